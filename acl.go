@@ -0,0 +1,182 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// ACL exposes methods to manage the consul access control lists.
+type ACL struct {
+	// The client used to send requests to the consul agent, which may be nil
+	// to indicate that a default client should be used. The client must be
+	// configured with a token that has the permissions to manage ACLs.
+	Client *Client
+}
+
+// ACLLink is a reference to an ACL policy or role, by ID or by name.
+type ACLLink struct {
+	ID   string `json:",omitempty"`
+	Name string `json:",omitempty"`
+}
+
+// ACLServiceIdentity grants a token or role the permissions needed by a service
+// to register itself and discover its upstreams.
+type ACLServiceIdentity struct {
+	ServiceName string
+	Datacenters []string `json:",omitempty"`
+}
+
+// ACLNodeIdentity grants a token or role the permissions needed by a consul
+// agent to register its node.
+type ACLNodeIdentity struct {
+	NodeName   string
+	Datacenter string
+}
+
+// ACLToken is a representation of a consul ACL token, which follows the
+// structure documented at https://www.consul.io/api/acl/tokens.html
+type ACLToken struct {
+	// The public identifier of the token, generated by consul if empty when
+	// the token is created.
+	AccessorID string `json:",omitempty"`
+
+	// The secret value of the token, this is the value that clients send with
+	// their requests. Generated by consul if empty when the token is created.
+	SecretID string `json:",omitempty"`
+
+	// A human-readable description of the token (optional).
+	Description string `json:",omitempty"`
+
+	// The policies, roles, and identities granting permissions to the token.
+	Policies          []ACLLink            `json:",omitempty"`
+	Roles             []ACLLink            `json:",omitempty"`
+	ServiceIdentities []ACLServiceIdentity `json:",omitempty"`
+	NodeIdentities    []ACLNodeIdentity    `json:",omitempty"`
+
+	// If true, the token is only valid in the datacenter it was created in.
+	Local bool `json:",omitempty"`
+
+	// The name of the auth method that created the token, if any.
+	AuthMethod string `json:",omitempty"`
+
+	// The time at which the token expires, nil if the token never expires.
+	ExpirationTime *time.Time `json:",omitempty"`
+
+	// May be set when creating the token to compute ExpirationTime relative
+	// to the creation time.
+	ExpirationTTL time.Duration `json:"-"`
+
+	// Fields set by consul.
+	CreateTime  time.Time
+	Hash        []byte `json:",omitempty"`
+	CreateIndex uint64 `json:",omitempty"`
+	ModifyIndex uint64 `json:",omitempty"`
+}
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (token ACLToken) MarshalJSON() ([]byte, error) {
+	type aclToken ACLToken
+	return json.Marshal(struct {
+		aclToken
+		ExpirationTTL duration `json:",omitempty"`
+	}{
+		aclToken:      aclToken(token),
+		ExpirationTTL: duration(token.ExpirationTTL),
+	})
+}
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface.
+func (token *ACLToken) UnmarshalJSON(b []byte) error {
+	type aclToken ACLToken
+	t := struct {
+		*aclToken
+		ExpirationTTL duration
+	}{
+		aclToken: (*aclToken)(token),
+	}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return err
+	}
+	token.ExpirationTTL = time.Duration(t.ExpirationTTL)
+	return nil
+}
+
+// ACLTokenFilter is used to narrow the list of tokens returned by ListTokens.
+// Empty fields are ignored.
+type ACLTokenFilter struct {
+	Policy     string
+	Role       string
+	AuthMethod string
+}
+
+// CreateToken creates a new ACL token, returning it with the fields populated
+// by consul.
+func (acl *ACL) CreateToken(ctx context.Context, token ACLToken) (created ACLToken, err error) {
+	err = acl.client().Put(ctx, "/v1/acl/token", nil, token, &created)
+	return
+}
+
+// ReadToken returns the ACL token with the given accessor ID.
+func (acl *ACL) ReadToken(ctx context.Context, accessorID string) (token ACLToken, err error) {
+	err = acl.client().Get(ctx, "/v1/acl/token/"+accessorID, nil, &token)
+	return
+}
+
+// ReadSelfToken returns the ACL token that the client is configured with.
+func (acl *ACL) ReadSelfToken(ctx context.Context) (token ACLToken, err error) {
+	err = acl.client().Get(ctx, "/v1/acl/token/self", nil, &token)
+	return
+}
+
+// UpdateToken updates the ACL token identified by the AccessorID field of the
+// token argument, returning the updated token.
+func (acl *ACL) UpdateToken(ctx context.Context, token ACLToken) (updated ACLToken, err error) {
+	err = acl.client().Put(ctx, "/v1/acl/token/"+token.AccessorID, nil, token, &updated)
+	return
+}
+
+// CloneToken creates a new ACL token with the same permissions as the token
+// with the given accessor ID, returning the new token.
+func (acl *ACL) CloneToken(ctx context.Context, accessorID string, description string) (clone ACLToken, err error) {
+	err = acl.client().Put(ctx, "/v1/acl/token/"+accessorID+"/clone", nil, struct {
+		Description string `json:",omitempty"`
+	}{description}, &clone)
+	return
+}
+
+// DeleteToken deletes the ACL token with the given accessor ID.
+func (acl *ACL) DeleteToken(ctx context.Context, accessorID string) error {
+	return acl.client().Delete(ctx, "/v1/acl/token/"+accessorID, nil, nil)
+}
+
+// ListTokens returns the list of ACL tokens matching the given filter. Secret
+// IDs are not included in the results.
+func (acl *ACL) ListTokens(ctx context.Context, filter ACLTokenFilter) (tokens []ACLToken, err error) {
+	var query Query
+
+	if len(filter.Policy) != 0 {
+		query = append(query, Param{Name: "policy", Value: filter.Policy})
+	}
+
+	if len(filter.Role) != 0 {
+		query = append(query, Param{Name: "role", Value: filter.Role})
+	}
+
+	if len(filter.AuthMethod) != 0 {
+		query = append(query, Param{Name: "authmethod", Value: filter.AuthMethod})
+	}
+
+	err = acl.client().Get(ctx, "/v1/acl/tokens", query, &tokens)
+	return
+}
+
+func (acl *ACL) client() *Client {
+	if client := acl.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+// DefaultACL is an ACL manager configured to use the default client.
+var DefaultACL = &ACL{}
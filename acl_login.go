@@ -0,0 +1,70 @@
+package consul
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+)
+
+// KubernetesServiceAccountTokenFile is the path at which kubernetes mounts the
+// service account token of pods, it may be used as BearerTokenFile to login
+// with a kubernetes auth method.
+const KubernetesServiceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// ACLLogin carries the parameters used to exchange a bearer token issued by a
+// trusted identity provider (kubernetes, JWT issuer, ...) for a consul ACL
+// token.
+type ACLLogin struct {
+	// The name of the auth method configured in consul to validate the bearer
+	// token.
+	AuthMethod string
+
+	// The bearer token presented to the auth method, like a kubernetes service
+	// account token or a JWT.
+	BearerToken string
+
+	// When BearerToken is empty, the bearer token is read from this file
+	// instead. Reading the file on every login allows the identity provider to
+	// rotate the bearer token.
+	BearerTokenFile string
+
+	// Arbitrary metadata set on the created token (optional).
+	Meta map[string]string
+}
+
+// Login exchanges a bearer token for a consul ACL token using an auth method.
+// The SecretID of the returned token may be set on the Token field of clients
+// to authorize their requests.
+func (acl *ACL) Login(ctx context.Context, login ACLLogin) (token ACLToken, err error) {
+	bearerToken := login.BearerToken
+
+	if len(bearerToken) == 0 && len(login.BearerTokenFile) != 0 {
+		var b []byte
+		if b, err = ioutil.ReadFile(login.BearerTokenFile); err != nil {
+			return
+		}
+		bearerToken = strings.TrimSpace(string(b))
+	}
+
+	err = acl.client().Do(ctx, "POST", "/v1/acl/login", nil, struct {
+		AuthMethod  string
+		BearerToken string
+		Meta        map[string]string `json:",omitempty"`
+	}{
+		AuthMethod:  login.AuthMethod,
+		BearerToken: bearerToken,
+		Meta:        login.Meta,
+	}, &token)
+	return
+}
+
+// Logout destroys a token that was previously obtained by calling Login, the
+// secretID argument is the SecretID of the token.
+func (acl *ACL) Logout(ctx context.Context, secretID string) error {
+	// The logout endpoint destroys the token that the request was made with,
+	// we make a copy of the client to override the token.
+	client := *acl.client()
+	client.Token = secretID
+	client.TokenProvider = nil
+	return client.Do(ctx, "POST", "/v1/acl/logout", nil, nil, nil)
+}
@@ -0,0 +1,218 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLoginRetryInterval is the interval at which LoginToken retries
+	// failed logins when it has none configured.
+	DefaultLoginRetryInterval = 5 * time.Second
+
+	// DefaultLogoutTimeout is the time limit given to LoginToken to logout
+	// its token when it is stopped.
+	DefaultLogoutTimeout = 5 * time.Second
+)
+
+// LoginToken is a TokenProvider which obtains its token by logging in with an
+// auth method, and logs in again before the token expires so clients using it
+// are never left with an expired token.
+//
+// Consul has no API to extend the lifetime of a token, renewing a token means
+// exchanging the bearer token for a new one, which is why the bearer token
+// should be read from a file when the identity provider rotates it. Previous
+// tokens are not logged out when they are renewed since requests may still be
+// using them, they are left to expire.
+//
+// A LoginToken must be started by calling Start before it can provide tokens.
+type LoginToken struct {
+	// The client used to login, the token it is configured with is not used.
+	// If nil, DefaultClient is used.
+	Client *Client
+
+	// The parameters of the logins.
+	Login ACLLogin
+
+	// How long before the expiration of the token it is renewed. If zero,
+	// tokens are renewed when a third of their lifetime remains.
+	RenewBefore time.Duration
+
+	// The interval at which failed renewals are retried. If zero,
+	// DefaultLoginRetryInterval is used.
+	RetryInterval time.Duration
+
+	// The clock used to schedule renewals. If nil, DefaultClock is used.
+	Clock Clock
+
+	// If not nil, called with every new token, including the one obtained by
+	// Start.
+	OnRenewed func(ACLToken)
+
+	// If not nil, called in the background goroutine with the errors of
+	// failed renewals, which are retried. If nil, the errors are reported to
+	// the error handler of the client.
+	OnRenewFailed func(error)
+
+	mutex   sync.RWMutex
+	token   ACLToken
+	started bool
+	err     error
+}
+
+// Start logs in, then keeps renewing the token in a background goroutine
+// until ctx is canceled, at which point the current token is logged out.
+//
+// An error is returned if the first login fails, in which case no goroutine
+// is started. Tokens which never expire are not renewed.
+func (t *LoginToken) Start(ctx context.Context) error {
+	t.mutex.Lock()
+	started := t.started
+	t.started = true
+	t.mutex.Unlock()
+
+	if started {
+		return errors.New("consul: the login token was already started")
+	}
+
+	token, err := t.login(ctx)
+	if err != nil {
+		t.mutex.Lock()
+		t.started = false
+		t.mutex.Unlock()
+		return err
+	}
+
+	go t.run(ctx, token)
+	return nil
+}
+
+// Token satisfies the TokenProvider interface.
+//
+// Once the token expired without being renewed, Token returns an error
+// wrapping the error of the last renewal attempt.
+func (t *LoginToken) Token(ctx context.Context) (string, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	switch {
+	case !t.started:
+		return "", errors.New("consul: the login token was not started")
+	case t.err != nil:
+		return "", t.err
+	default:
+		return t.token.SecretID, nil
+	}
+}
+
+// ACLToken returns the current token.
+func (t *LoginToken) ACLToken() ACLToken {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.token
+}
+
+func (t *LoginToken) run(ctx context.Context, token ACLToken) {
+	defer func() { t.logout(token) }()
+
+	clock := t.clock()
+
+	for token.ExpirationTime != nil {
+		issuedAt := clock.Now()
+		expireAt := *token.ExpirationTime
+
+		if err := Sleep(ctx, clock, t.renewAt(issuedAt, expireAt).Sub(issuedAt)); err != nil {
+			return
+		}
+
+		for {
+			renewed, err := t.login(ctx)
+			if err == nil {
+				token = renewed
+				break
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			t.renewFailed(err)
+
+			if now := clock.Now(); !now.Before(expireAt) {
+				t.mutex.Lock()
+				t.err = fmt.Errorf("consul: the ACL token obtained from %s expired at %s: %w", t.Login.AuthMethod, expireAt.Format(time.RFC3339), err)
+				t.mutex.Unlock()
+			}
+
+			if Sleep(ctx, clock, t.retryInterval()) != nil {
+				return
+			}
+		}
+	}
+
+	<-ctx.Done()
+}
+
+func (t *LoginToken) login(ctx context.Context) (ACLToken, error) {
+	token, err := (&ACL{Client: t.client()}).Login(ctx, t.Login)
+	if err != nil {
+		return token, fmt.Errorf("consul: login with %s: %w", t.Login.AuthMethod, err)
+	}
+
+	t.mutex.Lock()
+	t.token, t.err = token, nil
+	t.mutex.Unlock()
+
+	if t.OnRenewed != nil {
+		t.OnRenewed(token)
+	}
+	return token, nil
+}
+
+func (t *LoginToken) logout(token ACLToken) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultLogoutTimeout)
+	defer cancel()
+
+	if err := (&ACL{Client: t.client()}).Logout(ctx, token.SecretID); err != nil {
+		t.client().handleError(fmt.Errorf("consul: logout of the ACL token obtained from %s: %w", t.Login.AuthMethod, err))
+	}
+}
+
+func (t *LoginToken) renewFailed(err error) {
+	if t.OnRenewFailed != nil {
+		t.OnRenewFailed(err)
+	} else {
+		t.client().handleError(err)
+	}
+}
+
+// renewAt returns the time at which a token issued at issuedAt and expiring at
+// expireAt must be renewed.
+func (t *LoginToken) renewAt(issuedAt time.Time, expireAt time.Time) time.Time {
+	renewBefore := t.RenewBefore
+	if renewBefore <= 0 {
+		renewBefore = expireAt.Sub(issuedAt) / 3
+	}
+	return expireAt.Add(-renewBefore)
+}
+
+func (t *LoginToken) client() *Client {
+	if client := t.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+func (t *LoginToken) retryInterval() time.Duration {
+	if retryInterval := t.RetryInterval; retryInterval > 0 {
+		return retryInterval
+	}
+	return DefaultLoginRetryInterval
+}
+
+func (t *LoginToken) clock() Clock {
+	return clockOrDefault(t.Clock)
+}
@@ -0,0 +1,143 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoginToken(t *testing.T) {
+	var logins int32
+	var failing int32
+	logouts := make(chan string, 10)
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method + " " + req.URL.Path {
+		case "POST /v1/acl/login":
+			if atomic.LoadInt32(&failing) != 0 {
+				res.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			n := atomic.AddInt32(&logins, 1)
+			json.NewEncoder(res).Encode(ACLToken{
+				SecretID:       fmt.Sprintf("token-%d", n),
+				AuthMethod:     "kubernetes",
+				ExpirationTime: timePtr(time.Now().Add(300 * time.Millisecond)),
+			})
+
+		case "POST /v1/acl/logout":
+			logouts <- req.Header.Get("X-Consul-Token")
+
+		default:
+			t.Error("unexpected request:", req.Method, req.URL.Path)
+		}
+	})
+	defer server.Close()
+
+	renewed := make(chan string, 10)
+	failures := make(chan error, 10)
+
+	token := &LoginToken{
+		Client:        client,
+		Login:         ACLLogin{AuthMethod: "kubernetes", BearerToken: "jwt"},
+		RetryInterval: 50 * time.Millisecond,
+		OnRenewed:     func(token ACLToken) { renewed <- token.SecretID },
+		OnRenewFailed: func(err error) {
+			select {
+			case failures <- err:
+			default:
+			}
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := token.Token(ctx); err == nil {
+		t.Error("expected an error getting the token before starting")
+	}
+
+	if err := token.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := token.Start(ctx); err == nil {
+		t.Error("expected an error starting the token twice")
+	}
+
+	if secret, err := token.Token(ctx); err != nil || secret != "token-1" {
+		t.Fatal("bad token:", secret, err)
+	}
+
+	for _, expected := range []string{"token-1", "token-2"} {
+		select {
+		case secret := <-renewed:
+			if secret != expected {
+				t.Error("bad renewed token:", secret)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the token was not renewed")
+		}
+	}
+
+	if secret, err := token.Token(ctx); err != nil || secret != "token-2" {
+		t.Error("bad token after renewal:", secret, err)
+	}
+
+	// When renewals keep failing, the token eventually expires.
+	atomic.StoreInt32(&failing, 1)
+
+	select {
+	case err := <-failures:
+		if !strings.HasPrefix(err.Error(), "consul: login with kubernetes: ") {
+			t.Error("bad renewal error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the renewal failure was not reported")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := token.Token(ctx); err != nil {
+			if !strings.Contains(err.Error(), "expired") {
+				t.Error("bad error:", err)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the token did not expire")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The token is usable again once the login succeeds, and logged out when
+	// the context is canceled.
+	atomic.StoreInt32(&failing, 0)
+
+	select {
+	case <-renewed:
+	case <-time.After(time.Second):
+		t.Fatal("the token was not renewed after the failures")
+	}
+
+	if secret, err := token.Token(ctx); err != nil || secret != "token-3" {
+		t.Error("bad token after recovering:", secret, err)
+	}
+
+	cancel()
+
+	select {
+	case secret := <-logouts:
+		if secret != "token-3" {
+			t.Error("bad token logged out:", secret)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the token was not logged out")
+	}
+}
+
+func timePtr(t time.Time) *time.Time { return &t }
@@ -0,0 +1,199 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// ACLAccess is an enumeration representing the levels of access that ACL rules
+// may grant.
+type ACLAccess string
+
+const (
+	// ACLRead grants read access to a resource.
+	ACLRead ACLAccess = "read"
+
+	// ACLWrite grants read and write access to a resource.
+	ACLWrite ACLAccess = "write"
+
+	// ACLList grants the permission to list keys of the key/value store.
+	ACLList ACLAccess = "list"
+
+	// ACLDeny denies all access to a resource.
+	ACLDeny ACLAccess = "deny"
+)
+
+// ACLRule is the access granted to a resource, or a set of resources sharing
+// a common prefix.
+type ACLRule struct {
+	Policy ACLAccess `json:"policy"`
+
+	// Only applicable to service rules, controls access to the intentions of
+	// the service.
+	Intentions ACLAccess `json:"intentions,omitempty"`
+}
+
+// ACLRules is a typed representation of the rules of an ACL policy.
+//
+// The maps are indexed by resource names (or name prefixes for the fields
+// ending with Prefix), the empty string may be used as prefix to match all
+// resources.
+type ACLRules struct {
+	ACL      ACLAccess `json:"acl,omitempty"`
+	Keyring  ACLAccess `json:"keyring,omitempty"`
+	Mesh     ACLAccess `json:"mesh,omitempty"`
+	Operator ACLAccess `json:"operator,omitempty"`
+
+	Agent         map[string]ACLRule `json:"agent,omitempty"`
+	AgentPrefix   map[string]ACLRule `json:"agent_prefix,omitempty"`
+	Event         map[string]ACLRule `json:"event,omitempty"`
+	EventPrefix   map[string]ACLRule `json:"event_prefix,omitempty"`
+	Key           map[string]ACLRule `json:"key,omitempty"`
+	KeyPrefix     map[string]ACLRule `json:"key_prefix,omitempty"`
+	Node          map[string]ACLRule `json:"node,omitempty"`
+	NodePrefix    map[string]ACLRule `json:"node_prefix,omitempty"`
+	Query         map[string]ACLRule `json:"query,omitempty"`
+	QueryPrefix   map[string]ACLRule `json:"query_prefix,omitempty"`
+	Service       map[string]ACLRule `json:"service,omitempty"`
+	ServicePrefix map[string]ACLRule `json:"service_prefix,omitempty"`
+	Session       map[string]ACLRule `json:"session,omitempty"`
+	SessionPrefix map[string]ACLRule `json:"session_prefix,omitempty"`
+}
+
+// String returns the representation of the rules in the JSON format accepted
+// by consul in the Rules field of ACL policies.
+func (rules ACLRules) String() string {
+	b, _ := json.Marshal(rules)
+	return string(b)
+}
+
+// ACLPolicy is a representation of a consul ACL policy, which follows the
+// structure documented at https://www.consul.io/api/acl/policies.html
+type ACLPolicy struct {
+	// The policy ID, generated by consul when the policy is created.
+	ID string `json:",omitempty"`
+
+	// The unique name of the policy.
+	Name string
+
+	// A human-readable description of the policy (optional).
+	Description string `json:",omitempty"`
+
+	// The rules of the policy in HCL or JSON format, ACLRules may be used to
+	// generate a valid value.
+	Rules string `json:",omitempty"`
+
+	// The list of datacenters that the policy is valid in, all datacenters if
+	// empty.
+	Datacenters []string `json:",omitempty"`
+
+	// Fields set by consul.
+	Hash        []byte `json:",omitempty"`
+	CreateIndex uint64 `json:",omitempty"`
+	ModifyIndex uint64 `json:",omitempty"`
+}
+
+// CreatePolicy creates a new ACL policy, returning it with the fields populated
+// by consul.
+func (acl *ACL) CreatePolicy(ctx context.Context, policy ACLPolicy) (created ACLPolicy, err error) {
+	err = acl.client().Put(ctx, "/v1/acl/policy", nil, policy, &created)
+	return
+}
+
+// ReadPolicy returns the ACL policy with the given ID.
+func (acl *ACL) ReadPolicy(ctx context.Context, id string) (policy ACLPolicy, err error) {
+	err = acl.client().Get(ctx, "/v1/acl/policy/"+id, nil, &policy)
+	return
+}
+
+// ReadPolicyByName returns the ACL policy with the given name.
+func (acl *ACL) ReadPolicyByName(ctx context.Context, name string) (policy ACLPolicy, err error) {
+	err = acl.client().Get(ctx, "/v1/acl/policy/name/"+name, nil, &policy)
+	return
+}
+
+// UpdatePolicy updates the ACL policy identified by the ID field of the policy
+// argument, returning the updated policy.
+func (acl *ACL) UpdatePolicy(ctx context.Context, policy ACLPolicy) (updated ACLPolicy, err error) {
+	err = acl.client().Put(ctx, "/v1/acl/policy/"+policy.ID, nil, policy, &updated)
+	return
+}
+
+// DeletePolicy deletes the ACL policy with the given ID.
+func (acl *ACL) DeletePolicy(ctx context.Context, id string) error {
+	return acl.client().Delete(ctx, "/v1/acl/policy/"+id, nil, nil)
+}
+
+// ListPolicies returns the list of all ACL policies. The rules of the policies
+// are not included in the results.
+func (acl *ACL) ListPolicies(ctx context.Context) (policies []ACLPolicy, err error) {
+	err = acl.client().Get(ctx, "/v1/acl/policies", nil, &policies)
+	return
+}
+
+// ACLRole is a representation of a consul ACL role, which follows the structure
+// documented at https://www.consul.io/api/acl/roles.html
+type ACLRole struct {
+	// The role ID, generated by consul when the role is created.
+	ID string `json:",omitempty"`
+
+	// The unique name of the role.
+	Name string
+
+	// A human-readable description of the role (optional).
+	Description string `json:",omitempty"`
+
+	// The policies and identities granting permissions to the role.
+	Policies          []ACLLink            `json:",omitempty"`
+	ServiceIdentities []ACLServiceIdentity `json:",omitempty"`
+	NodeIdentities    []ACLNodeIdentity    `json:",omitempty"`
+
+	// Fields set by consul.
+	Hash        []byte `json:",omitempty"`
+	CreateIndex uint64 `json:",omitempty"`
+	ModifyIndex uint64 `json:",omitempty"`
+}
+
+// CreateRole creates a new ACL role, returning it with the fields populated by
+// consul.
+func (acl *ACL) CreateRole(ctx context.Context, role ACLRole) (created ACLRole, err error) {
+	err = acl.client().Put(ctx, "/v1/acl/role", nil, role, &created)
+	return
+}
+
+// ReadRole returns the ACL role with the given ID.
+func (acl *ACL) ReadRole(ctx context.Context, id string) (role ACLRole, err error) {
+	err = acl.client().Get(ctx, "/v1/acl/role/"+id, nil, &role)
+	return
+}
+
+// ReadRoleByName returns the ACL role with the given name.
+func (acl *ACL) ReadRoleByName(ctx context.Context, name string) (role ACLRole, err error) {
+	err = acl.client().Get(ctx, "/v1/acl/role/name/"+name, nil, &role)
+	return
+}
+
+// UpdateRole updates the ACL role identified by the ID field of the role
+// argument, returning the updated role.
+func (acl *ACL) UpdateRole(ctx context.Context, role ACLRole) (updated ACLRole, err error) {
+	err = acl.client().Put(ctx, "/v1/acl/role/"+role.ID, nil, role, &updated)
+	return
+}
+
+// DeleteRole deletes the ACL role with the given ID.
+func (acl *ACL) DeleteRole(ctx context.Context, id string) error {
+	return acl.client().Delete(ctx, "/v1/acl/role/"+id, nil, nil)
+}
+
+// ListRoles returns the list of ACL roles, if policy is not empty only the
+// roles linked to the policy with this ID are returned.
+func (acl *ACL) ListRoles(ctx context.Context, policy string) (roles []ACLRole, err error) {
+	var query Query
+
+	if len(policy) != 0 {
+		query = append(query, Param{Name: "policy", Value: policy})
+	}
+
+	err = acl.client().Get(ctx, "/v1/acl/roles", query, &roles)
+	return
+}
@@ -0,0 +1,247 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestACLTokens(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if token := req.Header.Get("X-Consul-Token"); token != "root" {
+			t.Error("bad token:", token)
+		}
+
+		switch req.Method + " " + req.URL.Path {
+		case "PUT /v1/acl/token":
+			var body map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&body)
+			if ttl := body["ExpirationTTL"]; ttl != "1h0m0s" {
+				t.Error("bad expiration TTL:", ttl)
+			}
+			if _, ok := body["AccessorID"]; ok {
+				t.Error("the accessor ID should have been omitted")
+			}
+			res.Write([]byte(`{"AccessorID":"1234","SecretID":"5678","Description":"test","ExpirationTTL":"1h0m0s"}`))
+
+		case "GET /v1/acl/token/self":
+			res.Write([]byte(`{"AccessorID":"0000","SecretID":"root"}`))
+
+		case "PUT /v1/acl/token/1234/clone":
+			res.Write([]byte(`{"AccessorID":"4321","SecretID":"8765","Description":"clone"}`))
+
+		case "DELETE /v1/acl/token/1234":
+			res.Write([]byte(`true`))
+
+		case "GET /v1/acl/tokens":
+			if policy := req.URL.Query().Get("policy"); policy != "read-only" {
+				t.Error("bad policy filter:", policy)
+			}
+			res.Write([]byte(`[{"AccessorID":"1234"},{"AccessorID":"4321"}]`))
+
+		default:
+			t.Error("unexpected request:", req.Method, req.URL.Path)
+		}
+	})
+	defer server.Close()
+
+	client.Token = "root"
+	acl := &ACL{Client: client}
+	ctx := context.Background()
+
+	token, err := acl.CreateToken(ctx, ACLToken{
+		Description:   "test",
+		Policies:      []ACLLink{{Name: "read-only"}},
+		ExpirationTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessorID != "1234" || token.SecretID != "5678" || token.ExpirationTTL != time.Hour {
+		t.Error("bad token created:", token)
+	}
+
+	self, err := acl.ReadSelfToken(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if self.SecretID != "root" {
+		t.Error("bad self token:", self)
+	}
+
+	clone, err := acl.CloneToken(ctx, token.AccessorID, "clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone.AccessorID != "4321" {
+		t.Error("bad token clone:", clone)
+	}
+
+	if err := acl.DeleteToken(ctx, token.AccessorID); err != nil {
+		t.Error(err)
+	}
+
+	tokens, err := acl.ListTokens(ctx, ACLTokenFilter{Policy: "read-only"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 {
+		t.Error("bad tokens:", tokens)
+	}
+}
+
+func TestACLRules(t *testing.T) {
+	rules := ACLRules{
+		Operator:  ACLRead,
+		KeyPrefix: map[string]ACLRule{"config/": {Policy: ACLList}},
+		Service:   map[string]ACLRule{"api": {Policy: ACLWrite, Intentions: ACLRead}},
+	}
+
+	const expect = `{"operator":"read","key_prefix":{"config/":{"policy":"list"}},"service":{"api":{"policy":"write","intentions":"read"}}}`
+
+	if s := rules.String(); s != expect {
+		t.Error("bad rules:")
+		t.Log("expected:", expect)
+		t.Log("found:   ", s)
+	}
+}
+
+func TestACLPoliciesAndRoles(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method + " " + req.URL.Path {
+		case "PUT /v1/acl/policy":
+			var policy ACLPolicy
+			json.NewDecoder(req.Body).Decode(&policy)
+			policy.ID = "1234"
+			json.NewEncoder(res).Encode(policy)
+
+		case "GET /v1/acl/policy/name/read-only":
+			res.Write([]byte(`{"ID":"1234","Name":"read-only"}`))
+
+		case "PUT /v1/acl/role":
+			var role ACLRole
+			json.NewDecoder(req.Body).Decode(&role)
+			role.ID = "5678"
+			json.NewEncoder(res).Encode(role)
+
+		case "GET /v1/acl/roles":
+			if policy := req.URL.Query().Get("policy"); policy != "1234" {
+				t.Error("bad policy filter:", policy)
+			}
+			res.Write([]byte(`[{"ID":"5678","Name":"readers"}]`))
+
+		case "DELETE /v1/acl/role/5678", "DELETE /v1/acl/policy/1234":
+			res.Write([]byte(`true`))
+
+		default:
+			t.Error("unexpected request:", req.Method, req.URL.Path)
+		}
+	})
+	defer server.Close()
+
+	acl := &ACL{Client: client}
+	ctx := context.Background()
+
+	policy, err := acl.CreatePolicy(ctx, ACLPolicy{
+		Name:  "read-only",
+		Rules: ACLRules{KeyPrefix: map[string]ACLRule{"": {Policy: ACLRead}}}.String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.ID != "1234" || policy.Rules != `{"key_prefix":{"":{"policy":"read"}}}` {
+		t.Error("bad policy created:", policy)
+	}
+
+	if policy, err = acl.ReadPolicyByName(ctx, "read-only"); err != nil {
+		t.Fatal(err)
+	}
+	if policy.ID != "1234" {
+		t.Error("bad policy:", policy)
+	}
+
+	role, err := acl.CreateRole(ctx, ACLRole{
+		Name:     "readers",
+		Policies: []ACLLink{{ID: policy.ID}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.ID != "5678" || len(role.Policies) != 1 || role.Policies[0].ID != "1234" {
+		t.Error("bad role created:", role)
+	}
+
+	roles, err := acl.ListRoles(ctx, policy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[0].Name != "readers" {
+		t.Error("bad roles:", roles)
+	}
+
+	if err := acl.DeleteRole(ctx, role.ID); err != nil {
+		t.Error(err)
+	}
+	if err := acl.DeletePolicy(ctx, policy.ID); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestACLLogin(t *testing.T) {
+	tokenFile, err := ioutil.TempFile("", "consul-go-acl-login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tokenFile.Name())
+	tokenFile.WriteString("service-account-jwt\n")
+	tokenFile.Close()
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method + " " + req.URL.Path {
+		case "POST /v1/acl/login":
+			var login struct {
+				AuthMethod  string
+				BearerToken string
+			}
+			json.NewDecoder(req.Body).Decode(&login)
+			if login.AuthMethod != "kubernetes" || login.BearerToken != "service-account-jwt" {
+				t.Error("bad login:", login)
+			}
+			res.Write([]byte(`{"AccessorID":"1234","SecretID":"5678","AuthMethod":"kubernetes"}`))
+
+		case "POST /v1/acl/logout":
+			if token := req.Header.Get("X-Consul-Token"); token != "5678" {
+				t.Error("bad token:", token)
+			}
+
+		default:
+			t.Error("unexpected request:", req.Method, req.URL.Path)
+		}
+	})
+	defer server.Close()
+
+	acl := &ACL{Client: client}
+	ctx := context.Background()
+
+	token, err := acl.Login(ctx, ACLLogin{
+		AuthMethod:      "kubernetes",
+		BearerTokenFile: tokenFile.Name(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.SecretID != "5678" {
+		t.Error("bad token:", token)
+	}
+
+	if err := acl.Logout(ctx, token.SecretID); err != nil {
+		t.Error(err)
+	}
+	if client.Token != "" {
+		t.Error("logging out must not modify the client")
+	}
+}
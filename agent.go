@@ -2,6 +2,7 @@ package consul
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
@@ -49,6 +50,8 @@ func (a *Agent) load(ctx context.Context) (*agentConfig, error) {
 	val, err := a.config.lookup(now, exp, func() (interface{}, error) {
 		config, err := a.client().agentConfig(ctx)
 		return &config, err
+	}, func(err error) {
+		a.client().handleError(fmt.Errorf("consul: refreshing the agent configuration: %w", err))
 	})
 
 	config, _ := val.(*agentConfig)
@@ -63,18 +66,37 @@ type agentConfig struct {
 	// This is a partial definition of the agent configuration object returned
 	// in response to a call to /v1/agent/self.
 	Config struct {
-		NodeName string
+		Datacenter string
+		NodeName   string
+	}
+
+	// The runtime configuration of the agent, where the addresses are
+	// formatted like "tcp://127.0.0.1:8500".
+	DebugConfig struct {
+		HTTPAddrs  []string
+		HTTPPort   int
+		HTTPSAddrs []string
+		HTTPSPort  int
+
+		// Agents older than consul 1.12 report their TLS settings at the top
+		// level, later versions in the HTTPS section of the TLS object.
+		agentSelfTLSConfig
+		TLS struct {
+			HTTPS agentSelfTLSConfig
+		}
 	}
 }
 
 type serviceConfig struct {
-	ID                string        `json:",omitempty"`
-	Name              string        `json:",omitempty"`
-	Tags              []string      `json:",omitempty"`
-	Address           string        `json:",omitempty"`
-	Port              int           `json:",omitempty"`
-	EnableTagOverride bool          `json:",omitempty"`
-	Checks            []checkConfig `json:",omitempty"`
+	ID                string            `json:",omitempty"`
+	Name              string            `json:",omitempty"`
+	Tags              []string          `json:",omitempty"`
+	Meta              map[string]string `json:",omitempty"`
+	Address           string            `json:",omitempty"`
+	Port              int               `json:",omitempty"`
+	EnableTagOverride bool              `json:",omitempty"`
+	Checks            []checkConfig     `json:",omitempty"`
+	Connect           *ServiceConnect   `json:",omitempty"`
 }
 
 type checkConfig struct {
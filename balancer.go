@@ -2,6 +2,7 @@ package consul
 
 import (
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"os"
 	"sync/atomic"
@@ -29,6 +30,30 @@ type Balancer interface {
 	Balance(name string, endpoints []Endpoint) []Endpoint
 }
 
+// RTTBalancer is implemented by balancers which can tell whether they use the
+// RTT of endpoints to balance them.
+//
+// Resolvers configured with LazyCoordinates only fetch the coordinates needed
+// to compute the RTT of endpoints when their balancer uses it. Balancers which
+// don't implement the interface are assumed to use the RTT.
+type RTTBalancer interface {
+	Balancer
+
+	// UsesRTT returns true if the balancer reads the RTT of endpoints.
+	UsesRTT() bool
+}
+
+// balancerUsesRTT returns true if b may use the RTT of endpoints.
+func balancerUsesRTT(b Balancer) bool {
+	if b == nil {
+		return false
+	}
+	if rb, ok := b.(RTTBalancer); ok {
+		return rb.UsesRTT()
+	}
+	return true
+}
+
 // BalancerFunc allows regular functions to be used as balancers.
 type BalancerFunc func(string, []Endpoint) []Endpoint
 
@@ -57,6 +82,16 @@ func (m *multiBalancer) Balance(name string, endpoints []Endpoint) []Endpoint {
 	return endpoints
 }
 
+// UsesRTT satisfies the RTTBalancer interface.
+func (m *multiBalancer) UsesRTT() bool {
+	for _, b := range m.balancers {
+		if balancerUsesRTT(b) {
+			return true
+		}
+	}
+	return false
+}
+
 // A LoadBalancer is an implementation of Balancer which maintains a set of
 // balancers that are local to each service name that Balance has been called
 // for.
@@ -195,6 +230,9 @@ func (rr *RoundRobin) Balance(name string, endpoints []Endpoint) []Endpoint {
 	return endpoints[i : i+1]
 }
 
+// UsesRTT satisfies the RTTBalancer interface.
+func (rr *RoundRobin) UsesRTT() bool { return false }
+
 // Rotator is the implementation of a load balancing algorithms similar to
 // RoundRobin but which returns the full list of endpoints instead of a single
 // one.
@@ -215,6 +253,9 @@ func (rr *Rotator) Balance(name string, endpoints []Endpoint) []Endpoint {
 	return endpoints
 }
 
+// UsesRTT satisfies the RTTBalancer interface.
+func (rr *Rotator) UsesRTT() bool { return false }
+
 func rotate(endpoints []Endpoint, d int) {
 	reverse(endpoints[:d])
 	reverse(endpoints[d:])
@@ -283,6 +324,9 @@ func (tags PreferTags) Balance(name string, endpoints []Endpoint) []Endpoint {
 	return endpoints[:i]
 }
 
+// UsesRTT satisfies the RTTBalancer interface.
+func (tags PreferTags) UsesRTT() bool { return false }
+
 func containsTag(tags []string, tag string) bool {
 	for _, candidate := range tags {
 		if candidate == tag {
@@ -322,19 +366,41 @@ func PreferEC2AvailabilityZone(c *http.Client) Balancer {
 
 // Shuffler is a Balancer implementation which returns a randomly shuffled list
 // of endpoints.
-type Shuffler struct{}
+type Shuffler struct {
+	// The source of random numbers used to shuffle endpoints, which does not
+	// need to be safe to use concurrently. Using a source with a fixed seed
+	// makes the order of endpoints reproducible, which is useful in tests.
+	//
+	// If nil, a time-seeded source is used.
+	Source rand.Source
+
+	rand sourceRand
+}
 
 // Balance satsifies the Balancer interface.
-func (*Shuffler) Balance(name string, endpoints []Endpoint) []Endpoint {
-	Shuffle(endpoints)
+func (s *Shuffler) Balance(name string, endpoints []Endpoint) []Endpoint {
+	if s.Source == nil {
+		Shuffle(endpoints)
+	} else {
+		s.rand.do(s.Source, func(rng *rand.Rand) { ShuffleWith(endpoints, rng) })
+	}
 	return endpoints
 }
 
+// UsesRTT satisfies the RTTBalancer interface.
+func (s *Shuffler) UsesRTT() bool { return false }
+
 // WeightedShuffler is a Balancer implementation which shuffles the list of
 // endpoints using a different weight for each endpoint.
 type WeightedShuffler struct {
 	// WeightOf returns the weight of an endpoint.
 	WeightOf func(Endpoint) float64
+
+	// The source of random numbers used to shuffle endpoints, see
+	// Shuffler.Source for details.
+	Source rand.Source
+
+	rand sourceRand
 }
 
 // Balance satisfies the Balancer interface.
@@ -345,10 +411,18 @@ func (ws *WeightedShuffler) Balance(name string, endpoints []Endpoint) []Endpoin
 		weightOf = func(_ Endpoint) float64 { return 1.0 }
 	}
 
-	WeightedShuffle(endpoints, weightOf)
+	if ws.Source == nil {
+		WeightedShuffle(endpoints, weightOf)
+	} else {
+		ws.rand.do(ws.Source, func(rng *rand.Rand) { WeightedShuffleWith(endpoints, weightOf, rng) })
+	}
 	return endpoints
 }
 
+// UsesRTT satisfies the RTTBalancer interface. Weight functions are opaque,
+// so the shuffler is assumed to use the RTT when WeightOf is set.
+func (ws *WeightedShuffler) UsesRTT() bool { return ws.WeightOf != nil }
+
 // NullBalancer is a balancer which doesn't modify the list of endpoints.
 type NullBalancer struct{}
 
@@ -357,6 +431,9 @@ func (*NullBalancer) Balance(name string, endpoints []Endpoint) []Endpoint {
 	return endpoints
 }
 
+// UsesRTT satisfies the RTTBalancer interface.
+func (*NullBalancer) UsesRTT() bool { return false }
+
 func defaultCacheBalancer() Balancer {
 	switch os.Getenv("CONSUL_CACHE_BALANCER") {
 	case "ec2-zone-affinity":
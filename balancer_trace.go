@@ -0,0 +1,176 @@
+package consul
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BalancerTrace describes the decision made by a balancer on a call to its
+// Balance method, it is reported by TracedBalancer.
+type BalancerTrace struct {
+	// The service name passed to the balancer.
+	Name string
+
+	// A description of the balancer and of how it orders endpoints, for
+	// example "weighted shuffle" or "preferred tags [us-west-2a]".
+	Balancer string
+
+	// The endpoints the balancer was called with, in their original order.
+	Candidates []Endpoint
+
+	// The weights of the candidates, for balancers which weight endpoints
+	// (nil otherwise).
+	Weights []float64
+
+	// The endpoints returned by the balancer, sorted by preference.
+	Result []Endpoint
+
+	// The traces of each of the balancers composed by MultiBalancer, in the
+	// order they were called.
+	Steps []BalancerTrace
+}
+
+// Dropped returns the candidates which were excluded from the result, because
+// the balancer selected a subset of the endpoints.
+func (t BalancerTrace) Dropped() []Endpoint {
+	var dropped []Endpoint
+
+	for _, c := range t.Candidates {
+		found := false
+
+		for _, r := range t.Result {
+			if c.ID == r.ID && c.Node == r.Node {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			dropped = append(dropped, c)
+		}
+	}
+
+	return dropped
+}
+
+// String returns a human-readable representation of the trace.
+func (t BalancerTrace) String() string {
+	s := fmt.Sprintf("%s: %s: %d candidates -> [%s]", t.Name, t.Balancer, len(t.Candidates), endpointIDs(t.Result))
+	for _, step := range t.Steps {
+		s += "\n  " + strings.ReplaceAll(step.String(), "\n", "\n  ")
+	}
+	return s
+}
+
+func endpointIDs(endpoints []Endpoint) string {
+	ids := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		ids[i] = e.ID
+	}
+	return strings.Join(ids, " ")
+}
+
+// TracedBalancer is a Balancer which reports the decisions of another balancer
+// to a trace function. It helps explaining uneven distributions of traffic
+// across the endpoints of services.
+//
+// Tracing copies the endpoints on every call, it is intended to be enabled
+// while investigating issues, or on a sample of the calls.
+type TracedBalancer struct {
+	// The balancer which decisions are traced.
+	Balancer Balancer
+
+	// Trace is called with the trace of each call to Balance. The function
+	// is called synchronously, it must not block, and it must be safe to call
+	// concurrently from multiple goroutines.
+	Trace func(BalancerTrace)
+}
+
+// Balance satisfies the Balancer interface.
+func (tb *TracedBalancer) Balance(name string, endpoints []Endpoint) []Endpoint {
+	trace, endpoints := traceBalance(tb.Balancer, name, endpoints)
+	if tb.Trace != nil {
+		tb.Trace(trace)
+	}
+	return endpoints
+}
+
+// UsesRTT satisfies the RTTBalancer interface.
+func (tb *TracedBalancer) UsesRTT() bool { return balancerUsesRTT(tb.Balancer) }
+
+func traceBalance(b Balancer, name string, endpoints []Endpoint) (trace BalancerTrace, result []Endpoint) {
+	trace = BalancerTrace{
+		Name:       name,
+		Balancer:   describeBalancer(b, name, endpoints),
+		Candidates: copyEndpoints(endpoints),
+	}
+
+	if ws, ok := b.(*WeightedShuffler); ok && ws.WeightOf != nil {
+		trace.Weights = make([]float64, len(endpoints))
+		for i, e := range endpoints {
+			trace.Weights[i] = ws.WeightOf(e)
+		}
+	}
+
+	switch m := b.(type) {
+	case nil:
+		result = endpoints
+	case *multiBalancer:
+		result = endpoints
+		for _, b := range m.balancers {
+			var step BalancerTrace
+			step, result = traceBalance(b, name, result)
+			trace.Steps = append(trace.Steps, step)
+		}
+	default:
+		result = b.Balance(name, endpoints)
+	}
+
+	trace.Result = copyEndpoints(result)
+	return
+}
+
+// describeBalancer returns a description of how b orders endpoints.
+func describeBalancer(b Balancer, name string, endpoints []Endpoint) string {
+	switch x := b.(type) {
+	case nil, *NullBalancer:
+		return "unchanged"
+	case *multiBalancer:
+		return fmt.Sprintf("%d balancers", len(x.balancers))
+	case *LoadBalancer:
+		if entry := x.cache()[name]; entry != nil {
+			return describeBalancer(entry.Balancer, name, endpoints)
+		}
+		return "new balancer"
+	case *RoundRobin:
+		return "round robin"
+	case *Rotator:
+		return "rotation"
+	case PreferTags:
+		for _, e := range endpoints {
+			for _, tag := range x {
+				if containsTag(e.Tags, tag) {
+					return fmt.Sprintf("preferred tags %v", []string(x))
+				}
+			}
+		}
+		return fmt.Sprintf("preferred tags %v (no match)", []string(x))
+	case *Shuffler:
+		return "shuffle"
+	case *WeightedShuffler:
+		if x.WeightOf == nil {
+			return "shuffle"
+		}
+		return "weighted shuffle"
+	case *TracedBalancer:
+		return describeBalancer(x.Balancer, name, endpoints)
+	case fmt.Stringer:
+		return x.String()
+	default:
+		return fmt.Sprintf("%T", b)
+	}
+}
+
+func copyEndpoints(endpoints []Endpoint) []Endpoint {
+	return append(make([]Endpoint, 0, len(endpoints)), endpoints...)
+}
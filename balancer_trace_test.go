@@ -0,0 +1,81 @@
+package consul
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestTracedBalancer(t *testing.T) {
+	endpoints := []Endpoint{
+		{ID: "A", Tags: []string{"us-west-2a"}},
+		{ID: "B", Tags: []string{"us-west-2b"}},
+		{ID: "C", Tags: []string{"us-west-2a"}},
+	}
+
+	var traces []BalancerTrace
+	balancer := &TracedBalancer{
+		Balancer: MultiBalancer(
+			PreferTags{"us-west-2a"},
+			&WeightedShuffler{
+				WeightOf: func(e Endpoint) float64 { return float64(len(e.ID)) },
+				Source:   rand.NewSource(0),
+			},
+		),
+		Trace: func(trace BalancerTrace) { traces = append(traces, trace) },
+	}
+
+	result := balancer.Balance("service", copyEndpoints(endpoints))
+
+	if len(traces) != 1 {
+		t.Fatal("bad number of traces:", len(traces))
+	}
+	trace := traces[0]
+
+	if trace.Name != "service" || trace.Balancer != "2 balancers" {
+		t.Errorf("bad trace: %+v", trace)
+	}
+	if !reflect.DeepEqual(trace.Candidates, endpoints) || !reflect.DeepEqual(trace.Result, result) {
+		t.Errorf("bad candidates or result: %+v", trace)
+	}
+	if dropped := trace.Dropped(); len(dropped) != 1 || dropped[0].ID != "B" {
+		t.Error("bad dropped endpoints:", dropped)
+	}
+
+	if len(trace.Steps) != 2 {
+		t.Fatal("bad number of steps:", len(trace.Steps))
+	}
+	if s := trace.Steps[0]; s.Balancer != "preferred tags [us-west-2a]" || len(s.Result) != 2 {
+		t.Errorf("bad first step: %+v", s)
+	}
+	if s := trace.Steps[1]; s.Balancer != "weighted shuffle" || !reflect.DeepEqual(s.Weights, []float64{1, 1}) {
+		t.Errorf("bad second step: %+v", s)
+	}
+
+	if balancer.UsesRTT() != true {
+		t.Error("the traced balancer must use the RTT when the balancer it wraps does")
+	}
+}
+
+func TestDescribeBalancer(t *testing.T) {
+	lb := &LoadBalancer{New: func() Balancer { return &RoundRobin{} }}
+	lb.Balance("service", []Endpoint{{ID: "A"}})
+
+	tests := []struct {
+		balancer    Balancer
+		description string
+	}{
+		{balancer: nil, description: "unchanged"},
+		{balancer: &Rotator{}, description: "rotation"},
+		{balancer: &Shuffler{}, description: "shuffle"},
+		{balancer: PreferTags{"nope"}, description: "preferred tags [nope] (no match)"},
+		{balancer: lb, description: "round robin"},
+		{balancer: BalancerFunc(nil), description: "consul.BalancerFunc"},
+	}
+
+	for _, test := range tests {
+		if s := describeBalancer(test.balancer, "service", []Endpoint{{ID: "A"}}); s != test.description {
+			t.Errorf("bad description of %T: %q", test.balancer, s)
+		}
+	}
+}
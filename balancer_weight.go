@@ -0,0 +1,92 @@
+package consul
+
+import (
+	"strconv"
+	"strings"
+)
+
+// DefaultWeightTag is the key of the tags that WeightExtractor reads the
+// weight of endpoints from, when it has neither a tag nor a metadata key
+// configured.
+const DefaultWeightTag = "weight"
+
+// WeightExtractor is a Balancer which sets the Weight of endpoints from one of
+// their tags, like "weight=25", or from their metadata, for services which
+// are not registered with native weights.
+//
+// The extractor is placed before a balancer which uses the weights, for
+// example:
+//
+//	rslv := &consul.Resolver{
+//		Balancer: consul.MultiBalancer(
+//			&consul.WeightExtractor{},
+//			&consul.WeightedShuffler{WeightOf: consul.InverseWeight},
+//		),
+//	}
+type WeightExtractor struct {
+	// The key of the tags holding the weight of endpoints, tags are expected
+	// to be formatted as "<key>=<weight>". If both Tag and MetaKey are empty,
+	// DefaultWeightTag is used.
+	Tag string
+
+	// The metadata key holding the weight of endpoints, which is read when
+	// the endpoints have no weight tag.
+	MetaKey string
+
+	// The weight of endpoints which have no weight, or an invalid one. If
+	// zero, their weight is left unchanged.
+	Default float64
+}
+
+// Balance satisfies the Balancer interface.
+func (x *WeightExtractor) Balance(name string, endpoints []Endpoint) []Endpoint {
+	for i := range endpoints {
+		if weight, ok := x.weightOf(endpoints[i]); ok {
+			endpoints[i].Weight = weight
+		} else if x.Default > 0 {
+			endpoints[i].Weight = x.Default
+		}
+	}
+	return endpoints
+}
+
+// UsesRTT satisfies the RTTBalancer interface.
+func (x *WeightExtractor) UsesRTT() bool { return false }
+
+func (x *WeightExtractor) weightOf(endpoint Endpoint) (float64, bool) {
+	tag, metaKey := x.Tag, x.MetaKey
+
+	if len(tag) == 0 && len(metaKey) == 0 {
+		tag = DefaultWeightTag
+	}
+
+	if len(tag) != 0 {
+		for _, t := range endpoint.Tags {
+			if strings.HasPrefix(t, tag) && strings.HasPrefix(t[len(tag):], "=") {
+				if weight, ok := parseWeight(t[len(tag)+1:]); ok {
+					return weight, true
+				}
+			}
+		}
+	}
+
+	if len(metaKey) != 0 {
+		if value, ok := endpoint.Meta[metaKey]; ok {
+			return parseWeight(value)
+		}
+	}
+
+	return 0, false
+}
+
+// parseWeight parses s as a weight, which must be a positive number.
+func parseWeight(s string) (float64, bool) {
+	weight, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || !(weight > 0) || weight > maxWeight {
+		return 0, false
+	}
+	return weight, true
+}
+
+// maxWeight bounds the weights parsed from tags, which excludes infinities.
+const maxWeight = 1e9
@@ -0,0 +1,78 @@
+package consul
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWeightExtractor(t *testing.T) {
+	endpoints := func() []Endpoint {
+		return []Endpoint{
+			{ID: "a", Tags: []string{"primary", "weight=25"}},
+			{ID: "b", Tags: []string{"weight=0.5"}, Meta: map[string]string{"lb-weight": "10"}},
+			{ID: "c", Meta: map[string]string{"lb-weight": "10"}},
+			{ID: "d", Tags: []string{"weight=-1", "weighted=3"}},
+			{ID: "e", Tags: []string{"weight=NaN"}, Meta: map[string]string{"lb-weight": "oops"}},
+		}
+	}
+
+	weights := func(endpoints []Endpoint) []float64 {
+		w := make([]float64, len(endpoints))
+		for i, e := range endpoints {
+			w[i] = e.Weight
+		}
+		return w
+	}
+
+	tests := []struct {
+		scenario  string
+		extractor WeightExtractor
+		weights   []float64
+	}{
+		{
+			scenario:  "weights are read from tags by default",
+			extractor: WeightExtractor{},
+			weights:   []float64{25, 0.5, 0, 0, 0},
+		},
+		{
+			scenario:  "weights are read from metadata when there is no weight tag",
+			extractor: WeightExtractor{Tag: "weight", MetaKey: "lb-weight"},
+			weights:   []float64{25, 0.5, 10, 0, 0},
+		},
+		{
+			scenario:  "only the configured metadata key is read",
+			extractor: WeightExtractor{MetaKey: "lb-weight"},
+			weights:   []float64{0, 10, 10, 0, 0},
+		},
+		{
+			scenario:  "endpoints without a valid weight get the default",
+			extractor: WeightExtractor{Default: 1},
+			weights:   []float64{25, 0.5, 1, 1, 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			res := test.extractor.Balance("web", endpoints())
+
+			if w := weights(res); !reflect.DeepEqual(w, test.weights) {
+				t.Error("bad weights:", w)
+			}
+		})
+	}
+}
+
+func TestInverseWeight(t *testing.T) {
+	for _, test := range []struct {
+		weight  float64
+		inverse float64
+	}{
+		{weight: 0, inverse: 1},
+		{weight: 1, inverse: 1},
+		{weight: 4, inverse: 0.25},
+	} {
+		if inverse := InverseWeight(Endpoint{Weight: test.weight}); inverse != test.inverse {
+			t.Errorf("bad inverse weight of %g: %g", test.weight, inverse)
+		}
+	}
+}
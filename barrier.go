@@ -0,0 +1,114 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Barrier blocks programs of a cluster until a number of participants have
+// reached it, for example to coordinate the steps of a rollout, or the workers
+// of a distributed test.
+//
+// Participants register by creating a key under the prefix of the barrier,
+// locked by their session, so participants which went away are not counted.
+type Barrier struct {
+	// The client used to send requests to the consul agent. If nil, the default
+	// client is used instead.
+	Client *Client
+
+	// The key prefix under which participants register.
+	Prefix string
+
+	// The number of participants that the barrier waits for.
+	Participants int
+
+	// The clock used to renew the sessions of participants and to schedule
+	// retries. If nil, DefaultClock is used.
+	Clock Clock
+}
+
+// Wait registers the caller as a participant of the barrier, and blocks until
+// the number of participants registered reached the size of the barrier, or
+// the context was canceled.
+//
+// The returned context is canceled when the registration is removed by calling
+// the cancellation function, or if it was lost, in this case the context's Err
+// method returns Unlocked. Participants which are slower to observe that the
+// barrier was reached may still be waiting when others leave it, so programs
+// should keep their registration until all participants are known to have
+// passed the barrier, for example until the coordinated step completed.
+func (b *Barrier) Wait(ctx context.Context) (context.Context, context.CancelFunc) {
+	if b.Participants <= 0 {
+		return errorContext(ctx, fmt.Errorf("consul: barrier %s has no participants", b.Prefix))
+	}
+
+	prefix := strings.TrimSuffix(b.Prefix, "/") + "/"
+	locker := &Locker{Client: b.Client, Clock: b.Clock}
+	client := locker.client()
+	clock := clockOrDefault(b.Clock)
+
+	sessionCtx, sessionCancel := locker.withSession(ctx, makeSessionName("barrier: ", prefix))
+
+	if sessionCtx.Err() != nil {
+		return sessionCtx, sessionCancel
+	}
+
+	session := contextSession(sessionCtx)
+	key := prefix + string(session.ID)
+	lock, unlock, err := locker.tryLock(sessionCtx, key)
+	if lock == nil {
+		sessionCancel()
+		return errorContext(ctx, coalesceError(ctx.Err(), err, Unlocked))
+	}
+
+	leave := func() {
+		leaveCtx, cancel := context.WithTimeout(context.Background(), locker.lockDelay())
+		client.Delete(leaveCtx, "/v1/kv/"+key, nil, nil)
+		cancel()
+		unlock()
+		sessionCancel()
+	}
+
+	var index uint64
+
+	for {
+		entries, lastIndex, err := client.fetchLockQueue(lock, prefix, index)
+
+		if err == nil {
+			participants, registered := 0, false
+
+			for _, e := range entries {
+				switch {
+				case len(e.Session) != 0:
+					participants++
+					registered = registered || e.Key == key && SessionID(e.Session) == session.ID
+				case e.Key != key:
+					// The registrations of participants which lost their
+					// session are removed, so they don't accumulate under the
+					// prefix.
+					client.Delete(lock, "/v1/kv/"+e.Key, Query{{"cas", strconv.FormatUint(e.ModifyIndex, 10)}}, nil)
+				}
+			}
+
+			if !registered {
+				leave()
+				return errorContext(ctx, coalesceError(ctx.Err(), Unlocked))
+			}
+			if participants >= b.Participants {
+				return lock, leave
+			}
+			index = lastIndex
+		} else {
+			index = 0
+			err = Sleep(lock, clock, 1*time.Second)
+		}
+
+		if err != nil || lock.Err() != nil {
+			leave()
+			return errorContext(ctx, coalesceError(ctx.Err(), lock.Err(), err))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package consul_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestBarrier(t *testing.T) {
+	agent, ctx := newFakeAgent(t)
+
+	barrier := &consul.Barrier{
+		Client:       agent.Client(),
+		Prefix:       "barrier",
+		Participants: 3,
+	}
+
+	registered := func() int {
+		return len(listKeys(t, agent, "barrier/"))
+	}
+
+	passed := make(chan context.CancelFunc, 2)
+
+	for i := 1; i <= 2; i++ {
+		go func() {
+			ctx, leave := barrier.Wait(ctx)
+			if err := ctx.Err(); err != nil {
+				t.Error(err)
+			}
+			passed <- leave
+		}()
+
+		for registered() != i {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	select {
+	case <-passed:
+		t.Fatal("a participant passed the barrier before all participants reached it")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	wait, leave := barrier.Wait(ctx)
+	if err := wait.Err(); err != nil {
+		t.Fatal(err)
+	}
+	leave()
+
+	for i := 0; i != 2; i++ {
+		select {
+		case leave := <-passed:
+			leave()
+		case <-ctx.Done():
+			t.Fatal("the participants did not pass the barrier")
+		}
+	}
+
+	if n := registered(); n != 0 {
+		t.Error("participants were left registered:", n)
+	}
+
+	// Participants which lost their session stop waiting.
+	done := make(chan error)
+	go func() {
+		ctx, leave := barrier.Wait(ctx)
+		defer leave()
+		done <- ctx.Err()
+	}()
+
+	for registered() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	sessions, _, err := (&consul.Sessions{Client: agent.Client()}).List(ctx, consul.SessionOptions{})
+	if err != nil || len(sessions) != 1 {
+		t.Fatal("expected a single session:", sessions, err)
+	}
+	agent.InvalidateSession(sessions[0].ID)
+
+	if err := <-done; !errors.Is(err, consul.Unlocked) {
+		t.Error("expected the registration to be lost but got:", err)
+	}
+	if n := registered(); n != 0 {
+		t.Error("the registration of the participant which lost its session was not removed:", n)
+	}
+}
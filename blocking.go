@@ -0,0 +1,91 @@
+package consul
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultWait is the duration that consul holds blocking queries for when
+	// they don't have a wait parameter.
+	defaultWait = 5 * time.Minute
+
+	// maxWaitMargin is the upper bound of the time reserved for blocking
+	// queries to complete after consul stopped waiting for changes.
+	maxWaitMargin = 1 * time.Second
+)
+
+// clipWait reduces the wait parameter of the blocking query so consul responds
+// before ctx expires, and before timeout (if non-zero) is reached. This way
+// the query returns the unchanged index instead of failing with a timeout.
+func clipWait(ctx context.Context, query Query, timeout time.Duration) Query {
+	limit := timeout
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if remain := time.Until(deadline); limit == 0 || remain < limit {
+			limit = remain
+		}
+	}
+
+	if limit == 0 {
+		return query
+	}
+
+	// Consul adds a random jitter of up to wait/16 to the wait time, the budget
+	// left after reserving time for the round trip must cover it as well.
+	margin := limit / 10
+	if margin > maxWaitMargin {
+		margin = maxWaitMargin
+	}
+	maxWait := (limit - margin) * 16 / 17
+
+	if wait := queryWait(query); wait <= maxWait {
+		return query
+	}
+
+	// A zero wait would make consul use its default, the shortest wait that
+	// can be expressed is one millisecond.
+	ms := int64(maxWait / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+
+	query.Add(Param{Name: "wait", Value: strconv.FormatInt(ms, 10) + "ms"})
+	return query
+}
+
+// queryWait returns the duration that consul holds the blocking query for if
+// the data it reads do not change.
+func queryWait(query Query) time.Duration {
+	wait := defaultWait
+	for _, p := range query {
+		if p.Name == "wait" {
+			if d, err := time.ParseDuration(p.Value); err == nil && d > 0 {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// maxQueryWait returns the longest time that consul may hold the blocking
+// query for, which includes the random jitter it adds to the wait time.
+func maxQueryWait(query Query) time.Duration {
+	wait := queryWait(query)
+	return wait + wait/16
+}
+
+// requestTimeout returns the time after which requests sent with transport or
+// httpClient time out while waiting for a response, or zero if there is no
+// such limit.
+func requestTimeout(transport http.RoundTripper, httpClient *http.Client) (timeout time.Duration) {
+	if t, ok := transport.(*http.Transport); ok {
+		timeout = t.ResponseHeaderTimeout
+	}
+	if httpClient != nil && httpClient.Timeout > 0 && (timeout == 0 || httpClient.Timeout < timeout) {
+		timeout = httpClient.Timeout
+	}
+	return
+}
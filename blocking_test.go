@@ -0,0 +1,101 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClipWait(t *testing.T) {
+	tests := []struct {
+		scenario string
+		query    Query
+		timeout  time.Duration
+		deadline time.Duration
+		expected string
+	}{
+		{
+			scenario: "no limits",
+			query:    Query{{"index", "1"}},
+			expected: "index=1",
+		},
+		{
+			scenario: "default wait clipped to the response timeout",
+			query:    Query{{"index", "1"}},
+			timeout:  5 * time.Second,
+			expected: "index=1&wait=4235ms",
+		},
+		{
+			scenario: "short wait left unchanged",
+			query:    Query{{"index", "1"}, {"wait", "2s"}},
+			timeout:  time.Minute,
+			expected: "index=1&wait=2s",
+		},
+		{
+			scenario: "wait clipped to the context deadline",
+			query:    Query{{"index", "1"}, {"wait", "10s"}},
+			timeout:  time.Minute,
+			deadline: 2 * time.Second,
+			expected: "index=1&wait=1694ms",
+		},
+		{
+			scenario: "expired deadline",
+			query:    Query{{"index", "1"}},
+			deadline: -time.Second,
+			expected: "index=1&wait=1ms",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			ctx := context.Background()
+
+			if test.deadline != 0 {
+				var cancel context.CancelFunc
+				// Round up so the time elapsed before calling clipWait doesn't
+				// change the expected value.
+				ctx, cancel = context.WithTimeout(ctx, test.deadline+time.Millisecond/2)
+				defer cancel()
+			}
+
+			if s := clipWait(ctx, test.query, test.timeout).String(); s != test.expected {
+				t.Errorf("bad query string:\n expected: %s\n found:    %s", test.expected, s)
+			}
+		})
+	}
+}
+
+func TestClientBlockingQueryTimeout(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		// Simulate a blocking query that never sees a change and honors the
+		// wait parameter.
+		wait, err := time.ParseDuration(req.URL.Query().Get("wait"))
+		if err != nil {
+			t.Error("bad wait parameter:", err)
+			wait = defaultWait
+		}
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return
+		}
+		res.Header().Set("X-Consul-Index", req.URL.Query().Get("index"))
+		json.NewEncoder(res).Encode(nil)
+	})
+	defer server.Close()
+
+	client.Transport = &http.Transport{ResponseHeaderTimeout: 200 * time.Millisecond}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	meta, err := client.GetWithMeta(ctx, "/v1/kv/key", Query{{"index", "42"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.LastIndex != 42 {
+		t.Error("bad index:", meta.LastIndex)
+	}
+}
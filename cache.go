@@ -1,6 +1,8 @@
 package consul
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -24,7 +26,19 @@ type cachedValueState struct {
 	expireAt time.Time
 }
 
-func (cache *cachedValue) lookup(now time.Time, exp time.Time, update func() (interface{}, error)) (interface{}, error) {
+// lookup returns the cached value, calling update to refresh it when it expired.
+// The errors of refreshes, which are discarded to keep serving the previous
+// value, are passed to discard.
+func (cache *cachedValue) lookup(now time.Time, exp time.Time, update func() (interface{}, error), discard func(error)) (interface{}, error) {
+	return cache.lookupUntil(now, func() (interface{}, time.Time, error) {
+		val, err := update()
+		return val, exp, err
+	}, discard)
+}
+
+// lookupUntil is like lookup but the expiration time is returned by update,
+// for values which carry their own lifetime.
+func (cache *cachedValue) lookupUntil(now time.Time, update func() (interface{}, time.Time, error), discard func(error)) (interface{}, error) {
 	state := cache.load()
 
 	// A nil state indicate that the value has never been set yet, this is the
@@ -32,7 +46,7 @@ func (cache *cachedValue) lookup(now time.Time, exp time.Time, update func() (in
 	// to be initialized before they can read it.
 	if state == nil {
 		cache.once.Do(func() {
-			val, err := update()
+			val, exp, err := update()
 			cache.store(&cachedValueState{value: val, error: err, expireAt: exp})
 		})
 		state = cache.load()
@@ -44,16 +58,16 @@ func (cache *cachedValue) lookup(now time.Time, exp time.Time, update func() (in
 	// goroutines.
 	if now.After(state.expireAt) {
 		if atomic.CompareAndSwapUint32(&state.lock, 0, 1) {
-			val, err := update()
+			val, exp, err := update()
 
 			// If an error occurred while trying to get an updated value we
 			// simply keep serving the previous value instead of discarding
 			// the cache.
-			//
-			// TODO: figure out how to report the error?
 			if err == nil {
 				state = &cachedValueState{value: val, error: err, expireAt: exp}
 				cache.store(state)
+			} else {
+				discard(err)
 			}
 
 			atomic.StoreUint32(&state.lock, 0)
@@ -63,6 +77,14 @@ func (cache *cachedValue) lookup(now time.Time, exp time.Time, update func() (in
 	return state.value, state.error
 }
 
+// expire marks the cached value as expired, the next lookup triggers an update
+// but keeps serving the current value while the update is in progress.
+func (cache *cachedValue) expire() {
+	if state := cache.load(); state != nil {
+		cache.store(&cachedValueState{value: state.value, error: state.error})
+	}
+}
+
 func (cache *cachedValue) load() *cachedValueState {
 	state, _ := cache.state.Load().(*cachedValueState)
 	return state
@@ -71,3 +93,105 @@ func (cache *cachedValue) load() *cachedValueState {
 func (cache *cachedValue) store(state *cachedValueState) {
 	cache.state.Store(state)
 }
+
+// Implementation of a cache for values kept up to date by a watch running in a
+// background goroutine.
+//
+// The watch is started by the first lookup, which blocks until the first value
+// was received, and runs until close is called. Errors occurring after the
+// first value was received are passed to the discard function given to
+// lookup, and the last known value keeps being served. When the first update
+// was an error, lookups return it until an update succeeds.
+//
+// Instances of watchedValue are safe to use concurrently from multiple
+// goroutines.
+type watchedValue struct {
+	once   sync.Once
+	mutex  sync.RWMutex
+	value  interface{}
+	error  error
+	ready  chan struct{}
+	cancel context.CancelFunc
+
+	// Status of the watch, reported by the status method.
+	running   bool
+	updatedAt time.Time
+	failure   error
+}
+
+func (cache *watchedValue) lookup(ctx context.Context, watch func(context.Context, func(interface{}, error)), discard func(error)) (interface{}, error) {
+	cache.once.Do(func() {
+		watchCtx, cancel := context.WithCancel(context.Background())
+		cache.ready = make(chan struct{})
+		cache.cancel = cancel
+
+		cache.mutex.Lock()
+		cache.running = true
+		cache.mutex.Unlock()
+
+		go watch(watchCtx, func(value interface{}, err error) {
+			discarded := false
+			cache.mutex.Lock()
+
+			if cache.failure = err; err == nil {
+				cache.updatedAt = time.Now()
+			}
+
+			select {
+			case <-cache.ready:
+				if err == nil {
+					// The first update may have failed, for example while the
+					// agent was starting, its error must not outlive it.
+					cache.value, cache.error = value, nil
+				} else {
+					discarded = true
+				}
+			default:
+				cache.value, cache.error = value, err
+				close(cache.ready)
+			}
+
+			cache.mutex.Unlock()
+
+			if discarded {
+				discard(err)
+			}
+		})
+	})
+
+	select {
+	case <-cache.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	cache.mutex.RLock()
+	value, err := cache.value, cache.error
+	cache.mutex.RUnlock()
+	return value, err
+}
+
+// status returns whether the watch is running, the time at which it last
+// received a value, and the error it last reported if it failed since then.
+func (cache *watchedValue) status() (running bool, updatedAt time.Time, err error) {
+	cache.mutex.RLock()
+	running, updatedAt, err = cache.running, cache.updatedAt, cache.failure
+	cache.mutex.RUnlock()
+	return
+}
+
+func (cache *watchedValue) close() {
+	cache.once.Do(func() {
+		cache.ready = make(chan struct{})
+		cache.error = errWatchedValueClosed
+		close(cache.ready)
+	})
+	if cancel := cache.cancel; cancel != nil {
+		cancel()
+	}
+	cache.mutex.Lock()
+	cache.running = false
+	cache.mutex.Unlock()
+}
+
+var errWatchedValueClosed = errors.New("the watch maintaining the cached value was closed")
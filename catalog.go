@@ -1,6 +1,9 @@
 package consul
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+)
 
 // Catalog exposes methods to interract with the consul catalog.
 type Catalog struct {
@@ -16,6 +19,87 @@ func (c *Catalog) ListServices(ctx context.Context) (services map[string][]strin
 	return
 }
 
+// Services is like ListServices but the query is configured by opts, it also
+// returns the query metadata, which may be used to issue blocking queries.
+func (c *Catalog) Services(ctx context.Context, opts CatalogOptions) (services map[string][]string, meta QueryMeta, err error) {
+	meta, err = c.client().GetWithMeta(ctx, "/v1/catalog/services", opts.Query(), &services)
+	return
+}
+
+// Node is a representation of a node registered to the consul catalog, which
+// follows the structure documented at
+// https://www.consul.io/api/catalog.html#list-nodes
+type Node struct {
+	ID              string
+	Node            string
+	Address         string
+	Datacenter      string
+	TaggedAddresses map[string]string
+	Meta            map[string]string
+}
+
+// ListNodes returns the list of nodes registered to consul.
+func (c *Catalog) ListNodes(ctx context.Context) (nodes []Node, err error) {
+	nodes, _, err = c.Nodes(ctx, CatalogOptions{})
+	return
+}
+
+// Nodes is like ListNodes but the query is configured by opts, it also returns
+// the query metadata, which may be used to issue blocking queries.
+func (c *Catalog) Nodes(ctx context.Context, opts CatalogOptions) (nodes []Node, meta QueryMeta, err error) {
+	var m responseMeta
+	m, err = c.client().getList(ctx, "/v1/catalog/nodes", opts.Query(), func(dec *json.Decoder) error {
+		nodes = append(nodes, Node{})
+		return dec.Decode(&nodes[len(nodes)-1])
+	})
+	meta = m.queryMeta()
+	return
+}
+
+// GatewayKind is an enumeration representing the kinds of gateways that may
+// front services in a consul service mesh.
+type GatewayKind string
+
+const (
+	// IngressGateway is the kind of gateways accepting traffic from outside
+	// of the service mesh.
+	IngressGateway GatewayKind = "ingress-gateway"
+
+	// TerminatingGateway is the kind of gateways routing traffic from the
+	// service mesh to services that are not part of it.
+	TerminatingGateway GatewayKind = "terminating-gateway"
+)
+
+// ServiceName is a service name qualified with the namespace it belongs to.
+type ServiceName struct {
+	Name      string
+	Namespace string `json:",omitempty"`
+}
+
+// GatewayService is a representation of a service fronted by a gateway, which
+// follows the structure documented at
+// https://www.consul.io/api-docs/catalog#list-services-for-gateway
+type GatewayService struct {
+	Gateway      ServiceName
+	Service      ServiceName
+	GatewayKind  GatewayKind
+	Port         int      `json:",omitempty"`
+	Protocol     string   `json:",omitempty"`
+	Hosts        []string `json:",omitempty"`
+	CAFile       string   `json:",omitempty"`
+	CertFile     string   `json:",omitempty"`
+	KeyFile      string   `json:",omitempty"`
+	SNI          string   `json:",omitempty"`
+	FromWildcard bool     `json:",omitempty"`
+}
+
+// ListGatewayServices returns the list of services that the gateway with the
+// given name fronts.
+func (c *Catalog) ListGatewayServices(ctx context.Context, gateway string) (services []GatewayService, err error) {
+	err = c.client().Get(ctx, "/v1/catalog/gateway-services/"+gateway, nil, &services)
+	return
+}
+
 func (c *Catalog) client() *Client {
 	if client := c.Client; client != nil {
 		return client
@@ -30,3 +114,14 @@ var DefaultCatalog = &Catalog{}
 func ListServices(ctx context.Context) (map[string][]string, error) {
 	return DefaultCatalog.ListServices(ctx)
 }
+
+// ListNodes is a helper function that delegates to the default catalog.
+func ListNodes(ctx context.Context) ([]Node, error) {
+	return DefaultCatalog.ListNodes(ctx)
+}
+
+// ListGatewayServices is a helper function that delegates to the default
+// catalog.
+func ListGatewayServices(ctx context.Context, gateway string) ([]GatewayService, error) {
+	return DefaultCatalog.ListGatewayServices(ctx, gateway)
+}
@@ -0,0 +1,57 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCatalog(t *testing.T) {
+	t.Run("ListGatewayServices", testCatalogListGatewayServices)
+}
+
+func testCatalogListGatewayServices(t *testing.T) {
+	services := []GatewayService{
+		{
+			Gateway:     ServiceName{Name: "ingress"},
+			Service:     ServiceName{Name: "api"},
+			GatewayKind: IngressGateway,
+			Port:        8080,
+			Protocol:    "http",
+			Hosts:       []string{"api.example.com"},
+		},
+		{
+			Gateway:      ServiceName{Name: "ingress"},
+			Service:      ServiceName{Name: "web"},
+			GatewayKind:  IngressGateway,
+			Port:         8080,
+			Protocol:     "http",
+			FromWildcard: true,
+		},
+	}
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" {
+			t.Error("bad method:", req.Method)
+		}
+		if req.URL.Path != "/v1/catalog/gateway-services/ingress" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		json.NewEncoder(res).Encode(services)
+	})
+	defer server.Close()
+
+	catalog := &Catalog{Client: client}
+
+	found, err := catalog.ListGatewayServices(context.Background(), "ingress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found, services) {
+		t.Error("bad gateway services:")
+		t.Logf("expected: %#v", services)
+		t.Logf("found:    %#v", found)
+	}
+}
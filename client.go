@@ -6,14 +6,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unsafe"
 )
 
 const (
@@ -28,22 +30,15 @@ var (
 	// DefaultTransport is the default HTTP transport used by consul clients.
 	// It differs from the default transport in net/http because we don't want
 	// to enable compression, or allow requests to be proxied. The sizes of the
-	// connection pool is also tuned to lower numbers since clients usually
+	// connection pool are also tuned to lower numbers since clients usually
 	// communicate with their local agent only. Finally the timeouts are set to
 	// lower values because the client and agent most likely communicate over
 	// the loopback interface.
-	DefaultTransport http.RoundTripper = &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout: 5 * time.Second,
-		}).DialContext,
-		DisableCompression:    true,
-		MaxIdleConns:          5,
-		MaxIdleConnsPerHost:   2,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   5 * time.Second,
-		ResponseHeaderTimeout: 5 * time.Second,
-		ExpectContinueTimeout: 5 * time.Second,
-	}
+	//
+	// The settings of the connection pool are the ones of
+	// DefaultConnectionPool, clients may use different settings with the
+	// WithConnectionPool option.
+	DefaultTransport http.RoundTripper = DefaultConnectionPool.Transport()
 
 	// DefaultClient is the default client used when none is specified.
 	DefaultClient = &Client{
@@ -57,6 +52,7 @@ var (
 
 func init() {
 	DefaultUserAgent = fmt.Sprintf("%s (github.com/segmentio/consul-go)", filepath.Base(os.Args[0]))
+	defaultUserAgentHeader = []string{DefaultUserAgent}
 }
 
 // A Client exposes an API for communicating with a consul agent.
@@ -79,10 +75,102 @@ type Client struct {
 	// If Datacenter is an empty string the agent's default is used.
 	Datacenter string
 
+	// Token is the ACL token sent with requests to authorize them.
+	// If Token is an empty string the agent's default token is used.
+	Token string
+
+	// TokenProvider may be set to obtain the ACL token sent with each request
+	// dynamically, which allows tokens to be rotated.
+	// If TokenProvider is not nil it takes precedence over Token.
+	TokenProvider TokenProvider
+
 	// Transport is the HTTP transport used by the client to send requests to
 	// its agent.
 	// If Transport is nil then DefaultTransport is used instead.
 	Transport http.RoundTripper
+
+	// HTTPClient may be set to send requests with a fully configured HTTP
+	// client (for cookie jars, redirect policies, ...) instead of a transport.
+	// If HTTPClient is not nil it takes precedence over Transport, and the
+	// transport of the HTTP client is used with the semantics of net/http.
+	HTTPClient *http.Client
+
+	// Logger is used by the client to report diagnostic messages.
+	// If Logger is nil then DefaultLogger is used instead.
+	Logger Logger
+
+	// Stats is used by the client, and the resolvers and sessions using it,
+	// to report metrics. If Stats is nil no metrics are reported.
+	Stats Stats
+
+	// ErrorHandler is called with the errors occurring in the background
+	// goroutines using the client, which have no caller to return them to:
+	// failed session renewals and destructions, retried watch queries, and
+	// failed cache refreshes.
+	// If ErrorHandler is nil then DefaultErrorHandler is used instead.
+	ErrorHandler func(error)
+
+	// RequestIDHeader may be set to the name of a header, like X-Request-Id,
+	// which carries an ID attached to every request sent to the agent. The
+	// ID is the one set on the request context by ContextWithRequestID, or a
+	// randomly generated one. Request IDs are included in the errors and log
+	// messages of the client, to correlate them with the logs of the agent
+	// or of proxies in front of it.
+	// If RequestIDHeader is empty no request IDs are sent.
+	RequestIDHeader string
+
+	// SlowRequestThreshold may be set to log a warning for every request
+	// which takes longer than the threshold to get a response from the agent.
+	// The time blocking queries are expected to wait for changes is not
+	// counted, they are slow when the agent holds them for longer than their
+	// wait time by more than the threshold.
+	// If SlowRequestThreshold is zero slow requests are not logged.
+	SlowRequestThreshold time.Duration
+
+	// Debug may be set to log the full requests and responses exchanged with
+	// the agent, including headers (with ACL tokens redacted), truncated
+	// bodies, and durations. It should only be enabled while diagnosing issues
+	// since it is costly and very verbose.
+	Debug bool
+
+	// Pointer to the *clientHealth tracking the outcome of requests, which is
+	// shared with clones of the client.
+	health unsafe.Pointer
+}
+
+// Clone returns a copy of c. The copy shares the transport of c, so deriving
+// clients is cheap and does not open new connections to the agent.
+func (c *Client) Clone() *Client {
+	// The health state is allocated first so the copy shares it, this also
+	// orders the read of the pointer after its initialization.
+	c.healthState()
+	copy := *c
+	return &copy
+}
+
+// WithDatacenter returns a copy of c which sends requests for the given
+// datacenter, c is left unchanged.
+func (c *Client) WithDatacenter(datacenter string) *Client {
+	copy := c.Clone()
+	copy.Datacenter = datacenter
+	return copy
+}
+
+// WithToken returns a copy of c which authorizes its requests with the given
+// ACL token, c is left unchanged. The token provider of c, if any, is not
+// inherited by the copy.
+func (c *Client) WithToken(token string) *Client {
+	copy := c.Clone()
+	copy.Token = token
+	copy.TokenProvider = nil
+	return copy
+}
+
+func (c *Client) logger() Logger {
+	if logger := c.Logger; logger != nil {
+		return logger
+	}
+	return DefaultLogger
 }
 
 func getConsulAddress() string {
@@ -119,22 +207,99 @@ func (c *Client) Delete(ctx context.Context, path string, query Query, recv inte
 // body of the request, which is usually of struct type, or nil if the request
 // has an empty body. The recv argument should be a pointer to a type which
 // matches the format of the response, or nil if no response is expected.
+//
+// The datacenter, consistency mode, and namespace set on ctx by
+// ContextWithDatacenter, ContextWithConsistency, and ContextWithNamespace are
+// applied to the request.
 func (c *Client) Do(ctx context.Context, method string, path string, query Query, send interface{}, recv interface{}) (err error) {
 	_, err = c.do(ctx, method, path, query, send, recv)
 	return
 }
 
+// QueryMeta carries the metadata that consul returns along with the responses
+// to read queries.
+type QueryMeta struct {
+	// The index of the data returned by the query, which may be used as
+	// starting point of blocking queries.
+	LastIndex uint64
+
+	// The amount of time since the server answering the query was last in
+	// contact with the leader.
+	LastContact time.Duration
+
+	// Whether the server answering the query knew about the leader.
+	KnownLeader bool
+}
+
+// GetWithMeta sends a GET request to the consul agent and returns the query
+// metadata found in the response headers. The metadata are returned even if
+// the request failed with an HTTP error status.
+//
+// See (*Client).Do for the full documentation.
+func (c *Client) GetWithMeta(ctx context.Context, path string, query Query, recv interface{}) (QueryMeta, error) {
+	meta, err := c.do(ctx, "GET", path, query, nil, recv)
+	return meta.queryMeta(), err
+}
+
+// getList sends a GET request to the consul agent, and decodes the JSON array
+// returned in the response one element at a time by calling decode.
+//
+// Unlike decoding the whole response at once, which buffers the full body in
+// memory, the decoder only holds one element at a time, which matters for
+// lists of thousands of services or nodes. The decoding also stops as soon as
+// ctx is canceled.
+func (c *Client) getList(ctx context.Context, path string, query Query, decode func(*json.Decoder) error) (meta responseMeta, err error) {
+	var header http.Header
+	var res io.ReadCloser
+
+	header, res, err = c.call(ctx, "GET", path, query, nil)
+	meta = parseRespMeta(header)
+	if err != nil {
+		return
+	}
+	defer res.Close()
+
+	dec := json.NewDecoder(res)
+	var tok json.Token
+
+	if tok, err = dec.Token(); err != nil {
+		return
+	}
+
+	switch tok {
+	case nil: // null
+		return
+	case json.Delim('['):
+	default:
+		err = fmt.Errorf("consul: %s: expected a JSON array but found %v", path, tok)
+		return
+	}
+
+	for dec.More() {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if err = decode(dec); err != nil {
+			return
+		}
+	}
+
+	_, err = dec.Token()
+	return
+}
+
 func (c *Client) do(ctx context.Context, method string, path string, query Query, send interface{}, recv interface{}) (meta responseMeta, err error) {
 	var req io.ReadCloser
 	var res io.ReadCloser
 	var header http.Header
 
 	if send != nil {
-		var b []byte
-		if b, err = json.Marshal(send); err != nil {
+		b := getRequestBuffer()
+		if err = b.encode(send); err != nil {
+			b.Close()
 			return
 		}
-		req = &buffer{bytes.NewReader(b)}
+		req = b
 	}
 
 	header, res, err = c.call(ctx, method, path, query, req)
@@ -156,11 +321,18 @@ func (c *Client) call(ctx context.Context, method string, path string, query Que
 	var address = c.Address
 	var transport = c.Transport
 	var userAgent = c.UserAgent
+	var token = c.Token
+
+	if provider := c.TokenProvider; provider != nil {
+		if token, err = provider.Token(ctx); err != nil {
+			return
+		}
+	}
 
 	if len(address) == 0 {
 		address = DefaultAddress
-	} else if i := strings.Index(address, "://"); i >= 0 {
-		scheme, address = address[:i], address[i+3:]
+	} else if s, hostport := splitAddress(address); len(s) != 0 {
+		scheme, address = s, hostport
 	}
 
 	if len(userAgent) == 0 {
@@ -171,6 +343,28 @@ func (c *Client) call(ctx context.Context, method string, path string, query Que
 		transport = DefaultTransport
 	}
 
+	httpClient := c.HTTPClient
+	if httpClient != nil {
+		transport = httpClient.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+	}
+
+	blocking := query.has("index")
+	if blocking {
+		query = clipWait(ctx, query, requestTimeout(transport, httpClient))
+	}
+
+	if c.Debug {
+		transport = &debugTransport{base: transport, logger: c.logger()}
+		if httpClient != nil {
+			copy := *httpClient
+			copy.Transport = transport
+			httpClient = &copy
+		}
+	}
+
 	var contentLength int64
 	switch v := send.(type) {
 	case nil:
@@ -183,9 +377,7 @@ func (c *Client) call(ctx context.Context, method string, path string, query Que
 		contentLength = -1
 	}
 
-	if dc := c.Datacenter; len(dc) != 0 {
-		query = append(query, Param{"dc", dc})
-	}
+	query = contextQuery(ctx, query, c.Datacenter)
 
 	url := &url.URL{
 		Scheme:   scheme,
@@ -194,23 +386,71 @@ func (c *Client) call(ctx context.Context, method string, path string, query Que
 		RawQuery: query.String(),
 	}
 
+	// The header values which are the same on all requests are shared, the
+	// transports only read them.
+	reqHeader := make(http.Header, 5)
+	reqHeader["Accept"] = jsonContentType
+	reqHeader["Content-Type"] = jsonContentType
+
+	// Programs may change DefaultUserAgent after the package was initialized,
+	// the shared header is only used if it holds the same value.
+	if userAgent == defaultUserAgentHeader[0] {
+		reqHeader["User-Agent"] = defaultUserAgentHeader
+	} else {
+		reqHeader["User-Agent"] = []string{userAgent}
+	}
+
+	if len(token) != 0 {
+		reqHeader["X-Consul-Token"] = []string{token}
+	}
+
+	var requestID string
+	if name := c.RequestIDHeader; len(name) != 0 {
+		requestID = contextRequestID(ctx)
+		reqHeader[http.CanonicalHeaderKey(name)] = []string{requestID}
+	}
+
 	req := &http.Request{
-		Method:     method,
-		URL:        url,
-		Proto:      "HTTP/1.1",
-		ProtoMajor: 1,
-		ProtoMinor: 1,
-		Header: http.Header{
-			"Accept":       {"application/json; charset=utf-8"},
-			"Content-Type": {"application/json; charset=utf-8"},
-			"Host":         {address},
-			"User-Agent":   {userAgent},
-		},
+		Method:        method,
+		URL:           url,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        reqHeader,
+		Host:          address,
 		Body:          send,
 		ContentLength: contentLength,
 	}
 
-	if res, err = transport.RoundTrip(req.WithContext(ctx)); err != nil {
+	start := time.Now()
+
+	if httpClient != nil {
+		res, err = httpClient.Do(req.WithContext(ctx))
+	} else {
+		res, err = transport.RoundTrip(req.WithContext(ctx))
+	}
+
+	c.healthState().observeResponse(ctx, start, res, err)
+
+	stats := c.Stats
+	if stats != nil {
+		c.reportRequest(stats, method, path, blocking, start, res, err)
+	}
+
+	if threshold := c.SlowRequestThreshold; threshold > 0 {
+		elapsed, expected := time.Since(start), time.Duration(0)
+		if blocking {
+			expected = maxQueryWait(query)
+		}
+		if elapsed-expected > threshold {
+			c.logSlowRequest(method, url, requestID, elapsed, res, err)
+		}
+	}
+
+	if err != nil {
+		if len(requestID) != 0 {
+			err = &requestError{requestID: requestID, err: err}
+		}
 		return
 	}
 
@@ -218,15 +458,33 @@ func (c *Client) call(ctx context.Context, method string, path string, query Que
 
 	if res.StatusCode == http.StatusOK {
 		recv = res.Body
+		if blocking && stats != nil {
+			recv = newTransferBody(recv, stats, path)
+		}
 		return
 	}
 
+	err = newHTTPError(method, url, requestID, res)
 	res.Body.Close()
-
-	err = newHTTPError(method, url, res)
 	return
 }
 
+// logSlowRequest logs a warning about a request which took longer than the
+// slow request threshold of the client.
+func (c *Client) logSlowRequest(method string, url *url.URL, requestID string, elapsed time.Duration, res *http.Response, err error) {
+	status := ""
+	if err != nil {
+		status = err.Error()
+	} else {
+		status = res.Status
+	}
+	if len(requestID) != 0 {
+		status += " (request id " + requestID + ")"
+	}
+	c.logger().Printf("slow request: %s %s took %s (threshold %s): %s",
+		method, url.Path, elapsed.Round(time.Millisecond), c.SlowRequestThreshold, status)
+}
+
 func parseRespMeta(h http.Header) responseMeta {
 	var ret responseMeta
 	if v, ok := h["X-Consul-KnownLeader"]; ok && len(v) > 0 {
@@ -247,6 +505,14 @@ type responseMeta struct {
 	translateAddresses bool
 }
 
+func (meta responseMeta) queryMeta() QueryMeta {
+	return QueryMeta{
+		LastIndex:   meta.index,
+		LastContact: time.Duration(meta.lastContact) * time.Millisecond,
+		KnownLeader: meta.knownLeader,
+	}
+}
+
 // Query is a representation of a URL query string as a list of parameters.
 type Query []Param
 
@@ -266,22 +532,94 @@ func (q *Query) Add(new Param) {
 	*q = append(ret, new)
 }
 
+func (q Query) has(name string) bool {
+	for _, p := range q {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // String satisfies the fmt.Stringer interface.
+//
+// The parameters are escaped like url.QueryEscape does, but the method
+// computes the exact size of the query string first so it only makes a single
+// allocation, since it runs on every request sent by clients.
 func (q Query) String() string {
-	b := make([]byte, 0, 100)
+	n := 0
+
+	for i, p := range q {
+		if i != 0 {
+			n++
+		}
+		n += queryEscapedLen(p.Name)
+		if len(p.Value) != 0 {
+			n += 1 + queryEscapedLen(p.Value)
+		}
+	}
+
+	if n == 0 {
+		return ""
+	}
+
+	b := strings.Builder{}
+	b.Grow(n)
 
 	for i, p := range q {
 		if i != 0 {
-			b = append(b, '&')
+			b.WriteByte('&')
 		}
-		b = append(b, url.QueryEscape(p.Name)...)
+		writeQueryEscaped(&b, p.Name)
 		if len(p.Value) != 0 {
-			b = append(b, '=')
-			b = append(b, url.QueryEscape(p.Value)...)
+			b.WriteByte('=')
+			writeQueryEscaped(&b, p.Value)
+		}
+	}
+
+	return b.String()
+}
+
+func queryEscapedLen(s string) int {
+	n := len(s)
+
+	for i := 0; i != len(s); i++ {
+		if c := s[i]; c != ' ' && shouldQueryEscape(c) {
+			n += 2
+		}
+	}
+
+	return n
+}
+
+func writeQueryEscaped(b *strings.Builder, s string) {
+	const hex = "0123456789ABCDEF"
+
+	for i := 0; i != len(s); i++ {
+		switch c := s[i]; {
+		case c == ' ':
+			b.WriteByte('+')
+		case shouldQueryEscape(c):
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		default:
+			b.WriteByte(c)
 		}
 	}
+}
 
-	return string(b)
+// shouldQueryEscape returns true if c must be escaped in query string
+// components, it matches the behavior of url.QueryEscape.
+func shouldQueryEscape(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return false
+	case c == '-', c == '_', c == '.', c == '~':
+		return false
+	default:
+		return true
+	}
 }
 
 // Values converts q to a url.Values.
@@ -300,3 +638,64 @@ type buffer struct {
 }
 
 func (*buffer) Close() error { return nil }
+
+var (
+	jsonContentType = []string{"application/json; charset=utf-8"}
+
+	// defaultUserAgentHeader is set by init, after DefaultUserAgent.
+	defaultUserAgentHeader []string
+)
+
+// requestBuffer is the body of requests sent by clients, which holds the JSON
+// representation of a value. Buffers are pooled, they are put back in the pool
+// when the transport closes them after sending the request.
+type requestBuffer struct {
+	buf    bytes.Buffer
+	rd     bytes.Reader
+	enc    *json.Encoder
+	closed uint32
+}
+
+var requestBufferPool = sync.Pool{
+	New: func() interface{} {
+		b := &requestBuffer{}
+		b.enc = json.NewEncoder(&b.buf)
+		return b
+	},
+}
+
+// maxPooledRequestBufferSize is the capacity above which buffers are not put
+// back in the pool, so the occasional large request doesn't pin its memory.
+const maxPooledRequestBufferSize = 64 * 1024
+
+func getRequestBuffer() *requestBuffer {
+	b := requestBufferPool.Get().(*requestBuffer)
+	atomic.StoreUint32(&b.closed, 0)
+	return b
+}
+
+func (b *requestBuffer) encode(v interface{}) error {
+	b.buf.Reset()
+	if err := b.enc.Encode(v); err != nil {
+		return err
+	}
+	// Remove the newline added by the encoder, so the body is the same as
+	// the output of json.Marshal.
+	b.buf.Truncate(b.buf.Len() - 1)
+	b.rd.Reset(b.buf.Bytes())
+	return nil
+}
+
+func (b *requestBuffer) Read(p []byte) (int, error) { return b.rd.Read(p) }
+
+func (b *requestBuffer) Len() int { return b.rd.Len() }
+
+func (b *requestBuffer) Close() error {
+	if atomic.CompareAndSwapUint32(&b.closed, 0, 1) {
+		b.rd.Reset(nil)
+		if b.buf.Cap() <= maxPooledRequestBufferSize {
+			requestBufferPool.Put(b)
+		}
+	}
+	return nil
+}
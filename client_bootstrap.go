@@ -0,0 +1,366 @@
+package consul
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+)
+
+// WithAgentConfigFile configures the client from the configuration of the
+// consul agent that it runs next to, so programs deployed alongside an agent
+// don't have to duplicate its settings.
+//
+// The path may be a single JSON or HCL file, or a configuration directory, in
+// which case the .json and .hcl files it contains are merged in lexical order,
+// the same way the agent loads its -config-dir.
+//
+// The address, datacenter, and TLS settings of the client are derived from
+// the client_addr, addresses, ports, datacenter, and tls (or legacy ca_file,
+// ca_path, cert_file, key_file) fields of the configuration. When the agent
+// exposes its HTTPS API the client uses it in preference to plain HTTP.
+func WithAgentConfigFile(path string) Option {
+	return func(config *clientConfig) error {
+		file, err := loadAgentConfigFile(path)
+		if err != nil {
+			return err
+		}
+		return file.configure(config)
+	}
+}
+
+// WithAgentSelf configures the client from the configuration reported by its
+// agent on /v1/agent/self. The request is sent once all other options have
+// been applied, with ctx, and NewClient fails if it could not be completed.
+//
+// The client is configured with the datacenter of the agent, and the address
+// and port of its API. When the agent exposes its HTTPS API the client uses it
+// in preference to plain HTTP, trusting the CA certificates of the agent.
+// Agents listening on all interfaces are reached on the host that the request
+// was sent to.
+//
+// The agent does not report the path to its private key, so the client does
+// not use the certificate of the agent, client certificates must be set with
+// WithTLS or WithAgentConfigFile.
+func WithAgentSelf(ctx context.Context) Option {
+	return func(config *clientConfig) error {
+		config.bootstrap = append(config.bootstrap, func(client *Client) error {
+			self, err := client.agentConfig(ctx)
+			if err != nil {
+				return fmt.Errorf("consul: bootstrapping the client from its agent: %w", err)
+			}
+
+			c := &clientConfig{client: *client}
+			if err := self.configure(c, config.tls); err != nil {
+				return fmt.Errorf("consul: bootstrapping the client from its agent: %w", err)
+			}
+
+			*client = c.client
+			return nil
+		})
+		return nil
+	}
+}
+
+type agentConfigFile struct {
+	Datacenter string `json:"datacenter" hcl:"datacenter"`
+	ClientAddr string `json:"client_addr" hcl:"client_addr"`
+
+	Addresses struct {
+		HTTP  string `json:"http" hcl:"http"`
+		HTTPS string `json:"https" hcl:"https"`
+	} `json:"addresses" hcl:"addresses"`
+
+	Ports struct {
+		HTTP  *int `json:"http" hcl:"http"`
+		HTTPS *int `json:"https" hcl:"https"`
+	} `json:"ports" hcl:"ports"`
+
+	agentTLSConfig `hcl:",squash"`
+
+	TLS struct {
+		Defaults agentTLSConfig `json:"defaults" hcl:"defaults"`
+		HTTPS    agentTLSConfig `json:"https" hcl:"https"`
+	} `json:"tls" hcl:"tls"`
+}
+
+type agentTLSConfig struct {
+	CAFile   string `json:"ca_file" hcl:"ca_file"`
+	CAPath   string `json:"ca_path" hcl:"ca_path"`
+	CertFile string `json:"cert_file" hcl:"cert_file"`
+	KeyFile  string `json:"key_file" hcl:"key_file"`
+}
+
+// agentSelfTLSConfig is the representation of agentTLSConfig in the responses
+// of /v1/agent/self.
+type agentSelfTLSConfig struct {
+	CAFile   string
+	CAPath   string
+	CertFile string
+	KeyFile  string
+}
+
+func loadAgentConfigFile(path string) (*agentConfigFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			switch filepath.Ext(entry.Name()) {
+			case ".json", ".hcl":
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+		sort.Strings(files)
+	}
+
+	config := &agentConfigFile{}
+
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		// Decoding each file on top of the previous ones merges their fields.
+		if filepath.Ext(file) == ".hcl" {
+			err = hcl.Unmarshal(b, config)
+		} else {
+			err = json.Unmarshal(b, config)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("consul: %s: %w", file, err)
+		}
+	}
+
+	return config, nil
+}
+
+func (file *agentConfigFile) configure(config *clientConfig) error {
+	if len(file.Datacenter) != 0 {
+		config.client.Datacenter = file.Datacenter
+	}
+
+	if port := file.Ports.HTTPS; port != nil && *port > 0 {
+		host, err := agentHost(file.Addresses.HTTPS, file.ClientAddr)
+		if err != nil {
+			return err
+		}
+		tlsConfig, err := file.tlsConfig()
+		if err != nil {
+			return err
+		}
+		config.client.Address = "https://" + net.JoinHostPort(host, strconv.Itoa(*port))
+		config.tls = tlsConfig
+		return nil
+	}
+
+	port := 8500
+	if p := file.Ports.HTTP; p != nil {
+		port = *p
+	}
+	if port <= 0 {
+		return errors.New("consul: the agent configuration disables both the HTTP and HTTPS APIs")
+	}
+
+	host, err := agentHost(file.Addresses.HTTP, file.ClientAddr)
+	if err != nil {
+		return err
+	}
+	config.client.Address = net.JoinHostPort(host, strconv.Itoa(port))
+	return nil
+}
+
+func (file *agentConfigFile) tlsConfig() (*tls.Config, error) {
+	settings := file.agentTLSConfig
+	settings.merge(file.TLS.Defaults)
+	settings.merge(file.TLS.HTTPS)
+	return settings.tlsConfig(&tls.Config{})
+}
+
+// tlsConfig returns a copy of base configured with the CA and certificate
+// files of settings.
+func (settings agentTLSConfig) tlsConfig(base *tls.Config) (*tls.Config, error) {
+	config := base.Clone()
+
+	if len(settings.CAFile) != 0 || len(settings.CAPath) != 0 {
+		roots := x509.NewCertPool()
+
+		files := []string{}
+		if len(settings.CAFile) != 0 {
+			files = append(files, settings.CAFile)
+		}
+		if len(settings.CAPath) != 0 {
+			matches, err := filepath.Glob(filepath.Join(settings.CAPath, "*"))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, matches...)
+		}
+
+		for _, file := range files {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			if !roots.AppendCertsFromPEM(b) && file == settings.CAFile {
+				return nil, fmt.Errorf("consul: %s: no certificates found", file)
+			}
+		}
+
+		config.RootCAs = roots
+	}
+
+	if len(settings.CertFile) != 0 || len(settings.KeyFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func (agent *agentConfig) configure(config *clientConfig, base *tls.Config) error {
+	debug := &agent.DebugConfig
+
+	_, hostport := splitAddress(config.client.Address)
+	if len(hostport) == 0 {
+		hostport = DefaultAddress
+	}
+	current, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return err
+	}
+
+	config.client.Datacenter = agent.Config.Datacenter
+
+	if debug.HTTPSPort > 0 {
+		settings := agentTLSConfig(debug.agentSelfTLSConfig)
+		settings.merge(agentTLSConfig(debug.TLS.HTTPS))
+
+		// The agent hides the path to its private key, the certificate is
+		// of no use without it.
+		settings.CertFile, settings.KeyFile = "", ""
+
+		config.client.Address = "https://" + net.JoinHostPort(agentSelfHost(debug.HTTPSAddrs, current), strconv.Itoa(debug.HTTPSPort))
+
+		if len(settings.CAFile) == 0 && len(settings.CAPath) == 0 {
+			return nil
+		}
+		if base == nil {
+			base = &tls.Config{}
+		}
+		tlsConfig, err := settings.tlsConfig(base)
+		if err != nil {
+			return err
+		}
+		config.tls = tlsConfig
+		return config.configureTLS()
+	}
+
+	// Agents which don't report their configuration, or have disabled both
+	// APIs, are left reachable at the address the request was sent to.
+	if debug.HTTPPort > 0 {
+		scheme, _ := splitAddress(config.client.Address)
+		address := net.JoinHostPort(agentSelfHost(debug.HTTPAddrs, current), strconv.Itoa(debug.HTTPPort))
+		if scheme == "http" {
+			address = "http://" + address
+		}
+		config.client.Address = address
+	}
+
+	return nil
+}
+
+// agentSelfHost returns the host that clients can use to reach an agent which
+// listens on the given addresses, falling back to the host that the client
+// already sends its requests to.
+func agentSelfHost(addrs []string, current string) string {
+	for _, addr := range addrs {
+		if !strings.HasPrefix(addr, "tcp://") {
+			continue // unix sockets
+		}
+		host, _, err := net.SplitHostPort(strings.TrimPrefix(addr, "tcp://"))
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+			return current
+		}
+		return host
+	}
+	return current
+}
+
+// merge overrides the settings of c with the non-empty settings of other,
+// which mirrors how consul applies the tls.https stanza over tls.defaults.
+func (c *agentTLSConfig) merge(other agentTLSConfig) {
+	if len(other.CAFile) != 0 {
+		c.CAFile = other.CAFile
+	}
+	if len(other.CAPath) != 0 {
+		c.CAPath = other.CAPath
+	}
+	if len(other.CertFile) != 0 {
+		c.CertFile = other.CertFile
+	}
+	if len(other.KeyFile) != 0 {
+		c.KeyFile = other.KeyFile
+	}
+}
+
+// agentHost returns the host that clients can use to reach an agent which
+// listens on the given addresses.
+func agentHost(addrs ...string) (string, error) {
+	for _, addr := range addrs {
+		fields := strings.Fields(addr)
+		if len(fields) == 0 {
+			continue
+		}
+
+		host := fields[0]
+
+		switch {
+		case strings.HasPrefix(host, "unix://"):
+			return "", fmt.Errorf("consul: agents listening on unix sockets are not supported (%s)", host)
+		case strings.Contains(host, "{{"):
+			return "", fmt.Errorf("consul: agent address templates are not supported (%s)", addr)
+		}
+
+		ip := net.ParseIP(host)
+		switch {
+		case ip == nil:
+			return host, nil
+		case ip.IsUnspecified() && ip.To4() != nil:
+			return "127.0.0.1", nil
+		case ip.IsUnspecified():
+			return "::1", nil
+		default:
+			return ip.String(), nil
+		}
+	}
+	return "127.0.0.1", nil
+}
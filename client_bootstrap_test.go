@@ -0,0 +1,321 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestWithAgentConfigFile(t *testing.T) {
+	tests := []struct {
+		scenario   string
+		file       string
+		config     string
+		address    string
+		datacenter string
+	}{
+		{
+			scenario: "defaults",
+			file:     "consul.json",
+			config:   `{}`,
+			address:  "127.0.0.1:8500",
+		},
+		{
+			scenario:   "client address and datacenter",
+			file:       "consul.json",
+			config:     `{"datacenter":"dc2","client_addr":"0.0.0.0"}`,
+			address:    "127.0.0.1:8500",
+			datacenter: "dc2",
+		},
+		{
+			scenario: "http address and port",
+			file:     "consul.json",
+			config:   `{"client_addr":"10.0.0.1 10.0.0.2","addresses":{"http":"10.0.0.3"},"ports":{"http":8600}}`,
+			address:  "10.0.0.3:8600",
+		},
+		{
+			scenario: "ipv6 client address",
+			file:     "consul.json",
+			config:   `{"client_addr":"::"}`,
+			address:  "[::1]:8500",
+		},
+		{
+			scenario: "hcl",
+			file:     "consul.hcl",
+			config: `
+datacenter  = "dc2"
+client_addr = "10.0.0.1 10.0.0.2"
+
+addresses {
+  http = "10.0.0.3"
+}
+
+ports {
+  http = 8600
+}
+`,
+			address:    "10.0.0.3:8600",
+			datacenter: "dc2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), test.file)
+			writeFile(t, path, test.config)
+
+			client, err := NewClient(WithAgentConfigFile(path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if client.Address != test.address {
+				t.Error("bad address:", client.Address)
+			}
+			if client.Datacenter != test.datacenter {
+				t.Error("bad datacenter:", client.Datacenter)
+			}
+		})
+	}
+}
+
+func TestWithAgentConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		scenario string
+		file     string
+		config   string
+		dir      bool
+	}{
+		{
+			scenario: "invalid hcl",
+			file:     "consul.hcl",
+			config:   `ports {`,
+		},
+		{
+			scenario: "invalid hcl in config dir",
+			file:     "consul.hcl",
+			config:   `ports { http = "x" }`,
+			dir:      true,
+		},
+		{
+			scenario: "unix socket",
+			file:     "consul.json",
+			config:   `{"addresses":{"http":"unix:///var/run/consul.sock"}}`,
+		},
+		{
+			scenario: "address template",
+			file:     "consul.json",
+			config:   `{"client_addr":"{{ GetPrivateIP }}"}`,
+		},
+		{
+			scenario: "disabled http api",
+			file:     "consul.json",
+			config:   `{"ports":{"http":-1}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, test.file)
+			writeFile(t, path, test.config)
+
+			if test.dir {
+				path = dir
+			}
+
+			if _, err := NewClient(WithAgentConfigFile(path)); err == nil {
+				t.Error("expected an error but got none")
+			}
+		})
+	}
+}
+
+func TestWithAgentConfigDirTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/agent/self" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		json.NewEncoder(res).Encode(map[string]interface{}{
+			"Config": map[string]interface{}{
+				"Datacenter": "dc2",
+				"NodeName":   "node-1",
+			},
+		})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	writeFile(t, filepath.Join(dir, "ca.pem"), string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	})))
+	writeFile(t, filepath.Join(dir, "00-base.json"), `{"datacenter":"dc1","client_addr":"0.0.0.0","ports":{"https":`+port+`}}`)
+	writeFile(t, filepath.Join(dir, "10-tls.json"), `{"tls":{"defaults":{"ca_file":"`+filepath.Join(dir, "ca.pem")+`"}}}`)
+
+	client, err := NewClient(
+		WithAgentConfigFile(dir),
+		WithAgentSelf(context.Background()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Address != "https://127.0.0.1:"+port {
+		t.Error("bad address:", client.Address)
+	}
+	if client.Datacenter != "dc2" {
+		t.Error("bad datacenter:", client.Datacenter)
+	}
+}
+
+func TestWithAgentConfigDirHCL(t *testing.T) {
+	dir := t.TempDir()
+
+	// The agent merges .json and .hcl files of its configuration directory in
+	// lexical order, regardless of their format.
+	writeFile(t, filepath.Join(dir, "00-base.hcl"), `
+datacenter  = "dc1"
+client_addr = "0.0.0.0"
+
+ports {
+  http = 8600
+}
+`)
+	writeFile(t, filepath.Join(dir, "10-datacenter.json"), `{"datacenter":"dc2"}`)
+	writeFile(t, filepath.Join(dir, "20-addresses.hcl"), `
+addresses {
+  http = "10.0.0.3"
+}
+`)
+	writeFile(t, filepath.Join(dir, "README.md"), `not a configuration file`)
+
+	client, err := NewClient(WithAgentConfigFile(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Address != "10.0.0.3:8600" {
+		t.Error("bad address:", client.Address)
+	}
+	if client.Datacenter != "dc2" {
+		t.Error("bad datacenter:", client.Datacenter)
+	}
+}
+
+func TestWithAgentSelf(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode("127.0.0.1:8300")
+	}))
+	defer tlsServer.Close()
+
+	dir := t.TempDir()
+	_, port, _ := net.SplitHostPort(tlsServer.Listener.Addr().String())
+	httpsPort, _ := strconv.Atoi(port)
+
+	writeFile(t, filepath.Join(dir, "ca.pem"), string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: tlsServer.Certificate().Raw,
+	})))
+
+	tests := []struct {
+		scenario string
+		config   map[string]interface{}
+		address  string
+	}{
+		{
+			scenario: "no runtime configuration",
+			config:   map[string]interface{}{},
+		},
+		{
+			scenario: "http",
+			config: map[string]interface{}{
+				"HTTPAddrs": []string{"unix:///var/run/consul.sock", "tcp://0.0.0.0:8600"},
+				"HTTPPort":  8600,
+				"HTTPSPort": -1,
+			},
+			address: "http://127.0.0.1:8600",
+		},
+		{
+			scenario: "https",
+			config: map[string]interface{}{
+				"HTTPAddrs":  []string{"tcp://127.0.0.1:8500"},
+				"HTTPPort":   8500,
+				"HTTPSAddrs": []string{"tcp://127.0.0.1:" + port},
+				"HTTPSPort":  httpsPort,
+				"TLS": map[string]interface{}{
+					"HTTPS": map[string]interface{}{
+						"CAFile":   filepath.Join(dir, "ca.pem"),
+						"CertFile": filepath.Join(dir, "agent.pem"),
+						"KeyFile":  "hidden",
+					},
+				},
+			},
+			address: "https://127.0.0.1:" + port,
+		},
+		{
+			scenario: "https with legacy tls settings",
+			config: map[string]interface{}{
+				"HTTPSAddrs": []string{"tcp://0.0.0.0:" + port},
+				"HTTPSPort":  httpsPort,
+				"CAFile":     filepath.Join(dir, "ca.pem"),
+			},
+			address: "https://127.0.0.1:" + port,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				json.NewEncoder(res).Encode(map[string]interface{}{
+					"Config": map[string]interface{}{
+						"Datacenter": "dc2",
+					},
+					"DebugConfig": test.config,
+				})
+			}))
+			defer server.Close()
+
+			client, err := NewClient(
+				WithAddress(server.URL),
+				WithAgentSelf(context.Background()),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			address := test.address
+			if len(address) == 0 {
+				address = server.URL
+			}
+			if client.Address != address {
+				t.Error("bad address:", client.Address)
+			}
+			if client.Datacenter != "dc2" {
+				t.Error("bad datacenter:", client.Datacenter)
+			}
+
+			// The client trusts the certificate of the HTTPS API of the agent.
+			if client.Address == tlsServer.URL {
+				var leader string
+				if err := client.Get(context.Background(), "/v1/status/leader", nil, &leader); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,276 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultEC2MetadataEndpoint is the address of the EC2 instance metadata
+	// service.
+	DefaultEC2MetadataEndpoint = "http://169.254.169.254"
+
+	// DefaultGCEMetadataEndpoint is the address of the GCE instance metadata
+	// server.
+	DefaultGCEMetadataEndpoint = "http://metadata.google.internal"
+
+	// DefaultAgentLocatorTimeout is the time limit applied to each agent
+	// locator when they have none configured. It is kept short since metadata
+	// services are link-local, and programs not running in the cloud would
+	// otherwise wait on them before falling back to the default address.
+	DefaultAgentLocatorTimeout = 1 * time.Second
+)
+
+// ErrAgentNotFound is returned by agent locators which have no address to
+// report, for example because the instance has no tag naming the agent.
+var ErrAgentNotFound = errors.New("consul: agent not found")
+
+// An AgentLocator discovers the address of the consul agent that programs
+// should send requests to, when it isn't running on localhost.
+type AgentLocator interface {
+	// LocateAgent returns the address of the agent, optionally prefixed with
+	// a scheme and without a port if the agent listens on the default one.
+	// ErrAgentNotFound is returned if the locator has no address to report.
+	LocateAgent(ctx context.Context) (string, error)
+}
+
+// AgentLocatorFunc allows regular functions to be used as agent locators.
+type AgentLocatorFunc func(context.Context) (string, error)
+
+// LocateAgent calls f.
+func (f AgentLocatorFunc) LocateAgent(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// WithAgentDiscovery configures the client to send requests to the agent
+// found by the first of the locators to return an address. The locators are
+// called in order, with ctx, once all other options have been applied, and
+// before the bootstrap requests of options like WithAgentSelf are sent.
+//
+// When none of the locators find an agent the client keeps its address, which
+// is DefaultAddress unless another was configured. The errors of locators are
+// logged, they never cause NewClient to fail since the discovery is optional.
+//
+// The CONSUL_HTTP_ADDR environment variable takes precedence, discovery is
+// skipped when it is set.
+func WithAgentDiscovery(ctx context.Context, locators ...AgentLocator) Option {
+	return func(config *clientConfig) error {
+		for _, locator := range locators {
+			if locator == nil {
+				return errors.New("consul: the agent locators must not be nil")
+			}
+		}
+
+		if _, ok := os.LookupEnv(ConsulEnvironment); ok {
+			return nil
+		}
+
+		discover := func(client *Client) error {
+			if address, ok := locateAgent(ctx, client, locators); ok {
+				client.Address = address
+			}
+			return nil
+		}
+
+		// Discovery runs first so the other bootstrap steps reach the agent.
+		config.bootstrap = append([]func(*Client) error{discover}, config.bootstrap...)
+		return nil
+	}
+}
+
+func locateAgent(ctx context.Context, client *Client, locators []AgentLocator) (string, bool) {
+	for _, locator := range locators {
+		address, err := callAgentLocator(ctx, locator)
+
+		if err == nil {
+			address, err = agentAddress(address, client.Address)
+		}
+
+		switch {
+		case err == nil:
+			return address, true
+		case errors.Is(err, ErrAgentNotFound):
+		default:
+			client.logger().Printf("locating the agent with %T: %s", locator, err)
+		}
+	}
+	return "", false
+}
+
+func callAgentLocator(ctx context.Context, locator AgentLocator) (string, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultAgentLocatorTimeout)
+		defer cancel()
+	}
+	return locator.LocateAgent(ctx)
+}
+
+// agentAddress returns the client address of an agent found at address, which
+// gets the default port when it has none, and the scheme of the current
+// address when it has no scheme, so clients configured with TLS keep using it.
+func agentAddress(address string, current string) (string, error) {
+	address = strings.TrimSpace(address)
+	if len(address) == 0 {
+		return "", ErrAgentNotFound
+	}
+
+	scheme, hostport := splitAddress(address)
+	if len(scheme) == 0 {
+		scheme, _ = splitAddress(current)
+	}
+
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		hostport = net.JoinHostPort(strings.Trim(hostport, "[]"), "8500")
+	}
+
+	if len(scheme) != 0 {
+		address = scheme + "://" + hostport
+	} else {
+		address = hostport
+	}
+
+	if err := validateAddress(address); err != nil {
+		return "", err
+	}
+	return address, nil
+}
+
+// StaticAgentProbe is an agent locator which returns the first of a list of
+// well-known addresses where an agent responds, like the address of the host
+// on a container bridge network, or a link-local address that agents are
+// bound to on every host of a cluster.
+type StaticAgentProbe struct {
+	// The addresses to probe, in order.
+	Addresses []string
+
+	// The transport used to send the probe requests. If nil, DefaultTransport
+	// is used.
+	Transport http.RoundTripper
+}
+
+// LocateAgent satisfies the AgentLocator interface.
+func (p *StaticAgentProbe) LocateAgent(ctx context.Context) (string, error) {
+	for _, address := range p.Addresses {
+		client := &Client{Address: address, Transport: p.Transport}
+		// The leader endpoint is available to all agents regardless of ACLs,
+		// responding is enough to tell that an agent listens on the address.
+		if _, err := (&Status{Client: client}).Leader(ctx); err == nil {
+			return address, nil
+		} else if ctx.Err() != nil {
+			return "", err
+		}
+	}
+	return "", ErrAgentNotFound
+}
+
+// EC2InstanceTag is an agent locator which reads the address of the agent from
+// a tag of the EC2 instance that the program runs on, using version 2 of the
+// instance metadata service. Tags must be allowed in the instance metadata for
+// the locator to find them.
+type EC2InstanceTag struct {
+	// The key of the tag holding the agent address.
+	Tag string
+
+	// The address of the metadata service. If empty,
+	// DefaultEC2MetadataEndpoint is used.
+	Endpoint string
+
+	// The transport used to query the metadata service. If nil,
+	// http.DefaultTransport is used.
+	Transport http.RoundTripper
+}
+
+// LocateAgent satisfies the AgentLocator interface.
+func (t *EC2InstanceTag) LocateAgent(ctx context.Context) (string, error) {
+	endpoint := metadataEndpoint(t.Endpoint, DefaultEC2MetadataEndpoint)
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "60")
+
+	token, err := fetchMetadata(t.Transport, req)
+	if err != nil {
+		return "", err
+	}
+
+	req, err = http.NewRequestWithContext(ctx, "GET", endpoint+"/latest/meta-data/tags/instance/"+url.PathEscape(t.Tag), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token", token)
+	return fetchMetadata(t.Transport, req)
+}
+
+// GCEInstanceAttribute is an agent locator which reads the address of the
+// agent from a custom metadata attribute of the GCE instance that the program
+// runs on.
+type GCEInstanceAttribute struct {
+	// The name of the attribute holding the agent address.
+	Attribute string
+
+	// The address of the metadata server. If empty,
+	// DefaultGCEMetadataEndpoint is used.
+	Endpoint string
+
+	// The transport used to query the metadata server. If nil,
+	// http.DefaultTransport is used.
+	Transport http.RoundTripper
+}
+
+// LocateAgent satisfies the AgentLocator interface.
+func (a *GCEInstanceAttribute) LocateAgent(ctx context.Context) (string, error) {
+	endpoint := metadataEndpoint(a.Endpoint, DefaultGCEMetadataEndpoint)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint+"/computeMetadata/v1/instance/attributes/"+url.PathEscape(a.Attribute), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return fetchMetadata(a.Transport, req)
+}
+
+func metadataEndpoint(endpoint string, def string) string {
+	if len(endpoint) == 0 {
+		endpoint = def
+	}
+	return strings.TrimSuffix(endpoint, "/")
+}
+
+// fetchMetadata sends req to a metadata service and returns the response body,
+// or ErrAgentNotFound if the value does not exist.
+func fetchMetadata(transport http.RoundTripper, req *http.Request) (string, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(http.MaxBytesReader(nil, res.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return strings.TrimSpace(string(b)), nil
+	case http.StatusNotFound:
+		return "", ErrAgentNotFound
+	default:
+		return "", fmt.Errorf("%s %s: %s", req.Method, req.URL, res.Status)
+	}
+}
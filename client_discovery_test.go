@@ -0,0 +1,183 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWithAgentDiscovery(t *testing.T) {
+	withoutConsulEnvironment(t)
+
+	metadata := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method + " " + req.URL.Path {
+		case "PUT /latest/api/token":
+			if req.Header.Get("X-Aws-Ec2-Metadata-Token-Ttl-Seconds") == "" {
+				t.Error("missing token TTL header")
+			}
+			res.Write([]byte("imds-token"))
+
+		case "GET /latest/meta-data/tags/instance/consul-agent":
+			if token := req.Header.Get("X-Aws-Ec2-Metadata-Token"); token != "imds-token" {
+				t.Error("bad metadata token:", token)
+			}
+			res.Write([]byte("10.0.0.1\n"))
+
+		case "GET /computeMetadata/v1/instance/attributes/consul-agent":
+			if flavor := req.Header.Get("Metadata-Flavor"); flavor != "Google" {
+				t.Error("bad metadata flavor:", flavor)
+			}
+			res.Write([]byte("https://10.0.0.2:8501"))
+
+		default:
+			http.NotFound(res, req)
+		}
+	}))
+	defer metadata.Close()
+
+	agent := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/status/leader":
+			res.Write([]byte(`"10.0.0.10:8300"`))
+		case "/v1/agent/self":
+			res.Write([]byte(`{"Config":{"Datacenter":"dc3"}}`))
+		default:
+			t.Error("unexpected request:", req.URL.Path)
+		}
+	}))
+	defer agent.Close()
+
+	ctx := context.Background()
+	notFound := AgentLocatorFunc(func(context.Context) (string, error) { return "", ErrAgentNotFound })
+
+	tests := []struct {
+		scenario string
+		locators []AgentLocator
+		address  string
+	}{
+		{
+			scenario: "ec2 instance tag",
+			locators: []AgentLocator{&EC2InstanceTag{Tag: "consul-agent", Endpoint: metadata.URL}},
+			address:  "10.0.0.1:8500",
+		},
+		{
+			scenario: "gce instance attribute",
+			locators: []AgentLocator{&GCEInstanceAttribute{Attribute: "consul-agent", Endpoint: metadata.URL}},
+			address:  "https://10.0.0.2:8501",
+		},
+		{
+			scenario: "missing tag falls back to the next locator",
+			locators: []AgentLocator{
+				&EC2InstanceTag{Tag: "missing", Endpoint: metadata.URL},
+				&GCEInstanceAttribute{Attribute: "consul-agent", Endpoint: metadata.URL},
+			},
+			address: "https://10.0.0.2:8501",
+		},
+		{
+			scenario: "probe of well-known addresses",
+			locators: []AgentLocator{&StaticAgentProbe{Addresses: []string{metadata.URL, agent.URL}}},
+			address:  agent.URL,
+		},
+		{
+			scenario: "no agent found",
+			locators: []AgentLocator{notFound},
+			address:  DefaultAddress,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			client, err := NewClient(WithAgentDiscovery(ctx, test.locators...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if client.Address != test.address {
+				t.Error("bad address:", client.Address)
+			}
+		})
+	}
+
+	t.Run("bootstrap requests are sent to the discovered agent", func(t *testing.T) {
+		client, err := NewClient(
+			WithAgentSelf(ctx),
+			WithAgentDiscovery(ctx, AgentLocatorFunc(func(context.Context) (string, error) {
+				return agent.URL, nil
+			})),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client.Datacenter != "dc3" {
+			t.Error("bad datacenter:", client.Datacenter)
+		}
+	})
+
+	t.Run("errors are logged", func(t *testing.T) {
+		logger := &testLogger{}
+		client, err := NewClient(
+			WithLogger(logger),
+			WithAgentDiscovery(ctx, AgentLocatorFunc(func(context.Context) (string, error) {
+				return "", errors.New("metadata unavailable")
+			})),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client.Address != DefaultAddress {
+			t.Error("bad address:", client.Address)
+		}
+		if log := logger.String(); !strings.Contains(log, "metadata unavailable") {
+			t.Error("the error was not logged:", log)
+		}
+	})
+
+	t.Run("the environment takes precedence", func(t *testing.T) {
+		os.Setenv(ConsulEnvironment, "10.0.0.9:8500")
+		defer os.Unsetenv(ConsulEnvironment)
+
+		client, err := NewClient(WithAgentDiscovery(ctx, &StaticAgentProbe{Addresses: []string{agent.URL}}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client.Address != "10.0.0.9:8500" {
+			t.Error("bad address:", client.Address)
+		}
+	})
+}
+
+func TestAgentAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		current string
+		result  string
+	}{
+		{address: "10.0.0.1", current: "localhost:8500", result: "10.0.0.1:8500"},
+		{address: "10.0.0.1:8600", current: "localhost:8500", result: "10.0.0.1:8600"},
+		{address: "fe80::1", current: "localhost:8500", result: "[fe80::1]:8500"},
+		{address: "10.0.0.1", current: "https://localhost:8501", result: "https://10.0.0.1:8500"},
+		{address: "http://10.0.0.1", current: "https://localhost:8501", result: "http://10.0.0.1:8500"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			result, err := agentAddress(test.address, test.current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result != test.result {
+				t.Error("bad address:", result)
+			}
+		})
+	}
+}
+
+func withoutConsulEnvironment(t *testing.T) {
+	if addr, ok := os.LookupEnv(ConsulEnvironment); ok {
+		os.Unsetenv(ConsulEnvironment)
+		t.Cleanup(func() { os.Setenv(ConsulEnvironment, addr) })
+	}
+}
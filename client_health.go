@@ -0,0 +1,228 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// ClientHealth is a report of the health of a client, as returned by
+// (*Client).Health.
+type ClientHealth struct {
+	// Whether the client could reach its agent when the report was made.
+	Healthy bool
+
+	// The address of the agent the client sends requests to.
+	Address string
+
+	// The address of the raft leader of the datacenter, as seen by the agent.
+	// Empty if the cluster had no leader or the agent could not be reached.
+	Leader string
+
+	// The error which occurred when checking the agent, if any.
+	Error string `json:",omitempty"`
+
+	// The times at which the client last got a response from its agent, and
+	// last failed to get one.
+	LastSuccess time.Time
+	LastFailure time.Time
+
+	// The number of requests which failed in a row since the last success.
+	ConsecutiveFailures int64
+
+	// The number of sessions created with the client which are still active,
+	// and the number of those which expired because they could not be renewed.
+	ActiveSessions  int64
+	ExpiredSessions int64
+}
+
+// Health checks that the client can reach its agent, and returns a report of
+// its health which includes the outcome of the requests it sent previously,
+// and the state of the sessions created with it.
+//
+// The method is intended to be used in the readiness checks of programs which
+// depend on consul, (*Client).HealthHandler exposes it over HTTP.
+func (c *Client) Health(ctx context.Context) ClientHealth {
+	var leader string
+	err := c.Get(ctx, "/v1/status/leader", nil, &leader)
+
+	h := c.healthState()
+	report := ClientHealth{
+		Healthy:             err == nil,
+		Address:             c.Address,
+		Leader:              leader,
+		LastSuccess:         unixNano(atomic.LoadInt64(&h.lastSuccess)),
+		LastFailure:         unixNano(atomic.LoadInt64(&h.lastFailure)),
+		ConsecutiveFailures: atomic.LoadInt64(&h.failures),
+		ActiveSessions:      atomic.LoadInt64(&h.sessions),
+		ExpiredSessions:     atomic.LoadInt64(&h.expiredSessions),
+	}
+
+	if len(report.Address) == 0 {
+		report.Address = DefaultAddress
+	}
+
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	return report
+}
+
+// HealthHandler returns a HTTP handler which serves the health report of c,
+// with a 200 status if the client is healthy, or 503 if it isn't.
+func (c *Client) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		report := c.Health(req.Context())
+		serveHealth(res, report.Healthy, report)
+	})
+}
+
+// clientHealth tracks the outcome of the requests sent by a client, and the
+// sessions created with it. Clients lazily allocate their health state, which
+// is shared with their clones.
+type clientHealth struct {
+	// Times are in nanoseconds since the epoch, all fields are manipulated
+	// using atomic operations.
+	lastSuccess     int64
+	lastFailure     int64
+	failures        int64
+	sessions        int64
+	expiredSessions int64
+}
+
+func (c *Client) healthState() *clientHealth {
+	for {
+		if h := atomic.LoadPointer(&c.health); h != nil {
+			return (*clientHealth)(h)
+		}
+		atomic.CompareAndSwapPointer(&c.health, nil, unsafe.Pointer(&clientHealth{}))
+	}
+}
+
+// observeResponse records the outcome of a request sent at the given time.
+// Requests interrupted by the cancellation of their context say nothing about
+// the agent and are ignored, as well as responses which were received but
+// indicate a failure of the agent.
+func (h *clientHealth) observeResponse(ctx context.Context, now time.Time, res *http.Response, err error) {
+	switch {
+	case err == nil && res.StatusCode < 500:
+		atomic.StoreInt64(&h.lastSuccess, now.UnixNano())
+		atomic.StoreInt64(&h.failures, 0)
+	case ctx.Err() == nil:
+		atomic.StoreInt64(&h.lastFailure, now.UnixNano())
+		atomic.AddInt64(&h.failures, 1)
+	}
+}
+
+func (h *clientHealth) sessionCreated() {
+	atomic.AddInt64(&h.sessions, 1)
+}
+
+func (h *clientHealth) sessionDestroyed(expired bool) {
+	atomic.AddInt64(&h.sessions, -1)
+	if expired {
+		atomic.AddInt64(&h.expiredSessions, 1)
+	}
+}
+
+// ResolverHealth is a report of the health of a resolver, as returned by
+// (*Resolver).Health.
+type ResolverHealth struct {
+	// Whether the resolver is healthy, which is the case when its client can
+	// reach the agent.
+	Healthy bool
+
+	// The health of the client used by the resolver.
+	Client ClientHealth
+
+	// The state of the resolver cache, nil if the resolver has no cache.
+	Cache *ResolverCacheHealth `json:",omitempty"`
+}
+
+// ResolverCacheHealth reports how fresh the entries of a resolver cache are.
+type ResolverCacheHealth struct {
+	// The number of service names in the cache.
+	Entries int
+
+	// The number of entries which expired, and will be refreshed the next time
+	// their name is resolved.
+	Expired int
+
+	// The names of services which could not be resolved on their last lookup.
+	Failed []string `json:",omitempty"`
+
+	// The time at which the least recently refreshed entry was resolved.
+	OldestUpdate time.Time
+}
+
+// Health checks the health of the client used by the resolver, and returns a
+// report which includes the staleness of the resolver cache.
+func (rslv *Resolver) Health(ctx context.Context) ResolverHealth {
+	report := ResolverHealth{Client: rslv.client().Health(ctx)}
+	report.Healthy = report.Client.Healthy
+
+	if cache := rslv.Cache; cache != nil {
+		h := cache.health()
+		report.Cache = &h
+	}
+
+	return report
+}
+
+// HealthHandler returns a HTTP handler which serves the health report of rslv,
+// with a 200 status if the resolver is healthy, or 503 if it isn't.
+func (rslv *Resolver) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		report := rslv.Health(req.Context())
+		serveHealth(res, report.Healthy, report)
+	})
+}
+
+func (cache *ResolverCache) health() ResolverCacheHealth {
+	entries := cache.cache()
+	now := clockOrDefault(cache.Clock).Now()
+	health := ResolverCacheHealth{Entries: len(entries)}
+
+	for name, entry := range entries {
+		if now.After(entry.expireAt) {
+			health.Expired++
+		}
+
+		if entry.err != nil {
+			health.Failed = append(health.Failed, name)
+		}
+
+		if update := entry.fetchedAt; health.OldestUpdate.IsZero() || update.Before(health.OldestUpdate) {
+			health.OldestUpdate = update
+		}
+	}
+
+	sort.Strings(health.Failed)
+	return health
+}
+
+func serveHealth(res http.ResponseWriter, healthy bool, report interface{}) {
+	status := http.StatusOK
+	if !healthy {
+		status = http.StatusServiceUnavailable
+	}
+	serveJSON(res, status, report)
+}
+
+func serveJSON(res http.ResponseWriter, status int, value interface{}) {
+	res.Header().Set("Content-Type", "application/json; charset=utf-8")
+	res.WriteHeader(status)
+	json.NewEncoder(res).Encode(value)
+}
+
+func unixNano(t int64) time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, t)
+}
@@ -0,0 +1,139 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientHealth(t *testing.T) {
+	failing := int32(0)
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&failing) != 0 {
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch req.URL.Path {
+		case "/v1/status/leader":
+			json.NewEncoder(res).Encode("10.0.0.1:8300")
+		case "/v1/session/create":
+			json.NewEncoder(res).Encode(struct{ ID string }{"1234"})
+		}
+	})
+	defer server.Close()
+
+	ctx, cancel := WithSession(context.Background(), Session{Client: client})
+	if err := ctx.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := client.Health(context.Background())
+	if !h.Healthy || h.Leader != "10.0.0.1:8300" || len(h.Error) != 0 {
+		t.Errorf("bad health: %+v", h)
+	}
+	if h.LastSuccess.IsZero() || !h.LastFailure.IsZero() || h.ConsecutiveFailures != 0 {
+		t.Errorf("bad request outcomes: %+v", h)
+	}
+	if h.ActiveSessions != 1 {
+		t.Error("bad number of active sessions:", h.ActiveSessions)
+	}
+
+	// Clones share the health state of the client they were derived from.
+	if c := client.WithDatacenter("dc2"); c.healthState() != client.healthState() {
+		t.Error("clones must share the health state")
+	}
+
+	atomic.StoreInt32(&failing, 1)
+	cancel()
+
+	h = client.Health(context.Background())
+	if h.Healthy || len(h.Error) == 0 {
+		t.Errorf("bad health: %+v", h)
+	}
+	if h.LastFailure.IsZero() || h.ConsecutiveFailures != 2 {
+		t.Errorf("bad request outcomes: %+v", h)
+	}
+	if h.ActiveSessions != 0 {
+		t.Error("bad number of active sessions:", h.ActiveSessions)
+	}
+}
+
+func TestClientHealthHandler(t *testing.T) {
+	status := int32(http.StatusOK)
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(int(atomic.LoadInt32(&status)))
+		res.Write([]byte(`""`))
+	})
+	defer server.Close()
+
+	for _, test := range []struct {
+		agent  int
+		status int
+	}{
+		{agent: http.StatusOK, status: http.StatusOK},
+		{agent: http.StatusInternalServerError, status: http.StatusServiceUnavailable},
+	} {
+		atomic.StoreInt32(&status, int32(test.agent))
+
+		rec := httptest.NewRecorder()
+		client.HealthHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+
+		if rec.Code != test.status {
+			t.Errorf("bad status for agent status %d: %d", test.agent, rec.Code)
+		}
+
+		var h ClientHealth
+		if err := json.NewDecoder(rec.Body).Decode(&h); err != nil {
+			t.Error(err)
+		}
+		if h.Healthy != (test.status == http.StatusOK) {
+			t.Errorf("bad health report for agent status %d: %+v", test.agent, h)
+		}
+	}
+}
+
+func TestResolverCacheHealth(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1e9, 0)}
+	cache := &ResolverCache{Clock: clock, CacheTimeout: time.Minute}
+
+	lookup := func(ctx context.Context, name string) ([]Endpoint, error) {
+		if name == "missing" {
+			return nil, ErrNotFound
+		}
+		return []Endpoint{{ID: name}}, nil
+	}
+
+	for _, name := range []string{"A", "missing", "B"} {
+		cache.LookupService(context.Background(), name, lookup)
+		clock.now = clock.now.Add(30 * time.Second)
+	}
+
+	h := cache.health()
+
+	if !reflect.DeepEqual(h, ResolverCacheHealth{
+		Entries:      3,
+		Expired:      1,
+		Failed:       []string{"missing"},
+		OldestUpdate: time.Unix(1e9, 0),
+	}) {
+		t.Errorf("bad cache health: %+v", h)
+	}
+}
+
+// manualClock is a clock which only moves when the test changes its time.
+type manualClock struct {
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time { return c.now }
+
+func (c *manualClock) NewTimer(d time.Duration) Timer { return DefaultClock.NewTimer(d) }
+
+func (c *manualClock) NewTicker(d time.Duration) Ticker { return DefaultClock.NewTicker(d) }
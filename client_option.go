@@ -0,0 +1,321 @@
+package consul
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// An Option configures a client created by NewClient.
+//
+// Options validate their arguments when they are applied, so misconfigured
+// clients are reported by NewClient instead of failing on the first request.
+type Option func(*clientConfig) error
+
+type clientConfig struct {
+	client Client
+	tls    *tls.Config
+	pool   *ConnectionPool
+
+	// Functions completing the configuration of the client once all options
+	// were applied.
+	bootstrap []func(*Client) error
+}
+
+// NewClient returns a client configured with the given options.
+//
+// Clients created by NewClient send requests to the agent found in the
+// CONSUL_HTTP_ADDR environment variable (or DefaultAddress) unless WithAddress
+// is used. An error is returned if any of the options is invalid or if the
+// options conflict with each other.
+//
+// NewClient is an alternative to setting the fields of a Client directly, the
+// zero-value of Client remains a valid configuration.
+func NewClient(options ...Option) (*Client, error) {
+	config := &clientConfig{
+		client: Client{Address: getConsulAddress()},
+	}
+
+	for _, option := range options {
+		if err := option(config); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.pool != nil {
+		if err := config.configurePool(); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.tls != nil {
+		if err := config.configureTLS(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := validateAddress(config.client.Address); err != nil {
+		return nil, err
+	}
+
+	client := config.client
+
+	for _, bootstrap := range config.bootstrap {
+		if err := bootstrap(&client); err != nil {
+			return nil, err
+		}
+	}
+
+	return &client, nil
+}
+
+// WithAddress configures the address of the agent that the client sends
+// requests to. The address may be prefixed with a http:// or https:// scheme.
+func WithAddress(address string) Option {
+	return func(config *clientConfig) error {
+		if err := validateAddress(address); err != nil {
+			return err
+		}
+		config.client.Address = address
+		return nil
+	}
+}
+
+// WithDatacenter configures the datacenter that the client sends requests for.
+// Omit this option to use the agent's default datacenter.
+func WithDatacenter(datacenter string) Option {
+	return func(config *clientConfig) error {
+		if len(datacenter) == 0 {
+			return errors.New("consul: the datacenter name must not be empty")
+		}
+		if strings.ContainsAny(datacenter, "/?&#= \t\r\n") {
+			return fmt.Errorf("consul: invalid datacenter name %q", datacenter)
+		}
+		config.client.Datacenter = datacenter
+		return nil
+	}
+}
+
+// WithToken configures the ACL token sent by the client to authorize its
+// requests.
+func WithToken(token string) Option {
+	return func(config *clientConfig) error {
+		if len(token) == 0 {
+			return errors.New("consul: the ACL token must not be empty")
+		}
+		if config.client.TokenProvider != nil {
+			return errors.New("consul: WithToken and WithTokenProvider cannot be used together")
+		}
+		config.client.Token = token
+		return nil
+	}
+}
+
+// WithTokenProvider configures the client to obtain the ACL tokens sent with
+// each request from provider.
+func WithTokenProvider(provider TokenProvider) Option {
+	return func(config *clientConfig) error {
+		if provider == nil {
+			return errors.New("consul: the token provider must not be nil")
+		}
+		if len(config.client.Token) != 0 {
+			return errors.New("consul: WithToken and WithTokenProvider cannot be used together")
+		}
+		config.client.TokenProvider = provider
+		return nil
+	}
+}
+
+// WithUserAgent configures the user agent sent by the client.
+func WithUserAgent(userAgent string) Option {
+	return func(config *clientConfig) error {
+		config.client.UserAgent = userAgent
+		return nil
+	}
+}
+
+// WithTransport configures the HTTP transport used by the client to send its
+// requests.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(config *clientConfig) error {
+		if transport == nil {
+			return errors.New("consul: the transport must not be nil")
+		}
+		if config.client.HTTPClient != nil {
+			return errors.New("consul: WithTransport and WithHTTPClient cannot be used together")
+		}
+		config.client.Transport = transport
+		return nil
+	}
+}
+
+// WithHTTPClient configures the HTTP client used to send requests, for programs
+// which need cookie jars, redirect policies, or other features of http.Client.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(config *clientConfig) error {
+		if httpClient == nil {
+			return errors.New("consul: the HTTP client must not be nil")
+		}
+		if config.client.Transport != nil {
+			return errors.New("consul: WithTransport and WithHTTPClient cannot be used together")
+		}
+		config.client.HTTPClient = httpClient
+		return nil
+	}
+}
+
+// WithLogger configures the logger that the client reports diagnostic messages
+// to.
+func WithLogger(logger Logger) Option {
+	return func(config *clientConfig) error {
+		if logger == nil {
+			return errors.New("consul: the logger must not be nil")
+		}
+		config.client.Logger = logger
+		return nil
+	}
+}
+
+// WithStats configures the client to report metrics to stats.
+func WithStats(stats Stats) Option {
+	return func(config *clientConfig) error {
+		if stats == nil {
+			return errors.New("consul: the stats must not be nil")
+		}
+		config.client.Stats = stats
+		return nil
+	}
+}
+
+// WithRequestID configures the client to attach an ID to its requests in the
+// header of the given name, see the RequestIDHeader field of Client for
+// details.
+func WithRequestID(header string) Option {
+	return func(config *clientConfig) error {
+		if !validHeaderName(header) {
+			return fmt.Errorf("consul: invalid request ID header name %q", header)
+		}
+		config.client.RequestIDHeader = header
+		return nil
+	}
+}
+
+func validHeaderName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// WithSlowRequestThreshold configures the client to log a warning for requests
+// taking longer than threshold, see the SlowRequestThreshold field of Client
+// for details.
+func WithSlowRequestThreshold(threshold time.Duration) Option {
+	return func(config *clientConfig) error {
+		if threshold <= 0 {
+			return fmt.Errorf("consul: the slow request threshold must be positive: %s", threshold)
+		}
+		config.client.SlowRequestThreshold = threshold
+		return nil
+	}
+}
+
+// WithDebug enables logging of the full requests and responses exchanged by the
+// client with its agent, see the Debug field of Client for details.
+func WithDebug() Option {
+	return func(config *clientConfig) error {
+		config.client.Debug = true
+		return nil
+	}
+}
+
+// WithTLS configures the client to communicate with its agent over TLS, using
+// the given configuration.
+//
+// If the address has no scheme it is changed to use https, it is an error to
+// combine this option with a http:// address. The option may be combined with
+// WithTransport only if the transport is a *http.Transport, which is copied
+// before being configured.
+func WithTLS(tlsConfig *tls.Config) Option {
+	return func(config *clientConfig) error {
+		if tlsConfig == nil {
+			return errors.New("consul: the TLS configuration must not be nil")
+		}
+		config.tls = tlsConfig
+		return nil
+	}
+}
+
+func (config *clientConfig) configureTLS() error {
+	c := &config.client
+
+	switch scheme, address := splitAddress(c.Address); scheme {
+	case "":
+		c.Address = "https://" + address
+	case "https":
+	default:
+		return fmt.Errorf("consul: TLS cannot be used with the address %q", c.Address)
+	}
+
+	if c.HTTPClient != nil {
+		return errors.New("consul: WithTLS cannot be combined with WithHTTPClient, configure TLS on the transport of the HTTP client instead")
+	}
+
+	transport := c.Transport
+	if transport == nil {
+		transport = DefaultTransport
+	}
+
+	t, ok := transport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("consul: TLS cannot be configured on transports of type %T", transport)
+	}
+
+	t = t.Clone()
+	t.TLSClientConfig = config.tls.Clone()
+	c.Transport = t
+	return nil
+}
+
+func splitAddress(address string) (scheme string, hostport string) {
+	if i := strings.Index(address, "://"); i >= 0 {
+		return address[:i], address[i+3:]
+	}
+	return "", address
+}
+
+func validateAddress(address string) error {
+	if len(address) == 0 {
+		return nil // DefaultAddress
+	}
+
+	scheme, hostport := splitAddress(address)
+
+	switch scheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("consul: unsupported scheme in agent address %q", address)
+	}
+
+	u, err := url.Parse("http://" + hostport)
+	if err != nil {
+		return fmt.Errorf("consul: malformed agent address %q: %w", address, err)
+	}
+
+	if len(u.Host) == 0 || len(u.Path) != 0 || len(u.RawQuery) != 0 || u.User != nil {
+		return fmt.Errorf("consul: malformed agent address %q", address)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package consul
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewClient(t *testing.T) {
+	client, err := NewClient(
+		WithAddress("localhost:8500"),
+		WithDatacenter("dc2"),
+		WithToken("secret"),
+		WithUserAgent("test"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Address != "localhost:8500" {
+		t.Error("bad address:", client.Address)
+	}
+	if client.Datacenter != "dc2" {
+		t.Error("bad datacenter:", client.Datacenter)
+	}
+	if client.Token != "secret" {
+		t.Error("bad token:", client.Token)
+	}
+	if client.UserAgent != "test" {
+		t.Error("bad user agent:", client.UserAgent)
+	}
+}
+
+func TestNewClientInvalidOptions(t *testing.T) {
+	tests := []struct {
+		scenario string
+		options  []Option
+	}{
+		{
+			scenario: "unsupported address scheme",
+			options:  []Option{WithAddress("ftp://localhost:8500")},
+		},
+		{
+			scenario: "address with a path",
+			options:  []Option{WithAddress("http://localhost:8500/v1")},
+		},
+		{
+			scenario: "address with a bad port",
+			options:  []Option{WithAddress("localhost:http")},
+		},
+		{
+			scenario: "empty datacenter",
+			options:  []Option{WithDatacenter("")},
+		},
+		{
+			scenario: "datacenter with query characters",
+			options:  []Option{WithDatacenter("dc1&stale")},
+		},
+		{
+			scenario: "nil transport",
+			options:  []Option{WithTransport(nil)},
+		},
+		{
+			scenario: "token and token provider",
+			options:  []Option{WithToken("secret"), WithTokenProvider(StaticToken("secret"))},
+		},
+		{
+			scenario: "TLS with a http address",
+			options:  []Option{WithAddress("http://localhost:8500"), WithTLS(&tls.Config{})},
+		},
+		{
+			scenario: "transport and HTTP client",
+			options:  []Option{WithTransport(DefaultTransport), WithHTTPClient(&http.Client{})},
+		},
+		{
+			scenario: "TLS with an HTTP client",
+			options:  []Option{WithHTTPClient(&http.Client{}), WithTLS(&tls.Config{})},
+		},
+		{
+			scenario: "TLS with a custom round tripper",
+			options:  []Option{WithTransport(roundTripperFunc(nil)), WithTLS(&tls.Config{})},
+		},
+		{
+			scenario: "connection pool with a transport",
+			options:  []Option{WithTransport(DefaultTransport), WithConnectionPool(ConnectionPool{})},
+		},
+		{
+			scenario: "connection pool with an HTTP client",
+			options:  []Option{WithConnectionPool(ConnectionPool{}), WithHTTPClient(&http.Client{})},
+		},
+		{
+			scenario: "request ID header with a space",
+			options:  []Option{WithRequestID("Request ID")},
+		},
+		{
+			scenario: "zero slow request threshold",
+			options:  []Option{WithSlowRequestThreshold(0)},
+		},
+		{
+			scenario: "negative connection pool size",
+			options:  []Option{WithConnectionPool(ConnectionPool{MaxIdleConnsPerHost: -1})},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if _, err := NewClient(test.options...); err == nil {
+				t.Error("expected an error but got none")
+			}
+		})
+	}
+}
+
+func TestNewClientTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode("dc1")
+	}))
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	client, err := NewClient(
+		WithAddress(server.Listener.Addr().String()),
+		WithTLS(&tls.Config{RootCAs: roots}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Address != "https://"+server.Listener.Addr().String() {
+		t.Error("bad address:", client.Address)
+	}
+	if DefaultTransport.(*http.Transport).TLSClientConfig != nil {
+		t.Error("the default transport was modified")
+	}
+
+	var dc string
+	if err := client.Get(context.Background(), "/", nil, &dc); err != nil {
+		t.Fatal(err)
+	}
+	if dc != "dc1" {
+		t.Error("bad response:", dc)
+	}
+}
+
+func TestNewClientConnectionPool(t *testing.T) {
+	client, err := NewClient(
+		WithConnectionPool(ConnectionPool{
+			MaxIdleConnsPerHost:   64,
+			ResponseHeaderTimeout: time.Minute,
+		}),
+		WithTLS(&tls.Config{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("bad transport type: %T", client.Transport)
+	}
+	if transport == DefaultTransport {
+		t.Error("the client must not use the default transport")
+	}
+	if transport.MaxIdleConnsPerHost != 64 {
+		t.Error("bad max idle connections per host:", transport.MaxIdleConnsPerHost)
+	}
+	if transport.MaxIdleConns != DefaultConnectionPool.MaxIdleConns {
+		t.Error("bad max idle connections:", transport.MaxIdleConns)
+	}
+	if transport.IdleConnTimeout != DefaultConnectionPool.IdleConnTimeout {
+		t.Error("bad idle connection timeout:", transport.IdleConnTimeout)
+	}
+	if !transport.DisableCompression {
+		t.Error("compression must be disabled")
+	}
+	if transport.TLSClientConfig == nil {
+		t.Error("the TLS configuration was not applied to the pooled transport")
+	}
+	if timeout := requestTimeout(client.Transport, client.HTTPClient); timeout != time.Minute {
+		t.Error("bad request timeout:", timeout)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,121 @@
+package consul
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ConnectionPool carries the settings of the pool of connections that clients
+// maintain to their agent.
+//
+// The pool of DefaultTransport is sized for clients sending a few requests at
+// a time, programs running many concurrent blocking queries against the same
+// agent should configure their clients with a larger pool, otherwise most
+// requests open new connections:
+//
+//	client, err := consul.NewClient(consul.WithConnectionPool(consul.ConnectionPool{
+//		MaxIdleConnsPerHost:   100,
+//		ResponseHeaderTimeout: 10 * time.Minute, // for blocking queries
+//	}))
+//
+// Zero values use the settings of DefaultConnectionPool.
+type ConnectionPool struct {
+	// The maximum number of idle connections kept open across all agents,
+	// and to each agent.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+
+	// The maximum number of connections opened to each agent, including the
+	// ones in use. Zero means no limit.
+	MaxConnsPerHost int
+
+	// The amount of time after which idle connections are closed.
+	IdleConnTimeout time.Duration
+
+	// The timeouts for establishing connections, and for receiving the
+	// headers of responses. Blocking queries sent by the client wait at most
+	// for the response header timeout.
+	DialTimeout           time.Duration
+	ResponseHeaderTimeout time.Duration
+}
+
+// DefaultConnectionPool is the configuration of the connection pool of
+// DefaultTransport.
+var DefaultConnectionPool = ConnectionPool{
+	MaxIdleConns:          5,
+	MaxIdleConnsPerHost:   2,
+	IdleConnTimeout:       90 * time.Second,
+	DialTimeout:           5 * time.Second,
+	ResponseHeaderTimeout: 5 * time.Second,
+}
+
+// Transport returns a new HTTP transport configured like DefaultTransport,
+// with the connection pool settings of p.
+func (p ConnectionPool) Transport() *http.Transport {
+	d := DefaultConnectionPool
+	return &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: durationOr(p.DialTimeout, d.DialTimeout),
+		}).DialContext,
+		DisableCompression:    true,
+		MaxIdleConns:          intOr(p.MaxIdleConns, d.MaxIdleConns),
+		MaxIdleConnsPerHost:   intOr(p.MaxIdleConnsPerHost, d.MaxIdleConnsPerHost),
+		MaxConnsPerHost:       intOr(p.MaxConnsPerHost, d.MaxConnsPerHost),
+		IdleConnTimeout:       durationOr(p.IdleConnTimeout, d.IdleConnTimeout),
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: durationOr(p.ResponseHeaderTimeout, d.ResponseHeaderTimeout),
+		ExpectContinueTimeout: 5 * time.Second,
+	}
+}
+
+func (p ConnectionPool) validate() error {
+	if p.MaxIdleConns < 0 || p.MaxIdleConnsPerHost < 0 || p.MaxConnsPerHost < 0 {
+		return errors.New("consul: the connection counts of the pool must not be negative")
+	}
+	if p.IdleConnTimeout < 0 || p.DialTimeout < 0 || p.ResponseHeaderTimeout < 0 {
+		return errors.New("consul: the timeouts of the connection pool must not be negative")
+	}
+	return nil
+}
+
+// WithConnectionPool configures the client to use a transport with the given
+// connection pool settings, see ConnectionPool for details.
+//
+// The option cannot be combined with WithTransport or WithHTTPClient, which
+// bring their own connection pools.
+func WithConnectionPool(pool ConnectionPool) Option {
+	return func(config *clientConfig) error {
+		if err := pool.validate(); err != nil {
+			return err
+		}
+		config.pool = &pool
+		return nil
+	}
+}
+
+func (config *clientConfig) configurePool() error {
+	c := &config.client
+
+	if c.Transport != nil || c.HTTPClient != nil {
+		return errors.New("consul: WithConnectionPool cannot be combined with WithTransport or WithHTTPClient")
+	}
+
+	c.Transport = config.pool.Transport()
+	return nil
+}
+
+func intOr(v int, def int) int {
+	if v != 0 {
+		return v
+	}
+	return def
+}
+
+func durationOr(v time.Duration, def time.Duration) time.Duration {
+	if v != 0 {
+		return v
+	}
+	return def
+}
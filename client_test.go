@@ -1,12 +1,20 @@
 package consul
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -111,6 +119,415 @@ func TestClient(t *testing.T) {
 
 }
 
+func TestClientDerivation(t *testing.T) {
+	var dc, token string
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		dc = req.URL.Query().Get("dc")
+		token = req.Header.Get("X-Consul-Token")
+		json.NewEncoder(res).Encode(nil)
+	})
+	defer server.Close()
+
+	client.Transport = &http.Transport{}
+	client.TokenProvider = StaticToken("provided")
+
+	derived := client.WithDatacenter("dc2").WithToken("secret")
+
+	if derived.Transport != client.Transport {
+		t.Error("the derived client does not share the transport of its parent")
+	}
+	if client.Datacenter != "dc1" || client.TokenProvider == nil {
+		t.Error("the parent client was modified")
+	}
+
+	if err := derived.Get(context.Background(), "/", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if dc != "dc2" {
+		t.Error("bad datacenter:", dc)
+	}
+	if token != "secret" {
+		t.Error("bad token:", token)
+	}
+}
+
+func TestClientContextOptions(t *testing.T) {
+	tests := []struct {
+		scenario string
+		ctx      context.Context
+		query    Query
+		expected string
+	}{
+		{
+			scenario: "no options",
+			ctx:      context.Background(),
+			expected: "dc=dc1",
+		},
+		{
+			scenario: "datacenter",
+			ctx:      ContextWithDatacenter(context.Background(), "dc2"),
+			expected: "dc=dc2",
+		},
+		{
+			scenario: "consistency",
+			ctx:      ContextWithConsistency(context.Background(), ConsistencyStale),
+			expected: "dc=dc1&stale",
+		},
+		{
+			scenario: "consistency set by the query",
+			ctx:      ContextWithConsistency(context.Background(), ConsistencyStale),
+			query:    Query{{Name: "consistent"}},
+			expected: "consistent&dc=dc1",
+		},
+		{
+			scenario: "all options",
+			ctx: ContextWithNamespace(
+				ContextWithConsistency(
+					ContextWithDatacenter(context.Background(), "dc3"),
+					ConsistencyConsistent,
+				),
+				"team-a",
+			),
+			expected: "dc=dc3&consistent&ns=team-a",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+				if req.URL.RawQuery != test.expected {
+					t.Error("bad query string:", req.URL.RawQuery)
+				}
+				json.NewEncoder(res).Encode(nil)
+			})
+			defer server.Close()
+
+			if err := client.Get(test.ctx, "/", test.query, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestClientHTTPClient(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/login":
+			http.SetCookie(res, &http.Cookie{Name: "session", Value: "42"})
+			http.Redirect(res, req, "/v1/agent/self", http.StatusFound)
+		default:
+			cookie, err := req.Cookie("session")
+			if err != nil || cookie.Value != "42" {
+				t.Error("missing session cookie:", err)
+			}
+			json.NewEncoder(res).Encode("OK")
+		}
+	})
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+	redirects := 0
+
+	client.HTTPClient = &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			redirects++
+			return nil
+		},
+	}
+	client.Transport = roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		t.Error("the transport must not be used when an HTTP client is configured")
+		return nil, context.Canceled
+	})
+
+	var recv string
+	if err := client.Get(context.Background(), "/login", nil, &recv); err != nil {
+		t.Fatal(err)
+	}
+	if recv != "OK" {
+		t.Error("bad response:", recv)
+	}
+	if redirects != 1 {
+		t.Error("bad number of redirects:", redirects)
+	}
+}
+
+func TestClientGetList(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected []int
+		err      bool
+	}{
+		{body: `[1,2,3]`, expected: []int{1, 2, 3}},
+		{body: `[]`, expected: nil},
+		{body: `null`, expected: nil},
+		{body: `{"A":1}`, err: true},
+		{body: `[1,2`, expected: []int{1, 2}, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.body, func(t *testing.T) {
+			server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+				res.Header().Set("X-Consul-Index", "42")
+				res.Write([]byte(test.body))
+			})
+			defer server.Close()
+
+			var values []int
+			meta, err := client.getList(context.Background(), "/", nil, func(dec *json.Decoder) error {
+				var v int
+				if err := dec.Decode(&v); err != nil {
+					return err
+				}
+				values = append(values, v)
+				return nil
+			})
+
+			if test.err != (err != nil) {
+				t.Error("bad error:", err)
+			}
+			if !reflect.DeepEqual(values, test.expected) {
+				t.Error("bad values:", values)
+			}
+			if meta.index != 42 {
+				t.Error("bad index:", meta.index)
+			}
+		})
+	}
+
+	t.Run("cancel", func(t *testing.T) {
+		server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte(`[1,`))
+			res.(http.Flusher).Flush()
+			<-req.Context().Done()
+		})
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		_, err := client.getList(ctx, "/", nil, func(dec *json.Decoder) error {
+			cancel()
+			var v int
+			return dec.Decode(&v)
+		})
+
+		if !errors.Is(err, context.Canceled) {
+			t.Error("bad error:", err)
+		}
+	})
+}
+
+func TestQueryString(t *testing.T) {
+	query := Query{
+		{Name: "recurse"},
+		{Name: "filter", Value: `Service.Tags contains "a b" and Meta["é"] != "x&y=z"`},
+		{Name: "wait", Value: "1m30s"},
+		{Name: "key~name", Value: "-_.~/?#%+"},
+	}
+
+	expected := make([]string, len(query))
+	for i, p := range query {
+		expected[i] = url.QueryEscape(p.Name)
+		if len(p.Value) != 0 {
+			expected[i] += "=" + url.QueryEscape(p.Value)
+		}
+	}
+
+	if s := query.String(); s != strings.Join(expected, "&") {
+		t.Error("bad query string:", s)
+	}
+
+	if s := (Query{}).String(); s != "" {
+		t.Error("bad empty query string:", s)
+	}
+
+	if n := testing.AllocsPerRun(100, func() { _ = query.String() }); n != 1 {
+		t.Error("bad number of allocations:", n)
+	}
+}
+
+func BenchmarkQueryString(b *testing.B) {
+	query := Query{
+		{Name: "index", Value: "123456"},
+		{Name: "wait", Value: "5m0s"},
+		{Name: "passing"},
+		{Name: "dc", Value: "us-west-2"},
+		{Name: "filter", Value: `Service.Meta.version == "v1"`},
+	}
+
+	for i := 0; i != b.N; i++ {
+		_ = query.String()
+	}
+}
+
+func TestClientSlowRequests(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		res.Write([]byte(`null`))
+	})
+	defer server.Close()
+
+	logger := &testLogger{}
+	client.Logger = logger
+	client.SlowRequestThreshold = 20 * time.Millisecond
+
+	// The blocking query is expected to wait, it is not reported.
+	if err := client.Get(context.Background(), "/v1/kv/A", Query{{"index", "1"}, {"wait", "1s"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Get(context.Background(), "/v1/kv/B", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if log := logger.String(); !strings.HasPrefix(log, "slow request: GET /v1/kv/B took ") || strings.Contains(log, "\n") {
+		t.Errorf("bad log output: %q", log)
+	}
+}
+
+func TestClientRequestID(t *testing.T) {
+	ids := make(chan string, 1)
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		ids <- req.Header.Get("X-Request-Id")
+		if req.URL.Path == "/v1/kv/missing" {
+			res.WriteHeader(http.StatusNotFound)
+			return
+		}
+		res.Write([]byte(`null`))
+	})
+	defer server.Close()
+
+	client.RequestIDHeader = "x-request-id"
+
+	if err := client.Get(ContextWithRequestID(context.Background(), "1234"), "/v1/kv/key", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if id := <-ids; id != "1234" {
+		t.Error("bad request ID taken from the context:", id)
+	}
+
+	if err := client.Get(context.Background(), "/v1/kv/key", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if id := <-ids; len(id) != 32 {
+		t.Error("bad generated request ID:", id)
+	}
+
+	err := client.Get(ContextWithRequestID(context.Background(), "5678"), "/v1/kv/missing", nil, nil)
+	<-ids
+
+	if !errors.Is(err, ErrNotFound) || !strings.HasSuffix(err.Error(), "(request id 5678)") {
+		t.Error("bad error:", err)
+	}
+
+	failure := errors.New("failure")
+	client.Transport = roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, failure })
+
+	err = client.Get(ContextWithRequestID(context.Background(), "abcd"), "/v1/kv/key", nil, nil)
+
+	if !errors.Is(err, failure) || err.Error() != "failure (request id abcd)" {
+		t.Error("bad error:", err)
+	}
+}
+
+func TestClientRequestBodies(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if ua := req.Header.Get("User-Agent"); ua != "test" {
+			t.Error("bad user agent:", ua)
+		}
+		io.Copy(res, req.Body)
+	})
+	defer server.Close()
+
+	wg := sync.WaitGroup{}
+
+	for i := 0; i != 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j != 10; j++ {
+				send := map[string]int{"i": i, "j": j}
+				recv := map[string]int{}
+
+				if err := client.Put(context.Background(), "/", nil, send, &recv); err != nil {
+					t.Error(err)
+					return
+				}
+				if !reflect.DeepEqual(send, recv) {
+					t.Error("request bodies were mixed:", send, recv)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func TestClientDefaultUserAgent(t *testing.T) {
+	var userAgent string
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		userAgent = req.Header.Get("User-Agent")
+		res.Write([]byte("{}"))
+	})
+	defer server.Close()
+
+	client.UserAgent = ""
+
+	if len(DefaultUserAgent) == 0 {
+		t.Fatal("the default user agent is empty")
+	}
+
+	for _, ua := range []string{DefaultUserAgent, "changed"} {
+		defer func(ua string) { DefaultUserAgent = ua }(DefaultUserAgent)
+		DefaultUserAgent = ua
+
+		if err := client.Get(context.Background(), "/", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if userAgent != ua {
+			t.Errorf("bad user agent: %q != %q", userAgent, ua)
+		}
+	}
+}
+
+func BenchmarkClientDo(b *testing.B) {
+	body := []byte(`{"ID":"1234","Name":"test"}`)
+	client := &Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Body != nil {
+				io.Copy(ioutil.Discard, req.Body)
+				req.Body.Close()
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(bytes.NewReader(body)),
+			}, nil
+		}),
+	}
+	ctx := context.Background()
+
+	b.Run("GET", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i != b.N; i++ {
+			var recv map[string]string
+			client.Get(ctx, "/v1/session/info/1234", nil, &recv)
+		}
+	})
+
+	b.Run("PUT", func(b *testing.B) {
+		send := map[string]string{"Name": "test", "TTL": "10s"}
+		b.ReportAllocs()
+		for i := 0; i != b.N; i++ {
+			var recv map[string]string
+			client.Put(ctx, "/v1/session/create", nil, send, &recv)
+		}
+	})
+}
+
 func newServerClient(handler func(http.ResponseWriter, *http.Request)) (server *httptest.Server, client *Client) {
 	server = httptest.NewServer(http.HandlerFunc(handler))
 	client = &Client{
@@ -0,0 +1,87 @@
+package consul
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the interface used by the time-driven components of the package
+// (session renewal, locks, resolver caches, and watch backoffs) to read the
+// time and wait, so tests can control the passage of time instead of sleeping.
+//
+// Clocks must be safe to use concurrently from multiple goroutines.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer returns a timer which fires once after d.
+	NewTimer(d time.Duration) Timer
+
+	// NewTicker returns a ticker which fires every d.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is the interface of timers returned by clocks, it mirrors time.Timer.
+type Timer interface {
+	// C returns the channel that the time is sent on when the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing, it returns false if the timer
+	// already fired or was stopped.
+	Stop() bool
+}
+
+// Ticker is the interface of tickers returned by clocks, it mirrors
+// time.Ticker.
+type Ticker interface {
+	// C returns the channel that the time is sent on when the ticker fires.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// DefaultClock is the clock used by components which have no clock
+// configured, it uses the system time.
+var DefaultClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer { return systemTimer{time.NewTimer(d)} }
+
+func (systemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+type systemTimer struct{ *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time { return t.Timer.C }
+
+type systemTicker struct{ *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.Ticker.C }
+
+func clockOrDefault(clock Clock) Clock {
+	if clock != nil {
+		return clock
+	}
+	return DefaultClock
+}
+
+// Sleep waits for d on clock, or until ctx is canceled, in which case it
+// returns the error of the context.
+func Sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := clockOrDefault(clock).NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
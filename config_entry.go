@@ -0,0 +1,481 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ConfigEntryKind is an enumeration representing the kinds of configuration
+// entries supported by consul.
+type ConfigEntryKind string
+
+const (
+	// ServiceDefaults is the kind of configuration entries setting the
+	// defaults of a service, such as its protocol.
+	ServiceDefaults ConfigEntryKind = "service-defaults"
+
+	// ProxyDefaults is the kind of the configuration entry setting the
+	// defaults of all proxies.
+	ProxyDefaults ConfigEntryKind = "proxy-defaults"
+
+	// ServiceRouter is the kind of configuration entries routing L7 traffic
+	// of a service.
+	ServiceRouter ConfigEntryKind = "service-router"
+
+	// ServiceSplitter is the kind of configuration entries splitting L7
+	// traffic of a service between multiple targets.
+	ServiceSplitter ConfigEntryKind = "service-splitter"
+
+	// ServiceResolver is the kind of configuration entries selecting the
+	// instances of a service that traffic is sent to.
+	ServiceResolver ConfigEntryKind = "service-resolver"
+)
+
+// ProxyConfigGlobal is the name of the only proxy-defaults configuration
+// entry supported by consul.
+const ProxyConfigGlobal = "global"
+
+// ConfigEntry is the interface implemented by all types representing consul
+// configuration entries, as documented at
+// https://www.consul.io/docs/agent/config-entries.html
+type ConfigEntry interface {
+	// Returns the kind of the configuration entry.
+	ConfigEntryKind() ConfigEntryKind
+
+	// Returns the name of the configuration entry.
+	ConfigEntryName() string
+}
+
+// MeshGatewayMode is an enumeration representing the ways that Connect traffic
+// may be routed through mesh gateways.
+type MeshGatewayMode string
+
+const (
+	MeshGatewayModeDefault MeshGatewayMode = ""
+	MeshGatewayModeNone    MeshGatewayMode = "none"
+	MeshGatewayModeLocal   MeshGatewayMode = "local"
+	MeshGatewayModeRemote  MeshGatewayMode = "remote"
+)
+
+// MeshGatewayConfig configures how traffic is routed through mesh gateways.
+type MeshGatewayConfig struct {
+	Mode MeshGatewayMode `json:",omitempty"`
+}
+
+// ServiceDefaultsEntry is a representation of the service-defaults
+// configuration entries.
+type ServiceDefaultsEntry struct {
+	Name        string
+	Namespace   string            `json:",omitempty"`
+	Protocol    string            `json:",omitempty"`
+	MeshGateway MeshGatewayConfig `json:",omitempty"`
+	ExternalSNI string            `json:",omitempty"`
+	Meta        map[string]string `json:",omitempty"`
+	CreateIndex uint64            `json:",omitempty"`
+	ModifyIndex uint64            `json:",omitempty"`
+}
+
+// ConfigEntryKind satisfies the ConfigEntry interface.
+func (entry ServiceDefaultsEntry) ConfigEntryKind() ConfigEntryKind { return ServiceDefaults }
+
+// ConfigEntryName satisfies the ConfigEntry interface.
+func (entry ServiceDefaultsEntry) ConfigEntryName() string { return entry.Name }
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (entry ServiceDefaultsEntry) MarshalJSON() ([]byte, error) {
+	type serviceDefaultsEntry ServiceDefaultsEntry
+	return json.Marshal(struct {
+		Kind ConfigEntryKind
+		serviceDefaultsEntry
+	}{ServiceDefaults, serviceDefaultsEntry(entry)})
+}
+
+// ProxyDefaultsEntry is a representation of the proxy-defaults configuration
+// entry. Its name must always be ProxyConfigGlobal.
+type ProxyDefaultsEntry struct {
+	Name        string
+	Namespace   string                 `json:",omitempty"`
+	Config      map[string]interface{} `json:",omitempty"`
+	MeshGateway MeshGatewayConfig      `json:",omitempty"`
+	Meta        map[string]string      `json:",omitempty"`
+	CreateIndex uint64                 `json:",omitempty"`
+	ModifyIndex uint64                 `json:",omitempty"`
+}
+
+// ConfigEntryKind satisfies the ConfigEntry interface.
+func (entry ProxyDefaultsEntry) ConfigEntryKind() ConfigEntryKind { return ProxyDefaults }
+
+// ConfigEntryName satisfies the ConfigEntry interface.
+func (entry ProxyDefaultsEntry) ConfigEntryName() string { return entry.Name }
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (entry ProxyDefaultsEntry) MarshalJSON() ([]byte, error) {
+	type proxyDefaultsEntry ProxyDefaultsEntry
+	return json.Marshal(struct {
+		Kind ConfigEntryKind
+		proxyDefaultsEntry
+	}{ProxyDefaults, proxyDefaultsEntry(entry)})
+}
+
+// ServiceRouterEntry is a representation of the service-router configuration
+// entries.
+type ServiceRouterEntry struct {
+	Name        string
+	Namespace   string            `json:",omitempty"`
+	Routes      []ServiceRoute    `json:",omitempty"`
+	Meta        map[string]string `json:",omitempty"`
+	CreateIndex uint64            `json:",omitempty"`
+	ModifyIndex uint64            `json:",omitempty"`
+}
+
+// ConfigEntryKind satisfies the ConfigEntry interface.
+func (entry ServiceRouterEntry) ConfigEntryKind() ConfigEntryKind { return ServiceRouter }
+
+// ConfigEntryName satisfies the ConfigEntry interface.
+func (entry ServiceRouterEntry) ConfigEntryName() string { return entry.Name }
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (entry ServiceRouterEntry) MarshalJSON() ([]byte, error) {
+	type serviceRouterEntry ServiceRouterEntry
+	return json.Marshal(struct {
+		Kind ConfigEntryKind
+		serviceRouterEntry
+	}{ServiceRouter, serviceRouterEntry(entry)})
+}
+
+// ServiceRoute is a single route of a service router, the first route that
+// matches a request is used.
+type ServiceRoute struct {
+	Match       *ServiceRouteMatch       `json:",omitempty"`
+	Destination *ServiceRouteDestination `json:",omitempty"`
+}
+
+// ServiceRouteMatch describes the requests matched by a route.
+type ServiceRouteMatch struct {
+	HTTP *ServiceRouteHTTPMatch `json:",omitempty"`
+}
+
+// ServiceRouteHTTPMatch describes the HTTP requests matched by a route.
+type ServiceRouteHTTPMatch struct {
+	PathExact  string                      `json:",omitempty"`
+	PathPrefix string                      `json:",omitempty"`
+	PathRegex  string                      `json:",omitempty"`
+	Header     []ServiceRouteHTTPMatchItem `json:",omitempty"`
+	QueryParam []ServiceRouteHTTPMatchItem `json:",omitempty"`
+	Methods    []string                    `json:",omitempty"`
+}
+
+// ServiceRouteHTTPMatchItem matches a header or query parameter of HTTP
+// requests.
+type ServiceRouteHTTPMatchItem struct {
+	Name    string
+	Present bool   `json:",omitempty"`
+	Exact   string `json:",omitempty"`
+	Prefix  string `json:",omitempty"`
+	Suffix  string `json:",omitempty"`
+	Regex   string `json:",omitempty"`
+	Invert  bool   `json:",omitempty"`
+}
+
+// ServiceRouteDestination describes where the requests matched by a route are
+// sent.
+type ServiceRouteDestination struct {
+	Service               string        `json:",omitempty"`
+	ServiceSubset         string        `json:",omitempty"`
+	Namespace             string        `json:",omitempty"`
+	PrefixRewrite         string        `json:",omitempty"`
+	RequestTimeout        time.Duration `json:"-"`
+	NumRetries            uint32        `json:",omitempty"`
+	RetryOnConnectFailure bool          `json:",omitempty"`
+	RetryOnStatusCodes    []uint32      `json:",omitempty"`
+}
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (dest ServiceRouteDestination) MarshalJSON() ([]byte, error) {
+	type serviceRouteDestination ServiceRouteDestination
+	return json.Marshal(struct {
+		serviceRouteDestination
+		RequestTimeout duration `json:",omitempty"`
+	}{
+		serviceRouteDestination: serviceRouteDestination(dest),
+		RequestTimeout:          duration(dest.RequestTimeout),
+	})
+}
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface.
+func (dest *ServiceRouteDestination) UnmarshalJSON(b []byte) error {
+	type serviceRouteDestination ServiceRouteDestination
+	d := struct {
+		*serviceRouteDestination
+		RequestTimeout duration
+	}{
+		serviceRouteDestination: (*serviceRouteDestination)(dest),
+	}
+	if err := json.Unmarshal(b, &d); err != nil {
+		return err
+	}
+	dest.RequestTimeout = time.Duration(d.RequestTimeout)
+	return nil
+}
+
+// ServiceSplitterEntry is a representation of the service-splitter
+// configuration entries.
+type ServiceSplitterEntry struct {
+	Name        string
+	Namespace   string            `json:",omitempty"`
+	Splits      []ServiceSplit    `json:",omitempty"`
+	Meta        map[string]string `json:",omitempty"`
+	CreateIndex uint64            `json:",omitempty"`
+	ModifyIndex uint64            `json:",omitempty"`
+}
+
+// ConfigEntryKind satisfies the ConfigEntry interface.
+func (entry ServiceSplitterEntry) ConfigEntryKind() ConfigEntryKind { return ServiceSplitter }
+
+// ConfigEntryName satisfies the ConfigEntry interface.
+func (entry ServiceSplitterEntry) ConfigEntryName() string { return entry.Name }
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (entry ServiceSplitterEntry) MarshalJSON() ([]byte, error) {
+	type serviceSplitterEntry ServiceSplitterEntry
+	return json.Marshal(struct {
+		Kind ConfigEntryKind
+		serviceSplitterEntry
+	}{ServiceSplitter, serviceSplitterEntry(entry)})
+}
+
+// ServiceSplit is a single target of a service splitter, the weights of all
+// splits must add up to 100.
+type ServiceSplit struct {
+	Weight        float32
+	Service       string `json:",omitempty"`
+	ServiceSubset string `json:",omitempty"`
+	Namespace     string `json:",omitempty"`
+}
+
+// ServiceResolverEntry is a representation of the service-resolver
+// configuration entries.
+type ServiceResolverEntry struct {
+	Name           string
+	Namespace      string                             `json:",omitempty"`
+	DefaultSubset  string                             `json:",omitempty"`
+	Subsets        map[string]ServiceResolverSubset   `json:",omitempty"`
+	Redirect       *ServiceResolverRedirect           `json:",omitempty"`
+	Failover       map[string]ServiceResolverFailover `json:",omitempty"`
+	ConnectTimeout time.Duration                      `json:"-"`
+	Meta           map[string]string                  `json:",omitempty"`
+	CreateIndex    uint64                             `json:",omitempty"`
+	ModifyIndex    uint64                             `json:",omitempty"`
+}
+
+// ConfigEntryKind satisfies the ConfigEntry interface.
+func (entry ServiceResolverEntry) ConfigEntryKind() ConfigEntryKind { return ServiceResolver }
+
+// ConfigEntryName satisfies the ConfigEntry interface.
+func (entry ServiceResolverEntry) ConfigEntryName() string { return entry.Name }
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (entry ServiceResolverEntry) MarshalJSON() ([]byte, error) {
+	type serviceResolverEntry ServiceResolverEntry
+	return json.Marshal(struct {
+		Kind ConfigEntryKind
+		serviceResolverEntry
+		ConnectTimeout duration `json:",omitempty"`
+	}{
+		Kind:                 ServiceResolver,
+		serviceResolverEntry: serviceResolverEntry(entry),
+		ConnectTimeout:       duration(entry.ConnectTimeout),
+	})
+}
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface.
+func (entry *ServiceResolverEntry) UnmarshalJSON(b []byte) error {
+	type serviceResolverEntry ServiceResolverEntry
+	e := struct {
+		*serviceResolverEntry
+		ConnectTimeout duration
+	}{
+		serviceResolverEntry: (*serviceResolverEntry)(entry),
+	}
+	if err := json.Unmarshal(b, &e); err != nil {
+		return err
+	}
+	entry.ConnectTimeout = time.Duration(e.ConnectTimeout)
+	return nil
+}
+
+// ServiceResolverSubset defines a subset of the instances of a service,
+// selected by a filter expression.
+type ServiceResolverSubset struct {
+	Filter      Filter `json:",omitempty"`
+	OnlyPassing bool   `json:",omitempty"`
+}
+
+// ServiceResolverRedirect redirects all traffic of a service to an other
+// target.
+type ServiceResolverRedirect struct {
+	Service       string `json:",omitempty"`
+	ServiceSubset string `json:",omitempty"`
+	Namespace     string `json:",omitempty"`
+	Datacenter    string `json:",omitempty"`
+}
+
+// ServiceResolverFailover defines the targets that traffic is sent to when all
+// instances of a subset are unhealthy.
+type ServiceResolverFailover struct {
+	Service       string   `json:",omitempty"`
+	ServiceSubset string   `json:",omitempty"`
+	Namespace     string   `json:",omitempty"`
+	Datacenters   []string `json:",omitempty"`
+}
+
+// ConfigEntries exposes methods to manage the consul configuration entries.
+type ConfigEntries struct {
+	// The client used to send requests to the consul agent, which may be nil
+	// to indicate that a default client should be used.
+	Client *Client
+}
+
+// Read returns the configuration entry of the given kind and name. The dynamic
+// type of the returned value is one of the *Entry types of this package,
+// matching kind.
+func (c *ConfigEntries) Read(ctx context.Context, kind ConfigEntryKind, name string) (entry ConfigEntry, err error) {
+	var raw json.RawMessage
+
+	if err = c.client().Get(ctx, "/v1/config/"+string(kind)+"/"+name, nil, &raw); err != nil {
+		return
+	}
+
+	entry, err = decodeConfigEntry(raw)
+	return
+}
+
+// List returns all the configuration entries of the given kind.
+func (c *ConfigEntries) List(ctx context.Context, kind ConfigEntryKind) (entries []ConfigEntry, err error) {
+	var raw []json.RawMessage
+
+	if err = c.client().Get(ctx, "/v1/config/"+string(kind), nil, &raw); err != nil {
+		return
+	}
+
+	entries = make([]ConfigEntry, len(raw))
+
+	for i, r := range raw {
+		if entries[i], err = decodeConfigEntry(r); err != nil {
+			entries = nil
+			return
+		}
+	}
+
+	return
+}
+
+// Write creates or updates the configuration entry.
+func (c *ConfigEntries) Write(ctx context.Context, entry ConfigEntry) error {
+	_, err := c.WriteCAS(ctx, entry, 0)
+	return err
+}
+
+// WriteCAS creates or updates the configuration entry, using a check-and-set
+// operation if index is greater than zero. The method returns false if the
+// entry was modified since index.
+//
+// If the entry has a Validate method, it is called before sending the entry to
+// consul, and the write is aborted if it returns an error.
+func (c *ConfigEntries) WriteCAS(ctx context.Context, entry ConfigEntry, index int64) (ok bool, err error) {
+	var query Query
+
+	if v, _ := entry.(interface{ Validate() error }); v != nil {
+		if err = v.Validate(); err != nil {
+			return
+		}
+	}
+
+	if index > 0 {
+		query = append(query, Param{
+			Name:  "cas",
+			Value: strconv.FormatInt(index, 10),
+		})
+	}
+
+	err = c.client().Put(ctx, "/v1/config", query, entry, &ok)
+	return
+}
+
+// Delete deletes the configuration entry of the given kind and name.
+func (c *ConfigEntries) Delete(ctx context.Context, kind ConfigEntryKind, name string) error {
+	return c.client().Delete(ctx, "/v1/config/"+string(kind)+"/"+name, nil, nil)
+}
+
+func (c *ConfigEntries) client() *Client {
+	if client := c.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+// DefaultConfigEntries is a configuration entries endpoint configured to use
+// the default client.
+var DefaultConfigEntries = &ConfigEntries{}
+
+// ReadConfigEntry is a helper function that delegates to the default
+// configuration entries endpoint.
+func ReadConfigEntry(ctx context.Context, kind ConfigEntryKind, name string) (ConfigEntry, error) {
+	return DefaultConfigEntries.Read(ctx, kind, name)
+}
+
+// ListConfigEntries is a helper function that delegates to the default
+// configuration entries endpoint.
+func ListConfigEntries(ctx context.Context, kind ConfigEntryKind) ([]ConfigEntry, error) {
+	return DefaultConfigEntries.List(ctx, kind)
+}
+
+// WriteConfigEntry is a helper function that delegates to the default
+// configuration entries endpoint.
+func WriteConfigEntry(ctx context.Context, entry ConfigEntry) error {
+	return DefaultConfigEntries.Write(ctx, entry)
+}
+
+// DeleteConfigEntry is a helper function that delegates to the default
+// configuration entries endpoint.
+func DeleteConfigEntry(ctx context.Context, kind ConfigEntryKind, name string) error {
+	return DefaultConfigEntries.Delete(ctx, kind, name)
+}
+
+func decodeConfigEntry(b []byte) (ConfigEntry, error) {
+	var header struct{ Kind ConfigEntryKind }
+
+	if err := json.Unmarshal(b, &header); err != nil {
+		return nil, err
+	}
+
+	var entry ConfigEntry
+
+	switch header.Kind {
+	case ServiceDefaults:
+		entry = &ServiceDefaultsEntry{}
+	case ProxyDefaults:
+		entry = &ProxyDefaultsEntry{}
+	case ServiceRouter:
+		entry = &ServiceRouterEntry{}
+	case ServiceSplitter:
+		entry = &ServiceSplitterEntry{}
+	case ServiceResolver:
+		entry = &ServiceResolverEntry{}
+	case ConfigEntryKind(IngressGateway):
+		entry = &IngressGatewayEntry{}
+	case ConfigEntryKind(TerminatingGateway):
+		entry = &TerminatingGatewayEntry{}
+	default:
+		return nil, fmt.Errorf("consul: unsupported config entry kind %q", header.Kind)
+	}
+
+	if err := json.Unmarshal(b, entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,276 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// IngressGatewayEntry is a representation of the ingress-gateway configuration
+// entries, which configure the listeners of ingress gateways and the services
+// that they expose.
+type IngressGatewayEntry struct {
+	// The name of the ingress gateway service that the entry configures.
+	Name      string
+	Namespace string `json:",omitempty"`
+
+	// TLS configuration of the listeners of the gateway.
+	TLS GatewayTLSConfig
+
+	// The list of listeners of the gateway, each on a different port.
+	Listeners []IngressListener `json:",omitempty"`
+
+	Meta        map[string]string `json:",omitempty"`
+	CreateIndex uint64            `json:",omitempty"`
+	ModifyIndex uint64            `json:",omitempty"`
+}
+
+// GatewayTLSConfig is the TLS configuration of a gateway.
+type GatewayTLSConfig struct {
+	Enabled bool
+}
+
+// IngressListener is a listener of an ingress gateway.
+type IngressListener struct {
+	Port     int
+	Protocol string           `json:",omitempty"`
+	Services []IngressService `json:",omitempty"`
+}
+
+// IngressService is a service exposed by a listener of an ingress gateway.
+type IngressService struct {
+	// The name of the service, or "*" to expose all services on listeners
+	// with an HTTP-based protocol.
+	Name      string
+	Namespace string `json:",omitempty"`
+
+	// The list of hosts that the service is exposed under, only supported on
+	// listeners with an HTTP-based protocol. Defaults to
+	// <service>.ingress.* when empty.
+	Hosts []string `json:",omitempty"`
+}
+
+// ConfigEntryKind satisfies the ConfigEntry interface.
+func (entry IngressGatewayEntry) ConfigEntryKind() ConfigEntryKind {
+	return ConfigEntryKind(IngressGateway)
+}
+
+// ConfigEntryName satisfies the ConfigEntry interface.
+func (entry IngressGatewayEntry) ConfigEntryName() string { return entry.Name }
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (entry IngressGatewayEntry) MarshalJSON() ([]byte, error) {
+	type ingressGatewayEntry IngressGatewayEntry
+	return json.Marshal(struct {
+		Kind ConfigEntryKind
+		ingressGatewayEntry
+	}{ConfigEntryKind(IngressGateway), ingressGatewayEntry(entry)})
+}
+
+// AddService exposes service on the listener of the given port, creating the
+// listener with protocol if it did not exist yet.
+func (entry *IngressGatewayEntry) AddService(port int, protocol string, service IngressService) {
+	for i := range entry.Listeners {
+		if l := &entry.Listeners[i]; l.Port == port {
+			l.Services = append(l.Services, service)
+			return
+		}
+	}
+	entry.Listeners = append(entry.Listeners, IngressListener{
+		Port:     port,
+		Protocol: protocol,
+		Services: []IngressService{service},
+	})
+}
+
+// Validate checks that entry is a valid ingress-gateway configuration entry,
+// applying the same rules than consul so errors can be detected before the
+// entry is written.
+func (entry IngressGatewayEntry) Validate() error {
+	if len(entry.Name) == 0 {
+		return fmt.Errorf("consul: ingress gateway name must not be empty")
+	}
+
+	ports := make(map[int]bool, len(entry.Listeners))
+
+	for _, l := range entry.Listeners {
+		if l.Port <= 0 || l.Port > 65535 {
+			return fmt.Errorf("consul: ingress gateway %s has a listener on the invalid port %d", entry.Name, l.Port)
+		}
+		if ports[l.Port] {
+			return fmt.Errorf("consul: ingress gateway %s has multiple listeners on port %d", entry.Name, l.Port)
+		}
+		ports[l.Port] = true
+
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("consul: ingress gateway %s: %w", entry.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (l IngressListener) validate() error {
+	protocol := l.Protocol
+	if len(protocol) == 0 {
+		protocol = "tcp"
+	}
+
+	http := false
+	switch protocol {
+	case "tcp":
+	case "http", "http2", "grpc":
+		http = true
+	default:
+		return fmt.Errorf("listener on port %d has the unsupported protocol %q", l.Port, protocol)
+	}
+
+	if len(l.Services) == 0 {
+		return fmt.Errorf("listener on port %d has no services", l.Port)
+	}
+
+	if !http && len(l.Services) != 1 {
+		return fmt.Errorf("listener on port %d must have exactly one service with the tcp protocol", l.Port)
+	}
+
+	names := make(map[string]bool, len(l.Services))
+	hosts := make(map[string]bool)
+
+	for _, s := range l.Services {
+		if len(s.Name) == 0 {
+			return fmt.Errorf("listener on port %d has a service without a name", l.Port)
+		}
+
+		if s.Name == "*" {
+			if !http {
+				return fmt.Errorf("listener on port %d cannot expose all services with the tcp protocol", l.Port)
+			}
+			if len(s.Hosts) != 0 {
+				return fmt.Errorf("listener on port %d cannot set hosts on the wildcard service", l.Port)
+			}
+		}
+
+		name := s.Namespace + "/" + s.Name
+		if names[name] {
+			return fmt.Errorf("listener on port %d exposes the %s service multiple times", l.Port, s.Name)
+		}
+		names[name] = true
+
+		if len(s.Hosts) != 0 && !http {
+			return fmt.Errorf("listener on port %d cannot set hosts with the tcp protocol", l.Port)
+		}
+
+		for _, host := range s.Hosts {
+			if err := validateIngressHost(host); err != nil {
+				return fmt.Errorf("listener on port %d: %w", l.Port, err)
+			}
+			if hosts[host] {
+				return fmt.Errorf("listener on port %d has the host %q on multiple services", l.Port, host)
+			}
+			hosts[host] = true
+		}
+	}
+
+	return nil
+}
+
+func validateIngressHost(host string) error {
+	if host == "*" {
+		return nil
+	}
+	if len(host) == 0 {
+		return fmt.Errorf("empty host")
+	}
+	if i := strings.LastIndexByte(host, '*'); i > 0 || (i == 0 && !strings.HasPrefix(host, "*.")) {
+		return fmt.Errorf("host %q has a wildcard which is not a full leftmost label", host)
+	}
+	return nil
+}
+
+// TerminatingGatewayEntry is a representation of the terminating-gateway
+// configuration entries, which link terminating gateways to the external
+// services that they route traffic to.
+type TerminatingGatewayEntry struct {
+	// The name of the terminating gateway service that the entry configures.
+	Name      string
+	Namespace string `json:",omitempty"`
+
+	// The list of services linked to the gateway.
+	Services []LinkedService `json:",omitempty"`
+
+	Meta        map[string]string `json:",omitempty"`
+	CreateIndex uint64            `json:",omitempty"`
+	ModifyIndex uint64            `json:",omitempty"`
+}
+
+// LinkedService is a service that a terminating gateway routes traffic to,
+// optionally using TLS to connect to the service.
+type LinkedService struct {
+	// The name of the service, or "*" to link all services of the namespace.
+	Name      string
+	Namespace string `json:",omitempty"`
+
+	// Paths to the files used by the gateway to establish TLS connections to
+	// the service, on the gateway's host.
+	CAFile   string `json:",omitempty"`
+	CertFile string `json:",omitempty"`
+	KeyFile  string `json:",omitempty"`
+
+	// The server name sent in the TLS handshake with the service.
+	SNI string `json:",omitempty"`
+}
+
+// ConfigEntryKind satisfies the ConfigEntry interface.
+func (entry TerminatingGatewayEntry) ConfigEntryKind() ConfigEntryKind {
+	return ConfigEntryKind(TerminatingGateway)
+}
+
+// ConfigEntryName satisfies the ConfigEntry interface.
+func (entry TerminatingGatewayEntry) ConfigEntryName() string { return entry.Name }
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (entry TerminatingGatewayEntry) MarshalJSON() ([]byte, error) {
+	type terminatingGatewayEntry TerminatingGatewayEntry
+	return json.Marshal(struct {
+		Kind ConfigEntryKind
+		terminatingGatewayEntry
+	}{ConfigEntryKind(TerminatingGateway), terminatingGatewayEntry(entry)})
+}
+
+// AddService links service to the terminating gateway.
+func (entry *TerminatingGatewayEntry) AddService(service LinkedService) {
+	entry.Services = append(entry.Services, service)
+}
+
+// Validate checks that entry is a valid terminating-gateway configuration
+// entry, applying the same rules than consul so errors can be detected before
+// the entry is written.
+func (entry TerminatingGatewayEntry) Validate() error {
+	if len(entry.Name) == 0 {
+		return fmt.Errorf("consul: terminating gateway name must not be empty")
+	}
+
+	names := make(map[string]bool, len(entry.Services))
+
+	for _, s := range entry.Services {
+		if len(s.Name) == 0 {
+			return fmt.Errorf("consul: terminating gateway %s links a service without a name", entry.Name)
+		}
+
+		name := s.Namespace + "/" + s.Name
+		if names[name] {
+			return fmt.Errorf("consul: terminating gateway %s links the %s service multiple times", entry.Name, s.Name)
+		}
+		names[name] = true
+
+		if (len(s.CertFile) == 0) != (len(s.KeyFile) == 0) {
+			return fmt.Errorf("consul: terminating gateway %s must set both the certificate and key files of the %s service", entry.Name, s.Name)
+		}
+
+		if len(s.CertFile) != 0 && len(s.CAFile) == 0 {
+			return fmt.Errorf("consul: terminating gateway %s must set the CA file of the %s service when presenting a client certificate", entry.Name, s.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestIngressGatewayEntryValidate(t *testing.T) {
+	tests := []struct {
+		scenario string
+		entry    IngressGatewayEntry
+		valid    bool
+	}{
+		{
+			scenario: "an entry without a name is invalid",
+			entry:    IngressGatewayEntry{},
+		},
+		{
+			scenario: "an entry without listeners is valid",
+			entry:    IngressGatewayEntry{Name: "ingress"},
+			valid:    true,
+		},
+		{
+			scenario: "a tcp listener with a single service is valid",
+			entry: IngressGatewayEntry{
+				Name:      "ingress",
+				Listeners: []IngressListener{{Port: 8080, Services: []IngressService{{Name: "db"}}}},
+			},
+			valid: true,
+		},
+		{
+			scenario: "a tcp listener with multiple services is invalid",
+			entry: IngressGatewayEntry{
+				Name: "ingress",
+				Listeners: []IngressListener{{
+					Port:     8080,
+					Protocol: "tcp",
+					Services: []IngressService{{Name: "db"}, {Name: "cache"}},
+				}},
+			},
+		},
+		{
+			scenario: "a tcp listener with hosts is invalid",
+			entry: IngressGatewayEntry{
+				Name: "ingress",
+				Listeners: []IngressListener{{
+					Port:     8080,
+					Services: []IngressService{{Name: "db", Hosts: []string{"db.example.com"}}},
+				}},
+			},
+		},
+		{
+			scenario: "multiple listeners on the same port are invalid",
+			entry: IngressGatewayEntry{
+				Name: "ingress",
+				Listeners: []IngressListener{
+					{Port: 8080, Services: []IngressService{{Name: "db"}}},
+					{Port: 8080, Services: []IngressService{{Name: "cache"}}},
+				},
+			},
+		},
+		{
+			scenario: "an http listener exposing all services is valid",
+			entry: IngressGatewayEntry{
+				Name: "ingress",
+				Listeners: []IngressListener{{
+					Port:     8080,
+					Protocol: "http",
+					Services: []IngressService{{Name: "*"}},
+				}},
+			},
+			valid: true,
+		},
+		{
+			scenario: "the wildcard service cannot have hosts",
+			entry: IngressGatewayEntry{
+				Name: "ingress",
+				Listeners: []IngressListener{{
+					Port:     8080,
+					Protocol: "http",
+					Services: []IngressService{{Name: "*", Hosts: []string{"example.com"}}},
+				}},
+			},
+		},
+		{
+			scenario: "hosts with wildcards in the middle are invalid",
+			entry: IngressGatewayEntry{
+				Name: "ingress",
+				Listeners: []IngressListener{{
+					Port:     8080,
+					Protocol: "http",
+					Services: []IngressService{{Name: "web", Hosts: []string{"www.*.com"}}},
+				}},
+			},
+		},
+		{
+			scenario: "hosts shared by multiple services are invalid",
+			entry: IngressGatewayEntry{
+				Name: "ingress",
+				Listeners: []IngressListener{{
+					Port:     8080,
+					Protocol: "http",
+					Services: []IngressService{
+						{Name: "web", Hosts: []string{"*.example.com"}},
+						{Name: "api", Hosts: []string{"*.example.com"}},
+					},
+				}},
+			},
+		},
+		{
+			scenario: "unsupported protocols are invalid",
+			entry: IngressGatewayEntry{
+				Name:      "ingress",
+				Listeners: []IngressListener{{Port: 8080, Protocol: "udp", Services: []IngressService{{Name: "dns"}}}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if err := test.entry.Validate(); (err == nil) != test.valid {
+				t.Error("bad validation result:", err)
+			}
+		})
+	}
+}
+
+func TestTerminatingGatewayEntryValidate(t *testing.T) {
+	tests := []struct {
+		scenario string
+		service  LinkedService
+		valid    bool
+	}{
+		{
+			scenario: "a service without TLS configuration is valid",
+			service:  LinkedService{Name: "billing"},
+			valid:    true,
+		},
+		{
+			scenario: "a service with a CA and client certificate is valid",
+			service:  LinkedService{Name: "billing", CAFile: "ca.pem", CertFile: "cert.pem", KeyFile: "key.pem"},
+			valid:    true,
+		},
+		{
+			scenario: "a service with a certificate but no key is invalid",
+			service:  LinkedService{Name: "billing", CAFile: "ca.pem", CertFile: "cert.pem"},
+		},
+		{
+			scenario: "a service with a client certificate but no CA is invalid",
+			service:  LinkedService{Name: "billing", CertFile: "cert.pem", KeyFile: "key.pem"},
+		},
+		{
+			scenario: "a service without a name is invalid",
+			service:  LinkedService{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			entry := TerminatingGatewayEntry{Name: "egress"}
+			entry.AddService(test.service)
+			if err := entry.Validate(); (err == nil) != test.valid {
+				t.Error("bad validation result:", err)
+			}
+		})
+	}
+
+	t.Run("linking a service multiple times is invalid", func(t *testing.T) {
+		entry := TerminatingGatewayEntry{Name: "egress"}
+		entry.AddService(LinkedService{Name: "billing"})
+		entry.AddService(LinkedService{Name: "billing"})
+		if err := entry.Validate(); err == nil {
+			t.Error("the entry should be invalid")
+		}
+	})
+}
+
+func TestIngressGatewayEntryJSON(t *testing.T) {
+	entry := IngressGatewayEntry{Name: "ingress"}
+	entry.AddService(8080, "http", IngressService{Name: "web", Hosts: []string{"www.example.com"}})
+	entry.AddService(8080, "http", IngressService{Name: "api"})
+	entry.AddService(9090, "tcp", IngressService{Name: "db"})
+
+	if len(entry.Listeners) != 2 {
+		t.Fatal("bad listeners:", entry.Listeners)
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kind := jsonValue(t, b)["Kind"]; kind != "ingress-gateway" {
+		t.Error("bad kind:", kind)
+	}
+
+	decoded, err := decodeConfigEntry(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, &entry) {
+		t.Errorf("bad config entry:\n%#v\n%#v", decoded, &entry)
+	}
+}
+
+func TestConfigEntriesWriteInvalid(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		t.Error("invalid config entries should not be sent to consul")
+	})
+	defer server.Close()
+
+	config := &ConfigEntries{Client: client}
+
+	if err := config.Write(context.Background(), TerminatingGatewayEntry{}); err == nil {
+		t.Error("writing an invalid config entry should fail")
+	}
+}
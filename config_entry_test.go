@@ -0,0 +1,128 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigEntries(t *testing.T) {
+	entries := map[string]json.RawMessage{}
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch req.Method + " " + req.URL.Path {
+		case "PUT /v1/config":
+			b, _ := ioutil.ReadAll(req.Body)
+			var header struct{ Kind, Name string }
+			json.Unmarshal(b, &header)
+			entries[header.Kind+"/"+header.Name] = b
+			json.NewEncoder(res).Encode(true)
+
+		case "GET /v1/config/service-resolver/db":
+			res.Write(entries["service-resolver/db"])
+
+		case "GET /v1/config/service-defaults":
+			res.Write([]byte("[" + string(entries["service-defaults/db"]) + "]"))
+
+		case "DELETE /v1/config/service-resolver/db":
+			delete(entries, "service-resolver/db")
+
+		default:
+			t.Error("unexpected request:", req.Method, req.URL.Path)
+		}
+	})
+	defer server.Close()
+
+	config := &ConfigEntries{Client: client}
+	ctx := context.Background()
+
+	resolver := &ServiceResolverEntry{
+		Name:          "db",
+		DefaultSubset: "v1",
+		Subsets: map[string]ServiceResolverSubset{
+			"v1": {Filter: "Service.Meta.version == v1"},
+			"v2": {Filter: "Service.Meta.version == v2"},
+		},
+		Failover: map[string]ServiceResolverFailover{
+			"*": {Datacenters: []string{"dc2"}},
+		},
+		ConnectTimeout: 5 * time.Second,
+	}
+
+	if err := config.Write(ctx, resolver); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.Write(ctx, ServiceDefaultsEntry{Name: "db", Protocol: "http"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := jsonValue(t, entries["service-resolver/db"]); v["Kind"] != "service-resolver" || v["ConnectTimeout"] != "5s" {
+		t.Error("bad encoding of the config entry:", v)
+	}
+
+	entry, err := config.Read(ctx, ServiceResolver, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entry, resolver) {
+		t.Errorf("bad config entry:\n%#v\n%#v", entry, resolver)
+	}
+
+	list, err := config.List(ctx, ServiceDefaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, []ConfigEntry{&ServiceDefaultsEntry{Name: "db", Protocol: "http"}}) {
+		t.Errorf("bad config entries: %#v", list)
+	}
+
+	if err := config.Delete(ctx, ServiceResolver, "db"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entries["service-resolver/db"]; ok {
+		t.Error("the config entry was not deleted")
+	}
+}
+
+func TestServiceRouterEntryJSON(t *testing.T) {
+	router := ServiceRouterEntry{
+		Name: "web",
+		Routes: []ServiceRoute{{
+			Match: &ServiceRouteMatch{
+				HTTP: &ServiceRouteHTTPMatch{PathPrefix: "/admin"},
+			},
+			Destination: &ServiceRouteDestination{
+				Service:        "admin",
+				RequestTimeout: 10 * time.Second,
+				NumRetries:     3,
+			},
+		}},
+	}
+
+	b, err := json.Marshal(router)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := decodeConfigEntry(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(entry, &router) {
+		t.Errorf("bad config entry:\n%#v\n%#v", entry, &router)
+	}
+}
+
+func jsonValue(t *testing.T, b []byte) map[string]interface{} {
+	var v map[string]interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
@@ -0,0 +1,224 @@
+package consul
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Connect exposes methods to interract with the consul service mesh (Connect).
+type Connect struct {
+	// The client used to send requests to the consul agent, which may be nil
+	// to indicate that a default client should be used.
+	Client *Client
+}
+
+// CARoot is a representation of a root certificate of the Connect certificate
+// authority, which follows the structure documented at
+// https://www.consul.io/api/agent/connect.html#certificate-authority-ca-roots
+type CARoot struct {
+	ID                string
+	Name              string
+	SerialNumber      uint64
+	SigningKeyID      string
+	NotBefore         time.Time
+	NotAfter          time.Time
+	RootCert          string
+	IntermediateCerts []string
+	Active            bool
+	CreateIndex       uint64
+	ModifyIndex       uint64
+}
+
+// CARoots is the set of root certificates trusted by the Connect certificate
+// authority.
+type CARoots struct {
+	ActiveRootID string
+	TrustDomain  string
+	Roots        []CARoot
+}
+
+// Active returns the root certificate currently used to sign leaf certificates.
+func (roots CARoots) Active() (CARoot, bool) {
+	for _, root := range roots.Roots {
+		if root.ID == roots.ActiveRootID {
+			return root, true
+		}
+	}
+	return CARoot{}, false
+}
+
+// CertPool returns a certificate pool containing all the root and intermediate
+// certificates of roots, which may be used to verify certificates issued by
+// the Connect certificate authority.
+func (roots CARoots) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+
+	for _, root := range roots.Roots {
+		pool.AppendCertsFromPEM([]byte(root.RootCert))
+
+		for _, cert := range root.IntermediateCerts {
+			pool.AppendCertsFromPEM([]byte(cert))
+		}
+	}
+
+	return pool
+}
+
+// verify checks that the certificate chain presented by the peer of a TLS
+// connection was issued by the Connect certificate authority, returning the
+// leaf certificate of the chain.
+//
+// The method only validates the chain of trust, it is the responsibility of
+// the caller to verify the service identity of the returned certificate.
+func (roots CARoots) verify(rawCerts [][]byte, usage x509.ExtKeyUsage) (*x509.Certificate, error) {
+	if len(rawCerts) == 0 {
+		return nil, fmt.Errorf("consul: no certificate presented by the Connect peer")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, err
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots.CertPool(),
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	}); err != nil {
+		return nil, err
+	}
+
+	trustDomain, _, err := certificateService(certs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(trustDomain, roots.TrustDomain) {
+		return nil, fmt.Errorf("consul: Connect certificate of trust domain %q does not match %q", trustDomain, roots.TrustDomain)
+	}
+
+	return certs[0], nil
+}
+
+// CARoots returns the root certificates of the Connect certificate authority.
+func (c *Connect) CARoots(ctx context.Context) (roots CARoots, err error) {
+	err = c.client().Get(ctx, "/v1/agent/connect/ca/roots", nil, &roots)
+	return
+}
+
+func (c *Connect) client() *Client {
+	if client := c.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+// DefaultConnect is a Connect endpoint configured to use the default client.
+var DefaultConnect = &Connect{}
+
+// CARootsUpdate carries the result of a blocking query on the root
+// certificates of the Connect certificate authority.
+type CARootsUpdate struct {
+	Roots CARoots
+	Err   error
+}
+
+// WatchCARoots executes a long poll for changes to the root certificates of the
+// Connect certificate authority. The returned channel receives the initial
+// roots, then an update every time they are rotated. Errors are reported
+// following the same rules than Watch.
+//
+// The channel is closed when ctx is canceled.
+func (w *Watcher) WatchCARoots(ctx context.Context) <-chan CARootsUpdate {
+	ch := make(chan CARootsUpdate)
+	go func() {
+		defer close(ch)
+		w.watchQuery(ctx, "/v1/agent/connect/ca/roots", nil,
+			func() interface{} { return &CARoots{} },
+			func(value interface{}, err error) {
+				u := CARootsUpdate{Err: err}
+				if err == nil {
+					u.Roots = *value.(*CARoots)
+				}
+				select {
+				case ch <- u:
+				case <-ctx.Done():
+				}
+			},
+		)
+	}()
+	return ch
+}
+
+// WatchCARoots is the package-level WatchCARoots definition which is called on
+// DefaultWatcher.
+func WatchCARoots(ctx context.Context) <-chan CARootsUpdate {
+	return DefaultWatcher.WatchCARoots(ctx)
+}
+
+// CARootsCache maintains an in-memory copy of the root certificates of the
+// Connect certificate authority, kept up to date by watching for rotations in
+// a background goroutine.
+//
+// The background goroutine is started by the first call to Roots and runs
+// until Close is called.
+//
+// Methods of CARootsCache are safe to use concurrently from multiple
+// goroutines.
+type CARootsCache struct {
+	// The watcher used to track rotations of the root certificates. If nil,
+	// DefaultWatcher is used instead.
+	Watcher *Watcher
+
+	roots watchedValue
+}
+
+// Roots returns the most recent root certificates of the Connect certificate
+// authority. Only the first call blocks, until the roots were fetched or ctx
+// is canceled.
+func (cache *CARootsCache) Roots(ctx context.Context) (CARoots, error) {
+	val, err := cache.roots.lookup(ctx, func(ctx context.Context, update func(interface{}, error)) {
+		cache.watcher().watchQuery(ctx, "/v1/agent/connect/ca/roots", nil,
+			func() interface{} { return &CARoots{} },
+			func(value interface{}, err error) {
+				roots, _ := value.(*CARoots)
+				update(roots, err)
+			},
+		)
+	}, func(err error) {
+		cache.watcher().client().handleError(fmt.Errorf("consul: refreshing the CA roots: %w", err))
+	})
+
+	roots, _ := val.(*CARoots)
+	if roots == nil {
+		return CARoots{}, err
+	}
+	return *roots, err
+}
+
+// Close stops the background goroutine updating the cache.
+func (cache *CARootsCache) Close() error {
+	cache.roots.close()
+	return nil
+}
+
+func (cache *CARootsCache) watcher() *Watcher {
+	if watcher := cache.Watcher; watcher != nil {
+		return watcher
+	}
+	return DefaultWatcher
+}
@@ -0,0 +1,103 @@
+package consul
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// AuthorizeRequest is the payload of requests sent to the Connect authorize
+// endpoint, which follows the structure documented at
+// https://www.consul.io/api/agent/connect.html#authorize
+type AuthorizeRequest struct {
+	// The name of the destination service that the connection is made to.
+	Target string
+
+	// The SPIFFE URI of the client certificate presented by the source of the
+	// connection.
+	ClientCertURI string
+
+	// The serial number of the client certificate, formatted as a sequence of
+	// colon-separated hexadecimal bytes.
+	ClientCertSerial string
+}
+
+// AuthorizeResult is the response of the Connect authorize endpoint.
+type AuthorizeResult struct {
+	Authorized bool
+	Reason     string
+}
+
+// Authorize asks the local agent whether the connection described by req is
+// allowed by the intentions of the target service.
+func (c *Connect) Authorize(ctx context.Context, req AuthorizeRequest) (res AuthorizeResult, err error) {
+	err = c.client().Do(ctx, "POST", "/v1/agent/connect/authorize", nil, req, &res)
+	return
+}
+
+// AuthorizeCertificate is a convenience wrapper around Authorize which builds
+// the request from the client certificate presented on a connection to the
+// target service.
+func (c *Connect) AuthorizeCertificate(ctx context.Context, target string, cert *x509.Certificate) (AuthorizeResult, error) {
+	uri, err := certificateServiceURI(cert)
+	if err != nil {
+		return AuthorizeResult{}, err
+	}
+	return c.Authorize(ctx, AuthorizeRequest{
+		Target:           target,
+		ClientCertURI:    uri.String(),
+		ClientCertSerial: certificateSerial(cert),
+	})
+}
+
+// Authorize is a helper function that delegates to the default Connect
+// endpoint.
+func Authorize(ctx context.Context, req AuthorizeRequest) (AuthorizeResult, error) {
+	return DefaultConnect.Authorize(ctx, req)
+}
+
+// certificateServiceURI returns the SPIFFE URI identifying the service that
+// cert was issued to.
+func certificateServiceURI(cert *x509.Certificate) (*url.URL, error) {
+	if cert == nil {
+		return nil, errors.New("consul: missing Connect certificate")
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri, nil
+		}
+	}
+	return nil, fmt.Errorf("consul: certificate %q has no SPIFFE URI", cert.Subject.CommonName)
+}
+
+// certificateService returns the trust domain and service name encoded in the
+// SPIFFE URI of a Connect certificate, which has the form
+// spiffe://<trust-domain>/ns/<namespace>/dc/<datacenter>/svc/<service>.
+func certificateService(cert *x509.Certificate) (trustDomain string, service string, err error) {
+	uri, err := certificateServiceURI(cert)
+	if err != nil {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(uri.Path, "/"), "/")
+	for i := 0; i+1 < len(parts); i += 2 {
+		if parts[i] == "svc" {
+			return uri.Host, parts[i+1], nil
+		}
+	}
+	err = fmt.Errorf("consul: %q is not a Connect service identity", uri)
+	return
+}
+
+// certificateSerial formats the serial number of cert the way consul does, as
+// colon-separated hexadecimal bytes.
+func certificateSerial(cert *x509.Certificate) string {
+	b := cert.SerialNumber.Bytes()
+	s := make([]string, len(b))
+	for i, c := range b {
+		s[i] = fmt.Sprintf("%02x", c)
+	}
+	return strings.Join(s, ":")
+}
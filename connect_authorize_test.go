@@ -0,0 +1,67 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestConnectAuthorize(t *testing.T) {
+	ca := newTestCA(t, "11111111-2222-3333-4444-555555555555.consul")
+	cert := ca.issue(t, "web")
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" || req.URL.Path != "/v1/agent/connect/authorize" {
+			t.Error("bad request:", req.Method, req.URL.Path)
+		}
+
+		var authz AuthorizeRequest
+		json.NewDecoder(req.Body).Decode(&authz)
+
+		if authz.Target != "db" {
+			t.Error("bad target:", authz.Target)
+		}
+		if authz.ClientCertURI != "spiffe://11111111-2222-3333-4444-555555555555.consul/ns/default/dc/dc1/svc/web" {
+			t.Error("bad client certificate URI:", authz.ClientCertURI)
+		}
+		if authz.ClientCertSerial != "02" {
+			t.Error("bad client certificate serial:", authz.ClientCertSerial)
+		}
+
+		json.NewEncoder(res).Encode(AuthorizeResult{
+			Authorized: true,
+			Reason:     "Matched L4 intention",
+		})
+	})
+	defer server.Close()
+
+	connect := &Connect{Client: client}
+
+	res, err := connect.AuthorizeCertificate(context.Background(), "db", cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Authorized {
+		t.Error("the connection should have been authorized:", res.Reason)
+	}
+}
+
+func TestCertificateService(t *testing.T) {
+	ca := newTestCA(t, "example.consul")
+
+	trustDomain, service, err := certificateService(ca.issue(t, "web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trustDomain != "example.consul" {
+		t.Error("bad trust domain:", trustDomain)
+	}
+	if service != "web" {
+		t.Error("bad service:", service)
+	}
+
+	if _, _, err := certificateService(ca.cert); err == nil {
+		t.Error("the CA certificate should not be a service identity")
+	}
+}
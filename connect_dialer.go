@@ -0,0 +1,215 @@
+package consul
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ConnectDialer establishes mutual TLS connections to Connect-enabled
+// services, it is the client side of a Connect-native program.
+//
+// The dialer resolves service names to the addresses of Connect-capable
+// endpoints, presents the leaf certificate of the local service, and verifies
+// that the peer presents a certificate issued by the Connect certificate
+// authority to the service being dialed.
+type ConnectDialer struct {
+	// Options applied to the network connections, see the net.Dialer
+	// documentation at https://golang.org/pkg/net/#Dialer for details.
+	Timeout   time.Duration
+	KeepAlive time.Duration
+	LocalAddr net.Addr
+
+	// Amount of time during which endpoints that could not be reached are
+	// blacklisted, if the resolver has a blacklist. Defaults to 1 second.
+	BlacklistTTL time.Duration
+
+	// The resolver used to look up the endpoints of the services being dialed.
+	// If nil, a resolver querying the Connect-capable endpoints with the
+	// default client is used.
+	//
+	// Resolvers configured by the program should have their Connect field set
+	// to true, otherwise connections to services fronted by sidecar proxies
+	// would be attempted on the service ports instead of the proxy ports.
+	Resolver *Resolver
+
+	// If not nil, Lookuper is used to look up the endpoints of services
+	// instead of Resolver, it must return the Connect-capable endpoints.
+	// Endpoints which could not be reached are only blacklisted if it is a
+	// Resolver with a blacklist.
+	Lookuper Lookuper
+
+	// The manager of the leaf certificate presented by the dialer. This field
+	// is required.
+	Leaf *LeafCertManager
+
+	// The cache of root certificates used to verify the certificates presented
+	// by the services. If nil, the dialer maintains its own cache, using the
+	// same watcher than Leaf.
+	Roots *CARootsCache
+
+	once  sync.Once
+	roots CARootsCache
+}
+
+// Dial establishes a Connect connection to the service at address.
+func (d *ConnectDialer) Dial(network string, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext establishes a Connect connection to the service at address.
+//
+// The host part of address is the name of the service to connect to, the port
+// is ignored and looked up from consul instead. The connection returned by the
+// method has already completed the TLS handshake.
+func (d *ConnectDialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	service, _ := splitHostPort(address)
+
+	if len(service) == 0 || net.ParseIP(service) != nil {
+		return nil, fmt.Errorf("consul: Connect connections must be established to service names, not %q", address)
+	}
+
+	config, err := d.TLSConfig(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := d.resolver()
+	buf := getEndpoints()
+	addrs, err := lookupServiceInto(ctx, resolver, service, *buf)
+	if err != nil {
+		endpointsPool.Put(buf)
+		return nil, err
+	}
+	defer putEndpoints(buf, addrs)
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("%w for %s", ErrNoEndpoints, service)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   d.Timeout,
+		KeepAlive: d.KeepAlive,
+		LocalAddr: d.LocalAddr,
+	}
+
+	var conn net.Conn
+
+	for _, addr := range addrs {
+		if conn, err = d.dial(ctx, dialer, network, addr.Addr.String(), config); err == nil {
+			break
+		}
+
+		blacklist(resolver, addr.Addr, time.Now().Add(d.blacklistTTL()))
+	}
+
+	return conn, err
+}
+
+// TLSConfig returns a TLS configuration for establishing Connect connections
+// to service. It may be used by programs that manage their network connections
+// but want to apply the Connect authentication scheme.
+func (d *ConnectDialer) TLSConfig(ctx context.Context, service string) (*tls.Config, error) {
+	if d.Leaf == nil {
+		return nil, errors.New("consul: the Leaf field of ConnectDialer must be set")
+	}
+
+	// Fetch the certificates ahead of the TLS handshake so the first dial
+	// does not report an opaque handshake failure if consul is unreachable.
+	if _, err := d.Leaf.Certificate(ctx); err != nil {
+		return nil, err
+	}
+
+	rootsCache := d.rootsCache()
+
+	if _, err := rootsCache.Roots(ctx); err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		GetClientCertificate: d.Leaf.GetClientCertificate,
+		// The standard verification is disabled because it checks the host
+		// name, while Connect certificates carry the service identity in a
+		// SPIFFE URI, the chain of trust is verified below.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			roots, err := rootsCache.Roots(ctx)
+			if err != nil {
+				return err
+			}
+			cert, err := roots.verify(rawCerts, x509.ExtKeyUsageServerAuth)
+			if err != nil {
+				return err
+			}
+			_, name, err := certificateService(cert)
+			if err != nil {
+				return err
+			}
+			if name != service {
+				return fmt.Errorf("consul: Connect certificate of service %q presented when connecting to %q", name, service)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// Close releases the resources held by the dialer, it does not close the
+// connections that were established.
+func (d *ConnectDialer) Close() error {
+	return d.roots.Close()
+}
+
+func (d *ConnectDialer) dial(ctx context.Context, dialer *net.Dialer, network string, address string, config *tls.Config) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, config)
+
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+func (d *ConnectDialer) resolver() Lookuper {
+	if lookuper := d.Lookuper; lookuper != nil {
+		return lookuper
+	}
+	if rslv := d.Resolver; rslv != nil {
+		return rslv
+	}
+	return defaultConnectResolver
+}
+
+func (d *ConnectDialer) rootsCache() *CARootsCache {
+	if roots := d.Roots; roots != nil {
+		return roots
+	}
+	d.once.Do(func() {
+		if d.Leaf != nil {
+			d.roots.Watcher = d.Leaf.Watcher
+		}
+	})
+	return &d.roots
+}
+
+func (d *ConnectDialer) blacklistTTL() time.Duration {
+	if ttl := d.BlacklistTTL; ttl != 0 {
+		return ttl
+	}
+	return 1 * time.Second
+}
+
+var defaultConnectResolver = &Resolver{
+	Connect:     true,
+	OnlyPassing: true,
+}
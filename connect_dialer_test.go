@@ -0,0 +1,171 @@
+package consul
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConnectDialer(t *testing.T) {
+	ca := newTestCA(t, "consul.test")
+
+	db := newConnectTestServer(t, ca, "db")
+	defer db.Close()
+
+	api := newConnectTestServer(t, ca, "api")
+	defer api.Close()
+
+	server, client := newConnectTestAgent(t, ca, map[string]net.Addr{
+		"db":  db.Addr(),
+		"api": api.Addr(),
+		// A service which resolves to the endpoint of an other service, the
+		// dialer must reject the certificate presented by the peer.
+		"evil": api.Addr(),
+	})
+	defer server.Close()
+
+	d := &ConnectDialer{
+		Resolver: &Resolver{Client: client, Connect: true, DisableCoordinates: true},
+		Leaf:     &LeafCertManager{Watcher: &Watcher{Client: client}, Service: "web"},
+	}
+	defer d.Close()
+	defer d.Leaf.Close()
+
+	t.Run("connecting to a service succeeds", func(t *testing.T) {
+		conn, err := d.DialContext(context.Background(), "tcp", "db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		b, err := ioutil.ReadAll(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "hello web, this is db" {
+			t.Error("bad greeting:", string(b))
+		}
+	})
+
+	t.Run("connecting to a service impersonated by an other service fails", func(t *testing.T) {
+		conn, err := d.DialContext(context.Background(), "tcp", "evil:4242")
+		if err == nil {
+			conn.Close()
+			t.Fatal("the connection should have failed")
+		}
+		if !strings.Contains(err.Error(), `service "api"`) {
+			t.Error("bad error:", err)
+		}
+	})
+
+	t.Run("connecting to an IP address fails", func(t *testing.T) {
+		if _, err := d.DialContext(context.Background(), "tcp", db.Addr().String()); err == nil {
+			t.Fatal("the connection should have failed")
+		}
+	})
+}
+
+// newConnectTestAgent creates a fake consul agent serving the Connect
+// certificates issued by ca, and resolving the services to the given
+// addresses.
+func newConnectTestAgent(t *testing.T, ca *testCA, services map[string]net.Addr) (*httptest.Server, *Client) {
+	return newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		// Simulate blocking queries which never see updates.
+		if index := req.URL.Query().Get("index"); index != "" && index != "0" {
+			<-req.Context().Done()
+			return
+		}
+
+		res.Header().Set("X-Consul-Index", "1")
+
+		switch path := req.URL.Path; {
+		case path == "/v1/agent/connect/ca/roots":
+			json.NewEncoder(res).Encode(ca.roots())
+
+		case strings.HasPrefix(path, "/v1/agent/connect/ca/leaf/"):
+			service := strings.TrimPrefix(path, "/v1/agent/connect/ca/leaf/")
+			cert, certPEM, keyPEM := ca.issuePEM(t, service, time.Hour)
+			json.NewEncoder(res).Encode(LeafCert{
+				SerialNumber:  cert.SerialNumber.String(),
+				CertPEM:       certPEM,
+				PrivateKeyPEM: keyPEM,
+				Service:       service,
+				ServiceURI:    cert.URIs[0].String(),
+			})
+
+		case path == "/v1/agent/connect/authorize":
+			// Intentions of the test agent deny all connections from the
+			// "evil" service.
+			var authz AuthorizeRequest
+			json.NewDecoder(req.Body).Decode(&authz)
+			json.NewEncoder(res).Encode(AuthorizeResult{
+				Authorized: !strings.HasSuffix(authz.ClientCertURI, "/svc/evil"),
+			})
+
+		case strings.HasPrefix(path, "/v1/health/connect/"):
+			addr, ok := services[strings.TrimPrefix(path, "/v1/health/connect/")]
+			if !ok {
+				json.NewEncoder(res).Encode([]struct{}{})
+				return
+			}
+			host, port, _ := net.SplitHostPort(addr.String())
+			type service struct {
+				Address string
+				Port    int
+			}
+			p, _ := strconv.Atoi(port)
+			json.NewEncoder(res).Encode([]struct{ Service service }{
+				{Service: service{Address: host, Port: p}},
+			})
+
+		default:
+			t.Error("unexpected request:", req.Method, path)
+		}
+	})
+}
+
+// newConnectTestServer starts a TLS server presenting a certificate issued by
+// ca to service, and greeting the clients with the name of their service.
+func newConnectTestServer(t *testing.T, ca *testCA, service string) net.Listener {
+	_, certPEM, keyPEM := ca.issuePEM(t, service, time.Hour)
+
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn *tls.Conn) {
+				defer conn.Close()
+				if err := conn.Handshake(); err != nil {
+					return
+				}
+				_, client, _ := certificateService(conn.ConnectionState().PeerCertificates[0])
+				conn.Write([]byte("hello " + client + ", this is " + service))
+			}(conn.(*tls.Conn))
+		}
+	}()
+
+	return l
+}
@@ -0,0 +1,215 @@
+package consul
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LeafCert is a representation of a leaf certificate issued by the Connect
+// certificate authority to a service, which follows the structure documented
+// at https://www.consul.io/api/agent/connect.html#service-leaf-certificate
+type LeafCert struct {
+	SerialNumber  string
+	CertPEM       string
+	PrivateKeyPEM string
+	Service       string
+	ServiceURI    string
+	ValidAfter    time.Time
+	ValidBefore   time.Time
+	CreateIndex   uint64
+	ModifyIndex   uint64
+}
+
+// TLSCertificate returns the leaf certificate and its private key as a
+// tls.Certificate.
+func (leaf LeafCert) TLSCertificate() (tls.Certificate, error) {
+	cert, err := tls.X509KeyPair([]byte(leaf.CertPEM), []byte(leaf.PrivateKeyPEM))
+	if err != nil {
+		return cert, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	return cert, err
+}
+
+// LeafCert returns the leaf certificate issued by the Connect certificate
+// authority to the given service.
+func (c *Connect) LeafCert(ctx context.Context, service string) (leaf LeafCert, err error) {
+	err = c.client().Get(ctx, "/v1/agent/connect/ca/leaf/"+service, nil, &leaf)
+	return
+}
+
+// LeafCertManager maintains an in-memory copy of the leaf certificate of a
+// service, which is renewed in a background goroutine before it expires.
+//
+// Renewals are driven by blocking queries on the agent, which rotates leaf
+// certificates ahead of their expiration, or when the roots of the certificate
+// authority change.
+//
+// The background goroutine is started by the first call to one of the methods
+// returning the certificate, and runs until Close is called.
+//
+// Methods of LeafCertManager are safe to use concurrently from multiple
+// goroutines.
+type LeafCertManager struct {
+	// The watcher used to fetch and renew the leaf certificate. If nil,
+	// DefaultWatcher is used instead.
+	Watcher *Watcher
+
+	// The name of the service that the leaf certificate is issued to.
+	Service string
+
+	// If not nil, the leaf certificate is read from the secrets instead of
+	// being issued by the agent, for programs whose Connect certificates are
+	// issued by an external authority like Vault. The certificate is read
+	// again when the secrets are rotated.
+	Secrets SecretsProvider
+
+	cert watchedValue
+
+	// Last certificate read from the secrets, so it is only parsed when it
+	// changes.
+	mutex   sync.Mutex
+	secrets *leafCertState
+}
+
+type leafCertState struct {
+	leaf LeafCert
+	cert tls.Certificate
+}
+
+// Leaf returns the current leaf certificate of the service. Only the first
+// call blocks, until the certificate was fetched or ctx is canceled.
+func (m *LeafCertManager) Leaf(ctx context.Context) (LeafCert, error) {
+	state, err := m.load(ctx)
+	if state == nil {
+		return LeafCert{}, err
+	}
+	return state.leaf, err
+}
+
+// Certificate returns the current leaf certificate of the service as a
+// tls.Certificate. Only the first call blocks, until the certificate was
+// fetched or ctx is canceled.
+func (m *LeafCertManager) Certificate(ctx context.Context) (*tls.Certificate, error) {
+	state, err := m.load(ctx)
+	if state == nil {
+		return nil, err
+	}
+	return &state.cert, err
+}
+
+// GetCertificate has the signature of the tls.Config.GetCertificate field,
+// it may be used to configure TLS servers to present the leaf certificate.
+func (m *LeafCertManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.Certificate(helloContext(hello))
+}
+
+// GetClientCertificate has the signature of the
+// tls.Config.GetClientCertificate field, it may be used to configure TLS
+// clients to present the leaf certificate.
+func (m *LeafCertManager) GetClientCertificate(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return m.Certificate(certificateRequestContext(info))
+}
+
+// Close stops the background goroutine renewing the certificate.
+func (m *LeafCertManager) Close() error {
+	m.cert.close()
+	return nil
+}
+
+func (m *LeafCertManager) load(ctx context.Context) (*leafCertState, error) {
+	if m.Secrets != nil {
+		return m.loadSecrets(ctx)
+	}
+
+	val, err := m.cert.lookup(ctx, func(ctx context.Context, update func(interface{}, error)) {
+		m.watcher().watchQuery(ctx, "/v1/agent/connect/ca/leaf/"+m.Service, nil,
+			func() interface{} { return &LeafCert{} },
+			func(value interface{}, err error) {
+				if err != nil {
+					update(nil, err)
+					return
+				}
+				leaf := *value.(*LeafCert)
+				cert, err := leaf.TLSCertificate()
+				if err != nil {
+					update(nil, err)
+					return
+				}
+				update(&leafCertState{leaf: leaf, cert: cert}, nil)
+			},
+		)
+	}, func(err error) {
+		m.watcher().client().handleError(fmt.Errorf("consul: renewing the leaf certificate of %s: %w", m.Service, err))
+	})
+
+	state, _ := val.(*leafCertState)
+	return state, err
+}
+
+func (m *LeafCertManager) loadSecrets(ctx context.Context) (*leafCertState, error) {
+	s, err := m.Secrets.Secrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if state := m.secrets; state != nil && state.leaf.CertPEM == s.CertPEM && state.leaf.PrivateKeyPEM == s.PrivateKeyPEM {
+		return state, nil
+	}
+
+	leaf := LeafCert{CertPEM: s.CertPEM, PrivateKeyPEM: s.PrivateKeyPEM}
+	cert, err := leaf.TLSCertificate()
+	if err != nil {
+		return nil, fmt.Errorf("consul: parsing the leaf certificate of %s: %w", m.Service, err)
+	}
+
+	_, service, err := certificateService(cert.Leaf)
+	if err != nil {
+		return nil, err
+	}
+	if service != m.Service {
+		return nil, fmt.Errorf("consul: the leaf certificate of the secrets was issued to %q instead of %q", service, m.Service)
+	}
+	uri, _ := certificateServiceURI(cert.Leaf)
+
+	leaf.SerialNumber = certificateSerial(cert.Leaf)
+	leaf.Service = service
+	leaf.ServiceURI = uri.String()
+	leaf.ValidAfter = cert.Leaf.NotBefore
+	leaf.ValidBefore = cert.Leaf.NotAfter
+
+	m.secrets = &leafCertState{leaf: leaf, cert: cert}
+	return m.secrets, nil
+}
+
+func (m *LeafCertManager) watcher() *Watcher {
+	if watcher := m.Watcher; watcher != nil {
+		return watcher
+	}
+	return DefaultWatcher
+}
+
+func helloContext(hello *tls.ClientHelloInfo) context.Context {
+	if hello != nil {
+		if ctx := hello.Context(); ctx != nil {
+			return ctx
+		}
+	}
+	return context.Background()
+}
+
+func certificateRequestContext(info *tls.CertificateRequestInfo) context.Context {
+	if info != nil {
+		if ctx := info.Context(); ctx != nil {
+			return ctx
+		}
+	}
+	return context.Background()
+}
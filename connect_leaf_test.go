@@ -0,0 +1,171 @@
+package consul
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLeafCertManager(t *testing.T) {
+	ca := newTestCA(t, "consul.test")
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/agent/connect/ca/leaf/web" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+
+		index, _ := strconv.Atoi(req.URL.Query().Get("index"))
+		switch index {
+		case 0:
+		case 1:
+			// Simulate the agent renewing the certificate after a little
+			// while.
+			time.Sleep(20 * time.Millisecond)
+		default:
+			<-req.Context().Done()
+			return
+		}
+
+		cert, certPEM, keyPEM := ca.issuePEM(t, "web", time.Hour)
+		res.Header().Set("X-Consul-Index", strconv.Itoa(index+1))
+		json.NewEncoder(res).Encode(LeafCert{
+			SerialNumber:  cert.SerialNumber.String(),
+			CertPEM:       certPEM,
+			PrivateKeyPEM: keyPEM,
+			Service:       "web",
+			ServiceURI:    cert.URIs[0].String(),
+			ValidAfter:    cert.NotBefore,
+			ValidBefore:   cert.NotAfter,
+		})
+	})
+	defer server.Close()
+
+	m := &LeafCertManager{
+		Watcher: &Watcher{Client: client},
+		Service: "web",
+	}
+	defer m.Close()
+
+	leaf1, err := m.Leaf(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf == nil || cert.Leaf.URIs[0].String() != "spiffe://consul.test/ns/default/dc/dc1/svc/web" {
+		t.Error("bad leaf certificate:", cert.Leaf)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	leaf2, err := m.Leaf(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf1.SerialNumber == leaf2.SerialNumber {
+		t.Error("the leaf certificate was not renewed")
+	}
+
+	if cert, err = m.GetClientCertificate(&tls.CertificateRequestInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if cert.Leaf.SerialNumber.String() != leaf2.SerialNumber {
+		t.Error("the TLS certificate does not match the renewed leaf certificate")
+	}
+}
+
+func TestLeafCertManagerFirstUpdateFailed(t *testing.T) {
+	ca := newTestCA(t, "consul.test")
+	requests := int32(0)
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1, 2:
+			// The agent is still starting when the first update is fetched.
+			http.Error(res, "starting", http.StatusInternalServerError)
+		case 3:
+			cert, certPEM, keyPEM := ca.issuePEM(t, "web", time.Hour)
+			res.Header().Set("X-Consul-Index", "1")
+			json.NewEncoder(res).Encode(LeafCert{
+				SerialNumber:  cert.SerialNumber.String(),
+				CertPEM:       certPEM,
+				PrivateKeyPEM: keyPEM,
+				Service:       "web",
+				ServiceURI:    cert.URIs[0].String(),
+				ValidAfter:    cert.NotBefore,
+				ValidBefore:   cert.NotAfter,
+			})
+		default:
+			<-req.Context().Done()
+		}
+	})
+	defer server.Close()
+
+	m := &LeafCertManager{
+		Watcher: &Watcher{Client: client, MaxAttempts: 1, InitialBackoff: time.Millisecond},
+		Service: "web",
+	}
+	defer m.Close()
+
+	if _, err := m.Leaf(context.Background()); err == nil {
+		t.Fatal("expected the error of the first update")
+	}
+
+	for atomic.LoadInt32(&requests) < 4 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := m.Leaf(context.Background()); err != nil {
+		t.Fatal("the error of the first update was not cleared:", err)
+	}
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{}); err != nil {
+		t.Error("the error of the first update was not cleared:", err)
+	}
+}
+
+func TestLeafCertManagerSecrets(t *testing.T) {
+	ca := newTestCA(t, "consul.test")
+	cert1, certPEM1, keyPEM1 := ca.issuePEM(t, "web", time.Hour)
+	cert2, certPEM2, keyPEM2 := ca.issuePEM(t, "web", time.Hour)
+
+	secrets := Secrets{CertPEM: certPEM1, PrivateKeyPEM: keyPEM1}
+
+	m := &LeafCertManager{
+		Service: "web",
+		Secrets: SecretsProviderFunc(func(context.Context) (Secrets, error) { return secrets, nil }),
+	}
+	defer m.Close()
+
+	leaf, err := m.Leaf(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Service != "web" || leaf.ServiceURI != cert1.URIs[0].String() || leaf.SerialNumber != certificateSerial(cert1) {
+		t.Errorf("bad leaf certificate: %+v", leaf)
+	}
+
+	// Rotating the secrets rotates the certificate presented by the manager.
+	secrets = Secrets{CertPEM: certPEM2, PrivateKeyPEM: keyPEM2}
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.Leaf.Equal(cert2) {
+		t.Error("the rotated certificate was not presented")
+	}
+
+	other := &LeafCertManager{Service: "api", Secrets: m.Secrets}
+
+	if _, err := other.Leaf(context.Background()); err == nil {
+		t.Error("expected an error for a certificate issued to another service")
+	}
+}
@@ -0,0 +1,208 @@
+package consul
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ConnectListener creates listeners accepting Connect connections, it is the
+// server side of a Connect-native program.
+//
+// Listeners present the leaf certificate of the local service, require the
+// clients to present certificates issued by the Connect certificate
+// authority, and consult the intentions of the service (via the authorize
+// endpoint of the agent) before returning connections from Accept.
+type ConnectListener struct {
+	// The manager of the leaf certificate presented by the listener, its
+	// Service field is the name of the service that connections are accepted
+	// for. This field is required.
+	Leaf *LeafCertManager
+
+	// The cache of root certificates used to verify the certificates presented
+	// by clients. If nil, the listener maintains its own cache, using the same
+	// watcher than Leaf.
+	Roots *CARootsCache
+
+	// The Connect endpoint used to authorize connections. If nil, an endpoint
+	// using the same client than Leaf is used.
+	Connect *Connect
+
+	// Maximum amount of time that the TLS handshake and authorization of new
+	// connections may take. Defaults to 10 seconds.
+	HandshakeTimeout time.Duration
+
+	once  sync.Once
+	roots CARootsCache
+}
+
+// Listen creates a new listener accepting Connect connections on the given
+// address.
+func (l *ConnectListener) Listen(network string, address string) (net.Listener, error) {
+	if l.Leaf == nil {
+		return nil, errors.New("consul: the Leaf field of ConnectListener must be set")
+	}
+	lstn, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return l.NewListener(lstn), nil
+}
+
+// NewListener wraps inner to accept Connect connections.
+//
+// The TLS handshakes and authorizations happen in background goroutines, so a
+// slow client cannot prevent other connections from being accepted. Clients
+// which fail to authenticate or are denied by intentions are disconnected and
+// never returned by Accept.
+func (l *ConnectListener) NewListener(inner net.Listener) net.Listener {
+	lstn := &connectListener{
+		Listener: inner,
+		config:   l.TLSConfig(),
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+		owner:    l,
+	}
+	go lstn.run()
+	return lstn
+}
+
+// TLSConfig returns the TLS configuration used by the listener to accept
+// Connect connections. The configuration verifies that clients present
+// certificates issued by the Connect certificate authority, but does not
+// authorize them.
+func (l *ConnectListener) TLSConfig() *tls.Config {
+	rootsCache := l.rootsCache()
+	return &tls.Config{
+		GetCertificate: l.Leaf.GetCertificate,
+		ClientAuth:     tls.RequireAnyClientCert,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			roots, err := rootsCache.Roots(context.Background())
+			if err != nil {
+				return err
+			}
+			_, err = roots.verify(rawCerts, x509.ExtKeyUsageClientAuth)
+			return err
+		},
+	}
+}
+
+// Close releases the resources held by l, it does not close the listeners
+// that were created.
+func (l *ConnectListener) Close() error {
+	return l.roots.Close()
+}
+
+func (l *ConnectListener) authorize(ctx context.Context, conn *tls.Conn) error {
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return err
+	}
+
+	res, err := l.connect().AuthorizeCertificate(ctx, l.Leaf.Service, conn.ConnectionState().PeerCertificates[0])
+	if err != nil {
+		return err
+	}
+
+	if !res.Authorized {
+		return fmt.Errorf("consul: connection from %s to %s denied: %s", conn.RemoteAddr(), l.Leaf.Service, res.Reason)
+	}
+
+	return nil
+}
+
+func (l *ConnectListener) connect() *Connect {
+	if connect := l.Connect; connect != nil {
+		return connect
+	}
+	if watcher := l.Leaf.Watcher; watcher != nil && watcher.Client != nil {
+		return &Connect{Client: watcher.Client}
+	}
+	return DefaultConnect
+}
+
+func (l *ConnectListener) rootsCache() *CARootsCache {
+	if roots := l.Roots; roots != nil {
+		return roots
+	}
+	l.once.Do(func() {
+		if l.Leaf != nil {
+			l.roots.Watcher = l.Leaf.Watcher
+		}
+	})
+	return &l.roots
+}
+
+func (l *ConnectListener) handshakeTimeout() time.Duration {
+	if timeout := l.HandshakeTimeout; timeout != 0 {
+		return timeout
+	}
+	return 10 * time.Second
+}
+
+type connectListener struct {
+	net.Listener
+	config *tls.Config
+	owner  *ConnectListener
+	conns  chan net.Conn
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+func (l *connectListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *connectListener) Close() error {
+	err := l.Listener.Close()
+	l.stop(net.ErrClosed)
+	return err
+}
+
+func (l *connectListener) stop(err error) {
+	l.once.Do(func() {
+		l.err = err
+		close(l.done)
+	})
+}
+
+func (l *connectListener) run() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			l.stop(err)
+			return
+		}
+		go l.handshake(tls.Server(conn, l.config))
+	}
+}
+
+func (l *connectListener) handshake(conn *tls.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.owner.handshakeTimeout())
+	defer cancel()
+
+	if err := l.owner.authorize(ctx, conn); err != nil {
+		conn.Close()
+		return
+	}
+
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
@@ -0,0 +1,103 @@
+package consul
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func TestConnectListener(t *testing.T) {
+	ca := newTestCA(t, "consul.test")
+	services := map[string]net.Addr{}
+
+	server, client := newConnectTestAgent(t, ca, services)
+	defer server.Close()
+
+	l := &ConnectListener{
+		Leaf: &LeafCertManager{Watcher: &Watcher{Client: client}, Service: "db"},
+	}
+	defer l.Close()
+	defer l.Leaf.Close()
+
+	lstn, err := l.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lstn.Close()
+	services["db"] = lstn.Addr()
+
+	accepted := make(chan string, 2)
+	go func() {
+		for {
+			conn, err := lstn.Accept()
+			if err != nil {
+				return
+			}
+			_, name, _ := certificateService(conn.(*tls.Conn).ConnectionState().PeerCertificates[0])
+			accepted <- name
+			conn.Write([]byte("hello " + name))
+			conn.Close()
+		}
+	}()
+
+	dial := func(service string) (string, error) {
+		d := &ConnectDialer{
+			Resolver: &Resolver{Client: client, Connect: true, DisableCoordinates: true},
+			Leaf:     &LeafCertManager{Watcher: &Watcher{Client: client}, Service: service},
+		}
+		defer d.Close()
+		defer d.Leaf.Close()
+
+		conn, err := d.DialContext(context.Background(), "tcp", "db")
+		if err != nil {
+			return "", err
+		}
+		defer conn.Close()
+
+		b, err := ioutil.ReadAll(conn)
+		return string(b), err
+	}
+
+	t.Run("connections from authorized services are accepted", func(t *testing.T) {
+		greeting, err := dial("web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if greeting != "hello web" {
+			t.Error("bad greeting:", greeting)
+		}
+		if name := <-accepted; name != "web" {
+			t.Error("bad accepted connection:", name)
+		}
+	})
+
+	t.Run("connections from services denied by intentions are rejected", func(t *testing.T) {
+		if greeting, _ := dial("evil"); greeting != "" {
+			t.Error("the connection should have been rejected:", greeting)
+		}
+		select {
+		case name := <-accepted:
+			t.Error("the connection should not have been accepted:", name)
+		default:
+		}
+	})
+
+	t.Run("clients without Connect certificates are rejected", func(t *testing.T) {
+		conn, err := tls.Dial("tcp", lstn.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err == nil {
+			b, _ := ioutil.ReadAll(conn)
+			conn.Close()
+			if len(b) != 0 {
+				t.Error("the connection should have been rejected:", string(b))
+			}
+		}
+	})
+
+	lstn.Close()
+
+	if _, err := lstn.Accept(); err == nil {
+		t.Error("accepting connections on a closed listener should fail")
+	}
+}
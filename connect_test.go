@@ -0,0 +1,215 @@
+package consul
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConnectCARoots(t *testing.T) {
+	ca := newTestCA(t, "consul.test")
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/agent/connect/ca/roots" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		json.NewEncoder(res).Encode(ca.roots())
+	})
+	defer server.Close()
+
+	connect := &Connect{Client: client}
+
+	roots, err := connect.CARoots(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	active, ok := roots.Active()
+	if !ok {
+		t.Fatal("no active root found")
+	}
+	if active.ID != "root-1" {
+		t.Error("bad active root:", active.ID)
+	}
+
+	leaf := ca.issue(t, "web")
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots.CertPool()}); err != nil {
+		t.Error("certificate issued by the CA could not be verified:", err)
+	}
+}
+
+func TestCARootsCache(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		index, _ := strconv.Atoi(req.URL.Query().Get("index"))
+		if index != 0 {
+			// Simulate a blocking query that never sees a change.
+			<-req.Context().Done()
+			return
+		}
+		res.Header().Set("X-Consul-Index", "1")
+		json.NewEncoder(res).Encode(CARoots{ActiveRootID: "root-1", TrustDomain: "consul.test"})
+	})
+	defer server.Close()
+
+	cache := &CARootsCache{Watcher: &Watcher{Client: client}}
+	defer cache.Close()
+
+	for i := 0; i != 3; i++ {
+		roots, err := cache.Roots(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if roots.ActiveRootID != "root-1" {
+			t.Error("bad active root ID:", roots.ActiveRootID)
+		}
+	}
+
+	cache.Close()
+	server.CloseClientConnections()
+}
+
+func TestCARootsCacheFirstUpdateFailed(t *testing.T) {
+	requests := int32(0)
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1, 2:
+			// The agent is still starting when the first update is fetched.
+			http.Error(res, "starting", http.StatusInternalServerError)
+		case 3:
+			res.Header().Set("X-Consul-Index", "1")
+			json.NewEncoder(res).Encode(CARoots{ActiveRootID: "root-1", TrustDomain: "consul.test"})
+		default:
+			<-req.Context().Done()
+		}
+	})
+	defer server.Close()
+
+	cache := &CARootsCache{Watcher: &Watcher{Client: client, MaxAttempts: 1, InitialBackoff: time.Millisecond}}
+	defer cache.Close()
+
+	if _, err := cache.Roots(context.Background()); err == nil {
+		t.Fatal("expected the error of the first update")
+	}
+
+	for atomic.LoadInt32(&requests) < 4 {
+		time.Sleep(time.Millisecond)
+	}
+
+	roots, err := cache.Roots(context.Background())
+	if err != nil {
+		t.Fatal("the error of the first update was not cleared:", err)
+	}
+	if roots.ActiveRootID != "root-1" {
+		t.Error("bad active root ID:", roots.ActiveRootID)
+	}
+}
+
+// testCA is a minimal certificate authority issuing Connect certificates for
+// tests.
+type testCA struct {
+	trustDomain string
+	key         *ecdsa.PrivateKey
+	cert        *x509.Certificate
+	pem         string
+	serial      int64
+}
+
+func newTestCA(t *testing.T, trustDomain string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Consul Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		URIs:                  []*url.URL{{Scheme: "spiffe", Host: trustDomain}},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testCA{
+		trustDomain: trustDomain,
+		key:         key,
+		cert:        cert,
+		pem:         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		serial:      1,
+	}
+}
+
+func (ca *testCA) roots() CARoots {
+	return CARoots{
+		ActiveRootID: "root-1",
+		TrustDomain:  ca.trustDomain,
+		Roots: []CARoot{{
+			ID:        "root-1",
+			Name:      "Consul Test CA",
+			RootCert:  ca.pem,
+			NotBefore: ca.cert.NotBefore,
+			NotAfter:  ca.cert.NotAfter,
+			Active:    true,
+		}},
+	}
+}
+
+func (ca *testCA) issue(t *testing.T, service string) *x509.Certificate {
+	cert, _, _ := ca.issuePEM(t, service, time.Hour)
+	return cert
+}
+
+func (ca *testCA) issuePEM(t *testing.T, service string, ttl time.Duration) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: service},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(ttl),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		URIs: []*url.URL{{
+			Scheme: "spiffe",
+			Host:   ca.trustDomain,
+			Path:   "/ns/default/dc/dc1/svc/" + service,
+		}},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return cert, certPEM, keyPEM
+}
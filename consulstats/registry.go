@@ -0,0 +1,348 @@
+// Package consulstats exports the metrics reported by consul clients,
+// resolvers, and sessions to Prometheus and expvar.
+//
+// A Registry collects the metrics when it is set as the Stats of clients, it
+// serves them in the Prometheus text format, and may be published to expvar:
+//
+//	registry := &consulstats.Registry{}
+//	registry.Publish("consul")
+//
+//	client, err := consul.NewClient(consul.WithStats(registry))
+//	...
+//	http.Handle("/metrics", registry)
+//
+// The package does not depend on the Prometheus client library, the registry
+// is scraped like any other Prometheus target.
+package consulstats
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+// DefaultBuckets are the upper bounds of the histogram buckets used by
+// registries which don't configure any, they are suited to durations in
+// seconds.
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// Registry is an implementation of consul.Stats which keeps the metrics in
+// memory, and exports them to Prometheus and expvar.
+//
+// Counters are exported with the "_total" suffix, and distributions as
+// Prometheus histograms. Dots in metric names are replaced with underscores.
+//
+// The zero-value is a valid Registry, registries are safe to use concurrently
+// from multiple goroutines.
+type Registry struct {
+	// The prefix of the names of exported metrics. If empty, "consul" is used.
+	Namespace string
+
+	// The upper bounds of histogram buckets, which must be sorted in
+	// increasing order. If nil, DefaultBuckets is used.
+	Buckets []float64
+
+	mutex    sync.Mutex
+	families map[string]*family
+}
+
+type metricKind int
+
+const (
+	counter metricKind = iota
+	gauge
+	histogram
+)
+
+// family is the group of metrics of the same name, which only differ by tags.
+type family struct {
+	name    string
+	kind    metricKind
+	metrics map[string]*metric
+}
+
+type metric struct {
+	tags    []consul.Tag
+	value   float64
+	sum     float64
+	count   uint64
+	buckets []uint64
+}
+
+// Count satisfies the consul.Stats interface.
+func (r *Registry) Count(name string, n int64, tags ...consul.Tag) {
+	r.mutex.Lock()
+	r.metric(name, counter, tags).value += float64(n)
+	r.mutex.Unlock()
+}
+
+// Gauge satisfies the consul.Stats interface.
+func (r *Registry) Gauge(name string, value float64, tags ...consul.Tag) {
+	r.mutex.Lock()
+	r.metric(name, gauge, tags).value = value
+	r.mutex.Unlock()
+}
+
+// Observe satisfies the consul.Stats interface.
+func (r *Registry) Observe(name string, value float64, tags ...consul.Tag) {
+	r.mutex.Lock()
+	m := r.metric(name, histogram, tags)
+	m.sum += value
+	m.count++
+
+	buckets := r.buckets()
+	if m.buckets == nil {
+		m.buckets = make([]uint64, len(buckets))
+	}
+	if i := sort.SearchFloat64s(buckets, value); i < len(m.buckets) {
+		m.buckets[i]++
+	}
+	r.mutex.Unlock()
+}
+
+// metric returns the metric of the given name and tags, creating it if it did
+// not exist. Metrics reported with a kind different from the one first
+// reported under the same name are discarded, so the exported types stay
+// consistent. The registry mutex must be held.
+func (r *Registry) metric(name string, kind metricKind, tags []consul.Tag) *metric {
+	name = r.exportedName(name, kind)
+
+	f := r.families[name]
+	if f == nil {
+		if r.families == nil {
+			r.families = make(map[string]*family)
+		}
+		f = &family{name: name, kind: kind, metrics: make(map[string]*metric)}
+		r.families[name] = f
+	} else if f.kind != kind {
+		return &metric{}
+	}
+
+	key := tagsKey(tags)
+	m := f.metrics[key]
+	if m == nil {
+		m = &metric{tags: append([]consul.Tag(nil), tags...)}
+		sort.Slice(m.tags, func(i, j int) bool { return m.tags[i].Name < m.tags[j].Name })
+		f.metrics[key] = m
+	}
+	return m
+}
+
+func (r *Registry) exportedName(name string, kind metricKind) string {
+	namespace := r.Namespace
+	if len(namespace) == 0 {
+		namespace = "consul"
+	}
+
+	name = sanitize(namespace + "_" + name)
+
+	switch kind {
+	case counter:
+		name += "_total"
+	}
+
+	return name
+}
+
+func (r *Registry) buckets() []float64 {
+	if buckets := r.Buckets; buckets != nil {
+		return buckets
+	}
+	return DefaultBuckets
+}
+
+// ServeHTTP satisfies the http.Handler interface, it serves the metrics in the
+// Prometheus text format.
+func (r *Registry) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(res)
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	b := &strings.Builder{}
+	r.mutex.Lock()
+
+	for _, f := range r.sortedFamilies() {
+		fmt.Fprintf(b, "# TYPE %s %s\n", f.name, [...]string{"counter", "gauge", "histogram"}[f.kind])
+
+		for _, m := range f.sortedMetrics() {
+			switch f.kind {
+			case counter, gauge:
+				fmt.Fprintf(b, "%s%s %s\n", f.name, labels(m.tags, ""), formatFloat(m.value))
+
+			case histogram:
+				cumulative := uint64(0)
+				for i, bound := range r.buckets() {
+					if i < len(m.buckets) {
+						cumulative += m.buckets[i]
+					}
+					fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, labels(m.tags, formatFloat(bound)), cumulative)
+				}
+				fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, labels(m.tags, "+Inf"), m.count)
+				fmt.Fprintf(b, "%s_sum%s %s\n", f.name, labels(m.tags, ""), formatFloat(m.sum))
+				fmt.Fprintf(b, "%s_count%s %d\n", f.name, labels(m.tags, ""), m.count)
+			}
+		}
+	}
+
+	r.mutex.Unlock()
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// String satisfies the expvar.Var interface, it returns a JSON object mapping
+// the names of metrics to the list of their values, counts and sums of
+// distributions are exported instead of their buckets.
+func (r *Registry) String() string {
+	type value struct {
+		Tags  map[string]string `json:"tags,omitempty"`
+		Value float64           `json:"value"`
+		Count *uint64           `json:"count,omitempty"`
+	}
+
+	values := make(map[string][]value)
+	r.mutex.Lock()
+
+	for _, f := range r.sortedFamilies() {
+		list := make([]value, 0, len(f.metrics))
+
+		for _, m := range f.sortedMetrics() {
+			v := value{Value: m.value}
+
+			if len(m.tags) != 0 {
+				v.Tags = make(map[string]string, len(m.tags))
+				for _, tag := range m.tags {
+					v.Tags[tag.Name] = tag.Value
+				}
+			}
+
+			if f.kind == histogram {
+				count := m.count
+				v.Value, v.Count = m.sum, &count
+			}
+
+			list = append(list, v)
+		}
+
+		values[f.name] = list
+	}
+
+	r.mutex.Unlock()
+	b, _ := json.Marshal(values)
+	return string(b)
+}
+
+// Publish publishes the registry to expvar under the given name, so the
+// metrics are exposed by the /debug/vars handler.
+func (r *Registry) Publish(name string) {
+	expvar.Publish(name, r)
+}
+
+func (r *Registry) sortedFamilies() []*family {
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+	return families
+}
+
+func (f *family) sortedMetrics() []*metric {
+	keys := make([]string, 0, len(f.metrics))
+	for key := range f.metrics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	metrics := make([]*metric, len(keys))
+	for i, key := range keys {
+		metrics[i] = f.metrics[key]
+	}
+	return metrics
+}
+
+// tagsKey returns a string uniquely identifying the set of tags, regardless of
+// their order.
+func tagsKey(tags []consul.Tag) string {
+	pairs := make([]string, len(tags))
+	for i, tag := range tags {
+		pairs[i] = strconv.Quote(tag.Name) + "=" + strconv.Quote(tag.Value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// labels formats tags as Prometheus labels, with the le label of histogram
+// buckets if le is not empty.
+func labels(tags []consul.Tag, le string) string {
+	if len(tags) == 0 && len(le) == 0 {
+		return ""
+	}
+
+	b := &strings.Builder{}
+	b.WriteByte('{')
+
+	for i, tag := range tags {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, "%s=\"%s\"", sanitize(tag.Name), escapeLabel(tag.Value))
+	}
+
+	if len(le) != 0 {
+		if len(tags) != 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(b, "le=\"%s\"", le)
+	}
+
+	b.WriteByte('}')
+	return b.String()
+}
+
+// sanitize replaces the characters which are not allowed in Prometheus metric
+// and label names with underscores.
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	_ consul.Stats = (*Registry)(nil)
+	_ http.Handler = (*Registry)(nil)
+	_ expvar.Var   = (*Registry)(nil)
+)
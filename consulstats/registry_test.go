@@ -0,0 +1,100 @@
+package consulstats
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestRegistry(t *testing.T) {
+	r := &Registry{Buckets: []float64{0.1, 1}}
+
+	r.Count("client.requests", 1, consul.Tag{Name: "status", Value: "200"}, consul.Tag{Name: "method", Value: "GET"})
+	r.Count("client.requests", 2, consul.Tag{Name: "method", Value: "GET"}, consul.Tag{Name: "status", Value: "200"})
+	r.Gauge("resolver.endpoints", 3, consul.Tag{Name: "service", Value: `a"b`})
+	r.Observe("client.request.seconds", 0.05)
+	r.Observe("client.request.seconds", 0.5)
+	r.Observe("client.request.seconds", 5)
+	r.Gauge("client.request.seconds", 1) // discarded, the metric is a histogram
+
+	b := &strings.Builder{}
+	r.WriteTo(b)
+
+	const expected = `# TYPE consul_client_request_seconds histogram
+consul_client_request_seconds_bucket{le="0.1"} 1
+consul_client_request_seconds_bucket{le="1"} 2
+consul_client_request_seconds_bucket{le="+Inf"} 3
+consul_client_request_seconds_sum 5.55
+consul_client_request_seconds_count 3
+# TYPE consul_client_requests_total counter
+consul_client_requests_total{method="GET",status="200"} 3
+# TYPE consul_resolver_endpoints gauge
+consul_resolver_endpoints{service="a\"b"} 3
+`
+
+	if s := b.String(); s != expected {
+		t.Errorf("bad output:\n%s\nexpected:\n%s", s, expected)
+	}
+
+	var values map[string][]struct {
+		Tags  map[string]string
+		Value float64
+		Count uint64
+	}
+	if err := json.Unmarshal([]byte(r.String()), &values); err != nil {
+		t.Fatal(err)
+	}
+	if v := values["consul_client_requests_total"]; len(v) != 1 || v[0].Value != 3 || v[0].Tags["method"] != "GET" {
+		t.Error("bad expvar counter:", v)
+	}
+	if v := values["consul_client_request_seconds"]; len(v) != 1 || v[0].Count != 3 {
+		t.Error("bad expvar histogram:", v)
+	}
+}
+
+func TestRegistryClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode([]interface{}{
+			map[string]interface{}{
+				"Node":    map[string]interface{}{"Node": "node-1"},
+				"Service": map[string]interface{}{"ID": "A", "Address": "192.168.0.1", "Port": 4242},
+			},
+		})
+	}))
+	defer server.Close()
+
+	registry := &Registry{Namespace: "test"}
+	client, err := consul.NewClient(consul.WithAddress(server.URL), consul.WithStats(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rslv := &consul.Resolver{Client: client, DisableCoordinates: true}
+	if _, err := rslv.LookupService(context.Background(), "web"); err != nil {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	registry.ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+	output := res.Body.String()
+
+	for _, line := range []string{
+		`test_client_requests_total{method="GET",route="/v1/health/service",status="200"} 1`,
+		`test_resolver_lookups_total{result="ok",service="web"} 1`,
+		`test_resolver_endpoints{service="web"} 1`,
+		`test_balancer_picks_total{node="node-1",service="web"} 1`,
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("missing metric: %s", line)
+		}
+	}
+
+	if t.Failed() {
+		t.Log(output)
+	}
+}
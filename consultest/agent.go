@@ -0,0 +1,309 @@
+// Package consultest provides tools to unit test programs which use the consul
+// package, without having to run a consul agent.
+//
+// The main component of the package is Agent, an in-memory fake of a consul
+// agent served over HTTP, which implements the key/value store, transaction,
+// session, health, and catalog endpoints with the semantics of blocking
+// queries:
+//
+//	agent := consultest.NewAgent()
+//	defer agent.Close()
+//
+//	agent.Register(consul.ServiceEntry{
+//		Node:    consul.Node{Node: "node-2", Address: "10.0.0.2"},
+//		Service: consul.ServiceInstance{ID: "web-1", Service: "web", Address: "10.0.0.2", Port: 80},
+//	})
+//
+//	rslv := &consul.Resolver{Client: agent.Client(), DisableCoordinates: true}
+//	endpoints, err := rslv.LookupService(ctx, "web")
+//
+// The fake agent only covers the parts of the consul API that are commonly
+// used by applications, requests to other endpoints fail with a 501 status.
+//
+// For end-to-end tests, the package also provides Server, which runs a real
+// consul agent in dev mode as a subprocess or in a docker container:
+//
+//	func TestIntegration(t *testing.T) {
+//		server := consultest.NewServer(t, consultest.ServerConfig{})
+//		client := server.Client()
+//		...
+//	}
+//
+// Programs which only coordinate through locks and sessions can use Locks, an
+// in-memory implementation of consul.LockManager and consul.SessionManager.
+//
+// Authors of custom balancers can verify how they spread the load across
+// endpoints with SampleBalancer and the checks of Distribution.
+//
+// GenerateLoad runs concurrent lookups and watches of services registered on
+// an Agent while they change, to measure the performance of service discovery.
+package consultest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+const (
+	// DefaultDatacenter is the datacenter that fake agents report being part
+	// of.
+	DefaultDatacenter = "dc1"
+
+	// DefaultNode is the name of the node that fake agents report running on.
+	DefaultNode = "consultest"
+
+	// maxWait is the longest duration that blocking queries are held for,
+	// which is also the default when requests don't have a wait parameter.
+	maxWait = 5 * time.Minute
+)
+
+// Agent is an in-memory fake of a consul agent, serving the consul HTTP API on
+// a local address.
+//
+// Each write to the state of the agent increments a global index, and each
+// part of the state (key/value store, sessions, catalog) reports the index of
+// its last modification in the X-Consul-Index header, so blocking queries
+// behave as they do with a real agent.
+//
+// Checks registered through the agent API start passing, except for TTL checks
+// which start critical as they would with consul, the fake agent does not run
+// health checks.
+//
+// Agents are safe to use concurrently from multiple goroutines.
+type Agent struct {
+	server *httptest.Server
+
+	mutex  sync.Mutex
+	notify chan struct{}
+	index  uint64
+
+	kvIndex      uint64
+	sessionIndex uint64
+	catalogIndex uint64
+
+	kv       map[string]*kvEntry
+	sessions map[consul.SessionID]*session
+	nodes    map[string]*node
+	nextID   uint64
+}
+
+// NewAgent starts and returns a new fake agent. The program must call Close
+// when it doesn't need the agent anymore to release its resources.
+func NewAgent() *Agent {
+	a := &Agent{
+		notify:   make(chan struct{}),
+		index:    1,
+		kv:       make(map[string]*kvEntry),
+		sessions: make(map[consul.SessionID]*session),
+		nodes:    make(map[string]*node),
+	}
+
+	a.registerNode(consul.Node{
+		Node:       DefaultNode,
+		Address:    "127.0.0.1",
+		Datacenter: DefaultDatacenter,
+	})
+	a.registerCheck(DefaultNode, consul.HealthCheck{
+		CheckID: "serfHealth",
+		Name:    "Serf Health Status",
+		Status:  consul.Passing,
+	})
+
+	a.server = httptest.NewServer(a)
+	return a
+}
+
+// Close stops the agent.
+func (a *Agent) Close() {
+	a.server.Close()
+
+	a.mutex.Lock()
+	for _, s := range a.sessions {
+		s.stop()
+	}
+	a.mutex.Unlock()
+}
+
+// URL returns the base URL of the agent, in the form http://ip:port.
+func (a *Agent) URL() string {
+	return a.server.URL
+}
+
+// Client returns a new client configured to send requests to the agent.
+func (a *Agent) Client() *consul.Client {
+	return &consul.Client{
+		Address:   a.server.URL,
+		UserAgent: "consultest",
+		Transport: a.server.Client().Transport,
+	}
+}
+
+// Index returns the current index of the agent, which is incremented on every
+// write.
+func (a *Agent) Index() uint64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.index
+}
+
+// ServeHTTP satisfies the http.Handler interface.
+func (a *Agent) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+
+	switch {
+	case strings.HasPrefix(path, "/v1/kv/") || path == "/v1/kv":
+		a.serveKV(res, req, strings.TrimPrefix(strings.TrimPrefix(path, "/v1/kv"), "/"))
+	case path == "/v1/txn":
+		a.serveTxn(res, req)
+	case strings.HasPrefix(path, "/v1/session/"):
+		a.serveSession(res, req, strings.TrimPrefix(path, "/v1/session/"))
+	case strings.HasPrefix(path, "/v1/catalog/"):
+		a.serveCatalog(res, req, strings.TrimPrefix(path, "/v1/catalog/"))
+	case strings.HasPrefix(path, "/v1/health/"):
+		a.serveHealth(res, req, strings.TrimPrefix(path, "/v1/health/"))
+	case strings.HasPrefix(path, "/v1/agent/"):
+		a.serveAgent(res, req, strings.TrimPrefix(path, "/v1/agent/"))
+	case path == "/v1/coordinate/nodes" && req.Method == "GET":
+		a.coordinateNodes(res, req)
+	default:
+		unsupported(res, req)
+	}
+}
+
+func (a *Agent) serveAgent(res http.ResponseWriter, req *http.Request, path string) {
+	switch {
+	case path == "self" && req.Method == "GET":
+		a.writeJSON(res, 0, map[string]interface{}{
+			"Config": map[string]interface{}{
+				"Datacenter": DefaultDatacenter,
+				"NodeName":   DefaultNode,
+			},
+		})
+	case path == "service/register" && req.Method == "PUT":
+		a.agentRegisterService(res, req)
+	case strings.HasPrefix(path, "service/deregister/") && req.Method == "PUT":
+		a.agentDeregisterService(res, strings.TrimPrefix(path, "service/deregister/"))
+	case strings.HasPrefix(path, "check/") && req.Method == "PUT":
+		a.agentUpdateCheck(res, req, strings.TrimPrefix(path, "check/"))
+	default:
+		unsupported(res, req)
+	}
+}
+
+// The fake agent has no network coordinates, which makes the resolver leave the
+// RTT of endpoints unset.
+func (a *Agent) coordinateNodes(res http.ResponseWriter, req *http.Request) {
+	if !a.block(req, tableIndex(&a.catalogIndex)) {
+		return
+	}
+	defer a.mutex.Unlock()
+	a.writeJSON(res, a.catalogIndex, []struct{}{})
+}
+
+// commit must be called with the mutex held after modifying the state of the
+// agent, table points to the index of the part of the state that changed.
+func (a *Agent) commit(tables ...*uint64) {
+	a.index++
+	for _, table := range tables {
+		*table = a.index
+	}
+	close(a.notify)
+	a.notify = make(chan struct{})
+}
+
+// block implements blocking queries, it returns with the mutex held once the
+// index of the result is greater than the index of the request, or the wait
+// time expired. The returned value is false if the request was canceled, in
+// which case the mutex is not held.
+func (a *Agent) block(req *http.Request, result func() uint64) bool {
+	query := req.URL.Query()
+	index, _ := strconv.ParseUint(query.Get("index"), 10, 64)
+	wait := maxWait
+
+	if s := query.Get("wait"); len(s) != 0 {
+		if d, err := time.ParseDuration(s); err == nil && d > 0 && d < maxWait {
+			wait = d
+		}
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		a.mutex.Lock()
+
+		if index == 0 || result() > index {
+			return true
+		}
+
+		notify := a.notify
+		a.mutex.Unlock()
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			a.mutex.Lock()
+			return true
+		case <-req.Context().Done():
+			return false
+		}
+	}
+}
+
+// tableIndex returns a function reporting the current value of table, for use
+// with block.
+func tableIndex(table *uint64) func() uint64 {
+	return func() uint64 { return *table }
+}
+
+func (a *Agent) writeJSON(res http.ResponseWriter, index uint64, value interface{}) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	a.writeBody(res, index, "application/json", b)
+}
+
+func (a *Agent) writeBody(res http.ResponseWriter, index uint64, contentType string, body []byte) {
+	h := res.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("X-Consul-KnownLeader", "true")
+	h.Set("X-Consul-LastContact", "0")
+	if index != 0 {
+		h.Set("X-Consul-Index", strconv.FormatUint(index, 10))
+	}
+	res.Write(body)
+}
+
+func (a *Agent) newID() string {
+	a.nextID++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012x", a.nextID)
+}
+
+func readJSON(res http.ResponseWriter, req *http.Request, value interface{}) bool {
+	if err := json.NewDecoder(req.Body).Decode(value); err != nil {
+		http.Error(res, "Request decode failed: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func notFound(res http.ResponseWriter, index uint64) {
+	if index != 0 {
+		res.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+	}
+	res.WriteHeader(http.StatusNotFound)
+}
+
+func unsupported(res http.ResponseWriter, req *http.Request) {
+	http.Error(res, fmt.Sprintf("consultest: %s %s is not supported by the fake agent", req.Method, req.URL.Path), http.StatusNotImplemented)
+}
@@ -0,0 +1,290 @@
+package consultest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestAgentStore(t *testing.T) {
+	agent := NewAgent()
+	defer agent.Close()
+
+	ctx := context.Background()
+	store := &consul.Store{Client: agent.Client(), Keyspace: "test"}
+
+	if ok, err := store.WriteValue(ctx, "A", "1", 0); err != nil || !ok {
+		t.Fatal("writing a new key failed:", ok, err)
+	}
+
+	if ok, err := store.WriteValue(ctx, "A", "2", 0); err != nil || ok {
+		t.Fatal("writing an existing key with a zero index must fail:", ok, err)
+	}
+
+	agent.Put("test/B/C", []byte(`"3"`))
+
+	var value string
+	index, err := store.ReadValue(ctx, "A", &value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "1" {
+		t.Error("bad value:", value)
+	}
+
+	if ok, err := store.WriteValue(ctx, "A", "2", index); err != nil || !ok {
+		t.Fatal("compare-and-swap failed:", ok, err)
+	}
+
+	keys, err := store.Tree(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"A", "B/C"}) {
+		t.Error("bad keys:", keys)
+	}
+
+	if ok, err := store.Delete(ctx, "B", 0); err != nil || !ok {
+		t.Fatal("delete failed:", ok, err)
+	}
+
+	if _, err := store.ReadValue(ctx, "B/C", &value); !errors.Is(err, consul.ErrNotFound) {
+		t.Error("expected a not found error after deleting the key but got:", err)
+	}
+}
+
+func TestAgentBlockingQuery(t *testing.T) {
+	agent := NewAgent()
+	defer agent.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := agent.Client()
+	agent.Put("key", []byte("A"))
+
+	_, meta, err := (&consul.Sessions{Client: client}).List(ctx, consul.SessionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := consul.KVOptions{Raw: true}
+	opts.WaitIndex = agent.Index()
+	opts.WaitTime = 50 * time.Millisecond
+
+	start := time.Now()
+	if _, err := client.GetWithMeta(ctx, "/v1/kv/key", opts.Query(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < opts.WaitTime {
+		t.Error("the blocking query returned before the wait time expired:", elapsed)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		agent.Put("key", []byte("B"))
+	}()
+
+	opts.WaitTime = 5 * time.Second
+	kvMeta, err := client.GetWithMeta(ctx, "/v1/kv/key", opts.Query(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kvMeta.LastIndex <= opts.WaitIndex {
+		t.Error("the index was not incremented:", kvMeta.LastIndex)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("the blocking query did not return after the key was modified")
+	}
+
+	// Writes to the key/value store must not change the index of sessions.
+	_, sessionMeta, err := (&consul.Sessions{Client: client}).List(ctx, consul.SessionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessionMeta.LastIndex != meta.LastIndex {
+		t.Error("the index of sessions changed:", meta.LastIndex, "!=", sessionMeta.LastIndex)
+	}
+}
+
+func TestAgentLocks(t *testing.T) {
+	agent := NewAgent()
+	defer agent.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	locker := &consul.Locker{
+		Client:    agent.Client(),
+		LockDelay: 300 * time.Millisecond,
+	}
+
+	lock, unlock := locker.TryLockOne(ctx, "key")
+	defer unlock()
+
+	if err := lock.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	lock2, unlock2 := locker.TryLockOne(ctx, "key")
+	defer unlock2()
+
+	if err := consul.LockError(lock2); lock2.Err() != consul.Unlocked || !errors.Is(err, consul.ErrLockHeld) {
+		t.Error("expected the lock to be held but got:", err)
+	}
+
+	sessions, _, err := (&consul.Sessions{Client: agent.Client()}).List(ctx, consul.SessionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 {
+		t.Fatal("expected a single session but found", len(sessions))
+	}
+
+	if !agent.InvalidateSession(sessions[0].ID) {
+		t.Fatal("the session was not found")
+	}
+
+	select {
+	case <-lock.Done():
+	case <-ctx.Done():
+		t.Fatal("the lock was not lost after its session was invalidated")
+	}
+
+	lock3, unlock3 := locker.TryLockOne(ctx, "key")
+	defer unlock3()
+
+	if err := lock3.Err(); err != nil {
+		t.Error("the lock could not be acquired after being released:", err)
+	}
+}
+
+func TestAgentResolver(t *testing.T) {
+	agent := NewAgent()
+	defer agent.Close()
+
+	agent.Register(consul.ServiceEntry{
+		Node:    consul.Node{Node: "node-1", Address: "10.0.0.1"},
+		Service: consul.ServiceInstance{ID: "web-1", Service: "web", Address: "10.0.0.1", Port: 80, Tags: []string{"primary"}},
+	})
+
+	agent.Register(consul.ServiceEntry{
+		Node:    consul.Node{Node: "node-2", Address: "10.0.0.2"},
+		Service: consul.ServiceInstance{ID: "web-2", Service: "web", Address: "10.0.0.2", Port: 80},
+		Checks:  []consul.HealthCheck{{Name: "web"}},
+	})
+
+	rslv := &consul.Resolver{
+		Client:             agent.Client(),
+		OnlyPassing:        true,
+		DisableCoordinates: true,
+	}
+
+	ctx := context.Background()
+
+	endpoints, err := rslv.LookupService(ctx, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 2 {
+		t.Fatal("expected 2 endpoints but got", len(endpoints))
+	}
+	if addr := endpoints[0].Addr.String(); addr != "10.0.0.1:80" {
+		t.Error("bad address:", addr)
+	}
+
+	if !agent.SetCheckStatus("service:web-2", consul.Critical) {
+		t.Fatal("the check was not found")
+	}
+
+	endpoints, err = rslv.LookupService(ctx, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].ID != "web-1" {
+		t.Error("bad endpoints after the check turned critical:", endpoints)
+	}
+
+	rslv.OnlyPassing = false
+	rslv.ServiceTags = []string{"primary"}
+
+	endpoints, err = rslv.LookupService(ctx, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].ID != "web-1" {
+		t.Error("bad endpoints when filtering on tags:", endpoints)
+	}
+
+	agent.Deregister("node-1", "web-1")
+
+	entries, _, err := (&consul.Health{Client: agent.Client()}).Service(ctx, "web", consul.HealthOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Service.ID != "web-2" {
+		t.Error("bad entries after deregistering a service:", entries)
+	}
+	if status := consul.AggregateHealth(entries[0].Checks); status != consul.Critical {
+		t.Error("bad health status:", status)
+	}
+}
+
+func TestAgentRegisterService(t *testing.T) {
+	agent := NewAgent()
+	defer agent.Close()
+
+	ctx := context.Background()
+	client := agent.Client()
+
+	err := client.Put(ctx, "/v1/agent/service/register", nil, map[string]interface{}{
+		"Name":  "worker",
+		"Port":  4242,
+		"Check": map[string]interface{}{"TTL": "10s"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks, err := (&consul.Health{Client: client}).ChecksInState(ctx, consul.Critical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 1 || checks[0].CheckID != "service:worker" {
+		t.Fatal("TTL checks must start critical:", checks)
+	}
+
+	if err := client.Put(ctx, "/v1/agent/check/pass/service:worker", nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	services, err := (&consul.Catalog{Client: client}).ListServices(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := services["worker"]; !ok {
+		t.Error("the service is missing from the catalog:", services)
+	}
+
+	checks, err = (&consul.Health{Client: client}).ChecksInState(ctx, consul.Critical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 0 {
+		t.Error("the check is still critical:", checks)
+	}
+}
+
+func TestAgentUnsupported(t *testing.T) {
+	agent := NewAgent()
+	defer agent.Close()
+
+	err := agent.Client().Get(context.Background(), "/v1/acl/tokens", nil, nil)
+	if err == nil {
+		t.Fatal("expected an error but got none")
+	}
+}
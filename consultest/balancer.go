@@ -0,0 +1,285 @@
+package consultest
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+// Distribution is the number of times that each endpoint was placed first in
+// the lists returned by a balancer, which is the endpoint that programs would
+// send requests to.
+//
+// Distributions are produced by SampleBalancer and checked against expected
+// shares of traffic with CheckShares or CheckChiSquared, so authors of custom
+// balancers can verify the load they spread across endpoints:
+//
+//	d := consultest.SampleBalancer(balancer, "web", endpoints, 10000)
+//	consultest.AssertChiSquared(t, d, consultest.UniformShares(endpoints), 0.001)
+type Distribution struct {
+	// The number of lists that the balancer returned.
+	Draws int
+
+	// The number of times each endpoint was placed first, indexed by endpoint
+	// ID.
+	Counts map[string]int
+}
+
+// SampleBalancer calls balancer draws times with copies of endpoints, and
+// returns the distribution of the first endpoint of the lists it returned.
+func SampleBalancer(balancer consul.Balancer, name string, endpoints []consul.Endpoint, draws int) Distribution {
+	d := Distribution{Counts: make(map[string]int, len(endpoints))}
+	list := make([]consul.Endpoint, len(endpoints))
+
+	for i := 0; i != draws; i++ {
+		copy(list, endpoints)
+
+		if balanced := balancer.Balance(name, list); len(balanced) != 0 {
+			d.Counts[balanced[0].ID]++
+		}
+
+		d.Draws++
+	}
+
+	return d
+}
+
+// Share returns the fraction of draws in which the endpoint with the given ID
+// was placed first.
+func (d Distribution) Share(id string) float64 {
+	if d.Draws == 0 {
+		return 0
+	}
+	return float64(d.Counts[id]) / float64(d.Draws)
+}
+
+// String returns a human-readable representation of d, listing endpoints by
+// decreasing share.
+func (d Distribution) String() string {
+	ids := make([]string, 0, len(d.Counts))
+	for id := range d.Counts {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		if ci, cj := d.Counts[ids[i]], d.Counts[ids[j]]; ci != cj {
+			return ci > cj
+		}
+		return ids[i] < ids[j]
+	})
+
+	s := strings.Builder{}
+	fmt.Fprintf(&s, "%d draws", d.Draws)
+
+	for _, id := range ids {
+		fmt.Fprintf(&s, "\n%s: %d (%.2f%%)", id, d.Counts[id], 100*d.Share(id))
+	}
+
+	return s.String()
+}
+
+// UniformShares returns the expected shares of a balancer spreading the load
+// evenly across endpoints.
+func UniformShares(endpoints []consul.Endpoint) map[string]float64 {
+	shares := make(map[string]float64, len(endpoints))
+
+	for _, endpoint := range endpoints {
+		shares[endpoint.ID] = 1 / float64(len(endpoints))
+	}
+
+	return shares
+}
+
+// WeightedShares returns the expected shares of a consul.WeightedShuffler
+// using weightOf. Like in the shuffler, endpoints with lower weights are
+// preferred: the share of each endpoint is inversely proportional to its
+// weight.
+func WeightedShares(endpoints []consul.Endpoint, weightOf func(consul.Endpoint) float64) map[string]float64 {
+	shares := make(map[string]float64, len(endpoints))
+	sum := 0.0
+
+	for _, endpoint := range endpoints {
+		share := 1 / weightOf(endpoint)
+		shares[endpoint.ID] = share
+		sum += share
+	}
+
+	for id := range shares {
+		shares[id] /= sum
+	}
+
+	return shares
+}
+
+// CheckShares verifies that the share of each endpoint in d is within
+// tolerance of the expected share, both being fractions of the draws between
+// 0 and 1. Endpoints which are missing from expected must never be placed
+// first.
+func (d Distribution) CheckShares(expected map[string]float64, tolerance float64) error {
+	var errs []string
+
+	for _, id := range distributionIDs(d, expected) {
+		share, want := d.Share(id), expected[id]
+
+		if math.Abs(share-want) > tolerance {
+			errs = append(errs, fmt.Sprintf("%s: share of %.4f, expected %.4f±%.4f", id, share, want, tolerance))
+		}
+	}
+
+	if len(errs) != 0 {
+		return fmt.Errorf("consultest: unexpected balancer distribution:\n%s", strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
+// ChiSquared runs a Pearson's chi-squared test of d against the expected
+// shares, returning the test statistic and its p-value: the probability that
+// a balancer producing the expected shares would deviate at least as much
+// from them as d does.
+//
+// Expected shares are normalized, so they don't need to add up to 1. The
+// p-value is zero if an endpoint with no expected share was placed first.
+func (d Distribution) ChiSquared(expected map[string]float64) (stat float64, pvalue float64) {
+	sum := 0.0
+	for _, share := range expected {
+		sum += share
+	}
+
+	categories := 0
+
+	for _, id := range distributionIDs(d, expected) {
+		observed := float64(d.Counts[id])
+		want := 0.0
+		if sum > 0 {
+			want = float64(d.Draws) * expected[id] / sum
+		}
+
+		if want == 0 {
+			if observed != 0 {
+				return math.Inf(1), 0
+			}
+			continue
+		}
+
+		stat += (observed - want) * (observed - want) / want
+		categories++
+	}
+
+	if categories < 2 {
+		return stat, 1
+	}
+
+	return stat, gammaQ(float64(categories-1)/2, stat/2)
+}
+
+// CheckChiSquared verifies that d is consistent with the expected shares, it
+// returns an error if the p-value of the chi-squared test is lower than alpha.
+//
+// The value of alpha is the probability of rejecting a correct balancer, tests
+// typically use low values (like 0.001) to avoid flaking. The test requires
+// enough draws for each endpoint to be expected to be placed first at least
+// five times.
+func (d Distribution) CheckChiSquared(expected map[string]float64, alpha float64) error {
+	if stat, pvalue := d.ChiSquared(expected); pvalue < alpha {
+		return fmt.Errorf("consultest: balancer distribution does not match the expected shares (chi-squared = %g, p-value = %g < %g):\n%s", stat, pvalue, alpha, d)
+	}
+	return nil
+}
+
+// AssertShares fails the test if d does not match the expected shares, see
+// Distribution.CheckShares for details.
+func AssertShares(t testing.TB, d Distribution, expected map[string]float64, tolerance float64) {
+	t.Helper()
+
+	if err := d.CheckShares(expected, tolerance); err != nil {
+		t.Error(err)
+	}
+}
+
+// AssertChiSquared fails the test if d is not consistent with the expected
+// shares, see Distribution.CheckChiSquared for details.
+func AssertChiSquared(t testing.TB, d Distribution, expected map[string]float64, alpha float64) {
+	t.Helper()
+
+	if err := d.CheckChiSquared(expected, alpha); err != nil {
+		t.Error(err)
+	}
+}
+
+func distributionIDs(d Distribution, expected map[string]float64) []string {
+	ids := make([]string, 0, len(expected)+len(d.Counts))
+
+	for id := range expected {
+		ids = append(ids, id)
+	}
+
+	for id := range d.Counts {
+		if _, ok := expected[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+// gammaQ computes the regularized upper incomplete gamma function Q(a, x),
+// which gives the p-values of chi-squared tests.
+func gammaQ(a float64, x float64) float64 {
+	const epsilon = 1e-15
+	const maxIterations = 1000
+
+	if x <= 0 {
+		return 1
+	}
+
+	lgamma, _ := math.Lgamma(a)
+	prefix := math.Exp(a*math.Log(x) - x - lgamma)
+
+	if x < a+1 {
+		// Series representation of P(a, x) = 1 - Q(a, x).
+		sum, term := 1/a, 1/a
+		for n := 1; n < maxIterations; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*epsilon {
+				break
+			}
+		}
+		return math.Max(0, 1-sum*prefix)
+	}
+
+	// Continued fraction representation of Q(a, x), evaluated with the
+	// modified Lentz's method.
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	f := 1 / b
+	h := f
+
+	for n := 1; n < maxIterations; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		f = an*f + b
+		if math.Abs(f) < tiny {
+			f = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		f = 1 / f
+		delta := f * c
+		h *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+
+	return h * prefix
+}
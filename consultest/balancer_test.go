@@ -0,0 +1,85 @@
+package consultest
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestSampleBalancer(t *testing.T) {
+	endpoints := testEndpoints(10)
+	uniform := UniformShares(endpoints)
+
+	t.Run("RoundRobin", func(t *testing.T) {
+		d := SampleBalancer(&consul.RoundRobin{}, "test", endpoints, 1000)
+
+		if d.Draws != 1000 {
+			t.Error("bad number of draws:", d.Draws)
+		}
+		AssertShares(t, d, uniform, 0)
+	})
+
+	t.Run("Shuffler", func(t *testing.T) {
+		d := SampleBalancer(&consul.Shuffler{Source: rand.NewSource(1)}, "test", endpoints, 10000)
+		AssertShares(t, d, uniform, 0.02)
+		AssertChiSquared(t, d, uniform, 0.001)
+	})
+
+	t.Run("WeightedShuffler", func(t *testing.T) {
+		balancer := &consul.WeightedShuffler{WeightOf: consul.WeightRTT, Source: rand.NewSource(1)}
+		d := SampleBalancer(balancer, "test", endpoints, 10000)
+		AssertChiSquared(t, d, WeightedShares(endpoints, consul.WeightRTT), 0.001)
+
+		if err := d.CheckChiSquared(uniform, 0.001); err == nil {
+			t.Error("the weighted distribution must not be uniform")
+		}
+	})
+
+	t.Run("NullBalancer", func(t *testing.T) {
+		d := SampleBalancer(&consul.NullBalancer{}, "test", endpoints, 100)
+
+		if err := d.CheckShares(uniform, 0.1); err == nil {
+			t.Error("expected an error for a balancer always returning the same endpoint")
+		}
+		if stat, pvalue := d.ChiSquared(uniform); pvalue > 1e-9 {
+			t.Error("bad chi-squared test result:", stat, pvalue)
+		}
+		if _, pvalue := d.ChiSquared(map[string]float64{"0": 1}); pvalue != 1 {
+			t.Error("bad p-value for a distribution matching a single endpoint:", pvalue)
+		}
+	})
+}
+
+func TestGammaQ(t *testing.T) {
+	// Critical values of the chi-squared distribution at a 0.05 significance.
+	tests := []struct {
+		df   int
+		stat float64
+	}{
+		{df: 1, stat: 3.841},
+		{df: 2, stat: 5.991},
+		{df: 10, stat: 18.307},
+		{df: 100, stat: 124.342},
+	}
+
+	for _, test := range tests {
+		if pvalue := gammaQ(float64(test.df)/2, test.stat/2); math.Abs(pvalue-0.05) > 1e-3 {
+			t.Errorf("bad p-value for %d degrees of freedom: %g", test.df, pvalue)
+		}
+	}
+}
+
+func testEndpoints(n int) []consul.Endpoint {
+	endpoints := make([]consul.Endpoint, n)
+
+	for i := range endpoints {
+		endpoints[i].ID = strconv.Itoa(i)
+		endpoints[i].RTT = time.Duration(i+1) * time.Millisecond
+	}
+
+	return endpoints
+}
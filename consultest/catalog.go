@@ -0,0 +1,676 @@
+package consultest
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+type node struct {
+	info     consul.Node
+	services map[string]consul.ServiceInstance
+	checks   map[string]consul.HealthCheck
+}
+
+// entries returns the service entries of the node matching the given service
+// name.
+func (n *node) entries(name string) []consul.ServiceEntry {
+	var entries []consul.ServiceEntry
+
+	for _, service := range n.services {
+		if service.Service != name {
+			continue
+		}
+
+		entry := consul.ServiceEntry{
+			Node:    n.info,
+			Service: service,
+			Checks:  []consul.HealthCheck{},
+		}
+
+		for _, check := range n.checks {
+			if len(check.ServiceID) == 0 || check.ServiceID == service.ID {
+				entry.Checks = append(entry.Checks, check)
+			}
+		}
+
+		sort.Slice(entry.Checks, func(i, j int) bool {
+			return entry.Checks[i].CheckID < entry.Checks[j].CheckID
+		})
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// Register adds the node, service, and checks of entry to the catalog of the
+// agent, replacing previous registrations with the same identifiers.
+//
+// The node name defaults to DefaultNode, the service ID defaults to the
+// service name, and the checks default to passing.
+func (a *Agent) Register(entry consul.ServiceEntry) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(entry.Node.Node) == 0 {
+		entry.Node.Node = DefaultNode
+	}
+
+	if n := a.nodes[entry.Node.Node]; n == nil || len(entry.Node.Address) != 0 {
+		a.registerNode(entry.Node)
+	}
+
+	if len(entry.Service.Service) != 0 {
+		a.registerService(entry.Node.Node, entry.Service)
+	}
+
+	for _, check := range entry.Checks {
+		if len(check.ServiceID) == 0 && len(entry.Service.Service) != 0 {
+			check.ServiceID = entry.Service.ID
+			if len(check.ServiceID) == 0 {
+				check.ServiceID = entry.Service.Service
+			}
+		}
+		a.registerCheck(entry.Node.Node, check)
+	}
+}
+
+// Deregister removes the service with the given ID from node, along with its
+// checks. The method returns false if no such service was registered.
+func (a *Agent) Deregister(node string, serviceID string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.deregisterService(node, serviceID)
+}
+
+// SetCheckStatus changes the status of all checks with the given ID. The method
+// returns false if no such check was registered.
+func (a *Agent) SetCheckStatus(checkID string, status consul.HealthStatus) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.setCheckStatus(checkID, status, "")
+}
+
+func (a *Agent) registerNode(info consul.Node) {
+	if len(info.Datacenter) == 0 {
+		info.Datacenter = DefaultDatacenter
+	}
+
+	if n := a.nodes[info.Node]; n != nil {
+		if len(info.ID) == 0 {
+			info.ID = n.info.ID
+		}
+		n.info = info
+	} else {
+		if len(info.ID) == 0 {
+			info.ID = a.newID()
+		}
+		a.nodes[info.Node] = &node{
+			info:     info,
+			services: make(map[string]consul.ServiceInstance),
+			checks:   make(map[string]consul.HealthCheck),
+		}
+	}
+
+	a.commit(&a.catalogIndex)
+}
+
+func (a *Agent) registerService(nodeName string, service consul.ServiceInstance) {
+	if len(service.ID) == 0 {
+		service.ID = service.Service
+	}
+
+	n := a.nodes[nodeName]
+	n.services[service.ID] = service
+
+	// Checks carry the name and tags of the service they belong to, which
+	// have to be updated when the service is registered again.
+	for id, check := range n.checks {
+		if check.ServiceID == service.ID {
+			check.ServiceName, check.ServiceTags = service.Service, service.Tags
+			n.checks[id] = check
+		}
+	}
+
+	a.commit(&a.catalogIndex)
+}
+
+func (a *Agent) registerCheck(nodeName string, check consul.HealthCheck) {
+	n := a.nodes[nodeName]
+	check.Node = nodeName
+
+	if len(check.ServiceID) != 0 {
+		service := n.services[check.ServiceID]
+		check.ServiceName, check.ServiceTags = service.Service, service.Tags
+	}
+
+	if len(check.CheckID) == 0 {
+		if len(check.ServiceID) != 0 {
+			check.CheckID = "service:" + check.ServiceID
+		} else {
+			check.CheckID = check.Name
+		}
+	}
+
+	if len(check.Status) == 0 {
+		check.Status = consul.Passing
+	}
+
+	n.checks[check.CheckID] = check
+	a.commit(&a.catalogIndex)
+}
+
+func (a *Agent) deregisterService(nodeName string, serviceID string) bool {
+	n := a.nodes[nodeName]
+	if n == nil {
+		return false
+	}
+
+	if _, ok := n.services[serviceID]; !ok {
+		return false
+	}
+
+	delete(n.services, serviceID)
+
+	for id, check := range n.checks {
+		if check.ServiceID == serviceID {
+			delete(n.checks, id)
+		}
+	}
+
+	a.commit(&a.catalogIndex)
+	return true
+}
+
+func (a *Agent) setCheckStatus(checkID string, status consul.HealthStatus, output string) bool {
+	found := false
+
+	for _, n := range a.nodes {
+		if a.setNodeCheckStatus(n, checkID, status, output) {
+			found = true
+		}
+	}
+
+	return found
+}
+
+func (a *Agent) setNodeCheckStatus(n *node, checkID string, status consul.HealthStatus, output string) bool {
+	check, ok := n.checks[checkID]
+	if !ok {
+		return false
+	}
+	check.Status, check.Output = status, output
+	n.checks[checkID] = check
+	a.commit(&a.catalogIndex)
+	return true
+}
+
+func (a *Agent) serveCatalog(res http.ResponseWriter, req *http.Request, path string) {
+	switch {
+	case path == "services" && req.Method == "GET":
+		a.catalogServices(res, req)
+	case path == "nodes" && req.Method == "GET":
+		a.catalogNodes(res, req)
+	case strings.HasPrefix(path, "service/") && req.Method == "GET":
+		a.catalogService(res, req, strings.TrimPrefix(path, "service/"))
+	case path == "register" && req.Method == "PUT":
+		a.catalogRegister(res, req)
+	case path == "deregister" && req.Method == "PUT":
+		a.catalogDeregister(res, req)
+	default:
+		unsupported(res, req)
+	}
+}
+
+func (a *Agent) catalogServices(res http.ResponseWriter, req *http.Request) {
+	if !a.blockCatalog(res, req) {
+		return
+	}
+	defer a.mutex.Unlock()
+
+	meta := nodeMeta(req)
+	services := make(map[string][]string)
+
+	for _, n := range a.nodes {
+		if !matchMeta(n.info.Meta, meta) {
+			continue
+		}
+		for _, service := range n.services {
+			tags := services[service.Service]
+			if tags == nil {
+				tags = []string{}
+			}
+			for _, tag := range service.Tags {
+				if !contains(tags, tag) {
+					tags = append(tags, tag)
+				}
+			}
+			sort.Strings(tags)
+			services[service.Service] = tags
+		}
+	}
+
+	a.writeJSON(res, a.catalogIndex, services)
+}
+
+func (a *Agent) catalogNodes(res http.ResponseWriter, req *http.Request) {
+	if !a.blockCatalog(res, req) {
+		return
+	}
+	defer a.mutex.Unlock()
+
+	meta := nodeMeta(req)
+	nodes := []consul.Node{}
+
+	for _, n := range a.nodes {
+		if matchMeta(n.info.Meta, meta) {
+			nodes = append(nodes, n.info)
+		}
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node < nodes[j].Node })
+	a.writeJSON(res, a.catalogIndex, nodes)
+}
+
+type catalogService struct {
+	ID              string
+	Node            string
+	Address         string
+	Datacenter      string
+	TaggedAddresses map[string]string
+	NodeMeta        map[string]string
+	ServiceID       string
+	ServiceName     string
+	ServiceTags     []string
+	ServiceAddress  string
+	ServicePort     int
+	ServiceMeta     map[string]string
+}
+
+func (a *Agent) catalogService(res http.ResponseWriter, req *http.Request, name string) {
+	if !a.blockCatalog(res, req) {
+		return
+	}
+	defer a.mutex.Unlock()
+
+	list := []catalogService{}
+
+	for _, entry := range a.serviceEntries(req, name) {
+		list = append(list, catalogService{
+			ID:              entry.Node.ID,
+			Node:            entry.Node.Node,
+			Address:         entry.Node.Address,
+			Datacenter:      entry.Node.Datacenter,
+			TaggedAddresses: entry.Node.TaggedAddresses,
+			NodeMeta:        entry.Node.Meta,
+			ServiceID:       entry.Service.ID,
+			ServiceName:     entry.Service.Service,
+			ServiceTags:     entry.Service.Tags,
+			ServiceAddress:  entry.Service.Address,
+			ServicePort:     entry.Service.Port,
+			ServiceMeta:     entry.Service.Meta,
+		})
+	}
+
+	a.writeJSON(res, a.catalogIndex, list)
+}
+
+func (a *Agent) catalogRegister(res http.ResponseWriter, req *http.Request) {
+	var registration struct {
+		Node            string
+		ID              string
+		Address         string
+		Datacenter      string
+		TaggedAddresses map[string]string
+		NodeMeta        map[string]string
+		Service         *consul.ServiceInstance
+		Check           *consul.HealthCheck
+		Checks          []consul.HealthCheck
+	}
+
+	if !readJSON(res, req, &registration) {
+		return
+	}
+
+	if len(registration.Node) == 0 || len(registration.Address) == 0 {
+		http.Error(res, "Must provide node and address", http.StatusBadRequest)
+		return
+	}
+
+	entry := consul.ServiceEntry{
+		Node: consul.Node{
+			ID:              registration.ID,
+			Node:            registration.Node,
+			Address:         registration.Address,
+			Datacenter:      registration.Datacenter,
+			TaggedAddresses: registration.TaggedAddresses,
+			Meta:            registration.NodeMeta,
+		},
+		Checks: registration.Checks,
+	}
+
+	if registration.Service != nil {
+		entry.Service = *registration.Service
+	}
+
+	if registration.Check != nil {
+		entry.Checks = append(entry.Checks, *registration.Check)
+	}
+
+	a.Register(entry)
+	a.writeJSON(res, 0, true)
+}
+
+func (a *Agent) catalogDeregister(res http.ResponseWriter, req *http.Request) {
+	var deregistration struct {
+		Node      string
+		ServiceID string
+		CheckID   string
+	}
+
+	if !readJSON(res, req, &deregistration) {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	n := a.nodes[deregistration.Node]
+
+	switch {
+	case n == nil:
+	case len(deregistration.ServiceID) != 0:
+		a.deregisterService(deregistration.Node, deregistration.ServiceID)
+	case len(deregistration.CheckID) != 0:
+		if _, ok := n.checks[deregistration.CheckID]; ok {
+			delete(n.checks, deregistration.CheckID)
+			a.commit(&a.catalogIndex)
+		}
+	default:
+		delete(a.nodes, deregistration.Node)
+		a.commit(&a.catalogIndex)
+	}
+
+	a.writeJSON(res, 0, true)
+}
+
+func (a *Agent) serveHealth(res http.ResponseWriter, req *http.Request, path string) {
+	if req.Method != "GET" {
+		unsupported(res, req)
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(path, "service/"):
+		a.healthService(res, req, strings.TrimPrefix(path, "service/"))
+	case strings.HasPrefix(path, "checks/"):
+		service := strings.TrimPrefix(path, "checks/")
+		a.healthChecks(res, req, func(c consul.HealthCheck) bool { return c.ServiceName == service })
+	case strings.HasPrefix(path, "node/"):
+		node := strings.TrimPrefix(path, "node/")
+		a.healthChecks(res, req, func(c consul.HealthCheck) bool { return c.Node == node })
+	case strings.HasPrefix(path, "state/"):
+		state := consul.HealthStatus(strings.TrimPrefix(path, "state/"))
+		a.healthChecks(res, req, func(c consul.HealthCheck) bool { return state == "any" || c.Status == state })
+	default:
+		unsupported(res, req)
+	}
+}
+
+func (a *Agent) healthService(res http.ResponseWriter, req *http.Request, name string) {
+	if !a.blockCatalog(res, req) {
+		return
+	}
+	defer a.mutex.Unlock()
+
+	_, passing := req.URL.Query()["passing"]
+	entries := []consul.ServiceEntry{}
+
+	for _, entry := range a.serviceEntries(req, name) {
+		if !passing || consul.AggregateHealth(entry.Checks) == consul.Passing {
+			entries = append(entries, entry)
+		}
+	}
+
+	a.writeJSON(res, a.catalogIndex, entries)
+}
+
+func (a *Agent) healthChecks(res http.ResponseWriter, req *http.Request, match func(consul.HealthCheck) bool) {
+	if !a.blockCatalog(res, req) {
+		return
+	}
+	defer a.mutex.Unlock()
+
+	checks := []consul.HealthCheck{}
+
+	for _, n := range a.nodes {
+		for _, check := range n.checks {
+			if match(check) {
+				checks = append(checks, check)
+			}
+		}
+	}
+
+	sort.Slice(checks, func(i, j int) bool {
+		if checks[i].Node != checks[j].Node {
+			return checks[i].Node < checks[j].Node
+		}
+		return checks[i].CheckID < checks[j].CheckID
+	})
+
+	a.writeJSON(res, a.catalogIndex, checks)
+}
+
+// serviceEntries returns the sorted list of entries for the service with the
+// given name, filtered by the tag and node-meta parameters of req.
+func (a *Agent) serviceEntries(req *http.Request, name string) []consul.ServiceEntry {
+	tags := req.URL.Query()["tag"]
+	meta := nodeMeta(req)
+	entries := []consul.ServiceEntry{}
+
+	for _, n := range a.nodes {
+		if !matchMeta(n.info.Meta, meta) {
+			continue
+		}
+		for _, entry := range n.entries(name) {
+			if hasTags(entry.Service.Tags, tags) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Node.Node != entries[j].Node.Node {
+			return entries[i].Node.Node < entries[j].Node.Node
+		}
+		return entries[i].Service.ID < entries[j].Service.ID
+	})
+
+	return entries
+}
+
+// blockCatalog is like block for the catalog, it also rejects filter
+// expressions since the fake agent cannot evaluate them, silently ignoring
+// them would return results that the program does not expect.
+func (a *Agent) blockCatalog(res http.ResponseWriter, req *http.Request) bool {
+	if len(req.URL.Query().Get("filter")) != 0 {
+		http.Error(res, "consultest: filter expressions are not supported by the fake agent", http.StatusBadRequest)
+		return false
+	}
+	return a.block(req, tableIndex(&a.catalogIndex))
+}
+
+func (a *Agent) agentRegisterService(res http.ResponseWriter, req *http.Request) {
+	var service struct {
+		ID      string
+		Name    string
+		Tags    []string
+		Meta    map[string]string
+		Address string
+		Port    int
+		Check   *agentCheck
+		Checks  []agentCheck
+	}
+
+	if !readJSON(res, req, &service) {
+		return
+	}
+
+	if len(service.Name) == 0 {
+		http.Error(res, "Missing service name", http.StatusBadRequest)
+		return
+	}
+
+	if len(service.ID) == 0 {
+		service.ID = service.Name
+	}
+
+	if service.Check != nil {
+		service.Checks = append(service.Checks, *service.Check)
+	}
+
+	entry := consul.ServiceEntry{
+		Node: consul.Node{Node: DefaultNode},
+		Service: consul.ServiceInstance{
+			ID:      service.ID,
+			Service: service.Name,
+			Tags:    service.Tags,
+			Address: service.Address,
+			Port:    service.Port,
+			Meta:    service.Meta,
+		},
+	}
+
+	for i, check := range service.Checks {
+		if len(check.ID) == 0 {
+			check.ID = "service:" + service.ID
+			if len(service.Checks) > 1 {
+				check.ID += ":" + strconv.Itoa(i+1)
+			}
+		}
+
+		if len(check.Name) == 0 {
+			check.Name = "Service '" + service.Name + "' check"
+		}
+
+		if len(check.Status) == 0 && len(check.TTL) != 0 {
+			check.Status = consul.Critical
+		}
+
+		entry.Checks = append(entry.Checks, consul.HealthCheck{
+			CheckID:   check.ID,
+			Name:      check.Name,
+			Notes:     check.Notes,
+			Status:    check.Status,
+			ServiceID: service.ID,
+		})
+	}
+
+	a.Register(entry)
+	res.WriteHeader(http.StatusOK)
+}
+
+type agentCheck struct {
+	ID     string
+	Name   string
+	Notes  string
+	TTL    string
+	Status consul.HealthStatus
+}
+
+func (a *Agent) agentDeregisterService(res http.ResponseWriter, id string) {
+	if !a.Deregister(DefaultNode, id) {
+		http.Error(res, "Unknown service ID \""+id+"\"", http.StatusNotFound)
+		return
+	}
+	res.WriteHeader(http.StatusOK)
+}
+
+func (a *Agent) agentUpdateCheck(res http.ResponseWriter, req *http.Request, path string) {
+	var status consul.HealthStatus
+	var output string
+
+	switch {
+	case strings.HasPrefix(path, "pass/"):
+		status, path = consul.Passing, strings.TrimPrefix(path, "pass/")
+	case strings.HasPrefix(path, "warn/"):
+		status, path = consul.Warning, strings.TrimPrefix(path, "warn/")
+	case strings.HasPrefix(path, "fail/"):
+		status, path = consul.Critical, strings.TrimPrefix(path, "fail/")
+	case strings.HasPrefix(path, "update/"):
+		var update struct {
+			Status consul.HealthStatus
+			Output string
+		}
+		if !readJSON(res, req, &update) {
+			return
+		}
+		status, output, path = update.Status, update.Output, strings.TrimPrefix(path, "update/")
+	default:
+		unsupported(res, req)
+		return
+	}
+
+	if len(output) == 0 {
+		output = req.URL.Query().Get("note")
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if n := a.nodes[DefaultNode]; n == nil || !a.setNodeCheckStatus(n, path, status, output) {
+		http.Error(res, "Unknown check ID \""+path+"\"", http.StatusNotFound)
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+}
+
+func nodeMeta(req *http.Request) map[string]string {
+	var meta map[string]string
+
+	for _, param := range req.URL.Query()["node-meta"] {
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		i := strings.IndexByte(param, ':')
+		if i < 0 {
+			meta[param] = ""
+		} else {
+			meta[param[:i]] = param[i+1:]
+		}
+	}
+
+	return meta
+}
+
+func matchMeta(meta map[string]string, filter map[string]string) bool {
+	for key, value := range filter {
+		if v, ok := meta[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+func hasTags(tags []string, required []string) bool {
+	for _, tag := range required {
+		if !contains(tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
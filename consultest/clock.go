@@ -0,0 +1,186 @@
+package consultest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+// Clock is a consul.Clock which time only moves forward when Advance is
+// called, so tests can drive session renewals, cache expirations, and watch
+// backoffs deterministically instead of sleeping.
+//
+//	clock := consultest.NewClock(time.Now())
+//	ctx, cancel := consul.WithSession(ctx, consul.Session{Clock: clock})
+//	...
+//	clock.Advance(10 * time.Second) // renews the session
+//
+// Timers and tickers created by the clock fire when the clock is advanced past
+// their deadline. Like the timers of the time package, their channels have a
+// buffer of one value, and ticks are dropped if the receiver falls behind.
+type Clock struct {
+	mutex  sync.Mutex
+	cond   sync.Cond
+	now    time.Time
+	seq    uint64
+	timers map[*clockTimer]struct{}
+}
+
+// NewClock returns a clock set at now.
+func NewClock(now time.Time) *Clock {
+	c := &Clock{
+		now:    now,
+		timers: make(map[*clockTimer]struct{}),
+	}
+	c.cond.L = &c.mutex
+	return c
+}
+
+// Now satisfies the consul.Clock interface.
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// NewTimer satisfies the consul.Clock interface.
+func (c *Clock) NewTimer(d time.Duration) consul.Timer {
+	return c.add(d, 0)
+}
+
+// NewTicker satisfies the consul.Clock interface.
+func (c *Clock) NewTicker(d time.Duration) consul.Ticker {
+	if d <= 0 {
+		panic("consultest: non-positive interval for NewTicker")
+	}
+	return clockTicker{c.add(d, d)}
+}
+
+// Advance moves the clock forward by d, firing the timers and tickers which
+// deadlines are reached in chronological order.
+func (c *Clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	end := c.now.Add(d)
+
+	for {
+		t := c.next(end)
+		if t == nil {
+			break
+		}
+
+		c.now = t.deadline
+		select {
+		case t.c <- c.now:
+		default:
+		}
+
+		if t.period > 0 {
+			t.deadline = t.deadline.Add(t.period)
+			c.seq++
+			t.seq = c.seq
+		} else {
+			delete(c.timers, t)
+		}
+	}
+
+	c.now = end
+	c.cond.Broadcast()
+}
+
+// Set moves the clock forward to now, it is equivalent to calling Advance with
+// the difference between now and the current time of the clock.
+func (c *Clock) Set(now time.Time) {
+	c.Advance(now.Sub(c.Now()))
+}
+
+// Timers returns the number of timers and tickers which are active on the
+// clock.
+func (c *Clock) Timers() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.timers)
+}
+
+// WaitTimers blocks until at least n timers and tickers are active on the
+// clock. Tests use it to wait for the goroutines they started to be ready
+// before advancing the clock.
+func (c *Clock) WaitTimers(n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+// next returns the timer with the earliest deadline before end, timers with
+// equal deadlines fire in the order they were scheduled.
+func (c *Clock) next(end time.Time) *clockTimer {
+	var timers []*clockTimer
+
+	for t := range c.timers {
+		if !t.deadline.After(end) {
+			timers = append(timers, t)
+		}
+	}
+
+	if len(timers) == 0 {
+		return nil
+	}
+
+	sort.Slice(timers, func(i, j int) bool {
+		if !timers[i].deadline.Equal(timers[j].deadline) {
+			return timers[i].deadline.Before(timers[j].deadline)
+		}
+		return timers[i].seq < timers[j].seq
+	})
+	return timers[0]
+}
+
+func (c *Clock) add(d time.Duration, period time.Duration) *clockTimer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.seq++
+	t := &clockTimer{
+		clock:    c,
+		c:        make(chan time.Time, 1),
+		deadline: c.now.Add(d),
+		period:   period,
+		seq:      c.seq,
+	}
+
+	if d <= 0 && period == 0 {
+		t.c <- c.now
+		return t
+	}
+
+	c.timers[t] = struct{}{}
+	c.cond.Broadcast()
+	return t
+}
+
+type clockTimer struct {
+	clock    *Clock
+	c        chan time.Time
+	deadline time.Time
+	period   time.Duration
+	seq      uint64
+}
+
+func (t *clockTimer) C() <-chan time.Time { return t.c }
+
+func (t *clockTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	_, active := t.clock.timers[t]
+	delete(t.clock.timers, t)
+	return active
+}
+
+type clockTicker struct{ *clockTimer }
+
+func (t clockTicker) Stop() { t.clockTimer.Stop() }
@@ -0,0 +1,175 @@
+package consultest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+	"github.com/segmentio/consul-go/watch"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+
+	timer := clock.NewTimer(2 * time.Second)
+	ticker := clock.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	clock.Advance(1 * time.Second)
+
+	select {
+	case <-timer.C():
+		t.Fatal("the timer fired too early")
+	default:
+	}
+
+	if now := <-ticker.C(); !now.Equal(start.Add(1 * time.Second)) {
+		t.Error("bad tick time:", now)
+	}
+
+	clock.Advance(5 * time.Second)
+
+	if now := <-timer.C(); !now.Equal(start.Add(2 * time.Second)) {
+		t.Error("bad timer time:", now)
+	}
+	if timer.Stop() {
+		t.Error("stopping a timer which fired must return false")
+	}
+	if now := clock.Now(); !now.Equal(start.Add(6 * time.Second)) {
+		t.Error("bad clock time:", now)
+	}
+	if n := clock.Timers(); n != 1 {
+		t.Error("bad number of active timers:", n)
+	}
+}
+
+func TestClockSession(t *testing.T) {
+	agent := NewAgent()
+	defer agent.Close()
+
+	var renewals int32
+	client := agent.Client()
+	transport := client.Transport
+	client.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.HasPrefix(req.URL.Path, "/v1/session/renew/") {
+			atomic.AddInt32(&renewals, 1)
+		}
+		return transport.RoundTrip(req)
+	})
+
+	clock := NewClock(time.Now())
+	ctx, cancel := consul.WithSession(context.Background(), consul.Session{
+		Client: client,
+		TTL:    30 * time.Second,
+		Clock:  clock,
+	})
+	defer cancel()
+
+	if err := ctx.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Renewals are scheduled every third of the TTL.
+	clock.WaitTimers(1)
+	clock.Advance(10 * time.Second)
+	waitFor(t, func() bool { return atomic.LoadInt32(&renewals) == 1 })
+
+	if ctx.Err() != nil {
+		t.Fatal("the session expired after being renewed:", ctx.Err())
+	}
+
+	sessions, _, err := (&consul.Sessions{Client: client}).List(context.Background(), consul.SessionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 {
+		t.Fatal("bad number of sessions:", len(sessions))
+	}
+	agent.InvalidateSession(sessions[0].ID)
+	clock.Advance(10 * time.Second)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the session context was not canceled after the session was invalidated")
+	}
+
+	if err := ctx.Err(); !errors.Is(err, consul.ErrSessionExpired) {
+		t.Error("bad session error:", err)
+	}
+}
+
+func TestClockResolverCache(t *testing.T) {
+	clock := NewClock(time.Now())
+	cache := &consul.ResolverCache{CacheTimeout: 1 * time.Second, Clock: clock}
+	lookups := 0
+
+	lookup := func(ctx context.Context, name string) ([]consul.Endpoint, error) {
+		lookups++
+		return consul.StaticEndpoints("127.0.0.1:4242"), nil
+	}
+
+	for i := 0; i != 3; i++ {
+		if _, err := cache.LookupService(context.Background(), "test", lookup); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lookups != 1 {
+		t.Fatal("cached lookups must not call the lookup function:", lookups)
+	}
+
+	clock.Advance(2 * time.Second)
+
+	if _, err := cache.LookupService(context.Background(), "test", lookup); err != nil {
+		t.Fatal(err)
+	}
+	if lookups != 2 {
+		t.Error("expired entries must be resolved again:", lookups)
+	}
+}
+
+func TestClockLimiter(t *testing.T) {
+	clock := NewClock(time.Now())
+	limiter := &watch.Limiter{Interval: 1 * time.Second, Clock: clock}
+
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- limiter.Wait(context.Background()) }()
+
+	clock.WaitTimers(1)
+
+	select {
+	case <-done:
+		t.Fatal("the limiter did not wait for the interval")
+	default:
+	}
+
+	clock.Advance(1 * time.Second)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the condition")
+		}
+	}
+}
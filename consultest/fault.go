@@ -0,0 +1,182 @@
+package consultest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+// ErrInjected is the error returned by FaultTransport when it drops responses,
+// programs may also configure faults to return it.
+var ErrInjected = errors.New("consultest: injected fault")
+
+// Fault describes a failure injected by a FaultTransport.
+type Fault struct {
+	// The method and path prefix of requests that the fault applies to, empty
+	// values match all requests.
+	Method string
+	Path   string
+
+	// The probability that the fault is injected in matching requests, from
+	// 0 to 1. The zero-value injects the fault in all matching requests.
+	Rate float64
+
+	// The delay added before sending the request.
+	Latency time.Duration
+
+	// If not nil, the error returned instead of sending the request.
+	Err error
+
+	// If not zero, the status of the response returned instead of sending the
+	// request.
+	Status int
+
+	// If true, the request is sent but the response is dropped, and the
+	// transport returns ErrInjected. This simulates requests that were served
+	// by consul but whose responses were lost.
+	Drop bool
+}
+
+func (f *Fault) matches(req *http.Request) bool {
+	return (len(f.Method) == 0 || f.Method == req.Method) && strings.HasPrefix(req.URL.Path, f.Path)
+}
+
+// FaultTransport is a HTTP transport which injects failures in the requests it
+// forwards to the underlying transport, to test the behavior of programs when
+// consul is slow or unavailable.
+//
+// Faults are evaluated in order, the latencies of all faults that apply to a
+// request are added, and the first fault returning an error, a status, or
+// dropping the response determines the outcome of the request.
+type FaultTransport struct {
+	// The transport used to send the requests, which defaults to
+	// consul.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	// The list of faults injected by the transport.
+	Faults []Fault
+
+	// The source of random numbers used to decide whether faults are injected,
+	// a time-seeded source is used if nil. Using a source with a fixed seed
+	// makes the injection of faults reproducible.
+	Source rand.Source
+
+	mutex    sync.Mutex
+	rng      *rand.Rand
+	injected int
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *FaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var latency time.Duration
+	var outcome *Fault
+
+	for _, f := range t.faults(req) {
+		latency += f.Latency
+		if outcome == nil && (f.Err != nil || f.Status != 0 || f.Drop) {
+			outcome = f
+		}
+	}
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	switch {
+	case outcome == nil:
+		return t.transport().RoundTrip(req)
+
+	case outcome.Err != nil:
+		return nil, outcome.Err
+
+	case outcome.Status != 0:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		body := []byte(ErrInjected.Error())
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", outcome.Status, http.StatusText(outcome.Status)),
+			StatusCode:    outcome.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+
+	default: // Drop
+		res, err := t.transport().RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		res.Body.Close()
+		return nil, ErrInjected
+	}
+}
+
+// Injected returns the number of requests that faults were injected in.
+func (t *FaultTransport) Injected() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.injected
+}
+
+// faults returns the list of faults injected in req.
+func (t *FaultTransport) faults(req *http.Request) []*Fault {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var faults []*Fault
+
+	for i := range t.Faults {
+		f := &t.Faults[i]
+
+		if !f.matches(req) {
+			continue
+		}
+
+		if f.Rate > 0 && f.Rate < 1 {
+			if t.rng == nil {
+				source := t.Source
+				if source == nil {
+					source = rand.NewSource(time.Now().UnixNano())
+				}
+				t.rng = rand.New(source)
+			}
+			if t.rng.Float64() >= f.Rate {
+				continue
+			}
+		}
+
+		faults = append(faults, f)
+	}
+
+	if len(faults) != 0 {
+		t.injected++
+	}
+
+	return faults
+}
+
+func (t *FaultTransport) transport() http.RoundTripper {
+	if transport := t.Transport; transport != nil {
+		return transport
+	}
+	return consul.DefaultTransport
+}
@@ -0,0 +1,98 @@
+package consultest
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestFaultTransport(t *testing.T) {
+	agent := NewAgent()
+	defer agent.Close()
+	agent.Put("key", []byte(`"value"`))
+
+	ctx := context.Background()
+
+	newStore := func(faults ...Fault) (*consul.Store, *FaultTransport) {
+		transport := &FaultTransport{
+			Transport: agent.Client().Transport,
+			Faults:    faults,
+			Source:    rand.NewSource(1),
+		}
+		client := agent.Client()
+		client.Transport = transport
+		return &consul.Store{Client: client}, transport
+	}
+
+	t.Run("status", func(t *testing.T) {
+		store, transport := newStore(Fault{Method: "GET", Path: "/v1/kv/", Status: 500})
+
+		var value string
+		_, err := store.ReadValue(ctx, "key", &value)
+		if err == nil {
+			t.Fatal("expected an error but got none")
+		}
+		if n := transport.Injected(); n != 1 {
+			t.Error("bad number of injected faults:", n)
+		}
+
+		if _, err := store.WriteValue(ctx, "other", "value", -1); err != nil {
+			t.Error("requests not matching the fault must not fail:", err)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		store, _ := newStore(Fault{Err: ErrInjected})
+
+		var value string
+		if _, err := store.ReadValue(ctx, "key", &value); !errors.Is(err, ErrInjected) {
+			t.Error("bad error:", err)
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		store, _ := newStore(Fault{Method: "PUT", Drop: true})
+
+		if _, err := store.WriteValue(ctx, "dropped", "value", -1); !errors.Is(err, ErrInjected) {
+			t.Error("bad error:", err)
+		}
+
+		agent.mutex.Lock()
+		_, ok := agent.kv["dropped"]
+		agent.mutex.Unlock()
+
+		if !ok {
+			t.Error("the request was not sent before dropping the response")
+		}
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		store, _ := newStore(Fault{Latency: time.Second})
+
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+
+		var value string
+		if _, err := store.ReadValue(ctx, "key", &value); !errors.Is(err, context.DeadlineExceeded) {
+			t.Error("bad error:", err)
+		}
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		const N = 1000
+		store, transport := newStore(Fault{Rate: 0.25, Status: 503})
+
+		for i := 0; i != N; i++ {
+			var value string
+			store.ReadValue(ctx, "key", &value)
+		}
+
+		if n := transport.Injected(); n < N/5 || n > N*3/10 {
+			t.Error("the rate of injected faults is too far off:", n)
+		}
+	})
+}
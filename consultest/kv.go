@@ -0,0 +1,273 @@
+package consultest
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+type kvEntry struct {
+	LockIndex   uint64
+	Key         string
+	Flags       uint64
+	Value       []byte
+	Session     consul.SessionID `json:",omitempty"`
+	CreateIndex uint64
+	ModifyIndex uint64
+}
+
+// Put sets the value of key in the key/value store of the agent.
+func (a *Agent) Put(key string, value []byte) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.put(key, value, 0)
+}
+
+// Delete removes key from the key/value store of the agent.
+func (a *Agent) Delete(key string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, ok := a.kv[key]; ok {
+		delete(a.kv, key)
+		a.commit(&a.kvIndex)
+	}
+}
+
+func (a *Agent) put(key string, value []byte, flags uint64) {
+	a.commit(&a.kvIndex)
+
+	if e := a.kv[key]; e != nil {
+		e.Value, e.Flags, e.ModifyIndex = value, flags, a.index
+		return
+	}
+
+	a.kv[key] = &kvEntry{
+		Key:         key,
+		Flags:       flags,
+		Value:       value,
+		CreateIndex: a.index,
+		ModifyIndex: a.index,
+	}
+}
+
+func (a *Agent) serveKV(res http.ResponseWriter, req *http.Request, key string) {
+	switch req.Method {
+	case "GET":
+		a.getKV(res, req, key)
+	case "PUT":
+		a.putKV(res, req, key)
+	case "DELETE":
+		a.deleteKV(res, req, key)
+	default:
+		unsupported(res, req)
+	}
+}
+
+func (a *Agent) getKV(res http.ResponseWriter, req *http.Request, key string) {
+	query := req.URL.Query()
+	_, keys := query["keys"]
+	_, recurse := query["recurse"]
+	single := !keys && !recurse
+
+	// Like consul, reads of a single key report the index of its last
+	// modification, which programs use to issue compare-and-swap writes.
+	index := func() uint64 {
+		if e := a.kv[key]; single && e != nil {
+			return e.ModifyIndex
+		}
+		return a.kvIndex
+	}
+
+	if !a.block(req, index) {
+		return
+	}
+	defer a.mutex.Unlock()
+
+	switch {
+	case keys:
+		list := a.listKeys(key, query.Get("separator"))
+		if len(list) == 0 {
+			notFound(res, index())
+			return
+		}
+		a.writeJSON(res, index(), list)
+
+	case recurse:
+		list := a.listEntries(key)
+		if len(list) == 0 {
+			notFound(res, index())
+			return
+		}
+		a.writeJSON(res, index(), list)
+
+	default:
+		e := a.kv[key]
+		if e == nil {
+			notFound(res, index())
+			return
+		}
+		if _, raw := query["raw"]; raw {
+			a.writeBody(res, index(), "application/octet-stream", e.Value)
+			return
+		}
+		a.writeJSON(res, index(), []*kvEntry{e})
+	}
+}
+
+func (a *Agent) putKV(res http.ResponseWriter, req *http.Request, key string) {
+	value, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := req.URL.Query()
+
+	flags, err := parseUint(query, "flags")
+	if err != nil {
+		http.Error(res, "Invalid flags: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	e := a.kv[key]
+
+	if s := query.Get("cas"); len(s) != 0 {
+		cas, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(res, "Invalid CAS index: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if (cas == 0 && e != nil) || (cas != 0 && (e == nil || e.ModifyIndex != cas)) {
+			a.writeJSON(res, 0, false)
+			return
+		}
+	}
+
+	if sid := consul.SessionID(query.Get("acquire")); len(sid) != 0 {
+		if a.sessions[sid] == nil {
+			http.Error(res, "invalid session \""+string(sid)+"\"", http.StatusInternalServerError)
+			return
+		}
+		if e != nil && len(e.Session) != 0 && e.Session != sid {
+			a.writeJSON(res, 0, false)
+			return
+		}
+		a.put(key, value, flags)
+		e = a.kv[key]
+		if e.Session != sid {
+			e.Session = sid
+			e.LockIndex++
+		}
+		a.writeJSON(res, 0, true)
+		return
+	}
+
+	if sid := consul.SessionID(query.Get("release")); len(sid) != 0 {
+		if e == nil || e.Session != sid {
+			a.writeJSON(res, 0, false)
+			return
+		}
+		a.put(key, value, flags)
+		e.Session = ""
+		a.writeJSON(res, 0, true)
+		return
+	}
+
+	a.put(key, value, flags)
+	a.writeJSON(res, 0, true)
+}
+
+func (a *Agent) deleteKV(res http.ResponseWriter, req *http.Request, key string) {
+	query := req.URL.Query()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, recurse := query["recurse"]; recurse {
+		deleted := false
+		for k := range a.kv {
+			if strings.HasPrefix(k, key) {
+				delete(a.kv, k)
+				deleted = true
+			}
+		}
+		if deleted {
+			a.commit(&a.kvIndex)
+		}
+		a.writeJSON(res, 0, true)
+		return
+	}
+
+	e := a.kv[key]
+
+	if s := query.Get("cas"); len(s) != 0 {
+		cas, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(res, "Invalid CAS index: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if e == nil || e.ModifyIndex != cas {
+			a.writeJSON(res, 0, false)
+			return
+		}
+	}
+
+	if e != nil {
+		delete(a.kv, key)
+		a.commit(&a.kvIndex)
+	}
+
+	a.writeJSON(res, 0, true)
+}
+
+func (a *Agent) listEntries(prefix string) []*kvEntry {
+	list := []*kvEntry{}
+
+	for k, e := range a.kv {
+		if strings.HasPrefix(k, prefix) {
+			list = append(list, e)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+func (a *Agent) listKeys(prefix string, separator string) []string {
+	seen := make(map[string]bool)
+	list := []string{}
+
+	for k := range a.kv {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if len(separator) != 0 {
+			if i := strings.Index(k[len(prefix):], separator); i >= 0 {
+				k = k[:len(prefix)+i+len(separator)]
+			}
+		}
+		if !seen[k] {
+			seen[k] = true
+			list = append(list, k)
+		}
+	}
+
+	sort.Strings(list)
+	return list
+}
+
+func parseUint(query map[string][]string, name string) (uint64, error) {
+	values := query[name]
+	if len(values) == 0 || len(values[0]) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseUint(values[0], 10, 64)
+}
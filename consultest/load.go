@@ -0,0 +1,288 @@
+package consultest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+	"github.com/segmentio/consul-go/watch"
+)
+
+// LoadConfig carries the configuration of load tests run by GenerateLoad.
+type LoadConfig struct {
+	// The number of services registered on the agent, and the number of
+	// instances of each service. Both default to 10.
+	Services  int
+	Instances int
+
+	// The number of goroutines concurrently looking up services, defaults to
+	// GOMAXPROCS.
+	Concurrency int
+
+	// The number of plans watching the services through the multiplexer.
+	// Plans are assigned to services in turn, so plans outnumbering services
+	// share their queries.
+	Watchers int
+
+	// The duration of the load test, defaults to 1 second.
+	Duration time.Duration
+
+	// The interval at which an instance is deregistered or registered back,
+	// zero means that the services don't change during the test.
+	ChurnInterval time.Duration
+
+	// The lookuper used to resolve the services. If nil, a resolver with a
+	// default cache, sending queries to the agent, is used.
+	Lookuper consul.Lookuper
+
+	// The multiplexer that the plans are attached to. If nil, a new one is
+	// created.
+	Mux *watch.Mux
+
+	// The source of random numbers used to pick the instances which change
+	// during the test, a time-seeded source is used if nil.
+	Source rand.Source
+}
+
+// LoadReport is the result of a load test run by GenerateLoad.
+type LoadReport struct {
+	// The time that the test ran for.
+	Duration time.Duration
+
+	// The number of lookups made, and how many of them failed.
+	Lookups int64
+	Errors  int64
+
+	// Percentiles of the latency of lookups, measured on a sample of them.
+	P50 time.Duration
+	P99 time.Duration
+	Max time.Duration
+
+	// The number of registration changes made during the test.
+	Changes int64
+
+	// The number of results received by the handlers of plans.
+	Updates int64
+}
+
+// LookupsPerSecond returns the average rate of lookups during the test.
+func (r LoadReport) LookupsPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Lookups) / r.Duration.Seconds()
+}
+
+// String returns a human-readable summary of r.
+func (r LoadReport) String() string {
+	return fmt.Sprintf("%d lookups in %s (%.0f/s, %d errors), latency p50=%s p99=%s max=%s, %d changes, %d updates",
+		r.Lookups, r.Duration, r.LookupsPerSecond(), r.Errors, r.P50, r.P99, r.Max, r.Changes, r.Updates)
+}
+
+// GenerateLoad registers services on agent, then resolves them from multiple
+// goroutines and watches them with plans sharing a watch.Mux, while instances
+// are deregistered and registered back, until the configured duration elapsed
+// or ctx is canceled.
+//
+// The function is intended to measure the performance of the service
+// discovery path of programs under churn, and catch regressions in it:
+//
+//	agent := consultest.NewAgent()
+//	defer agent.Close()
+//
+//	report, err := consultest.GenerateLoad(ctx, agent, consultest.LoadConfig{
+//		Watchers:      100,
+//		ChurnInterval: 10 * time.Millisecond,
+//	})
+//
+// Services are named "service-0", "service-1", etc.
+func GenerateLoad(ctx context.Context, agent *Agent, config LoadConfig) (LoadReport, error) {
+	config = config.withDefaults(agent)
+
+	for i := 0; i != config.Services; i++ {
+		for j := 0; j != config.Instances; j++ {
+			agent.Register(loadServiceEntry(i, j))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Duration)
+	defer cancel()
+
+	report := LoadReport{}
+	client := agent.Client()
+	wg := sync.WaitGroup{}
+	start := time.Now()
+
+	for i := 0; i != config.Watchers; i++ {
+		plan := &watch.Plan{
+			Type:    watch.Service,
+			Service: loadServiceName(i % config.Services),
+			Client:  client,
+			Mux:     config.Mux,
+			Handler: func(uint64, interface{}) { atomic.AddInt64(&report.Updates, 1) },
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			plan.Run(ctx)
+		}()
+	}
+
+	if config.ChurnInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Changes = churn(ctx, agent, config)
+		}()
+	}
+
+	samples := make([][]time.Duration, config.Concurrency)
+
+	for i := range samples {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lookups, errors, sample := lookupLoad(ctx, config, i)
+			atomic.AddInt64(&report.Lookups, lookups)
+			atomic.AddInt64(&report.Errors, errors)
+			samples[i] = sample
+		}(i)
+	}
+
+	wg.Wait()
+	report.Duration = time.Since(start)
+
+	var latencies []time.Duration
+	for _, sample := range samples {
+		latencies = append(latencies, sample...)
+	}
+
+	if len(latencies) != 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		report.P50 = latencies[len(latencies)*50/100]
+		report.P99 = latencies[len(latencies)*99/100]
+		report.Max = latencies[len(latencies)-1]
+	}
+
+	if err := ctx.Err(); err != nil && err != context.DeadlineExceeded {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// loadSampleSize is the maximum number of latencies sampled by each goroutine
+// of a load test.
+const loadSampleSize = 10000
+
+func lookupLoad(ctx context.Context, config LoadConfig, worker int) (lookups int64, errors int64, sample []time.Duration) {
+	rng := rand.New(rand.NewSource(int64(worker)))
+	sample = make([]time.Duration, 0, loadSampleSize)
+
+	for i := worker; ctx.Err() == nil; i++ {
+		start := time.Now()
+		_, err := config.Lookuper.LookupService(ctx, loadServiceName(i%config.Services))
+		latency := time.Since(start)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			errors++
+		}
+
+		// Reservoir sampling keeps a uniform sample of the latencies without
+		// retaining all of them.
+		if lookups++; len(sample) < loadSampleSize {
+			sample = append(sample, latency)
+		} else if j := rng.Int63n(lookups); j < loadSampleSize {
+			sample[j] = latency
+		}
+	}
+
+	return
+}
+
+func churn(ctx context.Context, agent *Agent, config LoadConfig) (changes int64) {
+	rng := rand.New(config.Source)
+	ticker := time.NewTicker(config.ChurnInterval)
+	defer ticker.Stop()
+
+	down := make(map[[2]int]bool)
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		i, j := rng.Intn(config.Services), rng.Intn(config.Instances)
+		entry := loadServiceEntry(i, j)
+
+		if down[[2]int{i, j}] {
+			agent.Register(entry)
+			delete(down, [2]int{i, j})
+		} else {
+			agent.Deregister(entry.Node.Node, entry.Service.ID)
+			down[[2]int{i, j}] = true
+		}
+
+		changes++
+	}
+}
+
+func (config LoadConfig) withDefaults(agent *Agent) LoadConfig {
+	if config.Services <= 0 {
+		config.Services = 10
+	}
+	if config.Instances <= 0 {
+		config.Instances = 10
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if config.Duration <= 0 {
+		config.Duration = 1 * time.Second
+	}
+	if config.Lookuper == nil {
+		config.Lookuper = &consul.Resolver{
+			Client:             agent.Client(),
+			DisableCoordinates: true,
+			Cache:              &consul.ResolverCache{},
+		}
+	}
+	if config.Mux == nil {
+		config.Mux = &watch.Mux{}
+	}
+	if config.Source == nil {
+		config.Source = rand.NewSource(time.Now().UnixNano())
+	}
+	return config
+}
+
+func loadServiceName(i int) string {
+	return "service-" + strconv.Itoa(i)
+}
+
+func loadServiceEntry(i int, j int) consul.ServiceEntry {
+	// Instances with the same index run on the same node, each service
+	// listening on a different port.
+	addr := fmt.Sprintf("10.0.%d.%d", j/256%256, j%256)
+	return consul.ServiceEntry{
+		Node: consul.Node{Node: "node-" + strconv.Itoa(j), Address: addr},
+		Service: consul.ServiceInstance{
+			ID:      loadServiceName(i) + "-" + strconv.Itoa(j),
+			Service: loadServiceName(i),
+			Address: addr,
+			Port:    4000 + i,
+		},
+	}
+}
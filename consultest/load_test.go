@@ -0,0 +1,160 @@
+package consultest
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+	"github.com/segmentio/consul-go/watch"
+)
+
+func TestGenerateLoad(t *testing.T) {
+	agent := NewAgent()
+	defer agent.Close()
+
+	report, err := GenerateLoad(context.Background(), agent, LoadConfig{
+		Services:      3,
+		Instances:     5,
+		Concurrency:   4,
+		Watchers:      10,
+		Duration:      200 * time.Millisecond,
+		ChurnInterval: 5 * time.Millisecond,
+		Source:        rand.NewSource(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log(report)
+
+	if report.Lookups == 0 {
+		t.Error("no lookups were made")
+	}
+	if report.Errors != 0 {
+		t.Error("lookups failed:", report.Errors)
+	}
+	if report.Changes == 0 {
+		t.Error("no changes were made")
+	}
+	if report.Updates < 10 {
+		t.Error("the watchers did not receive updates:", report.Updates)
+	}
+	if report.P50 > report.P99 || report.P99 > report.Max {
+		t.Error("bad latency percentiles:", report.P50, report.P99, report.Max)
+	}
+}
+
+// BenchmarkResolverCacheChurn measures concurrent lookups of services through
+// a resolver cache while the instances of the services change.
+func BenchmarkResolverCacheChurn(b *testing.B) {
+	agent := NewAgent()
+	defer agent.Close()
+
+	for i := 0; i != 10; i++ {
+		for j := 0; j != 10; j++ {
+			agent.Register(loadServiceEntry(i, j))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	config := LoadConfig{Services: 10, Instances: 10, ChurnInterval: time.Millisecond, Source: rand.NewSource(1)}
+	go churn(ctx, agent, config)
+
+	rslv := &consul.Resolver{
+		Client:             agent.Client(),
+		DisableCoordinates: true,
+		Cache:              &consul.ResolverCache{CacheTimeout: 10 * time.Millisecond},
+	}
+
+	var worker int32
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddInt32(&worker, 1))
+
+		for ; pb.Next(); i++ {
+			if _, err := rslv.LookupService(ctx, loadServiceName(i%10)); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkMux measures how fast changes are delivered to many plans sharing
+// a blocking query through a multiplexer.
+func BenchmarkMux(b *testing.B) {
+	for _, plans := range []int{1, 10, 100} {
+		b.Run(strconv.Itoa(plans), func(b *testing.B) {
+			benchmarkMux(b, plans)
+		})
+	}
+}
+
+func benchmarkMux(b *testing.B, plans int) {
+	agent := NewAgent()
+	defer agent.Close()
+	agent.Put("bench", []byte("0"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := agent.Client()
+	mux := &watch.Mux{}
+	last := make([]uint64, plans)
+	cond := sync.NewCond(&sync.Mutex{})
+	wg := sync.WaitGroup{}
+
+	for i := 0; i != plans; i++ {
+		i := i
+		plan := &watch.Plan{
+			Type:   watch.Key,
+			Key:    "bench",
+			Client: client,
+			Mux:    mux,
+			Handler: func(index uint64, _ interface{}) {
+				cond.L.Lock()
+				last[i] = index
+				cond.L.Unlock()
+				cond.Broadcast()
+			},
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			plan.Run(ctx)
+		}()
+	}
+
+	// waitIndex blocks until all plans have seen the given index.
+	waitIndex := func(index uint64) {
+		cond.L.Lock()
+		defer cond.L.Unlock()
+		for i := 0; i != plans; {
+			if last[i] < index {
+				cond.Wait()
+			} else {
+				i++
+			}
+		}
+	}
+
+	waitIndex(agent.Index())
+	b.ResetTimer()
+
+	for i := 0; i != b.N; i++ {
+		agent.Put("bench", []byte(strconv.Itoa(i)))
+		waitIndex(agent.Index())
+	}
+
+	b.StopTimer()
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,403 @@
+package consultest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+// Locks is an in-memory implementation of the consul.LockManager and
+// consul.SessionManager interfaces, for unit tests of programs coordinating
+// through consul locks and sessions, which don't need an agent.
+//
+// The lock and session contexts mirror the ones of the consul package: lock
+// contexts carry their keys at consul.LocksKey and their fencing tokens at
+// consul.FencingTokensKey, and are canceled with
+// consul.Unlocked when the lock is lost, and session contexts carry their
+// consul.Session at consul.SessionKey. Tests simulate the loss of locks and
+// sessions with the Revoke and ExpireSession methods.
+//
+//	locks := &consultest.Locks{}
+//	leader := NewLeader(locks) // takes a consul.LockManager
+//	...
+//	locks.Revoke("leader") // the program must step down
+//
+// The zero-value is ready to use. Locks are safe to use concurrently from
+// multiple goroutines.
+type Locks struct {
+	mutex    sync.Mutex
+	notify   chan struct{}
+	held     map[string]*memLock
+	sessions map[consul.SessionID]*memSession
+	indexes  map[string]uint64
+	nextID   uint64
+	index    uint64
+}
+
+type memSession struct {
+	info  consul.Session
+	ctx   *memContext
+	locks map[*memLock]struct{}
+}
+
+type memLock struct {
+	session *memSession
+	keys    []string
+	ctx     *memContext
+}
+
+// WithSession satisfies the consul.SessionManager interface. The Client, TTL,
+// and Clock of the session are ignored, in-memory sessions only end when they
+// are canceled, when ctx is canceled, or when ExpireSession is called.
+func (l *Locks) WithSession(ctx context.Context, session consul.Session) (context.Context, context.CancelFunc) {
+	if err := ctx.Err(); err != nil {
+		return canceledContext(ctx, err)
+	}
+
+	if len(session.Behavior) == 0 {
+		session.Behavior = consul.Release
+	}
+
+	l.mutex.Lock()
+	l.init()
+	l.nextID++
+	session.ID = consul.SessionID(fmt.Sprintf("00000000-0000-4000-9000-%012x", l.nextID))
+	s := &memSession{
+		info:  session,
+		ctx:   newMemContext(ctx, consul.SessionKey, session),
+		locks: make(map[*memLock]struct{}),
+	}
+	l.sessions[session.ID] = s
+	l.mutex.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.endSession(s, ctx.Err())
+		case <-s.ctx.done:
+		}
+	}()
+
+	return s.ctx, func() { l.endSession(s, context.Canceled) }
+}
+
+// Lock satisfies the consul.LockManager interface. The method blocks until all
+// the keys are free, then acquires them at once.
+func (l *Locks) Lock(ctx context.Context, keys ...string) (context.Context, context.CancelFunc) {
+	if len(keys) == 0 {
+		return canceledContext(ctx, consul.Unlocked)
+	}
+
+	keys = sortedKeys(keys)
+	s, sessionCtx, sessionCancel := l.withSession(ctx, "lock: ", keys)
+	if s == nil {
+		return sessionCtx, sessionCancel
+	}
+
+	for {
+		l.mutex.Lock()
+		if l.free(s, keys) {
+			lock := l.acquire(s, keys)
+			l.mutex.Unlock()
+			return lock.ctx, func() { l.release(lock, context.Canceled); sessionCancel() }
+		}
+		notify := l.notify
+		l.mutex.Unlock()
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			sessionCancel()
+			return canceledContext(ctx, ctx.Err())
+		case <-sessionCtx.Done():
+			sessionCancel()
+			return canceledContext(ctx, sessionCtx.Err())
+		}
+	}
+}
+
+// TryLockOne satisfies the consul.LockManager interface. The method acquires
+// the first of the keys which is free, or returns a canceled context if all of
+// them are held by other sessions, which Err method returns consul.Unlocked,
+// and for which consul.LockError returns an error matching consul.ErrLockHeld.
+func (l *Locks) TryLockOne(ctx context.Context, keys ...string) (context.Context, context.CancelFunc) {
+	if len(keys) == 0 {
+		return canceledContext(ctx, consul.Unlocked)
+	}
+
+	s, sessionCtx, sessionCancel := l.withSession(ctx, "try-lock: ", keys)
+	if s == nil {
+		return sessionCtx, sessionCancel
+	}
+
+	l.mutex.Lock()
+	for _, key := range keys {
+		if l.free(s, []string{key}) {
+			lock := l.acquire(s, []string{key})
+			l.mutex.Unlock()
+			return lock.ctx, func() { l.release(lock, context.Canceled); sessionCancel() }
+		}
+	}
+	l.mutex.Unlock()
+
+	sessionCancel()
+	held := context.WithValue(ctx, consul.LockErrorKey, &lockHeldError{keys: append([]string{}, keys...)})
+	return canceledContext(held, consul.Unlocked)
+}
+
+// Holder returns the ID of the session holding the lock on key, and whether
+// the key was locked.
+func (l *Locks) Holder(key string) (consul.SessionID, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if lock := l.held[key]; lock != nil {
+		return lock.session.info.ID, true
+	}
+	return "", false
+}
+
+// Revoke releases the lock held on key, as if it had been taken away from its
+// session (by an operator deleting the key for example). The context of the
+// lock is canceled with consul.Unlocked.
+//
+// The method returns false if the key was not locked.
+func (l *Locks) Revoke(key string) bool {
+	l.mutex.Lock()
+	lock := l.held[key]
+	l.mutex.Unlock()
+
+	if lock == nil {
+		return false
+	}
+
+	l.release(lock, consul.Unlocked)
+	return true
+}
+
+// ExpireSession invalidates the session with the given id, as if it could not
+// be renewed before its TTL expired. The context of the session is canceled
+// with an error matching consul.ErrSessionExpired, and the locks it held are
+// released.
+//
+// The method returns false if no session existed with the given id.
+func (l *Locks) ExpireSession(id consul.SessionID) bool {
+	l.mutex.Lock()
+	s := l.sessions[id]
+	l.mutex.Unlock()
+
+	if s == nil {
+		return false
+	}
+
+	l.endSession(s, fmt.Errorf("session %s expired: %w", id, consul.ErrSessionExpired))
+	return true
+}
+
+// withSession returns the in-memory session that ctx is attached to, or
+// creates a new one for the duration of the lock. The returned session is nil
+// if it could not be created, in which case the context reports why.
+func (l *Locks) withSession(ctx context.Context, prefix string, keys []string) (*memSession, context.Context, context.CancelFunc) {
+	if session, ok := ctx.Value(consul.SessionKey).(consul.Session); ok {
+		l.mutex.Lock()
+		s := l.sessions[session.ID]
+		l.mutex.Unlock()
+
+		if s != nil {
+			return s, ctx, func() {}
+		}
+	}
+
+	sessionCtx, sessionCancel := l.WithSession(ctx, consul.Session{
+		Name: prefix + fmt.Sprint(keys),
+	})
+	if sessionCtx.Err() != nil {
+		return nil, sessionCtx, sessionCancel
+	}
+
+	session := sessionCtx.Value(consul.SessionKey).(consul.Session)
+	l.mutex.Lock()
+	s := l.sessions[session.ID]
+	l.mutex.Unlock()
+	return s, sessionCtx, sessionCancel
+}
+
+// free must be called with the mutex held, it returns true if none of the keys
+// are held by sessions other than s.
+func (l *Locks) free(s *memSession, keys []string) bool {
+	if l.sessions[s.info.ID] != s {
+		return false
+	}
+	for _, key := range keys {
+		if lock := l.held[key]; lock != nil && lock.session != s {
+			return false
+		}
+	}
+	return true
+}
+
+// acquire must be called with the mutex held.
+func (l *Locks) acquire(s *memSession, keys []string) *memLock {
+	l.index++
+	tokens := make([]consul.FencingToken, len(keys))
+
+	for i, key := range keys {
+		l.indexes[key]++
+		tokens[i] = consul.FencingToken{
+			Key:         key,
+			Session:     s.info.ID,
+			LockIndex:   l.indexes[key],
+			ModifyIndex: l.index,
+		}
+	}
+
+	lock := &memLock{
+		session: s,
+		keys:    keys,
+		ctx:     newMemContext(newMemContext(s.ctx, consul.FencingTokensKey, tokens), consul.LocksKey, append([]string{}, keys...)),
+	}
+
+	for _, key := range keys {
+		l.held[key] = lock
+	}
+
+	s.locks[lock] = struct{}{}
+	return lock
+}
+
+func (l *Locks) release(lock *memLock, err error) {
+	l.mutex.Lock()
+	l.releaseLocked(lock)
+	l.commit()
+	l.mutex.Unlock()
+	lock.ctx.cancel(err)
+}
+
+func (l *Locks) releaseLocked(lock *memLock) {
+	for _, key := range lock.keys {
+		if l.held[key] == lock {
+			delete(l.held, key)
+		}
+	}
+	delete(lock.session.locks, lock)
+}
+
+func (l *Locks) endSession(s *memSession, err error) {
+	l.mutex.Lock()
+
+	if l.sessions[s.info.ID] != s {
+		l.mutex.Unlock()
+		return
+	}
+
+	delete(l.sessions, s.info.ID)
+	locks := make([]*memLock, 0, len(s.locks))
+
+	for lock := range s.locks {
+		l.releaseLocked(lock)
+		locks = append(locks, lock)
+	}
+
+	l.commit()
+	l.mutex.Unlock()
+
+	for _, lock := range locks {
+		lock.ctx.cancel(consul.Unlocked)
+	}
+	s.ctx.cancel(err)
+}
+
+func (l *Locks) init() {
+	if l.held == nil {
+		l.held = make(map[string]*memLock)
+		l.sessions = make(map[consul.SessionID]*memSession)
+		l.indexes = make(map[string]uint64)
+		l.notify = make(chan struct{})
+	}
+}
+
+// commit must be called with the mutex held, it wakes up the goroutines
+// waiting for locks to be released.
+func (l *Locks) commit() {
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// memContext is the implementation of contexts returned by Locks, which carry
+// a value and are canceled with a custom error.
+type memContext struct {
+	parent context.Context
+	key    interface{}
+	value  interface{}
+	err    atomic.Value
+	once   sync.Once
+	done   chan struct{}
+}
+
+func newMemContext(parent context.Context, key interface{}, value interface{}) *memContext {
+	return &memContext{
+		parent: parent,
+		key:    key,
+		value:  value,
+		done:   make(chan struct{}),
+	}
+}
+
+func canceledContext(parent context.Context, err error) (context.Context, context.CancelFunc) {
+	ctx := newMemContext(parent, nil, nil)
+	ctx.cancel(err)
+	return ctx, func() {}
+}
+
+func (c *memContext) Deadline() (time.Time, bool) {
+	return c.parent.Deadline()
+}
+
+func (c *memContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *memContext) Err() error {
+	err, _ := c.err.Load().(error)
+	return err
+}
+
+func (c *memContext) Value(key interface{}) interface{} {
+	if key != nil && key == c.key {
+		return c.value
+	}
+	return c.parent.Value(key)
+}
+
+func (c *memContext) cancel(err error) {
+	c.once.Do(func() {
+		c.err.Store(err)
+		close(c.done)
+	})
+}
+
+// lockHeldError is the lock error of the contexts returned by TryLockOne when
+// all keys are held by other sessions, it matches both consul.ErrLockHeld and
+// consul.Unlocked like the lock errors of consul.Locker.
+type lockHeldError struct {
+	keys []string
+}
+
+func (e *lockHeldError) Error() string {
+	return fmt.Sprintf("consultest: locks held by other sessions: %v", e.keys)
+}
+
+func (e *lockHeldError) Is(target error) bool { return target == consul.ErrLockHeld }
+
+func (e *lockHeldError) Unwrap() error { return consul.Unlocked }
+
+func sortedKeys(keys []string) []string {
+	keys = append([]string{}, keys...)
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,123 @@
+package consultest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestLocks(t *testing.T) {
+	var locks consul.LockManager = &Locks{}
+	ctx := context.Background()
+
+	lock, unlock := locks.Lock(ctx, "leader")
+	defer unlock()
+
+	if err := lock.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if keys := lock.Value(consul.LocksKey); !reflect.DeepEqual(keys, []string{"leader"}) {
+		t.Error("bad lock keys:", keys)
+	}
+
+	held, cancel := locks.TryLockOne(ctx, "leader")
+	cancel()
+
+	if err := held.Err(); err != consul.Unlocked {
+		t.Error("bad error for a lock held by another session:", err)
+	}
+	if err := consul.LockError(held); !errors.Is(err, consul.ErrLockHeld) || !errors.Is(err, consul.Unlocked) {
+		t.Error("bad error for a lock held by another session:", err)
+	}
+
+	other, cancel := locks.TryLockOne(ctx, "leader", "follower")
+	defer cancel()
+
+	if keys := other.Value(consul.LocksKey); !reflect.DeepEqual(keys, []string{"follower"}) {
+		t.Error("TryLockOne must acquire the first free key:", keys)
+	}
+}
+
+func TestLocksRevoke(t *testing.T) {
+	locks := &Locks{}
+	ctx := context.Background()
+
+	lock, unlock := locks.Lock(ctx, "leader")
+	defer unlock()
+	session := lock.Value(consul.SessionKey).(consul.Session)
+
+	if id, ok := locks.Holder("leader"); !ok || id != session.ID {
+		t.Error("bad lock holder:", id, ok)
+	}
+
+	next := make(chan context.Context)
+	go func() {
+		lock, _ := locks.Lock(ctx, "leader")
+		next <- lock
+	}()
+
+	select {
+	case <-next:
+		t.Fatal("the lock was acquired while another session held it")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	if !locks.Revoke("leader") {
+		t.Fatal("revoking a held lock must return true")
+	}
+
+	<-lock.Done()
+	if err := lock.Err(); err != consul.Unlocked {
+		t.Error("bad error for a revoked lock:", err)
+	}
+
+	nextLock := <-next
+	if err := nextLock.Err(); err != nil {
+		t.Error("the lock was not acquired after being revoked:", err)
+	}
+
+	// The fencing token of the new holder supersedes the one of the holder
+	// which lost the lock.
+	revoked, acquired := consul.FencingTokens(lock), consul.FencingTokens(nextLock)
+	if len(revoked) != 1 || len(acquired) != 1 || revoked[0].LockIndex != 1 || acquired[0].LockIndex != 2 {
+		t.Errorf("bad fencing tokens: %+v %+v", revoked, acquired)
+	}
+}
+
+func TestLocksExpireSession(t *testing.T) {
+	var sessions consul.SessionManager = &Locks{}
+	locks := sessions.(*Locks)
+
+	sessionCtx, cancel := sessions.WithSession(context.Background(), consul.Session{Name: "test"})
+	defer cancel()
+	session := sessionCtx.Value(consul.SessionKey).(consul.Session)
+
+	lock, unlock := locks.Lock(sessionCtx, "A", "B")
+	defer unlock()
+
+	if lock.Value(consul.SessionKey).(consul.Session).ID != session.ID {
+		t.Error("the lock must be attached to the session of the context")
+	}
+
+	if !locks.ExpireSession(session.ID) {
+		t.Fatal("expiring an active session must return true")
+	}
+
+	if err := sessionCtx.Err(); !errors.Is(err, consul.ErrSessionExpired) {
+		t.Error("bad session error:", err)
+	}
+	if err := lock.Err(); err != consul.Unlocked {
+		t.Error("bad lock error:", err)
+	}
+	if _, ok := locks.Holder("A"); ok {
+		t.Error("the locks of expired sessions must be released")
+	}
+
+	if lock, _ := locks.Lock(sessionCtx, "C"); !errors.Is(lock.Err(), consul.ErrSessionExpired) {
+		t.Error("locks can't be acquired with expired sessions:", lock.Err())
+	}
+}
@@ -0,0 +1,261 @@
+package consultest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+// Exchange is the record of a HTTP request sent to a consul agent and of the
+// response it received.
+type Exchange struct {
+	// The method and URL of the request. The URL only has the path and query,
+	// with the query parameters sorted and the token removed.
+	Method string
+	URL    string
+
+	// The body of the request, if any.
+	RequestBody string `json:",omitempty"`
+
+	// The status, headers, and body of the response. RawBody is used instead
+	// of Body when the response body is not valid UTF-8.
+	Status  int
+	Header  http.Header `json:",omitempty"`
+	Body    string      `json:",omitempty"`
+	RawBody []byte      `json:",omitempty"`
+
+	// The time it took to receive the response, which reproduces the timing of
+	// blocking queries when the exchange is replayed.
+	Delay time.Duration
+}
+
+// Recorder is a HTTP transport which records the exchanges it forwards to the
+// underlying transport, so they can be saved to a fixture file and replayed by
+// a Replayer.
+//
+// Tokens are never recorded, the X-Consul-Token header is not part of
+// exchanges and token query parameters are removed from the recorded URLs.
+type Recorder struct {
+	// The transport used to send the requests, which defaults to
+	// consul.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	mutex     sync.Mutex
+	exchanges []Exchange
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	exchange := Exchange{
+		Method: req.Method,
+		URL:    exchangeURL(req.URL),
+	}
+
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		exchange.RequestBody = string(b)
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	}
+
+	start := time.Now()
+	res, err := r.transport().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	exchange.Delay = time.Since(start)
+	exchange.Status = res.StatusCode
+	exchange.Header = res.Header.Clone()
+	exchange.Header.Del("Date")
+	exchange.Header.Del("Content-Length")
+
+	if utf8.Valid(b) {
+		exchange.Body = string(b)
+	} else {
+		exchange.RawBody = b
+	}
+
+	r.mutex.Lock()
+	r.exchanges = append(r.exchanges, exchange)
+	r.mutex.Unlock()
+	return res, nil
+}
+
+// Exchanges returns the list of exchanges recorded so far, in the order that
+// their responses were received.
+func (r *Recorder) Exchanges() []Exchange {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Exchange{}, r.exchanges...)
+}
+
+// Save writes the exchanges recorded so far to a fixture file at path.
+func (r *Recorder) Save(path string) error {
+	b, err := json.MarshalIndent(r.Exchanges(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+func (r *Recorder) transport() http.RoundTripper {
+	if transport := r.Transport; transport != nil {
+		return transport
+	}
+	return consul.DefaultTransport
+}
+
+// Replayer is a HTTP transport which serves responses from a list of recorded
+// exchanges instead of sending requests to a consul agent.
+//
+// Each request is matched with the first exchange that wasn't replayed yet and
+// has the same method, URL, and body. The response is delayed by the time it
+// took to receive it when it was recorded, so blocking queries behave like they
+// did when the exchanges were recorded, unless SkipDelays is set. Requests that
+// don't match any exchange fail with an error.
+type Replayer struct {
+	// The exchanges replayed by the transport.
+	Exchanges []Exchange
+
+	// If true, responses are returned immediately instead of reproducing the
+	// recorded delays.
+	SkipDelays bool
+
+	mutex    sync.Mutex
+	replayed []bool
+}
+
+// LoadReplayer returns a Replayer serving the exchanges of the fixture file at
+// path, which was written by a Recorder.
+func LoadReplayer(path string) (*Replayer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Replayer{}
+	if err := json.Unmarshal(b, &r.Exchanges); err != nil {
+		return nil, fmt.Errorf("consultest: decoding fixture %s: %w", path, err)
+	}
+
+	return r, nil
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	method, u := req.Method, exchangeURL(req.URL)
+	exchange, ok := r.next(method, u, string(body))
+	if !ok {
+		return nil, fmt.Errorf("consultest: no recorded exchange to replay for %s %s", method, u)
+	}
+
+	if !r.SkipDelays && exchange.Delay > 0 {
+		timer := time.NewTimer(exchange.Delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	resBody := exchange.RawBody
+	if resBody == nil {
+		resBody = []byte(exchange.Body)
+	}
+
+	header := exchange.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.Status, http.StatusText(exchange.Status)),
+		StatusCode:    exchange.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(resBody)),
+		ContentLength: int64(len(resBody)),
+		Request:       req,
+	}, nil
+}
+
+// Remaining returns the number of exchanges which were not replayed yet.
+func (r *Replayer) Remaining() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	n := 0
+	for i := range r.Exchanges {
+		if i >= len(r.replayed) || !r.replayed[i] {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Replayer) next(method string, u string, body string) (Exchange, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.replayed) < len(r.Exchanges) {
+		r.replayed = append(r.replayed, make([]bool, len(r.Exchanges)-len(r.replayed))...)
+	}
+
+	for i, exchange := range r.Exchanges {
+		if !r.replayed[i] && exchange.Method == method && exchange.URL == u && exchange.RequestBody == body {
+			r.replayed[i] = true
+			return exchange, true
+		}
+	}
+
+	return Exchange{}, false
+}
+
+// exchangeURL returns the canonical representation of u used to match requests
+// with recorded exchanges.
+func exchangeURL(u *url.URL) string {
+	query := u.Query()
+	query.Del("token")
+
+	if len(query) == 0 {
+		return u.Path
+	}
+
+	// Encode sorts the query parameters by name.
+	return u.Path + "?" + query.Encode()
+}
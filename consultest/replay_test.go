@@ -0,0 +1,98 @@
+package consultest
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestRecordReplay(t *testing.T) {
+	agent := NewAgent()
+	defer agent.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	const wait = 100 * time.Millisecond
+
+	// run executes the same sequence of operations against the client, it is
+	// used to record the exchanges with the fake agent and to replay them.
+	run := func(t *testing.T, client *consul.Client) (value string, elapsed time.Duration) {
+		store := &consul.Store{Client: client}
+
+		if ok, err := store.WriteValue(ctx, "key", "hello", 0); err != nil || !ok {
+			t.Fatal("write failed:", ok, err)
+		}
+
+		index, err := store.ReadValue(ctx, "key", &value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opts := consul.KVOptions{}
+		opts.WaitIndex = uint64(index)
+		opts.WaitTime = wait
+
+		start := time.Now()
+		if _, err := client.GetWithMeta(ctx, "/v1/kv/key", opts.Query(), nil); err != nil {
+			t.Fatal(err)
+		}
+		elapsed = time.Since(start)
+		return
+	}
+
+	recorder := &Recorder{Transport: agent.Client().Transport}
+	client := agent.Client()
+	client.Transport = recorder
+	client.Token = "secret"
+
+	if value, _ := run(t, client); value != "hello" {
+		t.Fatal("bad value:", value)
+	}
+
+	fixture := filepath.Join(t.TempDir(), "fixture.json")
+	if err := recorder.Save(fixture); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("secret")) {
+		t.Error("the token was recorded in the fixture file:\n", string(b))
+	}
+
+	agent.Close()
+
+	replayer, err := LoadReplayer(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client = &consul.Client{
+		Address:   "http://replay",
+		Token:     "other-secret",
+		Transport: replayer,
+	}
+
+	value, elapsed := run(t, client)
+	if value != "hello" {
+		t.Error("bad replayed value:", value)
+	}
+	if elapsed < wait {
+		t.Error("the timing of the blocking query was not replayed:", elapsed)
+	}
+	if n := replayer.Remaining(); n != 0 {
+		t.Error("some exchanges were not replayed:", n)
+	}
+
+	if err := client.Get(ctx, "/v1/kv/key", nil, nil); err == nil {
+		t.Error("expected an error when replaying an exchange that wasn't recorded")
+	}
+}
@@ -0,0 +1,327 @@
+package consultest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+const (
+	// DefaultImage is the docker image used to run consul servers when none
+	// was configured.
+	DefaultImage = "hashicorp/consul:latest"
+
+	// DefaultStartTimeout is the time that servers are given to elect a
+	// leader when no timeout was configured.
+	DefaultStartTimeout = 1 * time.Minute
+)
+
+// ErrServerUnavailable is returned by StartServer when neither a consul binary
+// nor docker could be found to run the server.
+var ErrServerUnavailable = errors.New("consultest: neither a consul binary nor docker were found to run a consul server")
+
+// ServerConfig carries the configuration of consul servers started by
+// StartServer. The zero-value runs a consul binary found in the PATH, falling
+// back to running DefaultImage with docker.
+type ServerConfig struct {
+	// Path to the consul binary to run the server with.
+	Binary string
+
+	// If set, the server is run in a docker container created from this
+	// image, even if a consul binary is available.
+	Image string
+
+	// Extra command line arguments passed to the consul agent.
+	Args []string
+
+	// The maximum amount of time given to the server to start and elect a
+	// leader, defaults to DefaultStartTimeout.
+	StartTimeout time.Duration
+}
+
+// Server is a real consul agent running in dev mode, as a subprocess or in a
+// docker container, for integration tests.
+type Server struct {
+	// The address of the HTTP API of the server, in the form http://ip:port.
+	Address string
+
+	once  sync.Once
+	err   error
+	close func() error
+	logs  *syncBuffer
+}
+
+// StartServer launches a consul agent in dev mode with the given
+// configuration, and waits until it elected itself leader of its cluster.
+//
+// The program must call Close when it doesn't need the server anymore, to
+// stop the agent and release its resources.
+func StartServer(ctx context.Context, config ServerConfig) (*Server, error) {
+	timeout := config.StartTimeout
+	if timeout == 0 {
+		timeout = DefaultStartTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var s *Server
+	var err error
+
+	switch {
+	case len(config.Image) != 0:
+		s, err = startContainer(ctx, config.Image, config.Args)
+	case len(config.Binary) != 0:
+		s, err = startProcess(config.Binary, config.Args)
+	default:
+		if binary, lookErr := exec.LookPath("consul"); lookErr == nil {
+			s, err = startProcess(binary, config.Args)
+		} else if _, lookErr := exec.LookPath("docker"); lookErr == nil {
+			s, err = startContainer(ctx, DefaultImage, config.Args)
+		} else {
+			err = ErrServerUnavailable
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.waitForLeader(ctx); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("consultest: waiting for the consul server to start: %w\n%s", err, s.logs.String())
+	}
+
+	return s, nil
+}
+
+// NewServer starts a consul server for the test t, which is stopped when the
+// test completes. The test is skipped if no consul binary or docker could be
+// found, and fails if the server could not be started.
+func NewServer(t testing.TB, config ServerConfig) *Server {
+	t.Helper()
+
+	s, err := StartServer(context.Background(), config)
+	switch {
+	case errors.Is(err, ErrServerUnavailable):
+		t.Skip(err)
+	case err != nil:
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return s
+}
+
+// Client returns a new client configured to send requests to the server.
+func (s *Server) Client() *consul.Client {
+	return &consul.Client{
+		Address:    s.Address,
+		UserAgent:  "consultest",
+		Datacenter: DefaultDatacenter,
+	}
+}
+
+// Logs returns the output of the consul agent.
+func (s *Server) Logs() string {
+	return s.logs.String()
+}
+
+// Close stops the server, it is safe to call it multiple times.
+func (s *Server) Close() error {
+	s.once.Do(func() { s.err = s.close() })
+	return s.err
+}
+
+func (s *Server) waitForLeader(ctx context.Context) error {
+	client := s.Client()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		var leader string
+
+		if err := client.Get(ctx, "/v1/status/leader", nil, &leader); err == nil && len(leader) != 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// startProcess runs a consul agent as a subprocess. Dev agents listen on fixed
+// ports by default, so free ports are picked for each of them to allow tests to
+// run multiple servers concurrently.
+func startProcess(binary string, extraArgs []string) (*Server, error) {
+	ports, err := freePorts(5)
+	if err != nil {
+		return nil, err
+	}
+
+	args := append(devArgs(DefaultNode, "127.0.0.1"),
+		"-http-port="+strconv.Itoa(ports[0]),
+		"-serf-lan-port="+strconv.Itoa(ports[1]),
+		"-serf-wan-port="+strconv.Itoa(ports[2]),
+		"-server-port="+strconv.Itoa(ports[3]),
+		"-grpc-port="+strconv.Itoa(ports[4]),
+		"-dns-port=-1",
+	)
+	args = append(args, extraArgs...)
+
+	logs := &syncBuffer{}
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = logs
+	cmd.Stderr = logs
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("consultest: starting %s: %w", binary, err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	return &Server{
+		Address: "http://127.0.0.1:" + strconv.Itoa(ports[0]),
+		logs:    logs,
+		close: func() error {
+			cmd.Process.Kill()
+			<-exited
+			return nil
+		},
+	}, nil
+}
+
+// startContainer runs a consul agent in a docker container, publishing the
+// HTTP port of the agent on a random port of the loopback interface.
+func startContainer(ctx context.Context, image string, extraArgs []string) (*Server, error) {
+	args := append([]string{"run", "--detach", "--rm", "--publish", "127.0.0.1::8500", image},
+		devArgs(DefaultNode, "0.0.0.0")...)
+	args = append(args, extraArgs...)
+
+	out, err := docker(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	id := strings.TrimSpace(out)
+
+	s := &Server{
+		logs: &syncBuffer{},
+		close: func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			_, err := docker(ctx, "rm", "--force", id)
+			return err
+		},
+	}
+
+	out, err = docker(ctx, "port", id, "8500/tcp")
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	// The output may list multiple bindings (for example IPv4 and IPv6), the
+	// first one is used.
+	addr := strings.TrimSpace(strings.SplitN(out, "\n", 2)[0])
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("consultest: bad port mapping for container %s: %q", id, addr)
+	}
+
+	s.Address = "http://" + addr
+	s.logs.WriteString("container " + id + "\n")
+	return s, nil
+}
+
+func devArgs(node string, clientAddr string) []string {
+	return []string{
+		"agent",
+		"-dev",
+		"-node=" + node,
+		"-datacenter=" + DefaultDatacenter,
+		"-bind=127.0.0.1",
+		"-client=" + clientAddr,
+		"-log-level=warn",
+	}
+}
+
+func docker(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("consultest: docker %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+func freePorts(n int) ([]int, error) {
+	ports := make([]int, n)
+	listeners := make([]net.Listener, 0, n)
+
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+
+	// All listeners are kept open until the end so the same port isn't
+	// returned twice.
+	for i := range ports {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, l)
+		ports[i] = l.Addr().(*net.TCPAddr).Port
+	}
+
+	return ports, nil
+}
+
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) WriteString(s string) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.WriteString(s)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
@@ -0,0 +1,54 @@
+package consultest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer(t, ServerConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	store := &consul.Store{Client: server.Client()}
+
+	if ok, err := store.WriteValue(ctx, "consultest/key", "value", -1); err != nil || !ok {
+		t.Fatal("write failed:", ok, err)
+	}
+
+	var value string
+	if _, err := store.ReadValue(ctx, "consultest/key", &value); err != nil {
+		t.Fatal(err)
+	}
+	if value != "value" {
+		t.Error("bad value:", value)
+	}
+}
+
+func TestStartServerBadBinary(t *testing.T) {
+	_, err := StartServer(context.Background(), ServerConfig{
+		Binary: "/path/to/nowhere/consul",
+	})
+	if err == nil {
+		t.Error("expected an error but got none")
+	}
+}
+
+func TestFreePorts(t *testing.T) {
+	ports, err := freePorts(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[int]bool)
+	for _, port := range ports {
+		if port == 0 || seen[port] {
+			t.Error("bad port:", ports)
+		}
+		seen[port] = true
+	}
+}
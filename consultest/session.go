@@ -0,0 +1,234 @@
+package consultest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+type session struct {
+	info  consul.SessionInfo
+	ttl   time.Duration
+	timer *time.Timer
+}
+
+func (s *session) stop() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+}
+
+// InvalidateSession expires the session with the given id, as if its TTL had
+// elapsed without being renewed, applying its behavior to the keys it held
+// locks on.
+//
+// The method returns false if no session existed with the given id.
+func (a *Agent) InvalidateSession(id consul.SessionID) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.invalidateSession(id)
+}
+
+func (a *Agent) invalidateSession(id consul.SessionID) bool {
+	s := a.sessions[id]
+	if s == nil {
+		return false
+	}
+
+	s.stop()
+	delete(a.sessions, id)
+
+	var released []*kvEntry
+	var deleted []string
+
+	for key, e := range a.kv {
+		if e.Session == id {
+			if s.info.Behavior == consul.Delete {
+				deleted = append(deleted, key)
+			} else {
+				released = append(released, e)
+			}
+		}
+	}
+
+	if len(released) == 0 && len(deleted) == 0 {
+		a.commit(&a.sessionIndex)
+		return true
+	}
+
+	a.commit(&a.sessionIndex, &a.kvIndex)
+
+	for _, key := range deleted {
+		delete(a.kv, key)
+	}
+
+	for _, e := range released {
+		e.Session, e.ModifyIndex = "", a.index
+	}
+
+	return true
+}
+
+func (a *Agent) serveSession(res http.ResponseWriter, req *http.Request, path string) {
+	switch {
+	case path == "create" && req.Method == "PUT":
+		a.createSession(res, req)
+	case strings.HasPrefix(path, "destroy/") && req.Method == "PUT":
+		a.destroySession(res, consul.SessionID(strings.TrimPrefix(path, "destroy/")))
+	case strings.HasPrefix(path, "renew/") && req.Method == "PUT":
+		a.renewSession(res, consul.SessionID(strings.TrimPrefix(path, "renew/")))
+	case strings.HasPrefix(path, "info/") && req.Method == "GET":
+		id := consul.SessionID(strings.TrimPrefix(path, "info/"))
+		a.listSessions(res, req, func(s *session) bool { return s.info.ID == id })
+	case strings.HasPrefix(path, "node/") && req.Method == "GET":
+		node := strings.TrimPrefix(path, "node/")
+		a.listSessions(res, req, func(s *session) bool { return s.info.Node == node })
+	case path == "list" && req.Method == "GET":
+		a.listSessions(res, req, func(*session) bool { return true })
+	default:
+		unsupported(res, req)
+	}
+}
+
+func (a *Agent) createSession(res http.ResponseWriter, req *http.Request) {
+	var config struct {
+		Name      string
+		Node      string
+		Checks    []string
+		Behavior  consul.SessionBehavior
+		LockDelay json.RawMessage
+		TTL       string
+	}
+
+	if req.ContentLength != 0 && !readJSON(res, req, &config) {
+		return
+	}
+
+	lockDelay, err := parseDuration(config.LockDelay)
+	if err != nil {
+		http.Error(res, "Request decode failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if len(config.TTL) != 0 {
+		if ttl, err = time.ParseDuration(config.TTL); err != nil {
+			http.Error(res, "Request decode failed: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if len(config.Node) == 0 {
+		config.Node = DefaultNode
+	}
+
+	if len(config.Behavior) == 0 {
+		config.Behavior = consul.Release
+	}
+
+	if config.Checks == nil {
+		config.Checks = []string{"serfHealth"}
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.nodes[config.Node] == nil {
+		http.Error(res, "Missing node registration", http.StatusInternalServerError)
+		return
+	}
+
+	id := consul.SessionID(a.newID())
+	a.commit(&a.sessionIndex)
+
+	s := &session{
+		info: consul.SessionInfo{
+			ID:          id,
+			Name:        config.Name,
+			Node:        config.Node,
+			Checks:      config.Checks,
+			LockDelay:   lockDelay,
+			Behavior:    config.Behavior,
+			TTL:         config.TTL,
+			CreateIndex: a.index,
+			ModifyIndex: a.index,
+		},
+		ttl: ttl,
+	}
+
+	a.sessions[id] = s
+	a.startSessionTimer(s)
+	a.writeJSON(res, 0, map[string]consul.SessionID{"ID": id})
+}
+
+func (a *Agent) destroySession(res http.ResponseWriter, id consul.SessionID) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.invalidateSession(id)
+	a.writeJSON(res, 0, true)
+}
+
+func (a *Agent) renewSession(res http.ResponseWriter, id consul.SessionID) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	s := a.sessions[id]
+	if s == nil {
+		http.Error(res, "Session id '"+string(id)+"' not found", http.StatusNotFound)
+		return
+	}
+
+	s.stop()
+	a.startSessionTimer(s)
+	a.writeJSON(res, 0, []consul.SessionInfo{s.info})
+}
+
+func (a *Agent) startSessionTimer(s *session) {
+	if s.ttl == 0 {
+		return
+	}
+	id := s.info.ID
+	s.timer = time.AfterFunc(s.ttl, func() { a.InvalidateSession(id) })
+}
+
+func (a *Agent) listSessions(res http.ResponseWriter, req *http.Request, match func(*session) bool) {
+	if !a.block(req, tableIndex(&a.sessionIndex)) {
+		return
+	}
+	defer a.mutex.Unlock()
+
+	list := []consul.SessionInfo{}
+
+	for _, s := range a.sessions {
+		if match(s) {
+			list = append(list, s.info)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].CreateIndex < list[j].CreateIndex })
+	a.writeJSON(res, a.sessionIndex, list)
+}
+
+// parseDuration parses lock delays, which may be expressed as duration strings
+// or numbers of seconds.
+func parseDuration(b json.RawMessage) (time.Duration, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		return time.ParseDuration(s)
+	}
+
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
@@ -0,0 +1,169 @@
+package consultest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+type txnOp struct {
+	KV *txnKVOp
+}
+
+type txnKVOp struct {
+	Verb    string
+	Key     string
+	Value   []byte
+	Flags   uint64
+	Index   uint64
+	Session consul.SessionID
+}
+
+type txnResult struct {
+	KV *kvEntry
+}
+
+type txnError struct {
+	OpIndex int
+	What    string
+}
+
+// serveTxn implements the key/value operations of the /v1/txn endpoint. Like
+// with consul, the operations are applied atomically at a single index, if any
+// of them fails none are applied and the errors are returned with a 409 status.
+func (a *Agent) serveTxn(res http.ResponseWriter, req *http.Request) {
+	if req.Method != "PUT" {
+		unsupported(res, req)
+		return
+	}
+
+	var ops []txnOp
+	if !readJSON(res, req, &ops) {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// The operations are applied to copies of the entries they modify, which
+	// are only written to the store if all operations succeeded. Deleted keys
+	// are represented by nil entries.
+	index := a.index + 1
+	changes := make(map[string]*kvEntry)
+	lookup := func(key string) *kvEntry {
+		if e, ok := changes[key]; ok {
+			return e
+		}
+		if e := a.kv[key]; e != nil {
+			c := *e
+			return &c
+		}
+		return nil
+	}
+
+	var results []txnResult
+	var errs []txnError
+
+	for i, op := range ops {
+		fail := func(format string, args ...interface{}) {
+			errs = append(errs, txnError{OpIndex: i, What: fmt.Sprintf(format, args...)})
+		}
+
+		if op.KV == nil {
+			fail("consultest: only key/value operations are supported by the fake agent")
+			continue
+		}
+
+		kv := op.KV
+		e := lookup(kv.Key)
+
+		switch kv.Verb {
+		case "get":
+			if e == nil {
+				fail("key %q doesn't exist", kv.Key)
+				continue
+			}
+
+		case "set", "cas", "lock", "unlock":
+			switch kv.Verb {
+			case "cas":
+				if (kv.Index == 0 && e != nil) || (kv.Index != 0 && (e == nil || e.ModifyIndex != kv.Index)) {
+					fail("failed to set key %q, index is stale", kv.Key)
+					continue
+				}
+			case "lock":
+				if a.sessions[kv.Session] == nil {
+					fail("failed to lock key %q: invalid session %q", kv.Key, kv.Session)
+					continue
+				}
+				if e != nil && len(e.Session) != 0 && e.Session != kv.Session {
+					fail("failed to lock key %q, lock is already held", kv.Key)
+					continue
+				}
+			case "unlock":
+				if e == nil || e.Session != kv.Session {
+					fail("failed to unlock key %q, lock isn't held, or is held by another session", kv.Key)
+					continue
+				}
+			}
+
+			if e == nil {
+				e = &kvEntry{Key: kv.Key, CreateIndex: index}
+			}
+			e.Value, e.Flags, e.ModifyIndex = kv.Value, kv.Flags, index
+
+			switch kv.Verb {
+			case "lock":
+				if e.Session != kv.Session {
+					e.Session = kv.Session
+					e.LockIndex++
+				}
+			case "unlock":
+				e.Session = ""
+			}
+
+			changes[kv.Key] = e
+
+		case "delete":
+			changes[kv.Key] = nil
+			continue
+
+		case "check-session":
+			if e == nil || e.Session != kv.Session {
+				fail("failed to check session %q for key %q", kv.Session, kv.Key)
+				continue
+			}
+
+		default:
+			fail("consultest: the %q verb is not supported by the fake agent", kv.Verb)
+			continue
+		}
+
+		c := *e
+		results = append(results, txnResult{KV: &c})
+	}
+
+	if len(errs) != 0 {
+		b, _ := json.Marshal(struct{ Errors []txnError }{errs})
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(http.StatusConflict)
+		res.Write(b)
+		return
+	}
+
+	if len(changes) != 0 {
+		a.commit(&a.kvIndex)
+
+		for key, e := range changes {
+			if e == nil {
+				delete(a.kv, key)
+			} else {
+				a.kv[key] = e
+			}
+		}
+	}
+
+	a.writeJSON(res, 0, struct{ Results []txnResult }{results})
+}
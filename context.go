@@ -2,9 +2,122 @@ package consul
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"time"
 )
 
+// Consistency is an enumeration of the consistency modes that read queries may
+// be served with, see https://www.consul.io/api/features/consistency.html
+type Consistency string
+
+const (
+	// ConsistencyDefault lets consul use its default consistency mode.
+	ConsistencyDefault Consistency = ""
+
+	// ConsistencyStale allows any server to answer read queries, trading
+	// consistency for latency and availability.
+	ConsistencyStale Consistency = "stale"
+
+	// ConsistencyConsistent forces the leader to verify its leadership before
+	// answering read queries.
+	ConsistencyConsistent Consistency = "consistent"
+)
+
+var (
+	// DatacenterKey is the key at which the datacenter set by
+	// ContextWithDatacenter is stored in a context.
+	DatacenterKey = &contextKey{"consul-datacenter"}
+
+	// ConsistencyKey is the key at which the consistency mode set by
+	// ContextWithConsistency is stored in a context.
+	ConsistencyKey = &contextKey{"consul-consistency"}
+
+	// NamespaceKey is the key at which the namespace set by
+	// ContextWithNamespace is stored in a context.
+	NamespaceKey = &contextKey{"consul-namespace"}
+
+	// RequestIDKey is the key at which the request ID set by
+	// ContextWithRequestID is stored in a context.
+	RequestIDKey = &contextKey{"consul-request-id"}
+
+	// LookupStatusKey is the key at which the lookup status set by
+	// ContextWithLookupStatus is stored in a context.
+	LookupStatusKey = &contextKey{"consul-lookup-status"}
+)
+
+// ContextWithDatacenter returns a copy of ctx which directs the requests sent
+// with it to the given datacenter, taking precedence over the Datacenter field
+// of the client.
+func ContextWithDatacenter(ctx context.Context, datacenter string) context.Context {
+	return context.WithValue(ctx, DatacenterKey, datacenter)
+}
+
+// ContextWithConsistency returns a copy of ctx which sets the consistency mode
+// of the requests sent with it. The mode is ignored by requests which already
+// specify one in their query string.
+func ContextWithConsistency(ctx context.Context, mode Consistency) context.Context {
+	return context.WithValue(ctx, ConsistencyKey, mode)
+}
+
+// ContextWithNamespace returns a copy of ctx which scopes the requests sent
+// with it to the given namespace (consul enterprise).
+func ContextWithNamespace(ctx context.Context, namespace string) context.Context {
+	return context.WithValue(ctx, NamespaceKey, namespace)
+}
+
+// ContextWithRequestID returns a copy of ctx which carries the given request
+// ID. Clients configured with a RequestIDHeader send it with the requests made
+// with the context, instead of generating a new ID for each request.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, RequestIDKey, id)
+}
+
+// ContextWithLookupStatus returns a copy of ctx which makes the service
+// lookups done with it fill status, so programs can tell whether they were
+// served stale endpoints.
+//
+// The status must not be shared by concurrent lookups.
+func ContextWithLookupStatus(ctx context.Context, status *LookupStatus) context.Context {
+	return context.WithValue(ctx, LookupStatusKey, status)
+}
+
+// contextRequestID returns the request ID carried by ctx, or a new random ID if
+// it has none.
+func contextRequestID(ctx context.Context) string {
+	if id, _ := ctx.Value(RequestIDKey).(string); len(id) != 0 {
+		return id
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// contextQuery returns query extended with the parameters carried by ctx, dc
+// is the default datacenter used when ctx does not carry one. Parameters that
+// are already present in query take precedence.
+func contextQuery(ctx context.Context, query Query, dc string) Query {
+	if v, ok := ctx.Value(DatacenterKey).(string); ok && len(v) != 0 {
+		dc = v
+	}
+
+	if len(dc) != 0 && !query.has("dc") {
+		query = append(query, Param{"dc", dc})
+	}
+
+	if mode, _ := ctx.Value(ConsistencyKey).(Consistency); len(mode) != 0 {
+		if !query.has("stale") && !query.has("consistent") {
+			query = append(query, Param{Name: string(mode)})
+		}
+	}
+
+	if ns, _ := ctx.Value(NamespaceKey).(string); len(ns) != 0 {
+		query = append(query, Param{"ns", ns})
+	}
+
+	return query
+}
+
 func errorContext(ctx context.Context, err error) (context.Context, context.CancelFunc) {
 	return newErrorCtx(ctx, err), func() {}
 }
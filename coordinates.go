@@ -2,6 +2,7 @@ package consul
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"time"
 )
@@ -60,6 +61,12 @@ func (coords NodeCoordinates) Distance(nodeA string, nodeB string) (time.Duratio
 // is updated asynchronously and fully non-blocking (except for the very first
 // call which has to initialize the cache).
 //
+// When Watch is set, the cache is instead kept up to date by a blocking query
+// running in a background goroutine, which only receives responses when the
+// coordinates changed. This keeps the coordinates fresh in large clusters
+// without polling the full list every second. The goroutine is started by the
+// first call to NodeCoordinates, and runs until Close is called.
+//
 // Methods of Tomography are safe to use concurrently from multiple goroutines,
 // assuming the fields aren't being modified after the value was constructed.
 type Tomography struct {
@@ -67,27 +74,83 @@ type Tomography struct {
 	Client *Client
 
 	// Configures how often the state is updated. If zero, the state is updated
-	// every second.
+	// every second. The field is ignored when Watch is set.
 	CacheTimeout time.Duration
 
+	// If set to true, the coordinates are updated by watching for changes
+	// with blocking queries instead of being refetched when the cache expires.
+	Watch bool
+
+	// The watcher used to run the blocking queries when Watch is set. If nil,
+	// a watcher using Client is created.
+	Watcher *Watcher
+
 	// Cached state of the consul network tomography.
-	nodes cachedValue
+	nodes   cachedValue
+	watched watchedValue
 }
 
 // NodeCoordinates returns the current coordinates of all nodes in the consul
 // datacenter.
+//
+// The returned map is shared with other callers and must not be modified.
 func (t *Tomography) NodeCoordinates(ctx context.Context) (NodeCoordinates, error) {
+	if t.Watch {
+		return t.watchNodeCoordinates(ctx)
+	}
+
 	now := time.Now()
 	exp := now.Add(t.cacheTimeout())
 
 	val, err := t.nodes.lookup(now, exp, func() (interface{}, error) {
 		return t.client().nodeCoordinates(ctx)
-	})
+	}, t.discardError)
 
 	nodes, _ := val.(NodeCoordinates)
 	return nodes, err
 }
 
+// Close stops the background goroutine watching the coordinates, if any.
+func (t *Tomography) Close() error {
+	t.watched.close()
+	return nil
+}
+
+func (t *Tomography) watchNodeCoordinates(ctx context.Context) (NodeCoordinates, error) {
+	val, err := t.watched.lookup(ctx, func(ctx context.Context, update func(interface{}, error)) {
+		var nodes NodeCoordinates
+
+		t.watcher().watchQuery(ctx, "/v1/coordinate/nodes", nil,
+			func() interface{} { return &[]nodeCoordinates{} },
+			func(value interface{}, err error) {
+				if err != nil {
+					update(nil, err)
+					return
+				}
+				// Merging the response into the current coordinates keeps
+				// serving the same map when nothing changed, and only copies
+				// it when nodes were updated, added, or removed.
+				nodes = nodes.merge(*value.(*[]nodeCoordinates))
+				update(nodes, nil)
+			},
+		)
+	}, t.discardError)
+
+	nodes, _ := val.(NodeCoordinates)
+	return nodes, err
+}
+
+func (t *Tomography) discardError(err error) {
+	t.client().handleError(fmt.Errorf("consul: refreshing the node coordinates: %w", err))
+}
+
+func (t *Tomography) watcher() *Watcher {
+	if watcher := t.Watcher; watcher != nil {
+		return watcher
+	}
+	return &Watcher{Client: t.Client}
+}
+
 func (t *Tomography) client() *Client {
 	if client := t.Client; client != nil {
 		return client
@@ -105,12 +168,43 @@ func (t *Tomography) cacheTimeout() time.Duration {
 // DefaultTomography is used as the default Tomography instance when
 var DefaultTomography = &Tomography{}
 
-func (c *Client) nodeCoordinates(ctx context.Context) (nodes NodeCoordinates, err error) {
-	var results []struct {
-		Node  string
-		Coord Coordinates
+// nodeCoordinates is the representation of items returned by the
+// /v1/coordinate/nodes endpoint.
+type nodeCoordinates struct {
+	Node  string
+	Coord Coordinates
+}
+
+// merge returns the coordinates of results, which is the full list of nodes,
+// reusing coords if none of the nodes changed.
+func (coords NodeCoordinates) merge(results []nodeCoordinates) NodeCoordinates {
+	if coords != nil && len(coords) == len(results) {
+		changed := false
+
+		for _, res := range results {
+			if c, ok := coords[res.Node]; !ok || c != res.Coord {
+				changed = true
+				break
+			}
+		}
+
+		if !changed {
+			return coords
+		}
 	}
 
+	nodes := make(NodeCoordinates, len(results))
+
+	for _, res := range results {
+		nodes[res.Node] = res.Coord
+	}
+
+	return nodes
+}
+
+func (c *Client) nodeCoordinates(ctx context.Context) (nodes NodeCoordinates, err error) {
+	var results []nodeCoordinates
+
 	if err = c.Get(ctx, "/v1/coordinate/nodes", nil, &results); err != nil {
 		return
 	}
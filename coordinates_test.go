@@ -2,7 +2,10 @@ package consul
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
 	"reflect"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -93,3 +96,61 @@ func TestTomography(t *testing.T) {
 		}
 	})
 }
+
+func TestTomographyWatch(t *testing.T) {
+	updates := [][]nodeCoordinates{
+		{{Node: "A", Coord: Coordinates{Height: 1}}, {Node: "B"}},
+		{{Node: "A", Coord: Coordinates{Height: 2}}, {Node: "B"}},
+	}
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		index, _ := strconv.Atoi(req.URL.Query().Get("index"))
+
+		if index >= len(updates) {
+			select {
+			case <-req.Context().Done():
+			case <-time.After(time.Second):
+			}
+			index = len(updates) - 1
+		}
+
+		res.Header().Set("X-Consul-Index", strconv.Itoa(index+1))
+		json.NewEncoder(res).Encode(updates[index])
+	})
+	defer server.Close()
+
+	tomography := &Tomography{Client: client, Watch: true}
+	defer tomography.Close()
+
+	nodes, err := tomography.NodeCoordinates(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 {
+		t.Error("bad node coordinates:", nodes)
+	}
+
+	for deadline := time.Now().Add(time.Second); nodes["A"].Height != 2; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the node coordinates were not updated:", nodes)
+		}
+		nodes, _ = tomography.NodeCoordinates(context.Background())
+	}
+}
+
+func TestNodeCoordinatesMerge(t *testing.T) {
+	results := []nodeCoordinates{{Node: "A", Coord: Coordinates{Height: 1}}, {Node: "B"}}
+
+	coords := NodeCoordinates(nil).merge(results)
+	if !reflect.DeepEqual(coords, NodeCoordinates{"A": {Height: 1}, "B": {}}) {
+		t.Error("bad node coordinates:", coords)
+	}
+
+	if merged := coords.merge(results); reflect.ValueOf(merged).Pointer() != reflect.ValueOf(coords).Pointer() {
+		t.Error("merging unchanged coordinates must return the same map")
+	}
+
+	if merged := coords.merge(results[:1]); len(merged) != 1 || len(coords) != 2 {
+		t.Error("merging must not modify the current coordinates:", merged, coords)
+	}
+}
@@ -0,0 +1,101 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Counter is an integer shared by the programs of a cluster, stored in a key
+// of the consul key/value store, which can be used to generate cluster-wide
+// sequence numbers or to account for the use of a quota.
+//
+// The counter is updated with compare-and-swap writes, which are retried when
+// other programs modified the key concurrently. Its value is stored in decimal
+// form, a key which doesn't exist holds the value zero.
+type Counter struct {
+	// The client used to send requests to the consul agent. If nil, the default
+	// client is used instead.
+	Client *Client
+
+	// The key of the consul key/value store holding the value of the counter.
+	Key string
+}
+
+// Get returns the current value of the counter.
+func (c *Counter) Get(ctx context.Context) (value int64, err error) {
+	value, _, err = c.read(ctx)
+	return
+}
+
+// Increment adds one to the counter, returning its new value.
+func (c *Counter) Increment(ctx context.Context) (value int64, err error) {
+	return c.Add(ctx, 1)
+}
+
+// Add adds delta, which may be negative, to the counter and returns its new
+// value. The method retries until the update succeeds, or the context is
+// canceled.
+func (c *Counter) Add(ctx context.Context, delta int64) (value int64, err error) {
+	client := c.client()
+
+	for {
+		var index uint64
+		var ok bool
+
+		if value, index, err = c.read(ctx); err != nil {
+			return
+		}
+
+		value += delta
+		query := Query{{"cas", strconv.FormatUint(index, 10)}}
+
+		if err = client.Put(ctx, "/v1/kv/"+c.Key, query, value, &ok); err != nil || ok {
+			return
+		}
+
+		// The key was modified since it was read, another program updated the
+		// counter and the operation is retried with its new value.
+		if err = ctx.Err(); err != nil {
+			return
+		}
+	}
+}
+
+// read returns the value of the counter and the index of its last
+// modification, which is zero if the key doesn't exist yet.
+func (c *Counter) read(ctx context.Context) (value int64, index uint64, err error) {
+	var entries []struct {
+		Value       []byte
+		ModifyIndex uint64
+	}
+
+	if err = c.client().Get(ctx, "/v1/kv/"+c.Key, nil, &entries); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+		return
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	index = entries[0].ModifyIndex
+
+	if s := strings.TrimSpace(string(entries[0].Value)); len(s) != 0 {
+		if value, err = strconv.ParseInt(s, 10, 64); err != nil {
+			err = fmt.Errorf("consul: counter %s holds a value which is not an integer: %q", c.Key, s)
+		}
+	}
+	return
+}
+
+func (c *Counter) client() *Client {
+	if client := c.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
@@ -0,0 +1,41 @@
+package consul_test
+
+import (
+	"sync"
+	"testing"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestCounter(t *testing.T) {
+	agent, ctx := newFakeAgent(t)
+	counter := &consul.Counter{Client: agent.Client(), Key: "counter"}
+
+	if value, err := counter.Get(ctx); err != nil || value != 0 {
+		t.Fatal("a counter which doesn't exist must be zero:", value, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i != 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j != 10; j++ {
+				if _, err := counter.Increment(ctx); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if value, err := counter.Add(ctx, -50); err != nil || value != 50 {
+		t.Error("bad counter value:", value, err)
+	}
+
+	agent.Put("counter", []byte("oops"))
+
+	if _, err := counter.Increment(ctx); err == nil {
+		t.Error("incrementing a counter holding a non-integer value must fail")
+	}
+}
@@ -0,0 +1,278 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ListDatacenters returns the list of datacenters known to the consul servers,
+// which consul sorts by estimated round trip time from the datacenter of the
+// agent.
+func (c *Catalog) ListDatacenters(ctx context.Context) (datacenters []string, err error) {
+	err = c.client().Get(ctx, "/v1/catalog/datacenters", nil, &datacenters)
+	return
+}
+
+// ListDatacenters is a helper function that delegates to the default catalog.
+func ListDatacenters(ctx context.Context) ([]string, error) {
+	return DefaultCatalog.ListDatacenters(ctx)
+}
+
+// Datacenter fetches the name of the datacenter that the consul agent is
+// running in.
+func (a *Agent) Datacenter(ctx context.Context) (string, error) {
+	c, err := a.load(ctx)
+	if err != nil {
+		return "", err
+	}
+	return c.Config.Datacenter, nil
+}
+
+// DatacenterDistance is the estimated round trip time to a datacenter.
+type DatacenterDistance struct {
+	Datacenter string
+
+	// The median of the estimated round trip times between the servers of
+	// the two datacenters, zero for the origin datacenter.
+	RTT time.Duration
+
+	// False if the RTT could not be estimated because one of the datacenters
+	// had no server coordinates.
+	Known bool
+}
+
+// DatacenterDistances returns the estimated round trip times from the servers
+// of the datacenter named from to the servers of all datacenters, using the WAN
+// coordinates of the servers. The origin datacenter comes first, followed by
+// the other datacenters sorted by distance, then the datacenters for which the
+// distance is unknown.
+func (t *Tomography) DatacenterDistances(ctx context.Context, from string) (distances []DatacenterDistance, err error) {
+	var results []datacenterCoordinates
+
+	if err = t.client().Get(ctx, "/v1/coordinate/datacenters", nil, &results); err != nil {
+		return
+	}
+
+	var origin []nodeCoordinates
+	for _, res := range results {
+		if res.Datacenter == from {
+			origin = append(origin, res.Coordinates...)
+		}
+	}
+
+	seen := make(map[string]bool, len(results))
+	distances = make([]DatacenterDistance, 0, len(results))
+
+	for _, res := range results {
+		// Datacenters may be listed once per network area.
+		if seen[res.Datacenter] {
+			continue
+		}
+		seen[res.Datacenter] = true
+
+		d := DatacenterDistance{Datacenter: res.Datacenter}
+
+		if res.Datacenter == from {
+			d.Known = true
+		} else {
+			d.RTT, d.Known = medianDistance(origin, res.Coordinates)
+		}
+
+		distances = append(distances, d)
+	}
+
+	sort.SliceStable(distances, func(i, j int) bool {
+		a, b := distances[i], distances[j]
+		switch {
+		case a.Datacenter == from:
+			return b.Datacenter != from
+		case b.Datacenter == from:
+			return false
+		case a.Known != b.Known:
+			return a.Known
+		default:
+			return a.RTT < b.RTT
+		}
+	})
+
+	return
+}
+
+// datacenterCoordinates is the representation of items returned by the
+// /v1/coordinate/datacenters endpoint.
+type datacenterCoordinates struct {
+	Datacenter  string
+	AreaID      string
+	Coordinates []nodeCoordinates
+}
+
+// medianDistance returns the median of the distances between all pairs of
+// nodes of a and b, which is how consul estimates distances between
+// datacenters.
+func medianDistance(a []nodeCoordinates, b []nodeCoordinates) (time.Duration, bool) {
+	if len(a) == 0 || len(b) == 0 {
+		return 0, false
+	}
+
+	rtts := make([]time.Duration, 0, len(a)*len(b))
+
+	for _, x := range a {
+		for _, y := range b {
+			rtts = append(rtts, Distance(x.Coord, y.Coord))
+		}
+	}
+
+	sort.Slice(rtts, func(i, j int) bool { return rtts[i] < rtts[j] })
+	return rtts[len(rtts)/2], true
+}
+
+// DatacenterFailover is a Lookuper which resolves services in the local
+// datacenter first, then in the nearest other datacenters, until one of them
+// returns endpoints. It brings the "try local, then nearest" semantics of
+// consul prepared queries to any lookuper.
+//
+// Lookups made with a context carrying a datacenter set by
+// ContextWithDatacenter are only made in that datacenter.
+//
+// DatacenterFailover values are safe to use concurrently from multiple
+// goroutines, the fields must not be modified after the first lookup.
+type DatacenterFailover struct {
+	// The lookuper used to resolve services in each datacenter, which must
+	// honor the datacenter set on contexts by ContextWithDatacenter, like
+	// Resolver does. If nil, DefaultResolver is used.
+	Resolver Lookuper
+
+	// The client used to discover datacenters and their coordinates. If nil,
+	// DefaultClient is used.
+	Client *Client
+
+	// The datacenters to try, in order. If empty, the datacenter of the client
+	// (or of the agent if the client has none) is tried first, followed by
+	// the other datacenters sorted by estimated round trip time.
+	Datacenters []string
+
+	// The maximum number of datacenters tried by each lookup, including the
+	// local datacenter. Zero means no limit.
+	MaxDatacenters int
+
+	// How long the list of discovered datacenters is cached. Defaults to 1
+	// minute.
+	CacheTimeout time.Duration
+
+	// Cached list of discovered datacenters.
+	discovered cachedValue
+}
+
+// LookupService satisfies the Lookuper interface.
+func (f *DatacenterFailover) LookupService(ctx context.Context, name string) ([]Endpoint, error) {
+	resolver := lookuperOrDefault(f.Resolver, DefaultResolver)
+
+	if dc, _ := ctx.Value(DatacenterKey).(string); len(dc) != 0 {
+		return resolver.LookupService(ctx, name)
+	}
+
+	datacenters, err := f.datacenters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if max := f.MaxDatacenters; max > 0 && len(datacenters) > max {
+		datacenters = datacenters[:max]
+	}
+
+	var found bool
+	var lastErr error
+
+	for _, dc := range datacenters {
+		endpoints, err := resolver.LookupService(ContextWithDatacenter(ctx, dc), name)
+
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			lastErr = fmt.Errorf("consul: resolving %s in %s: %w", name, dc, err)
+		case len(endpoints) != 0:
+			return endpoints, nil
+		default:
+			found = true
+		}
+	}
+
+	if found {
+		// The service has no endpoints in any of the datacenters that could
+		// be reached, which is not an error.
+		return nil, nil
+	}
+
+	return nil, lastErr
+}
+
+// Order returns the list of datacenters that lookups are tried in.
+func (f *DatacenterFailover) Order(ctx context.Context) ([]string, error) {
+	datacenters, err := f.datacenters(ctx)
+	return append([]string(nil), datacenters...), err
+}
+
+func (f *DatacenterFailover) datacenters(ctx context.Context) ([]string, error) {
+	if len(f.Datacenters) != 0 {
+		return f.Datacenters, nil
+	}
+
+	now := time.Now()
+	exp := now.Add(f.cacheTimeout())
+
+	val, err := f.discovered.lookup(now, exp, func() (interface{}, error) {
+		return f.discover(ctx)
+	}, func(err error) {
+		f.client().handleError(fmt.Errorf("consul: refreshing the list of datacenters: %w", err))
+	})
+
+	datacenters, _ := val.([]string)
+	return datacenters, err
+}
+
+func (f *DatacenterFailover) discover(ctx context.Context) ([]string, error) {
+	client := f.client()
+	local := client.Datacenter
+
+	if len(local) == 0 {
+		dc, err := (&Agent{Client: client}).Datacenter(ctx)
+		if err != nil {
+			return nil, err
+		}
+		local = dc
+	}
+
+	distances, err := (&Tomography{Client: client}).DatacenterDistances(ctx, local)
+	if err != nil {
+		return nil, err
+	}
+
+	datacenters := make([]string, 0, len(distances)+1)
+	if len(distances) == 0 || distances[0].Datacenter != local {
+		datacenters = append(datacenters, local)
+	}
+
+	for _, d := range distances {
+		datacenters = append(datacenters, d.Datacenter)
+	}
+
+	return datacenters, nil
+}
+
+func (f *DatacenterFailover) client() *Client {
+	if client := f.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+func (f *DatacenterFailover) cacheTimeout() time.Duration {
+	if cacheTimeout := f.CacheTimeout; cacheTimeout != 0 {
+		return cacheTimeout
+	}
+	return 1 * time.Minute
+}
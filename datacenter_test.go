@@ -0,0 +1,151 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDatacenterDistances(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/coordinate/datacenters" {
+			t.Error("unexpected request:", req.URL.Path)
+		}
+		json.NewEncoder(res).Encode([]datacenterCoordinates{
+			{Datacenter: "dc3", Coordinates: []nodeCoordinates{
+				{Node: "s3", Coord: Coordinates{Vec: [8]float64{0.030}}},
+			}},
+			{Datacenter: "dc1", Coordinates: []nodeCoordinates{
+				{Node: "s1a", Coord: Coordinates{}},
+				{Node: "s1b", Coord: Coordinates{Vec: [8]float64{0.002}}},
+			}},
+			{Datacenter: "dc4"},
+			{Datacenter: "dc2", Coordinates: []nodeCoordinates{
+				{Node: "s2", Coord: Coordinates{Vec: [8]float64{0.010}}},
+			}},
+		})
+	})
+	defer server.Close()
+
+	distances, err := (&Tomography{Client: client}).DatacenterDistances(context.Background(), "dc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(distances, []DatacenterDistance{
+		{Datacenter: "dc1", Known: true},
+		{Datacenter: "dc2", RTT: 10 * time.Millisecond, Known: true},
+		{Datacenter: "dc3", RTT: 30 * time.Millisecond, Known: true},
+		{Datacenter: "dc4"},
+	}) {
+		t.Errorf("bad distances: %+v", distances)
+	}
+}
+
+func TestDatacenterFailover(t *testing.T) {
+	var discoveries int32
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/agent/self":
+			json.NewEncoder(res).Encode(map[string]interface{}{
+				"Config": map[string]string{"Datacenter": "dc1"},
+			})
+
+		case "/v1/coordinate/datacenters":
+			atomic.AddInt32(&discoveries, 1)
+			json.NewEncoder(res).Encode([]datacenterCoordinates{
+				{Datacenter: "dc3", Coordinates: []nodeCoordinates{{Coord: Coordinates{Vec: [8]float64{0.030}}}}},
+				{Datacenter: "dc2", Coordinates: []nodeCoordinates{{Coord: Coordinates{Vec: [8]float64{0.010}}}}},
+				{Datacenter: "dc1", Coordinates: []nodeCoordinates{{}}},
+			})
+
+		case "/v1/health/service/web":
+			switch dc := req.URL.Query().Get("dc"); dc {
+			case "dc1":
+				json.NewEncoder(res).Encode([]ServiceEntry{})
+			case "dc2":
+				res.WriteHeader(http.StatusInternalServerError)
+			case "dc3":
+				json.NewEncoder(res).Encode([]ServiceEntry{{
+					Node:    Node{Node: "node-3", Address: "10.0.3.1"},
+					Service: ServiceInstance{ID: "web-3", Service: "web", Port: 80},
+				}})
+			default:
+				t.Error("unexpected datacenter:", dc)
+			}
+
+		case "/v1/health/service/api":
+			json.NewEncoder(res).Encode([]ServiceEntry{})
+
+		default:
+			t.Error("unexpected request:", req.URL.Path)
+		}
+	})
+	defer server.Close()
+
+	client.Datacenter = ""
+	failover := &DatacenterFailover{
+		Resolver: &Resolver{Client: client, Cache: &ResolverCache{}},
+		Client:   client,
+	}
+
+	ctx := context.Background()
+
+	order, err := failover.Order(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(order, []string{"dc1", "dc2", "dc3"}) {
+		t.Error("bad datacenter order:", order)
+	}
+
+	t.Run("falls back to the nearest datacenter with endpoints", func(t *testing.T) {
+		endpoints, err := failover.LookupService(ctx, "web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(endpoints) != 1 || endpoints[0].ID != "web-3" {
+			t.Errorf("bad endpoints: %+v", endpoints)
+		}
+	})
+
+	t.Run("the datacenter set on the context is not overridden", func(t *testing.T) {
+		endpoints, err := failover.LookupService(ContextWithDatacenter(ctx, "dc1"), "web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(endpoints) != 0 {
+			t.Errorf("bad endpoints: %+v", endpoints)
+		}
+	})
+
+	t.Run("no endpoints in any datacenter", func(t *testing.T) {
+		endpoints, err := failover.LookupService(ctx, "api")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(endpoints) != 0 {
+			t.Errorf("bad endpoints: %+v", endpoints)
+		}
+	})
+
+	t.Run("limited number of datacenters", func(t *testing.T) {
+		limited := &DatacenterFailover{
+			Resolver:       failover.Resolver,
+			Datacenters:    []string{"dc2", "dc3"},
+			MaxDatacenters: 1,
+		}
+		if _, err := limited.LookupService(ctx, "web"); err == nil {
+			t.Error("expected an error resolving the service in dc2 only")
+		}
+	})
+
+	if n := atomic.LoadInt32(&discoveries); n != 1 {
+		t.Error("the list of datacenters was not cached:", n)
+	}
+}
@@ -0,0 +1,131 @@
+package consul
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// debugBodyLimit is the maximum number of bytes of request and response bodies
+// written to the logs in debug mode.
+const debugBodyLimit = 4096
+
+// debugTransport is a http.RoundTripper which dumps the requests it sends and
+// the responses it receives to a logger.
+type debugTransport struct {
+	base   http.RoundTripper
+	logger Logger
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = b
+		req.Body = &buffer{bytes.NewReader(b)}
+	}
+
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start)
+
+	dump := &strings.Builder{}
+
+	if err != nil {
+		fmt.Fprintf(dump, "%s %s: %s (%s)\n", req.Method, redactURL(req.URL), err, elapsed)
+		dumpHeader(dump, "> ", req.Header)
+		dumpBody(dump, "> ", reqBody)
+		t.logger.Printf("%s", dump)
+		return nil, err
+	}
+
+	resBody, err := ioutil.ReadAll(io.LimitReader(res.Body, debugBodyLimit+1))
+	res.Body = &multiReadCloser{
+		Reader: io.MultiReader(bytes.NewReader(resBody), res.Body),
+		Closer: res.Body,
+	}
+
+	fmt.Fprintf(dump, "%s %s: %s (%s)\n", req.Method, redactURL(req.URL), res.Status, elapsed)
+	dumpHeader(dump, "> ", req.Header)
+	dumpBody(dump, "> ", reqBody)
+	dumpHeader(dump, "< ", res.Header)
+	dumpBody(dump, "< ", resBody)
+
+	if err != nil {
+		fmt.Fprintf(dump, "< (error reading the body: %s)\n", err)
+	}
+
+	t.logger.Printf("%s", dump)
+	return res, nil
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func dumpHeader(w io.Writer, prefix string, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range header[name] {
+			if isSecretHeader(name) {
+				value = "<redacted>"
+			}
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, name, value)
+		}
+	}
+}
+
+func dumpBody(w io.Writer, prefix string, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+
+	truncated := len(body) > debugBodyLimit
+	if truncated {
+		body = body[:debugBodyLimit]
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(string(body), "\n"), "\n") {
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+
+	if truncated {
+		fmt.Fprintf(w, "%s... (truncated to %d bytes)\n", prefix, debugBodyLimit)
+	}
+}
+
+func isSecretHeader(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "X-Consul-Token", "Authorization", "Proxy-Authorization":
+		return true
+	}
+	return false
+}
+
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	if _, ok := query["token"]; !ok {
+		return u.String()
+	}
+	query.Set("token", "redacted")
+	copy := *u
+	copy.RawQuery = query.Encode()
+	return copy.String()
+}
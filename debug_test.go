@@ -0,0 +1,73 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClientDebug(t *testing.T) {
+	large := strings.Repeat("A", 2*debugBodyLimit)
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Consul-Index", "42")
+		json.NewEncoder(res).Encode(large)
+	})
+	defer server.Close()
+
+	logger := &testLogger{}
+	client.Token = "secret-token"
+	client.Logger = logger
+	client.Debug = true
+
+	var recv string
+	if err := client.Put(context.Background(), "/v1/kv/key", Query{{"token", "secret-query"}}, "hello", &recv); err != nil {
+		t.Fatal(err)
+	}
+	if recv != large {
+		t.Error("the response body was altered by the debug transport")
+	}
+
+	dump := logger.String()
+
+	for _, expected := range []string{
+		"PUT http://",
+		"/v1/kv/key?",
+		"200 OK",
+		"> X-Consul-Token: <redacted>",
+		"> \"hello\"",
+		"< X-Consul-Index: 42",
+		"(truncated to 4096 bytes)",
+	} {
+		if !strings.Contains(dump, expected) {
+			t.Errorf("%q not found in the debug output:\n%s", expected, dump)
+		}
+	}
+
+	for _, secret := range []string{"secret-token", "secret-query"} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("%q was not redacted from the debug output", secret)
+		}
+	}
+}
+
+type testLogger struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, args ...interface{}) {
+	l.mutex.Lock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+	l.mutex.Unlock()
+}
+
+func (l *testLogger) String() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return strings.Join(l.lines, "\n")
+}
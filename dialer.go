@@ -26,6 +26,11 @@ type Dialer struct {
 	KeepAlive     time.Duration
 	BlacklistTTL  time.Duration
 	Resolver      *Resolver
+
+	// If not nil, Lookuper is used to resolve service names instead of
+	// Resolver, a StaticResolver for example. Endpoints which could not be
+	// reached are only blacklisted if it is a Resolver with a blacklist.
+	Lookuper Lookuper
 }
 
 // Dial establishes a network connection to address, using consul to resolve
@@ -65,12 +70,15 @@ func (d *Dialer) DialContext(ctx context.Context, network string, address string
 	var conn net.Conn
 	var err error
 
-	if addrs, err = resolver.LookupService(ctx, host); err != nil {
+	buf := getEndpoints()
+	if addrs, err = lookupServiceInto(ctx, resolver, host, *buf); err != nil {
+		endpointsPool.Put(buf)
 		return nil, err
 	}
+	defer putEndpoints(buf, addrs)
 
 	if len(addrs) == 0 {
-		return nil, fmt.Errorf("no addresses returned by the resolver for %s", host)
+		return nil, fmt.Errorf("%w for %s", ErrNoEndpoints, host)
 	}
 
 	for _, addr := range addrs {
@@ -80,15 +88,16 @@ func (d *Dialer) DialContext(ctx context.Context, network string, address string
 			break
 		}
 
-		if resolver.Blacklist != nil {
-			resolver.Blacklist.Blacklist(addr.Addr, time.Now().Add(d.blacklistTTL()))
-		}
+		blacklist(resolver, addr.Addr, time.Now().Add(d.blacklistTTL()))
 	}
 
 	return conn, err
 }
 
-func (d *Dialer) resolver() *Resolver {
+func (d *Dialer) resolver() Lookuper {
+	if lookuper := d.Lookuper; lookuper != nil {
+		return lookuper
+	}
 	if rslv := d.Resolver; rslv != nil {
 		return rslv
 	}
@@ -0,0 +1,18 @@
+// Package dnsconsul provides a small DNS server answering queries for service
+// names with the endpoints returned by a consul resolver.
+//
+// Programs which can't use the resolver directly, like processes written in
+// other languages running on the same host, can be pointed at the server to
+// get the same filtered and balanced view of services than Go programs:
+//
+//	server := &dnsconsul.Server{
+//		Addr:     "127.0.0.1:8053",
+//		Resolver: &consul.Resolver{OnlyPassing: true, Balancer: &consul.Shuffler{}},
+//	}
+//	log.Fatal(server.ListenAndServe(ctx))
+//
+// The server answers A and AAAA queries for <service>.service.<domain> with
+// the addresses of the service endpoints, and SRV queries with their ports and
+// addresses. RFC 2782 names like _<service>._tcp.service.<domain> are also
+// supported.
+package dnsconsul
@@ -0,0 +1,220 @@
+package dnsconsul
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// This file implements the subset of the DNS wire format (RFC 1035) needed by
+// the server: parsing queries, and building responses.
+
+const (
+	typeA    uint16 = 1
+	typeAAAA uint16 = 28
+	typeSRV  uint16 = 33
+	typeOPT  uint16 = 41
+
+	classIN uint16 = 1
+
+	rcodeSuccess        = 0
+	rcodeFormatError    = 1
+	rcodeServerFailure  = 2
+	rcodeNameError      = 3
+	rcodeNotImplemented = 4
+	rcodeRefused        = 5
+
+	headerSize = 12
+
+	// The maximum size of messages sent over UDP to clients which don't
+	// advertise a larger size with EDNS.
+	minUDPSize = 512
+
+	// The offset of the question name in messages, used as compression
+	// pointer by the records answering the question.
+	questionPointer = 0xC000 | headerSize
+)
+
+var errMalformedQuery = errors.New("dnsconsul: malformed query")
+
+// query is a parsed DNS query, the server only answers queries with a single
+// question.
+type query struct {
+	id      uint16
+	flags   uint16
+	name    string // lower case, fully qualified
+	qname   []byte // question name in wire format
+	qtype   uint16
+	qclass  uint16
+	opcode  int
+	udpSize int
+}
+
+func parseQuery(b []byte) (q query, err error) {
+	if len(b) < headerSize {
+		err = errMalformedQuery
+		return
+	}
+
+	q.id = binary.BigEndian.Uint16(b[0:])
+	q.flags = binary.BigEndian.Uint16(b[2:])
+	q.opcode = int(q.flags>>11) & 0xF
+	q.udpSize = minUDPSize
+
+	if q.flags&0x8000 != 0 || binary.BigEndian.Uint16(b[4:]) != 1 {
+		err = errMalformedQuery
+		return
+	}
+
+	i := headerSize
+	labels := []string{}
+
+	for {
+		if i >= len(b) {
+			err = errMalformedQuery
+			return
+		}
+		n := int(b[i])
+		i++
+		if n == 0 {
+			break
+		}
+		// Compression pointers are not expected in questions.
+		if n > 63 || i+n > len(b) {
+			err = errMalformedQuery
+			return
+		}
+		labels = append(labels, strings.ToLower(string(b[i:i+n])))
+		i += n
+	}
+
+	if i+4 > len(b) {
+		err = errMalformedQuery
+		return
+	}
+
+	q.qname = b[headerSize:i]
+	q.name = strings.Join(labels, ".") + "."
+	q.qtype = binary.BigEndian.Uint16(b[i:])
+	q.qclass = binary.BigEndian.Uint16(b[i+2:])
+	i += 4
+
+	// Clients advertise the size of the UDP messages they accept in the OPT
+	// pseudo-record of the additional section (RFC 6891), which is the only
+	// record expected after the question.
+	if binary.BigEndian.Uint16(b[10:]) != 0 && i+11 <= len(b) && b[i] == 0 {
+		if binary.BigEndian.Uint16(b[i+1:]) == typeOPT {
+			if size := int(binary.BigEndian.Uint16(b[i+3:])); size > minUDPSize {
+				q.udpSize = size
+			}
+		}
+	}
+
+	return
+}
+
+// response builds the DNS response to a query.
+type response struct {
+	q          query
+	rcode      int
+	answers    [][]byte
+	additional [][]byte
+	truncated  bool
+}
+
+// record returns a resource record in wire format, name is a wire format name
+// or nil to point at the question name.
+func record(name []byte, rtype uint16, ttl uint32, data []byte) []byte {
+	b := make([]byte, 0, len(name)+12+len(data))
+	if name == nil {
+		b = appendUint16(b, questionPointer)
+	} else {
+		b = append(b, name...)
+	}
+	b = appendUint16(b, rtype)
+	b = appendUint16(b, classIN)
+	b = appendUint32(b, ttl)
+	b = appendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// encodeName returns the wire format of a fully qualified domain name.
+func encodeName(name string) []byte {
+	b := make([]byte, 0, len(name)+1)
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 {
+			continue
+		}
+		if len(label) > 63 {
+			label = label[:63]
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// encode returns the wire format of the response, dropping records that don't
+// fit in maxSize bytes. The truncation flag is set if answers were dropped.
+func (r *response) encode(maxSize int) []byte {
+	b := make([]byte, headerSize, minUDPSize)
+	b = append(b, r.q.qname...)
+	b = appendUint16(b, r.q.qtype)
+	b = appendUint16(b, r.q.qclass)
+
+	answers := 0
+	for _, rr := range r.answers {
+		if len(b)+len(rr) > maxSize {
+			r.truncated = true
+			break
+		}
+		b = append(b, rr...)
+		answers++
+	}
+
+	additional := 0
+	if !r.truncated {
+		for _, rr := range r.additional {
+			if len(b)+len(rr) > maxSize {
+				break
+			}
+			b = append(b, rr...)
+			additional++
+		}
+	}
+
+	// QR (response), AA (authoritative), the opcode and RD (recursion
+	// desired) of the query, then TC (truncated) and the response code.
+	flags := uint16(0x8000|0x0400) | r.q.flags&0x7900 | uint16(r.rcode)
+	if r.truncated {
+		flags |= 0x0200
+	}
+
+	binary.BigEndian.PutUint16(b[0:], r.q.id)
+	binary.BigEndian.PutUint16(b[2:], flags)
+	binary.BigEndian.PutUint16(b[4:], 1)
+	binary.BigEndian.PutUint16(b[6:], uint16(answers))
+	binary.BigEndian.PutUint16(b[8:], 0)
+	binary.BigEndian.PutUint16(b[10:], uint16(additional))
+	return b
+}
+
+// errorResponse returns a response carrying only a response code, for queries
+// which could not be parsed.
+func errorResponse(b []byte, rcode int) []byte {
+	if len(b) < 2 {
+		return nil
+	}
+	res := make([]byte, headerSize)
+	copy(res, b[:2])
+	binary.BigEndian.PutUint16(res[2:], 0x8000|uint16(rcode))
+	return res
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
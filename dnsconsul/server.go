@@ -0,0 +1,422 @@
+package dnsconsul
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+const (
+	// DefaultAddr is the address that servers listen on when none was set.
+	DefaultAddr = "127.0.0.1:8053"
+
+	// DefaultDomain is the domain served by servers when none was set.
+	DefaultDomain = "consul."
+
+	// DefaultTimeout is the maximum time spent resolving a query when the
+	// server has no timeout set.
+	DefaultTimeout = 2 * time.Second
+)
+
+// A Server is a DNS server answering queries for service names with endpoints
+// returned by a resolver.
+//
+// Servers serve the following names, where <domain> is the server domain:
+//
+//	<service>.service.<domain>       A, AAAA and SRV records of the service
+//	_<service>._tcp.service.<domain> same as above (RFC 2782)
+//	<hex-ip>.addr.<domain>           A or AAAA record of a SRV target
+//
+// Records are returned in the order of the endpoints returned by the resolver,
+// so the filters and balancer configured on the resolver apply. SRV records
+// carry this order in their priority, and point at addr targets which are also
+// resolved in the additional section of responses.
+//
+// Server values are safe to use concurrently from multiple goroutines, the
+// fields must not be modified after the server started serving queries.
+type Server struct {
+	// The network address that ListenAndServe listens on for both UDP and
+	// TCP queries. If empty, DefaultAddr is used.
+	Addr string
+
+	// The domain that the server is authoritative for, queries outside of
+	// this domain are refused. If empty, DefaultDomain is used.
+	Domain string
+
+	// The resolver used to lookup services. If nil, consul.DefaultResolver
+	// is used.
+	Resolver consul.Lookuper
+
+	// The time to live of the records returned by the server. The default
+	// zero value prevents clients from caching responses, so they follow the
+	// decisions of the resolver's balancer on every query.
+	TTL time.Duration
+
+	// The maximum time spent resolving a query, if zero DefaultTimeout is
+	// used.
+	Timeout time.Duration
+}
+
+// ListenAndServe listens on s.Addr for UDP and TCP queries, and serves them
+// until ctx is canceled or an error occurs.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	addr := s.Addr
+	if len(addr) == 0 {
+		addr = DefaultAddr
+	}
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	lstn, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer lstn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, 2)
+	go func() { errs <- s.Serve(ctx, conn) }()
+	go func() { errs <- s.ServeTCP(ctx, lstn) }()
+
+	err = <-errs
+	cancel()
+	<-errs
+	return err
+}
+
+// Serve answers the UDP queries received on conn until ctx is canceled or an
+// error occurs. Serve closes conn when it returns.
+//
+// When ctx is canceled, Serve returns ctx.Err().
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn) error {
+	defer closeOnCancel(ctx, conn)()
+	buf := make([]byte, 65536)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return err
+		}
+
+		msg := append([]byte(nil), buf[:n]...)
+
+		go func() {
+			if res := s.handle(ctx, msg, udpSize(msg)); res != nil {
+				conn.WriteTo(res, addr)
+			}
+		}()
+	}
+}
+
+// ServeTCP answers the TCP queries received on the connections accepted by
+// lstn until ctx is canceled or an error occurs. ServeTCP closes lstn when it
+// returns.
+//
+// When ctx is canceled, ServeTCP returns ctx.Err().
+func (s *Server) ServeTCP(ctx context.Context, lstn net.Listener) error {
+	defer closeOnCancel(ctx, lstn)()
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+
+	for {
+		conn, err := lstn.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer closeOnCancel(ctx, conn)()
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	size := make([]byte, 2)
+
+	for {
+		// Idle connections are closed after a while so clients which don't
+		// close them don't hold resources on the server (RFC 7766).
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return
+		}
+
+		msg := make([]byte, binary.BigEndian.Uint16(size))
+
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			return
+		}
+
+		res := s.handle(ctx, msg, 65535)
+		if res == nil {
+			return
+		}
+
+		if _, err := conn.Write(append(appendUint16(nil, uint16(len(res))), res...)); err != nil {
+			return
+		}
+	}
+}
+
+func closeOnCancel(ctx context.Context, c io.Closer) (stop func()) {
+	done := make(chan struct{})
+	exit := make(chan struct{})
+
+	go func() {
+		defer close(exit)
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		c.Close()
+	}()
+
+	return func() { close(done); <-exit }
+}
+
+func udpSize(msg []byte) int {
+	q, err := parseQuery(msg)
+	if err != nil {
+		return minUDPSize
+	}
+	return q.udpSize
+}
+
+// handle returns the response to the query in msg, truncated to fit in
+// maxSize bytes, or nil if the message should be ignored.
+func (s *Server) handle(ctx context.Context, msg []byte, maxSize int) []byte {
+	q, err := parseQuery(msg)
+	if err != nil {
+		if len(msg) >= headerSize && msg[2]&0x80 != 0 {
+			return nil // never answer responses
+		}
+		return errorResponse(msg, rcodeFormatError)
+	}
+
+	r := &response{q: q}
+
+	switch {
+	case q.opcode != 0:
+		r.rcode = rcodeNotImplemented
+	case q.qclass != classIN:
+		r.rcode = rcodeRefused
+	default:
+		s.answer(ctx, r)
+	}
+
+	return r.encode(maxSize)
+}
+
+func (s *Server) answer(ctx context.Context, r *response) {
+	domain := s.domain()
+
+	if r.q.name != domain && !strings.HasSuffix(r.q.name, "."+domain) {
+		r.rcode = rcodeRefused
+		return
+	}
+
+	labels := strings.Split(strings.TrimSuffix(r.q.name, domain), ".")
+	labels = labels[:len(labels)-1] // empty label before the domain
+
+	switch {
+	case len(labels) == 2 && labels[1] == "addr":
+		s.answerAddr(r, labels[0])
+
+	case len(labels) == 2 && labels[1] == "service":
+		s.answerService(ctx, r, labels[0])
+
+	case len(labels) == 3 && labels[2] == "service" && strings.HasPrefix(labels[0], "_") && strings.HasPrefix(labels[1], "_"):
+		s.answerService(ctx, r, labels[0][1:])
+
+	default:
+		r.rcode = rcodeNameError
+	}
+}
+
+func (s *Server) answerAddr(r *response, name string) {
+	b, err := hex.DecodeString(name)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		r.rcode = rcodeNameError
+		return
+	}
+
+	if rr := s.addrRecord(nil, net.IP(b), r.q.qtype); rr != nil {
+		r.answers = append(r.answers, rr)
+	}
+}
+
+func (s *Server) answerService(ctx context.Context, r *response, name string) {
+	if len(name) == 0 {
+		r.rcode = rcodeNameError
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout())
+	defer cancel()
+
+	endpoints, err := s.resolver().LookupService(ctx, name)
+	if err != nil {
+		r.rcode = rcodeServerFailure
+		return
+	}
+
+	ips := make([]net.IP, 0, len(endpoints))
+	ports := make([]uint16, 0, len(endpoints))
+
+	for _, endpoint := range endpoints {
+		if ip, port, ok := splitAddr(endpoint.Addr); ok {
+			ips = append(ips, ip)
+			ports = append(ports, port)
+		}
+	}
+
+	if len(ips) == 0 {
+		r.rcode = rcodeNameError
+		return
+	}
+
+	switch r.q.qtype {
+	case typeA, typeAAAA:
+		seen := make(map[string]bool, len(ips))
+
+		// Duplicate records are not allowed in a record set (RFC 2181), only
+		// the first occurrence of addresses shared by endpoints is kept.
+		for _, ip := range ips {
+			if key := string(ip); !seen[key] {
+				seen[key] = true
+				if rr := s.addrRecord(nil, ip, r.q.qtype); rr != nil {
+					r.answers = append(r.answers, rr)
+				}
+			}
+		}
+
+	case typeSRV:
+		ttl := s.ttl()
+
+		for i, ip := range ips {
+			target := encodeName(hex.EncodeToString(ipBytes(ip)) + ".addr." + s.domain())
+
+			data := make([]byte, 0, 6+len(target))
+			data = appendUint16(data, priority(i))
+			data = appendUint16(data, 1)
+			data = appendUint16(data, ports[i])
+			data = append(data, target...)
+
+			r.answers = append(r.answers, record(nil, typeSRV, ttl, data))
+			r.additional = append(r.additional, s.addrRecord(target, ip, 0))
+		}
+	}
+}
+
+// addrRecord returns an A or AAAA record for ip, or nil if the record type
+// does not match qtype. A qtype of zero matches both record types.
+func (s *Server) addrRecord(name []byte, ip net.IP, qtype uint16) []byte {
+	b := ipBytes(ip)
+	rtype := typeA
+
+	if len(b) == net.IPv6len {
+		rtype = typeAAAA
+	}
+
+	if qtype != 0 && qtype != rtype {
+		return nil
+	}
+
+	return record(name, rtype, s.ttl(), b)
+}
+
+func (s *Server) domain() string {
+	domain := strings.ToLower(s.Domain)
+	if len(domain) == 0 {
+		domain = DefaultDomain
+	}
+	if !strings.HasSuffix(domain, ".") {
+		domain += "."
+	}
+	return domain
+}
+
+func (s *Server) resolver() consul.Lookuper {
+	if s.Resolver != nil {
+		return s.Resolver
+	}
+	return consul.DefaultResolver
+}
+
+func (s *Server) ttl() uint32 {
+	if s.TTL <= 0 {
+		return 0
+	}
+	return uint32(s.TTL / time.Second)
+}
+
+func (s *Server) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultTimeout
+}
+
+// splitAddr returns the IP and port of an endpoint address, endpoints which
+// have a host name instead of an IP address cannot be served and are skipped.
+func splitAddr(addr net.Addr) (ip net.IP, port uint16, ok bool) {
+	if addr == nil {
+		return
+	}
+
+	h, p, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return
+	}
+
+	n, err := strconv.ParseUint(p, 10, 16)
+	if err != nil {
+		return
+	}
+
+	if ip = net.ParseIP(h); ip == nil {
+		return
+	}
+
+	return ip, uint16(n), true
+}
+
+func ipBytes(ip net.IP) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+// priority returns the SRV priority of the endpoint at index i, clients try the
+// targets with the lowest priority first.
+func priority(i int) uint16 {
+	if i > 65535 {
+		return 65535
+	}
+	return uint16(i)
+}
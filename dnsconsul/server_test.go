@@ -0,0 +1,259 @@
+package dnsconsul
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestServer(t *testing.T) {
+	rslv := &consul.StaticResolver{
+		Endpoints: map[string][]consul.Endpoint{
+			"web": consul.StaticEndpoints("10.0.0.1:80", "10.0.0.2:8080", "[fe80::1]:443"),
+			"api": consul.StaticEndpoints("10.0.0.3:80"),
+		},
+		Updates: []consul.StaticUpdate{
+			{Name: "broken", Err: errors.New("lookup failed")},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lstn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &Server{Resolver: rslv}
+	udpErr := make(chan error, 1)
+	tcpErr := make(chan error, 1)
+	go func() { udpErr <- server.Serve(ctx, conn) }()
+	go func() { tcpErr <- server.ServeTCP(ctx, lstn) }()
+
+	for _, network := range []string{"udp", "tcp"} {
+		addr := conn.LocalAddr().String()
+		if network == "tcp" {
+			addr = lstn.Addr().String()
+		}
+
+		dnsResolver := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}
+
+		t.Run(network, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+
+			t.Run("host", func(t *testing.T) {
+				addrs, err := dnsResolver.LookupHost(ctx, "web.service.consul.")
+				if err != nil {
+					t.Fatal(err)
+				}
+				sort.Strings(addrs)
+				if !reflect.DeepEqual(addrs, []string{"10.0.0.1", "10.0.0.2", "fe80::1"}) {
+					t.Error("bad addresses:", addrs)
+				}
+			})
+
+			t.Run("srv", func(t *testing.T) {
+				_, srvs, err := dnsResolver.LookupSRV(ctx, "api", "tcp", "service.consul.")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(srvs) != 1 || srvs[0].Target != "0a000003.addr.consul." || srvs[0].Port != 80 {
+					t.Errorf("bad SRV records: %+v", srvs)
+				}
+
+				addrs, err := dnsResolver.LookupHost(ctx, srvs[0].Target)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(addrs, []string{"10.0.0.3"}) {
+					t.Error("bad target addresses:", addrs)
+				}
+			})
+
+			t.Run("not-found", func(t *testing.T) {
+				_, err := dnsResolver.LookupHost(ctx, "nope.service.consul.")
+				if e, ok := err.(*net.DNSError); !ok || !e.IsNotFound {
+					t.Error("bad error:", err)
+				}
+			})
+
+			t.Run("failure", func(t *testing.T) {
+				_, err := dnsResolver.LookupHost(ctx, "broken.service.consul.")
+				if e, ok := err.(*net.DNSError); !ok || e.IsNotFound {
+					t.Error("bad error:", err)
+				}
+			})
+		})
+	}
+
+	cancel()
+
+	if err := <-udpErr; err != context.Canceled {
+		t.Error("bad UDP server error:", err)
+	}
+	if err := <-tcpErr; err != context.Canceled {
+		t.Error("bad TCP server error:", err)
+	}
+}
+
+func TestServerHandle(t *testing.T) {
+	endpoints := make([]string, 100)
+	for i := range endpoints {
+		endpoints[i] = fmt.Sprintf("10.0.%d.%d:%d", i/256, i%256, 1000+i)
+	}
+
+	server := &Server{
+		Domain: "Example.Local",
+		TTL:    10 * time.Second,
+		Resolver: &consul.StaticResolver{
+			Endpoints: map[string][]consul.Endpoint{
+				"web": consul.StaticEndpoints(endpoints...),
+			},
+		},
+	}
+
+	tests := []struct {
+		scenario  string
+		name      string
+		qtype     uint16
+		udpSize   int
+		rcode     int
+		answers   int
+		truncated bool
+	}{
+		{
+			scenario: "answers A queries",
+			name:     "web.service.example.local.",
+			qtype:    typeA,
+			udpSize:  4096,
+			answers:  100,
+		},
+		{
+			scenario: "returns no records for AAAA queries of IPv4 endpoints",
+			name:     "web.service.example.local.",
+			qtype:    typeAAAA,
+			udpSize:  4096,
+		},
+		{
+			scenario: "matches names case-insensitively",
+			name:     "WEB.Service.EXAMPLE.local.",
+			qtype:    typeA,
+			udpSize:  4096,
+			answers:  100,
+		},
+		{
+			scenario:  "truncates responses to the default UDP size",
+			name:      "web.service.example.local.",
+			qtype:     typeA,
+			answers:   (minUDPSize - headerSize - 31) / 16,
+			truncated: true,
+		},
+		{
+			scenario:  "truncates SRV responses",
+			name:      "_web._tcp.service.example.local.",
+			qtype:     typeSRV,
+			udpSize:   1024,
+			answers:   (1024 - headerSize - 37) / 47,
+			truncated: true,
+		},
+		{
+			scenario: "refuses names outside of the domain",
+			name:     "web.service.consul.",
+			qtype:    typeA,
+			rcode:    rcodeRefused,
+		},
+		{
+			scenario: "returns NXDOMAIN for unknown names",
+			name:     "web.node.example.local.",
+			qtype:    typeA,
+			rcode:    rcodeNameError,
+		},
+		{
+			scenario: "returns NXDOMAIN for invalid addresses",
+			name:     "0a00.addr.example.local.",
+			qtype:    typeA,
+			rcode:    rcodeNameError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			msg := makeQuery(1234, test.name, test.qtype, test.udpSize)
+
+			size := minUDPSize
+			if test.udpSize != 0 {
+				size = test.udpSize
+			}
+
+			res := server.handle(context.Background(), msg, udpSize(msg))
+			if len(res) > size {
+				t.Errorf("response too large: %d > %d", len(res), size)
+			}
+
+			flags := binary.BigEndian.Uint16(res[2:])
+
+			if id := binary.BigEndian.Uint16(res); id != 1234 {
+				t.Error("bad response ID:", id)
+			}
+			if rcode := int(flags & 0xF); rcode != test.rcode {
+				t.Error("bad response code:", rcode)
+			}
+			if truncated := flags&0x0200 != 0; truncated != test.truncated {
+				t.Error("bad truncation flag:", truncated)
+			}
+			if answers := int(binary.BigEndian.Uint16(res[6:])); answers != test.answers {
+				t.Error("bad number of answers:", answers)
+			}
+		})
+	}
+
+	t.Run("ignores responses", func(t *testing.T) {
+		msg := makeQuery(1234, "web.service.example.local.", typeA, 0)
+		msg[2] |= 0x80
+
+		if res := server.handle(context.Background(), msg, minUDPSize); res != nil {
+			t.Error("unexpected response:", res)
+		}
+	})
+}
+
+func makeQuery(id uint16, name string, qtype uint16, udpSize int) []byte {
+	b := make([]byte, headerSize)
+	binary.BigEndian.PutUint16(b[0:], id)
+	binary.BigEndian.PutUint16(b[2:], 0x0100) // RD
+	binary.BigEndian.PutUint16(b[4:], 1)
+	b = append(b, encodeName(name)...)
+	b = appendUint16(b, qtype)
+	b = appendUint16(b, classIN)
+
+	if udpSize != 0 {
+		binary.BigEndian.PutUint16(b[10:], 1)
+		b = append(b, 0)
+		b = appendUint16(b, typeOPT)
+		b = appendUint16(b, uint16(udpSize))
+		b = appendUint32(b, 0)
+		b = appendUint16(b, 0)
+	}
+
+	return b
+}
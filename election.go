@@ -0,0 +1,222 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// An Election runs tasks on a single instance of a program at a time, by
+// having the instances campaign for leadership on a lock key. This is the
+// common pattern of programs running periodic jobs from multiple hosts for
+// availability, but which must not run the jobs concurrently.
+type Election struct {
+	// The lock manager used to campaign for leadership. If nil, DefaultLocker
+	// is used.
+	Locks LockManager
+
+	// The time to wait before campaigning again after the task failed or
+	// leadership was lost. The delay doubles on each consecutive failure, up
+	// to MaxBackoff. Defaults to 1s and 1m.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// The clock used to wait between campaigns. If nil, DefaultClock is used.
+	Clock Clock
+
+	// OnElected is called when leadership on key was won, before the task is
+	// started.
+	OnElected func(key string)
+
+	// OnResigned is called when leadership on key ended, after the task
+	// returned and the lock was released. err is nil if the task returned
+	// without errors or Resign was called, or the reason why leadership ended,
+	// which is Unlocked if it was lost.
+	//
+	// For each key, every call to OnElected is followed by a call to
+	// OnResigned, and the hooks are never called concurrently.
+	OnResigned func(key string, err error)
+
+	mutex sync.Mutex
+	terms map[*electionTerm]struct{}
+}
+
+// electionTerm represents the leadership of an election on a key.
+type electionTerm struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	resigned int32
+}
+
+// RunWhenLeader campaigns for leadership on key, and calls fn when it was
+// elected. The context passed to fn is canceled when leadership is lost, in
+// which case its Err method returns Unlocked, or when Resign is called.
+//
+// When fn returns, leadership is released (which is how fn resigns), and the
+// election campaigns again, after a backoff delay if fn returned an error or
+// leadership was lost. RunWhenLeader only returns when ctx is canceled, with
+// the error of ctx.
+//
+// When leadership is handed over by calling Resign, the election waits for
+// InitialBackoff before campaigning again, so other instances can be elected.
+//
+// The errors returned by fn, and the errors of campaigns, are reported to the
+// error handler of the client of Locks if it is a Locker, or to
+// DefaultErrorHandler otherwise.
+func (e *Election) RunWhenLeader(ctx context.Context, key string, fn func(context.Context) error) error {
+	for attempt := 0; ; {
+		resigned, err := e.campaign(ctx, key, fn)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err == nil {
+			attempt = 0
+		} else {
+			e.handleError(fmt.Errorf("consul: leader task for %s: %w", key, err))
+			attempt++
+		}
+
+		backoff := e.backoff(attempt)
+		if resigned && attempt == 0 {
+			backoff = e.backoff(1)
+		}
+
+		if Sleep(ctx, e.Clock, backoff) != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// Resign hands over the leadership held by the election on all keys: the
+// contexts passed to the tasks are canceled, and the locks are released as
+// soon as the tasks return. Locks released explicitly are not subject to the
+// lock delay of consul sessions, other instances can be elected right away.
+//
+// The method blocks until the OnResigned hooks returned, or ctx is canceled.
+func (e *Election) Resign(ctx context.Context) error {
+	e.mutex.Lock()
+	terms := make([]*electionTerm, 0, len(e.terms))
+	for term := range e.terms {
+		atomic.StoreInt32(&term.resigned, 1)
+		term.cancel()
+		terms = append(terms, term)
+	}
+	e.mutex.Unlock()
+
+	for _, term := range terms {
+		select {
+		case <-term.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (e *Election) campaign(ctx context.Context, key string, fn func(context.Context) error) (resigned bool, err error) {
+	lockCtx, unlock := e.locks().Lock(ctx, key)
+
+	if err = lockCtx.Err(); err != nil {
+		unlock()
+		return
+	}
+
+	leaderCtx, cancel := context.WithCancel(lockCtx)
+	term := &electionTerm{cancel: cancel, done: make(chan struct{})}
+
+	e.mutex.Lock()
+	if e.terms == nil {
+		e.terms = make(map[*electionTerm]struct{})
+	}
+	e.terms[term] = struct{}{}
+	e.mutex.Unlock()
+
+	defer func() {
+		e.mutex.Lock()
+		delete(e.terms, term)
+		e.mutex.Unlock()
+		close(term.done)
+	}()
+
+	if e.OnElected != nil {
+		e.OnElected(key)
+	}
+
+	err = fn(leaderCtx)
+	resigned = atomic.LoadInt32(&term.resigned) != 0
+
+	switch {
+	case resigned && errors.Is(err, context.Canceled):
+		// Tasks commonly return the error of their context when it is
+		// canceled, which is expected when resigning.
+		err = nil
+	case err == nil && !resigned:
+		err = lockCtx.Err()
+	}
+
+	cancel()
+	unlock()
+
+	if e.OnResigned != nil {
+		e.OnResigned(key, err)
+	}
+	return
+}
+
+func (e *Election) locks() LockManager {
+	if locks := e.Locks; locks != nil {
+		return locks
+	}
+	return DefaultLocker
+}
+
+func (e *Election) handleError(err error) {
+	if locker, ok := e.locks().(*Locker); ok {
+		locker.client().handleError(err)
+	} else {
+		handleError(err)
+	}
+}
+
+// backoff returns the delay before the next campaign, attempt is the number of
+// consecutive failures.
+func (e *Election) backoff(attempt int) time.Duration {
+	if attempt == 0 {
+		return 0
+	}
+
+	initialBackoff := e.InitialBackoff
+	if initialBackoff <= 0 {
+		initialBackoff = 1 * time.Second
+	}
+
+	maxBackoff := e.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 1 * time.Minute
+	}
+
+	backoff := initialBackoff
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	return backoff
+}
+
+// DefaultElection is the election used by RunWhenLeader.
+var DefaultElection = &Election{}
+
+// RunWhenLeader calls DefaultElection.RunWhenLeader.
+func RunWhenLeader(ctx context.Context, key string, fn func(context.Context) error) error {
+	return DefaultElection.RunWhenLeader(ctx, key, fn)
+}
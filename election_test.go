@@ -0,0 +1,269 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestElection(t *testing.T) {
+	t.Run("only one instance runs the task at a time", func(t *testing.T) {
+		locks := &testLockManager{}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		running := int32(0)
+		runs := int32(0)
+		errs := make(chan error, 3)
+
+		for i := 0; i != 3; i++ {
+			go func() {
+				errs <- (&Election{Locks: locks}).RunWhenLeader(ctx, "leader", func(ctx context.Context) error {
+					if atomic.AddInt32(&running, 1) != 1 {
+						t.Error("multiple leaders are running the task")
+					}
+					time.Sleep(time.Millisecond)
+					atomic.AddInt32(&running, -1)
+
+					if atomic.AddInt32(&runs, 1) == 10 {
+						cancel()
+					}
+					return nil
+				})
+			}()
+		}
+
+		for i := 0; i != 3; i++ {
+			if err := <-errs; err != context.Canceled {
+				t.Error("bad error:", err)
+			}
+		}
+	})
+
+	t.Run("leadership loss cancels the task and campaigns again", func(t *testing.T) {
+		locks := &testLockManager{}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		elected := make(chan struct{})
+		errs := make(chan error, 1)
+
+		go func() {
+			errs <- (&Election{Locks: locks, InitialBackoff: time.Millisecond}).RunWhenLeader(ctx, "leader", func(ctx context.Context) error {
+				elected <- struct{}{}
+				<-ctx.Done()
+				return nil
+			})
+		}()
+
+		<-elected
+		locks.revoke()
+
+		select {
+		case <-elected:
+		case <-time.After(time.Second):
+			t.Fatal("the election did not campaign again")
+		}
+
+		cancel()
+		if err := <-errs; err != context.Canceled {
+			t.Error("bad error:", err)
+		}
+	})
+
+	t.Run("task errors are reported and retried with backoff", func(t *testing.T) {
+		reported := make(chan error, 10)
+		defer func(handler func(error)) { DefaultErrorHandler = handler }(DefaultErrorHandler)
+		DefaultErrorHandler = func(err error) { reported <- err }
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		calls := int32(0)
+		err := (&Election{Locks: &testLockManager{}, InitialBackoff: time.Millisecond}).RunWhenLeader(ctx, "leader", func(ctx context.Context) error {
+			if atomic.AddInt32(&calls, 1) == 3 {
+				cancel()
+			}
+			return errors.New("oops")
+		})
+
+		if err != context.Canceled {
+			t.Error("bad error:", err)
+		}
+
+		if len(reported) != 2 {
+			t.Error("bad number of reported errors:", len(reported))
+		}
+		if err := <-reported; err.Error() != "consul: leader task for leader: oops" {
+			t.Error("bad reported error:", err)
+		}
+	})
+}
+
+func TestElectionResign(t *testing.T) {
+	locks := &testLockManager{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mutex sync.Mutex
+	var events []string
+
+	record := func(event string) {
+		mutex.Lock()
+		events = append(events, event)
+		mutex.Unlock()
+	}
+
+	elected := make(chan string, 2)
+	errs := make(chan error, 2)
+
+	e1 := &Election{
+		Locks:          locks,
+		InitialBackoff: time.Minute,
+		OnElected:      func(key string) { record("elected " + key) },
+		OnResigned:     func(key string, err error) { record(fmt.Sprintf("resigned %s %v", key, err)) },
+	}
+
+	go func() {
+		errs <- e1.RunWhenLeader(ctx, "leader", func(ctx context.Context) error {
+			elected <- "e1"
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	if leader := <-elected; leader != "e1" {
+		t.Fatal("bad leader:", leader)
+	}
+
+	go func() {
+		errs <- (&Election{Locks: locks}).RunWhenLeader(ctx, "leader", func(ctx context.Context) error {
+			elected <- "e2"
+			<-ctx.Done()
+			return nil
+		})
+	}()
+
+	if err := e1.Resign(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	if fmt.Sprint(events) != "[elected leader resigned leader <nil>]" {
+		t.Error("bad hook calls:", events)
+	}
+	mutex.Unlock()
+
+	select {
+	case leader := <-elected:
+		if leader != "e2" {
+			t.Error("leadership was not handed over:", leader)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("leadership was not handed over")
+	}
+
+	cancel()
+	for i := 0; i != 2; i++ {
+		if err := <-errs; err != context.Canceled {
+			t.Error("bad error:", err)
+		}
+	}
+}
+
+func TestElectionErrorHandler(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		http.Error(res, "oops", http.StatusInternalServerError)
+	})
+	defer server.Close()
+
+	reported := make(chan error, 10)
+	client.ErrorHandler = func(err error) {
+		select {
+		case reported <- err:
+		default:
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	e := &Election{Locks: &Locker{Client: client}, InitialBackoff: time.Millisecond}
+	go e.RunWhenLeader(ctx, "leader", func(ctx context.Context) error { return nil })
+
+	for {
+		select {
+		case err := <-reported:
+			// Errors of the client may be reported as well, the test waits for
+			// the error of the campaign.
+			if strings.HasPrefix(err.Error(), "consul: leader task for leader: ") {
+				return
+			}
+		case <-ctx.Done():
+			t.Fatal("the error of the campaign was not reported to the error handler of the client")
+		}
+	}
+}
+
+func TestElectionBackoff(t *testing.T) {
+	e := &Election{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	for attempt, backoff := range []time.Duration{0, 1 * time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if d := e.backoff(attempt); d != backoff {
+			t.Errorf("bad backoff for attempt %d: %s != %s", attempt, d, backoff)
+		}
+	}
+}
+
+// testLockManager is a minimal in-memory LockManager holding a single lock,
+// regardless of the keys.
+type testLockManager struct {
+	mutex  sync.Mutex
+	held   bool
+	cancel context.CancelFunc
+}
+
+func (l *testLockManager) Lock(ctx context.Context, keys ...string) (context.Context, context.CancelFunc) {
+	for {
+		if lockCtx, unlock := l.TryLockOne(ctx, keys...); lockCtx.Err() == nil {
+			return lockCtx, unlock
+		}
+		if err := Sleep(ctx, nil, 100*time.Microsecond); err != nil {
+			return errorContext(ctx, err)
+		}
+	}
+}
+
+func (l *testLockManager) TryLockOne(ctx context.Context, keys ...string) (context.Context, context.CancelFunc) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.held {
+		return errorContext(ctx, ErrLockHeld)
+	}
+
+	lockCtx, cancel := context.WithCancel(ctx)
+	l.held, l.cancel = true, cancel
+	once := sync.Once{}
+
+	return lockCtx, func() {
+		once.Do(func() {
+			cancel()
+			l.mutex.Lock()
+			l.held = false
+			l.mutex.Unlock()
+		})
+	}
+}
+
+func (l *testLockManager) revoke() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.cancel()
+}
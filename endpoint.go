@@ -33,25 +33,37 @@ type Endpoint struct {
 	// available).
 	RTT time.Duration
 
+	// Health is the aggregated status of the health checks of the endpoint
+	// (see AggregateHealth), it may be empty if the information wasn't
+	// available.
+	Health HealthStatus
+
+	// Weight is the share of traffic that the endpoint should receive relative
+	// to the other endpoints of the service, it is zero unless set by a
+	// balancer like WeightExtractor.
+	Weight float64
+
 	// This field is used internally by the weighted shuffle algorithms,
 	// embedding it in the endpoint value itself makes the algorithm more
 	// efficient since it doesn't need to allocate a separate slice to do the
 	// shuffling and then map the results back to the endpoint list.
 	expWeight float64
-
-	// TODO: add health check information?
 }
 
 // Shuffle is a sorting function that randomly rearranges the list of endpoints.
 func Shuffle(list []Endpoint) {
 	rng := randers.Get().(*rand.Rand)
+	ShuffleWith(list, rng)
+	randers.Put(rng)
+}
 
+// ShuffleWith is like Shuffle but draws random numbers from rng, which makes
+// the order of endpoints reproducible when rng was created with a fixed seed.
+func ShuffleWith(list []Endpoint, rng *rand.Rand) {
 	for i := range list {
 		j := rng.Intn(i + 1)
 		list[i], list[j] = list[j], list[i]
 	}
-
-	randers.Put(rng)
 }
 
 // WeightedShuffleOnRTT is a sorting function that randomly rearranges the list
@@ -66,13 +78,19 @@ func WeightedShuffleOnRTT(list []Endpoint) {
 // of the list.
 func WeightedShuffle(list []Endpoint, weightOf func(Endpoint) float64) {
 	rng := randers.Get().(*rand.Rand)
+	WeightedShuffleWith(list, weightOf, rng)
+	randers.Put(rng)
+}
 
+// WeightedShuffleWith is like WeightedShuffle but draws random numbers from rng,
+// which makes the order of endpoints reproducible when rng was created with a
+// fixed seed.
+func WeightedShuffleWith(list []Endpoint, weightOf func(Endpoint) float64, rng *rand.Rand) {
 	for i := range list {
 		list[i].expWeight = weightOf(list[i]) * rng.ExpFloat64()
 	}
 
 	sort.Sort(byExpWeight(list))
-	randers.Put(rng)
 }
 
 // WeightRTT returns the weight of the given endpoint based on it's RTT value.
@@ -99,6 +117,17 @@ func WeightRTT(endpoint Endpoint) float64 {
 	return math.MaxFloat64
 }
 
+// InverseWeight returns the inverse of the Weight of the given endpoint, it is
+// intended to be used as the WeightOf function of a WeightedShuffler, which
+// places endpoints with a low value first. Endpoints with no weight get the
+// same share of traffic as endpoints with a weight of 1.
+func InverseWeight(endpoint Endpoint) float64 {
+	if endpoint.Weight > 0 {
+		return 1 / endpoint.Weight
+	}
+	return 1
+}
+
 type byExpWeight []Endpoint
 
 func (list byExpWeight) Len() int {
@@ -113,6 +142,24 @@ func (list byExpWeight) Swap(i int, j int) {
 	list[i], list[j] = list[j], list[i]
 }
 
+// sourceRand serializes the use of a random number generator created from a
+// source, since neither are safe to use concurrently.
+type sourceRand struct {
+	mutex sync.Mutex
+	rng   *rand.Rand
+}
+
+func (r *sourceRand) do(source rand.Source, f func(*rand.Rand)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.rng == nil {
+		r.rng = rand.New(source)
+	}
+
+	f(r.rng)
+}
+
 var randers = sync.Pool{
 	New: func() interface{} {
 		return rand.New(rand.NewSource(time.Now().UnixNano()))
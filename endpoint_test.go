@@ -46,6 +46,56 @@ func TestWeightedShuffleOnRTT(t *testing.T) {
 	}
 }
 
+func TestShuffleReproducible(t *testing.T) {
+	tests := []struct {
+		scenario string
+		shuffle  func([]Endpoint, *rand.Rand)
+		balancer func(int64) Balancer
+	}{
+		{
+			scenario: "Shuffle",
+			shuffle:  ShuffleWith,
+			balancer: func(seed int64) Balancer {
+				return &Shuffler{Source: rand.NewSource(seed)}
+			},
+		},
+		{
+			scenario: "WeightedShuffle",
+			shuffle: func(list []Endpoint, rng *rand.Rand) {
+				WeightedShuffleWith(list, WeightRTT, rng)
+			},
+			balancer: func(seed int64) Balancer {
+				return &WeightedShuffler{WeightOf: WeightRTT, Source: rand.NewSource(seed)}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			list1 := generateTestEndpoints(100)
+			list2 := generateTestEndpoints(100)
+
+			test.shuffle(list1, rand.New(rand.NewSource(42)))
+			test.shuffle(list2, rand.New(rand.NewSource(42)))
+
+			if !reflect.DeepEqual(list1, list2) {
+				t.Error("shuffling with the same seed produced different orders")
+			}
+
+			b1, b2 := test.balancer(42), test.balancer(42)
+
+			for i := 0; i != 3; i++ {
+				list1 = b1.Balance("service", generateTestEndpoints(100))
+				list2 = b2.Balance("service", generateTestEndpoints(100))
+
+				if !reflect.DeepEqual(list1, list2) {
+					t.Error("balancers with the same seed produced different orders")
+				}
+			}
+		})
+	}
+}
+
 func TestDistribution(t *testing.T) {
 	t.Run("Shuffle", func(t *testing.T) { testDistribution(t, Shuffle) })
 	t.Run("WeightedShuffleOnRTT", func(t *testing.T) { testDistribution(t, WeightedShuffleOnRTT) })
@@ -0,0 +1,18 @@
+// Package envoyconsul provides extensions to integrate consul service discovery
+// with the Envoy proxy.
+//
+// The package renders the endpoints returned by a consul resolver as Envoy
+// ClusterLoadAssignment resources, in the JSON representation of the xDS v3
+// API, and serves them on the REST endpoint discovery service (EDS) endpoint.
+// Envoy can be configured to fetch the endpoints of its clusters from a program
+// using this package with a cluster configuration like:
+//
+//	eds_cluster_config:
+//	  eds_config:
+//	    resource_api_version: V3
+//	    api_config_source:
+//	      api_type: REST
+//	      transport_api_version: V3
+//	      cluster_names: [eds]
+//	      refresh_delay: 5s
+package envoyconsul
@@ -0,0 +1,286 @@
+package envoyconsul
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+const (
+	// ClusterLoadAssignmentType is the type URL of the resources returned by
+	// the endpoint discovery service.
+	ClusterLoadAssignmentType = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+
+	// EndpointsPath is the path of the REST endpoint discovery service.
+	EndpointsPath = "/v3/discovery:endpoints"
+)
+
+// ClusterLoadAssignment is the JSON representation of the Envoy resource of
+// the same name, which lists the endpoints of a cluster. See
+// https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/endpoint/v3/endpoint.proto
+type ClusterLoadAssignment struct {
+	Type        string                `json:"@type,omitempty"`
+	ClusterName string                `json:"cluster_name"`
+	Endpoints   []LocalityLbEndpoints `json:"endpoints"`
+}
+
+// LocalityLbEndpoints is a group of endpoints of a cluster in the same
+// locality.
+type LocalityLbEndpoints struct {
+	Locality    *Locality    `json:"locality,omitempty"`
+	LbEndpoints []LbEndpoint `json:"lb_endpoints"`
+}
+
+// Locality identifies where endpoints run.
+type Locality struct {
+	Region  string `json:"region,omitempty"`
+	Zone    string `json:"zone,omitempty"`
+	SubZone string `json:"sub_zone,omitempty"`
+}
+
+// LbEndpoint is an endpoint of a cluster.
+type LbEndpoint struct {
+	Endpoint            Endpoint `json:"endpoint"`
+	HealthStatus        string   `json:"health_status,omitempty"`
+	LoadBalancingWeight uint32   `json:"load_balancing_weight,omitempty"`
+}
+
+// Endpoint carries the address of an endpoint.
+type Endpoint struct {
+	Address  Address `json:"address"`
+	Hostname string  `json:"hostname,omitempty"`
+}
+
+// Address is a network address.
+type Address struct {
+	SocketAddress SocketAddress `json:"socket_address"`
+}
+
+// SocketAddress is a TCP address.
+type SocketAddress struct {
+	Address   string `json:"address"`
+	PortValue int    `json:"port_value"`
+}
+
+// Envoy health statuses, see
+// https://www.envoyproxy.io/docs/envoy/latest/api-v3/config/core/v3/health_check.proto#enum-config-core-v3-healthstatus
+const (
+	Unknown   = "UNKNOWN"
+	Healthy   = "HEALTHY"
+	Unhealthy = "UNHEALTHY"
+	Draining  = "DRAINING"
+	Degraded  = "DEGRADED"
+)
+
+// HealthStatus converts a consul health status to the Envoy equivalent.
+// Endpoints in maintenance are draining, since consul expects them to go away.
+func HealthStatus(status consul.HealthStatus) string {
+	switch status {
+	case consul.Passing:
+		return Healthy
+	case consul.Warning:
+		return Degraded
+	case consul.Critical:
+		return Unhealthy
+	case consul.Maintenance:
+		return Draining
+	default:
+		return Unknown
+	}
+}
+
+// An Exporter renders the endpoints of services returned by a resolver as
+// Envoy ClusterLoadAssignment resources. The cluster names of the resources
+// are the service names.
+type Exporter struct {
+	// The resolver used to lookup services. If nil, consul.DefaultResolver is
+	// used.
+	Resolver consul.Lookuper
+
+	// If not nil, endpoints are grouped by the localities returned by this
+	// function, which Envoy may use for zone-aware routing. Otherwise, all
+	// endpoints are in a single group with no locality.
+	Locality func(consul.Endpoint) Locality
+
+	// If not nil, sets the load balancing weight of endpoints, zero values
+	// are omitted. Envoy defaults to equal weights.
+	Weight func(consul.Endpoint) uint32
+}
+
+// ClusterLoadAssignment resolves service and returns its endpoints as an Envoy
+// resource. Endpoints which don't have an IP address are skipped, since Envoy
+// does not resolve host names of EDS endpoints.
+//
+// The filters of the resolver apply, but not the order of its balancer, the
+// endpoints are sorted by locality and address.
+func (e *Exporter) ClusterLoadAssignment(ctx context.Context, service string) (cla ClusterLoadAssignment, err error) {
+	endpoints, err := e.resolver().LookupService(ctx, service)
+	if err != nil {
+		return
+	}
+
+	cla.Type = ClusterLoadAssignmentType
+	cla.ClusterName = service
+	cla.Endpoints = []LocalityLbEndpoints{}
+
+	groups := map[Locality]int{}
+
+	for _, endpoint := range endpoints {
+		if endpoint.Addr == nil {
+			continue
+		}
+
+		host, port, err := net.SplitHostPort(endpoint.Addr.String())
+		if err != nil || net.ParseIP(host) == nil {
+			continue
+		}
+
+		portValue, err := strconv.Atoi(port)
+		if err != nil {
+			continue
+		}
+
+		lbEndpoint := LbEndpoint{
+			Endpoint: Endpoint{
+				Address:  Address{SocketAddress{Address: host, PortValue: portValue}},
+				Hostname: endpoint.Node,
+			},
+			HealthStatus: HealthStatus(endpoint.Health),
+		}
+
+		if e.Weight != nil {
+			lbEndpoint.LoadBalancingWeight = e.Weight(endpoint)
+		}
+
+		var locality Locality
+		if e.Locality != nil {
+			locality = e.Locality(endpoint)
+		}
+
+		i, ok := groups[locality]
+		if !ok {
+			i = len(cla.Endpoints)
+			groups[locality] = i
+			group := LocalityLbEndpoints{LbEndpoints: []LbEndpoint{}}
+			if locality != (Locality{}) {
+				l := locality
+				group.Locality = &l
+			}
+			cla.Endpoints = append(cla.Endpoints, group)
+		}
+
+		cla.Endpoints[i].LbEndpoints = append(cla.Endpoints[i].LbEndpoints, lbEndpoint)
+	}
+
+	// Envoy balances the endpoints itself, they are sorted so the resources
+	// only change when the set of endpoints changes, even if the resolver
+	// shuffles them.
+	sort.Slice(cla.Endpoints, func(i, j int) bool {
+		return localityLess(cla.Endpoints[i].Locality, cla.Endpoints[j].Locality)
+	})
+
+	for _, group := range cla.Endpoints {
+		sort.Slice(group.LbEndpoints, func(i, j int) bool {
+			a := group.LbEndpoints[i].Endpoint.Address.SocketAddress
+			b := group.LbEndpoints[j].Endpoint.Address.SocketAddress
+			return a.Address < b.Address || (a.Address == b.Address && a.PortValue < b.PortValue)
+		})
+	}
+
+	return
+}
+
+func localityLess(a, b *Locality) bool {
+	switch {
+	case a == nil:
+		return b != nil
+	case b == nil:
+		return false
+	case a.Region != b.Region:
+		return a.Region < b.Region
+	case a.Zone != b.Zone:
+		return a.Zone < b.Zone
+	default:
+		return a.SubZone < b.SubZone
+	}
+}
+
+// DiscoveryRequest is the JSON representation of requests sent by Envoy to
+// the REST endpoint discovery service.
+type DiscoveryRequest struct {
+	VersionInfo   string   `json:"version_info,omitempty"`
+	ResourceNames []string `json:"resource_names,omitempty"`
+	TypeURL       string   `json:"type_url,omitempty"`
+}
+
+// DiscoveryResponse is the JSON representation of responses returned to Envoy
+// by the REST endpoint discovery service.
+type DiscoveryResponse struct {
+	VersionInfo string                  `json:"version_info"`
+	Resources   []ClusterLoadAssignment `json:"resources"`
+	TypeURL     string                  `json:"type_url"`
+}
+
+// ServeHTTP implements the REST endpoint discovery service, it is usually
+// installed on EndpointsPath. The handler resolves the services named in the
+// resource names of the requests, and responds with the version of the
+// resources, derived from their content, so Envoy only applies changes.
+func (e *Exporter) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		res.Header().Set("Allow", http.MethodPost)
+		http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var discoveryReq DiscoveryRequest
+	if err := json.NewDecoder(req.Body).Decode(&discoveryReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	discoveryRes := DiscoveryResponse{
+		Resources: make([]ClusterLoadAssignment, 0, len(discoveryReq.ResourceNames)),
+		TypeURL:   ClusterLoadAssignmentType,
+	}
+
+	for _, name := range discoveryReq.ResourceNames {
+		cla, err := e.ClusterLoadAssignment(req.Context(), name)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		discoveryRes.Resources = append(discoveryRes.Resources, cla)
+	}
+
+	b, err := json.Marshal(discoveryRes.Resources)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(b)
+	discoveryRes.VersionInfo = hex.EncodeToString(sum[:8])
+
+	if discoveryRes.VersionInfo == discoveryReq.VersionInfo {
+		// The REST protocol uses 304 to signal that Envoy has the latest
+		// version of the resources.
+		res.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(discoveryRes)
+}
+
+func (e *Exporter) resolver() consul.Lookuper {
+	if e.Resolver != nil {
+		return e.Resolver
+	}
+	return consul.DefaultResolver
+}
@@ -0,0 +1,98 @@
+package envoyconsul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestExporterClusterLoadAssignment(t *testing.T) {
+	endpoints := consul.StaticEndpoints("10.0.0.2:80", "10.0.0.1:80", "10.0.0.3:8080", "db.local:5432")
+	endpoints[0].Meta = map[string]string{"zone": "us-west-2a"}
+	endpoints[0].Health = consul.Passing
+	endpoints[1].Meta = map[string]string{"zone": "us-west-2b"}
+	endpoints[1].Health = consul.Maintenance
+	endpoints[2].Meta = map[string]string{"zone": "us-west-2a"}
+	endpoints[2].Node = "node-3"
+
+	exporter := &Exporter{
+		Resolver: &consul.StaticResolver{Endpoints: map[string][]consul.Endpoint{"web": endpoints}},
+		Locality: func(e consul.Endpoint) Locality { return Locality{Zone: e.Meta["zone"]} },
+		Weight:   func(e consul.Endpoint) uint32 { return 10 },
+	}
+
+	cla, err := exporter.ClusterLoadAssignment(context.Background(), "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := json.Marshal(cla)
+	expected := `{"@type":"type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment","cluster_name":"web","endpoints":[` +
+		`{"locality":{"zone":"us-west-2a"},"lb_endpoints":[` +
+		`{"endpoint":{"address":{"socket_address":{"address":"10.0.0.2","port_value":80}}},"health_status":"HEALTHY","load_balancing_weight":10},` +
+		`{"endpoint":{"address":{"socket_address":{"address":"10.0.0.3","port_value":8080}},"hostname":"node-3"},"health_status":"UNKNOWN","load_balancing_weight":10}]},` +
+		`{"locality":{"zone":"us-west-2b"},"lb_endpoints":[` +
+		`{"endpoint":{"address":{"socket_address":{"address":"10.0.0.1","port_value":80}}},"health_status":"DRAINING","load_balancing_weight":10}]}]}`
+
+	if string(b) != expected {
+		t.Error("bad cluster load assignment:")
+		t.Log("expected:", expected)
+		t.Log("found:   ", string(b))
+	}
+}
+
+func TestExporterServeHTTP(t *testing.T) {
+	exporter := &Exporter{
+		Resolver: &consul.StaticResolver{Endpoints: map[string][]consul.Endpoint{
+			"web": consul.StaticEndpoints("10.0.0.1:80"),
+		}},
+	}
+
+	discover := func(req DiscoveryRequest) (*httptest.ResponseRecorder, DiscoveryResponse) {
+		b, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		exporter.ServeHTTP(rec, httptest.NewRequest("POST", EndpointsPath, bytes.NewReader(b)))
+
+		var res DiscoveryResponse
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec, res
+	}
+
+	rec, res := discover(DiscoveryRequest{ResourceNames: []string{"web", "api"}})
+	if rec.Code != http.StatusOK {
+		t.Fatal("bad status:", rec.Code)
+	}
+
+	if res.TypeURL != ClusterLoadAssignmentType || len(res.VersionInfo) == 0 {
+		t.Errorf("bad discovery response: %+v", res)
+	}
+
+	names := []string{}
+	for _, cla := range res.Resources {
+		names = append(names, cla.ClusterName)
+	}
+	if !reflect.DeepEqual(names, []string{"web", "api"}) {
+		t.Error("bad resources:", names)
+	}
+
+	rec, _ = discover(DiscoveryRequest{ResourceNames: []string{"web", "api"}, VersionInfo: res.VersionInfo})
+	if rec.Code != http.StatusNotModified {
+		t.Error("bad status for unchanged resources:", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	exporter.ServeHTTP(rec, httptest.NewRequest("GET", EndpointsPath, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Error("bad status for GET request:", rec.Code)
+	}
+}
@@ -1,31 +1,139 @@
 package consul
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 )
 
+var (
+	// ErrNotFound matches errors returned when the consul resource that a
+	// request was made for does not exist.
+	ErrNotFound = errors.New("consul: not found")
+
+	// ErrPermissionDenied matches errors returned when the ACL token used to
+	// send a request does not grant the permissions needed to perform it.
+	ErrPermissionDenied = errors.New("consul: permission denied")
+
+	// ErrNoEndpoints matches errors returned when resolving a service name did
+	// not produce any addresses to connect to.
+	ErrNoEndpoints = errors.New("no addresses returned by the resolver")
+
+	// ErrSessionExpired matches errors returned by session contexts when the
+	// session could not be renewed before its TTL expired, or was invalidated.
+	ErrSessionExpired = errors.New("consul: session expired")
+
+	// ErrLockHeld matches the errors returned by LockError when a lock could
+	// not be acquired because another session holds it.
+	ErrLockHeld = errors.New("consul: lock held by another session")
+)
+
+// DefaultErrorHandler is called with the errors occurring in background
+// goroutines, for clients and components which have no error handler. If nil,
+// the errors are discarded.
+//
+// The handler may be called concurrently from multiple goroutines, it must
+// not block.
+var DefaultErrorHandler func(error)
+
+// handleError passes err to the error handler of the client, or to
+// DefaultErrorHandler if the client has none.
+func (c *Client) handleError(err error) {
+	if handler := c.ErrorHandler; handler != nil {
+		handler(err)
+	} else {
+		handleError(err)
+	}
+}
+
+func handleError(err error) {
+	if handler := DefaultErrorHandler; handler != nil {
+		handler(err)
+	}
+}
+
 type httpError struct {
 	method     string
 	url        *url.URL
 	status     string
 	statusCode int
+	requestID  string
+	// The body of 409 Conflict responses, which consul uses to report the
+	// operations that failed in transactions.
+	body []byte
 }
 
-func newHTTPError(method string, u *url.URL, res *http.Response) error {
-	return &httpError{
+// maxConflictBodySize bounds the size of the response bodies retained in
+// errors.
+const maxConflictBodySize = 1 << 20
+
+func newHTTPError(method string, u *url.URL, requestID string, res *http.Response) error {
+	e := &httpError{
 		method:     method,
 		url:        u,
 		status:     res.Status,
 		statusCode: res.StatusCode,
+		requestID:  requestID,
 	}
+	if res.StatusCode == http.StatusConflict {
+		e.body, _ = ioutil.ReadAll(io.LimitReader(res.Body, maxConflictBodySize))
+	}
+	return e
 }
 
 func (e *httpError) Error() string {
+	if len(e.requestID) != 0 {
+		return fmt.Sprintf("%s %s: %s (request id %s)", e.method, e.url, e.status, e.requestID)
+	}
 	return fmt.Sprintf("%s %s: %s", e.method, e.url, e.status)
 }
 
 func (e *httpError) NotFound() bool {
 	return e.statusCode == http.StatusNotFound
 }
+
+// Is allows errors.Is to match HTTP errors against ErrNotFound and
+// ErrPermissionDenied.
+func (e *httpError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.statusCode == http.StatusNotFound
+	case ErrPermissionDenied:
+		return e.statusCode == http.StatusForbidden || e.statusCode == http.StatusUnauthorized
+	}
+	return false
+}
+
+// requestError carries the ID of the request which failed with err, when the
+// client sends request IDs.
+type requestError struct {
+	requestID string
+	err       error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error() + " (request id " + e.requestID + ")"
+}
+
+func (e *requestError) Unwrap() error { return e.err }
+
+// kindError associates an error with one of the sentinel errors of the package
+// so it can be matched with errors.Is, while retaining its message and the
+// error chain it wraps.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func withKind(kind error, err error) error {
+	return &kindError{kind: kind, err: err}
+}
+
+func (e *kindError) Error() string { return e.err.Error() }
+
+func (e *kindError) Unwrap() error { return e.err }
+
+func (e *kindError) Is(target error) bool { return target == e.kind }
@@ -0,0 +1,171 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPErrorIs(t *testing.T) {
+	tests := []struct {
+		status int
+		target error
+	}{
+		{status: http.StatusNotFound, target: ErrNotFound},
+		{status: http.StatusForbidden, target: ErrPermissionDenied},
+		{status: http.StatusUnauthorized, target: ErrPermissionDenied},
+	}
+
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+				res.WriteHeader(test.status)
+			})
+			defer server.Close()
+
+			err := client.Get(context.Background(), "/", nil, nil)
+			if !errors.Is(err, test.target) {
+				t.Errorf("%v does not match %v", err, test.target)
+			}
+			if errors.Is(err, ErrLockHeld) {
+				t.Errorf("%v matches %v", err, ErrLockHeld)
+			}
+		})
+	}
+}
+
+func TestSessionExpired(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/v1/session/create":
+			json.NewEncoder(res).Encode(map[string]string{"ID": "1234"})
+		case strings.HasPrefix(req.URL.Path, "/v1/session/renew/"):
+			res.WriteHeader(http.StatusNotFound)
+		default:
+			json.NewEncoder(res).Encode(nil)
+		}
+	})
+	defer server.Close()
+
+	ctx, cancel := WithSession(context.Background(), Session{
+		Client:    client,
+		LockDelay: time.Second,
+		TTL:       30 * time.Millisecond,
+	})
+	defer cancel()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the invalidated session was not detected")
+	}
+
+	if err := ctx.Err(); !errors.Is(err, ErrSessionExpired) || !errors.Is(err, ErrNotFound) {
+		t.Error("bad session error:", err)
+	}
+}
+
+func TestTryLockOneHeld(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/session/create":
+			json.NewEncoder(res).Encode(map[string]string{"ID": "1234"})
+		case "/v1/kv/held":
+			json.NewEncoder(res).Encode(false)
+		default:
+			json.NewEncoder(res).Encode(nil)
+		}
+	})
+	defer server.Close()
+
+	lock, unlock := (&Locker{Client: client, LockDelay: time.Second}).TryLockOne(context.Background(), "held")
+	defer unlock()
+
+	if err := lock.Err(); err != Unlocked {
+		t.Error("bad lock error:", err)
+	}
+	if err := LockError(lock); !errors.Is(err, ErrLockHeld) || !errors.Is(err, Unlocked) {
+		t.Error("bad lock error:", err)
+	}
+}
+
+func TestClientErrorHandler(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusInternalServerError)
+	})
+	defer server.Close()
+
+	errs := make(chan error, 10)
+	client.ErrorHandler = func(err error) { errs <- err }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &Watcher{Client: client, MaxAttempts: 2}
+	w.Watch(ctx, "key", func(_ []KeyData, err error) {
+		// The handler only receives the error after the retries.
+		cancel()
+	})
+
+	for i := 1; i <= 2; i++ {
+		select {
+		case err := <-errs:
+			if !strings.HasPrefix(err.Error(), "consul: watching /v1/kv/key (attempt ") {
+				t.Error("bad error:", err)
+			}
+		default:
+			t.Fatal("missing error of attempt", i)
+		}
+	}
+
+	select {
+	case err := <-errs:
+		t.Error("unexpected error:", err)
+	default:
+	}
+}
+
+func TestResolverCacheErrorHandler(t *testing.T) {
+	errs := make(chan error, 10)
+	clock := &manualClock{now: time.Unix(1e9, 0)}
+	cache := &ResolverCache{
+		Clock:        clock,
+		CacheTimeout: time.Minute,
+		ErrorHandler: func(err error) { errs <- err },
+	}
+
+	failure := errors.New("failure")
+	lookup := func(ctx context.Context, name string) ([]Endpoint, error) {
+		if clock.now.After(time.Unix(1e9, 0)) {
+			return nil, failure
+		}
+		return []Endpoint{{ID: "A"}}, nil
+	}
+
+	cache.LookupService(context.Background(), "service", lookup)
+	clock.now = clock.now.Add(55 * time.Second)
+
+	// The entry is close to expiring, it is refreshed but the error of the
+	// refresh must not replace the cached endpoints.
+	list, err := cache.LookupService(context.Background(), "service", lookup)
+	if err != nil || len(list) != 1 {
+		t.Error("bad lookup:", list, err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, failure) {
+			t.Error("bad error:", err)
+		}
+	default:
+		t.Error("the error of the refresh was not reported")
+	}
+
+	if list, err := cache.LookupService(context.Background(), "service", lookup); err != nil || len(list) != 1 {
+		t.Error("bad lookup after a failed refresh:", list, err)
+	}
+}
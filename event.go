@@ -0,0 +1,187 @@
+package consul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+)
+
+// Event is a representation of a consul user event, which follows the
+// structure documented at https://www.consul.io/api/event.html
+type Event struct {
+	// The event ID, this should not be set when firing an event, it is
+	// assigned by consul.
+	ID string
+
+	// The name of the event.
+	Name string
+
+	// An opaque payload carried by the event (optional).
+	Payload []byte
+
+	// Regular expressions used to restrict which nodes the event is delivered
+	// to, based on the node name, services registered on the node, and tags of
+	// those services (optional).
+	NodeFilter    string
+	ServiceFilter string
+	TagFilter     string
+
+	// Version and Lamport time of the event, set by consul.
+	Version int
+	LTime   uint64
+}
+
+// EventFilter is used to narrow the list of events returned when listing or
+// watching user events. Empty fields are ignored.
+type EventFilter struct {
+	Name    string
+	Node    string
+	Service string
+	Tag     string
+}
+
+func (f EventFilter) query() Query {
+	var query Query
+
+	if len(f.Name) != 0 {
+		query = append(query, Param{Name: "name", Value: f.Name})
+	}
+
+	if len(f.Node) != 0 {
+		query = append(query, Param{Name: "node", Value: f.Node})
+	}
+
+	if len(f.Service) != 0 {
+		query = append(query, Param{Name: "service", Value: f.Service})
+	}
+
+	if len(f.Tag) != 0 {
+		query = append(query, Param{Name: "tag", Value: f.Tag})
+	}
+
+	return query
+}
+
+// Events exposes methods to fire and list consul user events.
+type Events struct {
+	// The client used to send requests to the consul agent, which may be nil
+	// to indicate that a default client should be used.
+	Client *Client
+}
+
+// FireEvent fires a user event, returning it with the fields populated by
+// consul (like the event ID).
+func (e *Events) FireEvent(ctx context.Context, event Event) (Event, error) {
+	var query Query
+
+	if len(event.NodeFilter) != 0 {
+		query = append(query, Param{Name: "node", Value: event.NodeFilter})
+	}
+
+	if len(event.ServiceFilter) != 0 {
+		query = append(query, Param{Name: "service", Value: event.ServiceFilter})
+	}
+
+	if len(event.TagFilter) != 0 {
+		query = append(query, Param{Name: "tag", Value: event.TagFilter})
+	}
+
+	// The payload is sent as the raw body of the request, it must not be
+	// JSON-encoded.
+	_, res, err := e.client().call(ctx, "PUT", "/v1/event/fire/"+event.Name, query, &buffer{bytes.NewReader(event.Payload)})
+	if err != nil {
+		return event, err
+	}
+	defer res.Close()
+
+	var fired Event
+	if err := json.NewDecoder(res).Decode(&fired); err != nil {
+		return event, err
+	}
+
+	return fired, nil
+}
+
+// ListEvents returns the list of the most recent user events known to the
+// consul agent which match the given filter.
+func (e *Events) ListEvents(ctx context.Context, filter EventFilter) (events []Event, err error) {
+	err = e.client().Get(ctx, "/v1/event/list", filter.query(), &events)
+	return
+}
+
+func (e *Events) client() *Client {
+	if client := e.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+// DefaultEvents is an events endpoint configured to use the default client.
+var DefaultEvents = &Events{}
+
+// FireEvent is a helper function that delegates to the default events
+// endpoint.
+func FireEvent(ctx context.Context, event Event) (Event, error) {
+	return DefaultEvents.FireEvent(ctx, event)
+}
+
+// ListEvents is a helper function that delegates to the default events
+// endpoint.
+func ListEvents(ctx context.Context, filter EventFilter) ([]Event, error) {
+	return DefaultEvents.ListEvents(ctx, filter)
+}
+
+// EventsUpdate carries the result of a blocking query on the list of user
+// events.
+type EventsUpdate struct {
+	Events []Event
+	Err    error
+}
+
+// WatchEvents executes a long poll for user events matching the given filter.
+// The returned channel first receives the list of events already known to the
+// agent, then only the events that were fired since the previous update.
+// Errors are reported following the same rules than Watch.
+//
+// The channel is closed when ctx is canceled.
+func (w *Watcher) WatchEvents(ctx context.Context, filter EventFilter) <-chan EventsUpdate {
+	ch := make(chan EventsUpdate)
+	go func() {
+		defer close(ch)
+		seen := map[string]bool{}
+		w.watchQuery(ctx, "/v1/event/list", filter.query(),
+			func() interface{} { return &[]Event{} },
+			func(value interface{}, err error) {
+				u := EventsUpdate{Err: err}
+				if err == nil {
+					// The agent only retains a bounded list of the most recent
+					// events, remembering the IDs of the previous response is
+					// enough to detect which ones are new.
+					events := *value.(*[]Event)
+					ids := make(map[string]bool, len(events))
+					for _, event := range events {
+						if !seen[event.ID] {
+							u.Events = append(u.Events, event)
+						}
+						ids[event.ID] = true
+					}
+					seen = ids
+					if len(u.Events) == 0 {
+						return
+					}
+				}
+				select {
+				case ch <- u:
+				case <-ctx.Done():
+				}
+			},
+		)
+	}()
+	return ch
+}
+
+// WatchEvents is the package-level WatchEvents definition which is called on
+// DefaultWatcher.
+func WatchEvents(ctx context.Context, filter EventFilter) <-chan EventsUpdate {
+	return DefaultWatcher.WatchEvents(ctx, filter)
+}
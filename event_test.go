@@ -0,0 +1,119 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	t.Run("FireEvent", testEventsFire)
+	t.Run("ListEvents", testEventsList)
+	t.Run("WatchEvents", testEventsWatch)
+}
+
+func testEventsFire(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != "PUT" {
+			t.Error("bad method:", req.Method)
+		}
+		if req.URL.Path != "/v1/event/fire/deploy" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		if service := req.URL.Query().Get("service"); service != "api" {
+			t.Error("bad service filter:", service)
+		}
+		payload, _ := ioutil.ReadAll(req.Body)
+		json.NewEncoder(res).Encode(Event{
+			ID:            "1234",
+			Name:          "deploy",
+			Payload:       payload,
+			ServiceFilter: "api",
+			Version:       1,
+		})
+	})
+	defer server.Close()
+
+	events := &Events{Client: client}
+
+	event, err := events.FireEvent(context.Background(), Event{
+		Name:          "deploy",
+		Payload:       []byte("v1.2.3"),
+		ServiceFilter: "api",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != "1234" {
+		t.Error("bad event ID:", event.ID)
+	}
+	if string(event.Payload) != "v1.2.3" {
+		t.Error("bad event payload:", string(event.Payload))
+	}
+}
+
+func testEventsList(t *testing.T) {
+	list := []Event{{ID: "1", Name: "deploy"}, {ID: "2", Name: "deploy"}}
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/event/list" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		if name := req.URL.Query().Get("name"); name != "deploy" {
+			t.Error("bad name filter:", name)
+		}
+		json.NewEncoder(res).Encode(list)
+	})
+	defer server.Close()
+
+	events := &Events{Client: client}
+
+	found, err := events.ListEvents(context.Background(), EventFilter{Name: "deploy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found, list) {
+		t.Error("bad events:", found)
+	}
+}
+
+func testEventsWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		index, _ := strconv.Atoi(req.URL.Query().Get("index"))
+		index++
+		// Every response contains all events fired so far, the watch must
+		// only report the new ones.
+		list := make([]Event, index)
+		for i := range list {
+			list[i] = Event{ID: strconv.Itoa(i + 1), Name: "deploy"}
+		}
+		res.Header().Set("X-Consul-Index", strconv.Itoa(index))
+		json.NewEncoder(res).Encode(list)
+	})
+	defer server.Close()
+
+	w := &Watcher{Client: client, MaxAttempts: 1, MaxBackoff: 10 * time.Millisecond}
+	ch := w.WatchEvents(ctx, EventFilter{Name: "deploy"})
+
+	for i := 1; i <= 3; i++ {
+		u := <-ch
+		if u.Err != nil {
+			t.Fatal(u.Err)
+		}
+		if len(u.Events) != 1 || u.Events[0].ID != strconv.Itoa(i) {
+			t.Errorf("bad events at update %d: %v", i, u.Events)
+		}
+	}
+
+	cancel()
+	for range ch {
+	}
+}
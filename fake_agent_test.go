@@ -0,0 +1,37 @@
+package consul_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+	"github.com/segmentio/consul-go/consultest"
+)
+
+// newFakeAgent starts a fake consul agent which is closed when the test
+// completes, returning it with a context which expires if the test hangs.
+func newFakeAgent(t *testing.T) (*consultest.Agent, context.Context) {
+	agent := consultest.NewAgent()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+	t.Cleanup(func() {
+		cancel()
+		agent.Close()
+	})
+
+	return agent, ctx
+}
+
+// listKeys returns the keys stored under prefix in the key/value store of
+// agent.
+func listKeys(t *testing.T, agent *consultest.Agent, prefix string) (keys []string) {
+	t.Helper()
+
+	err := agent.Client().Get(context.Background(), "/v1/kv/"+prefix, consul.Query{{"keys", ""}}, &keys)
+	if err != nil && !errors.Is(err, consul.ErrNotFound) {
+		t.Fatal(err)
+	}
+	return
+}
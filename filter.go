@@ -0,0 +1,168 @@
+package consul
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Filter is a filter expression evaluated by consul to narrow the results of
+// queries, see https://www.consul.io/api/features/filtering.html
+//
+// Filters are usually built from selectors, which takes care of quoting values
+// and of combining expressions with the right precedence:
+//
+//	filter := consul.Selector("Service.Tags").Contains("primary").And(
+//		consul.Selector("Service.Meta").Key("version").Equal("v2"),
+//	)
+//
+// Since Filter is a string type, hand-written expressions may also be used
+// where a Filter is expected. The empty filter matches everything.
+type Filter string
+
+// Selector is the path to a field of the values that a filter is applied to,
+// for example "Service.Tags" or "Node.Meta".
+type Selector string
+
+// Key returns a selector for the given key of the map that s points to.
+func (s Selector) Key(key string) Selector {
+	if isFilterIdentifier(key) {
+		return s + Selector("."+key)
+	}
+	return s + Selector("["+strconv.Quote(key)+"]")
+}
+
+// Equal returns a filter matching values where s is equal to value.
+func (s Selector) Equal(value string) Filter {
+	return s.match("==", value)
+}
+
+// NotEqual returns a filter matching values where s is not equal to value.
+func (s Selector) NotEqual(value string) Filter {
+	return s.match("!=", value)
+}
+
+// Contains returns a filter matching values where the list or map that s
+// points to contains value.
+func (s Selector) Contains(value string) Filter {
+	return s.match("contains", value)
+}
+
+// NotContains returns a filter matching values where the list or map that s
+// points to does not contain value.
+func (s Selector) NotContains(value string) Filter {
+	return s.match("not contains", value)
+}
+
+// Matches returns a filter matching values where s matches the regular
+// expression pattern.
+func (s Selector) Matches(pattern string) Filter {
+	return s.match("matches", pattern)
+}
+
+// NotMatches returns a filter matching values where s does not match the
+// regular expression pattern.
+func (s Selector) NotMatches(pattern string) Filter {
+	return s.match("not matches", pattern)
+}
+
+// IsEmpty returns a filter matching values where s is empty.
+func (s Selector) IsEmpty() Filter {
+	return Filter(string(s) + " is empty")
+}
+
+// IsNotEmpty returns a filter matching values where s is not empty.
+func (s Selector) IsNotEmpty() Filter {
+	return Filter(string(s) + " is not empty")
+}
+
+func (s Selector) match(op string, value string) Filter {
+	return Filter(string(s) + " " + op + " " + strconv.Quote(value))
+}
+
+// And returns a filter matching values matched by f and all the others.
+// Empty filters are ignored.
+func (f Filter) And(others ...Filter) Filter {
+	return joinFilters("and", append([]Filter{f}, others...))
+}
+
+// Or returns a filter matching values matched by f or any of the others.
+// Empty filters are ignored.
+func (f Filter) Or(others ...Filter) Filter {
+	return joinFilters("or", append([]Filter{f}, others...))
+}
+
+// Not returns a filter matching values that f does not match. The negation of
+// the empty filter is the empty filter.
+func (f Filter) Not() Filter {
+	if len(f) == 0 {
+		return f
+	}
+	return "not (" + f + ")"
+}
+
+// String satisfies the fmt.Stringer interface.
+func (f Filter) String() string {
+	return string(f)
+}
+
+func joinFilters(op string, filters []Filter) Filter {
+	parts := make([]string, 0, len(filters))
+
+	for _, f := range filters {
+		if len(f) == 0 {
+			continue
+		}
+		// The "and" operator has a higher precedence than "or", so operands
+		// containing an "or" must be grouped when combined with "and". Operands
+		// containing an "and" are also grouped in "or" for readability.
+		if op == "and" && f.hasTopLevel("or") || op == "or" && f.hasTopLevel("and") {
+			parts = append(parts, "("+string(f)+")")
+		} else {
+			parts = append(parts, string(f))
+		}
+	}
+
+	return Filter(strings.Join(parts, " "+op+" "))
+}
+
+// hasTopLevel returns true if f contains the given keyword outside of quoted
+// strings and parentheses.
+func (f Filter) hasTopLevel(keyword string) bool {
+	s := string(f)
+	depth := 0
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '`':
+			// Skip quoted strings, honoring backslash escapes in double-quoted
+			// strings.
+			for i++; i < len(s) && s[i] != c; i++ {
+				if c == '"' && s[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ' ':
+			if depth == 0 && strings.HasPrefix(s[i+1:], keyword+" ") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isFilterIdentifier(s string) bool {
+	for i, c := range s {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i != 0:
+		default:
+			return false
+		}
+	}
+	return len(s) != 0
+}
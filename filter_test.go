@@ -0,0 +1,58 @@
+package consul
+
+import "testing"
+
+func TestFilter(t *testing.T) {
+	tags := Selector("Service.Tags")
+	meta := Selector("Service.Meta")
+
+	tests := []struct {
+		filter   Filter
+		expected string
+	}{
+		{
+			filter:   tags.Contains("primary"),
+			expected: `Service.Tags contains "primary"`,
+		},
+		{
+			filter:   meta.Key("version").Equal(`v2 "beta"`),
+			expected: `Service.Meta.version == "v2 \"beta\""`,
+		},
+		{
+			filter:   meta.Key("app.kubernetes.io/name").NotEqual("web"),
+			expected: `Service.Meta["app.kubernetes.io/name"] != "web"`,
+		},
+		{
+			filter:   tags.Contains("primary").And(Selector("Service.Port").Equal("80"), ""),
+			expected: `Service.Tags contains "primary" and Service.Port == "80"`,
+		},
+		{
+			filter:   tags.Contains("a").Or(tags.Contains("b")).And(meta.IsNotEmpty()),
+			expected: `(Service.Tags contains "a" or Service.Tags contains "b") and Service.Meta is not empty`,
+		},
+		{
+			filter:   tags.Contains("a").And(tags.Contains("b")).Or(tags.IsEmpty()),
+			expected: `(Service.Tags contains "a" and Service.Tags contains "b") or Service.Tags is empty`,
+		},
+		{
+			filter:   Filter(`Service.Tags contains "x or y"`).And(tags.NotContains("z")),
+			expected: `Service.Tags contains "x or y" and Service.Tags not contains "z"`,
+		},
+		{
+			filter:   Selector("Node.Node").Matches(`^web-\d+$`).Not(),
+			expected: `not (Node.Node matches "^web-\\d+$")`,
+		},
+		{
+			filter:   Filter("").Not().And(""),
+			expected: ``,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			if s := test.filter.String(); s != test.expected {
+				t.Errorf("bad filter:\n expected: %s\n found:    %s", test.expected, s)
+			}
+		})
+	}
+}
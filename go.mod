@@ -1 +1,8 @@
 module github.com/segmentio/consul-go
+
+require (
+	github.com/hashicorp/hcl v1.0.0
+	go.opencensus.io v0.24.0
+)
+
+require github.com/golang/groupcache v0.0.0-20200121045136-8c9f03a8e57e // indirect
@@ -0,0 +1,165 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// HealthStatus is an enumeration representing the states that consul health
+// checks may be in.
+type HealthStatus string
+
+const (
+	// Passing is the status of health checks that succeeded.
+	Passing HealthStatus = "passing"
+
+	// Warning is the status of health checks that reported a degraded state.
+	Warning HealthStatus = "warning"
+
+	// Critical is the status of health checks that failed.
+	Critical HealthStatus = "critical"
+
+	// Maintenance is the status reported for nodes or services that were put
+	// in maintenance mode.
+	Maintenance HealthStatus = "maintenance"
+)
+
+// HealthCheck is a representation of a consul health check, which follows the
+// structure documented at https://www.consul.io/api/health.html
+type HealthCheck struct {
+	Node        string
+	CheckID     string
+	Name        string
+	Status      HealthStatus
+	Notes       string
+	Output      string
+	ServiceID   string
+	ServiceName string
+	ServiceTags []string
+}
+
+// maintenance returns true if the check was registered by consul to put a node
+// or service in maintenance mode.
+func (check HealthCheck) maintenance() bool {
+	return check.CheckID == nodeMaintenanceCheckID ||
+		strings.HasPrefix(check.CheckID, serviceMaintenanceCheckPrefix)
+}
+
+const (
+	nodeMaintenanceCheckID        = "_node_maintenance"
+	serviceMaintenanceCheckPrefix = "_service_maintenance:"
+)
+
+// AggregateHealth folds a list of health checks (typically the serf, node and
+// service checks of a service instance) into a single status.
+//
+// The function applies the same precedence rules than consul: any check in
+// maintenance mode puts the whole instance in maintenance, otherwise the most
+// severe status wins, critical being more severe than warning, itself more
+// severe than passing. Checks with unknown statuses are considered critical.
+// An empty list of checks is considered passing.
+func AggregateHealth(checks []HealthCheck) HealthStatus {
+	var warning bool
+	var critical bool
+
+	for _, check := range checks {
+		if check.maintenance() {
+			return Maintenance
+		}
+
+		switch check.Status {
+		case Passing:
+		case Warning:
+			warning = true
+		default:
+			critical = true
+		}
+	}
+
+	switch {
+	case critical:
+		return Critical
+	case warning:
+		return Warning
+	default:
+		return Passing
+	}
+}
+
+// ServiceEntry is an instance of a service along with the node it runs on and
+// its health checks, which follows the structure documented at
+// https://www.consul.io/api/health.html#list-nodes-for-service
+type ServiceEntry struct {
+	Node    Node
+	Service ServiceInstance
+	Checks  []HealthCheck
+}
+
+// ServiceInstance is the registration of a service instance on a node.
+type ServiceInstance struct {
+	ID      string
+	Service string
+	Tags    []string
+	Address string
+	Port    int
+	Meta    map[string]string
+}
+
+// Endpoint converts entry to an Endpoint value, similar to the ones returned
+// by the resolver.
+func (entry ServiceEntry) Endpoint() Endpoint {
+	endpoint := Endpoint{
+		ID:   entry.Service.ID,
+		Addr: newServiceAddr(entry.Service.Address, entry.Service.Port),
+		Tags: entry.Service.Tags,
+		Node: entry.Node.Node,
+		Meta: entry.Node.Meta,
+	}
+	if len(entry.Checks) != 0 {
+		endpoint.Health = AggregateHealth(entry.Checks)
+	}
+	return endpoint
+}
+
+// Health exposes methods to interract with the consul health endpoints.
+type Health struct {
+	// The client used by the health endpoints, which may be nil to indicate
+	// that a default client should be used.
+	Client *Client
+}
+
+// ChecksInState returns the list of health checks that are in the given state.
+// The special value "any" may be used to return all health checks.
+func (h *Health) ChecksInState(ctx context.Context, state HealthStatus) (checks []HealthCheck, err error) {
+	err = h.client().Get(ctx, "/v1/health/state/"+string(state), nil, &checks)
+	return
+}
+
+// Service returns the instances of the given service, along with the nodes they
+// run on and their health checks, and the query metadata.
+func (h *Health) Service(ctx context.Context, service string, opts HealthOptions) (entries []ServiceEntry, meta QueryMeta, err error) {
+	var m responseMeta
+	m, err = h.client().getList(ctx, "/v1/health/service/"+service, opts.Query(), func(dec *json.Decoder) error {
+		entries = append(entries, ServiceEntry{})
+		return dec.Decode(&entries[len(entries)-1])
+	})
+	meta = m.queryMeta()
+	return
+}
+
+func (h *Health) client() *Client {
+	if client := h.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+// DefaultHealth is a health endpoint configured to use the default client.
+var DefaultHealth = &Health{}
+
+// ChecksInState is a helper function that delegates to the default health
+// endpoint.
+func ChecksInState(ctx context.Context, state HealthStatus) ([]HealthCheck, error) {
+	return DefaultHealth.ChecksInState(ctx, state)
+}
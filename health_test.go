@@ -0,0 +1,143 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAggregateHealth(t *testing.T) {
+	tests := []struct {
+		scenario string
+		checks   []HealthCheck
+		status   HealthStatus
+	}{
+		{
+			scenario: "an empty list of checks is passing",
+			checks:   nil,
+			status:   Passing,
+		},
+		{
+			scenario: "all checks passing",
+			checks: []HealthCheck{
+				{CheckID: "serfHealth", Status: Passing},
+				{CheckID: "service:A", Status: Passing},
+			},
+			status: Passing,
+		},
+		{
+			scenario: "warning takes precedence over passing",
+			checks: []HealthCheck{
+				{CheckID: "serfHealth", Status: Passing},
+				{CheckID: "service:A", Status: Warning},
+			},
+			status: Warning,
+		},
+		{
+			scenario: "critical takes precedence over warning",
+			checks: []HealthCheck{
+				{CheckID: "serfHealth", Status: Critical},
+				{CheckID: "service:A", Status: Warning},
+			},
+			status: Critical,
+		},
+		{
+			scenario: "unknown statuses are considered critical",
+			checks: []HealthCheck{
+				{CheckID: "service:A", Status: "whatever"},
+			},
+			status: Critical,
+		},
+		{
+			scenario: "node maintenance takes precedence over all other statuses",
+			checks: []HealthCheck{
+				{CheckID: "serfHealth", Status: Passing},
+				{CheckID: "_node_maintenance", Status: Critical},
+			},
+			status: Maintenance,
+		},
+		{
+			scenario: "service maintenance takes precedence over all other statuses",
+			checks: []HealthCheck{
+				{CheckID: "serfHealth", Status: Critical},
+				{CheckID: "_service_maintenance:A", Status: Critical},
+			},
+			status: Maintenance,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if status := AggregateHealth(test.checks); status != test.status {
+				t.Errorf("bad status: expected %q, found %q", test.status, status)
+			}
+		})
+	}
+}
+
+func TestResolverEndpointHealth(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		type service struct {
+			Address string
+			Port    int
+		}
+		json.NewEncoder(res).Encode([]struct {
+			Service service
+			Checks  []HealthCheck
+		}{
+			{
+				Service: service{Address: "192.168.0.1", Port: 4242},
+				Checks: []HealthCheck{
+					{CheckID: "serfHealth", Status: Passing},
+					{CheckID: "service:A", Status: Warning},
+				},
+			},
+		})
+	})
+	defer server.Close()
+
+	rslv := Resolver{
+		Client:             client,
+		DisableCoordinates: true,
+	}
+
+	endpoints, err := rslv.LookupService(context.Background(), "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 {
+		t.Fatal("bad endpoint count:", endpoints)
+	}
+	if endpoints[0].Health != Warning {
+		t.Error("bad endpoint health:", endpoints[0].Health)
+	}
+}
+
+func TestServiceEntryEndpoint(t *testing.T) {
+	entry := ServiceEntry{
+		Node: Node{Node: "node-1", Meta: map[string]string{"rack": "A"}},
+		Service: ServiceInstance{
+			ID:      "web-1",
+			Service: "web",
+			Tags:    []string{"v1"},
+			Address: "10.0.0.1",
+			Port:    8080,
+		},
+		Checks: []HealthCheck{{CheckID: "service:web-1", Status: Critical}},
+	}
+
+	endpoint := entry.Endpoint()
+
+	if !reflect.DeepEqual(endpoint, Endpoint{
+		ID:     "web-1",
+		Node:   "node-1",
+		Addr:   newServiceAddr("10.0.0.1", 8080),
+		Tags:   []string{"v1"},
+		Meta:   map[string]string{"rack": "A"},
+		Health: Critical,
+	}) {
+		t.Errorf("bad endpoint: %#v", endpoint)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	consul "github.com/segmentio/consul-go"
@@ -30,15 +31,23 @@ func NewTransport(t http.RoundTripper) http.RoundTripper {
 // NewTransport returns a decorated version of t that uses consul to resolve the
 // service name that requests are being sent for using the given resolver.
 func NewTransportWith(t http.RoundTripper, r *consul.Resolver) http.RoundTripper {
+	return NewTransportWithLookuper(t, r)
+}
+
+// NewTransportWithLookuper is like NewTransportWith but resolves service names
+// with l, which may be any consul.Lookuper like a consul.StaticResolver.
+// Endpoints which could not be reached are only blacklisted if l is a
+// *consul.Resolver with a blacklist.
+func NewTransportWithLookuper(t http.RoundTripper, l consul.Lookuper) http.RoundTripper {
 	return &transport{
 		base: t,
-		rslv: r,
+		rslv: l,
 	}
 }
 
 type transport struct {
 	base http.RoundTripper
-	rslv *consul.Resolver
+	rslv consul.Lookuper
 }
 
 func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -53,12 +62,19 @@ func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	var res *http.Response
 	var err error
 
-	if addrs, err = t.rslv.LookupService(req.Context(), host); err != nil {
+	if rslv, ok := t.rslv.(consul.LookuperInto); ok {
+		buf := endpointsPool.Get().(*[]consul.Endpoint)
+		if addrs, err = rslv.LookupServiceInto(req.Context(), host, *buf); err != nil {
+			endpointsPool.Put(buf)
+			return nil, err
+		}
+		defer putEndpoints(buf, addrs)
+	} else if addrs, err = t.rslv.LookupService(req.Context(), host); err != nil {
 		return nil, err
 	}
 
 	if len(addrs) == 0 {
-		return nil, fmt.Errorf("no addresses returned by the resolver for %s", host)
+		return nil, fmt.Errorf("%w for %s", consul.ErrNoEndpoints, host)
 	}
 
 	for _, addr := range addrs {
@@ -72,15 +88,30 @@ func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
 			break
 		}
 
-		if t.rslv.Blacklist != nil {
+		if rslv, ok := t.rslv.(*consul.Resolver); ok && rslv.Blacklist != nil {
 			// TODO: make the blacklist TTL configurable here?
-			t.rslv.Blacklist.Blacklist(addr.Addr, time.Now().Add(1*time.Second))
+			rslv.Blacklist.Blacklist(addr.Addr, time.Now().Add(1*time.Second))
 		}
 	}
 
 	return res, err
 }
 
+// endpointsPool recycles the slices that services are resolved into, since
+// the endpoints are only used for the duration of a request.
+var endpointsPool = sync.Pool{
+	New: func() interface{} { return new([]consul.Endpoint) },
+}
+
+func putEndpoints(p *[]consul.Endpoint, list []consul.Endpoint) {
+	list = list[:cap(list)]
+	for i := range list {
+		list[i] = consul.Endpoint{}
+	}
+	*p = list[:0]
+	endpointsPool.Put(p)
+}
+
 func splitHostPort(s string) (string, string) {
 	host, port, err := net.SplitHostPort(s)
 	if err != nil {
@@ -20,6 +20,9 @@ func TestTransport(t *testing.T) {
 
 	t.Run("sending requests to non-existing services results in blacklisting the endpoints and an error after a couple of attempts",
 		testTransportRequestNonExistingService)
+
+	t.Run("sending requests with a static resolver results in a getting a response from one of the endpoints",
+		testTransportRequestStaticResolver)
 }
 
 func testTransportRequestExistingService(t *testing.T) {
@@ -93,6 +96,34 @@ func testTransportRequestNonExistingService(t *testing.T) {
 	}
 }
 
+func testTransportRequestStaticResolver(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("Hello World!"))
+	}))
+	defer httpServer.Close()
+	u, _ := url.Parse(httpServer.URL)
+
+	httpClient := &http.Client{
+		Transport: NewTransportWithLookuper(&http.Transport{}, &consul.StaticResolver{
+			Endpoints: map[string][]consul.Endpoint{
+				"whatever": consul.StaticEndpoints(u.Host),
+			},
+		}),
+	}
+
+	res, err := httpClient.Get("http://whatever/")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if s := string(b); s != "Hello World!" {
+		t.Error("bad response:", s)
+	}
+}
+
 func atoi(s string) int {
 	v, _ := strconv.Atoi(s)
 	return v
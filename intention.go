@@ -0,0 +1,121 @@
+package consul
+
+import (
+	"context"
+	"time"
+)
+
+// IntentionAction is an enumeration representing the actions that intentions
+// apply to connections between services.
+type IntentionAction string
+
+const (
+	// Allow is the action of intentions authorizing connections.
+	Allow IntentionAction = "allow"
+
+	// Deny is the action of intentions rejecting connections.
+	Deny IntentionAction = "deny"
+)
+
+// IntentionMatchType is an enumeration representing the sides of intentions
+// that can be matched by MatchIntentions.
+type IntentionMatchType string
+
+const (
+	// IntentionMatchSource matches intentions by source service.
+	IntentionMatchSource IntentionMatchType = "source"
+
+	// IntentionMatchDestination matches intentions by destination service.
+	IntentionMatchDestination IntentionMatchType = "destination"
+)
+
+// Intention is a representation of a Connect intention, which follows the
+// structure documented at https://www.consul.io/api/connect/intentions.html
+type Intention struct {
+	// The intention ID, generated by consul when the intention is created.
+	ID string `json:",omitempty"`
+
+	// A human-readable description of the intention (optional).
+	Description string `json:",omitempty"`
+
+	// The source and destination services of the intention, "*" may be used
+	// to match all services.
+	SourceNS        string `json:",omitempty"`
+	SourceName      string
+	DestinationNS   string `json:",omitempty"`
+	DestinationName string
+
+	// The type of the source, consul only supports "consul" at this time.
+	SourceType string `json:",omitempty"`
+
+	// The action applied to connections matching the intention.
+	Action IntentionAction
+
+	// Arbitrary metadata attached to the intention (optional).
+	Meta map[string]string `json:",omitempty"`
+
+	// Fields set by consul.
+	Precedence  int        `json:",omitempty"`
+	CreatedAt   *time.Time `json:",omitempty"`
+	UpdatedAt   *time.Time `json:",omitempty"`
+	CreateIndex uint64     `json:",omitempty"`
+	ModifyIndex uint64     `json:",omitempty"`
+}
+
+// CreateIntention creates a new intention, returning its ID.
+func (c *Connect) CreateIntention(ctx context.Context, intention Intention) (id string, err error) {
+	var res struct{ ID string }
+	err = c.client().Do(ctx, "POST", "/v1/connect/intentions", nil, intention, &res)
+	id = res.ID
+	return
+}
+
+// ReadIntention returns the intention with the given ID.
+func (c *Connect) ReadIntention(ctx context.Context, id string) (intention Intention, err error) {
+	err = c.client().Get(ctx, "/v1/connect/intentions/"+id, nil, &intention)
+	return
+}
+
+// UpdateIntention updates the intention identified by the ID field of the
+// intention argument.
+func (c *Connect) UpdateIntention(ctx context.Context, intention Intention) error {
+	return c.client().Put(ctx, "/v1/connect/intentions/"+intention.ID, nil, intention, nil)
+}
+
+// DeleteIntention deletes the intention with the given ID.
+func (c *Connect) DeleteIntention(ctx context.Context, id string) error {
+	return c.client().Delete(ctx, "/v1/connect/intentions/"+id, nil, nil)
+}
+
+// ListIntentions returns the list of all intentions.
+func (c *Connect) ListIntentions(ctx context.Context) (intentions []Intention, err error) {
+	err = c.client().Get(ctx, "/v1/connect/intentions", nil, &intentions)
+	return
+}
+
+// MatchIntentions returns the intentions that apply to the given services, as
+// sources or destinations depending on the value of by. The result maps each
+// service name to its list of intentions, ordered by precedence.
+func (c *Connect) MatchIntentions(ctx context.Context, by IntentionMatchType, names ...string) (intentions map[string][]Intention, err error) {
+	query := make(Query, 0, 1+len(names))
+	query = append(query, Param{Name: "by", Value: string(by)})
+
+	for _, name := range names {
+		query = append(query, Param{Name: "name", Value: name})
+	}
+
+	err = c.client().Get(ctx, "/v1/connect/intentions/match", query, &intentions)
+	return
+}
+
+// CheckIntention returns whether connections from the source service to the
+// destination service are allowed by the current set of intentions.
+func (c *Connect) CheckIntention(ctx context.Context, source string, destination string) (allowed bool, err error) {
+	var res struct{ Allowed bool }
+	err = c.client().Get(ctx, "/v1/connect/intentions/check", Query{
+		{Name: "source", Value: source},
+		{Name: "destination", Value: destination},
+	}, &res)
+	allowed = res.Allowed
+	return
+}
@@ -0,0 +1,101 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestIntentions(t *testing.T) {
+	intentions := map[string]Intention{}
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+
+		switch req.Method + " " + req.URL.Path {
+		case "POST /v1/connect/intentions":
+			var intention Intention
+			json.NewDecoder(req.Body).Decode(&intention)
+			intention.ID = "1234"
+			intentions[intention.ID] = intention
+			json.NewEncoder(res).Encode(struct{ ID string }{intention.ID})
+
+		case "GET /v1/connect/intentions/1234":
+			json.NewEncoder(res).Encode(intentions["1234"])
+
+		case "PUT /v1/connect/intentions/1234":
+			var intention Intention
+			json.NewDecoder(req.Body).Decode(&intention)
+			intentions[intention.ID] = intention
+
+		case "DELETE /v1/connect/intentions/1234":
+			delete(intentions, "1234")
+
+		case "GET /v1/connect/intentions/match":
+			if by, names := q.Get("by"), q["name"]; by != "destination" || !reflect.DeepEqual(names, []string{"db"}) {
+				t.Error("bad match query:", req.URL.RawQuery)
+			}
+			json.NewEncoder(res).Encode(map[string][]Intention{"db": {intentions["1234"]}})
+
+		case "GET /v1/connect/intentions/check":
+			allowed := intentions["1234"].Action == Allow &&
+				q.Get("source") == intentions["1234"].SourceName &&
+				q.Get("destination") == intentions["1234"].DestinationName
+			json.NewEncoder(res).Encode(struct{ Allowed bool }{allowed})
+
+		default:
+			t.Error("unexpected request:", req.Method, req.URL.Path)
+		}
+	})
+	defer server.Close()
+
+	connect := &Connect{Client: client}
+	ctx := context.Background()
+
+	id, err := connect.CreateIntention(ctx, Intention{
+		SourceName:      "web",
+		DestinationName: "db",
+		Action:          Allow,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	intention, err := connect.ReadIntention(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intention.SourceName != "web" || intention.DestinationName != "db" || intention.Action != Allow {
+		t.Error("bad intention:", intention)
+	}
+
+	if allowed, err := connect.CheckIntention(ctx, "web", "db"); err != nil || !allowed {
+		t.Error("connections from web to db should be allowed:", err)
+	}
+
+	matches, err := connect.MatchIntentions(ctx, IntentionMatchDestination, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches["db"]) != 1 {
+		t.Error("bad intention matches:", matches)
+	}
+
+	intention.Action = Deny
+	if err := connect.UpdateIntention(ctx, intention); err != nil {
+		t.Fatal(err)
+	}
+
+	if allowed, err := connect.CheckIntention(ctx, "web", "db"); err != nil || allowed {
+		t.Error("connections from web to db should be denied:", err)
+	}
+
+	if err := connect.DeleteIntention(ctx, id); err != nil {
+		t.Error(err)
+	}
+	if len(intentions) != 0 {
+		t.Error("the intention was not deleted")
+	}
+}
@@ -0,0 +1,63 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ConvertAPI converts src to dst, where one of them is a value of this package
+// and the other a value of the official github.com/hashicorp/consul/api package
+// representing the same consul API object. It lets programs mix both clients,
+// or migrate from one to the other incrementally, without depending on the
+// other package here.
+//
+// Both packages follow the JSON representation of the consul HTTP API, which is
+// what the conversion goes through, so it supports the pairs of types which
+// mirror the same object, for example:
+//
+//	ServiceEntry    api.ServiceEntry
+//	ServiceInstance api.AgentService
+//	Node            api.Node, api.CatalogNode (Node field)
+//	HealthCheck     api.HealthCheck
+//	KeyData         api.KVPair
+//	SessionInfo     api.SessionEntry
+//	ServiceConnect  api.AgentServiceConnect
+//	SidecarService  api.AgentServiceRegistration
+//	ServiceProxy    api.AgentServiceConnectProxyConfig
+//	Upstream        api.Upstream
+//	ExposeConfig    api.ExposeConfig
+//
+// Slices of these types can be converted as well. Fields which only exist in
+// one of the types are left to their zero-value.
+//
+//	var entries []consul.ServiceEntry
+//	if err := consul.ConvertAPI(&entries, apiEntries); err != nil {
+//		...
+//	}
+//	endpoints := make([]consul.Endpoint, len(entries))
+//	for i, entry := range entries {
+//		endpoints[i] = entry.Endpoint()
+//	}
+//
+// Service registrations are converted the same way, for example to register a
+// Listener with the Connect configuration of an api.AgentServiceRegistration:
+//
+//	listener := &consul.Listener{ServiceName: reg.Name, ServiceTags: reg.Tags}
+//	if reg.Connect != nil {
+//		listener.ServiceConnect = new(consul.ServiceConnect)
+//		if err := consul.ConvertAPI(listener.ServiceConnect, reg.Connect); err != nil {
+//			...
+//		}
+//	}
+//
+// dst must be a pointer.
+func ConvertAPI(dst interface{}, src interface{}) error {
+	b, err := json.Marshal(src)
+	if err != nil {
+		return fmt.Errorf("consul: converting %T to %T: %w", src, dst, err)
+	}
+	if err := json.Unmarshal(b, dst); err != nil {
+		return fmt.Errorf("consul: converting %T to %T: %w", src, dst, err)
+	}
+	return nil
+}
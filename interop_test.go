@@ -0,0 +1,165 @@
+package consul
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The types below mirror the shape of the github.com/hashicorp/consul/api types
+// with the same names, which use pointers and different integer types.
+type apiServiceEntry struct {
+	Node    *apiNode
+	Service *apiAgentService
+	Checks  []*apiHealthCheck
+}
+
+type apiNode struct {
+	ID              string
+	Node            string
+	Address         string
+	Datacenter      string
+	TaggedAddresses map[string]string
+	Meta            map[string]string
+	CreateIndex     uint64
+}
+
+type apiAgentService struct {
+	ID      string
+	Service string
+	Tags    []string
+	Port    int
+	Address string
+	Meta    map[string]string
+	Weights struct{ Passing, Warning int }
+}
+
+type apiHealthCheck struct {
+	Node    string
+	CheckID string
+	Status  string
+}
+
+type apiAgentServiceRegistration struct {
+	ID      string `json:",omitempty"`
+	Name    string `json:",omitempty"`
+	Tags    []string
+	Port    int `json:",omitempty"`
+	Address string
+	Proxy   *apiAgentServiceConnectProxyConfig `json:",omitempty"`
+	Connect *apiAgentServiceConnect            `json:",omitempty"`
+}
+
+type apiAgentServiceConnect struct {
+	Native         bool                         `json:",omitempty"`
+	SidecarService *apiAgentServiceRegistration `json:",omitempty"`
+}
+
+type apiAgentServiceConnectProxyConfig struct {
+	DestinationServiceName string
+	LocalServicePort       int `json:",omitempty"`
+	Upstreams              []apiUpstream
+	Expose                 struct{ Checks bool }
+}
+
+type apiUpstream struct {
+	DestinationType string `json:",omitempty"`
+	DestinationName string
+	LocalBindPort   int `json:",omitempty"`
+}
+
+func TestConvertAPI(t *testing.T) {
+	apiEntries := []*apiServiceEntry{{
+		Node: &apiNode{
+			Node:        "node-1",
+			Address:     "10.0.0.1",
+			Meta:        map[string]string{"zone": "a"},
+			CreateIndex: 42,
+		},
+		Service: &apiAgentService{
+			ID:      "web-1",
+			Service: "web",
+			Tags:    []string{"canary"},
+			Port:    8080,
+			Address: "10.0.0.1",
+		},
+		Checks: []*apiHealthCheck{
+			{Node: "node-1", CheckID: "serfHealth", Status: "passing"},
+		},
+	}}
+
+	var entries []ServiceEntry
+	if err := ConvertAPI(&entries, apiEntries); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(entries, []ServiceEntry{{
+		Node:    Node{Node: "node-1", Address: "10.0.0.1", Meta: map[string]string{"zone": "a"}},
+		Service: ServiceInstance{ID: "web-1", Service: "web", Tags: []string{"canary"}, Port: 8080, Address: "10.0.0.1"},
+		Checks:  []HealthCheck{{Node: "node-1", CheckID: "serfHealth", Status: Passing}},
+	}}) {
+		t.Errorf("bad service entries: %+v", entries)
+	}
+
+	var back []*apiServiceEntry
+	if err := ConvertAPI(&back, entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if back[0].Node.Node != "node-1" || back[0].Service.Port != 8080 || back[0].Checks[0].Status != "passing" {
+		t.Errorf("bad conversion back to the api types: %+v", back[0])
+	}
+}
+
+func TestConvertAPIRegistration(t *testing.T) {
+	reg := &apiAgentServiceRegistration{
+		Name: "web",
+		Port: 8080,
+		Connect: &apiAgentServiceConnect{
+			SidecarService: &apiAgentServiceRegistration{
+				Port: 21000,
+				Proxy: &apiAgentServiceConnectProxyConfig{
+					Upstreams: []apiUpstream{
+						{DestinationType: "prepared_query", DestinationName: "db", LocalBindPort: 5432},
+					},
+				},
+			},
+		},
+	}
+
+	var connect ServiceConnect
+	if err := ConvertAPI(&connect, reg.Connect); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(connect, ServiceConnect{
+		SidecarService: &SidecarService{
+			Port: 21000,
+			Proxy: &ServiceProxy{
+				Upstreams: []Upstream{
+					{DestinationType: UpstreamPreparedQuery, DestinationName: "db", LocalBindPort: 5432},
+				},
+				Expose: &ExposeConfig{},
+			},
+		},
+	}) {
+		t.Errorf("bad connect configuration: %+v", connect)
+	}
+
+	connect.SidecarService.Proxy.Expose.Checks = true
+
+	var sidecar apiAgentServiceRegistration
+	if err := ConvertAPI(&sidecar, connect.SidecarService); err != nil {
+		t.Fatal(err)
+	}
+
+	if sidecar.Port != 21000 || sidecar.Proxy == nil || !sidecar.Proxy.Expose.Checks || len(sidecar.Proxy.Upstreams) != 1 || sidecar.Proxy.Upstreams[0].DestinationName != "db" {
+		t.Errorf("bad conversion back to the api types: %+v", sidecar)
+	}
+}
+
+func TestConvertAPIError(t *testing.T) {
+	var entries []ServiceEntry
+	if err := ConvertAPI(&entries, map[string]string{}); err == nil {
+		t.Error("expected an error converting incompatible types")
+	}
+}
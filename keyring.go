@@ -0,0 +1,55 @@
+package consul
+
+import "context"
+
+// KeyringResponse is a representation of the state of the gossip encryption
+// keyring of a pool of consul agents, which follows the structure documented
+// at https://www.consul.io/api/operator/keyring.html#list-gossip-encryption-keys
+type KeyringResponse struct {
+	// Set to true if the response describes the WAN gossip pool, false for
+	// LAN pools.
+	WAN bool
+
+	// The datacenter and network segment of the gossip pool.
+	Datacenter string
+	Segment    string
+
+	// Error messages reported by nodes of the pool, indexed by node name.
+	Messages map[string]string
+
+	// Installed keys, mapped to the number of nodes that have them.
+	Keys map[string]int
+
+	// Total number of nodes in the gossip pool.
+	NumNodes int
+}
+
+type keyringRequest struct {
+	Key string
+}
+
+// ListKeys returns the state of the gossip encryption keyring of all the
+// gossip pools known to the cluster.
+func (op *Operator) ListKeys(ctx context.Context) (keys []KeyringResponse, err error) {
+	err = op.client().Get(ctx, "/v1/operator/keyring", nil, &keys)
+	return
+}
+
+// InstallKey installs a new gossip encryption key, the key is distributed to
+// all the members of the cluster but not used to encrypt messages until UseKey
+// is called.
+func (op *Operator) InstallKey(ctx context.Context, key string) error {
+	return op.client().Do(ctx, "POST", "/v1/operator/keyring", nil, keyringRequest{key}, nil)
+}
+
+// UseKey changes the primary gossip encryption key, it must have already been
+// installed on all members of the cluster.
+func (op *Operator) UseKey(ctx context.Context, key string) error {
+	return op.client().Put(ctx, "/v1/operator/keyring", nil, keyringRequest{key}, nil)
+}
+
+// RemoveKey removes a gossip encryption key from the cluster, this operation
+// fails if the key is the one currently in use.
+func (op *Operator) RemoveKey(ctx context.Context, key string) error {
+	return op.client().Do(ctx, "DELETE", "/v1/operator/keyring", nil, keyringRequest{key}, nil)
+}
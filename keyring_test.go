@@ -0,0 +1,62 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestKeyring(t *testing.T) {
+	keys := []KeyringResponse{{
+		Datacenter: "dc1",
+		Keys:       map[string]int{"pUqJrVyVRj5jsiYEkM/tFQYfWyJIv4s3XkvDwy7Cu5s=": 3},
+		NumNodes:   3,
+	}}
+
+	var calls []string
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/operator/keyring" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+
+		if req.Method == "GET" {
+			json.NewEncoder(res).Encode(keys)
+			return
+		}
+
+		var body keyringRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		calls = append(calls, req.Method+" "+body.Key)
+	})
+	defer server.Close()
+
+	op := &Operator{Client: client}
+	ctx := context.Background()
+
+	found, err := op.ListKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found, keys) {
+		t.Error("bad keyring:", found)
+	}
+
+	if err := op.InstallKey(ctx, "A"); err != nil {
+		t.Error(err)
+	}
+	if err := op.UseKey(ctx, "A"); err != nil {
+		t.Error(err)
+	}
+	if err := op.RemoveKey(ctx, "B"); err != nil {
+		t.Error(err)
+	}
+
+	if expect := []string{"POST A", "PUT A", "DELETE B"}; !reflect.DeepEqual(calls, expect) {
+		t.Error("bad keyring operations:", calls)
+	}
+}
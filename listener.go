@@ -43,10 +43,19 @@ type Listener struct {
 	// By default, the address that new listeners accept connections on is used.
 	ServiceAddress net.Addr
 
+	// A set of key/value pairs attached to the service registered to consul.
+	ServiceMeta map[string]string
+
 	// Configures whether registering the service with specific tags should
 	// overwrite existing values.
 	ServiceEnableTagOverride bool
 
+	// The Connect configuration of the service, which may be set to register
+	// a sidecar proxy along with the service, or to declare that the service
+	// is Connect-native. The sidecar is deregistered with the service when
+	// the listener is closed.
+	ServiceConnect *ServiceConnect
+
 	// If the listener is intended to be used to serve HTTP connection this
 	// field may be set to the path that consul should query to health check
 	// the service.
@@ -94,7 +103,9 @@ func (l *Listener) Register(ctx context.Context, lstn net.Listener) (net.Listene
 		ID:                l.ServiceID,
 		Name:              l.ServiceName,
 		Tags:              l.ServiceTags,
+		Meta:              l.ServiceMeta,
 		EnableTagOverride: l.ServiceEnableTagOverride,
+		Connect:           l.ServiceConnect,
 	}
 
 	if len(service.Name) == 0 {
@@ -2,8 +2,12 @@ package consul
 
 import (
 	"context"
+	"encoding/json"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -49,3 +53,60 @@ func TestListener(t *testing.T) {
 		t.Error("bad response:", s)
 	}
 }
+
+func TestListenerSidecarRegistration(t *testing.T) {
+	var registration map[string]interface{}
+	var deregistered string
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/v1/agent/service/register":
+			json.NewDecoder(req.Body).Decode(&registration)
+		case strings.HasPrefix(req.URL.Path, "/v1/agent/service/deregister/"):
+			deregistered = strings.TrimPrefix(req.URL.Path, "/v1/agent/service/deregister/")
+		default:
+			t.Error("unexpected request:", req.Method, req.URL.Path)
+		}
+	})
+	defer server.Close()
+
+	lstn, err := (&Listener{
+		Client:         client,
+		ServiceName:    "web",
+		ServiceAddress: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8080},
+		ServiceConnect: &ServiceConnect{
+			SidecarService: &SidecarService{
+				Proxy: &ServiceProxy{
+					Upstreams: []Upstream{{DestinationName: "db", LocalBindPort: 9191}},
+				},
+			},
+		},
+	}).Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connect, _ := registration["Connect"].(map[string]interface{})
+	if !reflect.DeepEqual(connect, map[string]interface{}{
+		"SidecarService": map[string]interface{}{
+			"Proxy": map[string]interface{}{
+				"MeshGateway": map[string]interface{}{},
+				"Upstreams": []interface{}{
+					map[string]interface{}{
+						"DestinationName": "db",
+						"LocalBindPort":   9191.0,
+						"MeshGateway":     map[string]interface{}{},
+					},
+				},
+			},
+		},
+	}) {
+		t.Error("bad Connect registration:", connect)
+	}
+
+	lstn.Close()
+
+	if deregistered != "web" {
+		t.Error("the service was not deregistered:", deregistered)
+	}
+}
@@ -7,11 +7,23 @@ import (
 	"path"
 	"reflect"
 	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// LockManager is the interface of types acquiring locks on keys, which is
+// implemented by *Locker.
+//
+// Programs may depend on this interface instead of *Locker, so their tests can
+// use in-memory locks like the ones of the consultest package, for example to
+// exercise leader and follower code paths without running a consul agent.
+type LockManager interface {
+	Lock(ctx context.Context, keys ...string) (context.Context, context.CancelFunc)
+	TryLockOne(ctx context.Context, keys ...string) (context.Context, context.CancelFunc)
+}
+
 // A Locker exposes methods for acquiring locks on keys of the consul key/value
 // store.
 type Locker struct {
@@ -28,6 +40,20 @@ type Locker struct {
 
 	// The behavior to used when releasing a lock (default to Release).
 	UnlockBehavior SessionBehavior
+
+	// The clock used to schedule retries of Lock and checks of lock ownership.
+	// If nil, DefaultClock is used.
+	Clock Clock
+
+	// SessionStore may be set to persist the IDs of the sessions created by
+	// the locker, so a program restarting after a crash re-adopts the session
+	// of its previous process and the locks it held, instead of waiting for
+	// the lock delay to acquire them again. See Session.Store for details.
+	//
+	// The store holds a single session ID, it must only be set on lockers
+	// holding one lock at a time, like the one of an Election. Sessions with
+	// different names, which include the keys they lock, replace each other.
+	SessionStore SessionStore
 }
 
 // Lock acquires locks on the given keys. The method blocks until the locks were
@@ -39,10 +65,11 @@ func (l *Locker) Lock(ctx context.Context, keys ...string) (context.Context, con
 		return errorContext(ctx, Unlocked)
 	}
 
+	clock := clockOrDefault(l.Clock)
 	retryInterval := 1 * time.Second
 	deadline, ok := ctx.Deadline()
 	if ok {
-		retryInterval = deadline.Sub(time.Now()) / 10
+		retryInterval = deadline.Sub(clock.Now()) / 10
 	}
 
 	keys = l.prefixKeys(sortedKeys(keys))
@@ -77,9 +104,9 @@ func (l *Locker) Lock(ctx context.Context, keys ...string) (context.Context, con
 		}
 		locks = locks[:0]
 
-		timer := time.NewTicker(retryInterval)
+		timer := clock.NewTimer(retryInterval)
 		select {
-		case <-timer.C:
+		case <-timer.C():
 			timer.Stop()
 		case <-ctx.Done():
 			timer.Stop()
@@ -94,7 +121,9 @@ func (l *Locker) Lock(ctx context.Context, keys ...string) (context.Context, con
 // cancellation function), or if the ownership was lost, in this case the
 // context's Err method returns Unlocked.
 // The method never blocks, if it fails to acquire any of the locks it returns
-// a canceled context.
+// a canceled context. When the keys were locked by other sessions, the Err
+// method of the context returns Unlocked, and LockError returns an error
+// matching ErrLockHeld.
 func (l *Locker) TryLockOne(ctx context.Context, keys ...string) (context.Context, context.CancelFunc) {
 	if len(keys) == 0 {
 		return errorContext(ctx, Unlocked)
@@ -118,22 +147,50 @@ func (l *Locker) TryLockOne(ctx context.Context, keys ...string) (context.Contex
 	}
 
 	sessionCancel()
-	return errorContext(ctx, coalesceError(err, Unlocked))
+
+	if err != nil {
+		return errorContext(ctx, err)
+	}
+
+	held := context.WithValue(ctx, LockErrorKey, withKind(ErrLockHeld, Unlocked))
+	return errorContext(held, Unlocked)
 }
 
 func (l *Locker) tryLock(ctx context.Context, key string) (context.Context, context.CancelFunc, error) {
+	return l.tryLockAt(ctx, key, 0, nil)
+}
+
+// tryLockAt is like tryLock, but if index is not zero the lock is only acquired
+// if the key exists and was last modified at index. Acquiring a lock sets the
+// value of the key, which is replaced by value.
+func (l *Locker) tryLockAt(ctx context.Context, key string, index uint64, value []byte) (context.Context, context.CancelFunc, error) {
 	client := l.client()
 	session := contextSession(ctx)
 
 	tryLockCtx, tryLockCancel := context.WithTimeout(ctx, l.lockDelay())
 	defer tryLockCancel()
 
-	locked, err := client.acquireLock(tryLockCtx, key, string(session.ID))
+	locked, err := client.acquireLockAt(tryLockCtx, key, string(session.ID), index, value)
 	if !locked || err != nil {
 		return nil, nil, err
 	}
 
-	lock := newLockCtx(ctx, key, client)
+	// The lock index is read after acquiring the lock, it cannot change until
+	// the lock is released, unless the lock was already lost.
+	entry, err := client.fetchLockEntry(tryLockCtx, key)
+	if err != nil || SessionID(entry.Session) != session.ID {
+		releaseCtx, releaseCancel := context.WithTimeout(context.Background(), l.lockDelay())
+		client.releaseLockValue(releaseCtx, key, string(session.ID), value)
+		releaseCancel()
+		return nil, nil, err
+	}
+
+	lock := newLockCtx(ctx, key, value, client, FencingToken{
+		Key:         key,
+		Session:     session.ID,
+		LockIndex:   entry.LockIndex,
+		ModifyIndex: entry.ModifyIndex,
+	})
 	return lock, lock.cancel, nil
 }
 
@@ -150,6 +207,8 @@ func (l *Locker) withSession(ctx context.Context, name string) (context.Context,
 		Behavior:  l.unlockBehavior(),
 		LockDelay: lockDelay,
 		TTL:       lockDelay * 2,
+		Clock:     l.Clock,
+		Store:     l.SessionStore,
 	})
 }
 
@@ -214,13 +273,65 @@ var (
 	// Unlocked is the error returned by contexts when the lock they were
 	// associated with has been lost.
 	Unlocked = errors.New("unlocked")
+
+	// FencingTokensKey is used to lookup the fencing tokens of the keys held
+	// by a lock from its associated context, see FencingTokens.
+	FencingTokensKey = &contextKey{"consul-fencing-tokens"}
+
+	// LockErrorKey is used to lookup the reason why a lock could not be
+	// acquired from its associated context, see LockError.
+	LockErrorKey = &contextKey{"consul-lock-error"}
 )
 
-func newLockCtx(ctx context.Context, key string, client *Client) *lockCtx {
+// LockError returns the reason why the lock that ctx is associated with could
+// not be acquired, or was lost. The Err method of lock contexts returns the
+// Unlocked sentinel, LockError returns more specific errors, which still match
+// Unlocked with errors.Is, for example errors matching ErrLockHeld when the
+// keys were held by other sessions.
+func LockError(ctx context.Context) error {
+	if err, _ := ctx.Value(LockErrorKey).(error); err != nil && ctx.Err() != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// FencingToken identifies an acquisition of a lock. Programs using locks to
+// guard writes to external systems pass the token along with their writes, so
+// the systems can reject writes from holders which lost the lock but did not
+// notice yet, for example because they were paused.
+//
+// The LockIndex of a key is incremented every time that a session acquires
+// its lock, downstream systems should reject writes carrying a lower LockIndex
+// than the highest they have seen for the key. The ModifyIndex is the index of
+// the acquisition in the consul raft log, which can also be compared across
+// keys.
+type FencingToken struct {
+	Key         string
+	Session     SessionID
+	LockIndex   uint64
+	ModifyIndex uint64
+}
+
+// String returns a representation of the token in the "key:lock-index" form.
+func (t FencingToken) String() string {
+	return t.Key + ":" + strconv.FormatUint(t.LockIndex, 10)
+}
+
+// FencingTokens returns the fencing tokens of the keys held by the lock that
+// ctx is associated with, in the order of the keys, or nil if ctx is not the
+// context of a lock.
+func FencingTokens(ctx context.Context) []FencingToken {
+	tokens, _ := ctx.Value(FencingTokensKey).([]FencingToken)
+	return tokens
+}
+
+func newLockCtx(ctx context.Context, key string, value []byte, client *Client, token FencingToken) *lockCtx {
 	l := &lockCtx{
 		client: client,
 		ctx:    ctx,
 		key:    key,
+		value:  value,
+		token:  token,
 		done:   make(chan struct{}),
 	}
 	go l.run(ctx.Value(SessionKey).(Session))
@@ -231,6 +342,8 @@ type lockCtx struct {
 	client *Client
 	ctx    context.Context
 	key    string
+	value  []byte // written back when releasing the lock
+	token  FencingToken
 	err    atomic.Value
 	once   sync.Once
 	done   chan struct{}
@@ -250,8 +363,11 @@ func (l *lockCtx) Err() error {
 }
 
 func (l *lockCtx) Value(key interface{}) interface{} {
-	if key == LocksKey {
+	switch key {
+	case LocksKey:
 		return []string{l.key}
+	case FencingTokensKey:
+		return []FencingToken{l.token}
 	}
 	return l.ctx.Value(key)
 }
@@ -267,19 +383,19 @@ func (l *lockCtx) cancelWithError(err error) {
 
 		session := contextSession(l.ctx)
 		ctx, cancel := context.WithTimeout(context.Background(), session.LockDelay)
-		l.client.releaseLock(ctx, l.key, string(session.ID))
+		l.client.releaseLockValue(ctx, l.key, string(session.ID), l.value)
 		cancel()
 	})
 }
 
 func (l *lockCtx) run(session Session) {
 	timeout := session.LockDelay / 3
-	ticker := time.NewTicker(timeout)
+	ticker := session.clock().NewTicker(timeout)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 		case <-l.done:
 			return
 		case <-l.ctx.Done():
@@ -320,6 +436,7 @@ type multiLockCtx struct {
 func newMultiCtx(keys []string, locks []ctxCancel) *multiLockCtx {
 	m := &multiLockCtx{
 		locks: locks,
+		keys:  keys,
 		done:  make(chan struct{}),
 	}
 
@@ -349,8 +466,15 @@ func (m *multiLockCtx) Err() error {
 }
 
 func (m *multiLockCtx) Value(key interface{}) interface{} {
-	if key == LocksKey {
+	switch key {
+	case LocksKey:
 		return copyKeys(m.keys)
+	case FencingTokensKey:
+		tokens := make([]FencingToken, 0, len(m.locks))
+		for _, lock := range m.locks {
+			tokens = append(tokens, FencingTokens(lock.ctx)...)
+		}
+		return tokens
 	}
 	for _, lock := range m.locks {
 		if value := lock.ctx.Value(key); value != nil {
@@ -402,24 +526,54 @@ func (c *Client) acquireLock(ctx context.Context, key string, sid string) (locke
 	return
 }
 
+func (c *Client) acquireLockAt(ctx context.Context, key string, sid string, index uint64, value []byte) (locked bool, err error) {
+	query := Query{{"acquire", sid}}
+	if index != 0 {
+		query = append(query, Param{"cas", strconv.FormatUint(index, 10)})
+	}
+
+	return c.putKV(ctx, key, query, value)
+}
+
 func (c *Client) releaseLock(ctx context.Context, key string, sid string) (err error) {
 	err = c.Put(ctx, "/v1/kv/"+key, Query{{"release", sid}}, nil, nil)
 	return
 }
 
-func (c *Client) fetchLock(ctx context.Context, key string) (sid string, err error) {
-	var entries []struct {
-		Key     string
-		Session string
+// releaseLockValue releases the lock on key, setting its value to value, since
+// consul replaces the value of keys with the body of release requests.
+func (c *Client) releaseLockValue(ctx context.Context, key string, sid string, value []byte) (err error) {
+	if value == nil {
+		return c.releaseLock(ctx, key, sid)
 	}
+	_, err = c.putKV(ctx, key, Query{{"release", sid}}, value)
+	return
+}
+
+func (c *Client) fetchLock(ctx context.Context, key string) (sid string, err error) {
+	entry, err := c.fetchLockEntry(ctx, key)
+	sid = entry.Session
+	return
+}
+
+type lockEntry struct {
+	Key         string
+	Session     string
+	LockIndex   uint64
+	CreateIndex uint64
+	ModifyIndex uint64
+}
+
+func (c *Client) fetchLockEntry(ctx context.Context, key string) (entry lockEntry, err error) {
+	var entries []lockEntry
 
 	if err = c.Get(ctx, "/v1/kv/"+key, nil, &entries); err != nil {
 		return
 	}
 
-	for _, entry := range entries {
-		if entry.Key == key {
-			sid = entry.Session
+	for _, e := range entries {
+		if e.Key == key {
+			entry = e
 			break
 		}
 	}
@@ -0,0 +1,205 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// FairLockQueue is the suffix appended to the keys locked by LockFair to form
+// the prefix under which contenders enqueue.
+const FairLockQueue = "/.queue/"
+
+// LockFair acquires a lock on key like Lock, but the contenders are granted the
+// lock in the order in which they started waiting for it, which prevents the
+// starvation of unlucky contenders when the lock is heavily contended.
+//
+// Each contender enqueues by creating a key under key+FairLockQueue, locked by
+// its session so the entries of contenders which went away are ignored, and
+// only the contender at the head of the queue attempts to acquire the lock.
+// The order is only guaranteed among contenders calling LockFair, the ones
+// calling Lock on the same key may still acquire it first.
+//
+// The returned context behaves like the ones returned by Lock, including the
+// fencing token it carries.
+func (l *Locker) LockFair(ctx context.Context, key string) (context.Context, context.CancelFunc) {
+	key = l.prefixKeys([]string{key})[0]
+	sessionCtx, sessionCancel := l.withSession(ctx, makeSessionName("fair-lock: ", key))
+
+	if sessionCtx.Err() != nil {
+		return sessionCtx, sessionCancel
+	}
+
+	client := l.client()
+	clock := clockOrDefault(l.Clock)
+	session := contextSession(sessionCtx)
+	queue := key + FairLockQueue
+	entry := queue + string(session.ID)
+
+	retryInterval := 1 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		retryInterval = deadline.Sub(clock.Now()) / 10
+	}
+
+	dequeue := func() {
+		dequeueCtx, cancel := context.WithTimeout(context.Background(), l.lockDelay())
+		client.Delete(dequeueCtx, "/v1/kv/"+entry, nil, nil)
+		cancel()
+	}
+
+	fail := func(err error) (context.Context, context.CancelFunc) {
+		dequeue()
+		sessionCancel()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		return errorContext(ctx, err)
+	}
+
+	enqueueCtx, enqueueCancel := context.WithTimeout(sessionCtx, l.lockDelay())
+	enqueued, err := client.acquireLock(enqueueCtx, entry, string(session.ID))
+	enqueueCancel()
+
+	if err != nil || !enqueued {
+		return fail(coalesceError(err, Unlocked))
+	}
+
+	var queueIndex uint64
+
+	for {
+		if err := sessionCtx.Err(); err != nil {
+			return fail(err)
+		}
+
+		entries, index, err := client.fetchLockQueue(sessionCtx, queue, queueIndex)
+		if err != nil {
+			queueIndex = 0
+			if Sleep(sessionCtx, clock, retryInterval) != nil {
+				return fail(sessionCtx.Err())
+			}
+			continue
+		}
+
+		head := -1
+		for i, e := range entries {
+			if len(e.Session) != 0 {
+				head = i
+				break
+			}
+		}
+
+		position := -1
+		for i, e := range entries {
+			if e.Key == entry {
+				position = i
+				break
+			}
+		}
+
+		// The entry is missing or was released when the session was lost,
+		// which also means that the lock could not be held anymore.
+		if position < 0 || SessionID(entries[position].Session) != session.ID {
+			return fail(Unlocked)
+		}
+
+		if position != head {
+			// Entries released by sessions which expired are removed, so they
+			// don't accumulate under the queue prefix.
+			for _, e := range entries[:position] {
+				if len(e.Session) == 0 {
+					client.Delete(sessionCtx, "/v1/kv/"+e.Key, Query{{"cas", strconv.FormatUint(e.ModifyIndex, 10)}}, nil)
+				}
+			}
+			queueIndex = index
+			continue
+		}
+
+		lock, unlock, err := l.tryLock(sessionCtx, key)
+		if lock != nil {
+			dequeue()
+			return lock, func() { unlock(); sessionCancel() }
+		}
+
+		if err == nil {
+			err = l.waitUnlocked(sessionCtx, key, retryInterval)
+		}
+
+		if err != nil && Sleep(sessionCtx, clock, retryInterval) != nil {
+			return fail(sessionCtx.Err())
+		}
+
+		// The head of the queue reads it again without blocking after each
+		// attempt, it only blocks on changes of the lock.
+		queueIndex = 0
+	}
+}
+
+// waitUnlocked blocks until the lock on key changes, or sleeps for
+// retryInterval if the lock is free but could not be acquired, which happens
+// while consul applies the lock delay of a session which expired.
+func (l *Locker) waitUnlocked(ctx context.Context, key string, retryInterval time.Duration) error {
+	client := l.client()
+
+	entry, index, err := client.fetchLockEntryAt(ctx, key, 0)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	if len(entry.Session) == 0 {
+		return Sleep(ctx, l.Clock, retryInterval)
+	}
+
+	_, _, err = client.fetchLockEntryAt(ctx, key, index)
+	if errors.Is(err, ErrNotFound) {
+		err = nil
+	}
+	return err
+}
+
+// LockFair calls DefaultLocker.LockFair.
+func LockFair(ctx context.Context, key string) (context.Context, context.CancelFunc) {
+	return DefaultLocker.LockFair(ctx, key)
+}
+
+// fetchLockQueue returns the entries of the lock queue under prefix, in the
+// order of their creation, waiting for the queue to change after index if it
+// is not zero.
+func (c *Client) fetchLockQueue(ctx context.Context, prefix string, index uint64) (entries []lockEntry, lastIndex uint64, err error) {
+	query := Query{{"recurse", ""}}
+	if index != 0 {
+		query = append(query, Param{"index", strconv.FormatUint(index, 10)})
+	}
+
+	meta, err := c.do(ctx, "GET", "/v1/kv/"+prefix, query, nil, &entries)
+	lastIndex = meta.index
+
+	// An empty queue is not an error, the entry of the caller is missing.
+	if errors.Is(err, ErrNotFound) {
+		entries, err = nil, nil
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreateIndex < entries[j].CreateIndex
+	})
+	return
+}
+
+// fetchLockEntryAt reads the entry of the lock on key, waiting for it to change
+// after index if it is not zero.
+func (c *Client) fetchLockEntryAt(ctx context.Context, key string, index uint64) (entry lockEntry, lastIndex uint64, err error) {
+	var query Query
+	if index != 0 {
+		query = Query{{"index", strconv.FormatUint(index, 10)}}
+	}
+
+	var entries []lockEntry
+	meta, err := c.do(ctx, "GET", "/v1/kv/"+key, query, nil, &entries)
+	lastIndex = meta.index
+
+	if len(entries) != 0 {
+		entry = entries[0]
+	}
+	return
+}
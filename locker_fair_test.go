@@ -0,0 +1,61 @@
+package consul_test
+
+import (
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestLockerLockFair(t *testing.T) {
+	agent, ctx := newFakeAgent(t)
+
+	locker := &consul.Locker{
+		Client:    agent.Client(),
+		LockDelay: 300 * time.Millisecond,
+	}
+
+	lock, unlock := locker.LockFair(ctx, "key")
+	if err := lock.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	queued := func() int {
+		return len(listKeys(t, agent, "key"+consul.FairLockQueue))
+	}
+
+	order := make(chan int, 3)
+
+	for i := 1; i <= 3; i++ {
+		go func(i int) {
+			lock, unlock := locker.LockFair(ctx, "key")
+			defer unlock()
+			if err := lock.Err(); err != nil {
+				t.Error(err)
+			}
+			order <- i
+		}(i)
+
+		// Each contender is enqueued before the next one starts.
+		for queued() != i {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	unlock()
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case n := <-order:
+			if n != i {
+				t.Errorf("contender %d acquired the lock in position %d", n, i)
+			}
+		case <-ctx.Done():
+			t.Fatal("the contenders did not acquire the lock")
+		}
+	}
+
+	if n := queued(); n != 0 {
+		t.Error("entries were left in the queue:", n)
+	}
+}
@@ -0,0 +1,102 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MultiLock acquires locks on all the given keys atomically, in a single
+// consul transaction. The method blocks until the locks were acquired, or the
+// context was canceled. The returned context behaves like the ones returned by
+// Lock.
+//
+// Lock acquires the keys one at a time, and releases them when one of the keys
+// is held by another session, so contenders locking overlapping sets of keys
+// may keep preventing each other from acquiring all of them. MultiLock never
+// holds a subset of the keys, the transaction acquires all the keys or none.
+//
+// Consul limits transactions to 64 operations, which is the maximum number of
+// keys that MultiLock can acquire.
+func (l *Locker) MultiLock(ctx context.Context, keys ...string) (context.Context, context.CancelFunc) {
+	if len(keys) == 0 {
+		return errorContext(ctx, Unlocked)
+	}
+
+	if len(keys) > maxTxnOps {
+		return errorContext(ctx, fmt.Errorf("consul: cannot lock %d keys in a single transaction, the maximum is %d", len(keys), maxTxnOps))
+	}
+
+	client := l.client()
+	clock := clockOrDefault(l.Clock)
+	retryInterval := 1 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		retryInterval = deadline.Sub(clock.Now()) / 10
+	}
+
+	keys = l.prefixKeys(sortedKeys(keys))
+	sessionCtx, sessionCancel := l.withSession(ctx, makeSessionName("multi-lock: ", keys...))
+
+	if sessionCtx.Err() != nil {
+		return sessionCtx, sessionCancel
+	}
+
+	session := contextSession(sessionCtx)
+
+	for {
+		if tokens, err := client.acquireLocks(sessionCtx, keys, session.ID); err == nil {
+			locks := make([]ctxCancel, len(keys))
+			for i, key := range keys {
+				lock := newLockCtx(sessionCtx, key, nil, client, tokens[i])
+				locks[i] = ctxCancel{lock, lock.cancel}
+			}
+
+			if len(locks) == 1 {
+				lock := locks[0]
+				return lock.ctx, func() { lock.cancel(); sessionCancel() }
+			}
+
+			multi := newMultiCtx(keys, locks)
+			return multi, func() { multi.cancel(); sessionCancel() }
+		}
+
+		if Sleep(sessionCtx, clock, retryInterval) != nil {
+			sessionCancel()
+			return errorContext(ctx, coalesceError(ctx.Err(), Unlocked))
+		}
+	}
+}
+
+// MultiLock calls DefaultLocker.MultiLock.
+func MultiLock(ctx context.Context, keys ...string) (context.Context, context.CancelFunc) {
+	return DefaultLocker.MultiLock(ctx, keys...)
+}
+
+// acquireLocks acquires locks on keys with a single transaction, returning the
+// fencing tokens of the keys. The transaction fails if any of the keys is held
+// by another session.
+func (c *Client) acquireLocks(ctx context.Context, keys []string, sid SessionID) (tokens []FencingToken, err error) {
+	ops := make([]txnOp, len(keys))
+	for i, key := range keys {
+		ops[i].KV = &txnKVOp{Verb: "lock", Key: key, Session: string(sid)}
+	}
+
+	var res txnResponse
+	if err = c.Put(ctx, "/v1/txn", nil, ops, &res); err != nil {
+		return
+	}
+
+	tokens = make([]FencingToken, len(keys))
+	for i, key := range keys {
+		tokens[i] = FencingToken{Key: key, Session: sid}
+
+		if i < len(res.Results) {
+			if kv := res.Results[i].KV; kv != nil {
+				tokens[i].LockIndex = uint64(kv.LockIndex)
+				tokens[i].ModifyIndex = uint64(kv.ModifyIndex)
+			}
+		}
+	}
+
+	return
+}
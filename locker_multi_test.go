@@ -0,0 +1,49 @@
+package consul_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestLockerMultiLock(t *testing.T) {
+	agent, ctx := newFakeAgent(t)
+
+	locker := &consul.Locker{
+		Client:    agent.Client(),
+		LockDelay: 300 * time.Millisecond,
+	}
+
+	lock, unlock := locker.MultiLock(ctx, "B", "A")
+	if err := lock.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := lock.Value(consul.LocksKey); !reflect.DeepEqual(keys, []string{"A", "B"}) {
+		t.Error("bad lock keys:", keys)
+	}
+	if tokens := consul.FencingTokens(lock); len(tokens) != 2 || tokens[0].String() != "A:1" || tokens[1].String() != "B:1" {
+		t.Error("bad fencing tokens:", tokens)
+	}
+
+	locked := make(chan error)
+	go func() {
+		lock, unlock := locker.MultiLock(ctx, "B", "C")
+		defer unlock()
+		locked <- lock.Err()
+	}()
+
+	// The contender must not hold C while B is locked.
+	time.Sleep(100 * time.Millisecond)
+	if keys := listKeys(t, agent, "C"); len(keys) != 0 {
+		t.Error("a key was locked by a transaction which failed:", keys)
+	}
+
+	unlock()
+
+	if err := <-locked; err != nil {
+		t.Error("the keys could not be locked after being released:", err)
+	}
+}
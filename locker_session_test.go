@@ -0,0 +1,59 @@
+package consul_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestLockerSessionStore(t *testing.T) {
+	agent, ctx := newFakeAgent(t)
+	store := &consul.SessionFile{Path: filepath.Join(t.TempDir(), "session")}
+
+	// Each locker stands for a process of the program, the first one crashes
+	// while holding the lock, so its session is neither destroyed nor removed
+	// from the store.
+	newLocker := func() *consul.Locker {
+		return &consul.Locker{
+			Client:       agent.Client(),
+			LockDelay:    time.Minute,
+			SessionStore: store,
+		}
+	}
+
+	lock1, unlock1 := newLocker().Lock(ctx, "key")
+	defer unlock1()
+	if err := lock1.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := store.LoadSessionID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := lock1.Value(consul.SessionKey).(consul.Session)
+	if saved != session.ID {
+		t.Fatalf("the session ID %q was not saved to the store: %q", session.ID, saved)
+	}
+
+	// Without re-adopting the session the lock could not be acquired before
+	// the session expired and its lock delay elapsed.
+	restartCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	lock2, unlock2 := newLocker().Lock(restartCtx, "key")
+	defer unlock2()
+	if err := lock2.Err(); err != nil {
+		t.Fatal("the lock was not re-acquired after the restart:", err)
+	}
+
+	if id := lock2.Value(consul.SessionKey).(consul.Session).ID; id != session.ID {
+		t.Errorf("the session %q was not re-adopted: %q", session.ID, id)
+	}
+	if tokens := consul.FencingTokens(lock2); len(tokens) != 1 || tokens[0].Session != session.ID {
+		t.Error("bad fencing tokens:", tokens)
+	}
+}
@@ -2,6 +2,10 @@ package consul
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -152,3 +156,73 @@ func TestLockLoseSession(t *testing.T) {
 		t.Error("bad error returned by the lock:", err)
 	}
 }
+
+func TestLockFencingTokens(t *testing.T) {
+	var lockIndex uint64
+	var holder atomic.Value
+	holder.Store("")
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		key := strings.TrimPrefix(req.URL.Path, "/v1/kv/")
+
+		switch {
+		case req.URL.Path == "/v1/session/create":
+			json.NewEncoder(res).Encode(struct{ ID string }{"1234"})
+
+		case req.Method == "PUT" && req.URL.Query().Get("acquire") != "":
+			atomic.AddUint64(&lockIndex, 1)
+			res.Write([]byte(`true`))
+
+		case req.Method == "GET" && key != req.URL.Path:
+			sid := holder.Load().(string)
+			if len(sid) == 0 {
+				sid = "1234"
+			}
+			index := atomic.LoadUint64(&lockIndex)
+			json.NewEncoder(res).Encode([]lockEntry{{
+				Key:         key,
+				Session:     sid,
+				LockIndex:   index,
+				ModifyIndex: 100 + index,
+			}})
+		}
+	})
+	defer server.Close()
+
+	locker := &Locker{Client: client, LockDelay: time.Second}
+	ctx := context.Background()
+
+	lock, unlock := locker.Lock(ctx, "B", "A")
+	if err := lock.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := FencingTokens(lock)
+	unlock()
+
+	if !reflect.DeepEqual(tokens, []FencingToken{
+		{Key: "A", Session: "1234", LockIndex: 1, ModifyIndex: 101},
+		{Key: "B", Session: "1234", LockIndex: 2, ModifyIndex: 102},
+	}) {
+		t.Errorf("bad fencing tokens: %+v", tokens)
+	}
+
+	if s := tokens[0].String(); s != "A:1" {
+		t.Error("bad fencing token string:", s)
+	}
+
+	if tokens := FencingTokens(ctx); tokens != nil {
+		t.Error("unexpected fencing tokens on a context without locks:", tokens)
+	}
+
+	// A lock which is held by another session when its index is read was
+	// lost before the token could be issued.
+	holder.Store("5678")
+
+	lock, unlock = locker.TryLockOne(ctx, "A")
+	defer unlock()
+
+	if lock.Err() == nil {
+		t.Error("expected the lock to fail when the key is held by another session")
+	}
+}
@@ -0,0 +1,18 @@
+package consul
+
+import (
+	"log"
+	"os"
+)
+
+// Logger is the interface used by the package to report diagnostic messages.
+// The standard *log.Logger satisfies this interface.
+//
+// Loggers must be safe to use concurrently from multiple goroutines.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// DefaultLogger is the logger used when none is configured, it writes to the
+// standard error output.
+var DefaultLogger Logger = log.New(os.Stderr, "consul: ", log.LstdFlags)
@@ -0,0 +1,185 @@
+package consul
+
+import (
+	"context"
+	"net"
+	"strconv"
+)
+
+// NodeQuery selects nodes of the consul catalog, and resolves them to network
+// addresses. It is intended to drive fleet automation, like running commands
+// over SSH on the nodes running a service:
+//
+//	targets, err := (&consul.NodeQuery{
+//		Service:     "api",
+//		OnlyPassing: true,
+//		AddressType: "wan",
+//	}).LookupNodes(ctx)
+//
+// Unlike a Resolver, which resolves services to the address and port that they
+// registered, a NodeQuery resolves the addresses of the nodes themselves.
+type NodeQuery struct {
+	// The client used to send requests to consul, which may be nil to indicate
+	// that the default client should be used.
+	Client *Client
+
+	// The datacenter to select nodes from, if empty the datacenter of the
+	// client is used.
+	Datacenter string
+
+	// If not empty, only nodes with all the given metadata are selected.
+	Meta map[string]string
+
+	// If not empty, only nodes running an instance of this service are
+	// selected.
+	Service string
+
+	// If not empty, only nodes running an instance of Service with all these
+	// tags are selected.
+	ServiceTags []string
+
+	// If true, only nodes whose node-level health checks (like the serf
+	// health check) are all passing are selected.
+	OnlyPassing bool
+
+	// The name of a node to sort the results by estimated round trip time
+	// from, "_agent" designates the node of the agent serving the query.
+	Near string
+
+	// The key of the tagged address to resolve nodes to, for example "wan",
+	// "lan_ipv4" or "wan_ipv6". Nodes without the tagged address resolve to
+	// their default address, which is also used if AddressType is empty.
+	AddressType string
+
+	// The port combined with node addresses. Defaults to 22.
+	Port int
+}
+
+// NodeTarget is a node selected by a NodeQuery.
+type NodeTarget struct {
+	// The node as registered in the consul catalog.
+	Node Node
+
+	// The address of the node, in the form host:port.
+	Addr string
+
+	// The aggregated status of the node-level health checks of the node (see
+	// AggregateHealth).
+	Health HealthStatus
+}
+
+// LookupNodes returns the nodes matching q. The nodes are returned in the order
+// of the catalog, or sorted by round trip time if q.Near is set.
+func (q *NodeQuery) LookupNodes(ctx context.Context) (targets []NodeTarget, err error) {
+	var nodes []Node
+	var checks map[string][]HealthCheck
+
+	if len(q.Service) != 0 {
+		nodes, checks, err = q.lookupServiceNodes(ctx)
+	} else {
+		nodes, checks, err = q.lookupNodes(ctx)
+	}
+
+	if err != nil {
+		return
+	}
+
+	port := strconv.Itoa(q.port())
+	targets = make([]NodeTarget, 0, len(nodes))
+
+	for _, node := range nodes {
+		health := AggregateHealth(checks[node.Node])
+
+		if q.OnlyPassing && health != Passing {
+			continue
+		}
+
+		address := node.Address
+		if a := node.TaggedAddresses[q.AddressType]; len(q.AddressType) != 0 && len(a) != 0 {
+			address = a
+		}
+
+		targets = append(targets, NodeTarget{
+			Node:   node,
+			Addr:   net.JoinHostPort(address, port),
+			Health: health,
+		})
+	}
+
+	return
+}
+
+func (q *NodeQuery) lookupNodes(ctx context.Context) (nodes []Node, checks map[string][]HealthCheck, err error) {
+	client := q.client()
+	opts := q.queryOptions()
+
+	if nodes, _, err = (&Catalog{Client: client}).Nodes(ctx, CatalogOptions{QueryOptions: opts, NodeMeta: q.Meta}); err != nil {
+		return
+	}
+
+	var list []HealthCheck
+	if err = client.Get(ctx, "/v1/health/state/any", QueryOptions{Datacenter: q.Datacenter}.Query(), &list); err != nil {
+		return
+	}
+
+	checks = make(map[string][]HealthCheck, len(nodes))
+	for _, check := range list {
+		if len(check.ServiceID) == 0 {
+			checks[check.Node] = append(checks[check.Node], check)
+		}
+	}
+
+	return
+}
+
+func (q *NodeQuery) lookupServiceNodes(ctx context.Context) (nodes []Node, checks map[string][]HealthCheck, err error) {
+	var entries []ServiceEntry
+
+	if entries, _, err = (&Health{Client: q.client()}).Service(ctx, q.Service, HealthOptions{
+		QueryOptions: q.queryOptions(),
+		Tags:         q.ServiceTags,
+		NodeMeta:     q.Meta,
+	}); err != nil {
+		return
+	}
+
+	checks = make(map[string][]HealthCheck, len(entries))
+
+	for _, entry := range entries {
+		// Nodes running multiple instances of the service are only returned
+		// once.
+		if _, seen := checks[entry.Node.Node]; seen {
+			continue
+		}
+
+		nodeChecks := []HealthCheck{}
+		for _, check := range entry.Checks {
+			if len(check.ServiceID) == 0 {
+				nodeChecks = append(nodeChecks, check)
+			}
+		}
+
+		nodes = append(nodes, entry.Node)
+		checks[entry.Node.Node] = nodeChecks
+	}
+
+	return
+}
+
+func (q *NodeQuery) queryOptions() QueryOptions {
+	return QueryOptions{Datacenter: q.Datacenter, Near: q.Near}
+}
+
+func (q *NodeQuery) client() *Client {
+	if client := q.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+func (q *NodeQuery) port() int {
+	if q.Port != 0 {
+		return q.Port
+	}
+	return 22
+}
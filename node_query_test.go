@@ -0,0 +1,101 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNodeQuery(t *testing.T) {
+	nodes := []Node{
+		{Node: "node-1", Address: "10.0.0.1", TaggedAddresses: map[string]string{"wan": "203.0.113.1"}},
+		{Node: "node-2", Address: "10.0.0.2"},
+		{Node: "node-3", Address: "10.0.0.3", TaggedAddresses: map[string]string{"wan": "203.0.113.3"}},
+	}
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/catalog/nodes":
+			if meta := req.URL.Query().Get("node-meta"); meta != "role:web" {
+				t.Error("bad node-meta parameter:", meta)
+			}
+			json.NewEncoder(res).Encode(nodes)
+
+		case "/v1/health/state/any":
+			json.NewEncoder(res).Encode([]HealthCheck{
+				{Node: "node-1", CheckID: "serfHealth", Status: Passing},
+				{Node: "node-2", CheckID: "serfHealth", Status: Critical},
+				{Node: "node-3", CheckID: "serfHealth", Status: Passing},
+				{Node: "node-3", CheckID: "service:web", ServiceID: "web", Status: Critical},
+			})
+
+		case "/v1/health/service/web":
+			if tag := req.URL.Query().Get("tag"); tag != "canary" {
+				t.Error("bad tag parameter:", tag)
+			}
+			json.NewEncoder(res).Encode([]ServiceEntry{
+				{Node: nodes[2], Service: ServiceInstance{ID: "web-1"}, Checks: []HealthCheck{
+					{Node: "node-3", CheckID: "serfHealth", Status: Warning},
+				}},
+				{Node: nodes[2], Service: ServiceInstance{ID: "web-2"}},
+				{Node: nodes[0], Service: ServiceInstance{ID: "web-3"}},
+			})
+
+		default:
+			t.Error("unexpected request:", req.URL.Path)
+		}
+	})
+	defer server.Close()
+
+	tests := []struct {
+		scenario string
+		query    NodeQuery
+		targets  []NodeTarget
+	}{
+		{
+			scenario: "nodes with metadata",
+			query:    NodeQuery{Meta: map[string]string{"role": "web"}},
+			targets: []NodeTarget{
+				{Node: nodes[0], Addr: "10.0.0.1:22", Health: Passing},
+				{Node: nodes[1], Addr: "10.0.0.2:22", Health: Critical},
+				{Node: nodes[2], Addr: "10.0.0.3:22", Health: Passing},
+			},
+		},
+		{
+			scenario: "passing nodes with WAN addresses",
+			query:    NodeQuery{Meta: map[string]string{"role": "web"}, OnlyPassing: true, AddressType: "wan", Port: 2222},
+			targets: []NodeTarget{
+				{Node: nodes[0], Addr: "203.0.113.1:2222", Health: Passing},
+				{Node: nodes[2], Addr: "203.0.113.3:2222", Health: Passing},
+			},
+		},
+		{
+			scenario: "nodes running a service",
+			query:    NodeQuery{Service: "web", ServiceTags: []string{"canary"}},
+			targets: []NodeTarget{
+				{Node: nodes[2], Addr: "10.0.0.3:22", Health: Warning},
+				{Node: nodes[0], Addr: "10.0.0.1:22", Health: Passing},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			query := test.query
+			query.Client = client
+
+			targets, err := query.LookupNodes(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(targets, test.targets) {
+				t.Error("bad targets:")
+				t.Logf("expected: %+v", test.targets)
+				t.Logf("found:    %+v", targets)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+// Package opencensusconsul integrates consul clients with OpenCensus, for
+// programs which report their metrics and traces with OpenCensus rather than
+// OpenTelemetry.
+//
+// Stats is an implementation of consul.Stats recording the metrics of clients,
+// resolvers, and sessions as OpenCensus measures, and Transport traces the
+// requests that clients send to their agent:
+//
+//	client, err := consul.NewClient(
+//		consul.WithStats(&opencensusconsul.Stats{}),
+//		consul.WithTransport(&opencensusconsul.Transport{}),
+//	)
+//
+// The package does not configure exporters, programs register the ones they
+// use, for example to send the spans to Zipkin with the exporter from
+// contrib.go.opencensus.io/exporter/zipkin:
+//
+//	reporter := zipkinhttp.NewReporter("http://zipkin:9411/api/v2/spans")
+//	endpoint, _ := openzipkin.NewEndpoint("my-service", "10.0.0.1:8080")
+//	trace.RegisterExporter(zipkin.NewExporter(reporter, endpoint))
+package opencensusconsul
@@ -0,0 +1,188 @@
+package opencensusconsul
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	consul "github.com/segmentio/consul-go"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// DefaultBuckets are the bounds of the distributions of Stats which don't
+// configure any, they are suited to durations in seconds.
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// Stats is an implementation of consul.Stats which records the metrics as
+// OpenCensus measures.
+//
+// A view is registered for each metric the first time it is reported, with the
+// tags it was reported with as tag keys: counters are aggregated as sums,
+// gauges as last values, and observed values as distributions. The measures
+// and views are named after the metrics, prefixed with the namespace, like
+// "consul/client.requests".
+//
+// The zero-value is a valid Stats, which is safe to use concurrently from
+// multiple goroutines.
+type Stats struct {
+	// The prefix of the names of measures and views. If empty, "consul" is
+	// used.
+	Namespace string
+
+	// The bounds of distributions, which must be sorted in increasing order.
+	// If nil, DefaultBuckets is used.
+	Buckets []float64
+
+	// ErrorHandler is called with the errors registering views or recording
+	// measures, which the consul.Stats interface has no way to return.
+	// If nil, consul.DefaultErrorHandler is used instead.
+	ErrorHandler func(error)
+
+	mutex    sync.Mutex
+	measures map[string]*measure
+}
+
+type measureKind int
+
+const (
+	counter measureKind = iota
+	gauge
+	distribution
+)
+
+type measure struct {
+	kind    measureKind
+	int64   *stats.Int64Measure
+	float64 *stats.Float64Measure
+	keys    map[string]tag.Key
+}
+
+// Count satisfies the consul.Stats interface.
+func (s *Stats) Count(name string, n int64, tags ...consul.Tag) {
+	if m := s.measure(name, counter, tags); m != nil {
+		s.record(m, m.int64.M(n), tags)
+	}
+}
+
+// Gauge satisfies the consul.Stats interface.
+func (s *Stats) Gauge(name string, value float64, tags ...consul.Tag) {
+	if m := s.measure(name, gauge, tags); m != nil {
+		s.record(m, m.float64.M(value), tags)
+	}
+}
+
+// Observe satisfies the consul.Stats interface.
+func (s *Stats) Observe(name string, value float64, tags ...consul.Tag) {
+	if m := s.measure(name, distribution, tags); m != nil {
+		s.record(m, m.float64.M(value), tags)
+	}
+}
+
+// measure returns the measure of the metric of the given name, registering it
+// if it was never reported before. Nil is returned if the metric was already
+// reported as another kind of metric, or could not be registered.
+func (s *Stats) measure(name string, kind measureKind, tags []consul.Tag) *measure {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if m, ok := s.measures[name]; ok {
+		if m == nil || m.kind != kind {
+			return nil
+		}
+		return m
+	}
+
+	if s.measures == nil {
+		s.measures = make(map[string]*measure)
+	}
+
+	m, err := s.register(name, kind, tags)
+	if err != nil {
+		s.handleError(fmt.Errorf("opencensusconsul: registering the view of %s: %w", name, err))
+	}
+
+	// Metrics which could not be registered are remembered as well, so the
+	// error is only reported once.
+	s.measures[name] = m
+	return m
+}
+
+func (s *Stats) register(name string, kind measureKind, tags []consul.Tag) (*measure, error) {
+	m := &measure{
+		kind: kind,
+		keys: make(map[string]tag.Key, len(tags)),
+	}
+
+	keys := make([]tag.Key, 0, len(tags))
+	for _, t := range tags {
+		k, err := tag.NewKey(t.Name)
+		if err != nil {
+			return nil, err
+		}
+		m.keys[t.Name] = k
+		keys = append(keys, k)
+	}
+
+	name = s.namespace() + "/" + name
+	v := &view.View{
+		Name:    name,
+		TagKeys: keys,
+	}
+
+	switch kind {
+	case counter:
+		m.int64 = stats.Int64(name, "", stats.UnitDimensionless)
+		v.Measure, v.Aggregation = m.int64, view.Sum()
+	case gauge:
+		m.float64 = stats.Float64(name, "", stats.UnitDimensionless)
+		v.Measure, v.Aggregation = m.float64, view.LastValue()
+	default:
+		m.float64 = stats.Float64(name, "", stats.UnitDimensionless)
+		v.Measure, v.Aggregation = m.float64, view.Distribution(s.buckets()...)
+	}
+
+	if err := view.Register(v); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (s *Stats) record(m *measure, measurement stats.Measurement, tags []consul.Tag) {
+	mutators := make([]tag.Mutator, 0, len(tags))
+
+	// Tags which were not set when the view was registered are not part of
+	// its keys, they are dropped instead of creating keys on every call.
+	for _, t := range tags {
+		if k, ok := m.keys[t.Name]; ok {
+			mutators = append(mutators, tag.Upsert(k, t.Value))
+		}
+	}
+
+	if err := stats.RecordWithTags(context.Background(), mutators, measurement); err != nil {
+		s.handleError(fmt.Errorf("opencensusconsul: recording %s: %w", measurement.Measure().Name(), err))
+	}
+}
+
+func (s *Stats) namespace() string {
+	if namespace := s.Namespace; len(namespace) != 0 {
+		return namespace
+	}
+	return "consul"
+}
+
+func (s *Stats) buckets() []float64 {
+	if buckets := s.Buckets; buckets != nil {
+		return buckets
+	}
+	return DefaultBuckets
+}
+
+func (s *Stats) handleError(err error) {
+	if handler := s.ErrorHandler; handler != nil {
+		handler(err)
+	} else if handler := consul.DefaultErrorHandler; handler != nil {
+		handler(err)
+	}
+}
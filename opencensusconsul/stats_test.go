@@ -0,0 +1,83 @@
+package opencensusconsul
+
+import (
+	"testing"
+
+	consul "github.com/segmentio/consul-go"
+	"go.opencensus.io/stats/view"
+)
+
+func TestStats(t *testing.T) {
+	stats := &Stats{Namespace: "test-stats"}
+
+	stats.Count("requests", 1, consul.Tag{Name: "route", Value: "/v1/kv"})
+	stats.Count("requests", 2, consul.Tag{Name: "route", Value: "/v1/kv"})
+	stats.Gauge("sessions", 3)
+	stats.Gauge("sessions", 4)
+	stats.Observe("duration", 0.02, consul.Tag{Name: "route", Value: "/v1/kv"})
+
+	rows := retrieve(t, "test-stats/requests")
+	if len(rows) != 1 {
+		t.Fatal("unexpected rows:", rows)
+	}
+	if tags := rows[0].Tags; len(tags) != 1 || tags[0].Key.Name() != "route" || tags[0].Value != "/v1/kv" {
+		t.Error("unexpected tags:", tags)
+	}
+	if sum := rows[0].Data.(*view.SumData).Value; sum != 3 {
+		t.Error("unexpected sum:", sum)
+	}
+
+	rows = retrieve(t, "test-stats/sessions")
+	if len(rows) != 1 {
+		t.Fatal("unexpected rows:", rows)
+	}
+	if value := rows[0].Data.(*view.LastValueData).Value; value != 4 {
+		t.Error("unexpected last value:", value)
+	}
+
+	rows = retrieve(t, "test-stats/duration")
+	if len(rows) != 1 {
+		t.Fatal("unexpected rows:", rows)
+	}
+	if data := rows[0].Data.(*view.DistributionData); data.Count != 1 || data.Mean != 0.02 {
+		t.Error("unexpected distribution:", data.Count, data.Mean)
+	}
+}
+
+func TestStatsKindMismatch(t *testing.T) {
+	var errs []error
+
+	stats := &Stats{
+		Namespace:    "test-stats-mismatch",
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	}
+
+	stats.Count("metric", 1)
+	stats.Gauge("metric", 2)
+
+	if sum := retrieve(t, "test-stats-mismatch/metric")[0].Data.(*view.SumData).Value; sum != 1 {
+		t.Error("unexpected sum:", sum)
+	}
+
+	// A view of the same name registered by another Stats with a different
+	// aggregation is reported once.
+	other := &Stats{
+		Namespace:    "test-stats-mismatch",
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	}
+	other.Gauge("metric", 1)
+	other.Gauge("metric", 2)
+
+	if len(errs) != 1 {
+		t.Error("unexpected errors:", errs)
+	}
+}
+
+func retrieve(t *testing.T, name string) []*view.Row {
+	t.Helper()
+	rows, err := view.RetrieveData(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
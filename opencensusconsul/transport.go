@@ -0,0 +1,135 @@
+package opencensusconsul
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/trace"
+)
+
+// Transport is a HTTP transport creating an OpenCensus span for each request
+// that clients send to their agent, as children of the spans carried by the
+// contexts of the requests.
+//
+// Spans are named after the method and the route of requests, which does not
+// include variable parts like keys or service names, for example
+// "consul GET /v1/health/service". They carry the attributes of ochttp spans,
+// and the request ID of requests when clients send one.
+//
+// Spans end when the responses are received, before their bodies are read.
+type Transport struct {
+	// The transport used to send the requests. If nil,
+	// consul.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// The name of the header carrying the request IDs, which must be the
+	// RequestIDHeader of the clients using the transport. The request IDs are
+	// set as the "consul.request_id" attribute of spans.
+	// If empty, the request IDs are not recorded.
+	RequestIDHeader string
+
+	// SlowRequestThreshold may be set to annotate the spans of requests which
+	// take longer than the threshold, like clients log them. The time blocking
+	// queries are expected to wait for changes is not counted.
+	// If zero, spans are not annotated.
+	SlowRequestThreshold time.Duration
+
+	// The sampler deciding whether requests are traced. If nil, the default
+	// sampler of the trace package is used.
+	Sampler trace.Sampler
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	options := []trace.StartOption{trace.WithSpanKind(trace.SpanKindClient)}
+	if sampler := t.Sampler; sampler != nil {
+		options = append(options, trace.WithSampler(sampler))
+	}
+
+	ctx, span := trace.StartSpan(req.Context(), "consul "+req.Method+" "+requestRoute(req.URL.Path), options...)
+	defer span.End()
+
+	query := req.URL.Query()
+	_, blocking := query["index"]
+
+	span.AddAttributes(
+		trace.StringAttribute(ochttp.MethodAttribute, req.Method),
+		trace.StringAttribute(ochttp.PathAttribute, req.URL.Path),
+		trace.StringAttribute(ochttp.HostAttribute, req.URL.Host),
+		trace.BoolAttribute("consul.blocking", blocking),
+	)
+
+	if dc := query.Get("dc"); len(dc) != 0 {
+		span.AddAttributes(trace.StringAttribute("consul.datacenter", dc))
+	}
+
+	if name := t.RequestIDHeader; len(name) != 0 {
+		if id := req.Header.Get(name); len(id) != 0 {
+			span.AddAttributes(trace.StringAttribute("consul.request_id", id))
+		}
+	}
+
+	start := time.Now()
+	res, err := t.base().RoundTrip(req.WithContext(ctx))
+
+	if threshold := t.SlowRequestThreshold; threshold > 0 {
+		elapsed, expected := time.Since(start), time.Duration(0)
+		if blocking {
+			expected = maxQueryWait(query.Get("wait"))
+		}
+		if elapsed-expected > threshold {
+			span.Annotate([]trace.Attribute{
+				trace.Int64Attribute("consul.slow_request_threshold_ms", threshold.Milliseconds()),
+			}, "slow request")
+		}
+	}
+
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnavailable, Message: err.Error()})
+		return nil, err
+	}
+
+	span.AddAttributes(trace.Int64Attribute(ochttp.StatusCodeAttribute, int64(res.StatusCode)))
+	span.SetStatus(ochttp.TraceStatus(res.StatusCode, res.Status))
+	return res, nil
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if base := t.Base; base != nil {
+		return base
+	}
+	return consul.DefaultTransport
+}
+
+// requestRoute returns the prefix of path made of the version, the API group,
+// and the operation, like the routes that clients tag their metrics with.
+func requestRoute(path string) string {
+	n := 4
+	if strings.HasPrefix(path, "/v1/kv/") {
+		n = 3
+	}
+
+	for i := 0; i != len(path); i++ {
+		if path[i] == '/' {
+			if n--; n == 0 {
+				return path[:i]
+			}
+		}
+	}
+
+	return path
+}
+
+// maxQueryWait returns the longest time that consul may hold a blocking query
+// sent with the given wait parameter, which defaults to 5 minutes, including
+// the random jitter that consul adds to the wait time.
+func maxQueryWait(param string) time.Duration {
+	wait := 5 * time.Minute
+	if d, err := time.ParseDuration(param); err == nil && d > 0 {
+		wait = d
+	}
+	return wait + wait/16
+}
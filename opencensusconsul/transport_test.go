@@ -0,0 +1,148 @@
+package opencensusconsul
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/trace"
+)
+
+type spanRecorder struct {
+	mutex sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(span *trace.SpanData) {
+	r.mutex.Lock()
+	r.spans = append(r.spans, span)
+	r.mutex.Unlock()
+}
+
+func (r *spanRecorder) take() []*trace.SpanData {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	spans := r.spans
+	r.spans = nil
+	return spans
+}
+
+func newRecorder(t *testing.T) *spanRecorder {
+	r := &spanRecorder{}
+	trace.RegisterExporter(r)
+	t.Cleanup(func() { trace.UnregisterExporter(r) })
+	return r
+}
+
+func TestTransport(t *testing.T) {
+	recorder := newRecorder(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		res.Header().Set("Content-Type", "application/json")
+		res.Write([]byte(`"dc1"`))
+	}))
+	defer server.Close()
+
+	client, err := consul.NewClient(
+		consul.WithAddress(server.URL),
+		consul.WithTransport(&Transport{
+			RequestIDHeader:      "X-Request-Id",
+			SlowRequestThreshold: time.Millisecond,
+			Sampler:              trace.AlwaysSample(),
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.RequestIDHeader = "X-Request-Id"
+
+	ctx, parent := trace.StartSpan(context.Background(), "parent", trace.WithSampler(trace.AlwaysSample()))
+	var leader string
+	if err := client.Get(ctx, "/v1/status/leader", nil, &leader); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := recorder.take()
+	if len(spans) != 2 {
+		t.Fatal("unexpected spans:", spans)
+	}
+	span := spans[0]
+
+	if span.Name != "consul GET /v1/status/leader" {
+		t.Error("unexpected span name:", span.Name)
+	}
+	if span.ParentSpanID != parent.SpanContext().SpanID {
+		t.Error("the span is not a child of the span of the context")
+	}
+	if span.SpanKind != trace.SpanKindClient {
+		t.Error("unexpected span kind:", span.SpanKind)
+	}
+	if code := span.Attributes[ochttp.StatusCodeAttribute]; code != int64(200) {
+		t.Error("unexpected status code:", code)
+	}
+	if id, _ := span.Attributes["consul.request_id"].(string); len(id) == 0 {
+		t.Error("the request ID was not recorded")
+	}
+	if len(span.Annotations) != 1 || span.Annotations[0].Message != "slow request" {
+		t.Error("the slow request was not annotated:", span.Annotations)
+	}
+}
+
+func TestTransportError(t *testing.T) {
+	recorder := newRecorder(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client, err := consul.NewClient(
+		consul.WithAddress(server.URL),
+		consul.WithTransport(&Transport{
+			SlowRequestThreshold: time.Minute,
+			Sampler:              trace.AlwaysSample(),
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Get(context.Background(), "/v1/kv/a/b/c", nil, nil); err == nil {
+		t.Fatal("no error returned")
+	}
+
+	spans := recorder.take()
+	if len(spans) != 1 {
+		t.Fatal("unexpected spans:", spans)
+	}
+	span := spans[0]
+
+	if span.Name != "consul GET /v1/kv" {
+		t.Error("unexpected span name:", span.Name)
+	}
+	if span.Status.Code != trace.StatusCodeNotFound {
+		t.Error("unexpected status:", span.Status)
+	}
+	if len(span.Annotations) != 0 {
+		t.Error("unexpected annotations:", span.Annotations)
+	}
+}
+
+func TestRequestRoute(t *testing.T) {
+	for path, route := range map[string]string{
+		"/v1/kv/a/b":             "/v1/kv",
+		"/v1/health/service/web": "/v1/health/service",
+		"/v1/status/leader":      "/v1/status/leader",
+	} {
+		if r := requestRoute(path); r != route {
+			t.Errorf("%s: %s != %s", path, r, route)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Operator exposes methods to manage the consul cluster, it is intended to be
+// used by operation tooling rather than applications.
+type Operator struct {
+	// The client used to send requests to the consul agent, which may be nil
+	// to indicate that a default client should be used.
+	Client *Client
+
+	// Allow read operations to hit any consul servers, not just the leader.
+	AllowStale bool
+}
+
+// RaftServer is a representation of a server participating in the raft quorum
+// of a consul datacenter.
+type RaftServer struct {
+	// The raft ID of the server.
+	ID string
+
+	// The node name of the server.
+	Node string
+
+	// The IP:port address of the server's raft endpoint.
+	Address string
+
+	// Set to true if the server is currently the leader.
+	Leader bool
+
+	// The raft protocol version used by the server.
+	ProtocolVersion string
+
+	// Set to true if the server is a voting member of the quorum.
+	Voter bool
+}
+
+// RaftConfiguration is a representation of the raft configuration of a consul
+// datacenter, which follows the structure documented at
+// https://www.consul.io/api/operator/raft.html#read-configuration
+type RaftConfiguration struct {
+	Servers []RaftServer
+	Index   uint64
+}
+
+// RaftConfiguration returns the current raft configuration of the datacenter.
+func (op *Operator) RaftConfiguration(ctx context.Context) (config RaftConfiguration, err error) {
+	err = op.client().Get(ctx, "/v1/operator/raft/configuration", op.query(), &config)
+	return
+}
+
+// RemoveRaftPeerByID removes the server with the given raft ID from the raft
+// configuration of the datacenter. This is typically used to remove dead
+// servers that could not leave the cluster gracefully.
+func (op *Operator) RemoveRaftPeerByID(ctx context.Context, id string) error {
+	return op.client().Delete(ctx, "/v1/operator/raft/peer", Query{{Name: "id", Value: id}}, nil)
+}
+
+// RemoveRaftPeerByAddress removes the server with the given IP:port address
+// from the raft configuration of the datacenter.
+func (op *Operator) RemoveRaftPeerByAddress(ctx context.Context, address string) error {
+	return op.client().Delete(ctx, "/v1/operator/raft/peer", Query{{Name: "address", Value: address}}, nil)
+}
+
+func (op *Operator) query() Query {
+	if op.AllowStale {
+		return Query{{Name: "stale", Value: "true"}}
+	}
+	return nil
+}
+
+func (op *Operator) client() *Client {
+	if client := op.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+// DefaultOperator is an operator configured to use the default client.
+var DefaultOperator = &Operator{}
+
+// AutopilotConfiguration is a representation of the autopilot settings of a
+// consul datacenter, which follows the structure documented at
+// https://www.consul.io/api/operator/autopilot.html#read-configuration
+type AutopilotConfiguration struct {
+	// Whether dead servers are automatically removed from the raft quorum when
+	// new servers are added.
+	CleanupDeadServers bool
+
+	// The maximum amount of time a server can go without contact from the
+	// leader before being considered unhealthy.
+	LastContactThreshold time.Duration
+
+	// The maximum number of log entries that a server can trail the leader by
+	// before being considered unhealthy.
+	MaxTrailingLogs uint64
+
+	// The minimum number of servers needed before autopilot can prune dead
+	// servers.
+	MinQuorum uint
+
+	// The minimum amount of time a server must be stable in the healthy state
+	// before being added to the cluster.
+	ServerStabilizationTime time.Duration
+
+	// Enterprise features, ignored by the open source version of consul.
+	RedundancyZoneTag       string
+	DisableUpgradeMigration bool
+	UpgradeVersionTag       string
+
+	// Raft indexes of the configuration, ModifyIndex is used to perform
+	// compare-and-swap updates.
+	CreateIndex uint64
+	ModifyIndex uint64
+}
+
+type autopilotConfiguration struct {
+	CleanupDeadServers      bool
+	LastContactThreshold    duration
+	MaxTrailingLogs         uint64
+	MinQuorum               uint
+	ServerStabilizationTime duration
+	RedundancyZoneTag       string
+	DisableUpgradeMigration bool
+	UpgradeVersionTag       string
+	CreateIndex             uint64
+	ModifyIndex             uint64
+}
+
+// MarshalJSON satisfies the json.Marshaler interface.
+func (config AutopilotConfiguration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(autopilotConfiguration{
+		CleanupDeadServers:      config.CleanupDeadServers,
+		LastContactThreshold:    duration(config.LastContactThreshold),
+		MaxTrailingLogs:         config.MaxTrailingLogs,
+		MinQuorum:               config.MinQuorum,
+		ServerStabilizationTime: duration(config.ServerStabilizationTime),
+		RedundancyZoneTag:       config.RedundancyZoneTag,
+		DisableUpgradeMigration: config.DisableUpgradeMigration,
+		UpgradeVersionTag:       config.UpgradeVersionTag,
+		CreateIndex:             config.CreateIndex,
+		ModifyIndex:             config.ModifyIndex,
+	})
+}
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface.
+func (config *AutopilotConfiguration) UnmarshalJSON(b []byte) error {
+	var c autopilotConfiguration
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return err
+	}
+
+	*config = AutopilotConfiguration{
+		CleanupDeadServers:      c.CleanupDeadServers,
+		LastContactThreshold:    time.Duration(c.LastContactThreshold),
+		MaxTrailingLogs:         c.MaxTrailingLogs,
+		MinQuorum:               c.MinQuorum,
+		ServerStabilizationTime: time.Duration(c.ServerStabilizationTime),
+		RedundancyZoneTag:       c.RedundancyZoneTag,
+		DisableUpgradeMigration: c.DisableUpgradeMigration,
+		UpgradeVersionTag:       c.UpgradeVersionTag,
+		CreateIndex:             c.CreateIndex,
+		ModifyIndex:             c.ModifyIndex,
+	}
+	return nil
+}
+
+// AutopilotConfiguration returns the current autopilot configuration of the
+// datacenter.
+func (op *Operator) AutopilotConfiguration(ctx context.Context) (config AutopilotConfiguration, err error) {
+	err = op.client().Get(ctx, "/v1/operator/autopilot/configuration", op.query(), &config)
+	return
+}
+
+// SetAutopilotConfiguration updates the autopilot configuration of the
+// datacenter.
+//
+// If index is set to a positive value, it is used to turn the update into a
+// compare-and-swap operation. The configuration will only be updated if its
+// last modification index matches the given index. The method returns a
+// boolean that indicates whether the update succeeded.
+func (op *Operator) SetAutopilotConfiguration(ctx context.Context, config AutopilotConfiguration, index int64) (ok bool, err error) {
+	var query Query
+
+	if index > 0 {
+		query = append(query, Param{
+			Name:  "cas",
+			Value: strconv.FormatInt(index, 10),
+		})
+	}
+
+	err = op.client().Put(ctx, "/v1/operator/autopilot/configuration", query, config, &ok)
+	return
+}
+
+// ServerHealth is a representation of the health of a consul server as seen by
+// autopilot.
+type ServerHealth struct {
+	ID          string
+	Name        string
+	Address     string
+	SerfStatus  string
+	Version     string
+	Leader      bool
+	LastContact time.Duration
+	LastTerm    uint64
+	LastIndex   uint64
+	Healthy     bool
+	Voter       bool
+	StableSince time.Time
+}
+
+type serverHealth struct {
+	ID          string
+	Name        string
+	Address     string
+	SerfStatus  string
+	Version     string
+	Leader      bool
+	LastContact duration
+	LastTerm    uint64
+	LastIndex   uint64
+	Healthy     bool
+	Voter       bool
+	StableSince time.Time
+}
+
+// UnmarshalJSON satisfies the json.Unmarshaler interface.
+func (health *ServerHealth) UnmarshalJSON(b []byte) error {
+	var h serverHealth
+
+	if err := json.Unmarshal(b, &h); err != nil {
+		return err
+	}
+
+	*health = ServerHealth{
+		ID:          h.ID,
+		Name:        h.Name,
+		Address:     h.Address,
+		SerfStatus:  h.SerfStatus,
+		Version:     h.Version,
+		Leader:      h.Leader,
+		LastContact: time.Duration(h.LastContact),
+		LastTerm:    h.LastTerm,
+		LastIndex:   h.LastIndex,
+		Healthy:     h.Healthy,
+		Voter:       h.Voter,
+		StableSince: h.StableSince,
+	}
+	return nil
+}
+
+// AutopilotHealth is a representation of the health of the consul servers of
+// a datacenter, which follows the structure documented at
+// https://www.consul.io/api/operator/autopilot.html#read-health
+type AutopilotHealth struct {
+	Healthy          bool
+	FailureTolerance int
+	Servers          []ServerHealth
+}
+
+// AutopilotHealth returns the health of the consul servers of the datacenter.
+func (op *Operator) AutopilotHealth(ctx context.Context) (health AutopilotHealth, err error) {
+	err = op.client().Get(ctx, "/v1/operator/autopilot/health", op.query(), &health)
+	return
+}
@@ -0,0 +1,159 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOperator(t *testing.T) {
+	t.Run("RaftConfiguration", testOperatorRaftConfiguration)
+	t.Run("RemoveRaftPeer", testOperatorRemoveRaftPeer)
+	t.Run("AutopilotConfiguration", testOperatorAutopilotConfiguration)
+	t.Run("AutopilotHealth", testOperatorAutopilotHealth)
+}
+
+func testOperatorRaftConfiguration(t *testing.T) {
+	config := RaftConfiguration{
+		Servers: []RaftServer{
+			{ID: "a", Node: "node-a", Address: "10.0.0.1:8300", Leader: true, ProtocolVersion: "3", Voter: true},
+			{ID: "b", Node: "node-b", Address: "10.0.0.2:8300", ProtocolVersion: "3", Voter: true},
+		},
+		Index: 42,
+	}
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/operator/raft/configuration" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		if stale := req.URL.Query().Get("stale"); stale != "true" {
+			t.Error("bad stale parameter:", stale)
+		}
+		json.NewEncoder(res).Encode(config)
+	})
+	defer server.Close()
+
+	op := &Operator{Client: client, AllowStale: true}
+
+	found, err := op.RaftConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found, config) {
+		t.Error("bad raft configuration:", found)
+	}
+}
+
+func testOperatorRemoveRaftPeer(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != "DELETE" {
+			t.Error("bad method:", req.Method)
+		}
+		if req.URL.Path != "/v1/operator/raft/peer" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		q := req.URL.Query()
+		if q.Get("id") != "a" && q.Get("address") != "10.0.0.1:8300" {
+			t.Error("bad URL query:", req.URL.RawQuery)
+		}
+	})
+	defer server.Close()
+
+	op := &Operator{Client: client}
+
+	if err := op.RemoveRaftPeerByID(context.Background(), "a"); err != nil {
+		t.Error(err)
+	}
+	if err := op.RemoveRaftPeerByAddress(context.Background(), "10.0.0.1:8300"); err != nil {
+		t.Error(err)
+	}
+}
+
+func testOperatorAutopilotConfiguration(t *testing.T) {
+	config := AutopilotConfiguration{
+		CleanupDeadServers:      true,
+		LastContactThreshold:    200 * time.Millisecond,
+		MaxTrailingLogs:         250,
+		ServerStabilizationTime: 10 * time.Second,
+		ModifyIndex:             42,
+	}
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/operator/autopilot/configuration" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+
+		switch req.Method {
+		case "GET":
+			res.Write([]byte(`{
+				"CleanupDeadServers": true,
+				"LastContactThreshold": "200ms",
+				"MaxTrailingLogs": 250,
+				"ServerStabilizationTime": "10s",
+				"ModifyIndex": 42
+			}`))
+
+		case "PUT":
+			var found AutopilotConfiguration
+			if err := json.NewDecoder(req.Body).Decode(&found); err != nil {
+				t.Error(err)
+			}
+			if !reflect.DeepEqual(found, config) {
+				t.Error("bad autopilot configuration sent:", found)
+			}
+			if cas := req.URL.Query().Get("cas"); cas != "42" {
+				t.Error("bad cas parameter:", cas)
+			}
+			json.NewEncoder(res).Encode(true)
+		}
+	})
+	defer server.Close()
+
+	op := &Operator{Client: client}
+
+	found, err := op.AutopilotConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(found, config) {
+		t.Error("bad autopilot configuration:", found)
+	}
+
+	ok, err := op.SetAutopilotConfiguration(context.Background(), found, int64(found.ModifyIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("the autopilot configuration was not updated")
+	}
+}
+
+func testOperatorAutopilotHealth(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/operator/autopilot/health" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		res.Write([]byte(`{
+			"Healthy": true,
+			"FailureTolerance": 1,
+			"Servers": [{"ID": "a", "Name": "node-a", "LastContact": "10ms", "Healthy": true, "Voter": true}]
+		}`))
+	})
+	defer server.Close()
+
+	op := &Operator{Client: client}
+
+	health, err := op.AutopilotHealth(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !health.Healthy || health.FailureTolerance != 1 || len(health.Servers) != 1 {
+		t.Fatal("bad autopilot health:", health)
+	}
+	if s := health.Servers[0]; s.ID != "a" || s.LastContact != 10*time.Millisecond || !s.Healthy {
+		t.Error("bad server health:", s)
+	}
+}
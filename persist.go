@@ -0,0 +1,297 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPersistInterval is the minimum time between two writes of the file
+// that a ResolverCache persists its entries to, when it has no interval
+// configured.
+const DefaultPersistInterval = 10 * time.Second
+
+// resolverCacheFile is the on-disk representation of a ResolverCache.
+type resolverCacheFile struct {
+	Services map[string]resolverCacheFileEntry `json:"services"`
+}
+
+type resolverCacheFileEntry struct {
+	FetchedAt time.Time           `json:"fetched_at"`
+	Index     uint64              `json:"index,omitempty"`
+	Endpoints []persistedEndpoint `json:"endpoints"`
+}
+
+type persistedEndpoint struct {
+	ID     string            `json:"id,omitempty"`
+	Node   string            `json:"node,omitempty"`
+	Addr   string            `json:"addr"`
+	Tags   []string          `json:"tags,omitempty"`
+	Meta   map[string]string `json:"meta,omitempty"`
+	RTT    time.Duration     `json:"rtt,omitempty"`
+	Health HealthStatus      `json:"health,omitempty"`
+	Weight float64           `json:"weight,omitempty"`
+}
+
+// Save writes the endpoints held by the cache to the file at path, replacing
+// it atomically. Entries of lookups which failed are not saved.
+//
+// Programs persisting the cache with PersistPath should call Save when they
+// shut down, the last updates of the cache may not have been written yet.
+func (cache *ResolverCache) Save(path string) error {
+	file := resolverCacheFile{Services: make(map[string]resolverCacheFileEntry)}
+
+	for name, entry := range cache.cache() {
+		if entry.err != nil {
+			continue
+		}
+
+		endpoints := make([]persistedEndpoint, 0, len(entry.res))
+
+		for _, e := range entry.res {
+			if e.Addr == nil {
+				continue
+			}
+			endpoints = append(endpoints, persistedEndpoint{
+				ID:     e.ID,
+				Node:   e.Node,
+				Addr:   e.Addr.String(),
+				Tags:   e.Tags,
+				Meta:   e.Meta,
+				RTT:    e.RTT,
+				Health: e.Health,
+				Weight: e.Weight,
+			})
+		}
+
+		file.Services[name] = resolverCacheFileEntry{
+			FetchedAt: entry.fetchedAt,
+			Index:     entry.index,
+			Endpoints: endpoints,
+		}
+	}
+
+	b, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	return replaceFile(path, b)
+}
+
+// Load reads the endpoints saved to the file at path by Save, and adds them to
+// the cache. Services which already have an entry in the cache are left
+// unchanged.
+//
+// The loaded entries are expired, the services are resolved again on their
+// first lookup, and the loaded endpoints are only served when resolving them
+// fails, as long as they are not older than MaxStaleness. Loading a file in a
+// cache which has no MaxStaleness configured has no effect.
+func (cache *ResolverCache) Load(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file resolverCacheFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		return fmt.Errorf("consul: decoding the resolver cache file %s: %w", path, err)
+	}
+
+	now := clockOrDefault(cache.Clock).Now()
+
+	for {
+		oldCache := cache.load()
+		newCache := oldCache.copy()
+
+		for name, saved := range file.Services {
+			if _, exists := newCache[name]; exists {
+				continue
+			}
+
+			endpoints := make([]Endpoint, len(saved.Endpoints))
+
+			for i, e := range saved.Endpoints {
+				endpoints[i] = Endpoint{
+					ID:     e.ID,
+					Node:   e.Node,
+					Addr:   serviceAddr(e.Addr),
+					Tags:   e.Tags,
+					Meta:   e.Meta,
+					RTT:    e.RTT,
+					Health: e.Health,
+					Weight: e.Weight,
+				}
+			}
+
+			// The zero expiration time makes the entries expired, so they
+			// only serve as a fallback to failed lookups.
+			newCache[name] = &resolverEntry{
+				lastUse:   now.UnixNano(),
+				res:       endpoints,
+				fetchedAt: saved.FetchedAt,
+				index:     saved.Index,
+			}
+		}
+
+		if cache.compareAndSwap(oldCache, &newCache) {
+			return nil
+		}
+	}
+}
+
+func (cache *ResolverCache) persistInterval() time.Duration {
+	if interval := cache.PersistInterval; interval > 0 {
+		return interval
+	}
+	return DefaultPersistInterval
+}
+
+// restore loads the file at PersistPath the first time that the cache is used.
+func (cache *ResolverCache) restore() {
+	cache.restored.Do(func() {
+		if err := cache.Load(cache.PersistPath); err != nil && !os.IsNotExist(err) {
+			cache.handleError(fmt.Errorf("consul: restoring the resolver cache from %s: %w", cache.PersistPath, err))
+		}
+	})
+}
+
+// persist writes the cache to PersistPath in the background, unless it was
+// written less than PersistInterval ago or a write is already in progress.
+func (cache *ResolverCache) persist() {
+	now := clockOrDefault(cache.Clock).Now().UnixNano()
+
+	if time.Duration(now-atomic.LoadInt64(&cache.persistedAt)) < cache.persistInterval() {
+		return
+	}
+
+	if !atomic.CompareAndSwapUint32(&cache.persisting, 0, 1) {
+		return
+	}
+
+	atomic.StoreInt64(&cache.persistedAt, now)
+
+	go func() {
+		defer atomic.StoreUint32(&cache.persisting, 0)
+
+		if err := cache.Save(cache.PersistPath); err != nil {
+			cache.handleError(fmt.Errorf("consul: persisting the resolver cache to %s: %w", cache.PersistPath, err))
+		}
+	}()
+}
+
+// KVSnapshotFile persists the values read from the key/value store to a file,
+// so programs which get their configuration from consul can start with the
+// last values they have seen when the agent is unavailable.
+//
+// The Watch method wraps the handler of a watch, for example:
+//
+//	snapshot := consul.KVSnapshotFile{Path: "/var/cache/my-service/config.json"}
+//
+//	consul.WatchPrefix(ctx, "my-service/config", snapshot.Watch(func(data []consul.KeyData, err error) {
+//		...
+//	}))
+type KVSnapshotFile struct {
+	// The path of the file that the snapshot is saved to.
+	Path string
+
+	// ErrorHandler is called with the errors of saving snapshots. If nil,
+	// DefaultErrorHandler is used.
+	ErrorHandler func(error)
+}
+
+// Save writes data to the snapshot file, replacing it atomically.
+func (f *KVSnapshotFile) Save(data []KeyData) error {
+	if data == nil {
+		data = []KeyData{}
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return replaceFile(f.Path, b)
+}
+
+// Load reads the data last written to the snapshot file.
+func (f *KVSnapshotFile) Load() (data []KeyData, err error) {
+	b, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, &data); err != nil {
+		err = fmt.Errorf("consul: decoding the key/value snapshot file %s: %w", f.Path, err)
+	}
+	return
+}
+
+// Watch returns a WatcherFunc which saves the data of each update to the
+// snapshot file before passing it to handler.
+//
+// When the watch fails before receiving its first update, the data loaded
+// from the snapshot file is passed to handler instead of the error, if the
+// file exists. Later errors are passed to handler unchanged.
+func (f *KVSnapshotFile) Watch(handler WatcherFunc) WatcherFunc {
+	updated := false
+
+	return func(data []KeyData, err error) {
+		if err == nil {
+			updated = true
+
+			if saveErr := f.Save(data); saveErr != nil {
+				f.handleError(fmt.Errorf("consul: saving the key/value snapshot to %s: %w", f.Path, saveErr))
+			}
+
+			handler(data, nil)
+			return
+		}
+
+		if !updated {
+			updated = true
+
+			if snapshot, loadErr := f.Load(); loadErr == nil {
+				f.handleError(fmt.Errorf("consul: using the key/value snapshot of %s: %w", f.Path, err))
+				handler(snapshot, nil)
+				return
+			}
+		}
+
+		handler(nil, err)
+	}
+}
+
+func (f *KVSnapshotFile) handleError(err error) {
+	if handler := f.ErrorHandler; handler != nil {
+		handler(err)
+	} else {
+		handleError(err)
+	}
+}
+
+// replaceFile replaces the file at path with b, so readers never observe a
+// partially written version.
+func replaceFile(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,134 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolverCachePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolver.json")
+	clock := &manualClock{now: time.Unix(1000, 0)}
+
+	endpoints := []Endpoint{{
+		ID:     "web-1",
+		Node:   "node-1",
+		Addr:   newServiceAddr("10.0.0.1", 80),
+		Tags:   []string{"primary"},
+		Meta:   map[string]string{"version": "2"},
+		RTT:    time.Millisecond,
+		Health: Passing,
+	}}
+
+	lookup := func(ctx context.Context, name string) ([]Endpoint, error) {
+		return endpoints, nil
+	}
+
+	failing := func(ctx context.Context, name string) ([]Endpoint, error) {
+		return nil, errors.New("agent unreachable")
+	}
+
+	ctx := context.Background()
+
+	t.Run("entries are written to the persist path", func(t *testing.T) {
+		cache := &ResolverCache{PersistPath: path, Clock: clock}
+
+		if _, err := cache.LookupService(ctx, "web", lookup); err != nil {
+			t.Fatal(err)
+		}
+
+		// The file is written in the background.
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+			if _, err := os.Stat(path); err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("the cache was not persisted")
+			}
+		}
+
+		if err := cache.Save(path); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("a restarted cache serves the persisted endpoints when lookups fail", func(t *testing.T) {
+		clock.now = clock.now.Add(time.Minute)
+
+		status := &LookupStatus{}
+		cache := &ResolverCache{
+			PersistPath:  path,
+			MaxStaleness: time.Hour,
+			Clock:        clock,
+			ErrorHandler: func(error) {},
+		}
+
+		res, err := cache.LookupService(ContextWithLookupStatus(ctx, status), "web", failing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(res, endpoints) {
+			t.Errorf("bad endpoints:\n%#v\n%#v", res, endpoints)
+		}
+		if !status.Stale || status.Age != time.Minute {
+			t.Errorf("bad lookup status: %+v", status)
+		}
+	})
+
+	t.Run("persisted endpoints are not served past the maximum staleness", func(t *testing.T) {
+		cache := &ResolverCache{MaxStaleness: 30 * time.Second, Clock: clock}
+
+		if err := cache.Load(path); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cache.LookupService(ctx, "web", failing); err == nil {
+			t.Error("expected an error resolving endpoints older than the maximum staleness")
+		}
+	})
+}
+
+func TestKVSnapshotFile(t *testing.T) {
+	snapshot := &KVSnapshotFile{
+		Path:         filepath.Join(t.TempDir(), "config.json"),
+		ErrorHandler: func(error) {},
+	}
+
+	data := []KeyData{{Key: "config/timeout", Value: []byte("5s"), ModifyIndex: 42}}
+	unavailable := errors.New("agent unavailable")
+
+	var received [][]KeyData
+	var errs []error
+
+	handler := func(data []KeyData, err error) {
+		received = append(received, data)
+		errs = append(errs, err)
+	}
+
+	// Without a snapshot, the errors are passed through.
+	snapshot.Watch(handler)(nil, unavailable)
+
+	if errs[0] != unavailable {
+		t.Error("bad error:", errs[0])
+	}
+
+	watch := snapshot.Watch(handler)
+	watch(data, nil)
+
+	// A new watch failing before its first update gets the snapshot, later
+	// errors are passed through.
+	received, errs = nil, nil
+	watch = snapshot.Watch(handler)
+	watch(nil, unavailable)
+	watch(nil, unavailable)
+
+	if !reflect.DeepEqual(received, [][]KeyData{data, nil}) {
+		t.Errorf("bad data received: %+v", received)
+	}
+	if !reflect.DeepEqual(errs, []error{nil, unavailable}) {
+		t.Error("bad errors received:", errs)
+	}
+}
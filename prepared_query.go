@@ -0,0 +1,64 @@
+package consul
+
+import "context"
+
+// PreparedQueries exposes methods to execute consul prepared queries.
+type PreparedQueries struct {
+	// The client used to send requests to the consul agent, which may be nil
+	// to indicate that a default client should be used.
+	Client *Client
+}
+
+// PreparedQueryResult is the result of executing a prepared query, which
+// follows the structure documented at
+// https://www.consul.io/api/query.html#execute-prepared-query
+type PreparedQueryResult struct {
+	// The name of the service that the query resolved to.
+	Service string
+
+	// The healthy instances of the service, which may be in a different
+	// datacenter than the local one if the query failed over.
+	Nodes []ServiceEntry
+
+	// The DNS configuration of the query.
+	DNS struct {
+		TTL string
+	}
+
+	// The datacenter that the instances were found in, and the number of
+	// remote datacenters that were tried before finding healthy instances.
+	Datacenter string
+	Failovers  int
+}
+
+// Endpoints returns the instances of the query result as endpoints.
+func (res PreparedQueryResult) Endpoints() []Endpoint {
+	endpoints := make([]Endpoint, len(res.Nodes))
+	for i, node := range res.Nodes {
+		endpoints[i] = node.Endpoint()
+	}
+	return endpoints
+}
+
+// Execute executes the prepared query of the given name or ID.
+func (q *PreparedQueries) Execute(ctx context.Context, query string) (res PreparedQueryResult, err error) {
+	err = q.client().Get(ctx, "/v1/query/"+query+"/execute", nil, &res)
+	return
+}
+
+func (q *PreparedQueries) client() *Client {
+	if client := q.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+// DefaultPreparedQueries is a prepared queries endpoint configured to use the
+// default client.
+var DefaultPreparedQueries = &PreparedQueries{}
+
+// ExecutePreparedQuery is a helper function that delegates to the default
+// prepared queries endpoint.
+func ExecutePreparedQuery(ctx context.Context, query string) (PreparedQueryResult, error) {
+	return DefaultPreparedQueries.Execute(ctx, query)
+}
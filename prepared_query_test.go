@@ -0,0 +1,41 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestExecutePreparedQuery(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/query/db-failover/execute" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		json.NewEncoder(res).Encode(PreparedQueryResult{
+			Service: "db",
+			Nodes: []ServiceEntry{{
+				Node:    Node{Node: "node-1"},
+				Service: ServiceInstance{ID: "db-1", Service: "db", Address: "10.0.0.1", Port: 5432},
+			}},
+			Datacenter: "dc2",
+			Failovers:  1,
+		})
+	})
+	defer server.Close()
+
+	queries := &PreparedQueries{Client: client}
+
+	res, err := queries.Execute(context.Background(), "db-failover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Datacenter != "dc2" || res.Failovers != 1 {
+		t.Errorf("bad prepared query result: %+v", res)
+	}
+
+	endpoints := res.Endpoints()
+	if len(endpoints) != 1 || endpoints[0].Addr.String() != "10.0.0.1:5432" {
+		t.Error("bad endpoints:", endpoints)
+	}
+}
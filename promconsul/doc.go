@@ -0,0 +1,3 @@
+// Package promconsul provides extensions to integrate consul service discovery
+// with Prometheus.
+package promconsul
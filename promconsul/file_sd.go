@@ -0,0 +1,227 @@
+package promconsul
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+// DefaultInterval is the interval at which FileSD resolves services when it
+// has no interval set.
+const DefaultInterval = 30 * time.Second
+
+// TargetGroup is a group of targets in the Prometheus file_sd_config format.
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// FileSD continuously writes the endpoints of services to a file in the format
+// of Prometheus file_sd_config, enabling Prometheus to discover the services
+// without a consul_sd_config.
+//
+// Targets are labeled like consul_sd_config would, so existing relabeling
+// rules keep working:
+//
+//	__meta_consul_service           the name of the service
+//	__meta_consul_service_id        the ID of the service instance
+//	__meta_consul_node              the node running the instance
+//	__meta_consul_tags              the tags of the instance, joined by commas
+//	                                and enclosed in commas (",a,b,")
+//	__meta_consul_metadata_<key>    the metadata of the node
+//	__meta_consul_health            the health status of the instance
+//
+// Since the services are resolved by a resolver, its filters apply.
+type FileSD struct {
+	// The path of the file to write, which is replaced atomically on every
+	// change.
+	Path string
+
+	// The names of the services to write the endpoints of.
+	Services []string
+
+	// The resolver used to lookup services. If nil, consul.DefaultResolver is
+	// used.
+	Resolver consul.Lookuper
+
+	// The interval at which services are resolved, and the file is rewritten
+	// if they changed. If zero, DefaultInterval is used.
+	Interval time.Duration
+
+	// If not nil, returns additional labels for targets, which take
+	// precedence over the default labels.
+	Labels func(service string, endpoint consul.Endpoint) map[string]string
+
+	// The error handler called when Run fails to update the file, if nil
+	// consul.DefaultErrorHandler is used.
+	ErrorHandler func(error)
+}
+
+// Run writes the file, then updates it on every interval, until ctx is
+// canceled. Failures to resolve services or to write the file are reported to
+// the error handler, and retried on the next interval; the previous version of
+// the file is left unchanged until then.
+//
+// Run returns the error of ctx when it is canceled.
+func (f *FileSD) Run(ctx context.Context) error {
+	var last []byte
+
+	ticker := time.NewTicker(f.interval())
+	defer ticker.Stop()
+
+	for {
+		b, err := f.render(ctx)
+
+		if err == nil && !bytes.Equal(b, last) {
+			if err = writeFile(f.Path, b); err == nil {
+				last = b
+			}
+		}
+
+		if err != nil && ctx.Err() == nil {
+			f.handleError(fmt.Errorf("promconsul: updating %s: %w", f.Path, err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// WriteFile resolves the services and writes the file once.
+func (f *FileSD) WriteFile(ctx context.Context) error {
+	b, err := f.render(ctx)
+	if err != nil {
+		return err
+	}
+	return writeFile(f.Path, b)
+}
+
+// TargetGroups resolves the services and returns the target groups written to
+// the file, there is one group per endpoint since their labels differ.
+func (f *FileSD) TargetGroups(ctx context.Context) ([]TargetGroup, error) {
+	groups := []TargetGroup{}
+
+	for _, service := range f.Services {
+		endpoints, err := f.resolver().LookupService(ctx, service)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, endpoint := range endpoints {
+			if endpoint.Addr == nil {
+				continue
+			}
+			groups = append(groups, TargetGroup{
+				Targets: []string{endpoint.Addr.String()},
+				Labels:  f.labels(service, endpoint),
+			})
+		}
+	}
+
+	// The resolver may shuffle endpoints, sorting them avoids rewriting the
+	// file when the set of targets did not change.
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if sa, sb := a.Labels["__meta_consul_service"], b.Labels["__meta_consul_service"]; sa != sb {
+			return sa < sb
+		}
+		return a.Targets[0] < b.Targets[0]
+	})
+
+	return groups, nil
+}
+
+func (f *FileSD) render(ctx context.Context) ([]byte, error) {
+	groups, err := f.TargetGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(groups, "", "  ")
+}
+
+func (f *FileSD) labels(service string, endpoint consul.Endpoint) map[string]string {
+	labels := map[string]string{
+		"__meta_consul_service":    service,
+		"__meta_consul_service_id": endpoint.ID,
+		"__meta_consul_node":       endpoint.Node,
+		"__meta_consul_tags":       "," + strings.Join(endpoint.Tags, ",") + ",",
+	}
+
+	if len(endpoint.Health) != 0 {
+		labels["__meta_consul_health"] = string(endpoint.Health)
+	}
+
+	for key, value := range endpoint.Meta {
+		labels["__meta_consul_metadata_"+key] = value
+	}
+
+	if f.Labels != nil {
+		for key, value := range f.Labels(service, endpoint) {
+			labels[key] = value
+		}
+	}
+
+	return labels
+}
+
+func (f *FileSD) resolver() consul.Lookuper {
+	if f.Resolver != nil {
+		return f.Resolver
+	}
+	return consul.DefaultResolver
+}
+
+func (f *FileSD) interval() time.Duration {
+	if f.Interval > 0 {
+		return f.Interval
+	}
+	return DefaultInterval
+}
+
+func (f *FileSD) handleError(err error) {
+	handler := f.ErrorHandler
+	if handler == nil {
+		handler = consul.DefaultErrorHandler
+	}
+	if handler != nil {
+		handler(err)
+	}
+}
+
+// writeFile replaces the file at path with b, Prometheus watches the file and
+// must never observe a partially written version.
+func writeFile(path string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,157 @@
+package promconsul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestFileSD(t *testing.T) {
+	dir, err := ioutil.TempDir("", "promconsul")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	web := consul.StaticEndpoints("10.0.0.2:80", "10.0.0.1:80")
+	web[0].Node = "node-2"
+	web[0].Tags = []string{"a", "b"}
+	web[0].Meta = map[string]string{"zone": "us-west-2a"}
+	web[0].Health = consul.Passing
+
+	rslv := &consul.StaticResolver{
+		Endpoints: map[string][]consul.Endpoint{
+			"web": web,
+			"api": consul.StaticEndpoints("10.0.0.3:8080"),
+		},
+	}
+
+	path := filepath.Join(dir, "targets.json")
+	sd := &FileSD{
+		Path:     path,
+		Services: []string{"web", "api"},
+		Resolver: rslv,
+		Interval: 10 * time.Millisecond,
+		Labels: func(service string, endpoint consul.Endpoint) map[string]string {
+			return map[string]string{"job": service}
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 1)
+	go func() { errs <- sd.Run(ctx) }()
+
+	expected := []TargetGroup{
+		{Targets: []string{"10.0.0.3:8080"}, Labels: map[string]string{
+			"job":                      "api",
+			"__meta_consul_service":    "api",
+			"__meta_consul_service_id": "10.0.0.3:8080",
+			"__meta_consul_node":       "",
+			"__meta_consul_tags":       ",,",
+		}},
+		{Targets: []string{"10.0.0.1:80"}, Labels: map[string]string{
+			"job":                      "web",
+			"__meta_consul_service":    "web",
+			"__meta_consul_service_id": "10.0.0.1:80",
+			"__meta_consul_node":       "",
+			"__meta_consul_tags":       ",,",
+		}},
+		{Targets: []string{"10.0.0.2:80"}, Labels: map[string]string{
+			"job":                         "web",
+			"__meta_consul_service":       "web",
+			"__meta_consul_service_id":    "10.0.0.2:80",
+			"__meta_consul_node":          "node-2",
+			"__meta_consul_tags":          ",a,b,",
+			"__meta_consul_health":        "passing",
+			"__meta_consul_metadata_zone": "us-west-2a",
+		}},
+	}
+
+	if groups := waitForTargets(t, path, 3); !reflect.DeepEqual(groups, expected) {
+		t.Errorf("bad target groups: %+v", groups)
+	}
+
+	// The file is rewritten when services change.
+	rslv.Set("api")
+
+	if groups := waitForTargets(t, path, 2); !reflect.DeepEqual(groups, expected[1:]) {
+		t.Errorf("bad target groups after update: %+v", groups)
+	}
+
+	cancel()
+
+	if err := <-errs; err != context.Canceled {
+		t.Error("bad error:", err)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Error("temporary files were left in the directory:", len(files))
+	}
+}
+
+func TestFileSDErrors(t *testing.T) {
+	reported := make(chan error, 1)
+
+	sd := &FileSD{
+		Path:     filepath.Join(os.TempDir(), "promconsul-test-never-written.json"),
+		Services: []string{"web"},
+		Resolver: &consul.StaticResolver{
+			Updates: []consul.StaticUpdate{{Name: "web", Err: errors.New("lookup failed")}},
+		},
+		ErrorHandler: func(err error) {
+			select {
+			case reported <- err:
+			default:
+			}
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sd.Run(ctx)
+
+	select {
+	case err := <-reported:
+		if !strings.HasPrefix(err.Error(), "promconsul: updating ") || !strings.HasSuffix(err.Error(), ": lookup failed") {
+			t.Error("bad error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no error reported")
+	}
+
+	if _, err := os.Stat(sd.Path); !os.IsNotExist(err) {
+		t.Error("the file was written:", err)
+	}
+}
+
+func waitForTargets(t *testing.T, path string, n int) (groups []TargetGroup) {
+	deadline := time.Now().Add(2 * time.Second)
+
+	for time.Now().Before(deadline) {
+		if b, err := ioutil.ReadFile(path); err == nil {
+			groups = nil
+			if err := json.Unmarshal(b, &groups); err != nil {
+				t.Fatal(err)
+			}
+			if len(groups) == n {
+				return
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("timeout waiting for %d target groups, found %d", n, len(groups))
+	return
+}
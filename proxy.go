@@ -0,0 +1,368 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// The Proxy type implements a TCP proxy which forwards the connections that it
+// accepts to the endpoints of a service. It can be used as a lightweight
+// sidecar for programs speaking protocols which can't be instrumented to use
+// consul directly, which connect to the local address of the proxy instead.
+//
+// Endpoints are picked for each connection from the list returned by the
+// resolver, so its filters and balancer apply. The proxy periodically resolves
+// the service to detect endpoints that were removed, connections to those are
+// drained: they are given a grace period to complete, then closed.
+type Proxy struct {
+	// The network address that ListenAndServe listens on.
+	Addr string
+
+	// The name of the service that connections are forwarded to.
+	Service string
+
+	// The lookuper used to resolve the service, which is usually a Resolver.
+	// If nil, DefaultResolver is used instead.
+	Resolver Lookuper
+
+	// The dialer used to establish connections to the service endpoints. If
+	// nil, a zero-value net.Dialer is used.
+	Dialer *net.Dialer
+
+	// The time interval at which the proxy resolves the service to detect
+	// removed endpoints. Defaults to 10 seconds.
+	RefreshInterval time.Duration
+
+	// The time given to connections to complete after their endpoint was
+	// removed, or after the proxy started shutting down, before they are
+	// closed. Defaults to 30 seconds.
+	DrainTimeout time.Duration
+
+	// The time during which endpoints that could not be connected to are
+	// blacklisted by the resolver. Defaults to 1 second.
+	BlacklistTTL time.Duration
+}
+
+// ListenAndServe listens on p.Addr and forwards the connections it accepts
+// until ctx is canceled or an error occurs.
+func (p *Proxy) ListenAndServe(ctx context.Context) error {
+	lstn, err := net.Listen("tcp", p.Addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(ctx, lstn)
+}
+
+// Serve forwards the connections accepted by lstn until ctx is canceled or an
+// error occurs. Serve closes lstn when it returns.
+//
+// When ctx is canceled, Serve stops accepting connections and drains the open
+// connections before returning ctx.Err().
+func (p *Proxy) Serve(ctx context.Context, lstn net.Listener) error {
+	state := &proxyState{
+		conns:    make(map[string]map[*proxyConn]struct{}),
+		draining: make(map[string]*time.Timer),
+	}
+
+	refreshCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.refresh(refreshCtx, state)
+	}()
+
+	go func() {
+		<-refreshCtx.Done()
+		lstn.Close()
+	}()
+
+	var err error
+	for {
+		var conn net.Conn
+
+		if conn, err = lstn.Accept(); err != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.forward(ctx, state, conn)
+		}()
+	}
+
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	cancel()
+	state.shutdown(p.drainTimeout())
+	wg.Wait()
+	return err
+}
+
+func (p *Proxy) forward(ctx context.Context, state *proxyState, conn net.Conn) {
+	backend, addr, err := p.dial(ctx)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	c := &proxyConn{client: conn, server: backend}
+
+	if !state.add(addr, c) {
+		c.close()
+		return
+	}
+	defer state.remove(addr, c)
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go c.pipe(&wg, backend, conn)
+	go c.pipe(&wg, conn, backend)
+	wg.Wait()
+
+	c.close()
+}
+
+func (p *Proxy) dial(ctx context.Context) (conn net.Conn, addr string, err error) {
+	resolver := p.resolver()
+	dialer := p.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	endpoints, err := resolver.LookupService(ctx, p.Service)
+	if err != nil {
+		return
+	}
+
+	if len(endpoints) == 0 {
+		err = fmt.Errorf("%w for %s", ErrNoEndpoints, p.Service)
+		return
+	}
+
+	for _, endpoint := range endpoints {
+		addr = endpoint.Addr.String()
+
+		if conn, err = dialer.DialContext(ctx, "tcp", addr); err == nil {
+			return
+		}
+
+		blacklist(resolver, endpoint.Addr, time.Now().Add(p.blacklistTTL()))
+	}
+
+	return
+}
+
+func (p *Proxy) refresh(ctx context.Context, state *proxyState) {
+	ticker := time.NewTicker(p.refreshInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		endpoints, err := p.resolver().LookupService(ctx, p.Service)
+		if err != nil {
+			// Connections are not drained when the service can't be resolved,
+			// the endpoints may still be reachable.
+			continue
+		}
+
+		addrs := make(map[string]bool, len(endpoints))
+		for _, endpoint := range endpoints {
+			addrs[endpoint.Addr.String()] = true
+		}
+
+		state.drain(addrs, p.drainTimeout())
+	}
+}
+
+func (p *Proxy) resolver() Lookuper {
+	return lookuperOrDefault(p.Resolver, DefaultResolver)
+}
+
+func (p *Proxy) refreshInterval() time.Duration {
+	if p.RefreshInterval != 0 {
+		return p.RefreshInterval
+	}
+	return 10 * time.Second
+}
+
+func (p *Proxy) drainTimeout() time.Duration {
+	if p.DrainTimeout != 0 {
+		return p.DrainTimeout
+	}
+	return 30 * time.Second
+}
+
+func (p *Proxy) blacklistTTL() time.Duration {
+	if p.BlacklistTTL != 0 {
+		return p.BlacklistTTL
+	}
+	return 1 * time.Second
+}
+
+// proxyState tracks the connections forwarded by a proxy, indexed by the
+// address of the endpoint they were forwarded to.
+type proxyState struct {
+	mutex    sync.Mutex
+	conns    map[string]map[*proxyConn]struct{}
+	draining map[string]*time.Timer
+	closed   bool
+	done     chan struct{}
+}
+
+func (s *proxyState) add(addr string, c *proxyConn) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	conns := s.conns[addr]
+	if conns == nil {
+		conns = make(map[*proxyConn]struct{})
+		s.conns[addr] = conns
+	}
+
+	conns[c] = struct{}{}
+	return true
+}
+
+func (s *proxyState) remove(addr string, c *proxyConn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.conns[addr], c)
+
+	if len(s.conns[addr]) == 0 {
+		delete(s.conns, addr)
+
+		if timer := s.draining[addr]; timer != nil {
+			timer.Stop()
+			delete(s.draining, addr)
+		}
+	}
+
+	if s.done != nil && len(s.conns) == 0 {
+		close(s.done)
+		s.done = nil
+	}
+}
+
+// drain starts draining the connections to endpoints which are not in addrs,
+// and stops draining those to endpoints which are back in the list.
+func (s *proxyState) drain(addrs map[string]bool, timeout time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for addr := range s.conns {
+		timer := s.draining[addr]
+
+		switch {
+		case addrs[addr] && timer != nil:
+			timer.Stop()
+			delete(s.draining, addr)
+
+		case !addrs[addr] && timer == nil:
+			addr := addr
+			s.draining[addr] = time.AfterFunc(timeout, func() { s.closeDrained(addr) })
+		}
+	}
+}
+
+func (s *proxyState) closeDrained(addr string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.draining[addr] == nil {
+		return // the endpoint came back
+	}
+
+	delete(s.draining, addr)
+
+	for c := range s.conns[addr] {
+		c.close()
+	}
+}
+
+// shutdown waits for the open connections to complete for up to timeout, then
+// closes them.
+func (s *proxyState) shutdown(timeout time.Duration) {
+	s.mutex.Lock()
+	s.closed = true
+	for addr, timer := range s.draining {
+		timer.Stop()
+		delete(s.draining, addr)
+	}
+	done := make(chan struct{})
+	if len(s.conns) == 0 {
+		close(done)
+	} else {
+		s.done = done
+	}
+	s.mutex.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, conns := range s.conns {
+		for c := range conns {
+			c.close()
+		}
+	}
+}
+
+// proxyConn is a pair of connections between which a proxy forwards data.
+type proxyConn struct {
+	client net.Conn
+	server net.Conn
+	once   sync.Once
+}
+
+func (c *proxyConn) close() {
+	c.once.Do(func() {
+		c.client.Close()
+		c.server.Close()
+	})
+}
+
+// pipe copies data from src to dst, then closes the write side of dst so the
+// peer receives EOF while data may still flow in the other direction. Both
+// connections are closed if the copy fails.
+func (c *proxyConn) pipe(wg *sync.WaitGroup, dst net.Conn, src net.Conn) {
+	defer wg.Done()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		c.close()
+		return
+	}
+
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	} else {
+		dst.Close()
+	}
+}
@@ -0,0 +1,134 @@
+package consul
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProxy(t *testing.T) {
+	backend1 := newEchoServer(t, "A")
+	defer backend1.Close()
+
+	backend2 := newEchoServer(t, "B")
+	defer backend2.Close()
+
+	rslv := &StaticResolver{
+		Endpoints: map[string][]Endpoint{
+			"echo": StaticEndpoints(backend1.Addr().String()),
+		},
+	}
+
+	lstn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proxy := &Proxy{
+		Service:         "echo",
+		Resolver:        rslv,
+		RefreshInterval: 10 * time.Millisecond,
+		DrainTimeout:    500 * time.Millisecond,
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- proxy.Serve(ctx, lstn) }()
+
+	conn1, r1 := dialEcho(t, lstn.Addr())
+	defer conn1.Close()
+
+	if s := echo(t, conn1, r1, "hello"); s != "A: hello\n" {
+		t.Errorf("bad response: %q", s)
+	}
+
+	// Removes the first endpoint, the open connection gets drained and new
+	// connections are forwarded to the second endpoint.
+	rslv.Set("echo", StaticEndpoints(backend2.Addr().String())...)
+
+	conn2, r2 := dialEcho(t, lstn.Addr())
+	defer conn2.Close()
+
+	if s := echo(t, conn2, r2, "world"); s != "B: world\n" {
+		t.Errorf("bad response: %q", s)
+	}
+
+	if s := echo(t, conn1, r1, "still there?"); s != "A: still there?\n" {
+		t.Errorf("bad response while draining: %q", s)
+	}
+
+	conn1.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := r1.ReadString('\n'); err != io.EOF {
+		t.Error("the drained connection was not closed:", err)
+	}
+
+	cancel()
+
+	select {
+	case err := <-errs:
+		if err != context.Canceled {
+			t.Error("bad error:", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the proxy did not shut down")
+	}
+
+	conn2.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := r2.ReadString('\n'); err != io.EOF {
+		t.Error("the connection was not closed on shutdown:", err)
+	}
+}
+
+func newEchoServer(t *testing.T, prefix string) net.Listener {
+	lstn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := lstn.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					io.WriteString(conn, prefix+": "+line)
+				}
+			}()
+		}
+	}()
+
+	return lstn
+}
+
+func dialEcho(t *testing.T, addr net.Addr) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, bufio.NewReader(conn)
+}
+
+func echo(t *testing.T, conn net.Conn, r *bufio.Reader, s string) string {
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.WriteString(conn, s+"\n"); err != nil {
+		t.Fatal(err)
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line
+}
@@ -0,0 +1,175 @@
+package consul
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// QueryOptions carries the options common to read queries sent to the consul
+// API. The zero-value uses the defaults of the client and of consul.
+type QueryOptions struct {
+	// The datacenter to send the query to, takes precedence over the
+	// datacenter of the client and the one set on the context.
+	Datacenter string
+
+	// The consistency mode used to serve the query.
+	Consistency Consistency
+
+	// If true, the query may be served from the agent's cache.
+	Cached bool
+
+	// WaitIndex turns the query into a blocking query which returns when the
+	// data changed after the given index, or when WaitTime expired.
+	WaitIndex uint64
+	WaitTime  time.Duration
+
+	// A filter expression applied by consul to the results.
+	Filter Filter
+
+	// The name of a node to sort results by estimated round trip time from,
+	// "_agent" designates the node of the agent serving the query.
+	Near string
+}
+
+// Query renders the options as a query string.
+func (opts QueryOptions) Query() (query Query) {
+	if len(opts.Datacenter) != 0 {
+		query = append(query, Param{Name: "dc", Value: opts.Datacenter})
+	}
+
+	if len(opts.Consistency) != 0 {
+		query = append(query, Param{Name: string(opts.Consistency), Value: "true"})
+	}
+
+	if opts.Cached {
+		query = append(query, Param{Name: "cached", Value: "true"})
+	}
+
+	if opts.WaitIndex != 0 {
+		query = append(query, Param{Name: "index", Value: strconv.FormatUint(opts.WaitIndex, 10)})
+	}
+
+	if opts.WaitTime != 0 {
+		query = append(query, Param{Name: "wait", Value: fmt.Sprintf("%dms", opts.WaitTime/time.Millisecond)})
+	}
+
+	if len(opts.Filter) != 0 {
+		query = append(query, Param{Name: "filter", Value: string(opts.Filter)})
+	}
+
+	if len(opts.Near) != 0 {
+		query = append(query, Param{Name: "near", Value: opts.Near})
+	}
+
+	return
+}
+
+// KVOptions carries the options of queries sent to the key/value store.
+type KVOptions struct {
+	QueryOptions
+
+	// If true, all keys under the requested prefix are returned.
+	Recurse bool
+
+	// If true, only the keys are returned, without their values.
+	Keys bool
+
+	// With Keys, only lists keys up to the given separator.
+	Separator string
+
+	// If true, the value of the key is returned unencoded, without metadata.
+	Raw bool
+}
+
+// Query renders the options as a query string.
+func (opts KVOptions) Query() Query {
+	query := opts.QueryOptions.Query()
+
+	if opts.Recurse {
+		query = append(query, Param{Name: "recurse", Value: "true"})
+	}
+
+	if opts.Keys {
+		query = append(query, Param{Name: "keys"})
+	}
+
+	if len(opts.Separator) != 0 {
+		query = append(query, Param{Name: "separator", Value: opts.Separator})
+	}
+
+	if opts.Raw {
+		query = append(query, Param{Name: "raw"})
+	}
+
+	return query
+}
+
+// HealthOptions carries the options of queries sent to the health endpoints.
+type HealthOptions struct {
+	QueryOptions
+
+	// Only return service instances with all the given tags.
+	Tags []string
+
+	// Only return service instances whose health checks are all passing.
+	Passing bool
+
+	// Only return service instances running on nodes with the given metadata.
+	NodeMeta map[string]string
+}
+
+// Query renders the options as a query string.
+func (opts HealthOptions) Query() Query {
+	query := opts.QueryOptions.Query()
+
+	if opts.Passing {
+		query = append(query, Param{Name: "passing", Value: "true"})
+	}
+
+	query = appendNodeMeta(query, opts.NodeMeta)
+
+	for _, tag := range opts.Tags {
+		query = append(query, Param{Name: "tag", Value: tag})
+	}
+
+	return query
+}
+
+// CatalogOptions carries the options of queries sent to the catalog endpoints.
+type CatalogOptions struct {
+	QueryOptions
+
+	// Only return nodes (or services of nodes) with the given metadata.
+	NodeMeta map[string]string
+}
+
+// Query renders the options as a query string.
+func (opts CatalogOptions) Query() Query {
+	return appendNodeMeta(opts.QueryOptions.Query(), opts.NodeMeta)
+}
+
+// SessionOptions carries the options of queries sent to the session endpoints.
+type SessionOptions struct {
+	QueryOptions
+}
+
+// Query renders the options as a query string.
+func (opts SessionOptions) Query() Query {
+	return opts.QueryOptions.Query()
+}
+
+func appendNodeMeta(query Query, meta map[string]string) Query {
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		query = append(query, Param{Name: "node-meta", Value: key + ":" + meta[key]})
+	}
+
+	return query
+}
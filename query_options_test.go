@@ -0,0 +1,100 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestQueryOptions(t *testing.T) {
+	tests := []struct {
+		scenario string
+		query    Query
+		expected string
+	}{
+		{
+			scenario: "zero-value",
+			query:    QueryOptions{}.Query(),
+			expected: "",
+		},
+		{
+			scenario: "blocking stale query",
+			query: QueryOptions{
+				Datacenter:  "dc2",
+				Consistency: ConsistencyStale,
+				WaitIndex:   42,
+				WaitTime:    10 * time.Second,
+			}.Query(),
+			expected: "dc=dc2&stale=true&index=42&wait=10000ms",
+		},
+		{
+			scenario: "kv",
+			query: KVOptions{
+				QueryOptions: QueryOptions{Consistency: ConsistencyConsistent},
+				Keys:         true,
+				Separator:    "/",
+			}.Query(),
+			expected: "consistent=true&keys&separator=%2F",
+		},
+		{
+			scenario: "health",
+			query: HealthOptions{
+				QueryOptions: QueryOptions{Near: "_agent", Filter: `Service.Port == 80`},
+				Tags:         []string{"A", "B"},
+				Passing:      true,
+				NodeMeta:     map[string]string{"rack": "1", "az": "us-west-2a"},
+			}.Query(),
+			expected: "filter=Service.Port+%3D%3D+80&near=_agent&passing=true&node-meta=az%3Aus-west-2a&node-meta=rack%3A1&tag=A&tag=B",
+		},
+		{
+			scenario: "catalog",
+			query: CatalogOptions{
+				QueryOptions: QueryOptions{Cached: true},
+				NodeMeta:     map[string]string{"rack": "1"},
+			}.Query(),
+			expected: "cached=true&node-meta=rack%3A1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if s := test.query.String(); s != test.expected {
+				t.Errorf("bad query string:\n expected: %s\n found:    %s", test.expected, s)
+			}
+		})
+	}
+}
+
+func TestHealthService(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/health/service/web" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		// The datacenter of the options takes precedence over the client's.
+		if req.URL.RawQuery != "dc=dc2&passing=true" {
+			t.Error("bad query string:", req.URL.RawQuery)
+		}
+		res.Header().Set("X-Consul-Index", "42")
+		json.NewEncoder(res).Encode([]ServiceEntry{{
+			Node:    Node{Node: "node-1"},
+			Service: ServiceInstance{ID: "web-1", Service: "web", Port: 80},
+		}})
+	})
+	defer server.Close()
+
+	entries, meta, err := (&Health{Client: client}).Service(context.Background(), "web", HealthOptions{
+		QueryOptions: QueryOptions{Datacenter: "dc2"},
+		Passing:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Service.ID != "web-1" {
+		t.Error("bad entries:", entries)
+	}
+	if meta.LastIndex != 42 {
+		t.Error("bad index:", meta.LastIndex)
+	}
+}
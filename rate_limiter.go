@@ -0,0 +1,258 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A RateLimiter enforces a budget of operations per second shared by all the
+// programs of a cluster, for example to stay under the quota of a third-party
+// API called by a fleet of instances.
+//
+// The limiter implements a token bucket which state is stored in a key of the
+// consul key/value store, and updated with compare-and-swap writes. Tokens can
+// be reserved from the shared bucket in batches and handed out locally, so most
+// calls don't send any request to consul.
+//
+// The bucket is refilled based on the clocks of the programs sharing it, which
+// should be kept synchronized for the limit to be accurate.
+type RateLimiter struct {
+	// The client used to send requests to the consul agent. If nil, the default
+	// client is used instead.
+	Client *Client
+
+	// The key of the consul key/value store holding the state of the bucket.
+	Key string
+
+	// Rate is the number of tokens added to the bucket per second, which is the
+	// number of operations per second allowed across the cluster.
+	Rate float64
+
+	// Burst is the capacity of the bucket, the number of operations which may
+	// be allowed at once after the bucket stayed unused. If zero, it defaults
+	// to Rate, with a minimum of one token.
+	Burst int
+
+	// Batch is the number of tokens reserved from the shared bucket at once,
+	// and then handed out locally. Reserved tokens expire after the time it
+	// takes to add them to the bucket, so programs can't accumulate them into
+	// bursts exceeding the budget. If zero, tokens are reserved one at a time.
+	Batch int
+
+	// The clock used to refill the bucket and wait for tokens. If nil,
+	// DefaultClock is used.
+	Clock Clock
+
+	mutex    sync.Mutex
+	tokens   int
+	expireAt time.Time
+}
+
+// Allow takes a token from the limiter and returns true, or returns false if
+// no tokens were available.
+func (l *RateLimiter) Allow(ctx context.Context) (ok bool, err error) {
+	ok, _, err = l.take(ctx)
+	return
+}
+
+// Wait blocks until a token could be taken from the limiter, or the context
+// was canceled.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	clock := clockOrDefault(l.Clock)
+
+	for {
+		ok, wait, err := l.take(ctx)
+		if err != nil || ok {
+			return err
+		}
+		if err := Sleep(ctx, clock, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// take takes a token from the local reservation, reserving new tokens from the
+// shared bucket when it is empty. When no tokens were available, it returns
+// the time until the bucket holds a token again.
+func (l *RateLimiter) take(ctx context.Context) (ok bool, wait time.Duration, err error) {
+	if l.Rate <= 0 {
+		err = fmt.Errorf("consul: rate limiter %s has no rate", l.Key)
+		return
+	}
+
+	clock := clockOrDefault(l.Clock)
+
+	if l.takeReserved(clock.Now()) {
+		ok = true
+		return
+	}
+
+	batch := l.Batch
+	if batch <= 0 {
+		batch = 1
+	}
+
+	// The mutex is not held while reserving tokens, so callers waiting on it
+	// don't block past the cancellation of their context when consul is slow.
+	// Concurrent callers may each reserve a batch, the tokens they don't use
+	// are added to the local reservation.
+	tokens, wait, err := l.reserve(ctx, batch)
+	if err != nil || tokens == 0 {
+		return
+	}
+
+	now := clock.Now()
+	l.addReserved(now, tokens-1, now.Add(tokenDuration(float64(tokens), l.Rate)))
+	ok = true
+	return
+}
+
+// takeReserved takes a token from the local reservation, returning false if it
+// is empty or expired.
+func (l *RateLimiter) takeReserved(now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.tokens > 0 && now.Before(l.expireAt) {
+		l.tokens--
+		return true
+	}
+
+	return false
+}
+
+// addReserved adds tokens reserved at now, and expiring at expireAt, to the
+// local reservation. When tokens reserved concurrently are still held, all of
+// them expire at the earliest time so they can't exceed the budget.
+func (l *RateLimiter) addReserved(now time.Time, tokens int, expireAt time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.tokens <= 0 || !now.Before(l.expireAt) {
+		l.tokens = 0
+	} else if l.expireAt.Before(expireAt) {
+		expireAt = l.expireAt
+	}
+
+	l.tokens += tokens
+	l.expireAt = expireAt
+}
+
+// rateLimiterState is the state of the bucket stored in the key/value store.
+type rateLimiterState struct {
+	Tokens float64
+	Time   time.Time
+}
+
+// reserve takes up to n tokens from the shared bucket, returning the number of
+// tokens taken, or the time until the bucket holds a token if it is empty.
+func (l *RateLimiter) reserve(ctx context.Context, n int) (tokens int, wait time.Duration, err error) {
+	client := l.client()
+	clock := clockOrDefault(l.Clock)
+	burst := float64(l.burst())
+
+	for {
+		var state rateLimiterState
+		var index uint64
+		var ok bool
+
+		now := clock.Now()
+
+		if state, index, err = l.read(ctx); err != nil {
+			return
+		}
+
+		if index == 0 {
+			state = rateLimiterState{Tokens: burst, Time: now}
+		}
+
+		// The clocks of other programs may be ahead, the time of the bucket
+		// never moves backward so elapsed time isn't counted twice.
+		if now.Before(state.Time) {
+			now = state.Time
+		}
+
+		state.Tokens = math.Min(burst, state.Tokens+now.Sub(state.Time).Seconds()*l.Rate)
+		state.Time = now
+
+		if state.Tokens < 1 {
+			wait = tokenDuration(1-state.Tokens, l.Rate)
+			return
+		}
+
+		tokens = int(math.Min(float64(n), math.Floor(state.Tokens)))
+		state.Tokens -= float64(tokens)
+		query := Query{{"cas", strconv.FormatUint(index, 10)}}
+
+		if err = client.Put(ctx, "/v1/kv/"+l.Key, query, state, &ok); err != nil || ok {
+			if !ok {
+				tokens = 0
+			}
+			return
+		}
+
+		// Another program updated the bucket since it was read, the reservation
+		// is retried with its new state.
+		if err = ctx.Err(); err != nil {
+			tokens = 0
+			return
+		}
+	}
+}
+
+// read returns the state of the bucket and the index of its last
+// modification, which is zero if the key doesn't exist yet.
+func (l *RateLimiter) read(ctx context.Context) (state rateLimiterState, index uint64, err error) {
+	var entries []struct {
+		Value       []byte
+		ModifyIndex uint64
+	}
+
+	if err = l.client().Get(ctx, "/v1/kv/"+l.Key, nil, &entries); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			err = nil
+		}
+		return
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	if err = json.Unmarshal(entries[0].Value, &state); err != nil {
+		err = fmt.Errorf("consul: rate limiter %s has an invalid state: %w", l.Key, err)
+		return
+	}
+
+	index = entries[0].ModifyIndex
+	return
+}
+
+func (l *RateLimiter) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	if burst := int(l.Rate); burst > 1 {
+		return burst
+	}
+	return 1
+}
+
+func (l *RateLimiter) client() *Client {
+	if client := l.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+// tokenDuration returns the time it takes to add tokens to a bucket refilled
+// at rate tokens per second.
+func tokenDuration(tokens float64, rate float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / rate * float64(time.Second)))
+}
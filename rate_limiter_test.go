@@ -0,0 +1,116 @@
+package consul_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+	"github.com/segmentio/consul-go/consultest"
+)
+
+func TestRateLimiter(t *testing.T) {
+	agent, ctx := newFakeAgent(t)
+	clock := consultest.NewClock(time.Now())
+
+	limiter := func(batch int) *consul.RateLimiter {
+		return &consul.RateLimiter{
+			Client: agent.Client(),
+			Key:    "limits/api",
+			Rate:   10,
+			Burst:  5,
+			Batch:  batch,
+			Clock:  clock,
+		}
+	}
+
+	allowed := func(l *consul.RateLimiter, n int) (count int) {
+		for i := 0; i != n; i++ {
+			ok, err := l.Allow(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				count++
+			}
+		}
+		return
+	}
+
+	l1, l2 := limiter(0), limiter(0)
+
+	if n := allowed(l1, 4) + allowed(l2, 4); n != 5 {
+		t.Error("the burst of the shared bucket was not enforced:", n)
+	}
+
+	clock.Advance(200 * time.Millisecond)
+
+	if n := allowed(l2, 4); n != 2 {
+		t.Error("the bucket was not refilled at the configured rate:", n)
+	}
+
+	clock.Advance(time.Second)
+
+	// Tokens reserved in batches are handed out without sending requests to
+	// consul.
+	l3 := limiter(3)
+	if n := allowed(l3, 1); n != 1 {
+		t.Fatal("no tokens were reserved")
+	}
+	index := agent.Index()
+	if n := allowed(l3, 2); n != 2 || agent.Index() != index {
+		t.Error("the reserved tokens were not handed out locally:", n)
+	}
+	if n := allowed(l1, 3); n != 2 {
+		t.Error("the tokens reserved by the batch were not taken from the shared bucket:", n)
+	}
+
+	done := make(chan error)
+	go func() { done <- l1.Wait(ctx) }()
+
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(100 * time.Millisecond)
+
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+	agent, ctx := newFakeAgent(t)
+
+	// Requests to the bucket hang until the test completes.
+	client := agent.Client()
+	transport := &consultest.FaultTransport{
+		Transport: client.Transport,
+		Faults:    []consultest.Fault{{Path: "/v1/kv/limits/", Latency: time.Minute}},
+	}
+	client.Transport = transport
+
+	limiter := &consul.RateLimiter{
+		Client: client,
+		Key:    "limits/api",
+		Rate:   10,
+	}
+
+	go limiter.Allow(ctx)
+
+	for transport.Injected() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	if err := limiter.Wait(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("bad error:", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("waiting did not stop when the context was canceled:", elapsed)
+	}
+}
@@ -2,6 +2,8 @@ package consul
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net"
 	"strconv"
 	"strings"
@@ -11,11 +13,38 @@ import (
 	"unsafe"
 )
 
+// Lookuper is the interface implemented by types that resolve service names to
+// lists of endpoints, like Resolver and StaticResolver.
+//
+// Lookupers must be safe to use concurrently from multiple goroutines.
+type Lookuper interface {
+	// LookupService resolves a service name to a list of endpoints, sorted by
+	// preference.
+	LookupService(ctx context.Context, name string) ([]Endpoint, error)
+}
+
+// LookuperInto is implemented by lookupers which can store the endpoints they
+// resolve in a slice provided by the caller, like Resolver and StaticResolver.
+// Programs resolving services at a high rate may reuse slices across lookups
+// to avoid allocating a new one each time.
+type LookuperInto interface {
+	Lookuper
+
+	// LookupServiceInto is like LookupService but stores the endpoints in
+	// list if it has a large enough capacity. The returned slice is owned by
+	// the caller.
+	LookupServiceInto(ctx context.Context, name string, list []Endpoint) ([]Endpoint, error)
+}
+
 // A Resolver is a high-level abstraction on top of the consul service discovery
 // API.
 //
 // The zero-value is a valid Resolver that uses DefaultClient to query the
 // consul agent.
+//
+// Concurrent lookups of the same service name made with the same resolver are
+// coalesced into a single request to the agent, which prevents stampedes on
+// popular services when no cache is configured.
 type Resolver struct {
 	// The client used by the resolver, which may be nil to indicate that a
 	// default client should be used.
@@ -29,6 +58,10 @@ type Resolver struct {
 	// nodes that have matching metadata will be returned by LookupService.
 	NodeMeta map[string]string
 
+	// A filter expression evaluated by consul on the service instances, only
+	// the addresses of instances that match the filter are returned.
+	Filter Filter
+
 	// If set to true, the resolver only returns services that are passing their
 	// health checks.
 	OnlyPassing bool
@@ -45,13 +78,26 @@ type Resolver struct {
 	// service endpoints.
 	DisableCoordinates bool
 
+	// If set to true, the node coordinates are only fetched when the balancers
+	// of the resolver and its cache use the RTT of endpoints, as reported by
+	// the RTTBalancer interface, or when Sort is used. Otherwise the RTT of
+	// returned endpoints is left to zero, which saves the cost of fetching
+	// and computing coordinates for programs balancing with round-robin or
+	// random shuffles.
+	LazyCoordinates bool
+
+	// If set to true, the resolver only returns endpoints that are capable of
+	// accepting Connect connections to the service, which are either instances
+	// of Connect-native services or their sidecar proxies.
+	Connect bool
+
 	// Cache used by the resolver to reduce the number of round-trips to consul.
 	// If set to nil then no cache is used.
 	//
 	// ResolverCache instances should not be shared by multiple resolvers
 	// because the cache uses the service name as a lookup key, but the resolver
-	// may apply filters based on the values of the ServiceTags, NodeMeta, and
-	// OnlyPassing fields.
+	// may apply filters based on the values of the ServiceTags, NodeMeta,
+	// Filter, and OnlyPassing fields.
 	Cache *ResolverCache
 
 	// This field may be set to allow the resolver to support temporarily
@@ -117,12 +163,34 @@ func (rslv *Resolver) LookupService(ctx context.Context, name string) ([]Endpoin
 // resolver's configuration to narrow and sort the result set. It uses the
 // provided slice to store the results, if it has a large enough capacity.
 func (rslv *Resolver) LookupServiceInto(ctx context.Context, name string, list []Endpoint) ([]Endpoint, error) {
+	stats := rslv.client().Stats
+	if stats == nil {
+		return rslv.lookupBalanced(ctx, name, list)
+	}
+
+	start := time.Now()
+	list, err := rslv.lookupBalanced(ctx, name, list)
+	rslv.reportLookup(stats, name, start, list, err)
+	return list, err
+}
+
+func (rslv *Resolver) lookupBalanced(ctx context.Context, name string, list []Endpoint) ([]Endpoint, error) {
 	var err error
 
 	if cache := rslv.Cache; cache != nil {
-		list, err = cache.LookupServiceInto(ctx, name, list, rslv.lookupService)
+		key, lookup := name, rslv.lookupService
+		// Lookups in other datacenters are cached separately, the name is
+		// suffixed with the datacenter which is not a valid service name
+		// character so the keys never collide.
+		if dc, _ := ctx.Value(DatacenterKey).(string); len(dc) != 0 {
+			key = name + "@" + dc
+			lookup = func(ctx context.Context, _ string) ([]Endpoint, error) {
+				return rslv.lookupService(ctx, name)
+			}
+		}
+		list, err = cache.LookupServiceInto(ctx, key, list, lookup)
 	} else {
-		list, err = rslv.lookupService(ctx, name)
+		list, err = rslv.lookupServiceShared(ctx, name, list)
 	}
 
 	if err != nil {
@@ -142,12 +210,57 @@ func (rslv *Resolver) LookupServiceInto(ctx context.Context, name string, list [
 	return list, err
 }
 
-func (rslv *Resolver) lookupService(ctx context.Context, name string) (list []Endpoint, err error) {
-	var results []struct {
-		// There are other fields in the response which have been omitted to
-		// avoiding parsing a bunch of throw-away values. Refer to the consul
-		// documentation for a full description of the schema:
-		// https://www.consul.io/api/health.html#list-nodes-for-service
+// resolverFlight is the key of concurrent service lookups which are coalesced
+// into a single request, they must be made by the same resolver for the same
+// name, with the same options set on the context.
+type resolverFlight struct {
+	rslv  *Resolver
+	name  string
+	query string
+}
+
+// lookupServiceShared resolves name like lookupServiceInto does, but when
+// goroutines concurrently resolve the same name with the same resolver, only
+// one request is sent to the agent and its result is shared with the others.
+func (rslv *Resolver) lookupServiceShared(ctx context.Context, name string, list []Endpoint) ([]Endpoint, error) {
+	key := resolverFlight{
+		rslv:  rslv,
+		name:  name,
+		query: contextQuery(ctx, nil, "").String(),
+	}
+	leader := false
+
+	res, err := flights.do(ctx, key, func() (interface{}, error) {
+		leader = true
+		return rslv.lookupServiceInto(ctx, name, list)
+	}, func(res interface{}) interface{} {
+		return append([]Endpoint{}, res.([]Endpoint)...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if leader {
+		return res.([]Endpoint), nil
+	}
+
+	shared := res.([]Endpoint)
+	if list == nil {
+		list = make([]Endpoint, 0, len(shared))
+	}
+	return append(list[:0], shared...), nil
+}
+
+func (rslv *Resolver) lookupService(ctx context.Context, name string) ([]Endpoint, error) {
+	return rslv.lookupServiceInto(ctx, name, nil)
+}
+
+func (rslv *Resolver) lookupServiceInto(ctx context.Context, name string, list []Endpoint) ([]Endpoint, error) {
+	// There are other fields in the response which have been omitted to
+	// avoiding parsing a bunch of throw-away values. Refer to the consul
+	// documentation for a full description of the schema:
+	// https://www.consul.io/api/health.html#list-nodes-for-service
+	var result struct {
 		Node struct {
 			Node string
 			Meta map[string]string
@@ -158,55 +271,74 @@ func (rslv *Resolver) lookupService(ctx context.Context, name string) (list []En
 			Port    int
 			Tags    []string
 		}
+		Checks []HealthCheck
 	}
 
-	query := make(Query, 0, 3+len(rslv.NodeMeta)+len(rslv.ServiceTags))
-
-	if rslv.OnlyPassing {
-		query = append(query, Param{Name: "passing", Value: "true"})
+	opts := HealthOptions{
+		QueryOptions: QueryOptions{Cached: rslv.AllowCached, Filter: rslv.Filter},
+		Tags:         rslv.ServiceTags,
+		Passing:      rslv.OnlyPassing,
+		NodeMeta:     rslv.NodeMeta,
 	}
 
 	if rslv.AllowStale {
-		query = append(query, Param{Name: "stale", Value: "true"})
+		opts.Consistency = ConsistencyStale
 	}
 
-	if rslv.AllowCached {
-		query = append(query, Param{Name: "cached", Value: "true"})
-	}
+	query := opts.Query()
 
-	for key, value := range rslv.NodeMeta {
-		query = append(query, Param{
-			Name:  "node-meta",
-			Value: key + ":" + value,
-		})
-	}
+	serviceName, serviceID := splitNameID(name)
+	endpoint := "/v1/health/service/"
 
-	for _, tag := range rslv.ServiceTags {
-		query = append(query, Param{
-			Name:  "tag",
-			Value: tag,
-		})
+	if rslv.Connect {
+		endpoint = "/v1/health/connect/"
 	}
 
-	serviceName, serviceID := splitNameID(name)
+	list = list[:0]
 
-	if err = rslv.client().Get(ctx, "/v1/health/service/"+serviceName, query, &results); err != nil {
-		return
-	}
+	// The response is decoded one instance at a time, which keeps the memory
+	// footprint low when resolving services with thousands of instances.
+	meta, err := rslv.client().getList(ctx, endpoint+serviceName, query, func(dec *json.Decoder) error {
+		result.Node.Meta = nil
+		result.Service.Tags = nil
+		result.Checks = nil
+
+		if err := dec.Decode(&result); err != nil {
+			return err
+		}
+
+		if len(serviceID) != 0 {
+			if _, id := splitNameID(result.Service.ID); id != serviceID {
+				return nil
+			}
+		}
 
-	list = make([]Endpoint, len(results))
+		list = append(list, Endpoint{
+			ID:   result.Service.ID,
+			Addr: newServiceAddr(result.Service.Address, result.Service.Port),
+			Tags: result.Service.Tags,
+			Node: result.Node.Node,
+			Meta: result.Node.Meta,
+		})
 
-	for i, res := range results {
-		list[i] = Endpoint{
-			ID:   res.Service.ID,
-			Addr: newServiceAddr(res.Service.Address, res.Service.Port),
-			Tags: res.Service.Tags,
-			Node: res.Node.Node,
-			Meta: res.Node.Meta,
+		if len(result.Checks) != 0 {
+			list[len(list)-1].Health = AggregateHealth(result.Checks)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if !rslv.DisableCoordinates {
+	if list == nil {
+		list = []Endpoint{}
+	}
+
+	if info, ok := ctx.Value(lookupInfoKey{}).(*lookupInfo); ok {
+		info.index = meta.index
+	}
+
+	if rslv.needsCoordinates() {
 		agent, _ := rslv.agent().NodeName(ctx)
 		nodes, _ := rslv.tomography().NodeCoordinates(ctx)
 
@@ -216,23 +348,30 @@ func (rslv *Resolver) lookupService(ctx context.Context, name string) (list []En
 					list[i].RTT = Distance(from, to)
 				}
 			}
-		}
-	}
-
-	if len(serviceID) != 0 {
-		i := 0
 
-		for _, e := range list {
-			if _, id := splitNameID(e.ID); id == serviceID {
-				list[i] = e
-				i++
+			if stats := rslv.client().Stats; stats != nil {
+				rslv.reportRTT(stats, serviceName, list)
 			}
 		}
-
-		list = list[:i]
 	}
 
-	return
+	return list, nil
+}
+
+func (rslv *Resolver) needsCoordinates() bool {
+	if rslv.DisableCoordinates {
+		return false
+	}
+	if !rslv.LazyCoordinates {
+		return true
+	}
+	if cache := rslv.Cache; cache != nil && balancerUsesRTT(cache.Balancer) {
+		return true
+	}
+	if rslv.Balancer != nil {
+		return balancerUsesRTT(rslv.Balancer)
+	}
+	return rslv.Sort != nil
 }
 
 func (rslv *Resolver) client() *Client {
@@ -277,6 +416,54 @@ func LookupService(ctx context.Context, name string) ([]Endpoint, error) {
 	return DefaultResolver.LookupService(ctx, name)
 }
 
+// blacklist blacklists addr until expireAt if lookuper is a resolver with a
+// blacklist, other lookupers are left unchanged.
+func blacklist(lookuper Lookuper, addr net.Addr, expireAt time.Time) {
+	if rslv, ok := lookuper.(*Resolver); ok && rslv.Blacklist != nil {
+		rslv.Blacklist.Blacklist(addr, expireAt)
+	}
+}
+
+// lookupServiceInto resolves name with lookuper, storing the endpoints in list
+// if lookuper implements LookuperInto.
+func lookupServiceInto(ctx context.Context, lookuper Lookuper, name string, list []Endpoint) ([]Endpoint, error) {
+	if l, ok := lookuper.(LookuperInto); ok {
+		return l.LookupServiceInto(ctx, name, list)
+	}
+	return lookuper.LookupService(ctx, name)
+}
+
+// endpointsPool recycles the slices that dialers resolve services into, since
+// the endpoints are only used for the duration of a dial.
+var endpointsPool = sync.Pool{
+	New: func() interface{} { return new([]Endpoint) },
+}
+
+func getEndpoints() *[]Endpoint {
+	return endpointsPool.Get().(*[]Endpoint)
+}
+
+// putEndpoints recycles list, which was resolved into the slice obtained from
+// getEndpoints. The endpoints are cleared so the pool doesn't retain their tags
+// and metadata.
+func putEndpoints(p *[]Endpoint, list []Endpoint) {
+	list = list[:cap(list)]
+	for i := range list {
+		list[i] = Endpoint{}
+	}
+	*p = list[:0]
+	endpointsPool.Put(p)
+}
+
+// lookuperOrDefault returns lookuper, or def if lookuper is nil. Nil resolver
+// pointers assigned to lookupers are also replaced, like nil *Resolver fields.
+func lookuperOrDefault(lookuper Lookuper, def Lookuper) Lookuper {
+	if rslv, ok := lookuper.(*Resolver); lookuper == nil || (ok && rslv == nil) {
+		return def
+	}
+	return lookuper
+}
+
 type serviceAddr string
 
 func newServiceAddr(host string, port int) serviceAddr {
@@ -286,6 +473,19 @@ func newServiceAddr(host string, port int) serviceAddr {
 func (serviceAddr) Network() string  { return "" }
 func (a serviceAddr) String() string { return string(a) }
 
+// LookupStatus carries details about how a service lookup was served, it is
+// filled by lookups made with a context returned by ContextWithLookupStatus.
+type LookupStatus struct {
+	// True if the lookup was served endpoints kept by a resolver cache
+	// because resolving the service name failed, see the MaxStaleness field
+	// of ResolverCache.
+	Stale bool
+
+	// How long ago the endpoints were resolved, zero if the lookup was not
+	// served by a resolver cache.
+	Age time.Duration
+}
+
 // LookupServiceFunc is the signature of functions that can be used to lookup
 // service names.
 type LookupServiceFunc func(context.Context, string) ([]Endpoint, error)
@@ -300,10 +500,48 @@ type ResolverCache struct {
 	// used.
 	CacheTimeout time.Duration
 
+	// CacheTimeouts may be set to override CacheTimeout for some services, it
+	// maps service names to the maximum age of their cache entries. Services
+	// resolved in other datacenters use the timeout of their name.
+	CacheTimeouts map[string]time.Duration
+
 	// A balancer used by the cache to potentially filter or reorder endpoints
 	// from the resolved names before caching them.
 	Balancer Balancer
 
+	// The clock used to expire cache entries. If nil, DefaultClock is used.
+	Clock Clock
+
+	// The maximum number of service names kept in the cache. When resolving a
+	// name which is not cached would exceed the limit, the least recently used
+	// entry is evicted. Zero means no limit.
+	//
+	// Programs resolving many distinct names, like API gateways, should set a
+	// limit to bound the memory used by the cache.
+	MaxEntries int
+
+	// ErrorHandler is called with the errors of the lookups refreshing cache
+	// entries before they expire, which are discarded to keep serving the
+	// cached endpoints. If nil, DefaultErrorHandler is used instead.
+	ErrorHandler func(error)
+
+	// MaxStaleness may be set to keep serving the last endpoints resolved for
+	// a service when resolving it again fails, for example because the agent
+	// is unreachable, as long as they were resolved less than MaxStaleness
+	// ago. Lookups served stale endpoints succeed, the failures are reported
+	// to ErrorHandler, and programs may tell them apart with
+	// ContextWithLookupStatus. Zero disables the fallback, the errors of
+	// lookups are returned (and cached) instead.
+	MaxStaleness time.Duration
+
+	// PersistPath may be set to the path of a file that the cache entries are
+	// saved to, and loaded from when the cache is first used, so a program
+	// restarting while the agent is unavailable can still serve the endpoints
+	// it last resolved (see Load). The file is written in the background at
+	// most once every PersistInterval, or DefaultPersistInterval if zero.
+	PersistPath     string
+	PersistInterval time.Duration
+
 	// Pointer to *resolverCache where cached service endpoints are read from.
 	// The field is manipulated using atomic operations to prevent cache
 	// updates from ever blocking service lookups.
@@ -312,6 +550,16 @@ type ResolverCache struct {
 	// Version of the resolver, incremented every time it gets updated.
 	version uint64
 
+	// Counters reported by Stats.
+	misses    uint64
+	evictions uint64
+	stale     uint64
+
+	// State of the persistence of the cache to PersistPath.
+	persistedAt int64
+	persisting  uint32
+	restored    sync.Once
+
 	// This map keeps track of all in-flight resolution to avoid making more
 	// than one concurrent request to the actual resolver.
 	mutex    sync.Mutex
@@ -332,12 +580,17 @@ func (cache *ResolverCache) LookupService(ctx context.Context, name string, look
 // cache, or calling lookup if the name did not exist. The results are stored in
 // the provided list value, if it has a large enough capacity.
 func (cache *ResolverCache) LookupServiceInto(ctx context.Context, name string, list []Endpoint, lookup LookupServiceFunc) ([]Endpoint, error) {
-	cacheTimeout := cache.cacheTimeout()
+	if len(cache.PersistPath) != 0 {
+		cache.restore()
+	}
+
+	cacheTimeout := cache.cacheTimeoutOf(name)
 	entry := cache.cache()[name]
-	now := time.Now()
+	now := clockOrDefault(cache.Clock).Now()
 
 	for entry == nil || now.After(entry.expireAt) {
 		var err error
+		atomic.AddUint64(&cache.misses, 1)
 		// Slow path: when the entry doesn't exist or was expired the goroutines
 		// that concurrently attempt to resolve the same service name will sync
 		// on the inflight map to make a single call to the lookup function and
@@ -347,6 +600,15 @@ func (cache *ResolverCache) LookupServiceInto(ctx context.Context, name string,
 		}
 	}
 
+	if cache.MaxEntries > 0 {
+		atomic.StoreInt64(&entry.lastUse, now.UnixNano())
+	}
+
+	if status, _ := ctx.Value(LookupStatusKey).(*LookupStatus); status != nil {
+		status.Stale = entry.stale
+		status.Age = now.Sub(entry.fetchedAt)
+	}
+
 	// To reduce the chances of getting cache misses on expired entries we
 	// prefetch the updated list of addresses when we're getting close to the
 	// expiration time. This is not a perfect solution and works when fetching
@@ -359,12 +621,17 @@ func (cache *ResolverCache) LookupServiceInto(ctx context.Context, name string,
 		// we don't endup hammering the backend if an error occurs.
 		if entry.tryLock() {
 			// Only proactively update the cache entry if there was no error.
-			if res, err := lookup(ctx, name); err != nil {
+			info := &lookupInfo{}
+			if res, err := lookup(withLookupInfo(ctx, info), name); err == nil {
+				now := clockOrDefault(cache.Clock).Now()
 				cache.update(name, &resolverEntry{
-					res:      res,
-					err:      err,
-					expireAt: time.Now().Add(cacheTimeout),
+					res:       res,
+					fetchedAt: now,
+					expireAt:  now.Add(cacheTimeout),
+					index:     info.index,
 				})
+			} else {
+				cache.handleError(fmt.Errorf("consul: refreshing the cached endpoints of %s: %w", name, err))
 			}
 		}
 	}
@@ -380,6 +647,41 @@ func (cache *ResolverCache) LookupServiceInto(ctx context.Context, name string,
 	return append(list[:0], entry.res...), entry.err
 }
 
+// ResolverCacheStats is a snapshot of the state of a ResolverCache.
+type ResolverCacheStats struct {
+	// The number of service names in the cache.
+	Entries int
+
+	// The number of lookups which did not find a valid entry in the cache,
+	// and had to resolve the name.
+	Misses uint64
+
+	// The number of entries evicted because the cache was full.
+	Evictions uint64
+
+	// The number of times that stale endpoints were kept in the cache because
+	// resolving the service name failed, see MaxStaleness.
+	Stale uint64
+}
+
+// Stats returns a snapshot of the state of the cache.
+func (cache *ResolverCache) Stats() ResolverCacheStats {
+	return ResolverCacheStats{
+		Entries:   len(cache.cache()),
+		Misses:    atomic.LoadUint64(&cache.misses),
+		Evictions: atomic.LoadUint64(&cache.evictions),
+		Stale:     atomic.LoadUint64(&cache.stale),
+	}
+}
+
+func (cache *ResolverCache) handleError(err error) {
+	if handler := cache.ErrorHandler; handler != nil {
+		handler(err)
+	} else {
+		handleError(err)
+	}
+}
+
 func (cache *ResolverCache) cacheTimeout() time.Duration {
 	if cacheTimeout := cache.CacheTimeout; cacheTimeout != 0 {
 		return cache.CacheTimeout
@@ -387,6 +689,21 @@ func (cache *ResolverCache) cacheTimeout() time.Duration {
 	return 1 * time.Second
 }
 
+// cacheTimeoutOf returns the cache timeout of the entry of the given key, which
+// is either a service name or a service name and datacenter separated by "@".
+func (cache *ResolverCache) cacheTimeoutOf(key string) time.Duration {
+	if timeouts := cache.CacheTimeouts; len(timeouts) != 0 {
+		name := key
+		if i := strings.LastIndexByte(name, '@'); i >= 0 {
+			name = name[:i]
+		}
+		if cacheTimeout, ok := timeouts[name]; ok && cacheTimeout != 0 {
+			return cacheTimeout
+		}
+	}
+	return cache.cacheTimeout()
+}
+
 func (cache *ResolverCache) cache() resolverCache {
 	cmap := cache.load()
 	if cmap == nil {
@@ -408,12 +725,27 @@ func (cache *ResolverCache) update(name string, entry *resolverEntry) {
 		entry.res = b.Balance(name, entry.res)
 	}
 
+	if entry.lastUse == 0 {
+		entry.lastUse = clockOrDefault(cache.Clock).Now().UnixNano()
+	}
+
 	for {
 		oldCache := cache.load()
 		newCache := oldCache.copy()
 		newCache[name] = entry
 
+		evicted := false
+		if max := cache.MaxEntries; max > 0 && len(newCache) > max {
+			var lru string
+			if lru, evicted = newCache.leastRecentlyUsed(name); evicted {
+				delete(newCache, lru)
+			}
+		}
+
 		if cache.compareAndSwap(oldCache, &newCache) {
+			if evicted {
+				atomic.AddUint64(&cache.evictions, 1)
+			}
 			break
 		}
 	}
@@ -421,16 +753,56 @@ func (cache *ResolverCache) update(name string, entry *resolverEntry) {
 	if (atomic.AddUint64(&cache.version, 1) % resolverCacheCleanupInterval) == 0 {
 		cache.cleanup()
 	}
+
+	if len(cache.PersistPath) != 0 {
+		cache.persist()
+	}
+}
+
+// Invalidate expires the cache entries of the service of the given name, in all
+// datacenters, so the next lookups resolve it again. Programs may call it after
+// topology changes that they know of, to pick them up without waiting for the
+// entries to time out.
+//
+// The invalidated endpoints are still served stale when resolving the service
+// fails, see MaxStaleness.
+func (cache *ResolverCache) Invalidate(name string) {
+	for {
+		oldCache := cache.load()
+		newCache := oldCache.copy()
+		invalidated := false
+
+		for key, entry := range newCache {
+			if key != name && !strings.HasPrefix(key, name+"@") {
+				continue
+			}
+			// Entries are immutable, they are replaced by expired copies.
+			newCache[key] = &resolverEntry{
+				lastUse:   atomic.LoadInt64(&entry.lastUse),
+				res:       entry.res,
+				err:       entry.err,
+				fetchedAt: entry.fetchedAt,
+				index:     entry.index,
+				stale:     entry.stale,
+			}
+			invalidated = true
+		}
+
+		if !invalidated || cache.compareAndSwap(oldCache, &newCache) {
+			break
+		}
+	}
 }
 
 func (cache *ResolverCache) cleanup() {
 	for {
 		oldCache := cache.load()
 		newCache := oldCache.copy()
-		now := time.Now()
+		now := clockOrDefault(cache.Clock).Now()
 
 		for name, entry := range newCache {
-			if now.After(entry.expireAt) {
+			// Expired entries are kept while they may be served stale.
+			if now.After(entry.expireAt) && now.Sub(entry.fetchedAt) > cache.MaxStaleness {
 				delete(newCache, name)
 			}
 		}
@@ -469,17 +841,34 @@ func (cache *ResolverCache) lookup(ctx context.Context, name string, lookup Look
 		cache.mutex.Unlock()
 	}()
 
-	res, err := lookup(ctx, name)
+	prev := cache.cache()[name]
+	info := &lookupInfo{}
+	res, err := lookup(withLookupInfo(ctx, info), name)
 
 	if ctxErr := ctx.Err(); ctxErr != nil {
 		return nil, ctxErr
 	}
 
+	now := clockOrDefault(cache.Clock).Now()
 	entry := &resolverEntry{
-		res:      res,
-		err:      err,
-		expireAt: time.Now().Add(cache.cacheTimeout()),
+		res:       res,
+		err:       err,
+		fetchedAt: now,
+		expireAt:  now.Add(cache.cacheTimeoutOf(name)),
+		index:     info.index,
 	}
+
+	if err != nil && prev != nil && prev.err == nil {
+		if age := now.Sub(prev.fetchedAt); age <= cache.MaxStaleness {
+			// The lookup is retried when the stale entry expires, the
+			// endpoints keep their original age.
+			entry.res, entry.err = prev.res, nil
+			entry.fetchedAt, entry.index, entry.stale = prev.fetchedAt, prev.index, true
+			atomic.AddUint64(&cache.stale, 1)
+			cache.handleError(fmt.Errorf("consul: serving stale endpoints of %s resolved %s ago: %w", name, age, err))
+		}
+	}
+
 	cache.update(name, entry)
 	return entry, nil
 }
@@ -492,6 +881,23 @@ func (cache *resolverCache) add(name string, entry *resolverEntry) *resolverCach
 	return &copy
 }
 
+// leastRecentlyUsed returns the name of the least recently used entry of the
+// cache, other than the one of the given name.
+func (cache resolverCache) leastRecentlyUsed(except string) (name string, ok bool) {
+	var lastUse int64
+
+	for key, entry := range cache {
+		if key == except {
+			continue
+		}
+		if t := atomic.LoadInt64(&entry.lastUse); !ok || t < lastUse {
+			name, lastUse, ok = key, t, true
+		}
+	}
+
+	return
+}
+
 func (cache *resolverCache) copy() resolverCache {
 	copy := make(resolverCache)
 	if cache != nil {
@@ -503,10 +909,18 @@ func (cache *resolverCache) copy() resolverCache {
 }
 
 type resolverEntry struct {
+	// The time at which the entry was last used, in nanoseconds, which decides
+	// of the entries evicted when the cache is full. The field is first for
+	// the alignment required by atomic operations.
+	lastUse int64
+
 	// Immutable fields, cache entries are replaced when they have to change.
-	res      []Endpoint
-	err      error
-	expireAt time.Time
+	res       []Endpoint
+	err       error
+	fetchedAt time.Time
+	expireAt  time.Time
+	index     uint64
+	stale     bool
 
 	// Lock used to ensure that only a single goroutine takes care of refreshing
 	// the cache entry before it expires.
@@ -0,0 +1,214 @@
+package consul
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHedgeDelay is the time that HedgedLookuper waits for a response
+	// before sending a hedged request, when it has no delay configured.
+	DefaultHedgeDelay = 50 * time.Millisecond
+
+	// DefaultHedgeBudgetRatio is the ratio of hedged requests to lookups that
+	// HedgedLookuper allows when it has no ratio configured.
+	DefaultHedgeBudgetRatio = 0.1
+
+	// DefaultHedgeBudgetBurst is the number of hedged requests that
+	// HedgedLookuper may send in a burst when it has no burst configured.
+	DefaultHedgeBudgetBurst = 10
+)
+
+// HedgedLookuper is a Lookuper which cuts the tail latency of service lookups
+// by hedging them: when the first lookuper has not responded after a delay, the
+// lookup is also sent to the next lookuper, and so on, and the first successful
+// response is returned. The lookups still in flight are then canceled. Failed
+// lookups cause the next lookuper to be tried right away.
+//
+// The hedged requests are sent to lookupers which query other agents or
+// datacenters, because concurrent lookups made by a Resolver are coalesced
+// into a single request to its agent. For example, to hedge with another
+// datacenter:
+//
+//	rslv := &consul.HedgedLookuper{
+//		Lookuper: consul.DefaultResolver,
+//		Hedges: []consul.Lookuper{
+//			&consul.DatacenterFailover{Datacenters: []string{"dc2"}},
+//		},
+//	}
+//
+// Hedged requests add load on consul, they are bounded by a retry budget which
+// allows a ratio of the lookups to be hedged, so a slow agent does not double
+// the number of requests sent to the servers.
+//
+// HedgedLookuper values are safe to use concurrently from multiple goroutines,
+// the fields must not be modified after the first lookup.
+type HedgedLookuper struct {
+	// The lookuper that lookups are sent to first. If nil, DefaultResolver is
+	// used.
+	Lookuper Lookuper
+
+	// The lookupers that hedged requests are sent to, in order.
+	Hedges []Lookuper
+
+	// The time waited for a response before sending the next hedged request.
+	// If zero, DefaultHedgeDelay is used.
+	Delay time.Duration
+
+	// The ratio of hedged requests to lookups allowed by the budget, each
+	// lookup adds this amount to the budget, and each hedged request consumes
+	// one. If zero, DefaultHedgeBudgetRatio is used.
+	BudgetRatio float64
+
+	// The maximum number of hedged requests that the budget accumulates, which
+	// is also the initial budget. If zero, DefaultHedgeBudgetBurst is used.
+	BudgetBurst int
+
+	// The clock used to schedule hedged requests. If nil, DefaultClock is
+	// used.
+	Clock Clock
+
+	// If not nil, the number of hedged requests is reported to Stats as
+	// "resolver.hedges", and the number of hedged requests prevented by the
+	// budget as "resolver.hedges.throttled".
+	Stats Stats
+
+	mutex  sync.Mutex
+	init   bool
+	budget float64
+}
+
+type hedgedResult struct {
+	endpoints []Endpoint
+	err       error
+}
+
+// LookupService satisfies the Lookuper interface.
+func (h *HedgedLookuper) LookupService(ctx context.Context, name string) ([]Endpoint, error) {
+	h.deposit()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	n := 1 + len(h.Hedges)
+	results := make(chan hedgedResult, n)
+
+	launch := func(i int) {
+		lookuper := lookuperOrDefault(h.Lookuper, DefaultResolver)
+		if i != 0 {
+			lookuper = h.Hedges[i-1]
+		}
+		go func() {
+			endpoints, err := lookuper.LookupService(ctx, name)
+			results <- hedgedResult{endpoints: endpoints, err: err}
+		}()
+	}
+
+	clock := clockOrDefault(h.Clock)
+	timer := clock.NewTimer(h.delay())
+	defer func() { timer.Stop() }()
+
+	launch(0)
+	sent, pending := 1, 1
+	hedging := n > 1
+
+	var firstErr error
+
+	for pending != 0 {
+		var timeout <-chan time.Time
+		if hedging {
+			timeout = timer.C()
+		}
+
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.endpoints, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if ctx.Err() != nil {
+				return nil, firstErr
+			}
+
+		case <-timeout:
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		// Either a lookup failed or the delay elapsed, the next hedged
+		// request is sent if the budget allows it.
+		if hedging {
+			if hedging = h.withdraw(name); hedging {
+				launch(sent)
+				sent++
+				pending++
+				hedging = sent < n
+				timer.Stop()
+				timer = clock.NewTimer(h.delay())
+			}
+		}
+	}
+
+	return nil, firstErr
+}
+
+func (h *HedgedLookuper) deposit() {
+	h.mutex.Lock()
+	h.load()
+	if h.budget += h.budgetRatio(); h.budget > float64(h.budgetBurst()) {
+		h.budget = float64(h.budgetBurst())
+	}
+	h.mutex.Unlock()
+}
+
+func (h *HedgedLookuper) withdraw(name string) bool {
+	h.mutex.Lock()
+	h.load()
+	ok := h.budget >= 1
+	if ok {
+		h.budget--
+	}
+	h.mutex.Unlock()
+
+	if stats := h.Stats; stats != nil {
+		if ok {
+			stats.Count("resolver.hedges", 1, Tag{"service", name})
+		} else {
+			stats.Count("resolver.hedges.throttled", 1, Tag{"service", name})
+		}
+	}
+	return ok
+}
+
+func (h *HedgedLookuper) load() {
+	if !h.init {
+		h.init = true
+		h.budget = float64(h.budgetBurst())
+	}
+}
+
+func (h *HedgedLookuper) delay() time.Duration {
+	if delay := h.Delay; delay > 0 {
+		return delay
+	}
+	return DefaultHedgeDelay
+}
+
+func (h *HedgedLookuper) budgetRatio() float64 {
+	if ratio := h.BudgetRatio; ratio > 0 {
+		return ratio
+	}
+	return DefaultHedgeBudgetRatio
+}
+
+func (h *HedgedLookuper) budgetBurst() int {
+	if burst := h.BudgetBurst; burst > 0 {
+		return burst
+	}
+	return DefaultHedgeBudgetBurst
+}
@@ -0,0 +1,118 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type lookupFunc func(context.Context, string) ([]Endpoint, error)
+
+func (f lookupFunc) LookupService(ctx context.Context, name string) ([]Endpoint, error) {
+	return f(ctx, name)
+}
+
+func TestHedgedLookuper(t *testing.T) {
+	fast := StaticEndpoints("10.0.0.2:80")
+
+	slow := lookupFunc(func(ctx context.Context, name string) ([]Endpoint, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	failing := lookupFunc(func(ctx context.Context, name string) ([]Endpoint, error) {
+		return nil, errors.New("agent unavailable")
+	})
+
+	var hedged int32
+	hedge := lookupFunc(func(ctx context.Context, name string) ([]Endpoint, error) {
+		atomic.AddInt32(&hedged, 1)
+		return fast, nil
+	})
+
+	t.Run("the primary lookuper responds first", func(t *testing.T) {
+		atomic.StoreInt32(&hedged, 0)
+		h := &HedgedLookuper{
+			Lookuper: &StaticResolver{Endpoints: map[string][]Endpoint{"web": StaticEndpoints("10.0.0.1:80")}},
+			Hedges:   []Lookuper{hedge},
+			Delay:    time.Second,
+		}
+		endpoints, err := h.LookupService(context.Background(), "web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if endpoints[0].Addr.String() != "10.0.0.1:80" {
+			t.Error("bad endpoints:", endpoints)
+		}
+		if n := atomic.LoadInt32(&hedged); n != 0 {
+			t.Error("unexpected hedged requests:", n)
+		}
+	})
+
+	t.Run("a hedged request is sent after the delay", func(t *testing.T) {
+		stats := &testStats{}
+		h := &HedgedLookuper{
+			Lookuper: slow,
+			Hedges:   []Lookuper{hedge},
+			Delay:    10 * time.Millisecond,
+			Stats:    stats,
+		}
+		endpoints, err := h.LookupService(context.Background(), "web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(endpoints, fast) {
+			t.Error("bad endpoints:", endpoints)
+		}
+		if names := stats.names(); !reflect.DeepEqual(names, []string{"resolver.hedges"}) {
+			t.Error("bad metrics:", names)
+		}
+	})
+
+	t.Run("failed lookups are hedged without waiting", func(t *testing.T) {
+		h := &HedgedLookuper{
+			Lookuper: failing,
+			Hedges:   []Lookuper{hedge},
+			Delay:    time.Hour,
+		}
+		if _, err := h.LookupService(context.Background(), "web"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("the first error is returned when all lookups fail", func(t *testing.T) {
+		h := &HedgedLookuper{
+			Lookuper: failing,
+			Hedges:   []Lookuper{failing, failing},
+		}
+		if _, err := h.LookupService(context.Background(), "web"); err == nil || err.Error() != "agent unavailable" {
+			t.Error("bad error:", err)
+		}
+	})
+
+	t.Run("hedged requests are bounded by the budget", func(t *testing.T) {
+		stats := &testStats{}
+		h := &HedgedLookuper{
+			Lookuper:    failing,
+			Hedges:      []Lookuper{hedge},
+			BudgetRatio: 0.5,
+			BudgetBurst: 2,
+			Stats:       stats,
+		}
+
+		results := []bool{}
+		for i := 0; i != 5; i++ {
+			_, err := h.LookupService(context.Background(), "web")
+			results = append(results, err == nil)
+		}
+
+		// The budget starts at 2 and each lookup adds 0.5, hedged requests
+		// are allowed while it is at least 1.
+		if !reflect.DeepEqual(results, []bool{true, true, true, false, true}) {
+			t.Error("bad lookup results:", results)
+		}
+	})
+}
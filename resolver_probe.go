@@ -0,0 +1,328 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultProbeInterval is the time between two probes of an endpoint made
+	// by EndpointProber, when it has no interval configured.
+	DefaultProbeInterval = 5 * time.Second
+
+	// DefaultProbeTimeout is the time limit of probes made by EndpointProber,
+	// when it has no timeout configured.
+	DefaultProbeTimeout = 1 * time.Second
+
+	// DefaultProbeFailureThreshold is the number of consecutive failed probes
+	// after which EndpointProber ejects an endpoint, when it has no threshold
+	// configured.
+	DefaultProbeFailureThreshold = 2
+)
+
+// EndpointProbe is the interface implemented by the checks that EndpointProber
+// runs against endpoints.
+type EndpointProbe interface {
+	// Probe returns an error if the endpoint could not be reached, or is not
+	// able to serve requests.
+	Probe(ctx context.Context, endpoint Endpoint) error
+}
+
+// EndpointProbeFunc allows regular functions to be used as endpoint probes.
+type EndpointProbeFunc func(context.Context, Endpoint) error
+
+// Probe calls f, satisfies the EndpointProbe interface.
+func (f EndpointProbeFunc) Probe(ctx context.Context, endpoint Endpoint) error {
+	return f(ctx, endpoint)
+}
+
+// TCPProbe is an EndpointProbe which checks that a TCP connection can be
+// established to endpoints.
+type TCPProbe struct {
+	// The dialer used to connect to endpoints. If nil, a default dialer is
+	// used.
+	Dialer *net.Dialer
+}
+
+// Probe satisfies the EndpointProbe interface.
+func (p *TCPProbe) Probe(ctx context.Context, endpoint Endpoint) error {
+	dialer := p.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", endpoint.Addr.String())
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// HTTPProbe is an EndpointProbe which sends a GET request to endpoints, and
+// expects a response with a 2xx or 3xx status.
+type HTTPProbe struct {
+	// The path that requests are sent to. If empty, "/" is used.
+	Path string
+
+	// The scheme of the URL that requests are sent to. If empty, "http" is
+	// used.
+	Scheme string
+
+	// The transport used to send requests. If nil, http.DefaultTransport is
+	// used.
+	Transport http.RoundTripper
+}
+
+// Probe satisfies the EndpointProbe interface.
+func (p *HTTPProbe) Probe(ctx context.Context, endpoint Endpoint) error {
+	scheme, path := p.Scheme, p.Path
+	if len(scheme) == 0 {
+		scheme = "http"
+	}
+	if len(path) == 0 || path[0] != '/' {
+		path = "/" + path
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", scheme+"://"+endpoint.Addr.String()+path, nil)
+	if err != nil {
+		return err
+	}
+
+	transport := p.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 400 {
+		return fmt.Errorf("%s %s: %s", req.Method, req.URL, res.Status)
+	}
+	return nil
+}
+
+// EndpointProber is a Balancer which probes the endpoints it balances from the
+// local host, and ejects the endpoints that consul reports healthy but which
+// are unreachable, for example because of an asymmetric network partition.
+//
+// Probes are sent in the background, the first time that an endpoint is seen
+// and then every Interval while the endpoint is still balanced, so lookups
+// never wait on them. Endpoints are ejected after FailureThreshold consecutive
+// failed probes, and return after their first successful probe. The health
+// status reported by consul takes precedence: endpoints which consul reports
+// critical or in maintenance are not probed, and are left to the resolver's
+// filters. When all the probed endpoints of a service are unreachable, none of
+// them are ejected, since the problem is more likely on the local host.
+//
+// An EndpointProber is usually combined with other balancers, for example:
+//
+//	rslv := &consul.Resolver{
+//		Balancer: consul.MultiBalancer(&consul.EndpointProber{}, &consul.Shuffler{}),
+//	}
+//
+// EndpointProber values are safe to use concurrently from multiple goroutines,
+// the fields must not be modified after the first call to Balance.
+type EndpointProber struct {
+	// The probe run against endpoints. If nil, a TCPProbe is used.
+	Probe EndpointProbe
+
+	// The time between two probes of an endpoint. If zero,
+	// DefaultProbeInterval is used.
+	Interval time.Duration
+
+	// The time limit of each probe. If zero, DefaultProbeTimeout is used.
+	Timeout time.Duration
+
+	// The number of consecutive failed probes after which endpoints are
+	// ejected. If zero, DefaultProbeFailureThreshold is used.
+	FailureThreshold int
+
+	// The clock used to schedule probes. If nil, DefaultClock is used.
+	Clock Clock
+
+	// If not nil, the number of failed probes is reported to Stats as
+	// "resolver.probes.failures", and the number of ejected endpoints as
+	// "resolver.probes.ejections".
+	Stats Stats
+
+	// ErrorHandler is called with the errors of probes which eject endpoints.
+	// If nil, DefaultErrorHandler is used.
+	ErrorHandler func(error)
+
+	mutex     sync.Mutex
+	probes    map[string]*endpointProbeState
+	cleanedAt time.Time
+	inflight  sync.WaitGroup
+}
+
+type endpointProbeState struct {
+	probing  bool
+	probedAt time.Time
+	seenAt   time.Time
+	failures int
+}
+
+// Balance satisfies the Balancer interface.
+func (p *EndpointProber) Balance(name string, endpoints []Endpoint) []Endpoint {
+	now := clockOrDefault(p.Clock).Now()
+	interval := p.interval()
+	threshold := p.failureThreshold()
+
+	unreachable := make([]bool, len(endpoints))
+	probed, ejected := 0, 0
+
+	p.mutex.Lock()
+
+	if p.probes == nil {
+		p.probes = make(map[string]*endpointProbeState)
+	}
+
+	for i, endpoint := range endpoints {
+		if !probeEndpoint(endpoint) {
+			continue
+		}
+
+		addr := endpoint.Addr.String()
+		state := p.probes[addr]
+		if state == nil {
+			state = &endpointProbeState{}
+			p.probes[addr] = state
+		}
+		state.seenAt = now
+
+		if !state.probing && now.Sub(state.probedAt) >= interval {
+			state.probing = true
+			p.launch(name, endpoint, state)
+		}
+
+		if probed++; state.failures >= threshold {
+			unreachable[i] = true
+			ejected++
+		}
+	}
+
+	// Probe states of endpoints which were not balanced for a while are
+	// discarded, they are probed again if the endpoints come back.
+	if now.Sub(p.cleanedAt) >= 10*interval {
+		p.cleanedAt = now
+		for addr, state := range p.probes {
+			if !state.probing && now.Sub(state.seenAt) >= 10*interval {
+				delete(p.probes, addr)
+			}
+		}
+	}
+
+	p.mutex.Unlock()
+
+	if ejected == 0 || ejected == probed {
+		return endpoints
+	}
+
+	list := endpoints[:0]
+	for i, endpoint := range endpoints {
+		if !unreachable[i] {
+			list = append(list, endpoint)
+		}
+	}
+	return list
+}
+
+// UsesRTT satisfies the RTTBalancer interface.
+func (p *EndpointProber) UsesRTT() bool { return false }
+
+// launch runs a probe of endpoint in the background, the mutex must be held.
+func (p *EndpointProber) launch(name string, endpoint Endpoint, state *endpointProbeState) {
+	p.inflight.Add(1)
+
+	go func() {
+		defer p.inflight.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout())
+		err := p.probe().Probe(ctx, endpoint)
+		cancel()
+
+		p.mutex.Lock()
+		state.probing = false
+		state.probedAt = clockOrDefault(p.Clock).Now()
+		if err == nil {
+			state.failures = 0
+		} else {
+			state.failures++
+		}
+		failures := state.failures
+		ejected := err != nil && failures == p.failureThreshold()
+		p.mutex.Unlock()
+
+		if err == nil {
+			return
+		}
+
+		if stats := p.Stats; stats != nil {
+			tag := Tag{"service", name}
+			stats.Count("resolver.probes.failures", 1, tag)
+			if ejected {
+				stats.Count("resolver.probes.ejections", 1, tag)
+			}
+		}
+
+		if ejected {
+			p.handleError(fmt.Errorf("consul: endpoint %s of %s is unreachable after %d failed probes: %w", endpoint.Addr, name, failures, err))
+		}
+	}()
+}
+
+func (p *EndpointProber) handleError(err error) {
+	if handler := p.ErrorHandler; handler != nil {
+		handler(err)
+	} else {
+		handleError(err)
+	}
+}
+
+func (p *EndpointProber) probe() EndpointProbe {
+	if probe := p.Probe; probe != nil {
+		return probe
+	}
+	return &TCPProbe{}
+}
+
+func (p *EndpointProber) interval() time.Duration {
+	if interval := p.Interval; interval > 0 {
+		return interval
+	}
+	return DefaultProbeInterval
+}
+
+func (p *EndpointProber) timeout() time.Duration {
+	if timeout := p.Timeout; timeout > 0 {
+		return timeout
+	}
+	return DefaultProbeTimeout
+}
+
+func (p *EndpointProber) failureThreshold() int {
+	if threshold := p.FailureThreshold; threshold > 0 {
+		return threshold
+	}
+	return DefaultProbeFailureThreshold
+}
+
+// probeEndpoint returns true if the endpoint should be probed, which excludes
+// the endpoints that consul already reports as unhealthy.
+func probeEndpoint(endpoint Endpoint) bool {
+	if endpoint.Addr == nil {
+		return false
+	}
+	switch endpoint.Health {
+	case Critical, Maintenance:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEndpointProber(t *testing.T) {
+	a := Endpoint{ID: "a", Addr: serviceAddr("10.0.0.1:80"), Health: Passing}
+	b := Endpoint{ID: "b", Addr: serviceAddr("10.0.0.2:80"), Health: Passing}
+	c := Endpoint{ID: "c", Addr: serviceAddr("10.0.0.3:80"), Health: Critical}
+
+	var mutex sync.Mutex
+	down := map[string]bool{}
+	probed := map[string]int{}
+
+	setDown := func(id string, isDown bool) {
+		mutex.Lock()
+		down[id] = isDown
+		mutex.Unlock()
+	}
+
+	clock := &manualClock{now: time.Unix(1000, 0)}
+	stats := &testStats{}
+	errs := []error{}
+
+	prober := &EndpointProber{
+		Probe: EndpointProbeFunc(func(ctx context.Context, endpoint Endpoint) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			probed[endpoint.ID]++
+			if down[endpoint.ID] {
+				return errors.New("connection refused")
+			}
+			return nil
+		}),
+		Interval:         time.Second,
+		FailureThreshold: 2,
+		Clock:            clock,
+		Stats:            stats,
+		ErrorHandler:     func(err error) { errs = append(errs, err) },
+	}
+
+	balance := func(endpoints ...Endpoint) []string {
+		res := prober.Balance("web", endpoints)
+		prober.inflight.Wait()
+		ids := []string{}
+		for _, e := range res {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	setDown("b", true)
+
+	// Endpoints are returned until they reach the failure threshold.
+	for i := 0; i != 2; i++ {
+		if ids := balance(a, b, c); !reflect.DeepEqual(ids, []string{"a", "b", "c"}) {
+			t.Error("bad endpoints:", ids)
+		}
+		clock.now = clock.now.Add(time.Second)
+	}
+
+	if ids := balance(a, b, c); !reflect.DeepEqual(ids, []string{"a", "c"}) {
+		t.Error("the unreachable endpoint was not ejected:", ids)
+	}
+
+	mutex.Lock()
+	if !reflect.DeepEqual(probed, map[string]int{"a": 3, "b": 3}) {
+		t.Error("bad probes:", probed)
+	}
+	mutex.Unlock()
+
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "consul: endpoint 10.0.0.2:80 of web is unreachable after 2 failed probes: ") {
+		t.Error("bad errors reported:", errs)
+	}
+
+	// Endpoints are not all ejected when none of them can be reached.
+	if ids := balance(b); !reflect.DeepEqual(ids, []string{"b"}) {
+		t.Error("bad endpoints when all are unreachable:", ids)
+	}
+
+	// Ejected endpoints return after a successful probe.
+	setDown("b", false)
+	clock.now = clock.now.Add(time.Second)
+	balance(a, b, c)
+
+	if ids := balance(a, b, c); !reflect.DeepEqual(ids, []string{"a", "b", "c"}) {
+		t.Error("the reachable endpoint was not restored:", ids)
+	}
+
+	names := stats.names()
+	if !reflect.DeepEqual(names, []string{
+		"resolver.probes.failures",
+		"resolver.probes.failures",
+		"resolver.probes.ejections",
+		"resolver.probes.failures",
+	}) {
+		t.Error("bad metrics:", names)
+	}
+}
+
+func TestEndpointProbes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/health" {
+			res.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	endpoint := Endpoint{Addr: serviceAddr(strings.TrimPrefix(server.URL, "http://"))}
+
+	if err := (&TCPProbe{}).Probe(ctx, endpoint); err != nil {
+		t.Error(err)
+	}
+
+	if err := (&HTTPProbe{Path: "/health"}).Probe(ctx, endpoint); err != nil {
+		t.Error(err)
+	}
+
+	if err := (&HTTPProbe{}).Probe(ctx, endpoint); err == nil {
+		t.Error("expected an error probing an endpoint responding with a 503 status")
+	}
+
+	server.Close()
+
+	if err := (&TCPProbe{}).Probe(ctx, endpoint); err == nil {
+		t.Error("expected an error probing a closed endpoint")
+	}
+}
@@ -0,0 +1,141 @@
+package consul
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ResolverState is a snapshot of the internal state of a resolver, as returned
+// by (*Resolver).DumpState. It is intended to help diagnose why a resolver
+// returns stale or unexpected endpoints.
+type ResolverState struct {
+	// The services in the resolver cache, sorted by name. The list is empty if
+	// the resolver has no cache.
+	Services []ResolverServiceState
+
+	// The status of the watch keeping the node coordinates up to date, nil if
+	// the resolver does not watch coordinates.
+	Coordinates *WatchState `json:",omitempty"`
+}
+
+// ResolverServiceState is the state of a service in a resolver cache.
+type ResolverServiceState struct {
+	// The name the service was resolved with.
+	Name string
+
+	// The addresses of the cached endpoints, in the order they are returned
+	// before the resolver balances them.
+	Endpoints []string
+
+	// The error returned by the last lookup of the service, if it failed.
+	Error string `json:",omitempty"`
+
+	// The consul index of the data the entry was built from, zero if the
+	// lookup function did not report it.
+	Index uint64
+
+	// The time at which the entry was resolved, its age at the time of the
+	// snapshot, and the time at which it expires.
+	UpdatedAt time.Time
+	Age       time.Duration
+	ExpiresAt time.Time
+
+	// Whether the entry expired, it is then refreshed the next time the
+	// service is resolved.
+	Expired bool
+
+	// Whether the endpoints are stale, kept because resolving the service
+	// again failed.
+	Stale bool `json:",omitempty"`
+}
+
+// WatchState reports the status of a watch running in the background.
+type WatchState struct {
+	// Whether the watch is running.
+	Running bool
+
+	// The time at which the watch last received an update.
+	UpdatedAt time.Time
+
+	// The error reported by the watch, if it failed since the last update.
+	Error string `json:",omitempty"`
+}
+
+// DumpState returns a snapshot of the state of the resolver, which includes the
+// content of its cache and the status of its background watches.
+func (rslv *Resolver) DumpState() ResolverState {
+	state := ResolverState{Services: []ResolverServiceState{}}
+
+	if cache := rslv.Cache; cache != nil {
+		state.Services = cache.dumpState()
+	}
+
+	if rslv.needsCoordinates() {
+		if t := rslv.tomography(); t.Watch {
+			running, updatedAt, err := t.watched.status()
+			state.Coordinates = &WatchState{Running: running, UpdatedAt: updatedAt}
+			if err != nil {
+				state.Coordinates.Error = err.Error()
+			}
+		}
+	}
+
+	return state
+}
+
+// StateHandler returns a HTTP handler which serves the state of rslv in JSON,
+// it may be installed on debug endpoints of programs.
+func (rslv *Resolver) StateHandler() http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		serveJSON(res, http.StatusOK, rslv.DumpState())
+	})
+}
+
+func (cache *ResolverCache) dumpState() []ResolverServiceState {
+	entries := cache.cache()
+	now := clockOrDefault(cache.Clock).Now()
+	services := make([]ResolverServiceState, 0, len(entries))
+
+	for name, entry := range entries {
+		service := ResolverServiceState{
+			Name:      name,
+			Endpoints: make([]string, len(entry.res)),
+			Index:     entry.index,
+			UpdatedAt: entry.fetchedAt,
+			ExpiresAt: entry.expireAt,
+			Expired:   now.After(entry.expireAt),
+			Stale:     entry.stale,
+		}
+
+		service.Age = now.Sub(service.UpdatedAt)
+
+		for i, endpoint := range entry.res {
+			if endpoint.Addr != nil {
+				service.Endpoints[i] = endpoint.Addr.String()
+			}
+		}
+
+		if entry.err != nil {
+			service.Error = entry.err.Error()
+		}
+
+		services = append(services, service)
+	}
+
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services
+}
+
+// lookupInfo carries the details of the query made by a lookup function called
+// by a resolver cache, which are kept in the cache entry.
+type lookupInfo struct {
+	index uint64
+}
+
+type lookupInfoKey struct{}
+
+func withLookupInfo(ctx context.Context, info *lookupInfo) context.Context {
+	return context.WithValue(ctx, lookupInfoKey{}, info)
+}
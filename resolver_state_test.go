@@ -0,0 +1,101 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResolverDumpState(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Consul-Index", "42")
+		json.NewEncoder(res).Encode([]struct {
+			Service struct {
+				ID      string
+				Address string
+				Port    int
+			}
+		}{
+			{Service: struct {
+				ID      string
+				Address string
+				Port    int
+			}{ID: "web-1", Address: "10.0.0.1", Port: 80}},
+		})
+	})
+	defer server.Close()
+
+	clock := &manualClock{now: time.Unix(1e9, 0)}
+	rslv := &Resolver{
+		Client:             client,
+		Cache:              &ResolverCache{Clock: clock, CacheTimeout: time.Minute},
+		DisableCoordinates: true,
+	}
+
+	if _, err := rslv.LookupService(context.Background(), "web"); err != nil {
+		t.Fatal(err)
+	}
+	clock.now = clock.now.Add(10 * time.Second)
+
+	state := rslv.DumpState()
+
+	if !reflect.DeepEqual(state, ResolverState{
+		Services: []ResolverServiceState{{
+			Name:      "web",
+			Endpoints: []string{"10.0.0.1:80"},
+			Index:     42,
+			UpdatedAt: time.Unix(1e9, 0),
+			Age:       10 * time.Second,
+			ExpiresAt: time.Unix(1e9, 0).Add(time.Minute),
+		}},
+	}) {
+		t.Errorf("bad resolver state: %+v", state)
+	}
+
+	rec := httptest.NewRecorder()
+	rslv.StateHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/consul", nil))
+
+	var served ResolverState
+	if err := json.NewDecoder(rec.Body).Decode(&served); err != nil {
+		t.Fatal(err)
+	}
+	if len(served.Services) != 1 || served.Services[0].Index != 42 {
+		t.Errorf("bad state served by the handler: %+v", served)
+	}
+}
+
+func TestWatchedValueStatus(t *testing.T) {
+	cache := &watchedValue{}
+	updates := make(chan error)
+
+	go cache.lookup(context.Background(), func(ctx context.Context, update func(interface{}, error)) {
+		for err := range updates {
+			update("value", err)
+		}
+	}, func(error) {})
+
+	updates <- nil
+	updates <- errors.New("oops")
+	close(updates)
+
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		running, updatedAt, err := cache.status()
+		if running && !updatedAt.IsZero() && err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("bad watch status: running=%t updatedAt=%s err=%v", running, updatedAt, err)
+		}
+	}
+
+	cache.close()
+
+	if running, _, _ := cache.status(); running {
+		t.Error("the watch must not be running after being closed")
+	}
+}
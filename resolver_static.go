@@ -0,0 +1,186 @@
+package consul
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// StaticResolver is a Lookuper which resolves service names to fixed sets of
+// endpoints, without querying consul. It is mostly useful to test programs
+// that balance load or dial services, or to provide static configurations in
+// environments where consul is not available.
+//
+// The endpoints may change over time, either by calling Set, or by scheduling
+// updates which are applied when their delay has elapsed since the first
+// lookup.
+//
+//	rslv := &consul.StaticResolver{
+//		Endpoints: map[string][]consul.Endpoint{
+//			"web": consul.StaticEndpoints("10.0.0.1:80", "10.0.0.2:80"),
+//		},
+//		Updates: []consul.StaticUpdate{
+//			{After: 10 * time.Second, Name: "web", Endpoints: nil},
+//		},
+//	}
+//
+// Services with no endpoints resolve to an empty list, like they would with a
+// Resolver.
+type StaticResolver struct {
+	// The initial endpoints of each service name.
+	Endpoints map[string][]Endpoint
+
+	// Updates applied to the endpoints over time, in any order.
+	Updates []StaticUpdate
+
+	// The balancer used to reorder the list of endpoints returned by the
+	// resolver, the lists are returned in the configured order if nil.
+	Balancer Balancer
+
+	mutex     sync.Mutex
+	start     time.Time
+	endpoints map[string][]Endpoint
+	errors    map[string]error
+	applied   []bool
+}
+
+// StaticUpdate represents an update of the endpoints of a service made by a
+// StaticResolver.
+type StaticUpdate struct {
+	// The delay after the first lookup when the update is applied.
+	After time.Duration
+
+	// The name of the service that the update applies to.
+	Name string
+
+	// The new list of endpoints of the service.
+	Endpoints []Endpoint
+
+	// If not nil, lookups of the service fail with this error after the
+	// update was applied.
+	Err error
+}
+
+// StaticEndpoints returns a list of endpoints for the given addresses, in the
+// form host:port, which is intended to be used to configure a StaticResolver.
+// The ID of each endpoint is set to its address.
+func StaticEndpoints(addrs ...string) []Endpoint {
+	endpoints := make([]Endpoint, len(addrs))
+
+	for i, addr := range addrs {
+		endpoints[i] = Endpoint{ID: addr, Addr: serviceAddr(addr)}
+	}
+
+	return endpoints
+}
+
+// LookupService satisfies the Lookuper interface.
+func (rslv *StaticResolver) LookupService(ctx context.Context, name string) ([]Endpoint, error) {
+	return rslv.LookupServiceInto(ctx, name, nil)
+}
+
+// LookupServiceInto satisfies the LookuperInto interface.
+func (rslv *StaticResolver) LookupServiceInto(ctx context.Context, name string, list []Endpoint) ([]Endpoint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rslv.mutex.Lock()
+	rslv.init()
+	rslv.update(time.Now())
+	if endpoints := rslv.endpoints[name]; cap(list) < len(endpoints) {
+		list = make([]Endpoint, 0, len(endpoints))
+	}
+	list = append(list[:0], rslv.endpoints[name]...)
+	err := rslv.errors[name]
+	rslv.mutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rslv.Balancer != nil {
+		list = rslv.Balancer.Balance(name, list)
+	}
+
+	return list, nil
+}
+
+// LookupHost resolves a service name to a list of network addresses, it
+// mirrors the method of the same name on Resolver.
+func (rslv *StaticResolver) LookupHost(ctx context.Context, name string) ([]string, error) {
+	endpoints, err := rslv.LookupService(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, len(endpoints))
+
+	for i, endpoint := range endpoints {
+		addrs[i] = endpoint.Addr.String()
+	}
+
+	return addrs, nil
+}
+
+// Set replaces the endpoints of the service with the given name, clearing
+// errors that updates may have set for it.
+func (rslv *StaticResolver) Set(name string, endpoints ...Endpoint) {
+	rslv.mutex.Lock()
+	defer rslv.mutex.Unlock()
+	rslv.init()
+	rslv.set(name, endpoints, nil)
+}
+
+func (rslv *StaticResolver) init() {
+	if rslv.endpoints != nil {
+		return
+	}
+
+	rslv.endpoints = make(map[string][]Endpoint, len(rslv.Endpoints))
+	rslv.errors = make(map[string]error)
+	rslv.applied = make([]bool, len(rslv.Updates))
+
+	for name, endpoints := range rslv.Endpoints {
+		rslv.set(name, endpoints, nil)
+	}
+}
+
+func (rslv *StaticResolver) set(name string, endpoints []Endpoint, err error) {
+	rslv.endpoints[name] = append([]Endpoint{}, endpoints...)
+
+	if err != nil {
+		rslv.errors[name] = err
+	} else {
+		delete(rslv.errors, name)
+	}
+}
+
+// update applies the updates which are due at now. When multiple updates apply
+// to the same service, the one with the longest delay wins.
+func (rslv *StaticResolver) update(now time.Time) {
+	if rslv.start.IsZero() {
+		rslv.start = now
+	}
+
+	elapsed := now.Sub(rslv.start)
+	var latest map[string]int
+
+	for i, u := range rslv.Updates {
+		if rslv.applied[i] || u.After > elapsed {
+			continue
+		}
+		if latest == nil {
+			latest = make(map[string]int)
+		}
+		if j, ok := latest[u.Name]; !ok || u.After >= rslv.Updates[j].After {
+			latest[u.Name] = i
+		}
+		rslv.applied[i] = true
+	}
+
+	for name, i := range latest {
+		u := rslv.Updates[i]
+		rslv.set(name, u.Endpoints, u.Err)
+	}
+}
@@ -0,0 +1,131 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStaticResolver(t *testing.T) {
+	ctx := context.Background()
+	errLookup := errors.New("lookup failed")
+
+	rslv := &StaticResolver{
+		Endpoints: map[string][]Endpoint{
+			"web": StaticEndpoints("10.0.0.1:80", "10.0.0.2:80"),
+		},
+		Updates: []StaticUpdate{
+			{After: 50 * time.Millisecond, Name: "web", Endpoints: StaticEndpoints("10.0.0.3:80")},
+			{After: 50 * time.Millisecond, Name: "db", Err: errLookup},
+		},
+	}
+
+	addrs, err := rslv.LookupHost(ctx, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(addrs, []string{"10.0.0.1:80", "10.0.0.2:80"}) {
+		t.Error("bad addresses:", addrs)
+	}
+
+	// Modifications of the returned lists must not affect the resolver.
+	endpoints, _ := rslv.LookupService(ctx, "web")
+	endpoints[0] = Endpoint{}
+
+	endpoints, _ = rslv.LookupService(ctx, "web")
+	if endpoints[0].ID != "10.0.0.1:80" {
+		t.Error("the endpoints of the resolver were modified:", endpoints)
+	}
+
+	if endpoints, err := rslv.LookupService(ctx, "db"); err != nil || len(endpoints) != 0 {
+		t.Error("unknown services must resolve to no endpoints:", endpoints, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if addrs, _ := rslv.LookupHost(ctx, "web"); !reflect.DeepEqual(addrs, []string{"10.0.0.3:80"}) {
+		t.Error("bad addresses after the update:", addrs)
+	}
+
+	if _, err := rslv.LookupService(ctx, "db"); err != errLookup {
+		t.Error("bad error after the update:", err)
+	}
+
+	rslv.Set("db", StaticEndpoints("10.0.0.4:5432")...)
+
+	if addrs, err := rslv.LookupHost(ctx, "db"); err != nil || !reflect.DeepEqual(addrs, []string{"10.0.0.4:5432"}) {
+		t.Error("bad addresses after setting the endpoints:", addrs, err)
+	}
+}
+
+func TestStaticResolverLookupServiceInto(t *testing.T) {
+	ctx := context.Background()
+	rslv := &StaticResolver{
+		Endpoints: map[string][]Endpoint{
+			"web": StaticEndpoints("10.0.0.1:80", "10.0.0.2:80"),
+		},
+	}
+
+	list := make([]Endpoint, 0, 10)
+	endpoints, err := rslv.LookupServiceInto(ctx, "web", list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 2 || &endpoints[:1][0] != &list[:1][0] {
+		t.Error("the endpoints were not stored in the list:", endpoints)
+	}
+
+	var lookuper Lookuper = rslv
+	if _, ok := lookuper.(LookuperInto); !ok {
+		t.Error("StaticResolver must implement LookuperInto")
+	}
+
+	if n := testing.AllocsPerRun(100, func() { rslv.LookupServiceInto(ctx, "web", list) }); n != 0 {
+		t.Error("bad number of allocations:", n)
+	}
+}
+
+func TestStaticResolverDialer(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("Hello World!"))
+	}))
+	defer httpServer.Close()
+	u, _ := url.Parse(httpServer.URL)
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext: (&Dialer{
+				Lookuper: &StaticResolver{
+					Endpoints: map[string][]Endpoint{
+						"whatever": StaticEndpoints("127.0.0.1:1", u.Host),
+					},
+				},
+			}).DialContext,
+		},
+	}
+
+	res, err := httpClient.Get("http://whatever/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if s := string(b); s != "Hello World!" {
+		t.Error("bad response:", s)
+	}
+}
+
+func TestDialerNilResolver(t *testing.T) {
+	var rslv *Resolver
+
+	if (&Dialer{Resolver: rslv}).resolver() != DefaultResolver {
+		t.Error("a nil resolver must be replaced by the default resolver")
+	}
+}
@@ -3,9 +3,11 @@ package consul
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/url"
 	"reflect"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -19,6 +21,7 @@ func TestResolver(t *testing.T) {
 		t.Run("by-ID", func(t *testing.T) { testLookupServiceByID(t, nil) })
 		t.Run("looking up service by names or IDs works properly with cache and balancers", testLookupServiceWithBalancer)
 		t.Run("looking up service by name into slice returns re-slices to proper len", func(t *testing.T) { testLookupServiceInto(t) })
+		t.Run("into-uncached", testLookupServiceIntoUncached)
 	})
 	t.Run("LookupHost", func(t *testing.T) {
 		t.Run("uncached", func(t *testing.T) { testLookupHost(t, nil) })
@@ -44,6 +47,30 @@ func testLookupServiceInto(t *testing.T) {
 	}
 }
 
+func testLookupServiceIntoUncached(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(res).Encode([]interface{}{
+			map[string]interface{}{"Service": map[string]interface{}{"ID": "A", "Address": "192.168.0.1", "Port": 4242}},
+			map[string]interface{}{"Service": map[string]interface{}{"ID": "B", "Address": "192.168.0.2", "Port": 4242}},
+		})
+	})
+	defer server.Close()
+
+	rslv := &Resolver{Client: client, DisableCoordinates: true}
+	list := make([]Endpoint, 1, 10)
+
+	endpoints, err := rslv.LookupServiceInto(context.Background(), "test", list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 2 || endpoints[1].ID != "B" {
+		t.Error("bad endpoints:", endpoints)
+	}
+	if &endpoints[0] != &list[0] {
+		t.Error("the endpoints were not stored in the list")
+	}
+}
+
 func testLookupService(t *testing.T, cache *ResolverCache) {
 	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
 		if req.Method != "GET" {
@@ -62,6 +89,7 @@ func testLookupService(t *testing.T, cache *ResolverCache) {
 			"dc":        {"dc1"},
 			"tag":       {"A", "B", "C"},
 			"node-meta": {"answer:42"},
+			"filter":    {`Service.Port == "4242"`},
 		}
 		if !reflect.DeepEqual(foundQuery, expectQuery) {
 			t.Error("bad URL query:")
@@ -88,6 +116,7 @@ func testLookupService(t *testing.T, cache *ResolverCache) {
 		Client:      client,
 		ServiceTags: []string{"A", "B", "C"},
 		NodeMeta:    map[string]string{"answer": "42"},
+		Filter:      Selector("Service.Port").Equal("4242"),
 		OnlyPassing: true,
 		AllowStale:  true,
 		AllowCached: true,
@@ -446,6 +475,190 @@ func BenchmarkResolverCacheIntoResize(b *testing.B) {
 	})
 }
 
+func TestResolverLazyCoordinates(t *testing.T) {
+	tests := []struct {
+		scenario string
+		resolver Resolver
+		fetch    bool
+	}{
+		{
+			scenario: "round-robin balancer",
+			resolver: Resolver{Balancer: &RoundRobin{}},
+			fetch:    false,
+		},
+		{
+			scenario: "no balancer",
+			resolver: Resolver{},
+			fetch:    false,
+		},
+		{
+			scenario: "RTT-weighted shuffler",
+			resolver: Resolver{Balancer: &WeightedShuffler{WeightOf: WeightRTT}},
+			fetch:    true,
+		},
+		{
+			scenario: "multi balancer with an RTT-weighted shuffler",
+			resolver: Resolver{Balancer: MultiBalancer(PreferTags{"a"}, &WeightedShuffler{WeightOf: WeightRTT})},
+			fetch:    true,
+		},
+		{
+			scenario: "balancer function",
+			resolver: Resolver{Balancer: BalancerFunc(func(_ string, list []Endpoint) []Endpoint { return list })},
+			fetch:    true,
+		},
+		{
+			scenario: "sort function",
+			resolver: Resolver{Sort: WeightedShuffleOnRTT},
+			fetch:    true,
+		},
+		{
+			scenario: "cache balancer",
+			resolver: Resolver{Balancer: &Shuffler{}, Cache: &ResolverCache{Balancer: &WeightedShuffler{WeightOf: WeightRTT}}},
+			fetch:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			coordinates := int32(0)
+
+			server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+				switch req.URL.Path {
+				case "/v1/coordinate/nodes":
+					atomic.AddInt32(&coordinates, 1)
+					json.NewEncoder(res).Encode([]interface{}{})
+				case "/v1/agent/self":
+					json.NewEncoder(res).Encode(map[string]interface{}{})
+				default:
+					json.NewEncoder(res).Encode([]interface{}{
+						map[string]interface{}{"Service": map[string]interface{}{"ID": "A", "Address": "192.168.0.1", "Port": 4242}},
+					})
+				}
+			})
+			defer server.Close()
+
+			rslv := test.resolver
+			rslv.Client = client
+			rslv.LazyCoordinates = true
+			rslv.Agent = &Agent{Client: client}
+			rslv.Tomography = &Tomography{Client: client}
+
+			if _, err := rslv.LookupService(context.Background(), "test"); err != nil {
+				t.Fatal(err)
+			}
+
+			if fetched := atomic.LoadInt32(&coordinates) != 0; fetched != test.fetch {
+				t.Errorf("coordinates fetched: %t, expected %t", fetched, test.fetch)
+			}
+		})
+	}
+}
+
+func TestResolverCacheMaxEntries(t *testing.T) {
+	cache := &ResolverCache{MaxEntries: 2, CacheTimeout: time.Hour, Clock: &stepClock{}}
+	lookups := map[string]int{}
+
+	lookup := func(ctx context.Context, name string) ([]Endpoint, error) {
+		lookups[name]++
+		return StaticEndpoints("127.0.0.1:4242"), nil
+	}
+
+	for _, name := range []string{"A", "B", "A", "C", "A", "B"} {
+		if _, err := cache.LookupService(context.Background(), name, lookup); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// C evicts B, which was used less recently than A, then B evicts C.
+	if !reflect.DeepEqual(lookups, map[string]int{"A": 1, "B": 2, "C": 1}) {
+		t.Error("bad lookups:", lookups)
+	}
+
+	stats := cache.Stats()
+	if stats.Entries != 2 || stats.Misses != 4 || stats.Evictions != 2 {
+		t.Errorf("bad cache stats: %+v", stats)
+	}
+}
+
+func TestResolverCacheMaxStaleness(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1000, 0)}
+	errs := []error{}
+	cache := &ResolverCache{
+		CacheTimeout: time.Second,
+		MaxStaleness: time.Minute,
+		Clock:        clock,
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	}
+
+	var failing bool
+	lookup := func(ctx context.Context, name string) ([]Endpoint, error) {
+		if failing {
+			return nil, errors.New("agent unreachable")
+		}
+		return StaticEndpoints("127.0.0.1:4242"), nil
+	}
+
+	status := &LookupStatus{}
+	ctx := ContextWithLookupStatus(context.Background(), status)
+
+	if _, err := cache.LookupService(ctx, "A", lookup); err != nil {
+		t.Fatal(err)
+	}
+	if status.Stale {
+		t.Error("fresh endpoints reported as stale")
+	}
+
+	failing = true
+	clock.now = clock.now.Add(30 * time.Second)
+
+	endpoints, err := cache.LookupService(ctx, "A", lookup)
+	if err != nil {
+		t.Fatal("the stale endpoints were not served:", err)
+	}
+	if len(endpoints) != 1 || !status.Stale || status.Age != 30*time.Second {
+		t.Errorf("bad stale lookup: %v %+v", endpoints, status)
+	}
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "consul: serving stale endpoints of A resolved 30s ago: ") {
+		t.Error("bad errors reported:", errs)
+	}
+	if state := cache.dumpState(); !state[0].Stale {
+		t.Error("the stale entry is not reported in the state of the cache")
+	}
+
+	// Past the maximum staleness the errors are returned.
+	clock.now = clock.now.Add(31 * time.Second)
+
+	if _, err := cache.LookupService(ctx, "A", lookup); err == nil {
+		t.Error("expected an error once the endpoints exceeded the maximum staleness")
+	}
+
+	// Fresh endpoints replace the stale ones once the lookups succeed again.
+	failing = false
+	clock.now = clock.now.Add(2 * time.Second)
+
+	if _, err := cache.LookupService(ctx, "A", lookup); err != nil || status.Stale {
+		t.Error("bad lookup after recovering:", err, status)
+	}
+
+	if stats := cache.Stats(); stats.Stale != 1 {
+		t.Errorf("bad cache stats: %+v", stats)
+	}
+}
+
+// stepClock is a clock which moves forward by one nanosecond every time it is
+// read, so each lookup happens at a different time.
+type stepClock struct {
+	now int64
+}
+
+func (c *stepClock) Now() time.Time {
+	return time.Unix(0, atomic.AddInt64(&c.now, 1))
+}
+
+func (c *stepClock) NewTimer(d time.Duration) Timer { return DefaultClock.NewTimer(d) }
+
+func (c *stepClock) NewTicker(d time.Duration) Ticker { return DefaultClock.NewTicker(d) }
+
 func TestResolverBlacklist(t *testing.T) {
 	tests := []struct {
 		scenario string
@@ -581,3 +794,68 @@ func BenchmarkResolverBlacklist(b *testing.B) {
 		})
 	})
 }
+
+func TestResolverCacheTimeouts(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1000, 0)}
+	cache := &ResolverCache{
+		CacheTimeout:  time.Minute,
+		CacheTimeouts: map[string]time.Duration{"A": 5 * time.Second},
+		Clock:         clock,
+	}
+
+	lookups := map[string]int{}
+	lookup := func(ctx context.Context, name string) ([]Endpoint, error) {
+		lookups[name]++
+		return StaticEndpoints("127.0.0.1:4242"), nil
+	}
+
+	ctx := context.Background()
+
+	for _, name := range []string{"A", "A@dc2", "B"} {
+		cache.LookupService(ctx, name, lookup)
+	}
+
+	clock.now = clock.now.Add(10 * time.Second)
+
+	for _, name := range []string{"A", "A@dc2", "B"} {
+		cache.LookupService(ctx, name, lookup)
+	}
+
+	if !reflect.DeepEqual(lookups, map[string]int{"A": 2, "A@dc2": 2, "B": 1}) {
+		t.Error("bad lookups:", lookups)
+	}
+
+	cache.Invalidate("A")
+	cache.Invalidate("B")
+
+	for _, name := range []string{"A", "A@dc2", "B"} {
+		cache.LookupService(ctx, name, lookup)
+	}
+
+	if !reflect.DeepEqual(lookups, map[string]int{"A": 3, "A@dc2": 3, "B": 2}) {
+		t.Error("bad lookups after invalidating the cache:", lookups)
+	}
+}
+
+func TestResolverCacheInvalidateMaxStaleness(t *testing.T) {
+	cache := &ResolverCache{
+		CacheTimeout: time.Minute,
+		MaxStaleness: time.Hour,
+		ErrorHandler: func(error) {},
+	}
+
+	ctx := context.Background()
+
+	cache.LookupService(ctx, "A", func(context.Context, string) ([]Endpoint, error) {
+		return StaticEndpoints("127.0.0.1:4242"), nil
+	})
+
+	cache.Invalidate("A")
+
+	endpoints, err := cache.LookupService(ctx, "A", func(context.Context, string) ([]Endpoint, error) {
+		return nil, errors.New("agent unreachable")
+	})
+	if err != nil || len(endpoints) != 1 {
+		t.Error("the invalidated endpoints were not served stale:", endpoints, err)
+	}
+}
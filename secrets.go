@@ -0,0 +1,238 @@
+package consul
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Secrets is the credential material that clients use to authenticate with
+// consul: an ACL token, and the TLS certificates of the agent API or of the
+// Connect service mesh. Empty fields are not provided.
+type Secrets struct {
+	// The ACL token sent with requests.
+	Token string
+
+	// The PEM encoded certificate and private key presented by the client.
+	CertPEM       string
+	PrivateKeyPEM string
+
+	// The PEM encoded certificates of the authorities that the client trusts.
+	CAPEM string
+}
+
+// TLSCertificate returns the certificate and private key of s as a
+// tls.Certificate.
+func (s Secrets) TLSCertificate() (tls.Certificate, error) {
+	return LeafCert{CertPEM: s.CertPEM, PrivateKeyPEM: s.PrivateKeyPEM}.TLSCertificate()
+}
+
+// CertPool returns a certificate pool containing the authorities of s, or nil
+// if s has none, which means that the system roots are trusted.
+func (s Secrets) CertPool() (*x509.CertPool, error) {
+	if len(s.CAPEM) == 0 {
+		return nil, nil
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(s.CAPEM)) {
+		return nil, errors.New("consul: no certificates found in the CA of the secrets")
+	}
+	return pool, nil
+}
+
+// SecretsProvider is the interface implemented by types that provide the
+// secrets used by clients (via WithSecrets) and Connect components (via the
+// Secrets field of LeafCertManager).
+//
+// Providers are consulted on every request and TLS handshake, which is how
+// rotated secrets are picked up without restarting programs; implementations
+// are expected to cache the secrets, like FileSecrets and VaultSecrets do.
+//
+// Secrets providers must be safe to use concurrently from multiple goroutines.
+type SecretsProvider interface {
+	// Secrets returns the current secrets.
+	Secrets(ctx context.Context) (Secrets, error)
+}
+
+// SecretsProviderFunc allows regular functions to be used as secrets
+// providers.
+type SecretsProviderFunc func(context.Context) (Secrets, error)
+
+// Secrets calls f, satisfies the SecretsProvider interface.
+func (f SecretsProviderFunc) Secrets(ctx context.Context) (Secrets, error) {
+	return f(ctx)
+}
+
+// SecretsToken is a TokenProvider returning the ACL token of secrets.
+type SecretsToken struct {
+	Provider SecretsProvider
+}
+
+// Token satisfies the TokenProvider interface.
+func (t SecretsToken) Token(ctx context.Context) (string, error) {
+	s, err := t.Provider.Secrets(ctx)
+	return s.Token, err
+}
+
+// FileSecrets is a SecretsProvider which reads secrets from files, like the
+// ones written by Vault agent templates or kubernetes secret volumes. The files
+// are read again when the cache expires, so rotated secrets are picked up.
+// Files which are not configured are not read.
+type FileSecrets struct {
+	// The paths of the files holding the secrets.
+	TokenFile string
+	CertFile  string
+	KeyFile   string
+	CAFile    string
+
+	// Configures how often the files are read. If zero, they are read every
+	// minute.
+	CacheTimeout time.Duration
+
+	// Cached secrets.
+	secrets cachedValue
+}
+
+// Secrets satisfies the SecretsProvider interface.
+func (f *FileSecrets) Secrets(ctx context.Context) (Secrets, error) {
+	now := time.Now()
+	exp := now.Add(f.cacheTimeout())
+
+	val, err := f.secrets.lookup(now, exp, func() (interface{}, error) {
+		return f.read()
+	}, func(err error) {
+		handleError(fmt.Errorf("consul: reloading the secrets files: %w", err))
+	})
+
+	s, _ := val.(Secrets)
+	return s, err
+}
+
+// Expire forces the files to be read again on the next call to Secrets.
+func (f *FileSecrets) Expire() {
+	f.secrets.expire()
+}
+
+func (f *FileSecrets) read() (s Secrets, err error) {
+	files := []struct {
+		path  string
+		value *string
+	}{
+		{f.TokenFile, &s.Token},
+		{f.CertFile, &s.CertPEM},
+		{f.KeyFile, &s.PrivateKeyPEM},
+		{f.CAFile, &s.CAPEM},
+	}
+
+	for _, file := range files {
+		if len(file.path) == 0 {
+			continue
+		}
+		b, err := ioutil.ReadFile(file.path)
+		if err != nil {
+			return Secrets{}, err
+		}
+		*file.value = string(b)
+	}
+
+	s.Token = strings.TrimSpace(s.Token)
+
+	// The certificate and key are validated here so a partially rotated pair
+	// of files is never served, the previous secrets are kept instead.
+	if len(s.CertPEM) != 0 || len(s.PrivateKeyPEM) != 0 {
+		if _, err := s.TLSCertificate(); err != nil {
+			return Secrets{}, fmt.Errorf("consul: %s, %s: %w", f.CertFile, f.KeyFile, err)
+		}
+	}
+
+	return s, nil
+}
+
+func (f *FileSecrets) cacheTimeout() time.Duration {
+	if cacheTimeout := f.CacheTimeout; cacheTimeout != 0 {
+		return cacheTimeout
+	}
+	return 1 * time.Minute
+}
+
+// WithSecrets configures the client to obtain its ACL token and TLS material
+// from provider, so they can be rotated without recreating the client.
+//
+// The secrets are fetched once with ctx when the option is applied, if they
+// contain a certificate or authorities the client communicates with its agent
+// over TLS, presenting the current certificate and verifying the agent with
+// the current authorities on every new connection. Combining the option with
+// WithToken, WithTokenProvider, or WithTLS is an error.
+func WithSecrets(ctx context.Context, provider SecretsProvider) Option {
+	return func(config *clientConfig) error {
+		if provider == nil {
+			return errors.New("consul: the secrets provider must not be nil")
+		}
+		if len(config.client.Token) != 0 || config.client.TokenProvider != nil {
+			return errors.New("consul: WithSecrets cannot be combined with WithToken or WithTokenProvider")
+		}
+		if config.tls != nil {
+			return errors.New("consul: WithSecrets and WithTLS cannot be used together")
+		}
+
+		s, err := provider.Secrets(ctx)
+		if err != nil {
+			return fmt.Errorf("consul: fetching the secrets of the client: %w", err)
+		}
+
+		config.client.TokenProvider = SecretsToken{Provider: provider}
+
+		if len(s.CertPEM) != 0 || len(s.CAPEM) != 0 {
+			config.tls = secretsTLSConfig(provider)
+		}
+		return nil
+	}
+}
+
+// secretsTLSConfig returns a TLS configuration which uses the secrets of
+// provider when establishing connections to the agent.
+func secretsTLSConfig(provider SecretsProvider) *tls.Config {
+	return &tls.Config{
+		GetClientCertificate: func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			s, err := provider.Secrets(certificateRequestContext(info))
+			if err != nil {
+				return nil, err
+			}
+			if len(s.CertPEM) == 0 {
+				return &tls.Certificate{}, nil
+			}
+			cert, err := s.TLSCertificate()
+			return &cert, err
+		},
+		// The standard verification uses a fixed pool of roots, it is done
+		// below instead with the current authorities of the secrets.
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			s, err := provider.Secrets(context.Background())
+			if err != nil {
+				return err
+			}
+			roots, err := s.CertPool()
+			if err != nil {
+				return err
+			}
+
+			intermediates := x509.NewCertPool()
+			for _, cert := range state.PeerCertificates[1:] {
+				intermediates.AddCert(cert)
+			}
+
+			_, err = state.PeerCertificates[0].Verify(x509.VerifyOptions{
+				DNSName:       state.ServerName,
+				Roots:         roots,
+				Intermediates: intermediates,
+			})
+			return err
+		},
+	}
+}
@@ -0,0 +1,199 @@
+package consul
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSecrets(t *testing.T) {
+	ca := newTestCA(t, "consul.test")
+	_, certPEM, keyPEM := ca.issuePEM(t, "web", time.Hour)
+
+	dir := t.TempDir()
+	secrets := &FileSecrets{
+		TokenFile: filepath.Join(dir, "token"),
+		CertFile:  filepath.Join(dir, "cert.pem"),
+		KeyFile:   filepath.Join(dir, "key.pem"),
+		CAFile:    filepath.Join(dir, "ca.pem"),
+	}
+
+	writeFile(t, secrets.TokenFile, "token-1\n")
+	writeFile(t, secrets.CertFile, certPEM)
+	writeFile(t, secrets.KeyFile, keyPEM)
+	writeFile(t, secrets.CAFile, ca.pem)
+
+	ctx := context.Background()
+
+	s, err := secrets.Secrets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Token != "token-1" || s.CertPEM != certPEM || s.PrivateKeyPEM != keyPEM || s.CAPEM != ca.pem {
+		t.Errorf("bad secrets: %+v", s)
+	}
+	if pool, err := s.CertPool(); err != nil || pool == nil {
+		t.Error("bad certificate pool:", err)
+	}
+
+	// Files are only read again when the cache expires.
+	writeFile(t, secrets.TokenFile, "token-2\n")
+
+	if s, _ = secrets.Secrets(ctx); s.Token != "token-1" {
+		t.Error("the secrets were read before the cache expired:", s.Token)
+	}
+
+	secrets.Expire()
+
+	if s, _ = secrets.Secrets(ctx); s.Token != "token-2" {
+		t.Error("the rotated token was not read:", s.Token)
+	}
+
+	// A certificate which does not match its key is not served.
+	_, rotatedPEM, _ := ca.issuePEM(t, "web", time.Hour)
+	writeFile(t, secrets.CertFile, rotatedPEM)
+	secrets.Expire()
+
+	if s, _ = secrets.Secrets(ctx); s.CertPEM != certPEM {
+		t.Error("a mismatched certificate was served")
+	}
+}
+
+func TestVaultSecrets(t *testing.T) {
+	reads := 0
+
+	vault := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if token := req.Header.Get("X-Vault-Token"); token != "vault-token" {
+			t.Error("bad vault token:", token)
+		}
+
+		switch req.URL.Path {
+		case "/v1/secret/data/consul":
+			res.Write([]byte(`{
+				"lease_duration": 0,
+				"data": {
+					"data": {"acl-token": "kv-token", "ca": "ca-pem"},
+					"metadata": {"version": 3}
+				}
+			}`))
+
+		case "/v1/consul/creds/web":
+			reads++
+			res.Write([]byte(`{
+				"lease_id": "consul/creds/web/1234",
+				"lease_duration": 3600,
+				"data": {"token": "dynamic-token", "accessor": "1234"}
+			}`))
+
+		default:
+			http.Error(res, `{"errors":[]}`, http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+
+	ctx := context.Background()
+
+	kv := &VaultSecrets{
+		Address:  vault.URL,
+		Token:    "vault-token",
+		Path:     "secret/data/consul",
+		TokenKey: "acl-token",
+		CAKey:    "ca",
+	}
+
+	if s, err := kv.Secrets(ctx); err != nil {
+		t.Error(err)
+	} else if s.Token != "kv-token" || s.CAPEM != "ca-pem" {
+		t.Errorf("bad secrets: %+v", s)
+	}
+
+	creds := &VaultSecrets{
+		Address:      vault.URL,
+		Token:        "vault-token",
+		Path:         "consul/creds/web",
+		CacheTimeout: time.Nanosecond,
+	}
+
+	for i := 0; i != 3; i++ {
+		if s, err := creds.Secrets(ctx); err != nil {
+			t.Error(err)
+		} else if s.Token != "dynamic-token" {
+			t.Errorf("bad secrets: %+v", s)
+		}
+	}
+
+	// Dynamic secrets are kept for half of their lease, regardless of the
+	// cache timeout.
+	if reads != 1 {
+		t.Error("bad number of reads of the dynamic secret:", reads)
+	}
+
+	missing := &VaultSecrets{Address: vault.URL, Token: "vault-token", Path: "secret/data/missing"}
+
+	if _, err := missing.Secrets(ctx); err == nil {
+		t.Error("expected an error reading a missing secret")
+	}
+}
+
+func TestWithSecrets(t *testing.T) {
+	ca := newTestCA(t, "consul.test")
+	_, certPEM, keyPEM := ca.issuePEM(t, "web", time.Hour)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if len(req.TLS.PeerCertificates) == 0 {
+			t.Error("no client certificate presented")
+		}
+		if token := req.Header.Get("X-Consul-Token"); token != "secret-token" {
+			t.Error("bad token:", token)
+		}
+		res.Write([]byte(`"10.0.0.1:8300"`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	serverCA := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	provider := SecretsProviderFunc(func(context.Context) (Secrets, error) {
+		return Secrets{
+			Token:         "secret-token",
+			CertPEM:       certPEM,
+			PrivateKeyPEM: keyPEM,
+			CAPEM:         serverCA,
+		}, nil
+	})
+
+	ctx := context.Background()
+
+	client, err := NewClient(WithAddress(server.URL), WithSecrets(ctx, provider))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&Status{Client: client}).Leader(ctx); err != nil {
+		t.Error(err)
+	}
+
+	// The agent certificate is verified with the authorities of the secrets.
+	untrusted := SecretsProviderFunc(func(context.Context) (Secrets, error) {
+		return Secrets{CAPEM: ca.pem}, nil
+	})
+
+	client, err = NewClient(WithAddress(server.URL), WithSecrets(ctx, untrusted))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&Status{Client: client}).Leader(ctx); err == nil {
+		t.Error("expected an error connecting to an agent with an untrusted certificate")
+	}
+
+	if _, err := NewClient(WithToken("token"), WithSecrets(ctx, provider)); err == nil {
+		t.Error("expected an error combining WithToken and WithSecrets")
+	}
+}
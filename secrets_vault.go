@@ -0,0 +1,194 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultVaultAddress is the address of the Vault server used by VaultSecrets
+// when none is configured and the VAULT_ADDR environment variable is not set.
+const DefaultVaultAddress = "https://127.0.0.1:8200"
+
+// VaultSecrets is a SecretsProvider which reads secrets from a Vault secret,
+// like an entry of a KV secrets engine (version 1 or 2), or the credentials of
+// the consul secrets engine.
+//
+// Dynamic secrets are read again half way through their lease, other secrets
+// when the cache times out, so rotated secrets are picked up.
+type VaultSecrets struct {
+	// The address of the Vault server. If empty, the VAULT_ADDR environment
+	// variable is used, or DefaultVaultAddress.
+	Address string
+
+	// The Vault token used to read the secret. If empty, it is read from
+	// TokenFile, or from the VAULT_TOKEN environment variable.
+	Token     string
+	TokenFile string
+
+	// The path of the secret to read, for example "secret/data/consul" for a
+	// KV version 2 engine mounted at secret/, or "consul/creds/my-role".
+	Path string
+
+	// The keys of the secret data holding each of the secrets, keys which are
+	// empty or absent from the secret are not provided. If TokenKey is empty,
+	// the key "token" is used, which is the key of consul secrets engine
+	// credentials.
+	TokenKey string
+	CertKey  string
+	KeyKey   string
+	CAKey    string
+
+	// The transport used to send requests to Vault. If nil,
+	// http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// Configures how often secrets without a lease are read. If zero, they
+	// are read every minute.
+	CacheTimeout time.Duration
+
+	// Cached secrets.
+	secrets cachedValue
+}
+
+// Secrets satisfies the SecretsProvider interface.
+func (v *VaultSecrets) Secrets(ctx context.Context) (Secrets, error) {
+	now := time.Now()
+
+	val, err := v.secrets.lookupUntil(now, func() (interface{}, time.Time, error) {
+		s, lease, err := v.read(ctx)
+		exp := time.Now().Add(v.cacheTimeout())
+		// Leased secrets are read again half way through their lease, so
+		// they are replaced before Vault revokes them, and dynamic secrets
+		// are not generated more often than needed.
+		if lease > 0 {
+			exp = time.Now().Add(lease / 2)
+		}
+		return s, exp, err
+	}, func(err error) {
+		handleError(fmt.Errorf("consul: reading the secrets at %s from vault: %w", v.Path, err))
+	})
+
+	s, _ := val.(Secrets)
+	return s, err
+}
+
+// Expire forces the secret to be read again on the next call to Secrets.
+func (v *VaultSecrets) Expire() {
+	v.secrets.expire()
+}
+
+func (v *VaultSecrets) read(ctx context.Context) (s Secrets, lease time.Duration, err error) {
+	token, err := v.token()
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", v.address()+"/v1/"+strings.TrimPrefix(v.Path, "/"), nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	transport := v.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(http.MaxBytesReader(nil, res.Body, 4096))
+		err = fmt.Errorf("vault: %s %s: %s: %s", req.Method, req.URL.Path, res.Status, strings.TrimSpace(string(b)))
+		return
+	}
+
+	var secret struct {
+		LeaseID       string                 `json:"lease_id"`
+		LeaseDuration int                    `json:"lease_duration"`
+		Data          map[string]interface{} `json:"data"`
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&secret); err != nil {
+		return
+	}
+
+	data := secret.Data
+	// KV version 2 engines nest the entry under data.data.
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, isKV2 := data["metadata"]; isKV2 {
+			data = nested
+		}
+	}
+
+	keys := []struct {
+		key   string
+		value *string
+	}{
+		{v.tokenKey(), &s.Token},
+		{v.CertKey, &s.CertPEM},
+		{v.KeyKey, &s.PrivateKeyPEM},
+		{v.CAKey, &s.CAPEM},
+	}
+
+	for _, k := range keys {
+		if len(k.key) != 0 {
+			*k.value, _ = data[k.key].(string)
+		}
+	}
+
+	// The lease duration of static secrets like KV entries is only a hint of
+	// how often to read them, only dynamic secrets have a lease ID.
+	if len(secret.LeaseID) != 0 {
+		lease = time.Duration(secret.LeaseDuration) * time.Second
+	}
+	return
+}
+
+func (v *VaultSecrets) token() (string, error) {
+	if len(v.Token) != 0 {
+		return v.Token, nil
+	}
+	if len(v.TokenFile) != 0 {
+		b, err := ioutil.ReadFile(v.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return os.Getenv("VAULT_TOKEN"), nil
+}
+
+func (v *VaultSecrets) address() string {
+	address := v.Address
+	if len(address) == 0 {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if len(address) == 0 {
+		address = DefaultVaultAddress
+	}
+	return strings.TrimSuffix(address, "/")
+}
+
+func (v *VaultSecrets) tokenKey() string {
+	if key := v.TokenKey; len(key) != 0 {
+		return key
+	}
+	return "token"
+}
+
+func (v *VaultSecrets) cacheTimeout() time.Duration {
+	if cacheTimeout := v.CacheTimeout; cacheTimeout != 0 {
+		return cacheTimeout
+	}
+	return 1 * time.Minute
+}
@@ -0,0 +1,156 @@
+package consul
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultHealthCheckPath is the path of the health check registered by
+	// ServeHTTP when none was set.
+	DefaultHealthCheckPath = "/health"
+
+	// DefaultShutdownTimeout is the time given by ServeHTTP to in-flight
+	// requests to complete after its context was canceled.
+	DefaultShutdownTimeout = 10 * time.Second
+)
+
+// ServeHTTPOptions carries the options of a call to ServeHTTP, the zero-value
+// is a valid configuration.
+type ServeHTTPOptions struct {
+	// The configuration of the service registration, the ServiceName and
+	// CheckHTTP fields are set by ServeHTTP.
+	Listener Listener
+
+	// The network address that the server binds to, if empty the server binds
+	// a random port on all interfaces.
+	Address string
+
+	// The path of the HTTP health check registered with the service, if empty
+	// DefaultHealthCheckPath is used.
+	HealthCheckPath string
+
+	// The handler serving requests to the health check path. If nil, the
+	// health check reports the service as healthy until the server starts
+	// shutting down, then as unavailable so consul stops routing traffic to it
+	// while in-flight requests complete.
+	HealthCheck http.Handler
+
+	// The maximum time that the server waits for in-flight requests to
+	// complete on shutdown, if zero DefaultShutdownTimeout is used.
+	ShutdownTimeout time.Duration
+
+	// The maximum durations for reading the headers of requests, reading
+	// whole requests, and writing responses, and the maximum time that idle
+	// connections are kept open. These are set on the underlying http.Server,
+	// and zero means no timeout.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// If not nil, called with the address that the server accepts connections
+	// on, after the service was registered to consul.
+	OnListen func(net.Addr)
+}
+
+// ServeHTTP runs the full lifecycle of a HTTP service: it binds a port,
+// registers the service to consul with a HTTP health check, serves requests
+// with handler, then deregisters and gracefully shuts down the server when ctx
+// is canceled.
+//
+//	err := consul.ServeHTTP(ctx, "api", handler, consul.ServeHTTPOptions{
+//		Address: ":8080",
+//	})
+//
+// The function returns nil if the server shut down after ctx was canceled and
+// in-flight requests completed, or an error if the server could not start or
+// failed.
+func ServeHTTP(ctx context.Context, serviceName string, handler http.Handler, opts ServeHTTPOptions) error {
+	address := opts.Address
+	if len(address) == 0 {
+		address = ":0"
+	}
+
+	healthCheckPath := opts.HealthCheckPath
+	if len(healthCheckPath) == 0 {
+		healthCheckPath = DefaultHealthCheckPath
+	}
+
+	shutdownTimeout := opts.ShutdownTimeout
+	if shutdownTimeout == 0 {
+		shutdownTimeout = DefaultShutdownTimeout
+	}
+
+	shuttingDown := int32(0)
+	healthCheck := opts.HealthCheck
+	if healthCheck == nil {
+		healthCheck = http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if atomic.LoadInt32(&shuttingDown) != 0 {
+				res.WriteHeader(http.StatusServiceUnavailable)
+			} else {
+				res.WriteHeader(http.StatusOK)
+			}
+		})
+	}
+
+	lstn, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	config := opts.Listener
+	config.ServiceName = serviceName
+	config.CheckHTTP = healthCheckPath
+
+	// The returned listener deregisters the service when it gets closed by
+	// the shutdown of the server.
+	registered, err := config.Register(ctx, lstn)
+	if err != nil {
+		lstn.Close()
+		return err
+	}
+
+	if opts.OnListen != nil {
+		opts.OnListen(lstn.Addr())
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == healthCheckPath {
+				healthCheck.ServeHTTP(res, req)
+			} else {
+				handler.ServeHTTP(res, req)
+			}
+		}),
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		ReadTimeout:       opts.ReadTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		IdleTimeout:       opts.IdleTimeout,
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(registered) }()
+
+	select {
+	case err = <-served:
+		registered.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	atomic.StoreInt32(&shuttingDown, 1)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Deregistering first prevents new clients from resolving the service
+	// while the server waits for the in-flight requests to complete.
+	registered.Close()
+	err = server.Shutdown(shutdownCtx)
+	<-served
+	return err
+}
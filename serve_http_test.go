@@ -0,0 +1,101 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServeHTTP(t *testing.T) {
+	registered := make(chan serviceConfig, 1)
+	deregistered := make(chan string, 1)
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/agent/service/register":
+			var service serviceConfig
+			json.NewDecoder(req.Body).Decode(&service)
+			registered <- service
+		case "/v1/agent/service/deregister/api":
+			deregistered <- "api"
+		default:
+			t.Error("unexpected request:", req.Method, req.URL.Path)
+		}
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addrs := make(chan net.Addr, 1)
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- ServeHTTP(ctx, "api", http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Write([]byte("Hello World!"))
+		}), ServeHTTPOptions{
+			Listener: Listener{Client: client, ServiceTags: []string{"A"}},
+			Address:  "127.0.0.1:0",
+			OnListen: func(addr net.Addr) { addrs <- addr },
+		})
+	}()
+
+	var addr net.Addr
+	select {
+	case addr = <-addrs:
+	case err := <-errs:
+		t.Fatal(err)
+	}
+
+	service := <-registered
+	if service.Name != "api" || len(service.Tags) != 1 || service.Tags[0] != "A" {
+		t.Errorf("bad service registration: %+v", service)
+	}
+	if len(service.Checks) != 2 || service.Checks[1].HTTP != "http://"+addr.String()+"/health" {
+		t.Errorf("bad health checks: %+v", service.Checks)
+	}
+
+	res, err := http.Get("http://" + addr.String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(b) != "Hello World!" {
+		t.Errorf("bad response: %q", b)
+	}
+
+	res, err = http.Get("http://" + addr.String() + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Error("bad health check status:", res.StatusCode)
+	}
+
+	cancel()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server did not shut down")
+	}
+
+	select {
+	case <-deregistered:
+	default:
+		t.Error("the service was not deregistered")
+	}
+
+	if _, err := net.Dial("tcp", addr.String()); err == nil {
+		t.Error("the server is still accepting connections")
+	}
+}
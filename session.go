@@ -3,6 +3,8 @@ package consul
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -56,6 +58,98 @@ type Session struct {
 	//
 	// If zero, uses 2 x LockDelay.
 	TTL time.Duration
+
+	// The clock used to schedule renewals of the session, and of the locks
+	// attached to it. If nil, DefaultClock is used.
+	Clock Clock
+
+	// OnEvent is called with the events occurring during the lifetime of the
+	// session, like renewals or its expiration (optional). The events are also
+	// reported to the stats of the client, and those indicating that the
+	// session is at risk or was lost are logged by the client logger.
+	//
+	// The function is called synchronously by the goroutine managing the
+	// session, it must not block.
+	OnEvent func(SessionEvent)
+
+	// Store may be set to persist the session ID, so a program restarting
+	// after a crash re-adopts the session saved by its previous process if it
+	// still exists and has the same name, behavior, and TTL, and resumes
+	// renewing it. The locks held by the session are then kept, instead of
+	// being released when the session expires and blocked for its LockDelay.
+	//
+	// The ID is removed from the store when the session is destroyed.
+	Store SessionStore
+}
+
+// SessionInfo is a representation of a session as returned by the consul
+// session endpoints, which follows the structure documented at
+// https://www.consul.io/api/session.html#read-session
+type SessionInfo struct {
+	ID          SessionID
+	Name        string
+	Node        string
+	Checks      []string
+	LockDelay   time.Duration
+	Behavior    SessionBehavior
+	TTL         string
+	CreateIndex uint64
+	ModifyIndex uint64
+}
+
+// Sessions exposes methods to create and read the sessions registered to
+// consul.
+type Sessions struct {
+	// The client used to send requests to the consul agent, which may be nil
+	// to indicate that a default client should be used.
+	Client *Client
+}
+
+// Info returns the session with the given ID, or nil if it does not exist,
+// along with the query metadata.
+func (s *Sessions) Info(ctx context.Context, id SessionID, opts SessionOptions) (session *SessionInfo, meta QueryMeta, err error) {
+	var sessions []SessionInfo
+	meta, err = s.client().GetWithMeta(ctx, "/v1/session/info/"+string(id), opts.Query(), &sessions)
+	if len(sessions) != 0 {
+		session = &sessions[0]
+	}
+	return
+}
+
+// List returns the list of active sessions, along with the query metadata.
+func (s *Sessions) List(ctx context.Context, opts SessionOptions) (sessions []SessionInfo, meta QueryMeta, err error) {
+	meta, err = s.client().GetWithMeta(ctx, "/v1/session/list", opts.Query(), &sessions)
+	return
+}
+
+// WithSession constructs a copy of the context which is attached to a newly
+// created session, like the WithSession function. The session is created with
+// the client of s if it has none.
+func (s *Sessions) WithSession(ctx context.Context, session Session) (context.Context, context.CancelFunc) {
+	if session.Client == nil {
+		session.Client = s.client()
+	}
+	return WithSession(ctx, session)
+}
+
+func (s *Sessions) client() *Client {
+	if client := s.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+// DefaultSessions is a session reader configured to use the default client.
+var DefaultSessions = &Sessions{}
+
+// SessionManager is the interface of types creating sessions attached to
+// contexts, which is implemented by *Sessions.
+//
+// Programs may depend on this interface instead of calling WithSession, so
+// their tests can use in-memory sessions like the ones of the consultest
+// package.
+type SessionManager interface {
+	WithSession(ctx context.Context, session Session) (context.Context, context.CancelFunc)
 }
 
 var (
@@ -85,6 +179,16 @@ func WithSession(ctx context.Context, session Session) (context.Context, context
 	createSessionCtx, createSessionCancel := context.WithTimeout(ctx, session.LockDelay)
 	defer createSessionCancel()
 
+	if session.Store != nil {
+		if sid, adopted := session.adopt(createSessionCtx); adopted {
+			session.ID = sid
+			session.Client.healthState().sessionCreated()
+			session.emit(SessionAdopted, nil)
+			sessionCtx := newSessionCtx(ctx, session)
+			return sessionCtx, sessionCtx.cancel
+		}
+	}
+
 	sid, err := session.Client.createSession(createSessionCtx, sessionConfig{
 		Name:      session.Name,
 		Behavior:  string(session.Behavior),
@@ -93,10 +197,18 @@ func WithSession(ctx context.Context, session Session) (context.Context, context
 	})
 
 	if err != nil {
+		if stats := session.Client.Stats; stats != nil {
+			stats.Count("session.creates", 1, Tag{"result", "error"})
+		}
 		return errorContext(ctx, err)
 	}
 
 	session.ID = SessionID(sid)
+	if session.Store != nil {
+		session.save(createSessionCtx, session.ID)
+	}
+	session.Client.healthState().sessionCreated()
+	session.emit(SessionCreated, nil)
 	sessionCtx := newSessionCtx(ctx, session)
 	return sessionCtx, sessionCtx.cancel
 }
@@ -141,7 +253,7 @@ func newSessionCtx(ctx context.Context, session Session) *sessionCtx {
 		ctx:     ctx,
 		done:    make(chan struct{}),
 	}
-	go s.run(time.Now().Add(session.TTL))
+	go s.run(session.clock().Now().Add(session.TTL))
 	return s
 }
 
@@ -175,8 +287,14 @@ func (s *sessionCtx) cancelWithError(err error) {
 		close(s.done)
 
 		ctx, cancel := context.WithTimeout(context.Background(), s.session.LockDelay)
-		s.session.Client.destroySession(ctx, s.id())
+		destroyErr := s.session.Client.destroySession(ctx, s.id())
+		if s.session.Store != nil && destroyErr == nil {
+			s.session.save(ctx, "")
+		}
 		cancel()
+
+		s.session.Client.healthState().sessionDestroyed(errors.Is(err, ErrSessionExpired))
+		s.session.emit(SessionDestroyed, destroyErr)
 	})
 }
 
@@ -186,7 +304,7 @@ func (s *sessionCtx) id() string {
 
 func (s *sessionCtx) run(deadline time.Time) {
 	timeout := s.session.TTL / 3
-	ticker := time.NewTicker(timeout)
+	ticker := s.session.clock().NewTicker(timeout)
 	defer ticker.Stop()
 
 	for {
@@ -196,24 +314,40 @@ func (s *sessionCtx) run(deadline time.Time) {
 		case <-s.ctx.Done():
 			s.cancelWithError(s.ctx.Err())
 			return
-		case now := <-ticker.C:
+		case now := <-ticker.C():
 			renewSessionCtx, renewSessionCancel := context.WithTimeout(s, timeout)
 			err := s.session.Client.renewSession(renewSessionCtx, s.id())
 			renewSessionCancel()
 
 			if err != nil {
-				if now.Before(deadline) {
+				// The renewal is interrupted when the session is canceled,
+				// which is not a failure.
+				if s.Err() != nil {
+					return
+				}
+
+				s.session.emit(SessionRenewFailed, err)
+
+				// A session which is not found was invalidated by consul, there
+				// is no point retrying until the deadline.
+				if now.Before(deadline) && !errors.Is(err, ErrNotFound) {
 					continue
 				}
-				s.cancelWithError(err)
+				s.session.emit(SessionExpired, err)
+				s.cancelWithError(withKind(ErrSessionExpired, fmt.Errorf("session %s expired: %w", s.id(), err)))
 				return
 			}
 
+			s.session.emit(SessionRenewed, nil)
 			deadline = now.Add(s.session.TTL)
 		}
 	}
 }
 
+func (s Session) clock() Clock {
+	return clockOrDefault(s.Clock)
+}
+
 type duration time.Duration
 
 func (d duration) MarshalJSON() ([]byte, error) {
@@ -0,0 +1,112 @@
+package consul
+
+import (
+	"fmt"
+	"time"
+)
+
+// SessionEventType is an enumeration of the events occurring during the
+// lifetime of sessions.
+type SessionEventType string
+
+const (
+	// SessionCreated is emitted when a session was created.
+	SessionCreated SessionEventType = "created"
+
+	// SessionAdopted is emitted when a session saved to the session store by
+	// a previous process was re-adopted instead of creating a new session.
+	SessionAdopted SessionEventType = "adopted"
+
+	// SessionRenewed is emitted when the TTL of a session was renewed.
+	SessionRenewed SessionEventType = "renewed"
+
+	// SessionRenewFailed is emitted when renewing a session failed, the
+	// renewal is retried until the session expires.
+	SessionRenewFailed SessionEventType = "renew-failed"
+
+	// SessionExpired is emitted when a session could not be renewed before
+	// its TTL elapsed, or was invalidated by consul. The context of the
+	// session is canceled with an error matching ErrSessionExpired.
+	SessionExpired SessionEventType = "expired"
+
+	// SessionDestroyed is emitted when a session ended and was destroyed,
+	// which happens after it expired as well.
+	SessionDestroyed SessionEventType = "destroyed"
+)
+
+// SessionEvent carries the details of an event in the lifetime of a session.
+type SessionEvent struct {
+	// The type of the event.
+	Type SessionEventType
+
+	// The ID and name of the session.
+	ID   SessionID
+	Name string
+
+	// The time at which the event occurred, according to the session clock.
+	Time time.Time
+
+	// The error which caused a renewal to fail or the session to expire, or
+	// which occurred when destroying the session.
+	Err error
+}
+
+// String returns a human-readable representation of the event.
+func (e SessionEvent) String() string {
+	s := fmt.Sprintf("session %s", e.ID)
+	if len(e.Name) != 0 {
+		s += fmt.Sprintf(" (%s)", e.Name)
+	}
+	s += " " + string(e.Type)
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// emit reports a lifecycle event of the session to the stats and logger of the
+// session client, then to the OnEvent hook of the session.
+//
+// Only the events which indicate that the session is at risk, or was lost,
+// are logged, since renewals happen every few seconds.
+func (s Session) emit(typ SessionEventType, err error) {
+	event := SessionEvent{
+		Type: typ,
+		ID:   s.ID,
+		Name: s.Name,
+		Time: s.clock().Now(),
+		Err:  err,
+	}
+
+	if stats := s.Client.Stats; stats != nil {
+		switch typ {
+		case SessionCreated:
+			stats.Count("session.creates", 1, Tag{"result", "ok"})
+		case SessionAdopted:
+			stats.Count("session.adoptions", 1)
+		case SessionRenewed, SessionRenewFailed:
+			stats.Count("session.renewals", 1, Tag{"result", resultTag(err)})
+		case SessionExpired:
+			stats.Count("session.expirations", 1)
+		case SessionDestroyed:
+			stats.Count("session.destroys", 1, Tag{"result", resultTag(err)})
+		}
+	}
+
+	switch typ {
+	case SessionRenewFailed:
+		s.Client.logger().Printf("%s", event)
+		s.Client.handleError(fmt.Errorf("consul: renewing session %s: %w", s.ID, err))
+	case SessionExpired:
+		s.Client.logger().Printf("%s", event)
+	case SessionDestroyed:
+		if err != nil {
+			s.Client.logger().Printf("%s", event)
+			s.Client.handleError(fmt.Errorf("consul: destroying session %s: %w", s.ID, err))
+		}
+	}
+
+	if onEvent := s.OnEvent; onEvent != nil {
+		onEvent(event)
+	}
+}
@@ -0,0 +1,97 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSessionEvents(t *testing.T) {
+	renewals := int32(0)
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/v1/session/create":
+			json.NewEncoder(res).Encode(struct{ ID string }{"1234"})
+		case strings.HasPrefix(req.URL.Path, "/v1/session/renew/"):
+			// The first renewal succeeds, then the session is invalidated.
+			if atomic.AddInt32(&renewals, 1) != 1 {
+				res.WriteHeader(http.StatusNotFound)
+			}
+		}
+	})
+	defer server.Close()
+
+	logger := &testLogger{}
+	client.Logger = logger
+
+	errs := make(chan error, 10)
+	client.ErrorHandler = func(err error) { errs <- err }
+
+	events := make(chan SessionEvent, 10)
+	ctx, cancel := WithSession(context.Background(), Session{
+		Client:    client,
+		Name:      "test",
+		LockDelay: 100 * time.Millisecond,
+		TTL:       30 * time.Millisecond,
+		OnEvent:   func(e SessionEvent) { events <- e },
+	})
+	defer cancel()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the session did not expire")
+	}
+
+	var types []SessionEventType
+	for len(types) != 5 {
+		select {
+		case e := <-events:
+			if e.ID != "1234" || e.Name != "test" || e.Time.IsZero() {
+				t.Errorf("bad event: %+v", e)
+			}
+			if e.Type == SessionExpired && !errors.Is(e.Err, ErrNotFound) {
+				t.Error("bad expiration error:", e.Err)
+			}
+			types = append(types, e.Type)
+		case <-time.After(time.Second):
+			t.Fatal("missing events:", types)
+		}
+	}
+
+	if !reflect.DeepEqual(types, []SessionEventType{
+		SessionCreated,
+		SessionRenewed,
+		SessionRenewFailed,
+		SessionExpired,
+		SessionDestroyed,
+	}) {
+		t.Error("bad events:", types)
+	}
+
+	if err := <-errs; !errors.Is(err, ErrNotFound) || !strings.HasPrefix(err.Error(), "consul: renewing session 1234: ") {
+		t.Error("bad error reported to the error handler:", err)
+	}
+
+	lines := strings.Split(logger.String(), "\n")
+	if len(lines) != 2 ||
+		!strings.HasPrefix(lines[0], "session 1234 (test) renew-failed: ") ||
+		!strings.HasPrefix(lines[1], "session 1234 (test) expired: ") {
+		t.Errorf("bad log output: %q", lines)
+	}
+}
+
+func TestSessionEventString(t *testing.T) {
+	e := SessionEvent{Type: SessionDestroyed, ID: "1234"}
+
+	if s := e.String(); s != "session 1234 destroyed" {
+		t.Error("bad event string:", s)
+	}
+}
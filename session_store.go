@@ -0,0 +1,98 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// SessionStore is the interface implemented by the types that Session uses to
+// persist its ID, so a program restarting after a crash can re-adopt its
+// session, and the locks attached to it, instead of waiting for the session to
+// expire and for its lock delay to elapse.
+type SessionStore interface {
+	// LoadSessionID returns the session ID saved to the store, or an empty ID
+	// if none was saved.
+	LoadSessionID(ctx context.Context) (SessionID, error)
+
+	// SaveSessionID saves id to the store, an empty ID clears the store.
+	SaveSessionID(ctx context.Context, id SessionID) error
+}
+
+// SessionFile is a SessionStore which saves the session ID to a file on the
+// local disk.
+type SessionFile struct {
+	// The path of the file that the session ID is saved to.
+	Path string
+}
+
+// LoadSessionID satisfies the SessionStore interface.
+func (f *SessionFile) LoadSessionID(ctx context.Context) (SessionID, error) {
+	b, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return "", err
+	}
+	return SessionID(strings.TrimSpace(string(b))), nil
+}
+
+// SaveSessionID satisfies the SessionStore interface.
+func (f *SessionFile) SaveSessionID(ctx context.Context, id SessionID) error {
+	if len(id) == 0 {
+		if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return replaceFile(f.Path, []byte(string(id)+"\n"))
+}
+
+// adopt returns the ID of the session saved to the session store, if it still
+// exists and has the configuration of s, after renewing it. Sessions which do
+// not match the configuration are destroyed.
+func (s Session) adopt(ctx context.Context) (SessionID, bool) {
+	id, err := s.Store.LoadSessionID(ctx)
+	if err != nil {
+		s.Client.handleError(fmt.Errorf("consul: loading the ID of session %s: %w", s.Name, err))
+		return "", false
+	}
+	if len(id) == 0 {
+		return "", false
+	}
+
+	info, _, err := (&Sessions{Client: s.Client}).Info(ctx, id, SessionOptions{})
+	if err != nil {
+		s.Client.handleError(fmt.Errorf("consul: reading the saved session %s: %w", id, err))
+		return "", false
+	}
+
+	if info == nil {
+		return "", false
+	}
+
+	if info.Name != s.Name || info.Behavior != s.Behavior || info.TTL != seconds(s.TTL) {
+		if err := s.Client.destroySession(ctx, string(id)); err != nil {
+			s.Client.handleError(fmt.Errorf("consul: destroying the saved session %s which has a different configuration: %w", id, err))
+		}
+		return "", false
+	}
+
+	if err := s.Client.renewSession(ctx, string(id)); err != nil {
+		s.Client.handleError(fmt.Errorf("consul: renewing the saved session %s: %w", id, err))
+		return "", false
+	}
+
+	return id, true
+}
+
+// save writes the session ID to the session store, errors are reported to the
+// client since the session remains usable.
+func (s Session) save(ctx context.Context, id SessionID) {
+	if err := s.Store.SaveSessionID(ctx, id); err != nil {
+		s.Client.handleError(fmt.Errorf("consul: saving the ID of session %s: %w", s.ID, err))
+	}
+}
@@ -0,0 +1,122 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionStore(t *testing.T) {
+	var mutex sync.Mutex
+	var calls []string
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		mutex.Lock()
+		calls = append(calls, req.URL.Path)
+		mutex.Unlock()
+
+		switch {
+		case req.URL.Path == "/v1/session/create":
+			json.NewEncoder(res).Encode(struct{ ID string }{"new"})
+
+		case req.URL.Path == "/v1/session/info/saved":
+			res.Write([]byte(`[{"ID":"saved","Name":"test","Behavior":"release","TTL":"30s"}]`))
+
+		case req.URL.Path == "/v1/session/info/changed":
+			res.Write([]byte(`[{"ID":"changed","Name":"test","Behavior":"release","TTL":"60s"}]`))
+
+		case strings.HasPrefix(req.URL.Path, "/v1/session/info/"):
+			res.Write([]byte(`[]`))
+		}
+	})
+	defer server.Close()
+
+	client.ErrorHandler = func(err error) { t.Error(err) }
+
+	store := &SessionFile{Path: filepath.Join(t.TempDir(), "session")}
+
+	withSession := func(saved SessionID) (SessionID, []SessionEventType, []string) {
+		if err := store.SaveSessionID(context.Background(), saved); err != nil {
+			t.Fatal(err)
+		}
+
+		mutex.Lock()
+		calls = nil
+		mutex.Unlock()
+
+		var events []SessionEventType
+		ctx, cancel := WithSession(context.Background(), Session{
+			Client:  client,
+			Name:    "test",
+			TTL:     30 * time.Second,
+			Store:   store,
+			OnEvent: func(e SessionEvent) { events = append(events, e.Type) },
+		})
+		if ctx.Err() != nil {
+			t.Fatal(ctx.Err())
+		}
+
+		stored, err := store.LoadSessionID(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id := contextSession(ctx).ID; id != stored {
+			t.Errorf("the session ID %q was not saved to the store: %q", id, stored)
+		}
+
+		cancel()
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		return stored, events[:1], calls
+	}
+
+	t.Run("a new session is created and saved when none was saved", func(t *testing.T) {
+		id, events, calls := withSession("")
+
+		if id != "new" || !reflect.DeepEqual(events, []SessionEventType{SessionCreated}) {
+			t.Error("bad session:", id, events)
+		}
+		if !reflect.DeepEqual(calls, []string{"/v1/session/create", "/v1/session/destroy/new"}) {
+			t.Error("bad requests:", calls)
+		}
+		if _, err := os.Stat(store.Path); !os.IsNotExist(err) {
+			t.Error("the session ID was not removed from the store after destroying the session:", err)
+		}
+	})
+
+	t.Run("the saved session is adopted when it still exists", func(t *testing.T) {
+		id, events, calls := withSession("saved")
+
+		if id != "saved" || !reflect.DeepEqual(events, []SessionEventType{SessionAdopted}) {
+			t.Error("bad session:", id, events)
+		}
+		if !reflect.DeepEqual(calls, []string{"/v1/session/info/saved", "/v1/session/renew/saved", "/v1/session/destroy/saved"}) {
+			t.Error("bad requests:", calls)
+		}
+	})
+
+	t.Run("a new session is created when the saved session expired", func(t *testing.T) {
+		if id, _, _ := withSession("expired"); id != "new" {
+			t.Error("bad session:", id)
+		}
+	})
+
+	t.Run("a saved session with a different configuration is replaced", func(t *testing.T) {
+		id, _, calls := withSession("changed")
+
+		if id != "new" {
+			t.Error("bad session:", id)
+		}
+		if !reflect.DeepEqual(calls[:3], []string{"/v1/session/info/changed", "/v1/session/destroy/changed", "/v1/session/create"}) {
+			t.Error("bad requests:", calls)
+		}
+	})
+}
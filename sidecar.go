@@ -0,0 +1,92 @@
+package consul
+
+// ServiceConnect is the Connect configuration of a service registration, it
+// may be used to declare that the service is Connect-native, or to register a
+// sidecar proxy along with the service.
+type ServiceConnect struct {
+	// Set to true if the service natively supports Connect (for example using
+	// ConnectListener), and therefore does not need a sidecar proxy.
+	Native bool `json:",omitempty"`
+
+	// If non-nil, a sidecar proxy is registered along with the service, and
+	// deregistered with it. The zero-value registers a sidecar with defaults
+	// generated by consul, which is what `consul connect envoy -sidecar-for`
+	// expects.
+	SidecarService *SidecarService `json:",omitempty"`
+}
+
+// SidecarService is the registration of a sidecar proxy nested in the
+// registration of a service. Consul fills the empty fields with defaults
+// derived from the parent service, the name for example defaults to the
+// service name suffixed with "-sidecar-proxy".
+type SidecarService struct {
+	ID      string            `json:",omitempty"`
+	Name    string            `json:",omitempty"`
+	Tags    []string          `json:",omitempty"`
+	Meta    map[string]string `json:",omitempty"`
+	Address string            `json:",omitempty"`
+	Port    int               `json:",omitempty"`
+	Proxy   *ServiceProxy     `json:",omitempty"`
+}
+
+// ServiceProxy is the configuration of a Connect proxy, which follows the
+// structure documented at
+// https://www.consul.io/docs/connect/registration/service-registration.html
+//
+// When used in a SidecarService, the destination and local service fields are
+// set by consul to match the parent service.
+type ServiceProxy struct {
+	DestinationServiceName string                 `json:",omitempty"`
+	DestinationServiceID   string                 `json:",omitempty"`
+	LocalServiceAddress    string                 `json:",omitempty"`
+	LocalServicePort       int                    `json:",omitempty"`
+	Config                 map[string]interface{} `json:",omitempty"`
+	Upstreams              []Upstream             `json:",omitempty"`
+	MeshGateway            MeshGatewayConfig      `json:",omitempty"`
+	Expose                 *ExposeConfig          `json:",omitempty"`
+}
+
+// UpstreamDestinationType is an enumeration representing the kinds of targets
+// that proxy upstreams may have.
+type UpstreamDestinationType string
+
+const (
+	// UpstreamService is the destination type of upstreams targeting a
+	// service. This is the default.
+	UpstreamService UpstreamDestinationType = "service"
+
+	// UpstreamPreparedQuery is the destination type of upstreams targeting a
+	// prepared query.
+	UpstreamPreparedQuery UpstreamDestinationType = "prepared_query"
+)
+
+// Upstream is a service (or prepared query) that a proxy exposes on a local
+// port, for the application to establish Connect connections to it.
+type Upstream struct {
+	DestinationType      UpstreamDestinationType `json:",omitempty"`
+	DestinationNamespace string                  `json:",omitempty"`
+	DestinationName      string
+	Datacenter           string                 `json:",omitempty"`
+	LocalBindAddress     string                 `json:",omitempty"`
+	LocalBindPort        int                    `json:",omitempty"`
+	Config               map[string]interface{} `json:",omitempty"`
+	MeshGateway          MeshGatewayConfig      `json:",omitempty"`
+}
+
+// ExposeConfig configures the paths of the local service that a proxy exposes
+// without requiring Connect, which is typically used to let consul health
+// check a service behind its sidecar.
+type ExposeConfig struct {
+	// If true, the HTTP and gRPC checks of the service are exposed
+	// automatically.
+	Checks bool         `json:",omitempty"`
+	Paths  []ExposePath `json:",omitempty"`
+}
+
+// ExposePath is a path of the local service exposed by a proxy.
+type ExposePath struct {
+	Path          string `json:",omitempty"`
+	LocalPathPort int    `json:",omitempty"`
+	ListenerPort  int    `json:",omitempty"`
+	Protocol      string `json:",omitempty"`
+}
@@ -0,0 +1,93 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// flightGroup coalesces concurrent calls made with the same key into a single
+// call, sharing its result with all callers.
+//
+// The zero-value is a valid flightGroup, instances are safe to use
+// concurrently from multiple goroutines.
+type flightGroup struct {
+	mutex   sync.Mutex
+	flights map[interface{}]*flight
+}
+
+type flight struct {
+	done  chan struct{}
+	dups  int
+	value interface{}
+	err   error
+}
+
+// do calls fn and returns its result, unless a call with the same key is
+// already in flight, in which case it waits for that call to complete and
+// returns its result instead.
+//
+// The caller which runs fn owns the value it returns. When other callers are
+// waiting on the result, share is called to produce the value they receive,
+// which they must treat as read-only; share may be nil if the value can be
+// shared as is.
+//
+// The context of the caller running fn may be canceled while other callers
+// are waiting, in which case they retry instead of failing with an error they
+// were not responsible for.
+func (g *flightGroup) do(ctx context.Context, key interface{}, fn func() (interface{}, error), share func(interface{}) interface{}) (interface{}, error) {
+	for {
+		g.mutex.Lock()
+		f, ok := g.flights[key]
+		if ok {
+			f.dups++
+		} else {
+			if g.flights == nil {
+				g.flights = make(map[interface{}]*flight)
+			}
+			f = &flight{done: make(chan struct{})}
+			g.flights[key] = f
+		}
+		g.mutex.Unlock()
+
+		if !ok {
+			return g.run(key, f, fn, share)
+		}
+
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if isContextError(f.err) && ctx.Err() == nil {
+			continue
+		}
+
+		return f.value, f.err
+	}
+}
+
+func (g *flightGroup) run(key interface{}, f *flight, fn func() (interface{}, error), share func(interface{}) interface{}) (value interface{}, err error) {
+	defer func() {
+		g.mutex.Lock()
+		delete(g.flights, key)
+		dups := f.dups
+		g.mutex.Unlock()
+
+		f.value, f.err = value, err
+		if dups != 0 && share != nil && err == nil {
+			f.value = share(value)
+		}
+		close(f.done)
+	}()
+	return fn()
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// flights is the group coalescing the concurrent service lookups and key reads
+// of all resolvers and stores.
+var flights flightGroup
@@ -0,0 +1,181 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroup(t *testing.T) {
+	t.Run("coalesce", func(t *testing.T) {
+		g := &flightGroup{}
+		release := make(chan struct{})
+		calls := int32(0)
+		results := make(chan interface{}, 10)
+
+		for i := 0; i != 10; i++ {
+			go func() {
+				v, _ := g.do(context.Background(), "key", func() (interface{}, error) {
+					atomic.AddInt32(&calls, 1)
+					<-release
+					return "value", nil
+				}, nil)
+				results <- v
+			}()
+		}
+
+		waitFlightDups(t, g, "key", 9)
+		close(release)
+
+		for i := 0; i != 10; i++ {
+			if v := <-results; v != "value" {
+				t.Error("bad value:", v)
+			}
+		}
+		if calls != 1 {
+			t.Error("bad number of calls:", calls)
+		}
+	})
+
+	t.Run("leader-canceled", func(t *testing.T) {
+		g := &flightGroup{}
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan interface{})
+
+		go g.do(ctx, "key", func() (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}, nil)
+		waitFlightDups(t, g, "key", 0)
+
+		go func() {
+			v, _ := g.do(context.Background(), "key", func() (interface{}, error) {
+				return "value", nil
+			}, nil)
+			result <- v
+		}()
+		waitFlightDups(t, g, "key", 1)
+		cancel()
+
+		if v := <-result; v != "value" {
+			t.Error("the call must be retried when the leader is canceled:", v)
+		}
+	})
+}
+
+func TestResolverCoalesceLookups(t *testing.T) {
+	requests := int32(0)
+	release := make(chan struct{})
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		json.NewEncoder(res).Encode([]struct {
+			Service struct {
+				ID      string
+				Address string
+				Port    int
+			}
+		}{{}, {}})
+	})
+	defer server.Close()
+	defer closeOnce(release)
+
+	rslv := &Resolver{Client: client, DisableCoordinates: true}
+	wg := sync.WaitGroup{}
+
+	for i := 0; i != 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			list, err := rslv.LookupServiceInto(context.Background(), "service", make([]Endpoint, 0, 4))
+			if err != nil {
+				t.Error(err)
+			}
+			if len(list) != 2 {
+				t.Error("bad number of endpoints:", len(list))
+			}
+		}()
+	}
+
+	waitFlightDups(t, &flights, resolverFlight{rslv: rslv, name: "service"}, 9)
+	closeOnce(release)
+	wg.Wait()
+
+	if requests != 1 {
+		t.Error("bad number of requests:", requests)
+	}
+}
+
+func TestStoreCoalesceReads(t *testing.T) {
+	requests := int32(0)
+	release := make(chan struct{})
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		res.Header().Set("X-Consul-Index", "42")
+		res.Write([]byte("Hello World!"))
+	})
+	defer server.Close()
+	defer closeOnce(release)
+
+	store := &Store{Client: client, CoalesceReads: true}
+	wg := sync.WaitGroup{}
+
+	for i := 0; i != 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, index, err := store.Read(context.Background(), "key")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer value.Close()
+
+			if b, _ := ioutil.ReadAll(value); string(b) != "Hello World!" || index != 42 {
+				t.Errorf("bad read: %q at index %d", b, index)
+			}
+		}()
+	}
+
+	waitFlightDups(t, &flights, storeFlight{client: client, path: "/v1/kv/key", query: "raw"}, 9)
+	closeOnce(release)
+	wg.Wait()
+
+	if requests != 1 {
+		t.Error("bad number of requests:", requests)
+	}
+}
+
+func closeOnce(ch chan struct{}) {
+	select {
+	case <-ch:
+	default:
+		close(ch)
+	}
+}
+
+// waitFlightDups waits until the flight for key has n callers waiting on it.
+func waitFlightDups(t *testing.T, g *flightGroup, key interface{}, n int) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		g.mutex.Lock()
+		f := g.flights[key]
+		ok := f != nil && f.dups == n
+		g.mutex.Unlock()
+
+		if ok {
+			return
+		}
+	}
+
+	t.Fatalf("no flight with %d waiting callers for %v", n, key)
+}
@@ -0,0 +1,49 @@
+package consul
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+)
+
+// Snapshot returns a stream of the point-in-time snapshot of the state of the
+// consul servers, which can be used to restore the cluster with
+// RestoreSnapshot.
+//
+// The snapshot is streamed from the agent, the program must close the returned
+// value when it's done reading from it to prevent any leak of internal
+// resources.
+//
+// When AllowStale is set on the operator, any server may serve the snapshot,
+// not only the leader.
+func (op *Operator) Snapshot(ctx context.Context) (io.ReadCloser, error) {
+	_, snapshot, err := op.client().call(ctx, "GET", "/v1/snapshot", op.query(), nil)
+	return snapshot, err
+}
+
+// RestoreSnapshot restores the state of the consul servers from a snapshot
+// previously obtained by calling Snapshot. The snapshot is streamed to the
+// agent as it is read from r.
+func (op *Operator) RestoreSnapshot(ctx context.Context, r io.Reader) error {
+	send, ok := r.(io.ReadCloser)
+	if !ok {
+		send = ioutil.NopCloser(r)
+	}
+
+	_, res, err := op.client().call(ctx, "PUT", "/v1/snapshot", nil, send)
+	if err != nil {
+		return err
+	}
+
+	return res.Close()
+}
+
+// Snapshot is a helper function that delegates to the default operator.
+func Snapshot(ctx context.Context) (io.ReadCloser, error) {
+	return DefaultOperator.Snapshot(ctx)
+}
+
+// RestoreSnapshot is a helper function that delegates to the default operator.
+func RestoreSnapshot(ctx context.Context, r io.Reader) error {
+	return DefaultOperator.RestoreSnapshot(ctx, r)
+}
@@ -0,0 +1,50 @@
+package consul
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	data := bytes.Repeat([]byte("snapshot"), 1000)
+	restored := []byte(nil)
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/snapshot" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+
+		switch req.Method {
+		case "GET":
+			if stale := req.URL.Query().Get("stale"); stale != "true" {
+				t.Error("bad stale parameter:", stale)
+			}
+			res.Write(data)
+		case "PUT":
+			restored, _ = ioutil.ReadAll(req.Body)
+		default:
+			t.Error("bad method:", req.Method)
+		}
+	})
+	defer server.Close()
+
+	op := &Operator{Client: client, AllowStale: true}
+	ctx := context.Background()
+
+	snapshot, err := op.Snapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshot.Close()
+
+	if err := op.RestoreSnapshot(ctx, snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(restored, data) {
+		t.Error("the restored snapshot differs from the saved one")
+	}
+}
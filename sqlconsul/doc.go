@@ -0,0 +1,3 @@
+// Package sqlconsul provides extensions to integrate the standard database/sql
+// package with consul.
+package sqlconsul
@@ -0,0 +1,145 @@
+package consul
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stats is the interface used by the package to report metrics, like the
+// number and duration of requests sent to the agent, service lookups, or
+// session renewals. The consulstats package provides an implementation
+// exporting the metrics to Prometheus and expvar.
+//
+// Metric names are made of lower case words separated by dots, for example
+// "client.requests". Durations are reported in seconds.
+//
+// Stats must be safe to use concurrently from multiple goroutines.
+type Stats interface {
+	// Count adds n to the counter of the given name.
+	Count(name string, n int64, tags ...Tag)
+
+	// Gauge sets the current value of the gauge of the given name.
+	Gauge(name string, value float64, tags ...Tag)
+
+	// Observe records a value in the distribution of the given name.
+	Observe(name string, value float64, tags ...Tag)
+}
+
+// Tag is a name/value pair attached to metrics to break them down by
+// dimension, like the method of requests or the name of services.
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// requestRoute returns a representation of path suitable to tag metrics with,
+// which does not contain the variable parts of the path like service names or
+// keys, so the number of routes is bounded.
+func requestRoute(path string) string {
+	// Paths are made of a version, an API group, the operation, then its
+	// arguments, like /v1/health/service/<name>. Operations on the key/value
+	// store take the key right after the API group.
+	n := 4
+	if strings.HasPrefix(path, "/v1/kv/") {
+		n = 3
+	}
+
+	for i := 0; i != len(path); i++ {
+		if path[i] == '/' {
+			if n--; n == 0 {
+				return path[:i]
+			}
+		}
+	}
+
+	return path
+}
+
+func (c *Client) reportRequest(stats Stats, method string, path string, blocking bool, start time.Time, res *http.Response, err error) {
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+
+	route := requestRoute(path)
+	stats.Count("client.requests", 1, Tag{"method", method}, Tag{"route", route}, Tag{"status", status})
+
+	// Consul holds blocking queries until the data change or the wait time
+	// elapses, the time to get a response measures how long the query waited,
+	// not the latency of the agent.
+	if blocking {
+		stats.Observe("client.blocking.wait.seconds", time.Since(start).Seconds(), Tag{"route", route})
+	} else {
+		stats.Observe("client.request.seconds", time.Since(start).Seconds(), Tag{"method", method}, Tag{"route", route})
+	}
+}
+
+// transferBody wraps the body of responses to blocking queries to measure the
+// time spent reading and decoding them, after consul stopped waiting.
+type transferBody struct {
+	io.ReadCloser
+	stats Stats
+	route string
+	start time.Time
+}
+
+func newTransferBody(body io.ReadCloser, stats Stats, path string) *transferBody {
+	return &transferBody{
+		ReadCloser: body,
+		stats:      stats,
+		route:      requestRoute(path),
+		start:      time.Now(),
+	}
+}
+
+func (b *transferBody) Close() error {
+	if stats := b.stats; stats != nil {
+		b.stats = nil
+		stats.Observe("client.blocking.transfer.seconds", time.Since(b.start).Seconds(), Tag{"route", b.route})
+	}
+	return b.ReadCloser.Close()
+}
+
+func (rslv *Resolver) reportLookup(stats Stats, name string, start time.Time, list []Endpoint, err error) {
+	service, _ := splitNameID(name)
+
+	stats.Count("resolver.lookups", 1, Tag{"service", service}, Tag{"result", resultTag(err)})
+	stats.Observe("resolver.lookup.seconds", time.Since(start).Seconds(), Tag{"service", service})
+
+	if err == nil {
+		stats.Gauge("resolver.endpoints", float64(len(list)), Tag{"service", service})
+
+		// The first endpoint is the one that programs send requests to, the
+		// picks show how the balancer spreads the load across nodes.
+		if len(list) != 0 {
+			stats.Count("balancer.picks", 1, Tag{"service", service}, Tag{"node", list[0].Node})
+
+			if rtt := list[0].RTT; rtt != 0 {
+				stats.Observe("balancer.pick.rtt.seconds", rtt.Seconds(), Tag{"service", service})
+			}
+		}
+	}
+}
+
+// reportRTT reports the RTT estimated for each endpoint of a service when it was
+// resolved. Compared with the RTT of the endpoints that balancers pick, it
+// shows how effective RTT-weighted balancing is.
+func (rslv *Resolver) reportRTT(stats Stats, service string, list []Endpoint) {
+	for _, endpoint := range list {
+		if endpoint.RTT != 0 {
+			stats.Observe("resolver.endpoint.rtt.seconds", endpoint.RTT.Seconds(), Tag{"service", service})
+		}
+	}
+}
+
+// resultTag returns the value of the result tag of metrics reporting the
+// outcome of an operation.
+func resultTag(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
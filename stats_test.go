@@ -0,0 +1,123 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestRequestRoute(t *testing.T) {
+	tests := map[string]string{
+		"/v1/health/service/web":       "/v1/health/service",
+		"/v1/kv/config/app/key":        "/v1/kv",
+		"/v1/session/create":           "/v1/session/create",
+		"/v1/agent/check/pass/service": "/v1/agent/check",
+		"/v1/txn":                      "/v1/txn",
+	}
+
+	for path, route := range tests {
+		if r := requestRoute(path); r != route {
+			t.Errorf("%s: bad route: %s", path, r)
+		}
+	}
+}
+
+func TestClientBlockingQueryStats(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(`"value"`))
+	})
+	defer server.Close()
+
+	stats := &testStats{}
+	client.Stats = stats
+
+	var value string
+	if err := client.Get(context.Background(), "/v1/kv/key", Query{{"index", "1"}}, &value); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Get(context.Background(), "/v1/kv/key", nil, &value); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := stats.names(); !reflect.DeepEqual(names, []string{
+		"client.requests",
+		"client.blocking.wait.seconds",
+		"client.blocking.transfer.seconds",
+		"client.requests",
+		"client.request.seconds",
+	}) {
+		t.Error("bad metrics:", names)
+	}
+}
+
+// testStats records the names of the metrics reported to it.
+type testStats struct {
+	mutex   sync.Mutex
+	metrics []string
+}
+
+func (s *testStats) Count(name string, n int64, tags ...Tag)         { s.record(name) }
+func (s *testStats) Gauge(name string, value float64, tags ...Tag)   { s.record(name) }
+func (s *testStats) Observe(name string, value float64, tags ...Tag) { s.record(name) }
+
+func (s *testStats) record(name string) {
+	s.mutex.Lock()
+	s.metrics = append(s.metrics, name)
+	s.mutex.Unlock()
+}
+
+func (s *testStats) names() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.metrics...)
+}
+
+func TestResolverRTTStats(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/coordinate/nodes":
+			json.NewEncoder(res).Encode([]nodeCoordinates{
+				{Node: "local", Coord: Coordinates{Vec: [8]float64{0}}},
+				{Node: "A", Coord: Coordinates{Vec: [8]float64{0.001}}},
+				{Node: "B", Coord: Coordinates{Vec: [8]float64{0.002}}},
+			})
+		case "/v1/agent/self":
+			json.NewEncoder(res).Encode(map[string]interface{}{"Config": map[string]string{"NodeName": "local"}})
+		default:
+			json.NewEncoder(res).Encode([]interface{}{
+				map[string]interface{}{"Node": map[string]string{"Node": "A"}, "Service": map[string]interface{}{"ID": "A", "Address": "192.168.0.1", "Port": 4242}},
+				map[string]interface{}{"Node": map[string]string{"Node": "B"}, "Service": map[string]interface{}{"ID": "B", "Address": "192.168.0.2", "Port": 4242}},
+			})
+		}
+	})
+	defer server.Close()
+
+	stats := &testStats{}
+	client.Stats = stats
+
+	rslv := &Resolver{
+		Client:     client,
+		Agent:      &Agent{Client: client},
+		Tomography: &Tomography{Client: client},
+	}
+
+	if _, err := rslv.LookupService(context.Background(), "service"); err != nil {
+		t.Fatal(err)
+	}
+
+	rtts := 0
+	for _, name := range stats.names() {
+		switch name {
+		case "resolver.endpoint.rtt.seconds", "balancer.pick.rtt.seconds":
+			rtts++
+		}
+	}
+
+	// One observation per endpoint, and one for the endpoint picked.
+	if rtts != 3 {
+		t.Error("bad number of RTT observations:", rtts, stats.names())
+	}
+}
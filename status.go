@@ -0,0 +1,44 @@
+package consul
+
+import "context"
+
+// Status exposes methods to get information about the state of the consul
+// cluster.
+type Status struct {
+	// The client used to send requests to the consul agent, which may be nil
+	// to indicate that a default client should be used.
+	Client *Client
+}
+
+// Leader returns the address of the raft leader of the datacenter, or an empty
+// string if the cluster currently has no leader.
+func (s *Status) Leader(ctx context.Context) (leader string, err error) {
+	err = s.client().Get(ctx, "/v1/status/leader", nil, &leader)
+	return
+}
+
+// Peers returns the addresses of the raft peers of the datacenter.
+func (s *Status) Peers(ctx context.Context) (peers []string, err error) {
+	err = s.client().Get(ctx, "/v1/status/peers", nil, &peers)
+	return
+}
+
+func (s *Status) client() *Client {
+	if client := s.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+// DefaultStatus is a status endpoint configured to use the default client.
+var DefaultStatus = &Status{}
+
+// Leader is a helper function that delegates to the default status endpoint.
+func Leader(ctx context.Context) (string, error) {
+	return DefaultStatus.Leader(ctx)
+}
+
+// Peers is a helper function that delegates to the default status endpoint.
+func Peers(ctx context.Context) ([]string, error) {
+	return DefaultStatus.Peers(ctx)
+}
@@ -0,0 +1,47 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	peers := []string{"10.0.0.1:8300", "10.0.0.2:8300", "10.0.0.3:8300"}
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/status/leader":
+			json.NewEncoder(res).Encode(peers[0])
+		case "/v1/status/peers":
+			json.NewEncoder(res).Encode(peers)
+		default:
+			t.Error("bad URL path:", req.URL.Path)
+		}
+	})
+	defer server.Close()
+
+	status := &Status{Client: client}
+
+	t.Run("Leader", func(t *testing.T) {
+		leader, err := status.Leader(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if leader != peers[0] {
+			t.Error("bad leader:", leader)
+		}
+	})
+
+	t.Run("Peers", func(t *testing.T) {
+		found, err := status.Peers(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(found, peers) {
+			t.Error("bad peers:", found)
+		}
+	})
+}
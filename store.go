@@ -25,6 +25,14 @@ type Store struct {
 
 	// Allow read operations to hit any consul servers, not just the leader.
 	AllowStale bool
+
+	// If set to true, concurrent reads of the same key with the same options
+	// are coalesced into a single request, and share its result.
+	//
+	// Reads may then return values from requests started before they were
+	// called, programs which read keys right after writing them should leave
+	// this option disabled.
+	CoalesceReads bool
 }
 
 // Tree recursively scans the given key prefix in the consul key/value store,
@@ -34,11 +42,9 @@ type Store struct {
 // prefix, one may prefer to use the Walk method to iterate through the keys
 // without loading them all in memory.
 func (store *Store) Tree(ctx context.Context, prefix string) (keys []string, err error) {
-	query := Query{{Name: "keys"}}
-
-	if store.AllowStale {
-		query = append(query, Param{Name: "stale", Value: "true"})
-	}
+	opts := store.options()
+	opts.Keys = true
+	query := opts.Query()
 
 	err = store.client().Get(ctx, store.path(prefix), query, &keys)
 	for i := range keys {
@@ -54,14 +60,10 @@ func (store *Store) Tree(ctx context.Context, prefix string) (keys []string, err
 // is returned by Walk.
 func (store *Store) Walk(ctx context.Context, prefix string, walk func(key string) error) (err error) {
 	var result io.ReadCloser
-	var query = Query{
-		{Name: "keys"},
-		{Name: "recurse", Value: "true"},
-	}
+	var opts = store.options()
 
-	if store.AllowStale {
-		query = append(query, Param{Name: "stale", Value: "true"})
-	}
+	opts.Keys, opts.Recurse = true, true
+	query := opts.Query()
 
 	if _, result, err = store.client().call(ctx, "GET", store.path(prefix), query, nil); err != nil {
 		return
@@ -90,6 +92,7 @@ func (store *Store) Walk(ctx context.Context, prefix string, walk func(key strin
 type KeyData struct {
 	CreateIndex int64
 	ModifyIndex int64
+	LockIndex   int64
 	Key         string
 	Flags       int64
 	Value       []byte
@@ -103,13 +106,10 @@ type KeyData struct {
 // is returned by WalkData
 func (store *Store) WalkData(ctx context.Context, prefix string, walk func(data KeyData) error) (err error) {
 	var result io.ReadCloser
-	var query = Query{
-		{Name: "recurse", Value: "true"},
-	}
+	var opts = store.options()
 
-	if store.AllowStale {
-		query = append(query, Param{Name: "stale", Value: "true"})
-	}
+	opts.Recurse = true
+	query := opts.Query()
 
 	if _, result, err = store.client().call(ctx, "GET", store.path(prefix), query, nil); err != nil {
 		return
@@ -120,7 +120,7 @@ func (store *Store) WalkData(ctx context.Context, prefix string, walk func(data
 	var keyData KeyData
 
 	if _, err = dec.Token(); err != nil { // discard '[' to iterate the response
-		err = fmt.Errorf("error attempting to read opening '[' from consul response: %v", err)
+		err = fmt.Errorf("error attempting to read opening '[' from consul response: %w", err)
 		return
 	}
 
@@ -145,13 +145,62 @@ func (store *Store) WalkData(ctx context.Context, prefix string, walk func(data
 // The program must close the value when it's done reading from it to prevent
 // any leak of internal resources.
 func (store *Store) Read(ctx context.Context, key string) (value io.ReadCloser, index int64, err error) {
+	if store.CoalesceReads {
+		return store.readShared(ctx, key)
+	}
+	return store.read(ctx, key)
+}
+
+// storeFlight is the key of concurrent reads which are coalesced into a single
+// request.
+type storeFlight struct {
+	client *Client
+	path   string
+	query  string
+}
+
+type storeRead struct {
+	value []byte
+	index int64
+}
+
+func (store *Store) readShared(ctx context.Context, key string) (value io.ReadCloser, index int64, err error) {
+	var res interface{}
+	var opts = store.options()
+
+	opts.Raw = true
+	flight := storeFlight{
+		client: store.client(),
+		path:   store.path(key),
+		query:  contextQuery(ctx, opts.Query(), "").String(),
+	}
+
+	// The value is read in memory so it can be shared by all readers, which
+	// only ever read from it.
+	if res, err = flights.do(ctx, flight, func() (interface{}, error) {
+		value, index, err := store.read(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		defer value.Close()
+		b, err := ioutil.ReadAll(value)
+		return storeRead{value: b, index: index}, err
+	}, nil); err != nil {
+		return
+	}
+
+	r := res.(storeRead)
+	value, index = &buffer{bytes.NewReader(r.value)}, r.index
+	return
+}
+
+func (store *Store) read(ctx context.Context, key string) (value io.ReadCloser, index int64, err error) {
 	var header http.Header
 	var sindex string
-	var query = Query{{Name: "raw"}}
+	var opts = store.options()
 
-	if store.AllowStale {
-		query = append(query, Param{Name: "stale", Value: "true"})
-	}
+	opts.Raw = true
+	query := opts.Query()
 
 	if header, value, err = store.client().call(ctx, "GET", store.path(key), query, nil); err != nil {
 		return
@@ -289,7 +338,7 @@ func (store *Store) Session(ctx context.Context, key string) (session Session, e
 	}
 
 	if len(keyData.Session) == 0 {
-		err = fmt.Errorf("key %s is not locked", key)
+		err = withKind(ErrNotFound, fmt.Errorf("key %s is not locked", key))
 		return
 	}
 
@@ -302,7 +351,7 @@ func (store *Store) Session(ctx context.Context, key string) (session Session, e
 	}
 
 	if len(configs) == 0 {
-		err = fmt.Errorf("key %s is not locked", key)
+		err = withKind(ErrNotFound, fmt.Errorf("key %s is not locked", key))
 		return
 	}
 
@@ -320,18 +369,13 @@ func (store *Store) Session(ctx context.Context, key string) (session Session, e
 
 func (store *Store) readKeyData(ctx context.Context, key string) (keyData KeyData, err error) {
 	var meta []KeyData
-	var query Query
-
-	if store.AllowStale {
-		query = append(query, Param{Name: "stale", Value: "true"})
-	}
 
-	if err = store.client().Get(ctx, store.path(key), query, &meta); err != nil {
+	if err = store.client().Get(ctx, store.path(key), store.options().Query(), &meta); err != nil {
 		return
 	}
 
 	if len(meta) == 0 {
-		err = fmt.Errorf("key %s does not exist", key)
+		err = withKind(ErrNotFound, fmt.Errorf("key %s does not exist", key))
 		return
 	}
 
@@ -339,6 +383,13 @@ func (store *Store) readKeyData(ctx context.Context, key string) (keyData KeyDat
 	return
 }
 
+func (store *Store) options() (opts KVOptions) {
+	if store.AllowStale {
+		opts.Consistency = ConsistencyStale
+	}
+	return
+}
+
 func (store *Store) client() *Client {
 	if client := store.Client; client != nil {
 		return client
@@ -399,3 +450,20 @@ func formatKVPath(prefix, key string) string {
 var (
 	errMissingXConsulIndex = errors.New("missing X-Consul-Index in HTTP response")
 )
+
+// putKV writes value to key, sending it as the raw body of the request, and
+// returns whether the write succeeded.
+func (c *Client) putKV(ctx context.Context, key string, query Query, value []byte) (ok bool, err error) {
+	var req, res io.ReadCloser
+	if value != nil {
+		req = ioutil.NopCloser(bytes.NewReader(value))
+	}
+
+	if _, res, err = c.call(ctx, "PUT", "/v1/kv/"+key, query, req); err != nil {
+		return
+	}
+	defer res.Close()
+
+	err = json.NewDecoder(res).Decode(&ok)
+	return
+}
@@ -0,0 +1,132 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxTxnOps is the maximum number of operations that consul accepts in a
+// single transaction.
+const maxTxnOps = 64
+
+// GetMany reads the given keys from the consul key/value store, returning
+// their data indexed by key. Keys that don't exist are missing from the
+// returned map.
+//
+// Unlike calling Read for each key, the method sends the reads in batches of
+// up to 64 keys through the /v1/txn endpoint, which saves many round trips
+// when loading configurations made of many keys. The keys of each batch are
+// read at the same index of the store.
+func (store *Store) GetMany(ctx context.Context, keys []string) (values map[string]KeyData, err error) {
+	values = make(map[string]KeyData, len(keys))
+
+	for len(keys) != 0 {
+		n := len(keys)
+		if n > maxTxnOps {
+			n = maxTxnOps
+		}
+		if err = store.getMany(ctx, keys[:n], values); err != nil {
+			return
+		}
+		keys = keys[n:]
+	}
+
+	return
+}
+
+func (store *Store) getMany(ctx context.Context, keys []string, values map[string]KeyData) error {
+	ops := make([]txnOp, len(keys))
+	for i, key := range keys {
+		ops[i].KV = &txnKVOp{Verb: "get", Key: store.txnKey(key)}
+	}
+
+	// Consul fails transactions reading keys that don't exist, the missing
+	// keys are removed from the operations, then the transaction is retried.
+	for len(ops) != 0 {
+		var res txnResponse
+		err := store.client().Put(ctx, "/v1/txn", store.options().Query(), ops, &res)
+
+		if err == nil {
+			for _, result := range res.Results {
+				if kv := result.KV; kv != nil {
+					kv.Key = store.clean(kv.Key)
+					values[kv.Key] = *kv
+				}
+			}
+			return nil
+		}
+
+		var failed []txnError
+		if failed, err = txnErrors(err); err != nil {
+			return err
+		}
+
+		missing := make(map[int]bool, len(failed))
+		for _, e := range failed {
+			if e.OpIndex < 0 || e.OpIndex >= len(ops) {
+				return fmt.Errorf("consul: reading keys: %s", e.What)
+			}
+			if !strings.Contains(e.What, "doesn't exist") {
+				return fmt.Errorf("consul: reading key %s: %s", store.clean(ops[e.OpIndex].KV.Key), e.What)
+			}
+			missing[e.OpIndex] = true
+		}
+
+		remaining := ops[:0]
+		for i, op := range ops {
+			if !missing[i] {
+				remaining = append(remaining, op)
+			}
+		}
+		ops = remaining
+	}
+
+	return nil
+}
+
+func (store *Store) txnKey(key string) string {
+	return strings.TrimPrefix(store.path(key), "/v1/kv/")
+}
+
+type txnOp struct {
+	KV *txnKVOp `json:",omitempty"`
+}
+
+type txnKVOp struct {
+	Verb    string
+	Key     string
+	Session string `json:",omitempty"`
+}
+
+type txnResponse struct {
+	Results []struct {
+		KV *KeyData
+	}
+	Errors []txnError
+}
+
+type txnError struct {
+	OpIndex int
+	What    string
+}
+
+// txnErrors extracts the errors of the operations of a transaction from err,
+// which is returned unchanged if it was not caused by a failed transaction.
+func txnErrors(err error) ([]txnError, error) {
+	var httpErr *httpError
+
+	if !errors.As(err, &httpErr) || httpErr.statusCode != http.StatusConflict {
+		return nil, err
+	}
+
+	var res txnResponse
+	if json.Unmarshal(httpErr.body, &res) != nil || len(res.Errors) == 0 {
+		return nil, err
+	}
+
+	return res.Errors, nil
+}
@@ -0,0 +1,109 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestStoreGetMany(t *testing.T) {
+	kv := map[string]string{}
+	for i := 0; i != 100; i++ {
+		if i%10 != 3 {
+			kv["config/key-"+strconv.Itoa(i)] = "value-" + strconv.Itoa(i)
+		}
+	}
+
+	txns := 0
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != "PUT" || req.URL.Path != "/v1/txn" {
+			t.Error("bad request:", req.Method, req.URL.Path)
+		}
+		txns++
+
+		var ops []txnOp
+		if err := json.NewDecoder(req.Body).Decode(&ops); err != nil {
+			t.Error(err)
+		}
+		if len(ops) > maxTxnOps {
+			t.Error("too many operations in the transaction:", len(ops))
+		}
+
+		var r txnResponse
+		for i, op := range ops {
+			if value, ok := kv[op.KV.Key]; ok {
+				r.Results = append(r.Results, struct{ KV *KeyData }{
+					KV: &KeyData{Key: op.KV.Key, Value: []byte(value), ModifyIndex: 42},
+				})
+			} else {
+				r.Errors = append(r.Errors, txnError{OpIndex: i, What: fmt.Sprintf("key %q doesn't exist", op.KV.Key)})
+			}
+		}
+
+		if len(r.Errors) != 0 {
+			r.Results = nil
+			res.WriteHeader(http.StatusConflict)
+		}
+		json.NewEncoder(res).Encode(r)
+	})
+	defer server.Close()
+
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+
+	store := &Store{Client: client, Keyspace: "config"}
+	values, err := store.GetMany(context.Background(), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(values) != 90 {
+		t.Error("bad number of values:", len(values))
+	}
+	for i, key := range keys {
+		data, ok := values[key]
+		if missing := i%10 == 3; ok == missing {
+			t.Errorf("%s: found=%t", key, ok)
+			continue
+		}
+		if ok && (string(data.Value) != "value-"+strconv.Itoa(i) || data.Key != key) {
+			t.Errorf("bad data for %s: %+v", key, data)
+		}
+	}
+
+	// Two batches, each retried once after removing the missing keys.
+	if txns != 4 {
+		t.Error("bad number of transactions:", txns)
+	}
+}
+
+func TestStoreGetManyError(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusConflict)
+		json.NewEncoder(res).Encode(txnResponse{
+			Errors: []txnError{{OpIndex: 1, What: "Permission denied"}},
+		})
+	})
+	defer server.Close()
+
+	store := &Store{Client: client}
+	_, err := store.GetMany(context.Background(), []string{"A", "B"})
+
+	if err == nil || err.Error() != "consul: reading key B: Permission denied" {
+		t.Error("bad error:", err)
+	}
+
+	server.Config.Handler = http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusForbidden)
+	})
+
+	if _, err := store.GetMany(context.Background(), []string{"A"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Error("bad error:", err)
+	}
+}
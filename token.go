@@ -0,0 +1,84 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TokenProvider is the interface implemented by types that provide the ACL
+// tokens used by clients to authorize their requests.
+//
+// Token providers are consulted on every request, which allows tokens obtained
+// from external systems (Vault, ACL login, ...) to be rotated without having to
+// reconfigure the clients. Implementations that are expensive to call should be
+// wrapped in a CachedToken.
+//
+// Token providers must be safe to use concurrently from multiple goroutines.
+type TokenProvider interface {
+	// Token returns the ACL token to use for a request made with ctx.
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenProviderFunc allows regular functions to be used as token providers.
+type TokenProviderFunc func(context.Context) (string, error)
+
+// Token calls f, satisfies the TokenProvider interface.
+func (f TokenProviderFunc) Token(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// StaticToken is a TokenProvider which always returns the same token.
+type StaticToken string
+
+// Token satisfies the TokenProvider interface.
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// CachedToken is a TokenProvider which caches the tokens returned by another
+// provider.
+//
+// The cache is refreshed asynchronously and fully non-blocking (except for the
+// very first call which has to initialize the cache). If refreshing the token
+// fails, the previous token keeps being served until the provider succeeds.
+type CachedToken struct {
+	// The provider that tokens are obtained from.
+	Provider TokenProvider
+
+	// Configures how often the token is refreshed. If zero, the token is
+	// refreshed every minute.
+	CacheTimeout time.Duration
+
+	// Cached token.
+	token cachedValue
+}
+
+// Token satisfies the TokenProvider interface.
+func (t *CachedToken) Token(ctx context.Context) (string, error) {
+	now := time.Now()
+	exp := now.Add(t.cacheTimeout())
+
+	val, err := t.token.lookup(now, exp, func() (interface{}, error) {
+		return t.Provider.Token(ctx)
+	}, func(err error) {
+		handleError(fmt.Errorf("consul: refreshing the cached token: %w", err))
+	})
+
+	token, _ := val.(string)
+	return token, err
+}
+
+// Expire forces the token to be refreshed on the next call to Token. This is
+// useful when the program learns that the token was revoked before its cache
+// timeout was reached.
+func (t *CachedToken) Expire() {
+	t.token.expire()
+}
+
+func (t *CachedToken) cacheTimeout() time.Duration {
+	if cacheTimeout := t.CacheTimeout; cacheTimeout != 0 {
+		return cacheTimeout
+	}
+	return 1 * time.Minute
+}
@@ -0,0 +1,58 @@
+package consul
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenProvider(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if token := req.Header.Get("X-Consul-Token"); token != "dynamic" {
+			t.Error("bad token:", token)
+		}
+		res.Write([]byte(`{}`))
+	})
+	defer server.Close()
+
+	client.Token = "static"
+	client.TokenProvider = StaticToken("dynamic")
+
+	if err := client.Get(context.Background(), "/", nil, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCachedToken(t *testing.T) {
+	calls := int32(0)
+
+	token := &CachedToken{
+		Provider: TokenProviderFunc(func(ctx context.Context) (string, error) {
+			return strconv.Itoa(int(atomic.AddInt32(&calls, 1))), nil
+		}),
+		CacheTimeout: 10 * time.Millisecond,
+	}
+
+	ctx := context.Background()
+
+	for i := 0; i != 10; i++ {
+		if s, _ := token.Token(ctx); s != "1" {
+			t.Fatal("bad cached token:", s)
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if s, _ := token.Token(ctx); s != "2" {
+		t.Error("the token was not refreshed after the cache timeout:", s)
+	}
+
+	token.Expire()
+
+	if s, _ := token.Token(ctx); s != "3" {
+		t.Error("the token was not refreshed after being expired:", s)
+	}
+}
@@ -0,0 +1,69 @@
+package watch
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff is the policy applied by plans to retry failed queries.
+//
+// The delay before retrying grows exponentially with the number of
+// consecutive failures, from Min up to Max. The zero-value is a valid policy
+// which waits 1 second after the first failure, up to 30 seconds, without
+// jitter, and resets on the first successful query.
+type Backoff struct {
+	// The delay after the first failure. Defaults to 1 second.
+	Min time.Duration
+
+	// The maximum delay between retries. Defaults to 30 seconds.
+	Max time.Duration
+
+	// The factor by which the delay grows after each failure. Defaults to 2.
+	Factor float64
+
+	// Fraction of the delay which is randomized, between 0 and 1, so that
+	// multiple watches failing at the same time do not retry in lockstep.
+	// For example with a jitter of 0.2, a delay of 10 seconds becomes a
+	// random delay between 8 and 12 seconds.
+	Jitter float64
+
+	// The amount of time queries must be succeeding before the delay is reset
+	// to Min. Zero means to reset on the first successful query, larger
+	// values prevent agents with flapping connections from being queried in
+	// a tight loop.
+	ResetAfter time.Duration
+}
+
+func (b Backoff) delay(failures int) time.Duration {
+	min, max, factor := b.Min, b.Max, b.Factor
+
+	if min <= 0 {
+		min = 1 * time.Second
+	}
+	if max <= 0 {
+		max = 30 * time.Second
+	}
+	if max < min {
+		max = min
+	}
+	if factor < 1 {
+		factor = 2
+	}
+
+	d := float64(min)
+	for i := 1; i < failures && d < float64(max); i++ {
+		d *= factor
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+
+	if jitter := b.Jitter; jitter > 0 {
+		if jitter > 1 {
+			jitter = 1
+		}
+		d += d * jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(d)
+}
@@ -0,0 +1,130 @@
+package watch
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		scenario string
+		backoff  Backoff
+		delays   []time.Duration
+	}{
+		{
+			scenario: "the zero-value doubles from 1s to 30s",
+			backoff:  Backoff{},
+			delays:   []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second},
+		},
+		{
+			scenario: "custom bounds and factor",
+			backoff:  Backoff{Min: 100 * time.Millisecond, Max: time.Second, Factor: 3},
+			delays:   []time.Duration{100 * time.Millisecond, 300 * time.Millisecond, 900 * time.Millisecond, time.Second},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			for i, delay := range test.delays {
+				if d := test.backoff.delay(i + 1); d != delay {
+					t.Errorf("bad delay after %d failures: expected %s, found %s", i+1, delay, d)
+				}
+			}
+		})
+	}
+
+	t.Run("jitter randomizes the delay within bounds", func(t *testing.T) {
+		b := Backoff{Min: time.Second, Jitter: 0.5}
+		for i := 0; i < 100; i++ {
+			if d := b.delay(1); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+				t.Fatal("delay out of bounds:", d)
+			}
+		}
+	})
+}
+
+func TestPlanErrorHandler(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusInternalServerError)
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var failures []int
+	var retries []time.Duration
+
+	plan := &Plan{
+		Type:    Services,
+		Client:  client,
+		Handler: func(uint64, interface{}) { t.Error("the handler should not be called") },
+		Backoff: Backoff{Min: time.Millisecond, Max: 2 * time.Millisecond},
+		ErrorHandler: func(err error, n int, retry time.Duration) {
+			if err == nil {
+				t.Error("the error handler was called with a nil error")
+			}
+			failures = append(failures, n)
+			retries = append(retries, retry)
+			if n == 3 {
+				cancel()
+			}
+		},
+	}
+
+	if err := plan.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(failures) != 3 || failures[0] != 1 || failures[2] != 3 {
+		t.Error("bad failure counts:", failures)
+	}
+	if retries[0] != time.Millisecond || retries[2] != 2*time.Millisecond {
+		t.Error("bad retry delays:", retries)
+	}
+}
+
+func TestPlanBackoffResetAfter(t *testing.T) {
+	calls := 0
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+		// Alternate between failures and successes, simulating a flapping
+		// connection to the agent.
+		if calls%2 == 1 {
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		res.Header().Set("X-Consul-Index", "1")
+		res.Write([]byte("{}"))
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var failures []int
+
+	plan := &Plan{
+		Type:    Services,
+		Client:  client,
+		Handler: func(uint64, interface{}) {},
+		Backoff: Backoff{Min: time.Millisecond, Max: time.Millisecond, ResetAfter: time.Hour},
+		ErrorHandler: func(err error, n int, retry time.Duration) {
+			failures = append(failures, n)
+			if len(failures) == 3 {
+				cancel()
+			}
+		},
+	}
+
+	plan.Run(ctx)
+
+	// The successes in between failures are too short-lived to reset the
+	// backoff.
+	if len(failures) != 3 || failures[2] != 3 {
+		t.Error("bad failure counts:", failures)
+	}
+}
@@ -0,0 +1,196 @@
+package watch
+
+import (
+	"context"
+	"sync"
+)
+
+// Backpressure is an enumeration representing the policies applied by Chan
+// when the consumer of a channel is slower than the rate of updates.
+type Backpressure int
+
+const (
+	// Block blocks the watch until the consumer receives the update. The
+	// blocking queries are not sent while the watch is blocked, so the
+	// consumer receives the most recent state when it catches up, but the
+	// intermediate changes are lost.
+	Block Backpressure = iota
+
+	// DropOldest buffers up to the configured number of updates, dropping the
+	// oldest ones when the buffer is full.
+	DropOldest
+
+	// Coalesce keeps only the most recent update, replacing the pending one
+	// if the consumer did not receive it yet.
+	Coalesce
+)
+
+// Update carries a result of a watch delivered to a channel.
+type Update struct {
+	// The consul index of the result.
+	Index uint64
+
+	// The result of the watch, see the documentation of the plan types for
+	// the type of values.
+	Result interface{}
+
+	// The number of updates that were dropped by the backpressure policy
+	// since the previous update was delivered.
+	Dropped int
+}
+
+// Chan runs plan in a background goroutine and returns a channel receiving
+// its results, applying policy when the consumer of the channel is slower than
+// the rate of updates. The size argument configures the buffer of the
+// DropOldest policy, and is ignored by other policies.
+//
+// The Handler field of plan is ignored. The channel is closed when ctx is
+// canceled.
+func Chan(ctx context.Context, plan Plan, policy Backpressure, size int) (<-chan Update, error) {
+	out := make(chan Update)
+
+	switch policy {
+	case Block:
+		plan.Handler = func(index uint64, result interface{}) {
+			select {
+			case out <- Update{Index: index, Result: result}:
+			case <-ctx.Done():
+			}
+		}
+		if err := plan.Validate(); err != nil {
+			return nil, err
+		}
+		go func() {
+			defer close(out)
+			plan.Run(ctx)
+		}()
+		return out, nil
+
+	case Coalesce:
+		size = 1
+
+	case DropOldest:
+		if size < 1 {
+			size = 1
+		}
+	}
+
+	queue := &updateQueue{
+		size:   size,
+		notify: make(chan struct{}, 1),
+	}
+
+	plan.Handler = queue.push
+
+	if err := plan.Validate(); err != nil {
+		return nil, err
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		plan.Run(ctx)
+	}()
+
+	go func() {
+		defer wg.Done()
+		queue.forward(ctx, out)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out, nil
+}
+
+type updateQueue struct {
+	mutex   sync.Mutex
+	items   []Update
+	size    int
+	dropped int
+	notify  chan struct{}
+}
+
+func (q *updateQueue) push(index uint64, result interface{}) {
+	q.mutex.Lock()
+
+	if len(q.items) == q.size {
+		copy(q.items, q.items[1:])
+		q.items = q.items[:len(q.items)-1]
+		q.dropped++
+	}
+
+	q.items = append(q.items, Update{
+		Index:  index,
+		Result: result,
+	})
+
+	q.mutex.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *updateQueue) pop() (Update, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.items) == 0 {
+		return Update{}, false
+	}
+
+	u := q.items[0]
+	u.Dropped, q.dropped = q.dropped, 0
+	copy(q.items, q.items[1:])
+	q.items = q.items[:len(q.items)-1]
+	return u, true
+}
+
+func (q *updateQueue) forward(ctx context.Context, out chan<- Update) {
+	for {
+		u, ok := q.pop()
+
+		if !ok {
+			select {
+			case <-q.notify:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case out <- u:
+		case <-q.notify:
+			// A new update was pushed while waiting for the consumer, the
+			// pending update goes back to the queue where the backpressure
+			// policy applies to it.
+			q.unpop(u)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (q *updateQueue) unpop(u Update) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.dropped += u.Dropped
+	u.Dropped = 0
+
+	if len(q.items) == q.size {
+		q.dropped++
+		return
+	}
+
+	q.items = append(q.items, Update{})
+	copy(q.items[1:], q.items)
+	q.items[0] = u
+}
@@ -0,0 +1,119 @@
+package watch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestChan(t *testing.T) {
+	tests := []struct {
+		scenario string
+		policy   Backpressure
+		size     int
+		indexes  []uint64
+		dropped  int
+	}{
+		{
+			scenario: "coalescing keeps only the most recent update",
+			policy:   Coalesce,
+			indexes:  []uint64{10},
+			dropped:  9,
+		},
+		{
+			scenario: "dropping the oldest updates keeps the buffer size",
+			policy:   DropOldest,
+			size:     3,
+			indexes:  []uint64{8, 9, 10},
+			dropped:  7,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			server, client := newConstantlyChangingServer(10)
+			defer server.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ch, err := Chan(ctx, Plan{Type: Services, Client: client}, test.policy, test.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Simulate a slow consumer which only starts receiving after all
+			// the updates were produced.
+			time.Sleep(100 * time.Millisecond)
+
+			var indexes []uint64
+			var dropped int
+
+			for len(indexes) < len(test.indexes) {
+				u := <-ch
+				indexes = append(indexes, u.Index)
+				dropped += u.Dropped
+			}
+
+			if !reflect.DeepEqual(indexes, test.indexes) {
+				t.Error("bad indexes:", indexes)
+			}
+			if dropped != test.dropped {
+				t.Error("bad number of dropped updates:", dropped)
+			}
+
+			cancel()
+			for range ch {
+			}
+		})
+	}
+
+	t.Run("blocking delivers updates in order", func(t *testing.T) {
+		server, client := newConstantlyChangingServer(10)
+		defer server.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch, err := Chan(ctx, Plan{Type: Services, Client: client}, Block, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := uint64(1); i <= 10; i++ {
+			if u := <-ch; u.Index != i || u.Dropped != 0 {
+				t.Errorf("bad update: %+v", u)
+			}
+		}
+
+		cancel()
+		for range ch {
+		}
+	})
+
+	t.Run("invalid plans are rejected", func(t *testing.T) {
+		if _, err := Chan(context.Background(), Plan{Type: Key}, Coalesce, 0); err == nil {
+			t.Error("creating a channel from an invalid plan should fail")
+		}
+	})
+}
+
+// newConstantlyChangingServer creates a server simulating data which changes
+// on every query, until the index reaches max.
+func newConstantlyChangingServer(max int) (*httptest.Server, *consul.Client) {
+	return newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		index, _ := strconv.Atoi(req.URL.Query().Get("index"))
+		if index >= max {
+			<-req.Context().Done()
+			return
+		}
+		res.Header().Set("X-Consul-Index", strconv.Itoa(index+1))
+		res.Write([]byte("{}"))
+	})
+}
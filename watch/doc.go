@@ -0,0 +1,8 @@
+// Package watch provides a generic abstraction to watch for changes in consul.
+//
+// A watch is described by a Plan, which declares the type of data being
+// watched and the parameters selecting it. Running a plan repeatedly executes
+// blocking queries against the consul agent, tracking the indexes returned by
+// consul to only invoke the plan's handler when the data changed. Errors are
+// retried with an exponential backoff until the plan is stopped.
+package watch
@@ -0,0 +1,67 @@
+package watch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+// Limiter limits the rate of queries sent by plans to the consul agent.
+//
+// The limiter allows one query every Interval on average, with bursts of up to
+// Burst queries. Plans sharing a limiter wait for their turn before sending
+// queries, which protects the agent when many watches see changes at the same
+// time.
+//
+// Methods of Limiter are safe to use concurrently from multiple goroutines.
+type Limiter struct {
+	// The average interval between queries. Zero means no limit.
+	Interval time.Duration
+
+	// The maximum number of queries that may be sent at once. Defaults to 1.
+	Burst int
+
+	// The clock used to schedule queries. If nil, consul.DefaultClock is
+	// used.
+	Clock consul.Clock
+
+	mutex sync.Mutex
+	tat   time.Time // theoretical arrival time of the next query
+}
+
+// Wait blocks until a query may be sent, or ctx is canceled.
+func (l *Limiter) Wait(ctx context.Context) error {
+	clock := l.Clock
+	if clock == nil {
+		clock = consul.DefaultClock
+	}
+	if delay := l.reserve(clock.Now()); delay > 0 {
+		consul.Sleep(ctx, clock, delay)
+	}
+	return ctx.Err()
+}
+
+func (l *Limiter) reserve(now time.Time) time.Duration {
+	interval := l.Interval
+	if interval <= 0 {
+		return 0
+	}
+
+	burst := l.Burst
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.tat.Before(now) {
+		l.tat = now
+	}
+
+	delay := l.tat.Sub(now) - time.Duration(burst-1)*interval
+	l.tat = l.tat.Add(interval)
+	return delay
+}
@@ -0,0 +1,101 @@
+package watch
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLimiterReserve(t *testing.T) {
+	now := time.Now()
+	l := &Limiter{Interval: time.Second, Burst: 2}
+
+	delays := []time.Duration{
+		l.reserve(now),
+		l.reserve(now),
+		l.reserve(now),
+		l.reserve(now.Add(5 * time.Second)),
+	}
+
+	expected := []time.Duration{0, 0, time.Second, 0}
+
+	for i := range delays {
+		if (expected[i] == 0 && delays[i] > 0) || (expected[i] != 0 && delays[i] != expected[i]) {
+			t.Errorf("bad delay of reservation %d: expected %s, found %s", i, expected[i], delays[i])
+		}
+	}
+}
+
+func TestPlanMinInterval(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		// The index changes on every query, simulating data that changes
+		// faster than the watch is allowed to query.
+		index, _ := strconv.Atoi(req.URL.Query().Get("index"))
+		res.Header().Set("X-Consul-Index", strconv.Itoa(index+1))
+		res.Write([]byte("{}"))
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	start := time.Now()
+
+	plan := &Plan{
+		Type:        Services,
+		Client:      client,
+		MinInterval: 20 * time.Millisecond,
+		Handler: func(uint64, interface{}) {
+			if calls++; calls == 4 {
+				cancel()
+			}
+		},
+	}
+
+	plan.Run(ctx)
+
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Error("the plan queried the agent too often:", elapsed)
+	}
+}
+
+func TestPlanLimiter(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		index, _ := strconv.Atoi(req.URL.Query().Get("index"))
+		res.Header().Set("X-Consul-Index", strconv.Itoa(index+1))
+		res.Write([]byte("{}"))
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	limiter := &Limiter{Interval: 10 * time.Millisecond}
+	calls := make(chan struct{}, 100)
+	done := make(chan struct{})
+
+	// Two plans sharing the limiter, the total rate of queries must not
+	// exceed the limit.
+	for i := 0; i < 2; i++ {
+		plan := &Plan{
+			Type:    Services,
+			Client:  client,
+			Limiter: limiter,
+			Handler: func(uint64, interface{}) { calls <- struct{}{} },
+		}
+		go func() {
+			plan.Run(ctx)
+			done <- struct{}{}
+		}()
+	}
+
+	<-done
+	<-done
+
+	if n := len(calls); n > 12 {
+		t.Error("too many queries were sent to the agent:", n)
+	}
+}
@@ -0,0 +1,206 @@
+package watch
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+// Mux shares blocking queries between plans watching the same data, so that
+// a program where many components watch the same service or key only runs one
+// blocking query against the consul agent, and fans out its results to all
+// the plans.
+//
+// Plans are attached to a Mux by setting their Mux field. Two plans share
+// their queries if they have the same client, type, and parameters. The
+// backoff and rate limiting policies of the shared query are the ones of the
+// plan which started it, the error handlers of all the plans are called when
+// the query fails.
+//
+// Handlers of plans sharing a query receive the same result values, they must
+// therefore not modify them.
+//
+// When the handler of a plan is slower than the rate of changes, intermediate
+// results are skipped and the handler only sees the most recent result. This
+// matches the semantics of blocking queries, which may also miss intermediate
+// updates but always converge on the most recent value.
+//
+// The zero-value is a valid Mux. Methods of Mux are safe to use concurrently
+// from multiple goroutines.
+type Mux struct {
+	mutex   sync.Mutex
+	queries map[muxKey]*sharedQuery
+}
+
+type muxKey struct {
+	client      *consul.Client
+	typ         Type
+	key         string
+	prefix      string
+	service     string
+	tags        string
+	passingOnly bool
+	state       consul.HealthStatus
+	name        string
+	query       string
+	session     consul.SessionID
+	allowStale  bool
+	wait        time.Duration
+}
+
+func (p *Plan) muxKey() muxKey {
+	return muxKey{
+		client:      p.client(),
+		typ:         p.Type,
+		key:         p.Key,
+		prefix:      p.Prefix,
+		service:     p.Service,
+		tags:        strings.Join(p.Tags, "\x00"),
+		passingOnly: p.PassingOnly,
+		state:       p.state(),
+		name:        p.Name,
+		query:       p.Query,
+		session:     p.SessionID,
+		allowStale:  p.AllowStale,
+		wait:        p.Wait,
+	}
+}
+
+type sharedQuery struct {
+	cancel context.CancelFunc
+	mutex  sync.Mutex
+	index  uint64
+	result interface{}
+	subs   map[*muxSubscriber]struct{}
+}
+
+type muxSubscriber struct {
+	plan   *Plan
+	notify chan struct{}
+}
+
+// Len returns the number of blocking queries currently run by the Mux.
+func (m *Mux) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.queries)
+}
+
+func (m *Mux) run(ctx context.Context, p *Plan) error {
+	sub := &muxSubscriber{
+		plan:   p,
+		notify: make(chan struct{}, 1),
+	}
+
+	key := p.muxKey()
+	query := m.subscribe(key, sub)
+	defer m.unsubscribe(key, query, sub)
+
+	filter := p.filter()
+	last := uint64(0)
+
+	for {
+		select {
+		case <-sub.notify:
+		case <-ctx.Done():
+			return nil
+		}
+
+		index, result := query.load()
+		if index == last {
+			continue
+		}
+		last = index
+
+		if result = filter(result); result != nil {
+			p.Handler(index, result)
+		}
+	}
+}
+
+func (m *Mux) subscribe(key muxKey, sub *muxSubscriber) *sharedQuery {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	query := m.queries[key]
+
+	if query == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		query = &sharedQuery{
+			cancel: cancel,
+			subs:   make(map[*muxSubscriber]struct{}),
+		}
+
+		if m.queries == nil {
+			m.queries = make(map[muxKey]*sharedQuery)
+		}
+		m.queries[key] = query
+
+		p := sub.plan
+		go p.poll(ctx, p.fetcher(), query.store, query.fail)
+	}
+
+	query.mutex.Lock()
+	query.subs[sub] = struct{}{}
+	if query.index != 0 {
+		// The query already has a result, the new subscriber gets notified
+		// immediately instead of waiting for the next change.
+		sub.notify <- struct{}{}
+	}
+	query.mutex.Unlock()
+
+	return query
+}
+
+func (m *Mux) unsubscribe(key muxKey, query *sharedQuery, sub *muxSubscriber) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	query.mutex.Lock()
+	delete(query.subs, sub)
+	empty := len(query.subs) == 0
+	query.mutex.Unlock()
+
+	if empty {
+		query.cancel()
+		delete(m.queries, key)
+	}
+}
+
+func (q *sharedQuery) load() (uint64, interface{}) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.index, q.result
+}
+
+func (q *sharedQuery) store(index uint64, result interface{}) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.index, q.result = index, result
+
+	for sub := range q.subs {
+		select {
+		case sub.notify <- struct{}{}:
+		default: // the subscriber already has a pending notification
+		}
+	}
+}
+
+func (q *sharedQuery) fail(err error, failures int, retry time.Duration) {
+	q.mutex.Lock()
+	handlers := make([]ErrorHandlerFunc, 0, len(q.subs))
+	for sub := range q.subs {
+		if h := sub.plan.ErrorHandler; h != nil {
+			handlers = append(handlers, h)
+		}
+	}
+	q.mutex.Unlock()
+
+	for _, h := range handlers {
+		h(err, failures, retry)
+	}
+}
@@ -0,0 +1,142 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMux(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		switch req.URL.Query().Get("index") {
+		case "":
+		case "1":
+			select {
+			case <-release:
+			case <-req.Context().Done():
+				return
+			}
+		default:
+			<-req.Context().Done()
+			return
+		}
+
+		index, _ := strconv.Atoi(req.URL.Query().Get("index"))
+		index++
+		res.Header().Set("X-Consul-Index", strconv.Itoa(index))
+		json.NewEncoder(res).Encode(map[string][]string{
+			"service-" + strconv.Itoa(index): nil,
+		})
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mux := &Mux{}
+	wg := sync.WaitGroup{}
+	ready := sync.WaitGroup{}
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		ready.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			var indexes []uint64
+			plan := &Plan{
+				Type:   Services,
+				Client: client,
+				Mux:    mux,
+				Handler: func(index uint64, result interface{}) {
+					indexes = append(indexes, index)
+					if len(indexes) == 1 {
+						ready.Done()
+					}
+				},
+			}
+
+			plan.Run(ctx)
+
+			if len(indexes) != 2 || indexes[0] != 1 || indexes[1] != 2 {
+				t.Error("bad indexes:", indexes)
+			}
+		}()
+	}
+
+	ready.Wait()
+
+	if n := mux.Len(); n != 1 {
+		t.Error("bad number of shared queries:", n)
+	}
+
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	// One request for the initial value, one returning the update, and one
+	// blocking until the watch was canceled.
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Error("bad number of requests sent to the agent:", n)
+	}
+
+	if n := mux.Len(); n != 0 {
+		t.Error("shared queries were not stopped after all plans exited:", n)
+	}
+}
+
+func TestMuxDistinctPlans(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("index") != "" {
+			<-req.Context().Done()
+			return
+		}
+		res.Header().Set("X-Consul-Index", "1")
+		res.Write([]byte("[]"))
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mux := &Mux{}
+	ready := sync.WaitGroup{}
+	done := sync.WaitGroup{}
+
+	for _, service := range []string{"A", "B", "A"} {
+		ready.Add(1)
+		done.Add(1)
+		plan := &Plan{
+			Type:    Service,
+			Service: service,
+			Client:  client,
+			Mux:     mux,
+			Handler: func(uint64, interface{}) { ready.Done() },
+		}
+		go func() {
+			defer done.Done()
+			plan.Run(ctx)
+		}()
+	}
+
+	ready.Wait()
+
+	if n := mux.Len(); n != 2 {
+		t.Error("bad number of shared queries:", n)
+	}
+
+	cancel()
+	done.Wait()
+}
@@ -0,0 +1,500 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+// Type is an enumeration representing the kinds of data that plans can watch.
+type Type string
+
+const (
+	// Key watches a single key of the key/value store, the handler receives
+	// a *consul.KeyData, or nil if the key does not exist.
+	Key Type = "key"
+
+	// KeyPrefix watches all keys under a prefix of the key/value store, the
+	// handler receives a []consul.KeyData.
+	KeyPrefix Type = "keyprefix"
+
+	// Service watches the instances of a service, the handler receives a
+	// []consul.ServiceEntry.
+	Service Type = "service"
+
+	// Services watches the list of services registered in the catalog, the
+	// handler receives a map[string][]string of service names to tags.
+	Services Type = "services"
+
+	// Nodes watches the list of nodes registered in the catalog, the handler
+	// receives a []consul.Node.
+	Nodes Type = "nodes"
+
+	// Checks watches health checks, either of a service or in a given state,
+	// the handler receives a []consul.HealthCheck.
+	Checks Type = "checks"
+
+	// Event watches user events, the handler receives a []consul.Event.
+	Event Type = "event"
+
+	// PreparedQuery watches the results of executing a prepared query, the
+	// handler receives a consul.PreparedQueryResult.
+	//
+	// Prepared queries do not support blocking queries, the plan polls the
+	// agent every PollInterval instead, and calls the handler when the result
+	// changed.
+	PreparedQuery Type = "query"
+
+	// Session watches a session, the handler receives a *consul.SessionInfo,
+	// or nil once the session was invalidated (destroyed, expired, or one of
+	// its health checks failed).
+	Session Type = "session"
+)
+
+// HandlerFunc is the signature of functions called by plans when the data that
+// they watch change. The index is the consul index of the data, the type of
+// result depends on the type of plan.
+type HandlerFunc func(index uint64, result interface{})
+
+// ErrorHandlerFunc is the signature of functions called by plans when queries
+// fail. The failures argument is the number of consecutive failures, and retry
+// the amount of time that the plan waits before retrying.
+type ErrorHandlerFunc func(err error, failures int, retry time.Duration)
+
+// Plan describes a watch and the handler that it drives.
+//
+// Which of the parameter fields are used depends on the type of the plan,
+// other fields are ignored.
+type Plan struct {
+	// The type of data watched by the plan.
+	Type Type
+
+	// The key watched by plans of type Key.
+	Key string
+
+	// The prefix watched by plans of type KeyPrefix.
+	Prefix string
+
+	// The service watched by plans of type Service, or the service which
+	// checks are watched by plans of type Checks.
+	Service string
+
+	// Filters the instances watched by plans of type Service to the ones
+	// having all those tags.
+	Tags []string
+
+	// If true, plans of type Service only watch instances passing their health
+	// checks.
+	PassingOnly bool
+
+	// The state of the health checks watched by plans of type Checks, when no
+	// service is set. Defaults to "any".
+	State consul.HealthStatus
+
+	// Filters the events watched by plans of type Event to the ones with this
+	// name.
+	Name string
+
+	// The name or ID of the prepared query watched by plans of type
+	// PreparedQuery.
+	Query string
+
+	// The ID of the session watched by plans of type Session.
+	SessionID consul.SessionID
+
+	// The interval at which plans of type PreparedQuery execute the query.
+	// Defaults to 10 seconds.
+	PollInterval time.Duration
+
+	// If true, allows any consul server to answer the queries (not only the
+	// leader).
+	AllowStale bool
+
+	// The maximum amount of time that each blocking query waits for changes.
+	// Zero means to use the consul default (5 minutes).
+	Wait time.Duration
+
+	// The client used to send queries to consul. If nil, a client configured
+	// with consul.WatchTransport is used.
+	//
+	// Clients configured by the program must use an HTTP transport with a
+	// response header timeout longer than Wait, otherwise blocking queries
+	// would time out.
+	Client *consul.Client
+
+	// The function called with the results of the watch. This field is
+	// required.
+	Handler HandlerFunc
+
+	// The policy applied to retry failed queries.
+	Backoff Backoff
+
+	// If not nil, the function is called every time a query fails, before
+	// the plan waits to retry it.
+	ErrorHandler ErrorHandlerFunc
+
+	// If not nil, the plan shares its blocking queries with the other plans
+	// of the multiplexer watching the same data.
+	Mux *Mux
+
+	// The minimum amount of time between two consecutive queries of the plan.
+	// When the data changes faster (for example while health checks are
+	// flapping), the changes are coalesced and the handler only receives the
+	// most recent result.
+	MinInterval time.Duration
+
+	// If not nil, the queries of the plan are rate limited by Limiter. The
+	// same limiter may be shared by multiple plans to set a global limit on
+	// the rate of queries sent to the agent.
+	Limiter *Limiter
+
+	// The clock used to measure intervals and wait between queries. If nil,
+	// consul.DefaultClock is used.
+	Clock consul.Clock
+}
+
+// Validate checks that p has the parameters required by its type.
+func (p *Plan) Validate() error {
+	if p.Handler == nil {
+		return errors.New("watch: plan has no handler")
+	}
+	switch p.Type {
+	case Key:
+		if len(p.Key) == 0 {
+			return errors.New("watch: key plans require a key")
+		}
+	case Service:
+		if len(p.Service) == 0 {
+			return errors.New("watch: service plans require a service")
+		}
+	case PreparedQuery:
+		if len(p.Query) == 0 {
+			return errors.New("watch: prepared query plans require a query")
+		}
+	case Session:
+		if len(p.SessionID) == 0 {
+			return errors.New("watch: session plans require a session ID")
+		}
+	case KeyPrefix, Services, Nodes, Checks, Event:
+	default:
+		return fmt.Errorf("watch: unsupported plan type %q", p.Type)
+	}
+	return nil
+}
+
+// Run executes the plan until ctx is canceled, invoking the handler with the
+// initial result of the watch, then every time the result changes.
+//
+// The method returns nil when ctx is canceled, or an error if the plan is
+// invalid.
+func (p *Plan) Run(ctx context.Context) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	if p.Mux != nil {
+		return p.Mux.run(ctx, p)
+	}
+
+	filter := p.filter()
+
+	p.poll(ctx, p.fetcher(), func(index uint64, result interface{}) {
+		if result = filter(result); result != nil {
+			p.Handler(index, result)
+		}
+	}, p.ErrorHandler)
+
+	return nil
+}
+
+// poll implements the blocking query loop of plans, calling emit every time
+// the index of the data changes, and fail when queries fail.
+func (p *Plan) poll(ctx context.Context, fetch fetchFunc, emit func(uint64, interface{}), fail ErrorHandlerFunc) {
+	index := uint64(0)
+	first := true
+	failures := 0
+	recovery := time.Time{}
+	lastQuery := time.Time{}
+	clock := p.clock()
+
+	for ctx.Err() == nil {
+		if !lastQuery.IsZero() && p.MinInterval > 0 {
+			consul.Sleep(ctx, clock, p.MinInterval-clock.Now().Sub(lastQuery))
+		}
+
+		if p.Limiter != nil {
+			p.Limiter.Wait(ctx)
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		lastQuery = clock.Now()
+		newIndex, result, err := fetch(ctx, index)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			failures++
+			recovery = time.Time{}
+			retry := p.Backoff.delay(failures)
+			if fail != nil {
+				fail(err, failures, retry)
+			}
+			consul.Sleep(ctx, clock, retry)
+			continue
+		}
+
+		if failures != 0 {
+			now := clock.Now()
+			if recovery.IsZero() {
+				recovery = now
+			}
+			if now.Sub(recovery) >= p.Backoff.ResetAfter {
+				failures, recovery = 0, time.Time{}
+			}
+		}
+
+		// Consul may return a zero index in some edge cases, which would make
+		// the next query return immediately, turning the watch into a tight
+		// loop.
+		if newIndex == 0 {
+			newIndex = 1
+		}
+
+		// The index may also go backwards (after a snapshot restore for
+		// example), in which case it is used as is for the next query since
+		// consul only compares the query index to the current one.
+		if !first && newIndex == index {
+			continue
+		}
+
+		index, first = newIndex, false
+		emit(index, result)
+	}
+}
+
+type fetchFunc func(ctx context.Context, index uint64) (uint64, interface{}, error)
+
+func (p *Plan) fetcher() fetchFunc {
+	switch p.Type {
+	case Key:
+		return func(ctx context.Context, index uint64) (uint64, interface{}, error) {
+			var data []consul.KeyData
+			i, err := p.get(ctx, "/v1/kv/"+p.Key, nil, index, &data)
+			if err != nil || len(data) == 0 {
+				return i, (*consul.KeyData)(nil), err
+			}
+			return i, &data[0], nil
+		}
+
+	case KeyPrefix:
+		return func(ctx context.Context, index uint64) (uint64, interface{}, error) {
+			var data []consul.KeyData
+			i, err := p.get(ctx, "/v1/kv/"+p.Prefix, consul.Query{{Name: "recurse"}}, index, &data)
+			return i, data, err
+		}
+
+	case Service:
+		return func(ctx context.Context, index uint64) (uint64, interface{}, error) {
+			var query consul.Query
+			for _, tag := range p.Tags {
+				query = append(query, consul.Param{Name: "tag", Value: tag})
+			}
+			if p.PassingOnly {
+				query = append(query, consul.Param{Name: "passing", Value: "true"})
+			}
+			var entries []consul.ServiceEntry
+			i, err := p.get(ctx, "/v1/health/service/"+p.Service, query, index, &entries)
+			return i, entries, err
+		}
+
+	case Services:
+		return func(ctx context.Context, index uint64) (uint64, interface{}, error) {
+			var services map[string][]string
+			i, err := p.get(ctx, "/v1/catalog/services", nil, index, &services)
+			return i, services, err
+		}
+
+	case Nodes:
+		return func(ctx context.Context, index uint64) (uint64, interface{}, error) {
+			var nodes []consul.Node
+			i, err := p.get(ctx, "/v1/catalog/nodes", nil, index, &nodes)
+			return i, nodes, err
+		}
+
+	case Checks:
+		path := "/v1/health/state/" + string(p.state())
+		if len(p.Service) != 0 {
+			path = "/v1/health/checks/" + p.Service
+		}
+		return func(ctx context.Context, index uint64) (uint64, interface{}, error) {
+			var checks []consul.HealthCheck
+			i, err := p.get(ctx, path, nil, index, &checks)
+			return i, checks, err
+		}
+
+	case Session:
+		return func(ctx context.Context, index uint64) (uint64, interface{}, error) {
+			var sessions []consul.SessionInfo
+			i, err := p.get(ctx, "/v1/session/info/"+string(p.SessionID), nil, index, &sessions)
+			if err != nil || len(sessions) == 0 {
+				return i, (*consul.SessionInfo)(nil), err
+			}
+			return i, &sessions[0], nil
+		}
+
+	case PreparedQuery:
+		// The index is synthesized since prepared queries don't have one,
+		// it is incremented every time the result changes.
+		var last consul.PreparedQueryResult
+		var lastIndex uint64
+		return func(ctx context.Context, index uint64) (uint64, interface{}, error) {
+			if index != 0 {
+				consul.Sleep(ctx, p.clock(), p.pollInterval())
+			}
+			var res consul.PreparedQueryResult
+			if _, err := p.client().GetWithMeta(ctx, "/v1/query/"+p.Query+"/execute", nil, &res); err != nil {
+				return index, nil, err
+			}
+			if lastIndex == 0 || !reflect.DeepEqual(res, last) {
+				last, lastIndex = res, lastIndex+1
+			}
+			return lastIndex, last, nil
+		}
+
+	default: // Event
+		return func(ctx context.Context, index uint64) (uint64, interface{}, error) {
+			var query consul.Query
+			if len(p.Name) != 0 {
+				query = append(query, consul.Param{Name: "name", Value: p.Name})
+			}
+			var events []consul.Event
+			i, err := p.get(ctx, "/v1/event/list", query, index, &events)
+			return i, events, err
+		}
+	}
+}
+
+// filter returns a function transforming the results of queries into the
+// values passed to the plan's handler, or nil if the handler must not be
+// called.
+func (p *Plan) filter() func(interface{}) interface{} {
+	if p.Type != Event {
+		return func(result interface{}) interface{} { return result }
+	}
+
+	// The agent only retains a bounded list of the most recent events,
+	// remembering the IDs of the previous response is enough to detect which
+	// ones are new.
+	var seen map[string]bool
+	return func(result interface{}) interface{} {
+		events := result.([]consul.Event)
+		fresh := []consul.Event(nil)
+		ids := make(map[string]bool, len(events))
+		for _, event := range events {
+			if !seen[event.ID] {
+				fresh = append(fresh, event)
+			}
+			ids[event.ID] = true
+		}
+		if seen != nil && len(fresh) == 0 {
+			// Only the first call reports an empty list of events.
+			seen = ids
+			return nil
+		}
+		seen = ids
+		return fresh
+	}
+}
+
+func (p *Plan) get(ctx context.Context, path string, query consul.Query, index uint64, recv interface{}) (uint64, error) {
+	if index != 0 {
+		query = append(query, consul.Param{Name: "index", Value: strconv.FormatUint(index, 10)})
+	}
+	if p.Wait != 0 {
+		query = append(query, consul.Param{Name: "wait", Value: fmt.Sprintf("%dms", p.Wait/time.Millisecond)})
+	}
+	if p.AllowStale {
+		query = append(query, consul.Param{Name: "stale"})
+	}
+
+	meta, err := p.client().GetWithMeta(ctx, path, query, recv)
+
+	// Not found errors are fine in this context, they communicate the
+	// absence of data to the handler.
+	if errors.Is(err, consul.ErrNotFound) {
+		err = nil
+	}
+
+	return meta.LastIndex, err
+}
+
+func (p *Plan) client() *consul.Client {
+	if client := p.Client; client != nil {
+		return client
+	}
+	return defaultClient
+}
+
+func (p *Plan) pollInterval() time.Duration {
+	if interval := p.PollInterval; interval > 0 {
+		return interval
+	}
+	return 10 * time.Second
+}
+
+func (p *Plan) state() consul.HealthStatus {
+	if state := p.State; len(state) != 0 {
+		return state
+	}
+	return "any"
+}
+
+var defaultClient = &consul.Client{
+	Address:   consul.DefaultClient.Address,
+	Transport: consul.WatchTransport,
+}
+
+func (p *Plan) clock() consul.Clock {
+	if clock := p.Clock; clock != nil {
+		return clock
+	}
+	return consul.DefaultClock
+}
+
+// String returns a human-readable representation of p.
+func (p *Plan) String() string {
+	params := []string{"type=" + string(p.Type)}
+	switch p.Type {
+	case Key:
+		params = append(params, "key="+p.Key)
+	case KeyPrefix:
+		params = append(params, "prefix="+p.Prefix)
+	case Service:
+		params = append(params, "service="+p.Service)
+	case Checks:
+		if len(p.Service) != 0 {
+			params = append(params, "service="+p.Service)
+		} else {
+			params = append(params, "state="+string(p.state()))
+		}
+	case Event:
+		if len(p.Name) != 0 {
+			params = append(params, "name="+p.Name)
+		}
+	case PreparedQuery:
+		params = append(params, "query="+p.Query)
+	case Session:
+		params = append(params, "session="+string(p.SessionID))
+	}
+	return "watch(" + strings.Join(params, ", ") + ")"
+}
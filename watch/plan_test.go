@@ -0,0 +1,265 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestPlanValidate(t *testing.T) {
+	handler := func(uint64, interface{}) {}
+
+	tests := []struct {
+		scenario string
+		plan     Plan
+		valid    bool
+	}{
+		{
+			scenario: "a plan without a handler is invalid",
+			plan:     Plan{Type: Services},
+		},
+		{
+			scenario: "a plan with an unknown type is invalid",
+			plan:     Plan{Type: "whatever", Handler: handler},
+		},
+		{
+			scenario: "a key plan without a key is invalid",
+			plan:     Plan{Type: Key, Handler: handler},
+		},
+		{
+			scenario: "a service plan without a service is invalid",
+			plan:     Plan{Type: Service, Handler: handler},
+		},
+		{
+			scenario: "a services plan is valid",
+			plan:     Plan{Type: Services, Handler: handler},
+			valid:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			if err := test.plan.Validate(); (err == nil) != test.valid {
+				t.Error("bad validation result:", err)
+			}
+		})
+	}
+}
+
+func TestPlanRun(t *testing.T) {
+	tests := []struct {
+		plan    Plan
+		path    string
+		reply   func(index int) interface{}
+		results []interface{}
+	}{
+		{
+			plan: Plan{Type: Key, Key: "A"},
+			path: "/v1/kv/A",
+			reply: func(index int) interface{} {
+				return []consul.KeyData{{Key: "A", Value: []byte(strconv.Itoa(index))}}
+			},
+			results: []interface{}{
+				&consul.KeyData{Key: "A", Value: []byte("1")},
+				&consul.KeyData{Key: "A", Value: []byte("2")},
+			},
+		},
+		{
+			plan: Plan{Type: KeyPrefix, Prefix: "A/"},
+			path: "/v1/kv/A/",
+			reply: func(index int) interface{} {
+				return []consul.KeyData{{Key: "A/" + strconv.Itoa(index)}}
+			},
+			results: []interface{}{
+				[]consul.KeyData{{Key: "A/1"}},
+				[]consul.KeyData{{Key: "A/2"}},
+			},
+		},
+		{
+			plan: Plan{Type: Service, Service: "web", PassingOnly: true},
+			path: "/v1/health/service/web",
+			reply: func(index int) interface{} {
+				return []consul.ServiceEntry{{Service: consul.ServiceInstance{ID: strconv.Itoa(index)}}}
+			},
+			results: []interface{}{
+				[]consul.ServiceEntry{{Service: consul.ServiceInstance{ID: "1"}}},
+				[]consul.ServiceEntry{{Service: consul.ServiceInstance{ID: "2"}}},
+			},
+		},
+		{
+			plan: Plan{Type: Services},
+			path: "/v1/catalog/services",
+			reply: func(index int) interface{} {
+				return map[string][]string{strconv.Itoa(index): nil}
+			},
+			results: []interface{}{
+				map[string][]string{"1": nil},
+				map[string][]string{"2": nil},
+			},
+		},
+		{
+			plan: Plan{Type: Nodes},
+			path: "/v1/catalog/nodes",
+			reply: func(index int) interface{} {
+				return []consul.Node{{Node: strconv.Itoa(index)}}
+			},
+			results: []interface{}{
+				[]consul.Node{{Node: "1"}},
+				[]consul.Node{{Node: "2"}},
+			},
+		},
+		{
+			plan: Plan{Type: Checks, State: consul.Critical},
+			path: "/v1/health/state/critical",
+			reply: func(index int) interface{} {
+				return []consul.HealthCheck{{CheckID: strconv.Itoa(index)}}
+			},
+			results: []interface{}{
+				[]consul.HealthCheck{{CheckID: "1"}},
+				[]consul.HealthCheck{{CheckID: "2"}},
+			},
+		},
+		{
+			plan: Plan{Type: Event, Name: "deploy"},
+			path: "/v1/event/list",
+			reply: func(index int) interface{} {
+				// The agent returns all the events it knows about, only the
+				// new ones must be passed to the handler.
+				events := []consul.Event{}
+				for i := 1; i <= index; i++ {
+					events = append(events, consul.Event{ID: strconv.Itoa(i), Name: "deploy"})
+				}
+				return events
+			},
+			results: []interface{}{
+				[]consul.Event{{ID: "1", Name: "deploy"}},
+				[]consul.Event{{ID: "2", Name: "deploy"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.plan.Type), func(t *testing.T) {
+			server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+				if req.URL.Path != test.path {
+					t.Error("bad URL path:", req.URL.Path)
+				}
+				index, _ := strconv.Atoi(req.URL.Query().Get("index"))
+				index++
+				res.Header().Set("X-Consul-Index", strconv.Itoa(index))
+				json.NewEncoder(res).Encode(test.reply(index))
+			})
+			defer server.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var results []interface{}
+			var indexes []uint64
+
+			plan := test.plan
+			plan.Client = client
+			plan.Handler = func(index uint64, result interface{}) {
+				indexes = append(indexes, index)
+				results = append(results, result)
+				if len(results) == len(test.results) {
+					cancel()
+				}
+			}
+
+			if err := plan.Run(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(results, test.results) {
+				t.Errorf("bad results:\n%#v\n%#v", results, test.results)
+			}
+			if !reflect.DeepEqual(indexes, []uint64{1, 2}) {
+				t.Error("bad indexes:", indexes)
+			}
+		})
+	}
+}
+
+func TestPlanRunUnchangedIndex(t *testing.T) {
+	calls := 0
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+		// Simulate blocking queries timing out without changes, except for
+		// the fourth one.
+		index := 42
+		if calls >= 4 {
+			index = 43
+		}
+		res.Header().Set("X-Consul-Index", strconv.Itoa(index))
+		json.NewEncoder(res).Encode(map[string][]string{})
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var indexes []uint64
+
+	plan := &Plan{
+		Type:   Services,
+		Client: client,
+		Handler: func(index uint64, result interface{}) {
+			indexes = append(indexes, index)
+			if len(indexes) == 2 {
+				cancel()
+			}
+		},
+	}
+
+	plan.Run(ctx)
+
+	if !reflect.DeepEqual(indexes, []uint64{42, 43}) {
+		t.Error("bad indexes:", indexes)
+	}
+}
+
+func TestPlanRunKeyNotFound(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("X-Consul-Index", "1")
+		res.WriteHeader(http.StatusNotFound)
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var result interface{}
+
+	plan := &Plan{
+		Type:   Key,
+		Key:    "A",
+		Client: client,
+		Handler: func(index uint64, r interface{}) {
+			result = r
+			cancel()
+		},
+	}
+
+	plan.Run(ctx)
+
+	if data, ok := result.(*consul.KeyData); !ok || data != nil {
+		t.Errorf("bad result: %#v", result)
+	}
+}
+
+func newServerClient(handler func(http.ResponseWriter, *http.Request)) (server *httptest.Server, client *consul.Client) {
+	server = httptest.NewServer(http.HandlerFunc(handler))
+	client = &consul.Client{
+		Address:   server.URL,
+		UserAgent: "test",
+	}
+	return
+}
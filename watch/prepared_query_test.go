@@ -0,0 +1,67 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestPlanPreparedQuery(t *testing.T) {
+	calls := 0
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/query/db-failover/execute" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		// The query fails over to a remote datacenter after a few calls.
+		calls++
+		dc := "dc1"
+		if calls >= 3 {
+			dc = "dc2"
+		}
+		json.NewEncoder(res).Encode(consul.PreparedQueryResult{
+			Service:    "db",
+			Datacenter: dc,
+		})
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var indexes []uint64
+	var datacenters []string
+
+	plan := &Plan{
+		Type:         PreparedQuery,
+		Query:        "db-failover",
+		PollInterval: time.Millisecond,
+		Client:       client,
+		Handler: func(index uint64, result interface{}) {
+			indexes = append(indexes, index)
+			datacenters = append(datacenters, result.(consul.PreparedQueryResult).Datacenter)
+			if len(indexes) == 2 {
+				cancel()
+			}
+		},
+	}
+
+	if err := plan.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(indexes, []uint64{1, 2}) {
+		t.Error("bad indexes:", indexes)
+	}
+	if !reflect.DeepEqual(datacenters, []string{"dc1", "dc2"}) {
+		t.Error("bad datacenters:", datacenters)
+	}
+	if calls < 3 {
+		t.Error("the prepared query was not polled:", calls)
+	}
+}
@@ -0,0 +1,64 @@
+package watch
+
+import "sort"
+
+// ServiceListChange describes the services that appeared or disappeared from
+// the consul catalog.
+type ServiceListChange struct {
+	// The names of the services that were registered, sorted.
+	Added []string
+
+	// The names of the services that were deregistered, sorted.
+	Removed []string
+
+	// The current list of services in the catalog, mapping service names to
+	// their tags.
+	Services map[string][]string
+}
+
+// ServiceListHandlerFunc is the signature of functions receiving the changes
+// of the list of services in the consul catalog.
+type ServiceListHandlerFunc func(index uint64, change ServiceListChange)
+
+// ServiceListChanges returns a handler for plans of type Services which calls
+// handler when services appear or disappear from the catalog.
+//
+// The first call to handler reports all the services of the catalog as added.
+// Results which do not change the list of service names (for example a change
+// in the tags of a service) are not reported.
+//
+// The returned handler must be used by a single plan.
+func ServiceListChanges(handler ServiceListHandlerFunc) HandlerFunc {
+	var known map[string]bool
+
+	return func(index uint64, result interface{}) {
+		services, _ := result.(map[string][]string)
+		change := ServiceListChange{Services: services}
+
+		for name := range services {
+			if !known[name] {
+				change.Added = append(change.Added, name)
+			}
+		}
+
+		for name := range known {
+			if _, ok := services[name]; !ok {
+				change.Removed = append(change.Removed, name)
+			}
+		}
+
+		first := known == nil
+		known = make(map[string]bool, len(services))
+		for name := range services {
+			known[name] = true
+		}
+
+		if !first && len(change.Added) == 0 && len(change.Removed) == 0 {
+			return
+		}
+
+		sort.Strings(change.Added)
+		sort.Strings(change.Removed)
+		handler(index, change)
+	}
+}
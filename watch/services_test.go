@@ -0,0 +1,68 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestServiceListChanges(t *testing.T) {
+	snapshots := []map[string][]string{
+		{"consul": nil, "web": {"v1"}},
+		{"consul": nil, "web": {"v2"}},
+		{"consul": nil, "web": {"v2"}, "db": nil},
+		{"consul": nil, "db": nil},
+	}
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/catalog/services" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		index, _ := strconv.Atoi(req.URL.Query().Get("index"))
+		if index >= len(snapshots) {
+			<-req.Context().Done()
+			return
+		}
+		res.Header().Set("X-Consul-Index", strconv.Itoa(index+1))
+		json.NewEncoder(res).Encode(snapshots[index])
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type change struct {
+		index          uint64
+		added, removed []string
+	}
+
+	var changes []change
+
+	plan := &Plan{
+		Type:   Services,
+		Client: client,
+		Handler: ServiceListChanges(func(index uint64, c ServiceListChange) {
+			changes = append(changes, change{index, c.Added, c.Removed})
+			if index == 4 {
+				cancel()
+			}
+		}),
+	}
+
+	if err := plan.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []change{
+		{1, []string{"consul", "web"}, nil},
+		{3, []string{"db"}, nil},
+		{4, nil, []string{"web"}},
+	}
+
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("bad changes:\n%v\n%v", changes, expected)
+	}
+}
@@ -0,0 +1,23 @@
+package watch
+
+import consul "github.com/segmentio/consul-go"
+
+// SessionInvalidated returns a handler for plans of type Session which calls
+// handler once, when the session is invalidated. Sessions can be invalidated
+// because they were destroyed, their TTL expired, or one of their health
+// checks failed, consul does not report which of these happened.
+//
+// Sessions cannot be revived once invalidated, programs should stop the plan
+// after handler was called.
+//
+// The returned handler must be used by a single plan.
+func SessionInvalidated(handler func(index uint64)) HandlerFunc {
+	fired := false
+	return func(index uint64, result interface{}) {
+		if info, _ := result.(*consul.SessionInfo); info != nil || fired {
+			return
+		}
+		fired = true
+		handler(index)
+	}
+}
@@ -0,0 +1,53 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestSessionInvalidated(t *testing.T) {
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/session/info/1234" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		index, _ := strconv.Atoi(req.URL.Query().Get("index"))
+		index++
+		res.Header().Set("X-Consul-Index", strconv.Itoa(index))
+
+		// The session is renewed a couple of times, then expires.
+		sessions := []consul.SessionInfo{}
+		if index < 3 {
+			sessions = append(sessions, consul.SessionInfo{ID: "1234", TTL: "10s"})
+		}
+		json.NewEncoder(res).Encode(sessions)
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	invalidated := uint64(0)
+
+	plan := &Plan{
+		Type:      Session,
+		SessionID: "1234",
+		Client:    client,
+		Handler: SessionInvalidated(func(index uint64) {
+			invalidated = index
+			cancel()
+		}),
+	}
+
+	if err := plan.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if invalidated != 3 {
+		t.Error("bad index of the session invalidation:", invalidated)
+	}
+}
@@ -0,0 +1,97 @@
+package watch
+
+import (
+	"sort"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+// Transition is a change of the health status of a service instance.
+type Transition struct {
+	// The service instance which changed state.
+	Endpoint consul.Endpoint
+
+	// The status of the instance before the transition, which is empty if the
+	// instance was just registered.
+	OldStatus consul.HealthStatus
+
+	// The status of the instance after the transition, which is empty if the
+	// instance was deregistered.
+	NewStatus consul.HealthStatus
+}
+
+// TransitionHandlerFunc is the signature of functions receiving the health
+// transitions of service instances.
+type TransitionHandlerFunc func(index uint64, transitions []Transition)
+
+// HealthTransitions returns a handler for plans of type Service which calls
+// handler with the instances that changed state since the previous result of
+// the plan, instead of full snapshots of the service instances.
+//
+// The first call to handler reports all the instances known to consul, as
+// transitions from an empty status. Results which do not change the status of
+// any instance (for example a change in the output of a health check) are not
+// reported.
+//
+// The returned handler must be used by a single plan.
+func HealthTransitions(handler TransitionHandlerFunc) HandlerFunc {
+	var states map[instanceKey]instanceState
+	first := true
+
+	return func(index uint64, result interface{}) {
+		entries, _ := result.([]consul.ServiceEntry)
+		next := make(map[instanceKey]instanceState, len(entries))
+		transitions := []Transition{}
+
+		for _, entry := range entries {
+			key := instanceKey{node: entry.Node.Node, id: entry.Service.ID}
+			state := instanceState{
+				endpoint: entry.Endpoint(),
+				status:   consul.AggregateHealth(entry.Checks),
+			}
+			state.endpoint.Health = state.status
+			next[key] = state
+
+			if old := states[key]; old.status != state.status {
+				transitions = append(transitions, Transition{
+					Endpoint:  state.endpoint,
+					OldStatus: old.status,
+					NewStatus: state.status,
+				})
+			}
+		}
+
+		for key, old := range states {
+			if _, ok := next[key]; !ok {
+				transitions = append(transitions, Transition{
+					Endpoint:  old.endpoint,
+					OldStatus: old.status,
+				})
+			}
+		}
+
+		states = next
+
+		if len(transitions) == 0 && !first {
+			return
+		}
+		first = false
+
+		sort.Slice(transitions, func(i, j int) bool {
+			e1, e2 := transitions[i].Endpoint, transitions[j].Endpoint
+			return e1.Node < e2.Node || (e1.Node == e2.Node && e1.ID < e2.ID)
+		})
+
+		handler(index, transitions)
+	}
+}
+
+type instanceKey struct {
+	node string
+	id   string
+}
+
+type instanceState struct {
+	endpoint consul.Endpoint
+	status   consul.HealthStatus
+}
@@ -0,0 +1,81 @@
+package watch
+
+import (
+	"reflect"
+	"testing"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestHealthTransitions(t *testing.T) {
+	instance := func(id string, status consul.HealthStatus) consul.ServiceEntry {
+		return consul.ServiceEntry{
+			Node:    consul.Node{Node: "node-" + id},
+			Service: consul.ServiceInstance{ID: id, Address: "127.0.0.1", Port: 4242},
+			Checks:  []consul.HealthCheck{{CheckID: "service:" + id, Status: status}},
+		}
+	}
+
+	type transition struct {
+		id       string
+		old, new consul.HealthStatus
+	}
+
+	var got [][]transition
+
+	handler := HealthTransitions(func(index uint64, transitions []Transition) {
+		list := make([]transition, len(transitions))
+		for i, t := range transitions {
+			list[i] = transition{t.Endpoint.ID, t.OldStatus, t.NewStatus}
+		}
+		got = append(got, list)
+	})
+
+	handler(1, []consul.ServiceEntry{
+		instance("A", consul.Passing),
+		instance("B", consul.Passing),
+	})
+	handler(2, []consul.ServiceEntry{
+		instance("A", consul.Passing),
+		instance("B", consul.Critical),
+	})
+	// No status changes, the handler must not be called.
+	handler(3, []consul.ServiceEntry{
+		instance("A", consul.Passing),
+		instance("B", consul.Critical),
+	})
+	handler(4, []consul.ServiceEntry{
+		instance("B", consul.Passing),
+		instance("C", consul.Warning),
+	})
+
+	expected := [][]transition{
+		{{"A", "", consul.Passing}, {"B", "", consul.Passing}},
+		{{"B", consul.Passing, consul.Critical}},
+		{{"A", consul.Passing, ""}, {"B", consul.Critical, consul.Passing}, {"C", "", consul.Warning}},
+	}
+
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("bad transitions:\n%v\n%v", got, expected)
+	}
+}
+
+func TestHealthTransitionsEmptyService(t *testing.T) {
+	calls := 0
+
+	handler := HealthTransitions(func(index uint64, transitions []Transition) {
+		calls++
+		if len(transitions) != 0 {
+			t.Error("unexpected transitions:", transitions)
+		}
+	})
+
+	handler(1, []consul.ServiceEntry{})
+	handler(2, []consul.ServiceEntry{})
+
+	// The first result is always reported so the program knows that the
+	// watch is established.
+	if calls != 1 {
+		t.Error("bad number of calls:", calls)
+	}
+}
@@ -2,6 +2,8 @@ package consul
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"strconv"
@@ -39,6 +41,9 @@ type Watcher struct {
 	// MaxBackoff limits the maximum time to wait when doing exponential backoff
 	// after encountering errors. Defaults to 30s.
 	MaxBackoff time.Duration
+
+	// The clock used to wait between attempts. If nil, DefaultClock is used.
+	Clock Clock
 }
 
 var (
@@ -89,6 +94,24 @@ func WatchPrefix(ctx context.Context, prefix string, handler WatcherFunc) {
 	DefaultWatcher.WatchPrefix(ctx, prefix, handler)
 }
 
+// WatchServices is the package-level WatchServices definition which is called
+// on DefaultWatcher.
+func WatchServices(ctx context.Context) <-chan ServicesUpdate {
+	return DefaultWatcher.WatchServices(ctx)
+}
+
+// WatchNodes is the package-level WatchNodes definition which is called on
+// DefaultWatcher.
+func WatchNodes(ctx context.Context) <-chan NodesUpdate {
+	return DefaultWatcher.WatchNodes(ctx)
+}
+
+// WatchChecks is the package-level WatchChecks definition which is called on
+// DefaultWatcher.
+func WatchChecks(ctx context.Context, state HealthStatus) <-chan ChecksUpdate {
+	return DefaultWatcher.WatchChecks(ctx, state)
+}
+
 // Watch executes a long poll for changes to the given key.  handler will be
 // called immediately upon registration to initialize the watch and returns
 // the initial value (as a list, this is what Consul API returns).  In cases
@@ -113,12 +136,130 @@ func (w *Watcher) WatchPrefix(ctx context.Context, prefix string, handler Watche
 	w.watching(ctx, prefix, handler, q)
 }
 
+// ServicesUpdate carries the result of a blocking query on the list of services
+// registered in the consul catalog.
+type ServicesUpdate struct {
+	Services map[string][]string
+	Err      error
+}
+
+// NodesUpdate carries the result of a blocking query on the list of nodes
+// registered in the consul catalog.
+type NodesUpdate struct {
+	Nodes []Node
+	Err   error
+}
+
+// ChecksUpdate carries the result of a blocking query on the list of health
+// checks in a given state.
+type ChecksUpdate struct {
+	Checks []HealthCheck
+	Err    error
+}
+
+// WatchServices executes a long poll for changes to the list of services
+// registered in the consul catalog. The returned channel receives the initial
+// list of services, then an update every time it changes. Errors are reported
+// following the same rules than Watch.
+//
+// The channel is closed when ctx is canceled.
+func (w *Watcher) WatchServices(ctx context.Context) <-chan ServicesUpdate {
+	ch := make(chan ServicesUpdate)
+	go func() {
+		defer close(ch)
+		w.watchQuery(ctx, "/v1/catalog/services", nil,
+			func() interface{} { return &map[string][]string{} },
+			func(value interface{}, err error) {
+				u := ServicesUpdate{Err: err}
+				if err == nil {
+					u.Services = *value.(*map[string][]string)
+				}
+				select {
+				case ch <- u:
+				case <-ctx.Done():
+				}
+			},
+		)
+	}()
+	return ch
+}
+
+// WatchNodes executes a long poll for changes to the list of nodes registered
+// in the consul catalog. The returned channel receives the initial list of
+// nodes, then an update every time it changes. Errors are reported following
+// the same rules than Watch.
+//
+// The channel is closed when ctx is canceled.
+func (w *Watcher) WatchNodes(ctx context.Context) <-chan NodesUpdate {
+	ch := make(chan NodesUpdate)
+	go func() {
+		defer close(ch)
+		w.watchQuery(ctx, "/v1/catalog/nodes", nil,
+			func() interface{} { return &[]Node{} },
+			func(value interface{}, err error) {
+				u := NodesUpdate{Err: err}
+				if err == nil {
+					u.Nodes = *value.(*[]Node)
+				}
+				select {
+				case ch <- u:
+				case <-ctx.Done():
+				}
+			},
+		)
+	}()
+	return ch
+}
+
+// WatchChecks executes a long poll for changes to the list of health checks in
+// the given state (which may be "any" to watch all checks). The returned
+// channel receives the initial list of checks, then an update every time it
+// changes. Errors are reported following the same rules than Watch.
+//
+// The channel is closed when ctx is canceled.
+func (w *Watcher) WatchChecks(ctx context.Context, state HealthStatus) <-chan ChecksUpdate {
+	ch := make(chan ChecksUpdate)
+	go func() {
+		defer close(ch)
+		w.watchQuery(ctx, "/v1/health/state/"+string(state), nil,
+			func() interface{} { return &[]HealthCheck{} },
+			func(value interface{}, err error) {
+				u := ChecksUpdate{Err: err}
+				if err == nil {
+					u.Checks = *value.(*[]HealthCheck)
+				}
+				select {
+				case ch <- u:
+				case <-ctx.Done():
+				}
+			},
+		)
+	}()
+	return ch
+}
+
 func (w *Watcher) watching(ctx context.Context, key string, handler WatcherFunc, q Query) {
+	w.watchQuery(ctx, "/v1/kv/"+key, q,
+		func() interface{} { return &[]KeyData{} },
+		func(value interface{}, err error) {
+			if err != nil {
+				handler(nil, err)
+			} else {
+				handler(*value.(*[]KeyData), nil)
+			}
+		},
+	)
+}
+
+// watchQuery implements the blocking query loop shared by all watch types. It
+// repeatedly sends GET requests to path, tracking the index returned by consul
+// to only get responses when the data changed. Each response is decoded into a
+// value allocated by newValue and passed to handler.
+func (w *Watcher) watchQuery(ctx context.Context, path string, q Query, newValue func() interface{}, handler func(interface{}, error)) {
 	if w.MaxAttempts <= 0 {
 		w.MaxAttempts = defMaxAttempts
 	}
 
-	path := "/v1/kv/" + key
 	value := "0"
 
 	attempt := 0
@@ -128,8 +269,8 @@ func (w *Watcher) watching(ctx context.Context, key string, handler WatcherFunc,
 			return
 		}
 		q.Add(Param{Name: "index", Value: value})
-		resp := []KeyData{}
-		hdr, err := w.client().do(ctx, "GET", path, q, nil, &resp)
+		resp := newValue()
+		hdr, err := w.client().do(ctx, "GET", path, q, nil, resp)
 		if hdr.index > 0 {
 			value = strconv.FormatUint(hdr.index, 10)
 		}
@@ -143,7 +284,7 @@ func (w *Watcher) watching(ctx context.Context, key string, handler WatcherFunc,
 			// Not found errors are fine in this context, we have to treat
 			// them as non-errors in order to communicate the absence of data
 			// to the handler.
-			if nfe, ok := err.(*httpError); ok && nfe.NotFound() {
+			if errors.Is(err, ErrNotFound) {
 				attempt = 0
 				handler(resp, nil)
 				continue
@@ -151,6 +292,9 @@ func (w *Watcher) watching(ctx context.Context, key string, handler WatcherFunc,
 
 			attempt++
 			if attempt <= w.MaxAttempts {
+				if ctx.Err() == nil {
+					w.client().handleError(fmt.Errorf("consul: watching %s (attempt %d/%d): %w", path, attempt, w.MaxAttempts, err))
+				}
 				continue
 			}
 
@@ -182,12 +326,6 @@ func (w *Watcher) backoff(ctx context.Context, n int) {
 		backoff = w.MaxBackoff
 	}
 
-	timer := time.NewTimer(backoff)
-
 	// wait for either the context to cancel or timer to expire
-	select {
-	case <-timer.C:
-	case <-ctx.Done():
-	}
-	timer.Stop()
+	Sleep(ctx, w.Clock, backoff)
 }
@@ -3,6 +3,7 @@ package consul
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"strconv"
@@ -172,6 +173,41 @@ func TestWatchErrorMaxAttempts(t *testing.T) {
 	<-ch
 }
 
+func TestWatchServices(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server, client := newServerClient(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/catalog/services" {
+			t.Error("bad URL path:", req.URL.Path)
+		}
+		index, _ := strconv.Atoi(req.URL.Query().Get("index"))
+		index++
+		res.Header().Set("X-Consul-Index", strconv.Itoa(index))
+		json.NewEncoder(res).Encode(map[string][]string{
+			"service-" + strconv.Itoa(index): {"A"},
+		})
+	})
+	defer server.Close()
+
+	w := &Watcher{Client: client, MaxAttempts: 1, MaxBackoff: 10 * time.Millisecond}
+	ch := w.WatchServices(ctx)
+
+	for i := 1; i <= 3; i++ {
+		u := <-ch
+		if u.Err != nil {
+			t.Fatal(u.Err)
+		}
+		if _, ok := u.Services["service-"+strconv.Itoa(i)]; !ok {
+			t.Errorf("bad services at update %d: %v", i, u.Services)
+		}
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
 type mockTransport struct {
 	StatusCode int
 	Headers    map[string]string
@@ -0,0 +1,230 @@
+package consul
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A WorkQueue is a queue of tasks shared by producers and workers of a cluster,
+// stored under a prefix of the consul key/value store.
+//
+// Producers push tasks by creating keys under the prefix. Workers claim tasks
+// by acquiring a lock on their keys with a session, and delete the keys when
+// the tasks are completed. When the session of a worker is lost, consul
+// releases the locks it held, and the tasks it claimed are requeued.
+//
+// Tasks are claimed in the order in which they were pushed, but may complete in
+// any order, and may be processed more than once if a worker loses its claim
+// before completing a task.
+type WorkQueue struct {
+	// The client used to send requests to the consul agent. If nil, the default
+	// client is used instead.
+	Client *Client
+
+	// The key prefix under which tasks are stored.
+	Prefix string
+
+	// LockDelay is the time during which the tasks claimed by a worker which
+	// session expired cannot be claimed by other workers. Defaults to 15s.
+	LockDelay time.Duration
+
+	// The clock used to renew the sessions of workers and to schedule retries
+	// of Claim. If nil, DefaultClock is used.
+	Clock Clock
+
+	// SessionStore may be set to persist the session ID of workers, so a
+	// worker restarting after a crash keeps the task it claimed. Workers using
+	// it must claim one task at a time. See Locker.SessionStore.
+	SessionStore SessionStore
+}
+
+// A Task is a task claimed from a work queue.
+type Task struct {
+	// The key of the task in the consul key/value store.
+	Key string
+
+	// The value that the task was pushed with.
+	Value []byte
+
+	queue  *WorkQueue
+	index  uint64 // modify index of the key when the task was claimed
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Context returns a context which is canceled when the claim on the task is
+// released, or lost, in which case its Err method returns Unlocked. Workers
+// should stop processing the task when the context is canceled.
+func (t *Task) Context() context.Context {
+	return t.ctx
+}
+
+// Complete deletes the task from the queue and releases the claim on it. It
+// returns Unlocked if the claim was lost, the task was then requeued and may
+// be claimed by another worker.
+func (t *Task) Complete(ctx context.Context) error {
+	defer t.cancel()
+
+	if err := t.ctx.Err(); err != nil {
+		return err
+	}
+
+	// The claim may be lost after the context was checked, and the task claimed
+	// by another worker, which modifies its key. The compare-and-swap prevents
+	// deleting the task while it's processed by the other worker.
+	var ok bool
+	query := Query{{"cas", strconv.FormatUint(t.index, 10)}}
+
+	if err := t.queue.client().Delete(ctx, "/v1/kv/"+t.Key, query, &ok); err != nil {
+		return err
+	}
+	if !ok {
+		return Unlocked
+	}
+	return nil
+}
+
+// Requeue releases the claim on the task, which may then be claimed again by
+// any worker.
+func (t *Task) Requeue() {
+	t.cancel()
+}
+
+// Push adds a task with value to the queue, returning the key it was stored
+// at.
+func (q *WorkQueue) Push(ctx context.Context, value []byte) (key string, err error) {
+	var ok bool
+	key = q.prefix() + newTaskID(clockOrDefault(q.Clock).Now())
+
+	if ok, err = q.client().putKV(ctx, key, Query{{"cas", "0"}}, value); err == nil && !ok {
+		err = fmt.Errorf("consul: the key %s of the new task already exists", key)
+	}
+	return
+}
+
+// Claim blocks until a task of the queue was claimed, or the context was
+// canceled. The claim is held until the task is completed or requeued.
+func (q *WorkQueue) Claim(ctx context.Context) (*Task, error) {
+	prefix := q.prefix()
+	locker := q.locker()
+	clock := clockOrDefault(q.Clock)
+
+	sessionCtx, sessionCancel := locker.withSession(ctx, makeSessionName("work-queue: ", prefix))
+
+	if err := sessionCtx.Err(); err != nil {
+		sessionCancel()
+		return nil, err
+	}
+
+	// Tasks held by a session loaded from the store were claimed by the
+	// previous process of the worker, they would never be requeued if they
+	// weren't claimed again.
+	var adopted SessionID
+	if q.SessionStore != nil && ctx.Value(SessionKey) == nil {
+		adopted = contextSession(sessionCtx).ID
+	}
+
+	var index uint64
+
+	for {
+		entries, lastIndex, err := q.fetchTasks(sessionCtx, prefix, index)
+		if err != nil {
+			sessionCancel()
+			return nil, coalesceError(ctx.Err(), err)
+		}
+
+		retry := false
+
+		for _, e := range entries {
+			if len(e.Session) != 0 && e.Session != adopted {
+				continue
+			}
+
+			lock, unlock, err := locker.tryLockAt(sessionCtx, e.Key, uint64(e.ModifyIndex), e.Value)
+			if lock != nil {
+				return &Task{
+					Key:    e.Key,
+					Value:  e.Value,
+					queue:  q,
+					index:  FencingTokens(lock)[0].ModifyIndex,
+					ctx:    lock,
+					cancel: func() { unlock(); sessionCancel() },
+				}, nil
+			}
+
+			// The task may have been claimed or completed concurrently, which
+			// changes the queue, but the lock delay of a session which expired
+			// also prevents claiming it until it elapses.
+			if err == nil {
+				retry = true
+			}
+		}
+
+		if retry {
+			if err := Sleep(sessionCtx, clock, time.Second); err != nil {
+				sessionCancel()
+				return nil, coalesceError(ctx.Err(), err)
+			}
+			index = 0
+		} else {
+			index = lastIndex
+		}
+	}
+}
+
+// fetchTasks returns the tasks stored under prefix, in the order in which they
+// were pushed, waiting for the queue to change after index if it is not zero.
+func (q *WorkQueue) fetchTasks(ctx context.Context, prefix string, index uint64) (tasks []KeyData, lastIndex uint64, err error) {
+	query := Query{{"recurse", ""}}
+	if index != 0 {
+		query = append(query, Param{"index", strconv.FormatUint(index, 10)})
+	}
+
+	meta, err := q.client().do(ctx, "GET", "/v1/kv/"+prefix, query, nil, &tasks)
+	lastIndex = meta.index
+
+	if errors.Is(err, ErrNotFound) {
+		tasks, err = nil, nil
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].CreateIndex < tasks[j].CreateIndex
+	})
+	return
+}
+
+func (q *WorkQueue) locker() *Locker {
+	return &Locker{
+		Client:         q.Client,
+		LockDelay:      q.LockDelay,
+		UnlockBehavior: Release,
+		Clock:          q.Clock,
+		SessionStore:   q.SessionStore,
+	}
+}
+
+func (q *WorkQueue) prefix() string {
+	return strings.TrimSuffix(q.Prefix, "/") + "/"
+}
+
+func (q *WorkQueue) client() *Client {
+	if client := q.Client; client != nil {
+		return client
+	}
+	return DefaultClient
+}
+
+// newTaskID returns a random task ID, prefixed with the time so the keys of
+// tasks sort in the order in which they were pushed when listed.
+func newTaskID(now time.Time) string {
+	var b [8]byte
+	rand.Read(b[:])
+	return fmt.Sprintf("%016x-%s", now.UnixNano(), hex.EncodeToString(b[:]))
+}
@@ -0,0 +1,174 @@
+package consul_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	consul "github.com/segmentio/consul-go"
+)
+
+func TestWorkQueue(t *testing.T) {
+	agent, ctx := newFakeAgent(t)
+
+	queue := &consul.WorkQueue{
+		Client:    agent.Client(),
+		Prefix:    "tasks",
+		LockDelay: 100 * time.Millisecond,
+	}
+
+	for _, value := range []string{"A", "B", "C"} {
+		if _, err := queue.Push(ctx, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	claim := func(value string) *consul.Task {
+		t.Helper()
+		task, err := queue.Claim(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(task.Value) != value {
+			t.Errorf("expected to claim task %s but got %s", value, task.Value)
+		}
+		return task
+	}
+
+	taskA := claim("A")
+	taskB := claim("B")
+
+	if err := taskA.Complete(ctx); err != nil {
+		t.Error(err)
+	}
+	if keys := listKeys(t, agent, taskA.Key); len(keys) != 0 {
+		t.Error("the completed task was not deleted")
+	}
+
+	taskB.Requeue()
+	taskB = claim("B")
+
+	session := taskB.Context().Value(consul.SessionKey).(consul.Session)
+	if !agent.InvalidateSession(session.ID) {
+		t.Fatal("the session was not found")
+	}
+
+	select {
+	case <-taskB.Context().Done():
+	case <-ctx.Done():
+		t.Fatal("the claim was not lost after its session was invalidated")
+	}
+
+	if err := taskB.Complete(ctx); !errors.Is(err, consul.Unlocked) {
+		t.Error("completing a task which claim was lost must fail:", err)
+	}
+
+	// The task is requeued, with its value, after the lock delay.
+	for _, value := range []string{"B", "C"} {
+		if err := claim(value).Complete(ctx); err != nil {
+			t.Error(err)
+		}
+	}
+
+	claimed := make(chan *consul.Task)
+	go func() {
+		task, err := queue.Claim(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		claimed <- task
+	}()
+
+	if _, err := queue.Push(ctx, []byte("D")); err != nil {
+		t.Fatal(err)
+	}
+
+	if task := <-claimed; task != nil {
+		if string(task.Value) != "D" {
+			t.Error("bad task:", string(task.Value))
+		}
+		task.Complete(ctx)
+	}
+
+	// A task which key was modified since it was claimed, for example because
+	// it was claimed by another worker, must not be deleted.
+	if _, err := queue.Push(ctx, []byte("E")); err != nil {
+		t.Fatal(err)
+	}
+
+	taskE := claim("E")
+	agent.Put(taskE.Key, []byte("E"))
+
+	if err := taskE.Complete(ctx); !errors.Is(err, consul.Unlocked) {
+		t.Error("completing a task which key was modified must fail:", err)
+	}
+	if err := claim("E").Complete(ctx); err != nil {
+		t.Error("the task was deleted while its key was modified:", err)
+	}
+
+	if n := len(listKeys(t, agent, "tasks/")); n != 0 {
+		t.Error("tasks were left in the queue:", n)
+	}
+}
+
+func TestWorkQueueSessionStore(t *testing.T) {
+	agent, ctx := newFakeAgent(t)
+
+	newQueue := func() *consul.WorkQueue {
+		return &consul.WorkQueue{
+			Client:       agent.Client(),
+			Prefix:       "tasks",
+			LockDelay:    time.Minute,
+			SessionStore: &consul.SessionFile{Path: filepath.Join(t.TempDir(), "session")},
+		}
+	}
+
+	queue := newQueue()
+	if _, err := queue.Push(ctx, []byte("A")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The worker crashes while processing the task, and restarts with the
+	// same session store.
+	task1, err := queue.Claim(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := *queue
+	restartCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	task2, err := restarted.Claim(restartCtx)
+	if err != nil {
+		t.Fatal("the task was not claimed again after the restart:", err)
+	}
+	if task2.Key != task1.Key {
+		t.Errorf("claimed %s instead of %s", task2.Key, task1.Key)
+	}
+
+	if err := task2.Complete(ctx); err != nil {
+		t.Error(err)
+	}
+	if keys := listKeys(t, agent, "tasks/"); len(keys) != 0 {
+		t.Error("the task was not completed:", keys)
+	}
+
+	// Claims from workers with other sessions still skip the claimed tasks.
+	if _, err := queue.Push(ctx, []byte("B")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.Claim(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newQueue()
+	otherCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	if task, err := other.Claim(otherCtx); err == nil {
+		t.Error("a task held by another worker was claimed:", task.Key)
+	}
+}